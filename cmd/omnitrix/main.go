@@ -0,0 +1,14 @@
+// Command omnitrix is a coding assistant for the terminal
+package main
+
+import (
+	"os"
+
+	"github.com/omnitrix-sh/core.sh/internal/cli"
+)
+
+func main() {
+	if err := cli.Execute(); err != nil {
+		os.Exit(1)
+	}
+}
@@ -3,17 +3,37 @@ package agent
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"sync"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/omnitrix-sh/core.sh/internal/archive"
+	"github.com/omnitrix-sh/core.sh/internal/checkpoint"
 	"github.com/omnitrix-sh/core.sh/internal/db"
+	"github.com/omnitrix-sh/core.sh/internal/events"
+	"github.com/omnitrix-sh/core.sh/internal/format"
+	"github.com/omnitrix-sh/core.sh/internal/lsp"
+	"github.com/omnitrix-sh/core.sh/internal/permissions"
+	"github.com/omnitrix-sh/core.sh/internal/postprocess"
+	"github.com/omnitrix-sh/core.sh/internal/pricing"
+	"github.com/omnitrix-sh/core.sh/internal/prompt"
+	"github.com/omnitrix-sh/core.sh/internal/promptlog"
 	"github.com/omnitrix-sh/core.sh/internal/providers/ollama"
 	"github.com/omnitrix-sh/core.sh/internal/providers/openai"
+	"github.com/omnitrix-sh/core.sh/internal/pseudonym"
+	"github.com/omnitrix-sh/core.sh/internal/secrets"
+	"github.com/omnitrix-sh/core.sh/internal/stream"
 	"github.com/omnitrix-sh/core.sh/internal/tools"
 	"github.com/omnitrix-sh/core.sh/pkg/models"
 )
 
+// maxProviderRetries is how many times a rate limited or overloaded
+// provider call is retried before giving up
+const maxProviderRetries = 3
+
 type Agent struct {
 	provider models.ProviderType
 	model    string
@@ -21,6 +41,59 @@ type Agent struct {
 	queries  *db.Queries
 	ollama   *ollama.Provider
 	openai   *openai.Provider
+	external Provider // serves other providers, see SetProvider
+	sampling models.SamplingParams
+	profile  models.ModelProfile          // see SetModelProfile
+	aliases  map[string]models.ModelAlias // see SetModelAliases
+
+	promptLog    *promptlog.Logger
+	archive      *archive.Archive
+	pricing      *pricing.Catalog
+	systemPrompt *prompt.Builder
+
+	permissions *permissions.Checker
+	approver    permissions.Approver
+	approveMu   sync.Mutex // puts one question to the approver at a time
+	postProcess *postprocess.Pipeline
+	language    string // response language, see SetLanguage
+	mode        Mode   // of sessions that chose none, see SetMode
+	streamOpts  stream.Options
+	lsp         *lsp.Manager   // checks files tools write, see SetDiagnostics
+	formatters  *format.Runner // formats files tools write, see SetFormatters
+	events      *events.Bus
+	checkpoints *checkpoint.Store // snapshots taken before each turn
+	secrets     *secrets.Guard    // scans requests, see SetSecretsGuard
+	pseudonyms  *pseudonym.Mapper // see SetPseudonymizer
+
+	contextSize int
+	overflow    string
+	retrieval   models.RetrievalConfig     // see SetRetrieval
+	limits      models.MessageLimitsConfig // see SetMessageLimits
+	runLimits   models.RunLimits           // see SetRunLimits
+	toolExec    models.ToolExecutionConfig // see SetToolExecution
+	tasks       models.TaskConfig          // see SetTasks
+	memory      models.MemoryConfig        // see SetMemory
+
+	env map[string]string // defaults for every session, see SetEnv
+
+	schemaMu      sync.Mutex
+	schemaMode    string
+	expandedTools map[string]map[string]bool // session ID -> tool names
+
+	writer *db.MessageWriter
+	reader *db.Queries // read-only replica for reporting, see SetReadReplica
+
+	forgetMu    sync.Mutex
+	toolResults map[string]map[string]string // session ID -> tool call ID -> message ID
+	forgotten   map[string]map[string]bool   // session ID -> message IDs
+
+	runMu sync.Mutex
+	runs  map[string]*sessionRun // session ID -> run in progress, see Enqueue
+
+	// reloadMu guards the settings a reloaded config changes while
+	// sessions run: tools, aliases, promptLog and formatters
+	reloadMu   sync.RWMutex
+	configured map[string]bool // names of the tools given to New or SetTools
 }
 
 func New(provider models.ProviderType, model, baseURL, apiKey string, queries *db.Queries, availableTools []tools.Tool) *Agent {
@@ -33,75 +106,285 @@ func New(provider models.ProviderType, model, baseURL, apiKey string, queries *d
 		openaiProvider = openai.NewProvider(apiKey, model)
 	}
 
-	return &Agent{
+	a := &Agent{
 		provider: provider,
 		model:    model,
-		tools:    availableTools,
 		queries:  queries,
 		ollama:   ollamaProvider,
 		openai:   openaiProvider,
+		pricing:  pricing.NewCatalog(nil),
+	}
+	a.configured = toolNames(availableTools)
+	a.tools = append(append([]tools.Tool{}, availableTools...), &forgetTool{agent: a}, &searchTool{agent: a},
+		tools.Typed[readAttachmentArgs](&readAttachmentTool{agent: a}), tools.Typed[taskArgs](&taskTool{agent: a}),
+		tools.Typed[rememberArgs](&rememberTool{agent: a}), tools.Typed[askArgs](&askTool{agent: a}))
+	return a
+}
+
+// SetSamplingParams sets the generation defaults applied to every request,
+// typically from config.SamplingParamsFor
+func (a *Agent) SetSamplingParams(params models.SamplingParams) {
+	a.sampling = params
+}
+
+// SetOllamaOptions sets the Ollama model options and keep_alive from the
+// provider config. It has no effect for other providers.
+func (a *Agent) SetOllamaOptions(options map[string]interface{}, keepAlive string) {
+	if a.ollama == nil {
+		return
+	}
+	a.ollama.SetOptions(options, keepAlive)
+
+	// Ollama silently truncates prompts longer than num_ctx, so use it as
+	// the context limit unless one was set explicitly
+	if a.contextSize == 0 {
+		if numCtx, ok := intOption(options["num_ctx"]); ok && numCtx > 0 {
+			a.contextSize = numCtx
+		}
 	}
 }
 
-func (a *Agent) Chat(ctx context.Context, sessionID, userMessage string) (string, error) {
-	messages, err := a.queries.ListMessagesBySession(ctx, sessionID)
+// intOption reads a whole number from an option, which is a float64 when
+// decoded from JSON but may be any numeric type when set in code
+func intOption(value interface{}) (int, bool) {
+	switch v := value.(type) {
+	case int:
+		return v, true
+	case int8:
+		return int(v), true
+	case int16:
+		return int(v), true
+	case int32:
+		return int(v), true
+	case int64:
+		return int(v), true
+	case uint:
+		return int(v), true
+	case uint8:
+		return int(v), true
+	case uint16:
+		return int(v), true
+	case uint32:
+		return int(v), true
+	case uint64:
+		return int(v), true
+	case float32:
+		return int(v), true
+	case float64:
+		return int(v), true
+	case json.Number:
+		n, err := v.Int64()
+		return int(n), err == nil
+	}
+	return 0, false
+}
+
+// SetPricing overrides built-in model prices, typically from Config.Pricing
+func (a *Agent) SetPricing(overrides map[string]models.ModelPrice) {
+	a.pricing = pricing.NewCatalog(overrides)
+}
+
+// SetSystemPrompt sets the builder for the system prompt sent first in every
+// request. Without one no system prompt is sent.
+func (a *Agent) SetSystemPrompt(builder *prompt.Builder) {
+	a.systemPrompt = builder
+}
+
+// SetPermissions checks every tool execution against checker, asking
+// approver when the policy says to. Without an approver such executions are
+// denied; without a checker every tool runs.
+func (a *Agent) SetPermissions(checker *permissions.Checker, approver permissions.Approver) {
+	a.permissions = checker
+	a.approver = approver
+}
+
+// SetPostProcessor sets the pipeline final assistant output passes through
+// before it is saved and returned
+func (a *Agent) SetPostProcessor(pipeline *postprocess.Pipeline) {
+	a.postProcess = pipeline
+}
+
+// SetArchive records every provider exchange in archive, see archive.New
+func (a *Agent) SetArchive(archive *archive.Archive) {
+	a.archive = archive
+}
+
+// sessionPostProcess returns the post-processing pipeline for a session,
+// enforcing its response language
+func (a *Agent) sessionPostProcess(ctx context.Context, sessionID string) (*postprocess.Pipeline, error) {
+	language, err := a.SessionLanguage(ctx, sessionID)
 	if err != nil {
-		return "", fmt.Errorf("failed to load messages: %w", err)
+		return nil, err
 	}
+	return a.postProcess.WithLanguage(language)
+}
+
+// SetSecretsGuard scans every request for credentials before it is sent,
+// see secrets.New
+func (a *Agent) SetSecretsGuard(guard *secrets.Guard) {
+	a.secrets = guard
+}
+
+// SetPseudonymizer replaces identifying details in requests with
+// stand-ins and restores them in responses, see pseudonym.New
+func (a *Agent) SetPseudonymizer(mapper *pseudonym.Mapper) {
+	a.pseudonyms = mapper
+}
 
-	modelMessages := make([]models.Message, len(messages))
-	for i, msg := range messages {
-		modelMessages[i] = models.Message{
-			ID:        msg.ID,
-			SessionID: msg.SessionID,
-			Role:      models.Role(msg.Role),
-			Content:   msg.Content,
-			CreatedAt: time.Unix(msg.CreatedAt, 0),
+// SetEventBus publishes the progress of runs on bus
+func (a *Agent) SetEventBus(bus *events.Bus) {
+	a.events = bus
+}
+
+// SetStreamOptions sets how Stream delivers deltas, see stream.Relay
+func (a *Agent) SetStreamOptions(opts stream.Options) {
+	a.streamOpts = opts
+}
+
+// SetReadReplica serves history pages and cost reports from conn, a
+// read-only pool from db.ConnectReadOnly, so they never wait on the
+// connection the agent writes through
+func (a *Agent) SetReadReplica(conn *sql.DB) {
+	a.reader = db.New(conn)
+}
+
+// readQueries returns the queries for reporting reads
+func (a *Agent) readQueries() *db.Queries {
+	if a.reader != nil {
+		return a.reader
+	}
+	return a.queries
+}
+
+// SetMessageWriter batches message writes through writer, one transaction
+// per step of a turn instead of one per message
+func (a *Agent) SetMessageWriter(writer *db.MessageWriter) {
+	a.writer = writer
+}
+
+// SetPromptLogger enables logging of every request sent to the provider.
+// A nil logger disables it.
+func (a *Agent) SetPromptLogger(logger *promptlog.Logger) {
+	a.reloadMu.Lock()
+	defer a.reloadMu.Unlock()
+	a.promptLog = logger
+}
+
+// Chat sends a user message and runs the tool loop until the model replies.
+// Optional parts such as images are sent with the message but not persisted.
+// If the session has a run in progress, Chat waits for it to end; messages
+// sent meanwhile with Enqueue join the loop. A cancelled run leaves the
+// session ready for the next message.
+func (a *Agent) Chat(ctx context.Context, sessionID, userMessage string, parts ...models.ContentPart) (string, error) {
+	return a.turn(ctx, sessionID, func(ctx context.Context) (string, error) {
+		return a.runChat(ctx, sessionID, userMessage, parts...)
+	})
+}
+
+// turn runs fn as the session's run, see Chat
+func (a *Agent) turn(ctx context.Context, sessionID string, fn func(ctx context.Context) (string, error)) (string, error) {
+	ctx, run, err := a.beginRun(ctx, sessionID, false)
+	if err != nil {
+		return "", err
+	}
+	defer a.endRun(sessionID, run)
+	started := time.Now()
+	reply, err := fn(ctx)
+	if err != nil && ctx.Err() != nil {
+		// Whatever failed, it failed because the run was cancelled
+		err = ctx.Err()
+		if cleanupErr := a.interrupt(context.WithoutCancel(ctx), sessionID, "", ""); cleanupErr != nil {
+			err = fmt.Errorf("%w (%v)", err, cleanupErr)
 		}
 	}
+	a.publishRun(sessionID, reply, err, started)
+	return reply, err
+}
+
+func (a *Agent) runChat(ctx context.Context, sessionID, userMessage string, parts ...models.ContentPart) (string, error) {
+	prompt, err := a.assemble(ctx, sessionID)
+	if err != nil {
+		return "", err
+	}
 
 	userMsg := models.Message{
 		ID:        uuid.New().String(),
 		SessionID: sessionID,
 		Role:      models.RoleUser,
 		Content:   userMessage,
+		Parts:     parts,
 		CreatedAt: time.Now(),
 	}
-	modelMessages = append(modelMessages, userMsg)
+	if err := a.limitMessage(ctx, &userMsg); err != nil {
+		return "", err
+	}
 
+	env, err := a.SessionEnv(ctx, sessionID)
+	if err != nil {
+		return "", err
+	}
+	toolCtx := withMode(tools.WithSessionID(tools.WithEnv(ctx, env), sessionID), prompt.mode)
+
+	postProcess, err := a.sessionPostProcess(ctx, sessionID)
+	if err != nil {
+		return "", err
+	}
+
+	prompt = a.compact(ctx, sessionID, prompt, userMsg)
+	prompt = a.retrieve(ctx, sessionID, prompt, userMsg)
+	prompt = a.recall(ctx, sessionID, prompt, userMsg)
+	modelMessages := append(prompt.messages(), userMsg)
+
+	if err := a.recordConfig(ctx, sessionID); err != nil {
+		return "", err
+	}
 	if err := a.saveMessage(ctx, userMsg); err != nil {
 		return "", fmt.Errorf("failed to save user message: %w", err)
 	}
+	a.checkpoint(ctx, sessionID, userMsg.ID, userMessage)
 
-	modelTools := make([]models.Tool, len(a.tools))
-	for i, tool := range a.tools {
-		modelTools[i] = tools.ToModelTool(tool)
-	}
+	status := events.NewReporter(a.events, sessionID, string(a.provider))
+	defer status.Stop()
 
 	// Tool calling loop
-	maxIterations := 10
+	model := a.runModel(ctx)
+	maxIterations := a.maxIterations()
+	retried := false
+	var spent float64
 	for i := 0; i < maxIterations; i++ {
+		if err := a.checkRunCost(spent); err != nil {
+			return "", err
+		}
 		req := models.ChatRequest{
-			Model:    a.model,
+			Model:    model,
 			Messages: modelMessages,
-			Tools:    modelTools,
+			Tools:    a.toolSchemas(sessionID, prompt.mode),
 			Stream:   false,
 		}
-
-		var response *models.ChatResponse
-		switch a.provider {
-		case models.ProviderOllama:
-			response, err = a.ollama.Chat(ctx, req)
-		case models.ProviderOpenAI:
-			response, err = a.openai.Chat(ctx, req)
-		default:
-			return "", fmt.Errorf("unsupported provider: %s", a.provider)
+		a.fitModel(&req)
+		seedRequest(&req)
+		scrubEnv(&req, env)
+		if err := a.preflight(&req); err != nil {
+			return "", err
 		}
+		a.logPrompt(sessionID, req)
+		params := a.runParams(req)
 
+		status.Set(events.StateWaiting, "")
+		response, err := a.chat(ctx, req)
 		if err != nil {
+			a.archiveExchange(ctx, sessionID, "", req, nil, err)
 			return "", fmt.Errorf("failed to call provider: %w", err)
 		}
 
+		response.Cost = a.pricing.Cost(model, response.Usage)
+		spent += response.Cost
+		if err := a.recordUsage(ctx, sessionID, response.Usage, response.Cost); err != nil {
+			return "", err
+		}
+		params.ResponseModel = response.Model
+		params.SystemFingerprint = response.Fingerprint
+
 		// If content is empty and we have tool calls, set empty string
 		content := response.Content
 		if content == "" && len(response.ToolCalls) > 0 {
@@ -113,41 +396,87 @@ func (a *Agent) Chat(ctx context.Context, sessionID, userMessage string) (string
 			SessionID: sessionID,
 			Role:      models.RoleAssistant,
 			Content:   content,
+			Reasoning: response.Reasoning,
 			Model:     response.Model,
+			Params:    params,
 			ToolCalls: response.ToolCalls,
 			CreatedAt: time.Now(),
 		}
+		a.archiveExchange(ctx, sessionID, assistantMsg.ID, req, response, nil)
 
 		// If no tool calls, we're done
 		if len(response.ToolCalls) == 0 {
+			processed, err := postProcess.Run(content)
+			var retry *postprocess.RetryError
+			if errors.As(err, &retry) && !retried {
+				// Ask once for a corrected answer, the rejected one is not saved
+				retried = true
+				modelMessages = append(modelMessages, assistantMsg, models.Message{
+					SessionID: sessionID,
+					Role:      models.RoleUser,
+					Content:   retry.Instruction,
+				})
+				continue
+			}
+			if err != nil && retry == nil {
+				return "", fmt.Errorf("failed to post-process response: %w", err)
+			}
+
+			assistantMsg.Content = processed
 			if err := a.saveMessage(ctx, assistantMsg); err != nil {
 				return "", fmt.Errorf("failed to save assistant message: %w", err)
 			}
-			return response.Content, nil
+			if err := a.commitMessages(ctx); err != nil {
+				return "", err
+			}
+
+			// Messages queued meanwhile start a turn of their own
+			queued, err := a.sendQueued(ctx, sessionID, true)
+			if err != nil {
+				return "", err
+			}
+			if len(queued) == 0 {
+				return processed, nil
+			}
+			modelMessages = append(append(modelMessages, assistantMsg), queued...)
+			if err := a.commitMessages(ctx); err != nil {
+				return "", err
+			}
+			retried = false
+			i = -1
+			continue
 		}
 		
 		// Save assistant message with tool calls
 		if err := a.saveMessage(ctx, assistantMsg); err != nil {
 			return "", fmt.Errorf("failed to save assistant message: %w", err)
 		}
+		a.expandTools(sessionID, response.ToolCalls)
 
 		modelMessages = append(modelMessages, assistantMsg)
 
-		// Execute tool calls
-		for _, toolCall := range response.ToolCalls {
-			result, err := a.executeTool(ctx, toolCall)
-
+		// Execute tool calls, results are added in the order of the calls
+		runs := a.runToolCalls(toolCtx, sessionID, response.ToolCalls, status)
+		results := make([]string, len(runs))
+		for i, run := range runs {
+			results[i] = run.result
+			if run.err != nil {
+				results[i] = fmt.Sprintf("Error: %v", run.err)
+			}
+		}
+		limits := a.toolResultLimits(response.ToolCalls, results)
+		for i, toolCall := range response.ToolCalls {
 			toolResultMsg := models.Message{
 				ID:         uuid.New().String(),
 				SessionID:  sessionID,
 				Role:       models.RoleTool,
 				ToolCallID: toolCall.ID,
-				Content:    result,
+				Content:    results[i],
 				CreatedAt:  time.Now(),
 			}
 
-			if err != nil {
-				toolResultMsg.Content = fmt.Sprintf("Error: %v", err)
+			if err := a.limitMessageTo(ctx, &toolResultMsg, limits[i]); err != nil {
+				return "", err
 			}
 
 			modelMessages = append(modelMessages, toolResultMsg)
@@ -155,15 +484,130 @@ func (a *Agent) Chat(ctx context.Context, sessionID, userMessage string) (string
 			if err := a.saveMessage(ctx, toolResultMsg); err != nil {
 				return "", fmt.Errorf("failed to save tool result: %w", err)
 			}
+			a.rememberToolResult(sessionID, toolCall.ID, toolResultMsg.ID)
+		}
+		if msg, ok := toolImages(sessionID, runs); ok {
+			modelMessages = append(modelMessages, msg)
+		}
+		queued, err := a.sendQueued(ctx, sessionID, false)
+		if err != nil {
+			return "", err
+		}
+		modelMessages = append(modelMessages, queued...)
+		a.applyForgotten(sessionID, modelMessages)
+
+		if err := a.commitMessages(ctx); err != nil {
+			return "", err
 		}
 	}
 
-	return "", fmt.Errorf("exceeded maximum iterations (%d)", maxIterations)
+	return "", fmt.Errorf("%w (%d)", ErrIterationLimit, maxIterations)
 }
 
-func (a *Agent) executeTool(ctx context.Context, toolCall models.ToolCall) (string, error) {
+// chat sends a request to the configured provider, retrying with backoff
+// when the provider reports it is rate limited or overloaded.
+func (a *Agent) chat(ctx context.Context, req models.ChatRequest) (*models.ChatResponse, error) {
+	if err := a.secrets.Check(ctx, string(a.provider), &req); err != nil {
+		return nil, err
+	}
+	req = a.pseudonyms.Request(string(a.provider), req)
+
+	backoff := time.Second
+	for attempt := 0; ; attempt++ {
+		var response *models.ChatResponse
+		var err error
+		switch a.provider {
+		case models.ProviderOllama:
+			response, err = a.ollama.Chat(ctx, req)
+		case models.ProviderOpenAI:
+			response, err = a.openai.Chat(ctx, req)
+		default:
+			if a.external == nil {
+				return nil, fmt.Errorf("unsupported provider: %s", a.provider)
+			}
+			response, err = a.external.Chat(ctx, req)
+		}
+
+		if err == nil {
+			a.pseudonyms.Response(string(a.provider), response)
+			return response, nil
+		}
+
+		retryable := errors.Is(err, models.ErrRateLimited) || errors.Is(err, models.ErrOverloaded)
+		if !retryable || attempt >= maxProviderRetries {
+			return nil, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// recordUsage adds a response's token usage and cost to the session totals
+func (a *Agent) recordUsage(ctx context.Context, sessionID string, usage models.TokenUsage, cost float64) error {
+	_, err := a.queries.AddSessionUsage(ctx, db.AddSessionUsageParams{
+		PromptTokens:     int64(usage.PromptTokens),
+		CompletionTokens: int64(usage.CompletionTokens),
+		Cost:             cost,
+		UpdatedAt:        time.Now().Unix(),
+		ID:               sessionID,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to record usage: %w", err)
+	}
+	return nil
+}
+
+// SessionCost returns the accumulated token usage and cost of a session
+func (a *Agent) SessionCost(ctx context.Context, sessionID string) (*SessionCost, error) {
+	row, err := a.readQueries().GetSessionCost(ctx, sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get session cost: %w", err)
+	}
+	return &SessionCost{
+		PromptTokens:     row.PromptTokens,
+		CompletionTokens: row.CompletionTokens,
+		Cost:             row.Cost,
+	}, nil
+}
+
+// SessionCost is the usage and cost of a session so far
+type SessionCost struct {
+	PromptTokens     int64   `json:"prompt_tokens"`
+	CompletionTokens int64   `json:"completion_tokens"`
+	Cost             float64 `json:"cost"` // USD
+}
+
+// archiveExchange records a provider call in the archive. Like the prompt
+// log it is a debugging aid, so failures are ignored.
+func (a *Agent) archiveExchange(ctx context.Context, sessionID, messageID string, req models.ChatRequest, response *models.ChatResponse, callErr error) {
+	ex := archive.Exchange{
+		SessionID: sessionID,
+		MessageID: messageID,
+		Provider:  string(a.provider),
+		Model:     req.Model,
+		Request:   req,
+		Response:  response,
+	}
+	if callErr != nil {
+		ex.Error = callErr.Error()
+	}
+	a.archive.Record(ctx, ex)
+}
+
+// logPrompt records a request in the prompt log. Logging is a debugging aid,
+// so a failure to write it never fails the request.
+func (a *Agent) logPrompt(sessionID string, req models.ChatRequest) {
+	a.logger().Log(sessionID, a.provider, req)
+}
+
+func (a *Agent) executeTool(ctx context.Context, sessionID string, toolCall models.ToolCall) (string, error) {
 	var tool tools.Tool
-	for _, t := range a.tools {
+	for _, t := range a.toolList() {
 		if t.Name() == toolCall.Function.Name {
 			tool = t
 			break
@@ -173,30 +617,107 @@ func (a *Agent) executeTool(ctx context.Context, toolCall models.ToolCall) (stri
 	if tool == nil {
 		return "", fmt.Errorf("unknown tool: %s", toolCall.Function.Name)
 	}
+	if !modeOf(ctx).allows(tool) {
+		return "", fmt.Errorf("%s is not available in plan mode, which only reads the project; finish the plan and the user will switch to build mode to carry it out", tool.Name())
+	}
+	// Malformed calls go back to the model before anyone is asked to
+	// approve them
+	if err := tools.ValidateArgs(tool, toolCall.Function.Arguments); err != nil {
+		return "", err
+	}
 
-	result, err := tool.Execute(ctx, toolCall.Function.Arguments)
+	if err := a.authorize(ctx, sessionID, tool, toolCall.Function.Arguments); err != nil {
+		return "", err
+	}
+
+	// The timeout only starts now, so time spent waiting for approval
+	// doesn't count against it
+	runCtx := ctx
+	timeout := a.toolTimeout(tool.Name())
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		runCtx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	result, err := a.runTool(runCtx, tool, toolCall.Function.Arguments)
 	if err != nil {
+		if ctx.Err() == nil && errors.Is(runCtx.Err(), context.DeadlineExceeded) {
+			return "", fmt.Errorf("%s timed out after %s", tool.Name(), timeout)
+		}
 		return "", err
 	}
 
 	return result, nil
 }
 
-func (a *Agent) Stream(ctx context.Context, sessionID, userMessage string) (<-chan string, error) {
-	messages, err := a.queries.ListMessagesBySession(ctx, sessionID)
+// authorize checks a tool execution against the permission policy, asking
+// the approver when required
+func (a *Agent) authorize(ctx context.Context, sessionID string, tool tools.Tool, args map[string]interface{}) error {
+	if a.permissions == nil {
+		return nil
+	}
+
+	req, err := permissions.NewRequest(ctx, sessionID, tool, args)
+	if err != nil {
+		return fmt.Errorf("permission denied: can't tell which files %s changes: %w", tool.Name(), err)
+	}
+	if rule, ok := a.permissions.Guard(req); ok {
+		return fmt.Errorf("permission denied: %s is blocked by the project rule %q in %s", tool.Name(), rule.String(), permissions.RulesFile)
+	}
+	switch a.permissions.Check(req) {
+	case permissions.Allow:
+		return nil
+	case permissions.Deny:
+		return fmt.Errorf("permission denied: %s is not allowed by policy", tool.Name())
+	}
+
+	if a.approver == nil {
+		return fmt.Errorf("permission denied: %s requires approval and no approver is available", tool.Name())
+	}
+	if previewer, ok := tool.(tools.Previewer); ok {
+		req.Preview, _ = previewer.Preview(ctx, args)
+	}
+	// Tool calls may run concurrently, but the user answers one at a time
+	a.approveMu.Lock()
+	defer a.approveMu.Unlock()
+	a.events.Publish(events.Event{Type: events.TypePermission, SessionID: sessionID, Permission: &req})
+	approved, err := a.approver.Approve(ctx, req)
 	if err != nil {
-		return nil, fmt.Errorf("failed to load messages: %w", err)
+		return fmt.Errorf("failed to get approval: %w", err)
 	}
+	if !approved {
+		return fmt.Errorf("permission denied: the user declined to run %s", tool.Name())
+	}
+	return nil
+}
 
-	modelMessages := make([]models.Message, len(messages))
-	for i, msg := range messages {
-		modelMessages[i] = models.Message{
-			ID:        msg.ID,
-			SessionID: msg.SessionID,
-			Role:      models.Role(msg.Role),
-			Content:   msg.Content,
-			CreatedAt: time.Unix(msg.CreatedAt, 0),
+// Stream sends a user message and returns the reply as it arrives. Tools
+// are not run. Like Chat, it waits for a run in progress in the session.
+// Read the channel until it closes or cancel ctx: the session's run only
+// ends once the whole reply was read.
+func (a *Agent) Stream(ctx context.Context, sessionID, userMessage string, parts ...models.ContentPart) (<-chan string, error) {
+	ctx, run, err := a.beginRun(ctx, sessionID, true)
+	if err != nil {
+		return nil, err
+	}
+	out, err := a.runStream(ctx, sessionID, userMessage, time.Now(), run, parts...)
+	if err != nil {
+		if ctx.Err() != nil {
+			err = ctx.Err()
+			if cleanupErr := a.interrupt(context.WithoutCancel(ctx), sessionID, "", ""); cleanupErr != nil {
+				err = fmt.Errorf("%w (%v)", err, cleanupErr)
+			}
 		}
+		a.endRun(sessionID, run)
+		a.publishRun(sessionID, "", err, time.Time{})
+	}
+	return out, err
+}
+
+func (a *Agent) runStream(ctx context.Context, sessionID, userMessage string, started time.Time, run *sessionRun, parts ...models.ContentPart) (<-chan string, error) {
+	prompt, err := a.assemble(ctx, sessionID)
+	if err != nil {
+		return nil, err
 	}
 
 	userMsg := models.Message{
@@ -204,25 +725,57 @@ func (a *Agent) Stream(ctx context.Context, sessionID, userMessage string) (<-ch
 		SessionID: sessionID,
 		Role:      models.RoleUser,
 		Content:   userMessage,
+		Parts:     parts,
 		CreatedAt: time.Now(),
 	}
-	modelMessages = append(modelMessages, userMsg)
+	if err := a.limitMessage(ctx, &userMsg); err != nil {
+		return nil, err
+	}
 
-	if err := a.saveMessage(ctx, userMsg); err != nil {
-		return nil, fmt.Errorf("failed to save user message: %w", err)
+	env, err := a.SessionEnv(ctx, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	postProcess, err := a.sessionPostProcess(ctx, sessionID)
+	if err != nil {
+		return nil, err
 	}
 
-	modelTools := make([]models.Tool, len(a.tools))
-	for i, tool := range a.tools {
-		modelTools[i] = tools.ToModelTool(tool)
+	prompt = a.compact(ctx, sessionID, prompt, userMsg)
+	prompt = a.retrieve(ctx, sessionID, prompt, userMsg)
+	prompt = a.recall(ctx, sessionID, prompt, userMsg)
+	modelMessages := append(prompt.messages(), userMsg)
+
+	if err := a.recordConfig(ctx, sessionID); err != nil {
+		return nil, err
+	}
+	if err := a.saveMessage(ctx, userMsg); err != nil {
+		return nil, fmt.Errorf("failed to save user message: %w", err)
 	}
+	a.checkpoint(ctx, sessionID, userMsg.ID, userMessage)
+	status := events.NewReporter(a.events, sessionID, string(a.provider))
+	status.Set(events.StateQueued, "")
 
 	req := models.ChatRequest{
 		Model:    a.model,
 		Messages: modelMessages,
-		Tools:    modelTools,
+		Tools:    prompt.tools,
 		Stream:   true,
 	}
+	a.fitModel(&req)
+	seedRequest(&req)
+	scrubEnv(&req, env)
+	if err := a.preflight(&req); err != nil {
+		status.Stop()
+		return nil, err
+	}
+	if err := a.secrets.Check(ctx, string(a.provider), &req); err != nil {
+		status.Stop()
+		return nil, err
+	}
+	req = a.pseudonyms.Request(string(a.provider), req)
+	a.logPrompt(sessionID, req)
+	params := a.runParams(req)
 
 	var chunks <-chan models.StreamChunk
 	switch a.provider {
@@ -231,51 +784,188 @@ func (a *Agent) Stream(ctx context.Context, sessionID, userMessage string) (<-ch
 	case models.ProviderOpenAI:
 		chunks, err = a.openai.Stream(ctx, req)
 	default:
-		return nil, fmt.Errorf("unsupported provider: %s", a.provider)
+		if a.external == nil {
+			status.Stop()
+			return nil, fmt.Errorf("unsupported provider: %s", a.provider)
+		}
+		chunks, err = a.external.Stream(ctx, req)
 	}
 
 	if err != nil {
+		status.Stop()
+		a.archiveExchange(ctx, sessionID, "", req, nil, err)
 		return nil, fmt.Errorf("failed to start streaming: %w", err)
 	}
-
-	output := make(chan string)
+	chunks = a.pseudonyms.Stream(string(a.provider), chunks)
+	status.Set(events.StateWaiting, "")
+
+	// The relay never blocks, so chunks keep being read from the provider
+	// while the consumer is busy. Ending the run cancels ctx, so the run
+	// only ends once the relay has delivered what is left, or ctx was
+	// cancelled by the caller or Cancel.
+	relay := stream.NewRelay(ctx, a.streamOpts)
 	go func() {
-		defer close(output)
-
-		var fullContent string
+		defer a.endRun(sessionID, run)
+		defer status.Stop()
+		defer func() {
+			relay.Close()
+			<-relay.Done()
+		}()
+
+		var fullContent, reasoning string
 		for chunk := range chunks {
+			// Reasoning is stored with the message but not mixed into the answer
+			if chunk.Kind == models.ChunkReasoning {
+				status.Set(events.StateThinking, "")
+				reasoning += chunk.Delta
+				a.publishDelta(sessionID, chunk)
+				continue
+			}
+
 			if chunk.Delta != "" {
+				status.Set(events.StateStreaming, "")
 				fullContent += chunk.Delta
-				output <- chunk.Delta
+				relay.Send(chunk.Delta)
+				a.publishDelta(sessionID, chunk)
 			}
 
 			if chunk.Done {
+				var err error
+				if chunk.Usage != nil {
+					err = a.recordUsage(ctx, sessionID, *chunk.Usage, a.pricing.Cost(a.model, *chunk.Usage))
+				}
+				params.ResponseModel = chunk.Model
+				params.SystemFingerprint = chunk.Fingerprint
+
+				// Output was already streamed, so processing only affects
+				// what is saved and a retry cannot be requested
+				content, _ := postProcess.Run(fullContent)
+
 				assistantMsg := models.Message{
 					ID:        uuid.New().String(),
 					SessionID: sessionID,
 					Role:      models.RoleAssistant,
-					Content:   fullContent,
+					Content:   content,
+					Reasoning: reasoning,
 					Model:     a.model,
+					Params:    params,
 					CreatedAt: time.Now(),
 				}
-				a.saveMessage(ctx, assistantMsg)
+				response := &models.ChatResponse{
+					Content:     fullContent,
+					Reasoning:   reasoning,
+					Model:       chunk.Model,
+					Fingerprint: chunk.Fingerprint,
+				}
+				if chunk.Usage != nil {
+					response.Usage = *chunk.Usage
+				}
+				a.archiveExchange(ctx, sessionID, assistantMsg.ID, req, response, nil)
+				// The reply is saved even when its usage wasn't, since it was
+				// already shown
+				if saveErr := a.saveMessage(ctx, assistantMsg); saveErr != nil && err == nil {
+					err = fmt.Errorf("failed to save assistant message: %w", saveErr)
+				}
+				if commitErr := a.commitMessages(ctx); commitErr != nil && err == nil {
+					err = commitErr
+				}
+				if err != nil {
+					relay.Send(fmt.Sprintf("[Stream error: %v]", err))
+					a.publishRun(sessionID, "", err, started)
+					return
+				}
+				a.publishRun(sessionID, content, nil, started)
 				return
 			}
 		}
+		err := errStreamEnded(ctx)
+		if ctx.Err() != nil {
+			if cleanupErr := a.interrupt(context.WithoutCancel(ctx), sessionID, fullContent, reasoning); cleanupErr != nil {
+				err = fmt.Errorf("%w (%v)", err, cleanupErr)
+			}
+		}
+		a.publishRun(sessionID, "", err, started)
 	}()
 
-	return output, nil
+	return relay.Out(), nil
 }
 
 func (a *Agent) saveMessage(ctx context.Context, msg models.Message) error {
-	_, err := a.queries.CreateMessage(ctx, db.CreateMessageParams{
-		ID:        msg.ID,
-		SessionID: msg.SessionID,
-		Role:      string(msg.Role),
-		Content:   msg.Content,
-		Model:     sql.NullString{String: msg.Model, Valid: msg.Model != ""},
-		CreatedAt: msg.CreatedAt.Unix(),
-		UpdatedAt: msg.CreatedAt.Unix(),
-	})
-	return err
+	var params sql.NullString
+	if msg.Params != nil {
+		data, err := json.Marshal(msg.Params)
+		if err != nil {
+			return fmt.Errorf("failed to encode run parameters: %w", err)
+		}
+		params = sql.NullString{String: string(data), Valid: true}
+	}
+	var config sql.NullString
+	if msg.Config != nil {
+		data, err := json.Marshal(msg.Config)
+		if err != nil {
+			return fmt.Errorf("failed to encode session config: %w", err)
+		}
+		config = sql.NullString{String: string(data), Valid: true}
+	}
+	var interrupted int64
+	if msg.Interrupted {
+		interrupted = 1
+	}
+	var toolCalls sql.NullString
+	if len(msg.ToolCalls) > 0 {
+		data, err := json.Marshal(msg.ToolCalls)
+		if err != nil {
+			return fmt.Errorf("failed to encode tool calls: %w", err)
+		}
+		toolCalls = sql.NullString{String: string(data), Valid: true}
+	}
+
+	arg := db.CreateMessageParams{
+		ID:          msg.ID,
+		SessionID:   msg.SessionID,
+		Role:        string(msg.Role),
+		Content:     msg.Content,
+		Reasoning:   sql.NullString{String: msg.Reasoning, Valid: msg.Reasoning != ""},
+		Model:       sql.NullString{String: msg.Model, Valid: msg.Model != ""},
+		Params:      params,
+		Config:      config,
+		ToolCalls:   toolCalls,
+		ToolCallID:  sql.NullString{String: msg.ToolCallID, Valid: msg.ToolCallID != ""},
+		Interrupted: interrupted,
+		CreatedAt:   msg.CreatedAt.Unix(),
+		UpdatedAt:   msg.CreatedAt.Unix(),
+	}
+
+	if a.writer != nil {
+		a.writer.Add(db.InsertMessageParams(arg))
+		a.publishMessage(msg)
+		return nil
+	}
+	if _, err := a.queries.CreateMessage(ctx, arg); err != nil {
+		return err
+	}
+	a.publishMessage(msg)
+	return nil
+}
+
+// commitMessages ends a batch of saved messages, see db.MessageWriter
+func (a *Agent) commitMessages(ctx context.Context) error {
+	if a.writer == nil {
+		return nil
+	}
+	if err := a.writer.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to save messages: %w", err)
+	}
+	return nil
+}
+
+// flushMessages writes any batched messages so reads see them
+func (a *Agent) flushMessages(ctx context.Context) error {
+	if a.writer == nil {
+		return nil
+	}
+	if err := a.writer.Flush(ctx); err != nil {
+		return fmt.Errorf("failed to save messages: %w", err)
+	}
+	return nil
 }
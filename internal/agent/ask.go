@@ -0,0 +1,83 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/omnitrix-sh/core.sh/internal/events"
+	"github.com/omnitrix-sh/core.sh/internal/permissions"
+	"github.com/omnitrix-sh/core.sh/internal/tools"
+)
+
+const askToolName = "ask_user"
+
+// noAnswer tells the model to carry on when its question goes unanswered
+const noAnswer = "Make the most reasonable assumption, say what you assumed and carry on."
+
+type askArgs struct {
+	Question string   `json:"question" description:"The question, with the context the user needs to answer it"`
+	Options  []string `json:"options,omitempty" description:"Likely answers the user can pick from, if there are some"`
+}
+
+// askTool pauses a run to ask the user a clarifying question
+type askTool struct {
+	agent *Agent
+}
+
+func (t *askTool) Name() string {
+	return askToolName
+}
+
+func (t *askTool) Description() string {
+	return `Ask the user a clarifying question and wait for the answer.
+
+Usage:
+- Ask only when the request is ambiguous and guessing wrong would waste work, not for things you can find out with other tools
+- Ask one question at a time and give options when there are a few obvious answers
+- If the user doesn't answer, make the most reasonable assumption and say what you assumed`
+}
+
+func (t *askTool) Risk() tools.Risk {
+	return tools.RiskRead
+}
+
+func (t *askTool) Run(ctx context.Context, args askArgs) (string, error) {
+	answer, err := t.agent.ask(ctx, tools.SessionIDFromContext(ctx), args.Question, args.Options)
+	if errors.Is(err, permissions.ErrUnanswered) {
+		return "The user did not answer. " + noAnswer, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return "The user answered: " + answer, nil
+}
+
+// ask puts a question to the user through the approver, one at a time
+// like approvals. Approvers that aren't an Asker can't take answers.
+func (a *Agent) ask(ctx context.Context, sessionID, question string, options []string) (string, error) {
+	question = strings.TrimSpace(question)
+	if question == "" {
+		return "", errors.New("question is empty")
+	}
+	asker, ok := a.approver.(permissions.Asker)
+	if !ok {
+		return "", fmt.Errorf("no user is available to answer questions. %s", noAnswer)
+	}
+	q := permissions.Question{
+		ID:        uuid.New().String(),
+		SessionID: sessionID,
+		Question:  question,
+		Options:   options,
+	}
+	a.approveMu.Lock()
+	defer a.approveMu.Unlock()
+	a.events.Publish(events.Event{Type: events.TypeQuestion, SessionID: sessionID, Question: &q})
+	answer, err := asker.Ask(ctx, q)
+	if err != nil && !errors.Is(err, permissions.ErrUnanswered) {
+		return "", fmt.Errorf("failed to get an answer: %w", err)
+	}
+	return answer, err
+}
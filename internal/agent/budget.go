@@ -0,0 +1,44 @@
+package agent
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/omnitrix-sh/core.sh/pkg/models"
+)
+
+// defaultMaxIterations is how many provider calls a run makes at most
+// unless SetRunLimits says otherwise
+const defaultMaxIterations = 10
+
+var (
+	// ErrIterationLimit is returned by Chat when the model keeps calling
+	// tools after the last provider call a run may make
+	ErrIterationLimit = errors.New("exceeded maximum iterations")
+	// ErrCostLimit is returned by Chat when a run spent its budget before
+	// the model replied
+	ErrCostLimit = errors.New("exceeded maximum cost")
+)
+
+// SetRunLimits caps the provider calls and cost of each Chat run. Zero
+// values keep the defaults: 10 calls and no cost limit.
+func (a *Agent) SetRunLimits(limits models.RunLimits) {
+	a.runLimits = limits
+}
+
+// maxIterations returns how many provider calls a run may make
+func (a *Agent) maxIterations() int {
+	if a.runLimits.MaxIterations > 0 {
+		return a.runLimits.MaxIterations
+	}
+	return defaultMaxIterations
+}
+
+// checkRunCost fails once a run has spent its budget, before the next
+// provider call
+func (a *Agent) checkRunCost(spent float64) error {
+	if a.runLimits.MaxCost > 0 && spent >= a.runLimits.MaxCost {
+		return fmt.Errorf("%w ($%.4f of $%.4f)", ErrCostLimit, spent, a.runLimits.MaxCost)
+	}
+	return nil
+}
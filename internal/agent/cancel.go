@@ -0,0 +1,109 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/omnitrix-sh/core.sh/internal/db"
+	"github.com/omnitrix-sh/core.sh/pkg/models"
+)
+
+// interruptedNote tells the model in later prompts that a reply was cut off
+const interruptedNote = "[The user cancelled this reply before it was complete]"
+
+// cancelledResult answers the tool calls a cancelled run left without one
+const cancelledResult = "Error: cancelled by the user before the tool finished"
+
+// Cancel stops the run in progress in a session: the provider request and
+// running tools see their context cancelled, and the session is left ready
+// for the next message, see interrupt. It reports false when the session
+// has no run.
+func (a *Agent) Cancel(sessionID string) bool {
+	a.runMu.Lock()
+	defer a.runMu.Unlock()
+	run, ok := a.runs[sessionID]
+	if !ok {
+		return false
+	}
+	run.cancel()
+	return true
+}
+
+// interrupt cleans up after a run that was cancelled, however that came
+// about: tool calls without a result are answered as cancelled, and the
+// reply is saved as far as it got and marked interrupted. Nothing is saved
+// when the turn was already complete. ctx must not be the cancelled one.
+func (a *Agent) interrupt(ctx context.Context, sessionID, partial, reasoning string) error {
+	if err := a.flushMessages(ctx); err != nil {
+		return err
+	}
+	rows, err := a.queries.ListLastTurns(ctx, db.ListLastTurnsParams{SessionID: sessionID, Turns: 1})
+	if err != nil {
+		return fmt.Errorf("failed to load the last turn: %w", err)
+	}
+
+	var last *db.Message
+	var calls []models.ToolCall
+	answered := make(map[string]bool)
+	for i, row := range rows {
+		switch models.Role(row.Role) {
+		case models.RoleEvent:
+			continue
+		case models.RoleTool:
+			answered[row.ToolCallID.String] = true
+		case models.RoleAssistant:
+			if row.ToolCalls.Valid {
+				var made []models.ToolCall
+				if json.Unmarshal([]byte(row.ToolCalls.String), &made) == nil {
+					calls = append(calls, made...)
+				}
+			}
+		}
+		last = &rows[i]
+	}
+	if last == nil || (models.Role(last.Role) == models.RoleAssistant && !last.ToolCalls.Valid) {
+		return nil
+	}
+
+	for _, call := range calls {
+		if answered[call.ID] {
+			continue
+		}
+		err := a.saveMessage(ctx, models.Message{
+			ID:         uuid.New().String(),
+			SessionID:  sessionID,
+			Role:       models.RoleTool,
+			ToolCallID: call.ID,
+			Content:    cancelledResult,
+			CreatedAt:  time.Now(),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to save tool result: %w", err)
+		}
+	}
+	err = a.saveMessage(ctx, models.Message{
+		ID:          uuid.New().String(),
+		SessionID:   sessionID,
+		Role:        models.RoleAssistant,
+		Content:     partial,
+		Reasoning:   reasoning,
+		Model:       a.model,
+		Interrupted: true,
+		CreatedAt:   time.Now(),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save interrupted reply: %w", err)
+	}
+	return a.commitMessages(ctx)
+}
+
+// interruptedContent is the content of an interrupted reply in prompts
+func interruptedContent(content string) string {
+	if content == "" {
+		return interruptedNote
+	}
+	return content + "\n\n" + interruptedNote
+}
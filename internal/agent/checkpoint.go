@@ -0,0 +1,39 @@
+package agent
+
+import (
+	"context"
+	"strings"
+
+	"github.com/omnitrix-sh/core.sh/internal/checkpoint"
+)
+
+// maxCheckpointLabel is how much of the user message labels a checkpoint
+const maxCheckpointLabel = 80
+
+// SetCheckpoints snapshots the working tree into store before every turn,
+// see checkpoint.New
+func (a *Agent) SetCheckpoints(store *checkpoint.Store) {
+	a.checkpoints = store
+}
+
+// checkpoint snapshots the working tree before the turn answering the user
+// message. A failed snapshot never holds up the turn.
+func (a *Agent) checkpoint(ctx context.Context, sessionID, messageID, userMessage string) {
+	label := strings.Join(strings.Fields(userMessage), " ")
+	if len(label) > maxCheckpointLabel {
+		label = strings.ToValidUTF8(label[:maxCheckpointLabel], "") + "..."
+	}
+	a.checkpoints.Create(ctx, sessionID, messageID, label)
+}
+
+// ListCheckpoints returns the session's checkpoints, newest first
+func (a *Agent) ListCheckpoints(ctx context.Context, sessionID string) ([]checkpoint.Checkpoint, error) {
+	return a.checkpoints.List(ctx, sessionID)
+}
+
+// RestoreCheckpoint puts the working tree back the way it was before a
+// turn. The state it replaces is checkpointed first and returned, so the
+// restore can be undone by restoring that.
+func (a *Agent) RestoreCheckpoint(ctx context.Context, checkpointID string) (*checkpoint.Checkpoint, error) {
+	return a.checkpoints.Restore(ctx, checkpointID)
+}
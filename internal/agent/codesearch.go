@@ -0,0 +1,92 @@
+package agent
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/omnitrix-sh/core.sh/internal/codesearch"
+	"github.com/omnitrix-sh/core.sh/internal/tools"
+	"github.com/omnitrix-sh/core.sh/pkg/models"
+)
+
+const (
+	defaultCodeSearchLimit = 5
+	maxCodeSearchLimit     = 20
+)
+
+// SetCodeSearch offers the semantic_search tool, which finds code in
+// workDir by meaning, unless cfg disables it or no embedding model is
+// configured. Call it after SetRetrieval, whose model it falls back to.
+func (a *Agent) SetCodeSearch(cfg models.CodeSearchConfig, workDir string) error {
+	model := cmp.Or(cfg.EmbeddingModel, a.retrieval.EmbeddingModel)
+	if cfg.Disabled || model == "" {
+		return nil
+	}
+	index, err := codesearch.New(a.queries, workDir, model, func(ctx context.Context, input []string) ([][]float32, error) {
+		return a.embed(ctx, model, input)
+	})
+	if err != nil {
+		return err
+	}
+	a.tools = append(a.tools, tools.Typed[semanticSearchArgs](&semanticSearchTool{index: index}))
+	return nil
+}
+
+type semanticSearchArgs struct {
+	Query string `json:"query" description:"What the code does, in words, such as 'where retries are scheduled after a failed upload'"`
+	Limit int    `json:"limit,omitempty" description:"How many matches to return, 5 if unset and at most 20"`
+}
+
+// semanticSearchTool finds the chunks of the workspace's files most
+// similar in meaning to a query
+type semanticSearchTool struct {
+	index *codesearch.Index
+}
+
+func (t *semanticSearchTool) Name() string {
+	return "semantic_search"
+}
+
+func (t *semanticSearchTool) Description() string {
+	return `Find code by what it does rather than by its exact text. Returns the sections of the workspace's files most similar in meaning to the query, with their paths and line numbers.
+
+Usage:
+- Use it when you don't know the names or words the code uses, such as "where user input is validated"; use grep or find_symbol when you do
+- Describe the behaviour in a sentence; single keywords match poorly
+- The first search in a workspace indexes every file and may take a while; later ones only index what changed`
+}
+
+func (t *semanticSearchTool) Risk() tools.Risk {
+	return tools.RiskRead
+}
+
+func (t *semanticSearchTool) Run(ctx context.Context, args semanticSearchArgs) (string, error) {
+	query := strings.TrimSpace(args.Query)
+	if query == "" {
+		return "", fmt.Errorf("query is empty")
+	}
+	limit := args.Limit
+	if limit <= 0 {
+		limit = defaultCodeSearchLimit
+	}
+	limit = min(limit, maxCodeSearchLimit)
+
+	results, err := t.index.Search(ctx, query, limit)
+	if err != nil {
+		return "", err
+	}
+	if len(results) == 0 {
+		return "No files are indexed; the workspace has no text files to search.", nil
+	}
+
+	var b strings.Builder
+	for i, result := range results {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		fmt.Fprintf(&b, "%s:%d-%d (score %.2f)\n```\n%s\n```\n", result.Path, result.StartLine, result.EndLine, result.Score, result.Content)
+	}
+	return b.String(), nil
+}
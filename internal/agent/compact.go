@@ -0,0 +1,200 @@
+package agent
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/omnitrix-sh/core.sh/internal/db"
+	"github.com/omnitrix-sh/core.sh/internal/tokens"
+	"github.com/omnitrix-sh/core.sh/pkg/models"
+)
+
+// OverflowCompact summarizes older history once the prompt nears the
+// context window, falling back to trimming if that is not enough
+const OverflowCompact = "compact"
+
+const (
+	// compactThreshold is the share of the context budget, in percent, at
+	// which older history is summarized
+	compactThreshold = 80
+	// compactKeep is the share of the budget, in percent, of recent history
+	// kept verbatim after compaction
+	compactKeep = 30
+	// maxSummaryInput caps each message in the transcript being summarized
+	maxSummaryInput = 2000
+)
+
+// summaryHeader introduces the summary in the prompt
+const summaryHeader = "Summary of the earlier conversation, which is no longer shown:\n\n"
+
+const summaryPrompt = `You are compacting the history of a coding session so it can continue within a limited context window.
+
+Summarize the conversation below. Preserve everything needed to continue the work:
+- the user's goals, requirements and stated preferences
+- decisions made and their reasons
+- files, functions, commands and identifiers that were discussed or changed
+- errors encountered and how they were resolved
+- work that is still open
+
+Be concise and factual. Write the summary only, without preamble.`
+
+// latestSummary returns the session's latest summary, or nil if there is
+// none or the last message it covers was deleted, in which case it no
+// longer applies
+func (a *Agent) latestSummary(ctx context.Context, sessionID string) (*db.SessionSummary, error) {
+	summary, err := a.queries.GetLatestSessionSummary(ctx, sessionID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load session summary: %w", err)
+	}
+
+	if _, err := a.queries.GetMessage(ctx, summary.ThroughMessageID); errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to load summarized message: %w", err)
+	}
+	return &summary, nil
+}
+
+func summaryMessage(sessionID, content string) models.Message {
+	return models.Message{
+		SessionID: sessionID,
+		Role:      models.RoleSystem,
+		Content:   summaryHeader + content,
+	}
+}
+
+// compact summarizes older history when the prompt for next nears the
+// context window, persisting the summary so later turns reuse it. If
+// summarizing fails the parts are returned unchanged and preflight trims
+// the request instead, so a failed summary never fails the turn.
+func (a *Agent) compact(ctx context.Context, sessionID string, parts promptParts, next models.Message) promptParts {
+	if a.overflow != OverflowCompact || a.contextSize <= 0 {
+		return parts
+	}
+
+	counter := tokens.ForModel(a.model)
+	budget := a.contextSize - a.outputReserve(models.ChatRequest{MaxTokens: a.sampling.MaxTokens})
+	used := tokens.Request(counter, models.ChatRequest{
+		Messages: append(parts.messages(), next),
+		Tools:    parts.tools,
+	})
+	if used < budget*compactThreshold/100 {
+		return parts
+	}
+
+	split := keepRecent(counter, parts.history, budget*compactKeep/100)
+	if split == 0 {
+		return parts
+	}
+
+	old := parts.history[:split]
+	previous := ""
+	if len(parts.summary) > 0 {
+		previous = strings.TrimPrefix(parts.summary[0].Content, summaryHeader)
+	}
+
+	content, err := a.summarize(ctx, sessionID, previous, old)
+	if err != nil {
+		return parts
+	}
+
+	summarized := parts.summarized + len(old)
+	_, err = a.queries.CreateSessionSummary(ctx, db.CreateSessionSummaryParams{
+		ID:               uuid.New().String(),
+		SessionID:        sessionID,
+		Content:          content,
+		ThroughMessageID: old[len(old)-1].ID,
+		MessageCount:     int64(summarized),
+		CreatedAt:        time.Now().Unix(),
+	})
+	if err != nil {
+		return parts
+	}
+
+	parts.summary = []models.Message{summaryMessage(sessionID, content)}
+	parts.history = parts.history[split:]
+	parts.summarized = summarized
+	return parts
+}
+
+// keepRecent returns the index history is split at to keep the most
+// recent messages that fit in keep tokens. The kept part never starts on a
+// tool result, whose call would be cut off from it.
+func keepRecent(counter tokens.Counter, history []models.Message, keep int) int {
+	split, kept := len(history), 0
+	for split > 0 {
+		n := tokens.Message(counter, history[split-1])
+		if kept+n > keep {
+			break
+		}
+		kept += n
+		split--
+	}
+	for split < len(history) && history[split].Role == models.RoleTool {
+		split++
+	}
+	return split
+}
+
+// summarize asks the model to summarize messages, folding in the previous
+// summary so older context is carried forward
+func (a *Agent) summarize(ctx context.Context, sessionID, previous string, messages []models.Message) (string, error) {
+	var transcript strings.Builder
+	if previous != "" {
+		transcript.WriteString(previous)
+		transcript.WriteString("\n\n")
+	}
+	for _, msg := range messages {
+		content := msg.Content
+		if len(content) > maxSummaryInput {
+			// Back up to a rune boundary so no character is split
+			cut := maxSummaryInput
+			for cut > 0 && !utf8.RuneStart(content[cut]) {
+				cut--
+			}
+			content = content[:cut] + "\n[truncated]"
+		}
+		if content == "" && len(msg.ToolCalls) > 0 {
+			names := make([]string, len(msg.ToolCalls))
+			for i, tc := range msg.ToolCalls {
+				names[i] = tc.Function.Name
+			}
+			content = "[called " + strings.Join(names, ", ") + "]"
+		}
+		transcript.WriteString(fmt.Sprintf("%s: %s\n\n", msg.Role, content))
+	}
+
+	req := models.ChatRequest{
+		Model: a.model,
+		Messages: []models.Message{
+			{Role: models.RoleSystem, Content: summaryPrompt},
+			{Role: models.RoleUser, Content: transcript.String()},
+		},
+	}
+	a.sampling.ApplyTo(&req)
+
+	response, err := a.chat(ctx, req)
+	if err != nil {
+		return "", fmt.Errorf("failed to summarize history: %w", err)
+	}
+
+	cost := a.pricing.Cost(a.model, response.Usage)
+	if err := a.recordUsage(ctx, sessionID, response.Usage, cost); err != nil {
+		return "", err
+	}
+
+	summary := strings.TrimSpace(response.Content)
+	if summary == "" {
+		return "", fmt.Errorf("model returned an empty summary")
+	}
+	return summary, nil
+}
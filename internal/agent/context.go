@@ -0,0 +1,327 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/omnitrix-sh/core.sh/internal/db"
+	"github.com/omnitrix-sh/core.sh/internal/prompt"
+	"github.com/omnitrix-sh/core.sh/internal/tokens"
+	"github.com/omnitrix-sh/core.sh/pkg/models"
+)
+
+// Prompt segments reported by InspectContext
+const (
+	SegmentSystem    = "system_prompt"
+	SegmentPinned    = "pinned"
+	SegmentSummary   = "summary"
+	SegmentRetrieved = "retrieved"
+	SegmentHistory   = "history"
+	SegmentTools     = "tool_schemas"
+	SegmentMessage   = "next_message"
+)
+
+// maxSegmentItems is how many of the largest items are listed per segment
+const maxSegmentItems = 10
+
+// promptParts are the pieces a request is assembled from. They are kept
+// apart until the request is built so the context inspector can measure
+// exactly what would be sent.
+type promptParts struct {
+	system    []models.Message
+	pinned    []models.Message
+	summary   []models.Message
+	retrieved []models.Message
+	history   []models.Message
+	tools     []models.Tool
+
+	// mode is the session's mode the prompt was built for
+	mode Mode
+
+	// summarized is how many of the session's messages the summary replaces
+	summarized int
+}
+
+// messages returns the prompt messages in the order they are sent
+func (p promptParts) messages() []models.Message {
+	messages := make([]models.Message, 0, len(p.system)+len(p.pinned)+len(p.summary)+len(p.retrieved)+len(p.history))
+	messages = append(messages, p.system...)
+	messages = append(messages, p.pinned...)
+	messages = append(messages, p.summary...)
+	messages = append(messages, p.retrieved...)
+	messages = append(messages, p.history...)
+	return messages
+}
+
+// assemble gathers everything that goes into the next request for a session
+func (a *Agent) assemble(ctx context.Context, sessionID string) (promptParts, error) {
+	var parts promptParts
+	language, err := a.SessionLanguage(ctx, sessionID)
+	if err != nil {
+		return parts, err
+	}
+	parts.mode, err = a.SessionMode(ctx, sessionID)
+	if err != nil {
+		return parts, err
+	}
+	parts.system = withModeInstruction(a.systemMessages(sessionID, language), sessionID, parts.mode)
+
+	if err := a.flushMessages(ctx); err != nil {
+		return parts, err
+	}
+
+	summary, err := a.latestSummary(ctx, sessionID)
+	if err != nil {
+		return parts, err
+	}
+	after := ""
+	if summary != nil {
+		after = summary.ThroughMessageID
+		parts.summary = []models.Message{summaryMessage(sessionID, summary.Content)}
+		parts.summarized = int(summary.MessageCount)
+	}
+
+	messages, err := a.loadHistory(ctx, sessionID, after)
+	if err != nil {
+		return parts, err
+	}
+
+	parts.history = make([]models.Message, 0, len(messages))
+	for _, msg := range messages {
+		if models.Role(msg.Role) == models.RoleEvent {
+			continue
+		}
+		m := convertMessage(msg)
+		if msg.Forgotten != 0 {
+			m.Content = forgottenContent
+		}
+		if m.Interrupted {
+			m.Content = interruptedContent(m.Content)
+		}
+		parts.history = append(parts.history, m)
+	}
+	parts.history = pairToolCalls(parts.history)
+
+	parts.tools = a.toolSchemas(sessionID, parts.mode)
+
+	return parts, nil
+}
+
+// systemMessages returns the system prompt, if one is configured, asking
+// for responses in language if set
+func (a *Agent) systemMessages(sessionID, language string) []models.Message {
+	return systemMessagesFrom(a.systemPrompt, sessionID, language)
+}
+
+// systemMessagesFrom is systemMessages with the prompt built by builder,
+// which may be nil
+func systemMessagesFrom(builder *prompt.Builder, sessionID, language string) []models.Message {
+	var content string
+	if builder != nil {
+		content = builder.Build()
+	}
+	if language != "" {
+		if content != "" {
+			content += "\n\n"
+		}
+		content += languageInstruction(language)
+	}
+	if content == "" {
+		return nil
+	}
+	return []models.Message{{
+		SessionID: sessionID,
+		Role:      models.RoleSystem,
+		Content:   content,
+	}}
+}
+
+// pairToolCalls keeps tool calls and their results together: results whose
+// call is not in the history, such as those saved before tool calls were
+// stored or whose call was summarized away, are dropped, and so are calls
+// that never got a result because the turn was interrupted. Providers
+// reject either.
+func pairToolCalls(history []models.Message) []models.Message {
+	called := make(map[string]bool)
+	answered := make(map[string]bool)
+	for _, msg := range history {
+		for _, tc := range msg.ToolCalls {
+			called[tc.ID] = true
+		}
+		if msg.Role == models.RoleTool {
+			answered[msg.ToolCallID] = true
+		}
+	}
+
+	result := history[:0]
+	for _, msg := range history {
+		if msg.Role == models.RoleTool && !called[msg.ToolCallID] {
+			continue
+		}
+		if len(msg.ToolCalls) > 0 {
+			var calls []models.ToolCall
+			for _, tc := range msg.ToolCalls {
+				if answered[tc.ID] {
+					calls = append(calls, tc)
+				}
+			}
+			msg.ToolCalls = calls
+		}
+		result = append(result, msg)
+	}
+	return result
+}
+
+// convertMessage converts a stored message to its model form
+func convertMessage(msg db.Message) models.Message {
+	m := models.Message{
+		ID:          msg.ID,
+		SessionID:   msg.SessionID,
+		Role:        models.Role(msg.Role),
+		Content:     msg.Content,
+		Reasoning:   msg.Reasoning.String,
+		Model:       msg.Model.String,
+		ToolCallID:  msg.ToolCallID.String,
+		Interrupted: msg.Interrupted != 0,
+		CreatedAt:   time.Unix(msg.CreatedAt, 0),
+		UpdatedAt:   time.Unix(msg.UpdatedAt, 0),
+	}
+	if msg.ToolCalls.Valid {
+		var calls []models.ToolCall
+		if json.Unmarshal([]byte(msg.ToolCalls.String), &calls) == nil {
+			m.ToolCalls = calls
+		}
+	}
+	if msg.Params.Valid {
+		var params models.RunParams
+		if json.Unmarshal([]byte(msg.Params.String), &params) == nil {
+			m.Params = &params
+		}
+	}
+	if msg.Config.Valid {
+		var config models.SessionConfig
+		if json.Unmarshal([]byte(msg.Config.String), &config) == nil {
+			m.Config = &config
+		}
+	}
+	return m
+}
+
+// ContextReport breaks down the prompt the next request would send.
+// ContextSize and Remaining are 0 when no context limit is configured.
+type ContextReport struct {
+	Model       string           `json:"model"`
+	Tokenizer   string           `json:"tokenizer"`
+	Exact       bool             `json:"exact"`
+	TotalTokens int              `json:"total_tokens"`
+	ContextSize int              `json:"context_size,omitempty"`
+	Remaining   int              `json:"remaining,omitempty"`
+	Segments    []ContextSegment `json:"segments"`
+}
+
+// ContextSegment is one part of the prompt. Items lists the largest
+// contributors, biggest first.
+type ContextSegment struct {
+	Name   string        `json:"name"`
+	Tokens int           `json:"tokens"`
+	Chars  int           `json:"chars"`
+	Count  int           `json:"count"`
+	Items  []ContextItem `json:"items,omitempty"`
+}
+
+// ContextItem is a single message or tool schema within a segment
+type ContextItem struct {
+	Label  string `json:"label"`
+	Tokens int    `json:"tokens"`
+}
+
+// InspectContext reports how the prompt for the next request in a session
+// would be composed if nextMessage were sent, without sending anything.
+// Token counts are exact for OpenAI models and approximate otherwise.
+func (a *Agent) InspectContext(ctx context.Context, sessionID, nextMessage string) (*ContextReport, error) {
+	parts, err := a.assemble(ctx, sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	counter := tokens.ForModel(a.model)
+	report := &ContextReport{
+		Model:     a.model,
+		Tokenizer: counter.Name(),
+		Exact:     counter.Exact(),
+	}
+	report.add(messageSegment(counter, SegmentSystem, parts.system))
+	report.add(messageSegment(counter, SegmentPinned, parts.pinned))
+	report.add(messageSegment(counter, SegmentSummary, parts.summary))
+	report.add(messageSegment(counter, SegmentRetrieved, parts.retrieved))
+	report.add(messageSegment(counter, SegmentHistory, parts.history))
+	report.add(toolSegment(counter, parts.tools))
+	if nextMessage != "" {
+		report.add(messageSegment(counter, SegmentMessage, []models.Message{{Role: models.RoleUser, Content: nextMessage}}))
+	}
+
+	if a.contextSize > 0 {
+		report.ContextSize = a.contextSize
+		report.Remaining = a.contextSize - report.TotalTokens
+	}
+
+	return report, nil
+}
+
+func (r *ContextReport) add(segment ContextSegment) {
+	r.TotalTokens += segment.Tokens
+	r.Segments = append(r.Segments, segment)
+}
+
+func messageSegment(counter tokens.Counter, name string, messages []models.Message) ContextSegment {
+	segment := ContextSegment{Name: name, Count: len(messages)}
+	for i, msg := range messages {
+		n := tokens.Message(counter, msg)
+		segment.Tokens += n
+		segment.Chars += len(msg.Content)
+		segment.Items = append(segment.Items, ContextItem{
+			Label:  fmt.Sprintf("#%d %s: %s", i+1, msg.Role, preview(msg.Content)),
+			Tokens: n,
+		})
+	}
+	segment.Items = largest(segment.Items)
+	return segment
+}
+
+func toolSegment(counter tokens.Counter, schemas []models.Tool) ContextSegment {
+	segment := ContextSegment{Name: SegmentTools, Count: len(schemas)}
+	for _, tool := range schemas {
+		n := tokens.Tool(counter, tool)
+		segment.Tokens += n
+		segment.Chars += len(tool.Function.Description)
+		segment.Items = append(segment.Items, ContextItem{Label: tool.Function.Name, Tokens: n})
+	}
+	segment.Items = largest(segment.Items)
+	return segment
+}
+
+func largest(items []ContextItem) []ContextItem {
+	sort.SliceStable(items, func(i, j int) bool { return items[i].Tokens > items[j].Tokens })
+	if len(items) > maxSegmentItems {
+		items = items[:maxSegmentItems]
+	}
+	return items
+}
+
+// preview returns the start of a message for labelling it
+func preview(content string) string {
+	const maxLen = 60
+	runes := []rune(content)
+	for i, r := range runes {
+		if r == '\n' {
+			runes[i] = ' '
+		}
+	}
+	if len(runes) > maxLen {
+		return string(runes[:maxLen]) + "..."
+	}
+	return string(runes)
+}
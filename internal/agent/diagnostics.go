@@ -0,0 +1,142 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/omnitrix-sh/core.sh/internal/format"
+	"github.com/omnitrix-sh/core.sh/internal/lsp"
+	"github.com/omnitrix-sh/core.sh/internal/tools"
+)
+
+// maxReportedErrors caps the language server errors added to a tool result
+const maxReportedErrors = 20
+
+// SetDiagnostics has the language servers check every file a tool writes,
+// adding the errors they find to the tool's result so the model sees them
+// in its next step
+func (a *Agent) SetDiagnostics(manager *lsp.Manager) {
+	a.lsp = manager
+}
+
+// changeRecorder collects the files a tool writes
+type changeRecorder struct {
+	mu    sync.Mutex
+	paths []string
+	seen  map[string]bool
+}
+
+func (r *changeRecorder) record(path string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.seen[path] {
+		r.seen[path] = true
+		r.paths = append(r.paths, path)
+	}
+}
+
+// SetFormatters has the formatters run on every file a tool writes, before
+// the language servers check it, adding what they report to the tool's
+// result. They can be replaced while sessions run.
+func (a *Agent) SetFormatters(runner *format.Runner) {
+	a.reloadMu.Lock()
+	defer a.reloadMu.Unlock()
+	a.formatters = runner
+}
+
+func (a *Agent) formatRunner() *format.Runner {
+	a.reloadMu.RLock()
+	defer a.reloadMu.RUnlock()
+	return a.formatters
+}
+
+// formatterTool stands for the formatters in permission requests, so their
+// commands meet the same guardrails and policy as the model's. The user
+// approved the change to a file, not the command run on it afterwards.
+type formatterTool struct{}
+
+func (formatterTool) Name() string {
+	return "format"
+}
+
+func (formatterTool) Description() string {
+	return "Run a configured formatter on the files a tool wrote"
+}
+
+func (formatterTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"command": map[string]interface{}{"type": "string"},
+		},
+	}
+}
+
+func (formatterTool) Risk() tools.Risk {
+	return tools.RiskExecute
+}
+
+func (formatterTool) Execute(context.Context, map[string]interface{}) (string, error) {
+	return "", errors.New("formatters are run by the agent")
+}
+
+// authorizeFormatter checks a formatter's command as a call of the
+// "format" tool
+func (a *Agent) authorizeFormatter(ctx context.Context, command string) error {
+	return a.authorize(ctx, tools.SessionIDFromContext(ctx), formatterTool{}, map[string]interface{}{"command": command})
+}
+
+// runTool executes a tool, formatting and checking the files it writes
+// when formatters or language servers are set
+func (a *Agent) runTool(ctx context.Context, tool tools.Tool, args map[string]interface{}) (string, error) {
+	formatters := a.formatRunner()
+	if a.lsp == nil && formatters == nil {
+		return tool.Execute(ctx, args)
+	}
+
+	changes := &changeRecorder{seen: make(map[string]bool)}
+	result, err := tool.Execute(tools.WithChangeRecorder(ctx, changes.record), args)
+	if err != nil || len(changes.paths) == 0 {
+		return result, err
+	}
+	if report := formatters.Run(ctx, changes.paths, a.authorizeFormatter); report != "" {
+		result = strings.TrimRight(result, "\n") + "\n\n" + report
+	}
+	if a.lsp == nil {
+		return result, nil
+	}
+	if report := a.checkChanges(ctx, changes.paths); report != "" {
+		result = strings.TrimRight(result, "\n") + "\n\n" + report
+	}
+	return result, nil
+}
+
+// checkChanges returns the errors the language servers report for the
+// files, formatted for a tool result, or "" if there are none
+func (a *Agent) checkChanges(ctx context.Context, paths []string) string {
+	diagnostics, err := a.lsp.Check(ctx, paths...)
+	errs := lsp.Errors(diagnostics)
+	if len(errs) == 0 {
+		// A server that failed isn't worth a note on every edit; the
+		// diagnostics tool reports it
+		return ""
+	}
+
+	var b strings.Builder
+	b.WriteString(fmt.Sprintf("Language server errors after this change (%d):\n", len(errs)))
+	shown := errs
+	if len(shown) > maxReportedErrors {
+		shown = shown[:maxReportedErrors]
+	}
+	b.WriteString(lsp.Format(shown, a.lsp.WorkDir()))
+	if len(errs) > len(shown) {
+		b.WriteString(fmt.Sprintf("... and %d more, see the diagnostics tool\n", len(errs)-len(shown)))
+	}
+	if err != nil {
+		b.WriteString(fmt.Sprintf("Some files could not be checked: %v\n", err))
+	}
+	return b.String()
+}
@@ -0,0 +1,94 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/omnitrix-sh/core.sh/internal/db"
+	"github.com/omnitrix-sh/core.sh/pkg/models"
+)
+
+// minScrubLength is the shortest environment value scrubbed from requests.
+// Shorter values such as "1" or "dev" would mangle unrelated text.
+const minScrubLength = 4
+
+// SetEnv sets the environment variables every session's tools run with,
+// typically from the config's env section. Session variables override them.
+func (a *Agent) SetEnv(env map[string]string) {
+	a.env = env
+}
+
+// SetSessionEnv sets an environment variable for a session's tools
+func (a *Agent) SetSessionEnv(ctx context.Context, sessionID, name, value string) error {
+	if name == "" || strings.ContainsAny(name, "=\x00") {
+		return fmt.Errorf("invalid environment variable name: %q", name)
+	}
+	err := a.queries.SetSessionEnv(ctx, db.SetSessionEnvParams{
+		SessionID: sessionID,
+		Name:      name,
+		Value:     value,
+		UpdatedAt: time.Now().Unix(),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to set environment variable: %w", err)
+	}
+	return nil
+}
+
+// UnsetSessionEnv removes an environment variable from a session
+func (a *Agent) UnsetSessionEnv(ctx context.Context, sessionID, name string) error {
+	err := a.queries.DeleteSessionEnv(ctx, db.DeleteSessionEnvParams{SessionID: sessionID, Name: name})
+	if err != nil {
+		return fmt.Errorf("failed to unset environment variable: %w", err)
+	}
+	return nil
+}
+
+// SessionEnv returns the environment variables a session's tools run with
+func (a *Agent) SessionEnv(ctx context.Context, sessionID string) (map[string]string, error) {
+	vars, err := a.queries.ListSessionEnv(ctx, sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load environment: %w", err)
+	}
+
+	env := make(map[string]string, len(a.env)+len(vars))
+	for name, value := range a.env {
+		env[name] = value
+	}
+	for _, v := range vars {
+		env[v.Name] = v.Value
+	}
+	return env, nil
+}
+
+// scrubEnv replaces environment values in the request's messages with a
+// reference to the variable, so values such as connection strings that tools
+// echo back never reach the provider. Messages are copied, not modified.
+func scrubEnv(req *models.ChatRequest, env map[string]string) {
+	var pairs []string
+	names := make([]string, 0, len(env))
+	for name, value := range env {
+		if len(value) >= minScrubLength {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return
+	}
+
+	// Longest values first, so a value containing another is replaced whole
+	sort.Slice(names, func(i, j int) bool {
+		if len(env[names[i]]) != len(env[names[j]]) {
+			return len(env[names[i]]) > len(env[names[j]])
+		}
+		return names[i] < names[j]
+	})
+	for _, name := range names {
+		pairs = append(pairs, env[name], "$"+name)
+	}
+	replacer := strings.NewReplacer(pairs...)
+	*req = req.MapText(replacer.Replace)
+}
@@ -0,0 +1,141 @@
+package agent
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/omnitrix-sh/core.sh/pkg/models"
+)
+
+// sessionConfig returns the configuration the session's next prompt is
+// built with
+func (a *Agent) sessionConfig(sessionID, language string, mode Mode) models.SessionConfig {
+	cfg := models.SessionConfig{
+		Provider: a.provider,
+		Model:    a.model,
+		Language: language,
+		Mode:     string(mode),
+	}
+	if system := withModeInstruction(a.systemMessages(sessionID, language), sessionID, mode); len(system) > 0 {
+		cfg.SystemPrompt = system[0].Content
+	}
+	for _, tool := range a.toolList() {
+		cfg.Tools = append(cfg.Tools, tool.Name())
+	}
+	sort.Strings(cfg.Tools)
+	if a.permissions != nil {
+		cfg.Permissions = a.permissions.Policy()
+	}
+	return cfg
+}
+
+// recordConfig adds an event message to the session's history when its
+// configuration differs from the one last recorded, so transcripts and
+// replays show what each later request was built with. The first turn of
+// a session records the configuration it started with.
+func (a *Agent) recordConfig(ctx context.Context, sessionID string) error {
+	language, err := a.SessionLanguage(ctx, sessionID)
+	if err != nil {
+		return err
+	}
+	mode, err := a.SessionMode(ctx, sessionID)
+	if err != nil {
+		return err
+	}
+	current := a.sessionConfig(sessionID, language, mode)
+
+	var previous *models.SessionConfig
+	row, err := a.queries.GetLatestEvent(ctx, sessionID)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+	case err != nil:
+		return fmt.Errorf("failed to load session events: %w", err)
+	default:
+		previous = convertMessage(row).Config
+	}
+
+	content := describeConfig(previous, current)
+	if content == "" {
+		return nil
+	}
+
+	event := models.Message{
+		ID:        uuid.New().String(),
+		SessionID: sessionID,
+		Role:      models.RoleEvent,
+		Content:   content,
+		Config:    &current,
+		CreatedAt: time.Now(),
+	}
+	if err := a.saveMessage(ctx, event); err != nil {
+		return fmt.Errorf("failed to save session event: %w", err)
+	}
+	return nil
+}
+
+// describeConfig describes the change from previous to current, or returns
+// "" if there is none
+func describeConfig(previous *models.SessionConfig, current models.SessionConfig) string {
+	if previous == nil {
+		return fmt.Sprintf("Session started with %s model %s and %d tools.", current.Provider, current.Model, len(current.Tools))
+	}
+
+	var changes []string
+	if previous.Provider != current.Provider || previous.Model != current.Model {
+		changes = append(changes, fmt.Sprintf("model changed from %s/%s to %s/%s",
+			previous.Provider, previous.Model, current.Provider, current.Model))
+	}
+	// Sessions recorded before modes existed were in build mode
+	previousMode := Mode(previous.Mode)
+	if previousMode == "" {
+		previousMode = ModeBuild
+	}
+	modeChanged := previousMode != Mode(current.Mode)
+	if modeChanged {
+		changes = append(changes, "switched to "+current.Mode+" mode")
+	}
+	if previous.Language != current.Language {
+		if current.Language == "" {
+			changes = append(changes, "response language unset")
+		} else {
+			changes = append(changes, "response language set to "+current.Language)
+		}
+	} else if previous.SystemPrompt != current.SystemPrompt && !modeChanged {
+		changes = append(changes, "system prompt changed")
+	}
+	if added := missing(current.Tools, previous.Tools); len(added) > 0 {
+		changes = append(changes, "tools added: "+strings.Join(added, ", "))
+	}
+	if removed := missing(previous.Tools, current.Tools); len(removed) > 0 {
+		changes = append(changes, "tools removed: "+strings.Join(removed, ", "))
+	}
+	if previous.Permissions != current.Permissions {
+		changes = append(changes, "tool permissions changed")
+	}
+
+	if len(changes) == 0 {
+		return ""
+	}
+	return "Configuration changed: " + strings.Join(changes, "; ") + "."
+}
+
+// missing returns the names in a that are not in b
+func missing(a, b []string) []string {
+	seen := make(map[string]bool, len(b))
+	for _, name := range b {
+		seen[name] = true
+	}
+	var result []string
+	for _, name := range a {
+		if !seen[name] {
+			result = append(result, name)
+		}
+	}
+	return result
+}
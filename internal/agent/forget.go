@@ -0,0 +1,157 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/omnitrix-sh/core.sh/internal/db"
+	"github.com/omnitrix-sh/core.sh/internal/tools"
+	"github.com/omnitrix-sh/core.sh/pkg/models"
+)
+
+// forgottenContent replaces a forgotten tool result in the prompt. The
+// message itself stays so the call it answers remains valid.
+const forgottenContent = "[Result removed from context as no longer relevant]"
+
+// forgetTool lets the model drop tool results it no longer needs from its
+// working context. The messages stay in the session, only later prompts
+// leave them out.
+type forgetTool struct {
+	agent *Agent
+}
+
+func (t *forgetTool) Name() string {
+	return "forget"
+}
+
+func (t *forgetTool) Description() string {
+	return `Remove earlier tool results from your working context to free up space.
+
+Usage:
+- Provide the IDs of the tool calls whose results you no longer need, such as a file you read before rewriting it or output of a command you have already acted on
+- The results are replaced with a short note in later requests; the conversation history itself is kept
+
+Forget only results you are sure you will not need again.`
+}
+
+func (t *forgetTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"tool_call_ids": map[string]interface{}{
+				"type":        "array",
+				"items":       map[string]interface{}{"type": "string"},
+				"description": "IDs of the tool calls whose results to forget",
+			},
+			"reason": map[string]interface{}{
+				"type":        "string",
+				"description": "Optional: why the results are no longer relevant",
+			},
+		},
+		"required": []string{"tool_call_ids"},
+	}
+}
+
+func (t *forgetTool) Risk() tools.Risk {
+	return tools.RiskRead
+}
+
+func (t *forgetTool) Execute(ctx context.Context, args map[string]interface{}) (string, error) {
+	sessionID := tools.SessionIDFromContext(ctx)
+	ids := tools.GetStringSliceArg(args, "tool_call_ids")
+	if len(ids) == 0 {
+		return "", fmt.Errorf("tool_call_ids is required")
+	}
+
+	// Results of this turn may still be queued for writing
+	if err := t.agent.flushMessages(ctx); err != nil {
+		return "", err
+	}
+
+	var forgotten, unknown []string
+	for _, callID := range ids {
+		messageID, ok := t.agent.toolResultID(sessionID, callID)
+		if !ok {
+			unknown = append(unknown, callID)
+			continue
+		}
+
+		n, err := t.agent.queries.ForgetMessage(ctx, db.ForgetMessageParams{
+			UpdatedAt: time.Now().Unix(),
+			ID:        messageID,
+			SessionID: sessionID,
+		})
+		if err != nil {
+			return "", fmt.Errorf("failed to forget %s: %w", callID, err)
+		}
+		if n == 0 {
+			unknown = append(unknown, callID)
+			continue
+		}
+		t.agent.markForgotten(sessionID, messageID)
+		forgotten = append(forgotten, callID)
+	}
+
+	var result strings.Builder
+	result.WriteString(fmt.Sprintf("Forgot %d tool result(s)", len(forgotten)))
+	if len(forgotten) > 0 {
+		result.WriteString(": " + strings.Join(forgotten, ", "))
+	}
+	if len(unknown) > 0 {
+		result.WriteString(fmt.Sprintf("\nUnknown tool call IDs: %s", strings.Join(unknown, ", ")))
+	}
+	return result.String(), nil
+}
+
+// rememberToolResult records which message holds a tool call's result, so
+// the forget tool can find it by the call ID the model knows
+func (a *Agent) rememberToolResult(sessionID, callID, messageID string) {
+	a.forgetMu.Lock()
+	defer a.forgetMu.Unlock()
+
+	if a.toolResults == nil {
+		a.toolResults = make(map[string]map[string]string)
+	}
+	if a.toolResults[sessionID] == nil {
+		a.toolResults[sessionID] = make(map[string]string)
+	}
+	a.toolResults[sessionID][callID] = messageID
+}
+
+func (a *Agent) toolResultID(sessionID, callID string) (string, bool) {
+	a.forgetMu.Lock()
+	defer a.forgetMu.Unlock()
+
+	id, ok := a.toolResults[sessionID][callID]
+	return id, ok
+}
+
+// markForgotten notes a forgotten message for the turn in progress, whose
+// prompt was assembled before the message was flagged
+func (a *Agent) markForgotten(sessionID, messageID string) {
+	a.forgetMu.Lock()
+	defer a.forgetMu.Unlock()
+
+	if a.forgotten == nil {
+		a.forgotten = make(map[string]map[string]bool)
+	}
+	if a.forgotten[sessionID] == nil {
+		a.forgotten[sessionID] = make(map[string]bool)
+	}
+	a.forgotten[sessionID][messageID] = true
+}
+
+// applyForgotten replaces the content of forgotten tool results in messages
+func (a *Agent) applyForgotten(sessionID string, messages []models.Message) {
+	a.forgetMu.Lock()
+	defer a.forgetMu.Unlock()
+
+	forgotten := a.forgotten[sessionID]
+	for i, msg := range messages {
+		if forgotten[msg.ID] {
+			messages[i].Content = forgottenContent
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/omnitrix-sh/core.sh/internal/db"
+	"github.com/omnitrix-sh/core.sh/internal/tokens"
+	"github.com/omnitrix-sh/core.sh/pkg/models"
+)
+
+const (
+	// historyPageSize is how many messages are read at a time when loading
+	// history backwards
+	historyPageSize = 100
+	// defaultPageLimit and maxPageLimit bound pages returned by Messages
+	defaultPageLimit = 50
+	maxPageLimit     = 500
+)
+
+// loadHistory loads the stored messages the next prompt can use, oldest
+// first: those after afterID, the last message a summary covers. When the
+// context window is known and overflow is trimmed or rejected rather than
+// compacted, only as many recent messages are read as could fit, plus the
+// one that overflows so preflight still sees the overflow. Compaction needs
+// every unsummarized message, so it always loads them all.
+func (a *Agent) loadHistory(ctx context.Context, sessionID, afterID string) ([]db.Message, error) {
+	if a.contextSize <= 0 || a.overflow == OverflowCompact {
+		messages, err := a.queries.ListMessagesAfter(ctx, db.ListMessagesAfterParams{
+			SessionID: sessionID,
+			AfterID:   afterID,
+			Limit:     -1,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to load messages: %w", err)
+		}
+		return messages, nil
+	}
+
+	counter := tokens.ForModel(a.model)
+	budget := a.contextSize - a.outputReserve(models.ChatRequest{MaxTokens: a.sampling.MaxTokens})
+
+	var newestFirst []db.Message
+	used, before := 0, ""
+	for {
+		page, err := a.queries.ListMessagesBefore(ctx, db.ListMessagesBeforeParams{
+			SessionID: sessionID,
+			BeforeID:  before,
+			Limit:     historyPageSize,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to load messages: %w", err)
+		}
+
+		for _, msg := range page {
+			if msg.ID == afterID {
+				return reverse(newestFirst), nil
+			}
+			newestFirst = append(newestFirst, msg)
+			used += tokens.Message(counter, convertMessage(msg))
+			if used > budget {
+				return reverse(newestFirst), nil
+			}
+		}
+
+		if len(page) < historyPageSize {
+			return reverse(newestFirst), nil
+		}
+		before = page[len(page)-1].ID
+	}
+}
+
+func reverse(messages []db.Message) []db.Message {
+	for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
+		messages[i], messages[j] = messages[j], messages[i]
+	}
+	return messages
+}
+
+// MessagePage is a page of a session's messages, oldest first
+type MessagePage struct {
+	Messages []models.Message `json:"messages"`
+	// Older is the cursor for the preceding page, empty when this page
+	// starts at the beginning of the session
+	Older string `json:"older,omitempty"`
+}
+
+// Messages returns a page of up to limit messages of a session ending just
+// before the message with ID before, or with the latest message if before
+// is empty. Cursors are message IDs, so pages stay stable while new
+// messages are added.
+func (a *Agent) Messages(ctx context.Context, sessionID, before string, limit int) (*MessagePage, error) {
+	if err := a.flushMessages(ctx); err != nil {
+		return nil, err
+	}
+
+	limit = pageLimit(limit)
+
+	// One extra row tells whether an older page exists
+	rows, err := a.readQueries().ListMessagesBefore(ctx, db.ListMessagesBeforeParams{
+		SessionID: sessionID,
+		BeforeID:  before,
+		Limit:     int64(limit + 1),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to load messages: %w", err)
+	}
+
+	page := &MessagePage{}
+	if len(rows) > limit {
+		rows = rows[:limit]
+		page.Older = rows[limit-1].ID
+	}
+	for _, row := range reverse(rows) {
+		page.Messages = append(page.Messages, convertMessage(row))
+	}
+	return page, nil
+}
+
+// MessagesAfter returns up to limit messages of a session following the
+// message with ID after, or from the start if after is empty. Use it to
+// page forward or to fetch messages added since the last one seen.
+func (a *Agent) MessagesAfter(ctx context.Context, sessionID, after string, limit int) ([]models.Message, error) {
+	if err := a.flushMessages(ctx); err != nil {
+		return nil, err
+	}
+
+	rows, err := a.readQueries().ListMessagesAfter(ctx, db.ListMessagesAfterParams{
+		SessionID: sessionID,
+		AfterID:   after,
+		Limit:     int64(pageLimit(limit)),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to load messages: %w", err)
+	}
+
+	messages := make([]models.Message, len(rows))
+	for i, row := range rows {
+		messages[i] = convertMessage(row)
+	}
+	return messages, nil
+}
+
+func pageLimit(limit int) int {
+	if limit <= 0 {
+		return defaultPageLimit
+	}
+	if limit > maxPageLimit {
+		return maxPageLimit
+	}
+	return limit
+}
@@ -0,0 +1,129 @@
+package agent
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/omnitrix-sh/core.sh/internal/archive"
+	"github.com/omnitrix-sh/core.sh/internal/db"
+	"github.com/omnitrix-sh/core.sh/pkg/models"
+)
+
+// Turn is everything behind an assistant message: the prompt it answered,
+// what the provider returned and what its tool calls did, to answer why
+// the model did what it did
+type Turn struct {
+	Message models.Message `json:"message"`
+
+	// Request is the prompt as it was sent, after trimming, retrieval and
+	// with the system prompt, when the exchange was archived. Otherwise it
+	// is rebuilt from the stored messages and Archived is false; the
+	// rebuilt prompt misses what was trimmed, retrieved or compacted.
+	Request  models.ChatRequest `json:"request"`
+	Archived bool               `json:"archived"`
+
+	// Response is the provider's response before post-processing, only
+	// when the exchange was archived
+	Response *models.ChatResponse `json:"response,omitempty"`
+	// SentAt is when the request was archived
+	SentAt time.Time `json:"sent_at,omitempty"`
+
+	// Steps are the message's tool calls with their results
+	Steps []TurnStep `json:"steps,omitempty"`
+}
+
+// TurnStep is a tool call and the message answering it
+type TurnStep struct {
+	Call models.ToolCall `json:"call"`
+	// Result is nil when the call was never answered, e.g. because the run
+	// was interrupted
+	Result *models.Message `json:"result,omitempty"`
+}
+
+// InspectTurn reconstructs the turn that produced an assistant message,
+// assembled from the provider archive and the stored messages. Archived
+// requests have secrets masked.
+func (a *Agent) InspectTurn(ctx context.Context, messageID string) (*Turn, error) {
+	if err := a.flushMessages(ctx); err != nil {
+		return nil, err
+	}
+
+	target, err := a.readQueries().GetMessage(ctx, messageID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("message %s not found", messageID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load message: %w", err)
+	}
+	msg := convertMessage(target)
+	if msg.Role != models.RoleAssistant {
+		return nil, fmt.Errorf("message %s is not an assistant message (role %s)", messageID, msg.Role)
+	}
+
+	turn := &Turn{Message: msg}
+	ex, err := a.archive.ForMessage(ctx, messageID)
+	switch {
+	case err == nil:
+		turn.Request = ex.Request
+		turn.Response = ex.Response
+		turn.SentAt = ex.CreatedAt
+		turn.Archived = true
+	case errors.Is(err, archive.ErrNotFound):
+		turn.Request, err = a.rebuildRequest(ctx, target, msg.Params)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, err
+	}
+
+	if len(msg.ToolCalls) > 0 {
+		turn.Steps, err = a.turnSteps(ctx, msg)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return turn, nil
+}
+
+// turnSteps pairs a message's tool calls with the tool messages after it
+// that answer them
+func (a *Agent) turnSteps(ctx context.Context, msg models.Message) ([]TurnStep, error) {
+	steps := make([]TurnStep, len(msg.ToolCalls))
+	pending := make(map[string]int, len(msg.ToolCalls))
+	for i, call := range msg.ToolCalls {
+		steps[i].Call = call
+		pending[call.ID] = i
+	}
+
+	after := msg.ID
+	for len(pending) > 0 {
+		rows, err := a.readQueries().ListMessagesAfter(ctx, db.ListMessagesAfterParams{
+			SessionID: msg.SessionID,
+			AfterID:   after,
+			Limit:     historyPageSize,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to load tool results: %w", err)
+		}
+		for _, row := range rows {
+			// Results follow their call before the next assistant message
+			if models.Role(row.Role) == models.RoleAssistant {
+				return steps, nil
+			}
+			if i, ok := pending[row.ToolCallID.String]; ok && models.Role(row.Role) == models.RoleTool {
+				result := convertMessage(row)
+				steps[i].Result = &result
+				delete(pending, row.ToolCallID.String)
+			}
+		}
+		if len(rows) < historyPageSize {
+			break
+		}
+		after = rows[len(rows)-1].ID
+	}
+	return steps, nil
+}
@@ -0,0 +1,67 @@
+package agent
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/omnitrix-sh/core.sh/internal/db"
+	"github.com/omnitrix-sh/core.sh/internal/postprocess"
+)
+
+// SetLanguage sets the language every session's responses are written in,
+// typically from the config. Sessions can override it with
+// SetSessionLanguage. An empty code leaves the language to the model.
+func (a *Agent) SetLanguage(code string) error {
+	code = strings.ToLower(code)
+	if code != "" {
+		if _, ok := postprocess.LanguageName(code); !ok {
+			return fmt.Errorf("unsupported response language: %s", code)
+		}
+	}
+	a.language = code
+	return nil
+}
+
+// SetSessionLanguage sets the language of a session's responses. An empty
+// code reverts to the agent's language.
+func (a *Agent) SetSessionLanguage(ctx context.Context, sessionID, code string) error {
+	code = strings.ToLower(code)
+	if code != "" {
+		if _, ok := postprocess.LanguageName(code); !ok {
+			return fmt.Errorf("unsupported response language: %s", code)
+		}
+	}
+	err := a.queries.SetSessionLanguage(ctx, db.SetSessionLanguageParams{
+		Language:  sql.NullString{String: code, Valid: code != ""},
+		UpdatedAt: time.Now().Unix(),
+		ID:        sessionID,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to set session language: %w", err)
+	}
+	return nil
+}
+
+// SessionLanguage returns the language code a session's responses are
+// written in, or "" if none is set
+func (a *Agent) SessionLanguage(ctx context.Context, sessionID string) (string, error) {
+	language, err := a.queries.GetSessionLanguage(ctx, sessionID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return "", fmt.Errorf("failed to load session language: %w", err)
+	}
+	if language.Valid && language.String != "" {
+		return language.String, nil
+	}
+	return a.language, nil
+}
+
+// languageInstruction is added to the system prompt to ask for responses
+// in a language
+func languageInstruction(code string) string {
+	name, _ := postprocess.LanguageName(code)
+	return fmt.Sprintf("Write all explanations and other prose in %s. Keep code, identifiers, file paths, commands, log output and quoted text exactly as they are, without translating them.", name)
+}
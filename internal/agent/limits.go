@@ -0,0 +1,253 @@
+package agent
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/omnitrix-sh/core.sh/internal/db"
+	"github.com/omnitrix-sh/core.sh/internal/tools"
+	"github.com/omnitrix-sh/core.sh/pkg/models"
+)
+
+const (
+	defaultUserLimit = 100000
+	defaultToolLimit = 50000
+	defaultPreview   = 4000
+	// minResultShare is the least a tool result is shortened to when the
+	// results of a response share the total budget
+	minResultShare = 1000
+	// attachmentPage is how much read_attachment returns at a time
+	attachmentPage    = 20000
+	maxAttachmentPage = 50000
+)
+
+// ErrAttachmentNotFound is returned for attachments that don't exist
+var ErrAttachmentNotFound = errors.New("attachment not found")
+
+// SetMessageLimits sets the size limits of user messages and tool results
+func (a *Agent) SetMessageLimits(cfg models.MessageLimitsConfig) {
+	a.limits = cfg
+}
+
+// limitFor returns the size limit of messages with role, or -1 for none
+func (a *Agent) limitFor(role models.Role) int {
+	var limit, def int
+	switch role {
+	case models.RoleUser:
+		limit, def = a.limits.User, defaultUserLimit
+	case models.RoleTool:
+		limit, def = a.limits.Tool, defaultToolLimit
+	default:
+		return -1
+	}
+	if limit == 0 {
+		return def
+	}
+	return limit
+}
+
+// toolLimit returns the size limit of results of the named tool, or -1 for
+// none
+func (a *Agent) toolLimit(name string) int {
+	if limit, ok := a.limits.Tools[name]; ok && limit != 0 {
+		return limit
+	}
+	return a.limitFor(models.RoleTool)
+}
+
+// toolResultLimits returns the size limit of each tool result of a
+// response: the tool's own limit, lowered so that the results together fit
+// the total budget. Results smaller than an even share of the budget are
+// kept whole and the larger ones split what is left equally. Pages of
+// attachments are never shortened again, the model chose their length.
+func (a *Agent) toolResultLimits(calls []models.ToolCall, results []string) []int {
+	limits := make([]int, len(calls))
+	sizes := make([]int, len(calls))
+	total := 0
+	for i, call := range calls {
+		limits[i] = a.toolLimit(call.Function.Name)
+		sizes[i] = len(results[i])
+		if limits[i] >= 0 && sizes[i] > limits[i] {
+			sizes[i] = limits[i]
+		}
+		total += sizes[i]
+	}
+	budget := a.limits.ToolTotal
+	if budget <= 0 || total <= budget {
+		return limits
+	}
+
+	left := budget
+	var order []int
+	for i, call := range calls {
+		if call.Function.Name == "read_attachment" {
+			left -= sizes[i]
+			continue
+		}
+		order = append(order, i)
+	}
+	sort.Slice(order, func(x, y int) bool { return sizes[order[x]] < sizes[order[y]] })
+	for k, i := range order {
+		share := max(left/(len(order)-k), minResultShare)
+		if sizes[i] <= share {
+			left -= sizes[i]
+			continue
+		}
+		for _, j := range order[k:] {
+			limits[j] = share
+		}
+		break
+	}
+	return limits
+}
+
+// limitMessage moves the content of a message over its size limit into an
+// attachment, leaving its start and end and a note on how to read the rest.
+// The message keeps the shortened content for good, so it never costs more
+// than the limit in later prompts.
+func (a *Agent) limitMessage(ctx context.Context, msg *models.Message) error {
+	return a.limitMessageTo(ctx, msg, a.limitFor(msg.Role))
+}
+
+// limitMessageTo is limitMessage with the limit given, -1 for none
+func (a *Agent) limitMessageTo(ctx context.Context, msg *models.Message, limit int) error {
+	if limit < 0 || len(msg.Content) <= limit {
+		return nil
+	}
+
+	id := uuid.New().String()
+	err := a.queries.CreateAttachment(ctx, db.CreateAttachmentParams{
+		ID:        id,
+		SessionID: msg.SessionID,
+		MessageID: msg.ID,
+		Content:   msg.Content,
+		Size:      int64(len(msg.Content)),
+		CreatedAt: time.Now().Unix(),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save attachment: %w", err)
+	}
+
+	what := "message"
+	if msg.Role == models.RoleTool {
+		what = "tool result"
+	}
+	preview := a.limits.Preview
+	if preview <= 0 {
+		preview = defaultPreview
+	}
+	preview = min(preview, limit)
+
+	head := firstBytes(msg.Content, preview/2)
+	tail := lastBytes(msg.Content, preview-len(head))
+	msg.Content = fmt.Sprintf("%s\n\n[... %d of %d bytes not shown. The full %s is saved as attachment %s; read the missing part with read_attachment from offset %d ...]\n\n%s",
+		head, len(msg.Content)-len(head)-len(tail), len(msg.Content), what, id, len(head), tail)
+	return nil
+}
+
+// firstBytes returns the longest prefix of s of at most n bytes that
+// doesn't split a rune
+func firstBytes(s string, n int) string {
+	if n >= len(s) {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+// lastBytes is firstBytes for suffixes
+func lastBytes(s string, n int) string {
+	if n >= len(s) {
+		return s
+	}
+	start := len(s) - n
+	for start < len(s) && !utf8.RuneStart(s[start]) {
+		start++
+	}
+	return s[start:]
+}
+
+// Attachment returns the full content of an oversized message
+func (a *Agent) Attachment(ctx context.Context, id string) (string, error) {
+	row, err := a.readQueries().GetAttachment(ctx, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", ErrAttachmentNotFound
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to load attachment: %w", err)
+	}
+	return row.Content, nil
+}
+
+type readAttachmentArgs struct {
+	ID     string `json:"id" description:"ID of the attachment, from the note in the shortened message"`
+	Offset int    `json:"offset,omitempty" description:"Byte offset to start reading at (default: 0)"`
+	Length int    `json:"length,omitempty" description:"Bytes to read (default: 20000, max: 50000)"`
+}
+
+// readAttachmentTool lets the model page through messages that were too
+// large to keep in its context
+type readAttachmentTool struct {
+	agent *Agent
+}
+
+func (t *readAttachmentTool) Name() string {
+	return "read_attachment"
+}
+
+func (t *readAttachmentTool) Description() string {
+	return `Read part of a message that was too large to keep in the conversation, such as a pasted log file or long command output.
+
+Usage:
+- Oversized messages keep only their start and end, with a note giving the attachment ID and size
+- Read the part you need with offset and length instead of the whole attachment, which may not fit your context
+
+Prefer narrowing down with a few targeted reads over reading everything.`
+}
+
+func (t *readAttachmentTool) Risk() tools.Risk {
+	return tools.RiskRead
+}
+
+func (t *readAttachmentTool) Run(ctx context.Context, args readAttachmentArgs) (string, error) {
+	length := args.Length
+	if length <= 0 {
+		length = attachmentPage
+	}
+	length = min(length, maxAttachmentPage)
+	offset := max(args.Offset, 0)
+
+	row, err := t.agent.readQueries().ReadAttachment(ctx, db.ReadAttachmentParams{
+		Offset: int64(offset),
+		Length: int64(length),
+		ID:     args.ID,
+	})
+	sessionID := tools.SessionIDFromContext(ctx)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && sessionID != "" && row.SessionID != sessionID) {
+		return "", fmt.Errorf("attachment %s not found", args.ID)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read attachment: %w", err)
+	}
+	if int64(offset) >= row.Size {
+		return "", fmt.Errorf("offset %d is past the end of the attachment (%d bytes)", offset, row.Size)
+	}
+
+	// The range is in bytes, so runes at its edges may be cut
+	part := strings.ToValidUTF8(row.Part, "")
+	end := offset + len(row.Part)
+	header := fmt.Sprintf("Bytes %d-%d of %d", offset, end, row.Size)
+	if int64(end) < row.Size {
+		header += fmt.Sprintf("; continue at offset %d", end)
+	}
+	return header + ":\n\n" + part, nil
+}
@@ -0,0 +1,253 @@
+package agent
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/omnitrix-sh/core.sh/internal/db"
+	"github.com/omnitrix-sh/core.sh/internal/embeddings"
+	"github.com/omnitrix-sh/core.sh/internal/tools"
+	"github.com/omnitrix-sh/core.sh/pkg/models"
+)
+
+const (
+	defaultMemoryTopK     = 5
+	defaultMemoryMinScore = 0.3
+	// maxMemoryLength is the longest memory the remember tool saves, in
+	// bytes
+	maxMemoryLength = 500
+)
+
+// memoriesHeader introduces the recalled memories in the system prompt
+const memoriesHeader = "You saved these memories in earlier conversations with the remember tool. Rely on them where they apply; what the user says in this conversation takes precedence:\n"
+
+// ErrMemoryNotFound is returned for memory IDs that don't exist
+var ErrMemoryNotFound = errors.New("memory not found")
+
+// Memory is a fact or preference saved with the remember tool
+type Memory struct {
+	ID        string    `json:"id"`
+	Content   string    `json:"content"`
+	SessionID string    `json:"session_id,omitempty"` // where it was saved
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// SetMemory configures long-term memory. Unless disabled, the model saves
+// memories with the remember tool and the ones relevant to each message
+// are added to the system prompt.
+func (a *Agent) SetMemory(cfg models.MemoryConfig) {
+	a.memory = cfg
+	if !cfg.Disabled {
+		return
+	}
+	kept := a.tools[:0:0]
+	for _, tool := range a.tools {
+		if tool.Name() != rememberToolName {
+			kept = append(kept, tool)
+		}
+	}
+	a.tools = kept
+}
+
+// Memories returns every memory, newest first
+func (a *Agent) Memories(ctx context.Context) ([]Memory, error) {
+	rows, err := a.queries.ListMemories(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list memories: %w", err)
+	}
+	memories := make([]Memory, len(rows))
+	for i, row := range rows {
+		memories[i] = Memory{
+			ID:        row.ID,
+			Content:   row.Content,
+			SessionID: row.SessionID,
+			CreatedAt: time.Unix(row.CreatedAt, 0),
+		}
+	}
+	return memories, nil
+}
+
+// DeleteMemory deletes a memory, so it is no longer recalled
+func (a *Agent) DeleteMemory(ctx context.Context, id string) error {
+	deleted, err := a.queries.DeleteMemory(ctx, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete memory: %w", err)
+	}
+	if deleted == 0 {
+		return fmt.Errorf("%w: %s", ErrMemoryNotFound, id)
+	}
+	return nil
+}
+
+// memoryModel returns the embedding model memories are recalled with, or
+// "" to recall the most recent ones
+func (a *Agent) memoryModel() string {
+	return cmp.Or(a.memory.EmbeddingModel, a.retrieval.EmbeddingModel)
+}
+
+// remember saves a memory. It is embedded now if it can be, and otherwise
+// when it is first recalled.
+func (a *Agent) remember(ctx context.Context, sessionID, content string) error {
+	content = strings.TrimSpace(content)
+	if content == "" {
+		return fmt.Errorf("content is empty")
+	}
+	if len(content) > maxMemoryLength {
+		return fmt.Errorf("the memory is %d bytes; keep it to one fact of at most %d", len(content), maxMemoryLength)
+	}
+	rows, err := a.queries.ListMemories(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list memories: %w", err)
+	}
+	for _, row := range rows {
+		if strings.EqualFold(row.Content, content) {
+			return nil
+		}
+	}
+
+	arg := db.CreateMemoryParams{
+		ID:        uuid.New().String(),
+		Content:   content,
+		SessionID: sessionID,
+		CreatedAt: time.Now().Unix(),
+	}
+	if model := a.memoryModel(); model != "" {
+		if vectors, err := a.embed(ctx, model, []string{content}); err == nil {
+			arg.Model = model
+			arg.Vector = embeddings.Encode(vectors[0])
+		}
+	}
+	if err := a.queries.CreateMemory(ctx, arg); err != nil {
+		return fmt.Errorf("failed to save memory: %w", err)
+	}
+	return nil
+}
+
+// recall adds the memories most relevant to next to the system prompt.
+// Without an embedding model, or if embedding fails, those are the most
+// recent ones.
+func (a *Agent) recall(ctx context.Context, sessionID string, parts promptParts, next models.Message) promptParts {
+	if a.memory.Disabled {
+		return parts
+	}
+	rows, err := a.queries.ListMemories(ctx)
+	if err != nil || len(rows) == 0 {
+		return parts
+	}
+	topK := cmp.Or(a.memory.TopK, defaultMemoryTopK)
+	chosen, err := a.relevantMemories(ctx, rows, embedText(next), topK)
+	if err != nil {
+		chosen = rows[:min(topK, len(rows))]
+	}
+	if len(chosen) == 0 {
+		return parts
+	}
+
+	var content strings.Builder
+	content.WriteString(memoriesHeader)
+	for _, row := range chosen {
+		fmt.Fprintf(&content, "- %s\n", row.Content)
+	}
+	parts.system = withInstruction(parts.system, sessionID, strings.TrimSuffix(content.String(), "\n"))
+	return parts
+}
+
+// relevantMemories returns up to topK memories similar enough to query,
+// most similar first, embedding memories that have no embedding from the
+// current model yet. Without a model or query they are the newest.
+func (a *Agent) relevantMemories(ctx context.Context, rows []db.Memory, query string, topK int) ([]db.Memory, error) {
+	model := a.memoryModel()
+	if model == "" || query == "" {
+		return rows[:min(topK, len(rows))], nil
+	}
+
+	var pending []int
+	for i, row := range rows {
+		if row.Model != model || len(row.Vector) == 0 {
+			pending = append(pending, i)
+		}
+	}
+	for start := 0; start < len(pending); start += embedBatch {
+		batch := pending[start:min(start+embedBatch, len(pending))]
+		input := make([]string, len(batch))
+		for i, index := range batch {
+			input[i] = rows[index].Content
+		}
+		result, err := a.embed(ctx, model, input)
+		if err != nil {
+			return nil, err
+		}
+		for i, index := range batch {
+			rows[index].Model = model
+			rows[index].Vector = embeddings.Encode(result[i])
+			err := a.queries.UpdateMemoryEmbedding(ctx, db.UpdateMemoryEmbeddingParams{
+				Model:  model,
+				Vector: rows[index].Vector,
+				ID:     rows[index].ID,
+			})
+			if err != nil {
+				return nil, fmt.Errorf("failed to save memory embedding: %w", err)
+			}
+		}
+	}
+
+	queryVectors, err := a.embed(ctx, model, []string{query})
+	if err != nil {
+		return nil, err
+	}
+	minScore := cmp.Or(a.memory.MinScore, defaultMemoryMinScore)
+	scores := make(map[string]float64, len(rows))
+	var chosen []db.Memory
+	for _, row := range rows {
+		if score := embeddings.Cosine(queryVectors[0], embeddings.Decode(row.Vector)); score >= minScore {
+			scores[row.ID] = score
+			chosen = append(chosen, row)
+		}
+	}
+	sort.SliceStable(chosen, func(i, j int) bool {
+		return scores[chosen[i].ID] > scores[chosen[j].ID]
+	})
+	return chosen[:min(topK, len(chosen))], nil
+}
+
+const rememberToolName = "remember"
+
+type rememberArgs struct {
+	Content string `json:"content" description:"The fact or preference in a sentence or two that make sense without this conversation"`
+}
+
+// rememberTool saves a memory that later sessions recall
+type rememberTool struct {
+	agent *Agent
+}
+
+func (t *rememberTool) Name() string {
+	return rememberToolName
+}
+
+func (t *rememberTool) Description() string {
+	return `Save a fact or preference to remember in later conversations, such as how the user likes changes explained, the commands a project is built and tested with, or conventions the user asked you to follow.
+
+Usage:
+- Save what will still be true and useful later, not the details of the current task
+- Save one fact per call, written so it makes sense without this conversation
+- Never save secrets such as passwords or API keys
+- Relevant memories are shown to you at the start of later conversations`
+}
+
+func (t *rememberTool) Risk() tools.Risk {
+	return tools.RiskRead
+}
+
+func (t *rememberTool) Run(ctx context.Context, args rememberArgs) (string, error) {
+	if err := t.agent.remember(ctx, tools.SessionIDFromContext(ctx), args.Content); err != nil {
+		return "", err
+	}
+	return "Remembered.", nil
+}
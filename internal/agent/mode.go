@@ -0,0 +1,122 @@
+package agent
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/omnitrix-sh/core.sh/internal/db"
+	"github.com/omnitrix-sh/core.sh/internal/tools"
+	"github.com/omnitrix-sh/core.sh/pkg/models"
+)
+
+// Mode is what the agent may do in a session
+type Mode string
+
+const (
+	// ModeBuild has every tool
+	ModeBuild Mode = "build"
+	// ModePlan only has tools that read: the model investigates and
+	// proposes a plan, which the user carries out by switching to build
+	ModePlan Mode = "plan"
+)
+
+// planInstruction is added to the system prompt in plan mode
+const planInstruction = "You are in plan mode: you can read the project but not change it, and tools that write files or run commands are not available. Investigate what the task needs, then reply with a concrete, numbered plan naming the files and changes involved, and any open questions. The user switches to build mode to carry it out."
+
+// ParseMode checks a mode name. An empty name is build mode.
+func ParseMode(name string) (Mode, error) {
+	switch Mode(name) {
+	case "", ModeBuild:
+		return ModeBuild, nil
+	case ModePlan:
+		return ModePlan, nil
+	}
+	return "", fmt.Errorf("unknown mode %q, expected plan or build", name)
+}
+
+// SetMode sets the mode of sessions that haven't chosen one with
+// SetSessionMode, build unless set
+func (a *Agent) SetMode(mode Mode) error {
+	mode, err := ParseMode(string(mode))
+	if err != nil {
+		return err
+	}
+	a.mode = mode
+	return nil
+}
+
+// SetSessionMode switches a session to a mode, taking effect with its
+// next message. The mode is kept with the session.
+func (a *Agent) SetSessionMode(ctx context.Context, sessionID string, mode Mode) error {
+	mode, err := ParseMode(string(mode))
+	if err != nil {
+		return err
+	}
+	err = a.queries.SetSessionMode(ctx, db.SetSessionModeParams{
+		Mode:      sql.NullString{String: string(mode), Valid: true},
+		UpdatedAt: time.Now().Unix(),
+		ID:        sessionID,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to set session mode: %w", err)
+	}
+	return nil
+}
+
+// SessionMode returns the mode of a session
+func (a *Agent) SessionMode(ctx context.Context, sessionID string) (Mode, error) {
+	mode, err := a.queries.GetSessionMode(ctx, sessionID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return "", fmt.Errorf("failed to load session mode: %w", err)
+	}
+	if mode.Valid && mode.String != "" {
+		return Mode(mode.String), nil
+	}
+	if a.mode == "" {
+		return ModeBuild, nil
+	}
+	return a.mode, nil
+}
+
+// allows tells whether a tool is available in the mode
+func (m Mode) allows(tool tools.Tool) bool {
+	return m != ModePlan || tool.Risk() == tools.RiskRead
+}
+
+// withModeInstruction adds the instruction of the mode to the system
+// prompt
+func withModeInstruction(system []models.Message, sessionID string, mode Mode) []models.Message {
+	if mode != ModePlan {
+		return system
+	}
+	return withInstruction(system, sessionID, planInstruction)
+}
+
+// withInstruction adds text to the end of the system prompt
+func withInstruction(system []models.Message, sessionID, text string) []models.Message {
+	if len(system) == 0 {
+		return []models.Message{{SessionID: sessionID, Role: models.RoleSystem, Content: text}}
+	}
+	system = append([]models.Message{}, system...)
+	last := &system[len(system)-1]
+	last.Content += "\n\n" + text
+	return system
+}
+
+type modeKey struct{}
+
+// withMode records the mode of a run in the context its tools run with
+func withMode(ctx context.Context, mode Mode) context.Context {
+	return context.WithValue(ctx, modeKey{}, mode)
+}
+
+// modeOf returns the mode recorded by withMode, build if none
+func modeOf(ctx context.Context) Mode {
+	if mode, ok := ctx.Value(modeKey{}).(Mode); ok {
+		return mode
+	}
+	return ModeBuild
+}
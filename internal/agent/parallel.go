@@ -0,0 +1,123 @@
+package agent
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/omnitrix-sh/core.sh/internal/events"
+	"github.com/omnitrix-sh/core.sh/internal/tools"
+	"github.com/omnitrix-sh/core.sh/pkg/models"
+)
+
+// defaultToolWorkers is how many read-only tool calls run at once unless
+// SetToolExecution says otherwise
+const defaultToolWorkers = 4
+
+// SetToolExecution sets how many tool calls of a response run at once and
+// how long each may take
+func (a *Agent) SetToolExecution(cfg models.ToolExecutionConfig) {
+	a.toolExec = cfg
+}
+
+// toolRun is the outcome of a tool call
+type toolRun struct {
+	result string
+	err    error
+	images []models.ImagePart // attached by the tool, see toolImages
+}
+
+// runToolCalls executes the tool calls of a response and returns their
+// outcomes in the order of calls. Consecutive calls of read-only tools run
+// concurrently; any other call waits for the calls before it and runs
+// alone, so the model's edits and commands happen in the order it asked.
+func (a *Agent) runToolCalls(ctx context.Context, sessionID string, calls []models.ToolCall, status *events.Reporter) []toolRun {
+	runs := make([]toolRun, len(calls))
+	workers := a.toolExec.Workers
+	if workers <= 0 {
+		workers = defaultToolWorkers
+	}
+
+	for i := 0; i < len(calls); {
+		// A batch is a run of read-only calls, or a single other call
+		end := i + 1
+		if a.readOnly(calls[i]) {
+			for end < len(calls) && a.readOnly(calls[end]) {
+				end++
+			}
+		}
+		if end-i == 1 || workers == 1 {
+			for j := i; j < end; j++ {
+				runs[j] = a.runToolCall(ctx, sessionID, calls[j], status)
+			}
+			i = end
+			continue
+		}
+
+		var wg sync.WaitGroup
+		sem := make(chan struct{}, workers)
+		for j := i; j < end; j++ {
+			wg.Add(1)
+			sem <- struct{}{}
+			go func(j int) {
+				defer wg.Done()
+				defer func() { <-sem }()
+				runs[j] = a.runToolCall(ctx, sessionID, calls[j], status)
+			}(j)
+		}
+		wg.Wait()
+		i = end
+	}
+	return runs
+}
+
+// runToolCall executes one tool call and publishes its progress
+func (a *Agent) runToolCall(ctx context.Context, sessionID string, call models.ToolCall, status *events.Reporter) toolRun {
+	status.Set(events.StateTool, call.Function.Name)
+	a.publishToolStarted(sessionID, call)
+	started := time.Now()
+
+	callCtx := ctx
+	if a.events != nil {
+		callCtx = tools.WithOutputStream(callCtx, func(output string) {
+			a.publishToolOutput(sessionID, call, output)
+		})
+	}
+	var images []models.ImagePart
+	if a.seesImages() {
+		callCtx = tools.WithImageAttacher(callCtx, func(image models.ImagePart) {
+			images = append(images, image)
+		})
+	}
+	result, err := a.executeTool(callCtx, sessionID, call)
+	if err != nil {
+		images = nil
+	}
+
+	a.publishToolFinished(sessionID, call, result, err, started)
+	return toolRun{result: result, err: err, images: images}
+}
+
+// readOnly tells whether a call is of a tool that only reads, and so can
+// run alongside others
+func (a *Agent) readOnly(call models.ToolCall) bool {
+	for _, t := range a.toolList() {
+		if t.Name() == call.Function.Name {
+			return t.Risk() == tools.RiskRead
+		}
+	}
+	return false
+}
+
+// toolTimeout returns how long a call of the named tool may take once
+// approved, or 0 for no limit. Questions to the user only time out if configured to, as
+// they wait on the user rather than on work.
+func (a *Agent) toolTimeout(name string) time.Duration {
+	if seconds, ok := a.toolExec.Timeouts[name]; ok {
+		return time.Duration(seconds) * time.Second
+	}
+	if name == askToolName {
+		return 0
+	}
+	return time.Duration(a.toolExec.Timeout) * time.Second
+}
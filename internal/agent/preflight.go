@@ -0,0 +1,102 @@
+package agent
+
+import (
+	"fmt"
+
+	"github.com/omnitrix-sh/core.sh/internal/tokens"
+	"github.com/omnitrix-sh/core.sh/pkg/models"
+)
+
+// Context overflow policies
+const (
+	OverflowTrim   = "trim"
+	OverflowReject = "reject"
+)
+
+// defaultOutputReserve is the room kept free for the reply when the request
+// does not set MaxTokens
+const defaultOutputReserve = 1024
+
+// SetContextLimit sets the model's context window in tokens and what to do
+// when a request would not fit: trim the oldest history, compact or
+// retrieve it, or reject it. A size of 0 disables the check.
+func (a *Agent) SetContextLimit(size int, policy string) {
+	a.contextSize = size
+	a.overflow = policy
+}
+
+// outputReserve is how many tokens of the context window are kept for the
+// model's reply
+func (a *Agent) outputReserve(req models.ChatRequest) int {
+	if req.MaxTokens > 0 {
+		return req.MaxTokens
+	}
+	if a.contextSize/4 < defaultOutputReserve {
+		return a.contextSize / 4
+	}
+	return defaultOutputReserve
+}
+
+// preflight checks that a request fits the context window before it is sent.
+// Under the trim policy the oldest history is dropped from the request (not
+// from the session) until it fits; otherwise an ErrContextLengthExceeded
+// error is returned.
+func (a *Agent) preflight(req *models.ChatRequest) error {
+	if a.contextSize <= 0 {
+		return nil
+	}
+
+	counter := tokens.ForModel(a.model)
+	budget := a.contextSize - a.outputReserve(*req)
+	used := tokens.Request(counter, *req)
+	if used <= budget {
+		return nil
+	}
+
+	if a.overflow != OverflowReject {
+		req.Messages, used = trimHistory(counter, req.Messages, used, budget)
+		if used <= budget {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%w: prompt is %d tokens but only %d of the %d token context are available",
+		models.ErrContextLengthExceeded, used, budget, a.contextSize)
+}
+
+// trimHistory drops the oldest messages until the prompt fits the budget.
+// Leading system messages and everything from the latest user message on are
+// kept, and tool results are dropped together with the call that produced
+// them so the history stays valid.
+func trimHistory(counter tokens.Counter, messages []models.Message, used, budget int) ([]models.Message, int) {
+	start := 0
+	for start < len(messages) && messages[start].Role == models.RoleSystem {
+		start++
+	}
+
+	end := len(messages)
+	for end > start && messages[end-1].Role != models.RoleUser {
+		end--
+	}
+	if end > start {
+		end-- // keep the latest user message
+	}
+
+	drop := start
+	for drop < end && used > budget {
+		used -= tokens.Message(counter, messages[drop])
+		drop++
+		for drop < end && messages[drop].Role == models.RoleTool {
+			used -= tokens.Message(counter, messages[drop])
+			drop++
+		}
+	}
+	if drop == start {
+		return messages, used
+	}
+
+	trimmed := make([]models.Message, 0, len(messages)-(drop-start))
+	trimmed = append(trimmed, messages[:start]...)
+	trimmed = append(trimmed, messages[drop:]...)
+	return trimmed, used
+}
@@ -0,0 +1,89 @@
+package agent
+
+import (
+	"time"
+
+	"github.com/omnitrix-sh/core.sh/pkg/models"
+)
+
+// imageOmitted replaces images sent to a model without vision
+const imageOmitted = "[An image was attached here, but this model can't see images]"
+
+// SetModelProfile sets the generation defaults and capabilities of the
+// model, typically from config.ModelProfileFor. Its context size is given
+// to SetContextLimit.
+func (a *Agent) SetModelProfile(profile models.ModelProfile) {
+	a.profile = profile
+	a.sampling = profile.SamplingParams
+}
+
+// fitModel fills in the model's defaults and drops what it can't take from
+// a request: tools for a model without tool calling, images for one
+// without vision. Messages are copied before they are changed, so the
+// session's history keeps its images.
+func (a *Agent) fitModel(req *models.ChatRequest) {
+	a.sampling.ApplyTo(req)
+	if a.profile.SupportsTools != nil && !*a.profile.SupportsTools {
+		req.Tools = nil
+	}
+	if a.seesImages() {
+		return
+	}
+	var messages []models.Message
+	for i, msg := range req.Messages {
+		if !hasImage(msg) {
+			continue
+		}
+		if messages == nil {
+			messages = append([]models.Message(nil), req.Messages...)
+		}
+		parts := make([]models.ContentPart, len(msg.Parts))
+		for j, part := range msg.Parts {
+			if _, ok := part.(models.ImagePart); ok {
+				part = models.TextPart{Text: imageOmitted}
+			}
+			parts[j] = part
+		}
+		messages[i].Parts = parts
+	}
+	if messages != nil {
+		req.Messages = messages
+	}
+}
+
+// seesImages reports whether the model can be shown images. Models not
+// known to lack vision are assumed to have it.
+func (a *Agent) seesImages() bool {
+	return a.profile.SupportsVision == nil || *a.profile.SupportsVision
+}
+
+// toolImages returns a message showing the model the images tools attached
+// to their results, since providers only take images from the user. It is
+// sent for the rest of the run but not saved, like images the user sends.
+func toolImages(sessionID string, runs []toolRun) (models.Message, bool) {
+	var parts []models.ContentPart
+	for _, run := range runs {
+		for _, image := range run.images {
+			parts = append(parts, image)
+		}
+	}
+	if len(parts) == 0 {
+		return models.Message{}, false
+	}
+	return models.Message{
+		SessionID: sessionID,
+		Role:      models.RoleUser,
+		Content:   "The images attached by the tool results above:",
+		Parts:     parts,
+		CreatedAt: time.Now(),
+	}, true
+}
+
+func hasImage(msg models.Message) bool {
+	for _, part := range msg.Parts {
+		if _, ok := part.(models.ImagePart); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,21 @@
+package agent
+
+import (
+	"context"
+
+	"github.com/omnitrix-sh/core.sh/pkg/models"
+)
+
+// Provider serves a model provider the agent has no client of its own
+// for, such as one a plugin offers
+type Provider interface {
+	Chat(ctx context.Context, req models.ChatRequest) (*models.ChatResponse, error)
+	Stream(ctx context.Context, req models.ChatRequest) (<-chan models.StreamChunk, error)
+	Embed(ctx context.Context, model string, input []string) ([][]float32, error)
+}
+
+// SetProvider sets what serves the agent's provider when it is not one of
+// the built-in ones
+func (a *Agent) SetProvider(p Provider) {
+	a.external = p
+}
@@ -0,0 +1,100 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/omnitrix-sh/core.sh/internal/events"
+	"github.com/omnitrix-sh/core.sh/pkg/models"
+)
+
+// The publish helpers report a run's progress on the event bus, see
+// SetEventBus. Without a bus they do nothing.
+
+func (a *Agent) publishMessage(msg models.Message) {
+	if a.events == nil {
+		return
+	}
+	a.events.Publish(events.Event{Type: events.TypeMessage, SessionID: msg.SessionID, Message: &msg})
+}
+
+func (a *Agent) publishToolStarted(sessionID string, call models.ToolCall) {
+	if a.events == nil {
+		return
+	}
+	a.events.Publish(events.Event{
+		Type:      events.TypeToolStarted,
+		SessionID: sessionID,
+		Tool: &events.Tool{
+			CallID:    call.ID,
+			Name:      call.Function.Name,
+			Arguments: call.Function.Arguments,
+		},
+	})
+}
+
+func (a *Agent) publishToolFinished(sessionID string, call models.ToolCall, result string, err error, started time.Time) {
+	if a.events == nil {
+		return
+	}
+	tool := &events.Tool{
+		CallID:     call.ID,
+		Name:       call.Function.Name,
+		Arguments:  call.Function.Arguments,
+		Result:     result,
+		DurationMS: time.Since(started).Milliseconds(),
+	}
+	if err != nil {
+		tool.Error = err.Error()
+	}
+	a.events.Publish(events.Event{Type: events.TypeToolFinished, SessionID: sessionID, Tool: tool})
+}
+
+func (a *Agent) publishToolOutput(sessionID string, call models.ToolCall, output string) {
+	a.events.Publish(events.Event{
+		Type:      events.TypeToolOutput,
+		SessionID: sessionID,
+		Tool: &events.Tool{
+			CallID: call.ID,
+			Name:   call.Function.Name,
+			Output: output,
+		},
+	})
+}
+
+func (a *Agent) publishDelta(sessionID string, chunk models.StreamChunk) {
+	if a.events == nil {
+		return
+	}
+	a.events.Publish(events.Event{
+		Type:      events.TypeDelta,
+		SessionID: sessionID,
+		Delta:     &events.Delta{Kind: chunk.Kind, Text: chunk.Delta},
+	})
+}
+
+// publishRun reports how a run ended. started is zero for runs that failed
+// before they began.
+func (a *Agent) publishRun(sessionID, content string, err error, started time.Time) {
+	if a.events == nil {
+		return
+	}
+	if err != nil {
+		a.events.Publish(events.Event{Type: events.TypeError, SessionID: sessionID, Error: &events.Error{Message: err.Error()}})
+		return
+	}
+	run := &events.Run{Content: content}
+	if !started.IsZero() {
+		run.DurationMS = time.Since(started).Milliseconds()
+	}
+	a.events.Publish(events.Event{Type: events.TypeRunCompleted, SessionID: sessionID, Run: run})
+}
+
+// errStreamEnded is why a stream stopped before the response was complete
+func errStreamEnded(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return errors.New("stream ended before the response was complete")
+}
@@ -0,0 +1,117 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/omnitrix-sh/core.sh/pkg/models"
+)
+
+// sessionRun is a run in progress in a session
+type sessionRun struct {
+	stream bool               // streamed runs take no queued messages
+	queued []models.Message   // user messages waiting for the tool loop
+	cancel context.CancelFunc // see Cancel
+	done   chan struct{}      // closed when the run ends
+}
+
+// beginRun claims a session for a run, waiting for the run in progress
+// to end first, so the messages of two runs are never interleaved. The
+// run uses the returned context, which Cancel cancels.
+func (a *Agent) beginRun(ctx context.Context, sessionID string, stream bool) (context.Context, *sessionRun, error) {
+	for {
+		a.runMu.Lock()
+		if a.runs == nil {
+			a.runs = make(map[string]*sessionRun)
+		}
+		run, ok := a.runs[sessionID]
+		if !ok {
+			runCtx, cancel := context.WithCancel(ctx)
+			run = &sessionRun{stream: stream, cancel: cancel, done: make(chan struct{})}
+			a.runs[sessionID] = run
+			a.runMu.Unlock()
+			return runCtx, run, nil
+		}
+		a.runMu.Unlock()
+
+		select {
+		case <-run.done:
+		case <-ctx.Done():
+			return nil, nil, ctx.Err()
+		}
+	}
+}
+
+// endRun releases a session claimed by beginRun for run, unless the run
+// already ended in takeQueued. Messages still queued, because the run
+// failed, are dropped.
+func (a *Agent) endRun(sessionID string, run *sessionRun) {
+	run.cancel()
+	a.runMu.Lock()
+	defer a.runMu.Unlock()
+	if a.runs[sessionID] == run {
+		close(run.done)
+		delete(a.runs, sessionID)
+	}
+}
+
+// Enqueue adds a user message to the run in progress in a session. The
+// run sends it once the tool calls of its current step are done, or after
+// its reply if there are none, and the run's reply is then the reply to
+// the last message queued. Enqueue reports false when the session has no
+// run that takes messages, such as a streamed one; send the message with
+// Chat or Stream instead, which wait for the session to be free.
+func (a *Agent) Enqueue(sessionID, userMessage string, parts ...models.ContentPart) bool {
+	a.runMu.Lock()
+	defer a.runMu.Unlock()
+	run, ok := a.runs[sessionID]
+	if !ok || run.stream {
+		return false
+	}
+	run.queued = append(run.queued, models.Message{
+		ID:        uuid.New().String(),
+		SessionID: sessionID,
+		Role:      models.RoleUser,
+		Content:   userMessage,
+		Parts:     parts,
+		CreatedAt: time.Now(),
+	})
+	return true
+}
+
+// takeQueued removes the messages queued for a session's run. With last,
+// an empty queue ends the run, so nothing can be queued that it would not
+// send.
+func (a *Agent) takeQueued(sessionID string, last bool) []models.Message {
+	a.runMu.Lock()
+	defer a.runMu.Unlock()
+	run, ok := a.runs[sessionID]
+	if !ok {
+		return nil
+	}
+	queued := run.queued
+	run.queued = nil
+	if last && len(queued) == 0 {
+		close(run.done)
+		delete(a.runs, sessionID)
+	}
+	return queued
+}
+
+// sendQueued saves the messages queued for a session's run and returns
+// them to be added to the request. See takeQueued for last.
+func (a *Agent) sendQueued(ctx context.Context, sessionID string, last bool) ([]models.Message, error) {
+	queued := a.takeQueued(sessionID, last)
+	for i := range queued {
+		if err := a.limitMessage(ctx, &queued[i]); err != nil {
+			return nil, err
+		}
+		if err := a.saveMessage(ctx, queued[i]); err != nil {
+			return nil, fmt.Errorf("failed to save queued message: %w", err)
+		}
+		a.checkpoint(ctx, sessionID, queued[i].ID, queued[i].Content)
+	}
+	return queued, nil
+}
@@ -0,0 +1,158 @@
+package agent
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/omnitrix-sh/core.sh/internal/db"
+	"github.com/omnitrix-sh/core.sh/pkg/models"
+)
+
+// DeleteLastReply deletes everything that answered the session's last user
+// message: the model's replies, its tool calls and their results. The
+// message itself stays, to be answered by the next run. It returns how
+// many messages were deleted.
+func (a *Agent) DeleteLastReply(ctx context.Context, sessionID string) (int64, error) {
+	ctx, run, err := a.beginRun(ctx, sessionID, false)
+	if err != nil {
+		return 0, err
+	}
+	defer a.endRun(sessionID, run)
+
+	turn, err := a.lastTurn(ctx, sessionID)
+	if err != nil {
+		return 0, err
+	}
+	if len(turn) < 2 {
+		return 0, nil
+	}
+	return a.deleteFrom(ctx, sessionID, turn[1].ID)
+}
+
+// Regenerate deletes the reply to the session's last user message, as
+// DeleteLastReply does, and runs the message again. With a model other
+// than "" the new reply comes from that model, or alias, of the same
+// provider.
+// Parts sent with the message, such as images, were not stored and are
+// not sent again.
+func (a *Agent) Regenerate(ctx context.Context, sessionID, model string) (string, error) {
+	model, err := a.resolveModel(model)
+	if err != nil {
+		return "", err
+	}
+	return a.turn(ctx, sessionID, func(ctx context.Context) (string, error) {
+		turn, err := a.lastTurn(ctx, sessionID)
+		if err != nil {
+			return "", err
+		}
+		if _, err := a.deleteFrom(ctx, sessionID, turn[0].ID); err != nil {
+			return "", err
+		}
+		if model != "" {
+			ctx = withModel(ctx, model)
+		}
+		return a.runChat(ctx, sessionID, turn[0].Content)
+	})
+}
+
+// EditMessage replaces one of the session's user messages with content:
+// the message and everything after it are deleted and the new message is
+// run in its place. Files the deleted turns changed stay as they are;
+// restore the message's checkpoint to undo them.
+func (a *Agent) EditMessage(ctx context.Context, sessionID, messageID, content string) (string, error) {
+	return a.turn(ctx, sessionID, func(ctx context.Context) (string, error) {
+		if err := a.flushMessages(ctx); err != nil {
+			return "", err
+		}
+		msg, err := a.queries.GetMessage(ctx, messageID)
+		if errors.Is(err, sql.ErrNoRows) || (err == nil && msg.SessionID != sessionID) {
+			return "", fmt.Errorf("session %s has no message %s", sessionID, messageID)
+		}
+		if err != nil {
+			return "", fmt.Errorf("failed to load message: %w", err)
+		}
+		if models.Role(msg.Role) != models.RoleUser {
+			return "", fmt.Errorf("message %s is not a user message", messageID)
+		}
+		if _, err := a.deleteFrom(ctx, sessionID, messageID); err != nil {
+			return "", err
+		}
+		return a.runChat(ctx, sessionID, content)
+	})
+}
+
+// lastTurn returns the session's last user message followed by what
+// answered it
+func (a *Agent) lastTurn(ctx context.Context, sessionID string) ([]db.Message, error) {
+	if err := a.flushMessages(ctx); err != nil {
+		return nil, err
+	}
+	rows, err := a.queries.ListLastTurns(ctx, db.ListLastTurnsParams{SessionID: sessionID, Turns: 1})
+	if err != nil {
+		return nil, fmt.Errorf("failed to load the last turn: %w", err)
+	}
+	for i, row := range rows {
+		if models.Role(row.Role) == models.RoleUser {
+			return rows[i:], nil
+		}
+	}
+	return nil, fmt.Errorf("session %s has no user message", sessionID)
+}
+
+// deleteFrom deletes a message and every later message of the session,
+// with the summaries and attachments that belong to them
+func (a *Agent) deleteFrom(ctx context.Context, sessionID, messageID string) (int64, error) {
+	err := a.queries.DeleteSessionSummariesFrom(ctx, db.DeleteSessionSummariesFromParams{SessionID: sessionID, MessageID: messageID})
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete summaries: %w", err)
+	}
+	err = a.queries.DeleteAttachmentsFrom(ctx, db.DeleteAttachmentsFromParams{SessionID: sessionID, MessageID: messageID})
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete attachments: %w", err)
+	}
+	deleted, err := a.queries.DeleteMessagesFrom(ctx, db.DeleteMessagesFromParams{SessionID: sessionID, MessageID: messageID})
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete messages: %w", err)
+	}
+	return deleted, nil
+}
+
+type modelKey struct{}
+
+// withModel has a run ask model instead of the configured one
+func withModel(ctx context.Context, model string) context.Context {
+	return context.WithValue(ctx, modelKey{}, model)
+}
+
+// runModel returns the model a run asks, see withModel
+func (a *Agent) runModel(ctx context.Context) string {
+	if model, ok := ctx.Value(modelKey{}).(string); ok {
+		return model
+	}
+	return a.model
+}
+
+// SetModelAliases sets the short names accepted for models, typically
+// Config.Aliases
+func (a *Agent) SetModelAliases(aliases map[string]models.ModelAlias) {
+	a.reloadMu.Lock()
+	defer a.reloadMu.Unlock()
+	a.aliases = aliases
+}
+
+// resolveModel returns the model an alias stands for, or name if it is
+// not one. Aliases for another provider's models are an error.
+func (a *Agent) resolveModel(name string) (string, error) {
+	a.reloadMu.RLock()
+	alias, ok := a.aliases[name]
+	a.reloadMu.RUnlock()
+	if !ok {
+		return name, nil
+	}
+	if alias.Provider != "" && alias.Provider != a.provider {
+		return "", fmt.Errorf("model %s is an alias for %s of %s, not of %s", name, alias.Model, alias.Provider, a.provider)
+	}
+	return alias.Model, nil
+}
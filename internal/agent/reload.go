@@ -0,0 +1,46 @@
+package agent
+
+import (
+	"github.com/omnitrix-sh/core.sh/internal/promptlog"
+	"github.com/omnitrix-sh/core.sh/internal/tools"
+)
+
+// SetTools replaces the tools given to New, typically rebuilt from a
+// reloaded config, while sessions run. The agent's own tools, such as
+// task and remember, stay as their settings left them. Runs already
+// underway finish with the tools they started with.
+func (a *Agent) SetTools(toolset []tools.Tool) {
+	a.reloadMu.Lock()
+	defer a.reloadMu.Unlock()
+
+	kept := append([]tools.Tool{}, toolset...)
+	for _, tool := range a.tools {
+		if !a.configured[tool.Name()] {
+			kept = append(kept, tool)
+		}
+	}
+	a.tools = kept
+	a.configured = toolNames(toolset)
+}
+
+// toolList returns the tools offered to the model
+func (a *Agent) toolList() []tools.Tool {
+	a.reloadMu.RLock()
+	defer a.reloadMu.RUnlock()
+	return a.tools
+}
+
+// logger returns the prompt logger, see SetPromptLogger
+func (a *Agent) logger() *promptlog.Logger {
+	a.reloadMu.RLock()
+	defer a.reloadMu.RUnlock()
+	return a.promptLog
+}
+
+func toolNames(toolset []tools.Tool) map[string]bool {
+	names := make(map[string]bool, len(toolset))
+	for _, tool := range toolset {
+		names[tool.Name()] = true
+	}
+	return names
+}
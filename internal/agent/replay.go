@@ -0,0 +1,200 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+
+	"github.com/omnitrix-sh/core.sh/internal/archive"
+	"github.com/omnitrix-sh/core.sh/internal/db"
+	"github.com/omnitrix-sh/core.sh/internal/prompt"
+	"github.com/omnitrix-sh/core.sh/pkg/models"
+)
+
+// seedRequest gives a request a random seed when none is configured, so the
+// recorded parameters are enough to reproduce the turn on providers that
+// honour seeds
+func seedRequest(req *models.ChatRequest) {
+	if req.Seed == nil {
+		seed := rand.Intn(1 << 31)
+		req.Seed = &seed
+	}
+}
+
+// runParams captures the parameters a request is sent with. Ollama merges
+// the provider's model options into each request, so those are recorded too.
+func (a *Agent) runParams(req models.ChatRequest) *models.RunParams {
+	params := models.NewRunParams(a.provider, req)
+	if a.provider == models.ProviderOllama {
+		params.Options = a.ollama.EffectiveOptions(req)
+	}
+	return params
+}
+
+// Replay re-sends the prompt that produced an assistant message using the
+// parameters recorded with it, and returns the new response without saving
+// it. When the exchange was archived the archived request is sent as is,
+// with secrets masked. Otherwise the prompt is rebuilt from the session's
+// stored messages and the system prompt its last event recorded, so it
+// differs from the original if history was trimmed or compacted at the
+// time.
+// Comparing the response's Fingerprint with the recorded one shows whether
+// the provider's backend changed in between.
+func (a *Agent) Replay(ctx context.Context, messageID string) (*models.ChatResponse, *models.RunParams, error) {
+	req, msg, err := a.replayRequest(ctx, messageID)
+	if err != nil {
+		return nil, nil, err
+	}
+	response, err := a.chat(ctx, req)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to call provider: %w", err)
+	}
+	return response, msg.Params, nil
+}
+
+// ReplayVariant is Replay with the request changed as variant says, for
+// comparing prompts and parameters on real turns, see the experiment
+// package. The response is not saved.
+func (a *Agent) ReplayVariant(ctx context.Context, messageID string, variant models.PromptVariant) (*models.ChatResponse, error) {
+	req, msg, err := a.replayRequest(ctx, messageID)
+	if err != nil {
+		return nil, err
+	}
+
+	if variant.SystemPrompt != "" || variant.PromptFragments != nil {
+		language, err := a.SessionLanguage(ctx, msg.SessionID)
+		if err != nil {
+			return nil, err
+		}
+		builder := a.systemPrompt
+		if builder == nil {
+			builder = prompt.NewBuilder("", "", nil, nil)
+		}
+		builder = builder.WithPrompt(variant.SystemPrompt, variant.PromptFragments)
+		mode, err := a.SessionMode(ctx, msg.SessionID)
+		if err != nil {
+			return nil, err
+		}
+		system := withModeInstruction(systemMessagesFrom(builder, msg.SessionID, language), msg.SessionID, mode)
+
+		// Only the leading system messages are the system prompt
+		rest := req.Messages
+		for len(rest) > 0 && rest[0].Role == models.RoleSystem {
+			rest = rest[1:]
+		}
+		req.Messages = append(system, rest...)
+	}
+	if variant.Model != "" {
+		if req.Model, err = a.resolveModel(variant.Model); err != nil {
+			return nil, err
+		}
+	}
+	variant.Params.Override(&req)
+
+	response, err := a.chat(ctx, req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to call provider: %w", err)
+	}
+	return response, nil
+}
+
+// replayRequest returns the request that produced an assistant message and
+// the message, see Replay
+func (a *Agent) replayRequest(ctx context.Context, messageID string) (models.ChatRequest, models.Message, error) {
+	if err := a.flushMessages(ctx); err != nil {
+		return models.ChatRequest{}, models.Message{}, err
+	}
+
+	target, err := a.queries.GetMessage(ctx, messageID)
+	if err != nil {
+		return models.ChatRequest{}, models.Message{}, fmt.Errorf("failed to load message: %w", err)
+	}
+
+	msg := convertMessage(target)
+	if msg.Role != models.RoleAssistant || msg.Params == nil {
+		return models.ChatRequest{}, msg, fmt.Errorf("message %s has no recorded run parameters", messageID)
+	}
+	if msg.Params.Provider != a.provider {
+		return models.ChatRequest{}, msg, fmt.Errorf("message %s was generated by %s, not %s", messageID, msg.Params.Provider, a.provider)
+	}
+
+	if ex, err := a.archive.ForMessage(ctx, messageID); err == nil {
+		ex.Request.Stream = false
+		return ex.Request, msg, nil
+	} else if !errors.Is(err, archive.ErrNotFound) {
+		return models.ChatRequest{}, msg, err
+	}
+
+	req, err := a.rebuildRequest(ctx, target, msg.Params)
+	if err != nil {
+		return models.ChatRequest{}, msg, err
+	}
+	return req, msg, nil
+}
+
+// rebuildRequest rebuilds the request that produced an assistant message
+// from the session's stored messages and the system prompt its last event
+// recorded, sent with params if there are any
+func (a *Agent) rebuildRequest(ctx context.Context, target db.Message, params *models.RunParams) (models.ChatRequest, error) {
+	stored, err := a.queries.ListMessagesBefore(ctx, db.ListMessagesBeforeParams{
+		SessionID: target.SessionID,
+		BeforeID:  target.ID,
+		Limit:     -1,
+	})
+	if err != nil {
+		return models.ChatRequest{}, fmt.Errorf("failed to load messages: %w", err)
+	}
+
+	// The latest event before the message holds the system prompt the
+	// original request was sent with
+	language, err := a.SessionLanguage(ctx, target.SessionID)
+	if err != nil {
+		return models.ChatRequest{}, err
+	}
+	mode, err := a.SessionMode(ctx, target.SessionID)
+	if err != nil {
+		return models.ChatRequest{}, err
+	}
+	system := withModeInstruction(a.systemMessages(target.SessionID, language), target.SessionID, mode)
+	var history []models.Message
+	for _, m := range reverse(stored) {
+		msg := convertMessage(m)
+		if msg.Role != models.RoleEvent {
+			history = append(history, msg)
+			continue
+		}
+		system = nil
+		if msg.Config != nil {
+			mode = ModeBuild
+			if msg.Config.Mode != "" {
+				mode = Mode(msg.Config.Mode)
+			}
+		}
+		if msg.Config != nil && msg.Config.SystemPrompt != "" {
+			system = []models.Message{{
+				SessionID: target.SessionID,
+				Role:      models.RoleSystem,
+				Content:   msg.Config.SystemPrompt,
+			}}
+		}
+	}
+	prompt := append(system, history...)
+
+	env, err := a.SessionEnv(ctx, target.SessionID)
+	if err != nil {
+		return models.ChatRequest{}, err
+	}
+
+	req := models.ChatRequest{
+		Messages: prompt,
+		Tools:    a.toolSchemas(target.SessionID, mode),
+	}
+	if params != nil {
+		params.ApplyTo(&req)
+	} else {
+		req.Model = target.Model.String
+	}
+	scrubEnv(&req, env)
+	return req, nil
+}
@@ -0,0 +1,217 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/omnitrix-sh/core.sh/internal/db"
+	"github.com/omnitrix-sh/core.sh/internal/embeddings"
+	"github.com/omnitrix-sh/core.sh/internal/tokens"
+	"github.com/omnitrix-sh/core.sh/pkg/models"
+)
+
+// OverflowRetrieve drops older history once the prompt nears the context
+// window and brings back only the earlier messages most relevant to the
+// new one, found by embedding similarity
+const OverflowRetrieve = "retrieve"
+
+const (
+	defaultRetrieveTopK     = 5
+	defaultRetrieveMinScore = 0.3
+	// retrieveShare is the share of the context budget, in percent, the
+	// messages brought back may take
+	retrieveShare = 20
+	// maxEmbedInput caps the text of each message embedded or brought back
+	maxEmbedInput = 2000
+	// embedBatch is how many messages are embedded per request
+	embedBatch = 32
+)
+
+// retrievedHeader introduces the messages brought back in the prompt
+const retrievedHeader = "Earlier messages from this conversation that may be relevant. The rest of the older history no longer fits and is not shown:\n\n"
+
+// SetRetrieval sets the embedding model and limits of the retrieve
+// overflow policy
+func (a *Agent) SetRetrieval(cfg models.RetrievalConfig) {
+	if cfg.TopK <= 0 {
+		cfg.TopK = defaultRetrieveTopK
+	}
+	if cfg.MinScore <= 0 {
+		cfg.MinScore = defaultRetrieveMinScore
+	}
+	a.retrieval = cfg
+}
+
+// retrieve replaces older history with the messages from it most relevant
+// to next when the prompt nears the context window. Messages are embedded
+// and stored once they drop out of the prompt, so sessions that fit never
+// pay for embeddings. If embedding fails the parts are returned unchanged
+// and preflight trims the request instead.
+func (a *Agent) retrieve(ctx context.Context, sessionID string, parts promptParts, next models.Message) promptParts {
+	if a.overflow != OverflowRetrieve || a.contextSize <= 0 || a.retrieval.EmbeddingModel == "" {
+		return parts
+	}
+
+	counter := tokens.ForModel(a.model)
+	budget := a.contextSize - a.outputReserve(models.ChatRequest{MaxTokens: a.sampling.MaxTokens})
+	used := tokens.Request(counter, models.ChatRequest{
+		Messages: append(parts.messages(), next),
+		Tools:    parts.tools,
+	})
+	if used < budget*compactThreshold/100 {
+		return parts
+	}
+
+	split := keepRecent(counter, parts.history, budget*compactKeep/100)
+	query := embedText(next)
+	if split == 0 || query == "" {
+		return parts
+	}
+	dropped := parts.history[:split]
+
+	vectors, err := a.indexMessages(ctx, sessionID, dropped)
+	if err != nil {
+		return parts
+	}
+	queryVectors, err := a.embed(ctx, a.retrieval.EmbeddingModel, []string{query})
+	if err != nil {
+		return parts
+	}
+
+	type candidate struct {
+		index int
+		score float64
+	}
+	var candidates []candidate
+	for i, msg := range dropped {
+		if vector, ok := vectors[msg.ID]; ok {
+			if score := embeddings.Cosine(queryVectors[0], vector); score >= a.retrieval.MinScore {
+				candidates = append(candidates, candidate{index: i, score: score})
+			}
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].score > candidates[j].score
+	})
+
+	// Take the best matches that fit, then restore their original order
+	var chosen []int
+	room := budget * retrieveShare / 100
+	for _, c := range candidates {
+		if len(chosen) == a.retrieval.TopK {
+			break
+		}
+		n := counter.Count(retrievedText(dropped[c.index]))
+		if n > room {
+			continue
+		}
+		room -= n
+		chosen = append(chosen, c.index)
+	}
+	sort.Ints(chosen)
+
+	parts.history = parts.history[split:]
+	parts.retrieved = nil
+	if len(chosen) > 0 {
+		var content strings.Builder
+		content.WriteString(retrievedHeader)
+		for _, i := range chosen {
+			content.WriteString(retrievedText(dropped[i]))
+		}
+		parts.retrieved = []models.Message{{
+			SessionID: sessionID,
+			Role:      models.RoleSystem,
+			Content:   content.String(),
+		}}
+	}
+	return parts
+}
+
+// indexMessages returns the stored embeddings of messages, embedding and
+// storing those that have none yet
+func (a *Agent) indexMessages(ctx context.Context, sessionID string, messages []models.Message) (map[string][]float32, error) {
+	model := a.retrieval.EmbeddingModel
+	rows, err := a.queries.ListMessageEmbeddings(ctx, db.ListMessageEmbeddingsParams{
+		SessionID: sessionID,
+		Model:     model,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to load message embeddings: %w", err)
+	}
+	vectors := make(map[string][]float32, len(rows))
+	for _, row := range rows {
+		vectors[row.MessageID] = embeddings.Decode(row.Vector)
+	}
+
+	var pending []models.Message
+	for _, msg := range messages {
+		if _, ok := vectors[msg.ID]; !ok && msg.ID != "" && embedText(msg) != "" {
+			pending = append(pending, msg)
+		}
+	}
+
+	for start := 0; start < len(pending); start += embedBatch {
+		batch := pending[start:min(start+embedBatch, len(pending))]
+		input := make([]string, len(batch))
+		for i, msg := range batch {
+			input[i] = embedText(msg)
+		}
+		result, err := a.embed(ctx, model, input)
+		if err != nil {
+			return nil, err
+		}
+		for i, msg := range batch {
+			err := a.queries.UpsertMessageEmbedding(ctx, db.UpsertMessageEmbeddingParams{
+				MessageID: msg.ID,
+				Model:     model,
+				SessionID: sessionID,
+				Vector:    embeddings.Encode(result[i]),
+				CreatedAt: time.Now().Unix(),
+			})
+			if err != nil {
+				return nil, fmt.Errorf("failed to save message embedding: %w", err)
+			}
+			vectors[msg.ID] = result[i]
+		}
+	}
+	return vectors, nil
+}
+
+// embed computes embeddings with model on the provider
+func (a *Agent) embed(ctx context.Context, model string, input []string) ([][]float32, error) {
+	switch a.provider {
+	case models.ProviderOllama:
+		return a.ollama.Embed(ctx, model, input)
+	case models.ProviderOpenAI:
+		return a.openai.Embed(ctx, model, input)
+	}
+	if a.external != nil {
+		return a.external.Embed(ctx, model, input)
+	}
+	return nil, fmt.Errorf("unsupported provider: %s", a.provider)
+}
+
+// embedText is the part of a message that is embedded, or "" for messages
+// that are never brought back
+func embedText(msg models.Message) string {
+	if msg.Role == models.RoleSystem || msg.Content == forgottenContent {
+		return ""
+	}
+	content := strings.TrimSpace(msg.Content)
+	if len(content) > maxEmbedInput {
+		content = content[:maxEmbedInput]
+	}
+	return content
+}
+
+// retrievedText renders a message brought back into the prompt
+func retrievedText(msg models.Message) string {
+	content := embedText(msg)
+	if len(strings.TrimSpace(msg.Content)) > maxEmbedInput {
+		content += "\n[truncated]"
+	}
+	return fmt.Sprintf("%s: %s\n\n", msg.Role, content)
+}
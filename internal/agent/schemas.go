@@ -0,0 +1,95 @@
+package agent
+
+import (
+	"strings"
+
+	"github.com/omnitrix-sh/core.sh/internal/tools"
+	"github.com/omnitrix-sh/core.sh/pkg/models"
+)
+
+// Tool schema modes
+const (
+	ToolSchemasFull    = "full"
+	ToolSchemasCompact = "compact"
+	ToolSchemasAuto    = "auto"
+)
+
+// compactCapableModels are model name prefixes that reliably call tools from
+// compact schemas. Smaller local models need the full parameter docs.
+var compactCapableModels = []string{
+	"gpt-4o", "gpt-4.1", "o1", "o3", "o4",
+	"claude-",
+	"deepseek-chat", "deepseek-v3",
+	"qwen2.5-coder:32b", "qwen3",
+	"llama3.3", "llama4",
+}
+
+// SetToolSchemaMode sets how tool schemas are sent, see Config.ToolSchemas
+func (a *Agent) SetToolSchemaMode(mode string) {
+	a.schemaMu.Lock()
+	defer a.schemaMu.Unlock()
+	a.schemaMode = mode
+}
+
+// compactSchemas reports whether tool schemas should be compacted for the
+// agent's model
+func (a *Agent) compactSchemas() bool {
+	switch a.schemaMode {
+	case ToolSchemasCompact:
+		return true
+	case ToolSchemasAuto:
+		model := strings.ToLower(a.model)
+		for _, prefix := range compactCapableModels {
+			if strings.HasPrefix(model, prefix) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// toolSchemas returns the schemas of the tools available in mode for the
+// next request in a session. In compact mode, tools the model has already
+// called in the session are sent in full so it has their complete
+// parameter docs from then on.
+func (a *Agent) toolSchemas(sessionID string, mode Mode) []models.Tool {
+	a.schemaMu.Lock()
+	defer a.schemaMu.Unlock()
+
+	compact := a.compactSchemas()
+	expanded := a.expandedTools[sessionID]
+
+	toolset := a.toolList()
+	schemas := make([]models.Tool, 0, len(toolset))
+	for _, tool := range toolset {
+		switch {
+		case !mode.allows(tool):
+		case compact && !expanded[tool.Name()]:
+			schemas = append(schemas, tools.ToCompactModelTool(tool))
+		default:
+			schemas = append(schemas, tools.ToModelTool(tool))
+		}
+	}
+	return schemas
+}
+
+// expandTools marks tools the model selected so their full schemas are sent
+// on later requests in the session
+func (a *Agent) expandTools(sessionID string, calls []models.ToolCall) {
+	if len(calls) == 0 {
+		return
+	}
+
+	a.schemaMu.Lock()
+	defer a.schemaMu.Unlock()
+
+	if a.expandedTools == nil {
+		a.expandedTools = make(map[string]map[string]bool)
+	}
+	if a.expandedTools[sessionID] == nil {
+		a.expandedTools[sessionID] = make(map[string]bool)
+	}
+	for _, call := range calls {
+		a.expandedTools[sessionID][call.Function.Name] = true
+	}
+}
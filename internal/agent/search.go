@@ -0,0 +1,184 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/omnitrix-sh/core.sh/internal/db"
+	"github.com/omnitrix-sh/core.sh/internal/display"
+	"github.com/omnitrix-sh/core.sh/internal/tools"
+	"github.com/omnitrix-sh/core.sh/pkg/models"
+)
+
+const (
+	defaultSearchLimit = 10
+	maxSearchLimit     = 50
+	// snippetRadius is how many characters are shown around a match
+	snippetRadius = 150
+)
+
+// SearchResult is a message matching a history search
+type SearchResult struct {
+	Message      models.Message `json:"message"`
+	SessionTitle string         `json:"session_title"`
+	Snippet      string         `json:"snippet"` // the text around the first match
+}
+
+// SearchMessages returns the user and assistant messages containing every
+// word of query, newest first, using the full-text index. Words match as
+// prefixes and "quoted words" as a phrase. An empty sessionID searches all
+// sessions.
+func (a *Agent) SearchMessages(ctx context.Context, query, sessionID string, limit int) ([]SearchResult, error) {
+	match := db.MatchQuery(query)
+	if match == "" {
+		return nil, fmt.Errorf("search query is empty")
+	}
+	if limit <= 0 {
+		limit = defaultSearchLimit
+	}
+	if err := a.flushMessages(ctx); err != nil {
+		return nil, err
+	}
+
+	rows, err := a.readQueries().SearchMessages(ctx, db.SearchMessagesParams{
+		Query:     match,
+		SessionID: sessionID,
+		Limit:     int64(limit),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to search messages: %w", err)
+	}
+
+	// The snippet is centred on the first word or phrase
+	first := strings.Trim(strings.Fields(match)[0], `"*`)
+	if phrase, ok := strings.CutPrefix(match, `"`); ok {
+		first, _, _ = strings.Cut(phrase, `"`)
+	}
+
+	results := make([]SearchResult, len(rows))
+	for i, row := range rows {
+		results[i] = SearchResult{
+			Message: models.Message{
+				ID:        row.ID,
+				SessionID: row.SessionID,
+				Role:      models.Role(row.Role),
+				Content:   row.Content,
+				CreatedAt: time.Unix(row.CreatedAt, 0),
+			},
+			SessionTitle: row.Title,
+			Snippet:      snippet(row.Content, first),
+		}
+	}
+	return results, nil
+}
+
+// snippet returns the text around the first occurrence of term on one line
+func snippet(content, term string) string {
+	index := strings.Index(strings.ToLower(content), term)
+	if index < 0 {
+		index = 0
+	}
+
+	start := max(index-snippetRadius, 0)
+	end := min(index+len(term)+snippetRadius, len(content))
+	// Don't cut runes in half
+	for start > 0 && !isRuneStart(content[start]) {
+		start--
+	}
+	for end < len(content) && !isRuneStart(content[end]) {
+		end++
+	}
+
+	text := strings.Join(strings.Fields(content[start:end]), " ")
+	if start > 0 {
+		text = "..." + text
+	}
+	if end < len(content) {
+		text += "..."
+	}
+	return text
+}
+
+func isRuneStart(b byte) bool {
+	return b&0xC0 != 0x80
+}
+
+// searchTool lets the model look up earlier parts of the conversation, and
+// of other sessions, that are no longer in its context
+type searchTool struct {
+	agent *Agent
+}
+
+func (t *searchTool) Name() string {
+	return "search_history"
+}
+
+func (t *searchTool) Description() string {
+	return `Search the conversation history for earlier messages, including ones no longer in your context and other sessions in this project.
+
+Usage:
+- Provide words the messages contain, e.g. "port redis" to find which port was chosen for Redis
+- Every word must appear in a message for it to match; words match their beginnings, so "deploy" also finds "deployment", and matching ignores case
+- Put words in double quotes to match them as a phrase, e.g. "\"connection pool\" size"
+- Searches this session by default; set scope to "all" to include previous sessions
+
+Use this to recall earlier decisions instead of guessing or asking the user again.`
+}
+
+func (t *searchTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"query": map[string]interface{}{
+				"type":        "string",
+				"description": "Words to search for",
+			},
+			"scope": map[string]interface{}{
+				"type":        "string",
+				"enum":        []string{"session", "all"},
+				"description": "Search this session (default) or all sessions",
+			},
+			"limit": map[string]interface{}{
+				"type":        "integer",
+				"description": fmt.Sprintf("Maximum results to return (default: %d, max: %d)", defaultSearchLimit, maxSearchLimit),
+			},
+		},
+		"required": []string{"query"},
+	}
+}
+
+func (t *searchTool) Risk() tools.Risk {
+	return tools.RiskRead
+}
+
+func (t *searchTool) Execute(ctx context.Context, args map[string]interface{}) (string, error) {
+	query := tools.GetStringArg(args, "query", "")
+	limit := min(tools.GetIntArg(args, "limit", defaultSearchLimit), maxSearchLimit)
+
+	sessionID := tools.SessionIDFromContext(ctx)
+	if tools.GetStringArg(args, "scope", "session") == "all" {
+		sessionID = ""
+	}
+
+	results, err := t.agent.SearchMessages(ctx, query, sessionID, limit)
+	if err != nil {
+		return "", err
+	}
+	if len(results) == 0 {
+		return fmt.Sprintf("No messages found containing: %s", query), nil
+	}
+
+	current := tools.SessionIDFromContext(ctx)
+	var output strings.Builder
+	output.WriteString(fmt.Sprintf("Found %d message(s), newest first:\n", len(results)))
+	for _, r := range results {
+		output.WriteString(fmt.Sprintf("\n[%s] %s", display.Time(r.Message.CreatedAt), r.Message.Role))
+		if r.Message.SessionID != current {
+			output.WriteString(fmt.Sprintf(" in session %q", r.SessionTitle))
+		}
+		output.WriteString(":\n" + r.Snippet + "\n")
+	}
+	return output.String(), nil
+}
@@ -0,0 +1,99 @@
+package agent
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/omnitrix-sh/core.sh/internal/db"
+	"github.com/omnitrix-sh/core.sh/pkg/models"
+)
+
+// ErrSessionNotFound is returned for sessions that don't exist
+var ErrSessionNotFound = errors.New("session not found")
+
+// CreateSession starts a session with the agent's provider and model
+func (a *Agent) CreateSession(ctx context.Context, title string) (*models.Session, error) {
+	if title == "" {
+		title = "New session"
+	}
+	now := time.Now().Unix()
+	row, err := a.queries.CreateSession(ctx, db.CreateSessionParams{
+		ID:        uuid.New().String(),
+		Title:     title,
+		Model:     a.model,
+		Provider:  string(a.provider),
+		CreatedAt: now,
+		UpdatedAt: now,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create session: %w", err)
+	}
+	session := convertSession(row)
+	return &session, nil
+}
+
+// Session returns a session
+func (a *Agent) Session(ctx context.Context, id string) (*models.Session, error) {
+	row, err := a.readQueries().GetSession(ctx, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w: %s", ErrSessionNotFound, id)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load session: %w", err)
+	}
+	session := convertSession(row)
+	return &session, nil
+}
+
+// ListSessions returns a page of sessions, most recently updated first
+func (a *Agent) ListSessions(ctx context.Context, limit, offset int) ([]models.Session, error) {
+	rows, err := a.readQueries().ListSessions(ctx, db.ListSessionsParams{
+		Limit:  int64(limit),
+		Offset: int64(offset),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sessions: %w", err)
+	}
+	sessions := make([]models.Session, len(rows))
+	for i, row := range rows {
+		sessions[i] = convertSession(row)
+	}
+	return sessions, nil
+}
+
+// DeleteSession deletes a session with its messages, attachments and
+// everything else stored for it
+func (a *Agent) DeleteSession(ctx context.Context, id string) error {
+	if _, err := a.queries.GetSession(ctx, id); errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("%w: %s", ErrSessionNotFound, id)
+	} else if err != nil {
+		return fmt.Errorf("failed to load session: %w", err)
+	}
+	// Messages still queued would fail to insert once the session is gone
+	if a.writer != nil {
+		a.writer.Discard(id)
+	}
+	if err := a.queries.DeleteSession(ctx, id); err != nil {
+		return fmt.Errorf("failed to delete session: %w", err)
+	}
+	return nil
+}
+
+func convertSession(row db.Session) models.Session {
+	return models.Session{
+		ID:               row.ID,
+		Title:            row.Title,
+		Model:            row.Model,
+		Provider:         row.Provider,
+		MessageCount:     int(row.MessageCount.Int64),
+		PromptTokens:     row.PromptTokens.Int64,
+		CompletionTokens: row.CompletionTokens.Int64,
+		Cost:             row.Cost,
+		CreatedAt:        time.Unix(row.CreatedAt, 0),
+		UpdatedAt:        time.Unix(row.UpdatedAt, 0),
+	}
+}
@@ -0,0 +1,247 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/omnitrix-sh/core.sh/internal/permissions"
+	"github.com/omnitrix-sh/core.sh/internal/tools"
+	"github.com/omnitrix-sh/core.sh/pkg/models"
+)
+
+// defaultTaskIterations is how many provider calls a task makes at most
+// unless the config says otherwise
+const defaultTaskIterations = 15
+
+// taskInstruction is added to the system prompt of sub-agents
+const taskInstruction = "You are a sub-agent: another agent handed you one task and sees nothing of your work but your final reply. Work on the task with your tools, then reply with a concise report: the answer or what you did, the files and lines involved, and anything you are unsure of. Don't ask questions; nobody can answer them."
+
+// riskRank orders risks from least to most dangerous
+var riskRank = map[tools.Risk]int{
+	tools.RiskRead:    0,
+	tools.RiskNetwork: 1,
+	tools.RiskWrite:   2,
+	tools.RiskExecute: 3,
+}
+
+// SetTasks configures the task tool, which hands work to a sub-agent with
+// its own context
+func (a *Agent) SetTasks(cfg models.TaskConfig) {
+	a.tasks = cfg
+	if !cfg.Disabled {
+		return
+	}
+	kept := a.tools[:0:0]
+	for _, tool := range a.tools {
+		if tool.Name() != taskToolName {
+			kept = append(kept, tool)
+		}
+	}
+	a.tools = kept
+}
+
+// taskTools returns the tools of sub-agents: those named in the config, or
+// every tool that only reads. Sub-agents can't start tasks of their own,
+// forget the parent's messages, remember things for the user or ask the
+// user questions.
+func (a *Agent) taskTools() []tools.Tool {
+	allowed := make(map[string]bool, len(a.tasks.Tools))
+	for _, name := range a.tasks.Tools {
+		allowed[name] = true
+	}
+	var toolset []tools.Tool
+	for _, tool := range a.toolList() {
+		switch name := tool.Name(); {
+		case name == taskToolName || name == "forget" || name == rememberToolName || name == askToolName:
+		case len(allowed) > 0 && !allowed[name]:
+		case len(allowed) == 0 && tool.Risk() != tools.RiskRead:
+		default:
+			toolset = append(toolset, tool)
+		}
+	}
+	return toolset
+}
+
+// subAgent returns an agent for a task: it talks to the same provider
+// under the same permissions, with its own tools and no history. Its
+// approvals go through the parent, which asks one question at a time.
+func (a *Agent) subAgent(toolset []tools.Tool) *Agent {
+	sub := &Agent{
+		provider:    a.provider,
+		model:       a.model,
+		tools:       toolset,
+		queries:     a.queries,
+		ollama:      a.ollama,
+		openai:      a.openai,
+		external:    a.external,
+		sampling:    a.sampling,
+		profile:     a.profile,
+		promptLog:   a.logger(),
+		pricing:     a.pricing,
+		permissions: a.permissions,
+		lsp:         a.lsp,
+		formatters:  a.formatRunner(),
+		events:      a.events,
+		secrets:     a.secrets,
+		pseudonyms:  a.pseudonyms,
+		contextSize: a.contextSize,
+		overflow:    a.overflow,
+		limits:      a.limits,
+		toolExec:    a.toolExec,
+		reader:      a.reader,
+	}
+	if a.approver != nil {
+		sub.approver = permissions.ApproverFunc(func(ctx context.Context, req permissions.Request) (bool, error) {
+			a.approveMu.Lock()
+			defer a.approveMu.Unlock()
+			return a.approver.Approve(ctx, req)
+		})
+	}
+	return sub
+}
+
+// runTask runs a sub-agent on a task until it replies. Its messages are
+// not saved; its usage counts towards the session.
+func (a *Agent) runTask(ctx context.Context, sessionID, task string) (string, error) {
+	mode := modeOf(ctx)
+	var toolset []tools.Tool
+	for _, tool := range a.taskTools() {
+		if mode.allows(tool) {
+			toolset = append(toolset, tool)
+		}
+	}
+	sub := a.subAgent(toolset)
+
+	var system string
+	if a.systemPrompt != nil {
+		system = a.systemPrompt.Build() + "\n\n"
+	}
+	messages := []models.Message{
+		{SessionID: sessionID, Role: models.RoleSystem, Content: system + taskInstruction},
+		{SessionID: sessionID, Role: models.RoleUser, Content: task},
+	}
+	schemas := make([]models.Tool, len(toolset))
+	for i, tool := range toolset {
+		schemas[i] = tools.ToModelTool(tool)
+	}
+	env := tools.EnvFromContext(ctx)
+
+	maxIterations := a.tasks.MaxIterations
+	if maxIterations <= 0 {
+		maxIterations = defaultTaskIterations
+	}
+	for i := 0; i < maxIterations; i++ {
+		req := models.ChatRequest{
+			Model:    a.model,
+			Messages: messages,
+			Tools:    schemas,
+		}
+		a.fitModel(&req)
+		seedRequest(&req)
+		scrubEnv(&req, env)
+		if err := sub.preflight(&req); err != nil {
+			return "", err
+		}
+		a.logPrompt(sessionID, req)
+
+		response, err := sub.chat(ctx, req)
+		if err != nil {
+			return "", fmt.Errorf("failed to call provider: %w", err)
+		}
+		response.Cost = a.pricing.Cost(a.model, response.Usage)
+		if err := a.recordUsage(ctx, sessionID, response.Usage, response.Cost); err != nil {
+			return "", err
+		}
+		if len(response.ToolCalls) == 0 {
+			return response.Content, nil
+		}
+
+		messages = append(messages, models.Message{
+			SessionID: sessionID,
+			Role:      models.RoleAssistant,
+			Content:   response.Content,
+			ToolCalls: response.ToolCalls,
+			CreatedAt: time.Now(),
+		})
+		runs := sub.runToolCalls(ctx, sessionID, response.ToolCalls, nil)
+		for j, call := range response.ToolCalls {
+			content := runs[j].result
+			if runs[j].err != nil {
+				content = fmt.Sprintf("Error: %v", runs[j].err)
+			}
+			messages = append(messages, models.Message{
+				SessionID:  sessionID,
+				Role:       models.RoleTool,
+				ToolCallID: call.ID,
+				Content:    shorten(content, a.toolLimit(call.Function.Name)),
+				CreatedAt:  time.Now(),
+			})
+		}
+		if msg, ok := toolImages(sessionID, runs); ok {
+			messages = append(messages, msg)
+		}
+	}
+	return "", fmt.Errorf("the task did not finish within %d steps; give it a smaller task", maxIterations)
+}
+
+// shorten keeps the start and end of content over limit bytes. Sub-agents
+// have no session to keep the rest in, so unlike limitMessage it is gone.
+func shorten(content string, limit int) string {
+	if limit < 0 || len(content) <= limit {
+		return content
+	}
+	head := firstBytes(content, limit/2)
+	tail := lastBytes(content, limit-len(head))
+	return fmt.Sprintf("%s\n\n[... %d bytes not shown; narrow the request to see them ...]\n\n%s", head, len(content)-len(head)-len(tail), tail)
+}
+
+const taskToolName = "task"
+
+type taskArgs struct {
+	Description string `json:"description" description:"A few words on what the task is for, shown to the user"`
+	Prompt      string `json:"prompt" description:"The task, with everything needed to do it: the sub-agent doesn't see this conversation"`
+}
+
+// taskTool hands a self-contained piece of work to a sub-agent, so its
+// exploration doesn't fill the parent's context
+type taskTool struct {
+	agent *Agent
+}
+
+func (t *taskTool) Name() string {
+	return taskToolName
+}
+
+func (t *taskTool) Description() string {
+	return `Hand a self-contained task to a sub-agent and get back its report. The sub-agent has its own context and, unless configured otherwise, only tools that read.
+
+Usage:
+- Use it for searches and investigations that would take many tool calls, such as finding every place a function is used and how, so only the conclusion enters this conversation
+- Several tasks called at once run at the same time
+- Say exactly what to find out and what the report should contain; the sub-agent knows nothing of this conversation
+- Don't use it for a single file read or search; call that tool directly`
+}
+
+// Risk is the highest risk of the sub-agent's tools
+func (t *taskTool) Risk() tools.Risk {
+	risk := tools.RiskRead
+	for _, tool := range t.agent.taskTools() {
+		if riskRank[tool.Risk()] > riskRank[risk] {
+			risk = tool.Risk()
+		}
+	}
+	return risk
+}
+
+func (t *taskTool) Run(ctx context.Context, args taskArgs) (string, error) {
+	if strings.TrimSpace(args.Prompt) == "" {
+		return "", fmt.Errorf("prompt is empty")
+	}
+	report, err := t.agent.runTask(ctx, tools.SessionIDFromContext(ctx), args.Prompt)
+	if err != nil {
+		return "", err
+	}
+	return report, nil
+}
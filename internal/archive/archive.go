@@ -0,0 +1,251 @@
+package archive
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/omnitrix-sh/core.sh/internal/db"
+	"github.com/omnitrix-sh/core.sh/internal/redact"
+	"github.com/omnitrix-sh/core.sh/pkg/models"
+)
+
+const (
+	defaultMaxEntries = 1000
+	defaultMaxAgeDays = 30
+
+	// pruneEvery is how many exchanges are recorded between retention passes
+	pruneEvery = 50
+)
+
+// ErrNotFound is returned when no exchange is archived for a message
+var ErrNotFound = errors.New("no archived exchange for message")
+
+// Archive stores the requests sent to providers and their responses,
+// linked to the assistant message they produced
+type Archive struct {
+	queries    *db.Queries
+	redactor   *redact.Redactor
+	maxEntries int
+	maxAge     time.Duration
+
+	mu       sync.Mutex
+	recorded int
+}
+
+// Exchange is one provider call
+type Exchange struct {
+	ID        string               `json:"id"`
+	SessionID string               `json:"session_id"`
+	MessageID string               `json:"message_id,omitempty"`
+	Provider  string               `json:"provider"`
+	Model     string               `json:"model"`
+	Request   models.ChatRequest   `json:"request"`
+	Response  *models.ChatResponse `json:"response,omitempty"`
+	Error     string               `json:"error,omitempty"`
+	CreatedAt time.Time            `json:"created_at"`
+}
+
+// New creates an Archive from config. It returns nil when archiving is
+// disabled; a nil Archive ignores every call.
+func New(cfg models.ArchiveConfig, queries *db.Queries) (*Archive, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+
+	rules, err := redact.WithPatterns(cfg.RedactPatterns)
+	if err != nil {
+		return nil, err
+	}
+
+	maxEntries := cfg.MaxEntries
+	if maxEntries <= 0 {
+		maxEntries = defaultMaxEntries
+	}
+	maxAgeDays := cfg.MaxAgeDays
+	if maxAgeDays <= 0 {
+		maxAgeDays = defaultMaxAgeDays
+	}
+
+	return &Archive{
+		queries:    queries,
+		redactor:   redact.New(rules...),
+		maxEntries: maxEntries,
+		maxAge:     time.Duration(maxAgeDays) * 24 * time.Hour,
+	}, nil
+}
+
+// Record archives an exchange. Retention limits are enforced every few
+// records rather than on each one.
+func (a *Archive) Record(ctx context.Context, ex Exchange) error {
+	if a == nil {
+		return nil
+	}
+
+	request, size, err := a.encode(ex.Request)
+	if err != nil {
+		return err
+	}
+	var response []byte
+	if ex.Response != nil {
+		var n int
+		response, n, err = a.encode(ex.Response)
+		if err != nil {
+			return err
+		}
+		size += n
+	}
+
+	if ex.ID == "" {
+		ex.ID = uuid.New().String()
+	}
+	if ex.CreatedAt.IsZero() {
+		ex.CreatedAt = time.Now()
+	}
+
+	errText, _ := a.redactor.Redact(ex.Error)
+	err = a.queries.CreateArchiveEntry(ctx, db.CreateArchiveEntryParams{
+		ID:        ex.ID,
+		SessionID: ex.SessionID,
+		MessageID: sql.NullString{String: ex.MessageID, Valid: ex.MessageID != ""},
+		Provider:  ex.Provider,
+		Model:     ex.Model,
+		Request:   request,
+		Response:  response,
+		Error:     sql.NullString{String: errText, Valid: errText != ""},
+		Size:      int64(size),
+		CreatedAt: ex.CreatedAt.Unix(),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to archive exchange: %w", err)
+	}
+
+	a.mu.Lock()
+	a.recorded++
+	prune := a.recorded%pruneEvery == 1
+	a.mu.Unlock()
+
+	if prune {
+		return a.Prune(ctx)
+	}
+	return nil
+}
+
+// Prune deletes exchanges beyond the retention limits
+func (a *Archive) Prune(ctx context.Context) error {
+	if a == nil {
+		return nil
+	}
+	if _, err := a.queries.DeleteArchiveEntriesBefore(ctx, time.Now().Add(-a.maxAge).Unix()); err != nil {
+		return fmt.Errorf("failed to prune archive: %w", err)
+	}
+	if _, err := a.queries.DeleteArchiveEntriesOverLimit(ctx, int64(a.maxEntries)); err != nil {
+		return fmt.Errorf("failed to prune archive: %w", err)
+	}
+	return nil
+}
+
+// ForMessage returns the exchange that produced an assistant message
+func (a *Archive) ForMessage(ctx context.Context, messageID string) (*Exchange, error) {
+	if a == nil {
+		return nil, ErrNotFound
+	}
+
+	row, err := a.queries.GetArchiveEntryByMessage(ctx, sql.NullString{String: messageID, Valid: true})
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load archived exchange: %w", err)
+	}
+
+	ex := &Exchange{
+		ID:        row.ID,
+		SessionID: row.SessionID,
+		MessageID: row.MessageID.String,
+		Provider:  row.Provider,
+		Model:     row.Model,
+		Error:     row.Error.String,
+		CreatedAt: time.Unix(row.CreatedAt, 0),
+	}
+	if err := decode(row.Request, &ex.Request); err != nil {
+		return nil, err
+	}
+	if row.Response != nil {
+		ex.Response = &models.ChatResponse{}
+		if err := decode(row.Response, ex.Response); err != nil {
+			return nil, err
+		}
+	}
+	return ex, nil
+}
+
+// encode returns v as redacted, gzipped JSON and the uncompressed size.
+// Redaction runs on each string value rather than the encoded document so
+// a match can never break the JSON.
+func (a *Archive) encode(v interface{}) ([]byte, int, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to encode exchange: %w", err)
+	}
+	var doc interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, 0, fmt.Errorf("failed to encode exchange: %w", err)
+	}
+	data, err = json.Marshal(a.redactValue(doc))
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to encode exchange: %w", err)
+	}
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(data); err != nil {
+		return nil, 0, fmt.Errorf("failed to compress exchange: %w", err)
+	}
+	if err := zw.Close(); err != nil {
+		return nil, 0, fmt.Errorf("failed to compress exchange: %w", err)
+	}
+	return buf.Bytes(), len(data), nil
+}
+
+func (a *Archive) redactValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case string:
+		redacted, _ := a.redactor.Redact(v)
+		return redacted
+	case []interface{}:
+		for i := range v {
+			v[i] = a.redactValue(v[i])
+		}
+	case map[string]interface{}:
+		for k := range v {
+			v[k] = a.redactValue(v[k])
+		}
+	}
+	return v
+}
+
+func decode(data []byte, v interface{}) error {
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("failed to decompress archived exchange: %w", err)
+	}
+	defer zr.Close()
+
+	raw, err := io.ReadAll(zr)
+	if err != nil {
+		return fmt.Errorf("failed to decompress archived exchange: %w", err)
+	}
+	if err := json.Unmarshal(raw, v); err != nil {
+		return fmt.Errorf("failed to decode archived exchange: %w", err)
+	}
+	return nil
+}
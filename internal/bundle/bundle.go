@@ -0,0 +1,248 @@
+// Package bundle packages an agent setup into a single file that teams can
+// share: the system prompt and instructions, which tools run and what they
+// may do, model preferences, command tools and a prompt library. Provider
+// settings are never included, so bundles can't leak API keys.
+package bundle
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/omnitrix-sh/core.sh/internal/config"
+	"github.com/omnitrix-sh/core.sh/internal/permissions"
+	"github.com/omnitrix-sh/core.sh/internal/tools"
+	"github.com/omnitrix-sh/core.sh/pkg/models"
+)
+
+// Format is the version of the bundle format. It changes when bundles
+// change incompatibly.
+const Format = 1
+
+// Extension is the usual extension of bundle files
+const Extension = ".omnitrix-bundle.json"
+
+// Bundle is an agent profile
+type Bundle struct {
+	Format      int    `json:"format"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+
+	SystemPrompt    string   `json:"system_prompt,omitempty"`
+	PromptFragments []string `json:"prompt_fragments,omitempty"`
+
+	// Tool policy: which tools run, what needs approval, and the contents
+	// of the project's guardrails file, see permissions.RulesFile
+	Tools       models.ToolsConfig       `json:"tools,omitempty"`
+	Permissions models.PermissionsConfig `json:"permissions,omitempty"`
+	Rules       string                   `json:"rules,omitempty"`
+
+	DefaultProvider string                           `json:"default_provider,omitempty"`
+	DefaultModel    string                           `json:"default_model,omitempty"`
+	Aliases         map[string]models.ModelAlias     `json:"aliases,omitempty"`
+	ModelParams     map[string]models.SamplingParams `json:"model_params,omitempty"`
+	Models          map[string]models.ModelProfile   `json:"models,omitempty"`
+
+	Commands map[string]models.CommandToolConfig `json:"commands,omitempty"`
+	Prompts  map[string]string                   `json:"prompts,omitempty"`
+}
+
+// Scope is where a bundle is imported to
+type Scope string
+
+const (
+	// ScopeUser imports into the user config, for every project
+	ScopeUser Scope = "user"
+	// ScopeProject imports into a project's config and rules file
+	ScopeProject Scope = "project"
+)
+
+// Export creates a bundle from the loaded config and the guardrails of the
+// project in cfg.WorkDir
+func Export(cfg *models.Config, name, description string) (*Bundle, error) {
+	if strings.TrimSpace(name) == "" {
+		return nil, errors.New("a bundle needs a name")
+	}
+	b := &Bundle{
+		Format:          Format,
+		Name:            name,
+		Description:     description,
+		SystemPrompt:    cfg.SystemPrompt,
+		PromptFragments: cfg.PromptFragments,
+		Tools:           cfg.Tools,
+		Permissions:     cfg.Permissions,
+		DefaultProvider: cfg.DefaultProvider,
+		DefaultModel:    cfg.DefaultModel,
+		Aliases:         cfg.Aliases,
+		ModelParams:     cfg.ModelParams,
+		Models:          cfg.Models,
+		Commands:        cfg.Commands,
+		Prompts:         cfg.Prompts,
+	}
+	if cfg.WorkDir != "" {
+		data, err := os.ReadFile(filepath.Join(cfg.WorkDir, permissions.RulesFile))
+		if err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("failed to read %s: %w", permissions.RulesFile, err)
+		}
+		b.Rules = string(data)
+	}
+	return b, nil
+}
+
+// Write encodes the bundle
+func (b *Bundle) Write(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(b)
+}
+
+// Read decodes and validates a bundle
+func Read(r io.Reader) (*Bundle, error) {
+	var b Bundle
+	if err := json.NewDecoder(r).Decode(&b); err != nil {
+		return nil, fmt.Errorf("invalid bundle: %w", err)
+	}
+	if err := b.Validate(); err != nil {
+		return nil, err
+	}
+	return &b, nil
+}
+
+// Load reads the bundle file at path
+func Load(path string) (*Bundle, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open bundle: %w", err)
+	}
+	defer f.Close()
+	b, err := Read(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return b, nil
+}
+
+// Validate checks that the bundle can be imported
+func (b *Bundle) Validate() error {
+	switch {
+	case b.Format == 0:
+		return errors.New("invalid bundle: format is missing")
+	case b.Format > Format:
+		return fmt.Errorf("bundle format %d is newer than this version of Omnitrix supports (%d)", b.Format, Format)
+	case strings.TrimSpace(b.Name) == "":
+		return errors.New("invalid bundle: name is missing")
+	}
+	if err := permissions.ValidateConfig(b.Permissions); err != nil {
+		return fmt.Errorf("invalid bundle permissions: %w", err)
+	}
+	if _, err := permissions.ParseRules(b.Rules); err != nil {
+		return fmt.Errorf("invalid bundle rules: %w", err)
+	}
+	for name, command := range b.Commands {
+		if err := tools.ValidateCommandTool(name, command); err != nil {
+			return fmt.Errorf("invalid bundle: %w", err)
+		}
+	}
+	return nil
+}
+
+// Settings returns the bundle's config settings, keyed like the config
+// file's top level. Settings the bundle leaves empty are left out, so
+// importing keeps the current ones.
+func (b *Bundle) Settings() map[string]interface{} {
+	settings := make(map[string]interface{})
+	set := func(key string, value interface{}, empty bool) {
+		if !empty {
+			settings[key] = value
+		}
+	}
+	set("system_prompt", b.SystemPrompt, b.SystemPrompt == "")
+	set("prompt_fragments", b.PromptFragments, len(b.PromptFragments) == 0)
+	set("tools", b.Tools, len(b.Tools.Enabled) == 0 && len(b.Tools.Disabled) == 0)
+	set("permissions", b.Permissions, len(b.Permissions.Risks) == 0 && len(b.Permissions.Tools) == 0 && len(b.Permissions.Paths) == 0)
+	set("default_provider", b.DefaultProvider, b.DefaultProvider == "")
+	set("default_model", b.DefaultModel, b.DefaultModel == "")
+	set("aliases", b.Aliases, len(b.Aliases) == 0)
+	set("model_params", b.ModelParams, len(b.ModelParams) == 0)
+	set("models", b.Models, len(b.Models) == 0)
+	set("commands", b.Commands, len(b.Commands) == 0)
+	set("prompts", b.Prompts, len(b.Prompts) == 0)
+	return settings
+}
+
+// Imported is what an import wrote
+type Imported struct {
+	ConfigPath string `json:"config_path"`
+	// RulesPath is the guardrails file, if the bundle had rules to add
+	RulesPath string `json:"rules_path,omitempty"`
+	// SkippedRules is true when the bundle's guardrails were left out
+	// because they only apply to projects
+	SkippedRules bool `json:"skipped_rules,omitempty"`
+}
+
+// Import writes the bundle's settings into the user config or the config
+// of the project in workDir, replacing the settings it has. Guardrails
+// are added to the project's rules file, keeping the rules already there.
+func Import(b *Bundle, scope Scope, workDir string) (*Imported, error) {
+	if err := b.Validate(); err != nil {
+		return nil, err
+	}
+
+	result := &Imported{}
+	var err error
+	switch scope {
+	case ScopeUser:
+		result.ConfigPath, err = config.SaveUser(b.Settings())
+		result.SkippedRules = strings.TrimSpace(b.Rules) != ""
+	case ScopeProject:
+		result.ConfigPath, err = config.SaveProject(workDir, b.Settings())
+		if err == nil && strings.TrimSpace(b.Rules) != "" {
+			result.RulesPath, err = addRules(workDir, b.Rules)
+		}
+	default:
+		return nil, fmt.Errorf("invalid scope %q, expected user or project", scope)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// addRules appends the lines of rules that the project's rules file
+// doesn't have yet
+func addRules(workDir, rules string) (string, error) {
+	path := filepath.Join(workDir, permissions.RulesFile)
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return "", fmt.Errorf("failed to read %s: %w", permissions.RulesFile, err)
+	}
+
+	existing := make(map[string]bool)
+	for _, line := range strings.Split(string(data), "\n") {
+		existing[strings.TrimSpace(line)] = true
+	}
+	content := string(data)
+	if content != "" && !strings.HasSuffix(content, "\n") {
+		content += "\n"
+	}
+	for _, line := range strings.Split(rules, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || existing[trimmed] {
+			continue
+		}
+		existing[trimmed] = true
+		content += trimmed + "\n"
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return "", fmt.Errorf("failed to create %s: %w", filepath.Dir(path), err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		return "", fmt.Errorf("failed to write %s: %w", permissions.RulesFile, err)
+	}
+	return path, nil
+}
@@ -0,0 +1,322 @@
+// Package checkpoint snapshots the working tree before agent turns so the
+// changes made during a turn can be rolled back
+package checkpoint
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/omnitrix-sh/core.sh/internal/db"
+	"github.com/omnitrix-sh/core.sh/pkg/models"
+)
+
+const defaultKeep = 50
+
+var (
+	// ErrNotFound is returned for checkpoints that don't exist or were pruned
+	ErrNotFound = errors.New("checkpoint not found")
+	// ErrDisabled is returned when restoring without checkpoints configured
+	ErrDisabled = errors.New("checkpoints are disabled")
+)
+
+// Checkpoint is a snapshot of the working tree
+type Checkpoint struct {
+	ID        string    `json:"id"`
+	SessionID string    `json:"session_id"`
+	MessageID string    `json:"message_id,omitempty"` // the user message of the turn that followed
+	Commit    string    `json:"commit"`
+	Label     string    `json:"label"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Change is a file that differs from a checkpoint
+type Change struct {
+	Path   string `json:"path"` // relative to the working directory
+	Status string `json:"status"`
+}
+
+// Store takes and restores checkpoints. The snapshots are commits in a
+// shadow git repository under the data directory, so the project's own
+// repository, index and stashes are never touched and projects that don't
+// use git are covered too.
+type Store struct {
+	queries *db.Queries
+	workDir string
+	gitDir  string
+	keep    int
+
+	// The shadow repository has a single index
+	mu sync.Mutex
+}
+
+// New creates a Store from config. It returns nil when checkpoints are
+// disabled or git is not installed; a nil Store takes no checkpoints.
+func New(cfg models.CheckpointConfig, workDir, dataDir string, queries *db.Queries) (*Store, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+	if _, err := exec.LookPath("git"); err != nil {
+		return nil, nil
+	}
+
+	absWorkDir, err := filepath.Abs(workDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve work directory: %w", err)
+	}
+	// One shadow repository per working directory
+	sum := sha256.Sum256([]byte(absWorkDir))
+	s := &Store{
+		queries: queries,
+		workDir: absWorkDir,
+		gitDir:  filepath.Join(dataDir, "checkpoints", hex.EncodeToString(sum[:8])),
+		keep:    cfg.Keep,
+	}
+	if s.keep <= 0 {
+		s.keep = defaultKeep
+	}
+	return s, nil
+}
+
+// Create snapshots the working tree. Files ignored by the project's
+// .gitignore are left out. When nothing changed since the last checkpoint
+// its commit is reused.
+func (s *Store) Create(ctx context.Context, sessionID, messageID, label string) (*Checkpoint, error) {
+	if s == nil {
+		return nil, nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.create(ctx, sessionID, messageID, label)
+}
+
+func (s *Store) create(ctx context.Context, sessionID, messageID, label string) (*Checkpoint, error) {
+	commit, err := s.snapshot(ctx, label)
+	if err != nil {
+		return nil, err
+	}
+
+	cp := &Checkpoint{
+		ID:        uuid.New().String(),
+		SessionID: sessionID,
+		MessageID: messageID,
+		Commit:    commit,
+		Label:     label,
+		CreatedAt: time.Now(),
+	}
+	err = s.queries.CreateCheckpoint(ctx, db.CreateCheckpointParams{
+		ID:         cp.ID,
+		SessionID:  cp.SessionID,
+		MessageID:  sql.NullString{String: messageID, Valid: messageID != ""},
+		CommitHash: cp.Commit,
+		Label:      cp.Label,
+		CreatedAt:  cp.CreatedAt.Unix(),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to save checkpoint: %w", err)
+	}
+	if _, err := s.queries.DeleteCheckpointsOverLimit(ctx, db.DeleteCheckpointsOverLimitParams{
+		SessionID: sessionID,
+		Keep:      int64(s.keep),
+	}); err != nil {
+		return nil, fmt.Errorf("failed to prune checkpoints: %w", err)
+	}
+	return cp, nil
+}
+
+// List returns a session's checkpoints, newest first
+func (s *Store) List(ctx context.Context, sessionID string) ([]Checkpoint, error) {
+	if s == nil {
+		return nil, nil
+	}
+	rows, err := s.queries.ListCheckpointsBySession(ctx, sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list checkpoints: %w", err)
+	}
+	result := make([]Checkpoint, len(rows))
+	for i, row := range rows {
+		result[i] = fromRow(row)
+	}
+	return result, nil
+}
+
+// Get returns a checkpoint by ID
+func (s *Store) Get(ctx context.Context, id string) (*Checkpoint, error) {
+	if s == nil {
+		return nil, ErrDisabled
+	}
+	row, err := s.queries.GetCheckpoint(ctx, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load checkpoint: %w", err)
+	}
+	cp := fromRow(row)
+	return &cp, nil
+}
+
+// Changes lists the files that differ between a checkpoint and the working
+// tree now
+func (s *Store) Changes(ctx context.Context, id string) ([]Change, error) {
+	cp, err := s.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := s.git(ctx, "add", "-A"); err != nil {
+		return nil, err
+	}
+	out, err := s.git(ctx, "diff-index", "--cached", "--name-status", "-z", "--no-renames", cp.Commit)
+	if err != nil {
+		return nil, err
+	}
+	fields := strings.Split(strings.TrimSuffix(out, "\x00"), "\x00")
+	var changes []Change
+	for i := 0; i+1 < len(fields); i += 2 {
+		changes = append(changes, Change{Path: fields[i+1], Status: changeStatus(fields[i])})
+	}
+	return changes, nil
+}
+
+// Restore puts the working tree back the way it was at a checkpoint: files
+// are restored, and files created since are removed. Ignored files are
+// left alone. The current state is checkpointed first and returned, so the
+// restore can itself be undone.
+func (s *Store) Restore(ctx context.Context, id string) (*Checkpoint, error) {
+	cp, err := s.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, err := s.create(ctx, cp.SessionID, "", fmt.Sprintf("before restoring %q", cp.Label))
+	if err != nil {
+		return nil, err
+	}
+
+	added, err := s.git(ctx, "diff-tree", "-r", "--name-only", "-z", "--no-renames", "--diff-filter=A", cp.Commit, current.Commit)
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range strings.Split(added, "\x00") {
+		if path == "" {
+			continue
+		}
+		if err := os.Remove(filepath.Join(s.workDir, filepath.FromSlash(path))); err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("failed to remove %s: %w", path, err)
+		}
+	}
+
+	if _, err := s.git(ctx, "read-tree", cp.Commit); err != nil {
+		return nil, err
+	}
+	if _, err := s.git(ctx, "checkout-index", "-a", "-f"); err != nil {
+		return nil, err
+	}
+	return current, nil
+}
+
+// snapshot commits the working tree to the shadow repository
+func (s *Store) snapshot(ctx context.Context, label string) (string, error) {
+	if err := s.init(ctx); err != nil {
+		return "", err
+	}
+	if _, err := s.git(ctx, "add", "-A"); err != nil {
+		return "", err
+	}
+	tree, err := s.git(ctx, "write-tree")
+	if err != nil {
+		return "", err
+	}
+	tree = strings.TrimSpace(tree)
+
+	args := []string{"commit-tree", tree, "-m", label}
+	if parent, err := s.git(ctx, "rev-parse", "-q", "--verify", "HEAD"); err == nil {
+		parent = strings.TrimSpace(parent)
+		if parentTree, err := s.git(ctx, "rev-parse", parent+"^{tree}"); err == nil && strings.TrimSpace(parentTree) == tree {
+			return parent, nil
+		}
+		args = append(args, "-p", parent)
+	}
+	commit, err := s.git(ctx, args...)
+	if err != nil {
+		return "", err
+	}
+	commit = strings.TrimSpace(commit)
+	if _, err := s.git(ctx, "update-ref", "HEAD", commit); err != nil {
+		return "", err
+	}
+	return commit, nil
+}
+
+// init creates the shadow repository on first use
+func (s *Store) init(ctx context.Context) error {
+	if _, err := os.Stat(filepath.Join(s.gitDir, "HEAD")); err == nil {
+		return nil
+	}
+	if err := os.MkdirAll(s.gitDir, 0o700); err != nil {
+		return fmt.Errorf("failed to create checkpoint repository: %w", err)
+	}
+	if _, err := s.git(ctx, "init", "--quiet"); err != nil {
+		return err
+	}
+	return nil
+}
+
+// git runs a git command against the shadow repository and the working tree
+func (s *Store) git(ctx context.Context, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", append([]string{"-c", "core.autocrlf=false", "-c", "core.quotepath=false"}, args...)...)
+	cmd.Dir = s.workDir
+	cmd.Env = append(os.Environ(),
+		"GIT_DIR="+s.gitDir,
+		"GIT_WORK_TREE="+s.workDir,
+		"GIT_INDEX_FILE="+filepath.Join(s.gitDir, "index"),
+		"GIT_AUTHOR_NAME=omnitrix",
+		"GIT_AUTHOR_EMAIL=checkpoints@omnitrix.local",
+		"GIT_COMMITTER_NAME=omnitrix",
+		"GIT_COMMITTER_EMAIL=checkpoints@omnitrix.local",
+	)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("checkpoint git %s failed: %w: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.String(), nil
+}
+
+func fromRow(row db.Checkpoint) Checkpoint {
+	return Checkpoint{
+		ID:        row.ID,
+		SessionID: row.SessionID,
+		MessageID: row.MessageID.String,
+		Commit:    row.CommitHash,
+		Label:     row.Label,
+		CreatedAt: time.Unix(row.CreatedAt, 0),
+	}
+}
+
+func changeStatus(code string) string {
+	switch code {
+	case "A":
+		return "added"
+	case "D":
+		return "deleted"
+	}
+	return "modified"
+}
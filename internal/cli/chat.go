@@ -0,0 +1,91 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/omnitrix-sh/core.sh/internal/onboard"
+	"github.com/omnitrix-sh/core.sh/internal/tui"
+	"github.com/spf13/cobra"
+)
+
+type chatOptions struct {
+	session string
+	stream  bool
+}
+
+func newChatCommand(flags *globalFlags) *cobra.Command {
+	opts := &chatOptions{}
+	cmd := &cobra.Command{
+		Use:   "chat",
+		Short: "Chat in the terminal UI",
+		Long: `Chat in the terminal UI. It opens the most recent session, or the one
+given with --session.
+
+On first run it sets Omnitrix up: it looks for the providers you can use,
+tests the one you choose and saves it to your config.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runChat(cmd, flags, opts)
+		},
+	}
+	cmd.Flags().StringVarP(&opts.session, "session", "s", "", "session to open (default: the most recent)")
+	cmd.Flags().BoolVar(&opts.stream, "stream", false, "show replies as they are written; tools only run without it")
+	return cmd
+}
+
+func runChat(cmd *cobra.Command, flags *globalFlags, opts *chatOptions) error {
+	ctx := cmd.Context()
+	if !isTerminal(os.Stdin) || !isTerminal(os.Stdout) {
+		return errors.New("the chat needs a terminal; use omnitrix run -p for scripts")
+	}
+
+	sessionID := opts.session
+	if onboard.Needed() && flags.provider == "" && flags.model == "" {
+		welcome, err := runOnboarding(cmd, flags)
+		if err != nil {
+			return err
+		}
+		if sessionID == "" {
+			sessionID = welcome
+		}
+	}
+
+	// Opened after onboarding, which saves a new config
+	b, err := open(flags)
+	if err != nil {
+		return err
+	}
+	defer b.Close()
+
+	if err := b.start(ctx, flags); err != nil {
+		return err
+	}
+	// Without the watcher config changes wait for the next start, which is
+	// no reason to refuse the chat
+	_ = b.watch(ctx)
+	app := tui.New(b.agent, b.bus, tui.Options{Stream: opts.stream})
+	b.approve(app.Approver())
+	if err := app.Run(ctx, sessionID); err != nil {
+		return fmt.Errorf("chat: %w", err)
+	}
+	return nil
+}
+
+// runOnboarding sets Omnitrix up on the terminal and returns the ID of the
+// welcome session
+func runOnboarding(cmd *cobra.Command, flags *globalFlags) (string, error) {
+	b, err := open(flags)
+	if err != nil {
+		return "", err
+	}
+	defer b.Close()
+
+	ctx := cmd.Context()
+	result, err := onboard.Run(ctx, newLinePrompter(ctx, os.Stdin, cmd.OutOrStdout()), b.queries)
+	if err != nil {
+		return "", err
+	}
+	return result.Session.ID, nil
+}
@@ -0,0 +1,239 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/omnitrix-sh/core.sh/internal/agent"
+	"github.com/omnitrix-sh/core.sh/internal/events"
+	"github.com/omnitrix-sh/core.sh/internal/permissions"
+	"github.com/omnitrix-sh/core.sh/pkg/models"
+	"github.com/spf13/cobra"
+)
+
+// ciBuffer is how many events a CI run can fall behind by before the
+// report misses some
+const ciBuffer = 1024
+
+const (
+	ciSuccess = "success"
+	ciFailure = "failure"
+)
+
+type ciOptions struct {
+	prompt        string
+	task          string
+	allow         []string
+	maxIterations int
+	maxCost       float64
+	timeout       time.Duration
+	report        string
+	mode          string
+}
+
+// ciReport is the machine-readable outcome of omnitrix ci
+type ciReport struct {
+	Status     string              `json:"status"`
+	Error      string              `json:"error,omitempty"`
+	SessionID  string              `json:"session_id,omitempty"`
+	Provider   models.ProviderType `json:"provider"`
+	Model      string              `json:"model"`
+	Response   string              `json:"response"`
+	StartedAt  time.Time           `json:"started_at"`
+	DurationMS int64               `json:"duration_ms"`
+	// Iterations counts the model's replies, one per provider call
+	Iterations       int          `json:"iterations"`
+	ToolCalls        []ciToolCall `json:"tool_calls"`
+	PromptTokens     int64        `json:"prompt_tokens"`
+	CompletionTokens int64        `json:"completion_tokens"`
+	Cost             float64      `json:"cost"` // USD
+}
+
+// ciToolCall is a tool run of a CI run. Declined runs have an Error.
+type ciToolCall struct {
+	Name       string `json:"name"`
+	Error      string `json:"error,omitempty"`
+	DurationMS int64  `json:"duration_ms"`
+}
+
+func newCICommand(flags *globalFlags) *cobra.Command {
+	opts := &ciOptions{}
+	cmd := &cobra.Command{
+		Use:   "ci",
+		Short: "Run a task without a user, for CI jobs",
+		Long: `Run a task without a user, for CI jobs such as GitHub Actions. The task
+is read from --task, -p or standard input.
+
+Tools that need approval run only when they are allowed with --allow or
+ci.allow in the config; everything else is declined. Runs stop after
+--max-iterations provider calls or once they cost --max-cost. A JSON
+report is written to --report, or to standard output without it, and
+omnitrix exits with status 1 when the run failed.`,
+		Example: `  omnitrix ci --task .github/omnitrix/review.md --allow edit_file,apply_patch --report report.json
+  omnitrix ci -p "fix the failing test in ./internal/db" --allow edit_file --max-cost 0.50`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runCI(cmd, flags, opts)
+		},
+	}
+	cmd.Flags().StringVarP(&opts.prompt, "prompt", "p", "", "the task")
+	cmd.Flags().StringVarP(&opts.task, "task", "f", "", "file to read the task from")
+	cmd.Flags().StringSliceVar(&opts.allow, "allow", nil, "tools approved without asking, added to ci.allow")
+	cmd.Flags().IntVar(&opts.maxIterations, "max-iterations", 0, "provider calls the run may make (default: ci.max_iterations, else 10)")
+	cmd.Flags().Float64Var(&opts.maxCost, "max-cost", 0, "USD the run may spend (default: ci.max_cost, else no limit)")
+	cmd.Flags().DurationVar(&opts.timeout, "timeout", 0, "time the run may take (default: ci.timeout, else no limit)")
+	cmd.Flags().StringVar(&opts.report, "report", "", "file to write the JSON report to; the reply then goes to standard output")
+	cmd.Flags().StringVar(&opts.mode, "mode", "", "plan (read-only) or build (default: the mode in the config)")
+	return cmd
+}
+
+func runCI(cmd *cobra.Command, flags *globalFlags, opts *ciOptions) error {
+	ctx := cmd.Context()
+	if opts.task != "" && opts.prompt != "" {
+		return errors.New("pass the task with either --task or -p, not both")
+	}
+	if _, err := agent.ParseMode(opts.mode); err != nil {
+		return err
+	}
+	task := opts.prompt
+	if opts.task != "" {
+		data, err := os.ReadFile(opts.task)
+		if err != nil {
+			return fmt.Errorf("failed to read the task: %w", err)
+		}
+		task = string(data)
+	}
+	task, err := readPrompt(task, cmd.InOrStdin())
+	if err != nil {
+		return err
+	}
+
+	b, err := open(flags)
+	if err != nil {
+		return err
+	}
+	defer b.Close()
+	cfg := b.config().CI
+
+	timeout := opts.timeout
+	if timeout == 0 && cfg.Timeout != "" {
+		if timeout, err = time.ParseDuration(cfg.Timeout); err != nil {
+			return fmt.Errorf("invalid ci.timeout %q: %w", cfg.Timeout, err)
+		}
+	}
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	report := &ciReport{StartedAt: time.Now(), ToolCalls: []ciToolCall{}}
+	runErr := b.startCI(ctx, flags, opts)
+	if runErr == nil {
+		report.Provider, report.Model = b.provider, b.model
+		runErr = b.runCITask(ctx, task, opts.mode, report)
+	}
+	report.DurationMS = time.Since(report.StartedAt).Milliseconds()
+	report.Status = ciSuccess
+	if runErr != nil {
+		report.Status = ciFailure
+		report.Error = runErr.Error()
+	}
+	if err := writeCIReport(cmd, opts.report, report); err != nil {
+		return err
+	}
+	return runErr
+}
+
+// startCI starts the agent with the limits and allowlist of the CI config
+// and opts
+func (b *backend) startCI(ctx context.Context, flags *globalFlags, opts *ciOptions) error {
+	if err := b.start(ctx, flags); err != nil {
+		return err
+	}
+	cfg := b.config().CI
+	limits := cfg.RunLimits
+	if opts.maxIterations > 0 {
+		limits.MaxIterations = opts.maxIterations
+	}
+	if opts.maxCost > 0 {
+		limits.MaxCost = opts.maxCost
+	}
+	b.agent.SetRunLimits(limits)
+	allowed := make(map[string]bool)
+	for _, name := range append(cfg.Allow, opts.allow...) {
+		allowed[name] = true
+	}
+	b.approve(permissions.ApproverFunc(func(_ context.Context, req permissions.Request) (bool, error) {
+		return allowed[req.Tool], nil
+	}))
+	return nil
+}
+
+// runCITask runs task in a new session in mode, filling in report as it
+// goes
+func (b *backend) runCITask(ctx context.Context, task, mode string, report *ciReport) error {
+	session, err := b.runSession(ctx, "", task)
+	if err != nil {
+		return err
+	}
+	report.SessionID = session.ID
+	if err := b.switchMode(ctx, session.ID, mode); err != nil {
+		return err
+	}
+
+	ch, unsubscribe := b.bus.Subscribe(session.ID, ciBuffer, events.TypeMessage, events.TypeToolFinished)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for event := range ch {
+			switch {
+			case event.Message != nil && event.Message.Role == models.RoleAssistant:
+				report.Iterations++
+			case event.Tool != nil:
+				report.ToolCalls = append(report.ToolCalls, ciToolCall{
+					Name:       event.Tool.Name,
+					Error:      event.Tool.Error,
+					DurationMS: event.Tool.DurationMS,
+				})
+			}
+		}
+	}()
+	report.Response, err = b.agent.Chat(ctx, session.ID, task)
+	unsubscribe()
+	<-done
+
+	// Usage is recorded even for failed runs; a fresh context reads it
+	// after a timeout
+	if cost, costErr := b.agent.SessionCost(context.Background(), session.ID); costErr == nil {
+		report.PromptTokens = cost.PromptTokens
+		report.CompletionTokens = cost.CompletionTokens
+		report.Cost = cost.Cost
+	}
+	return err
+}
+
+// writeCIReport writes report to path, or to standard output if path is
+// empty, in which case the reply is left out of standard output
+func writeCIReport(cmd *cobra.Command, path string, report *ciReport) error {
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode the report: %w", err)
+	}
+	data = append(data, '\n')
+	if path == "" {
+		_, err := cmd.OutOrStdout().Write(data)
+		return err
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write the report: %w", err)
+	}
+	if report.Response != "" {
+		fmt.Fprintln(cmd.OutOrStdout(), report.Response)
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+// Package cli is the omnitrix command: an interactive chat, one-shot runs
+// for scripts, and commands to look after sessions, models and tools.
+package cli
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/omnitrix-sh/core.sh/internal/version"
+	"github.com/spf13/cobra"
+)
+
+// Execute runs the command line, stopping commands on an interrupt
+func Execute() error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	return newRootCommand().ExecuteContext(ctx)
+}
+
+func newRootCommand() *cobra.Command {
+	flags := &globalFlags{}
+	root := &cobra.Command{
+		Use:   "omnitrix [prompt]",
+		Short: "A coding assistant running on the models of your choice",
+		Long: `Omnitrix reads, writes and explains the code of your project with local
+or cloud models.
+
+Without arguments it opens the chat. With a prompt it answers it once, like
+"omnitrix run -p".`,
+		Version:      version.Get().String(),
+		Args:         cobra.ArbitraryArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) > 0 {
+				return runOnce(cmd, flags, &runOptions{prompt: strings.Join(args, " "), output: outputText})
+			}
+			return runChat(cmd, flags, &chatOptions{})
+		},
+	}
+	root.SetVersionTemplate("{{.Version}}\n")
+
+	root.PersistentFlags().StringVarP(&flags.dir, "dir", "C", "", "project directory (default: the current directory)")
+	root.PersistentFlags().StringVar(&flags.provider, "provider", "", "provider to use, e.g. ollama or openai (default: from the config)")
+	root.PersistentFlags().StringVarP(&flags.model, "model", "m", "", "model to use (default: from the config)")
+
+	root.AddCommand(
+		newChatCommand(flags),
+		newRunCommand(flags),
+		newSessionsCommand(flags),
+		newMemoryCommand(flags),
+		newModelsCommand(flags),
+		newToolsCommand(flags),
+		newCICommand(flags),
+		newExperimentCommand(flags),
+		newServeCommand(flags),
+		newRPCCommand(flags),
+		newUpdateCommand(flags),
+	)
+	return root
+}
@@ -0,0 +1,133 @@
+package cli
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/omnitrix-sh/core.sh/internal/experiment"
+	"github.com/spf13/cobra"
+)
+
+func newExperimentCommand(flags *globalFlags) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "experiment",
+		Short: "Compare the prompt or parameter variants of the configured experiment",
+		Long: `Compare the two variants under experiment in the config by sending recorded
+turns again under both. Sessions are not changed; the metrics of every run
+are appended to experiments/<name>.jsonl in the data directory.`,
+	}
+	cmd.AddCommand(
+		newExperimentRunCommand(flags),
+		newExperimentReportCommand(flags),
+	)
+	return cmd
+}
+
+func newExperimentRunCommand(flags *globalFlags) *cobra.Command {
+	return &cobra.Command{
+		Use:   "run <session-id>...",
+		Short: "Replay the turns of sessions under both variants",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			b, err := open(flags)
+			if err != nil {
+				return err
+			}
+			defer b.Close()
+			if err := b.start(cmd.Context(), flags); err != nil {
+				return err
+			}
+			e, err := b.experiment()
+			if err != nil {
+				return err
+			}
+
+			out := cmd.OutOrStdout()
+			for _, id := range args {
+				if _, err := b.agent.Session(cmd.Context(), id); err != nil {
+					return err
+				}
+				results, err := e.CompareSession(cmd.Context(), id)
+				fmt.Fprintf(out, "Session %s: %d turns compared\n", id, len(results)/2)
+				if err != nil {
+					return err
+				}
+			}
+			report, err := loadReport(e.Path(), b.config().Experiment.Name)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintln(out)
+			fmt.Fprint(out, report)
+			return nil
+		},
+	}
+}
+
+func newExperimentReportCommand(flags *globalFlags) *cobra.Command {
+	var asJSON bool
+	cmd := &cobra.Command{
+		Use:   "report",
+		Short: "Summarize the results of the experiment so far",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			b, err := open(flags)
+			if err != nil {
+				return err
+			}
+			defer b.Close()
+			e, err := experiment.New(b.sessions(), b.config().Experiment, b.config().DataDir)
+			if err != nil {
+				return err
+			}
+			if e == nil {
+				return errNoExperiment
+			}
+
+			report, err := loadReport(e.Path(), b.config().Experiment.Name)
+			if err != nil {
+				return err
+			}
+			out := cmd.OutOrStdout()
+			if asJSON {
+				enc := json.NewEncoder(out)
+				enc.SetIndent("", "  ")
+				return enc.Encode(report)
+			}
+			if report.Turns == 0 {
+				fmt.Fprintf(out, "No results for experiment %s yet.\n", report.Experiment)
+				return nil
+			}
+			fmt.Fprint(out, report)
+			return nil
+		},
+	}
+	cmd.Flags().BoolVar(&asJSON, "json", false, "print JSON")
+	return cmd
+}
+
+var errNoExperiment = errors.New("no experiment is configured: set experiment.name and the variants a and b in the config")
+
+// experiment returns the started agent's experiment
+func (b *backend) experiment() (*experiment.Experiment, error) {
+	e, err := experiment.New(b.agent, b.config().Experiment, b.config().DataDir)
+	if err != nil {
+		return nil, err
+	}
+	if e == nil {
+		return nil, errNoExperiment
+	}
+	return e, nil
+}
+
+// loadReport summarizes the results of experiment name in path
+func loadReport(path, name string) (*experiment.Report, error) {
+	results, err := experiment.Load(path)
+	if err != nil {
+		return nil, err
+	}
+	report := experiment.Summarize(results)
+	report.Experiment = name
+	return report, nil
+}
@@ -0,0 +1,87 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/omnitrix-sh/core.sh/internal/display"
+	"github.com/spf13/cobra"
+)
+
+func newMemoryCommand(flags *globalFlags) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "memory",
+		Aliases: []string{"memories"},
+		Short:   "List and delete what the agent remembers across sessions",
+	}
+	cmd.AddCommand(
+		newMemoryListCommand(flags),
+		newMemoryDeleteCommand(flags),
+	)
+	return cmd
+}
+
+func newMemoryListCommand(flags *globalFlags) *cobra.Command {
+	var asJSON bool
+	cmd := &cobra.Command{
+		Use:     "list",
+		Aliases: []string{"ls"},
+		Short:   "List memories, newest first",
+		Args:    cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			b, err := open(flags)
+			if err != nil {
+				return err
+			}
+			defer b.Close()
+
+			memories, err := b.sessions().Memories(cmd.Context())
+			if err != nil {
+				return err
+			}
+			out := cmd.OutOrStdout()
+			if asJSON {
+				enc := json.NewEncoder(out)
+				enc.SetIndent("", "  ")
+				return enc.Encode(memories)
+			}
+			if len(memories) == 0 {
+				fmt.Fprintln(out, "No memories yet.")
+				return nil
+			}
+			rows := make([][]string, len(memories))
+			for i, m := range memories {
+				rows[i] = []string{m.ID, m.Content, display.Time(m.CreatedAt)}
+			}
+			fmt.Fprint(out, display.Table([]string{"ID", "Memory", "Saved"}, rows))
+			return nil
+		},
+	}
+	cmd.Flags().BoolVar(&asJSON, "json", false, "print JSON")
+	return cmd
+}
+
+func newMemoryDeleteCommand(flags *globalFlags) *cobra.Command {
+	return &cobra.Command{
+		Use:     "delete <id>...",
+		Aliases: []string{"rm"},
+		Short:   "Delete memories, so they are no longer recalled",
+		Args:    cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			b, err := open(flags)
+			if err != nil {
+				return err
+			}
+			defer b.Close()
+
+			a := b.sessions()
+			for _, id := range args {
+				if err := a.DeleteMemory(cmd.Context(), id); err != nil {
+					return err
+				}
+				fmt.Fprintf(cmd.OutOrStdout(), "Deleted memory %s\n", id)
+			}
+			return nil
+		},
+	}
+}
@@ -0,0 +1,142 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/omnitrix-sh/core.sh/internal/display"
+	"github.com/omnitrix-sh/core.sh/internal/plugin"
+	"github.com/omnitrix-sh/core.sh/internal/providers/ollama"
+	"github.com/omnitrix-sh/core.sh/internal/providers/openai"
+	"github.com/omnitrix-sh/core.sh/pkg/models"
+	"github.com/spf13/cobra"
+)
+
+// listModelsTimeout bounds asking one provider for its models
+const listModelsTimeout = 10 * time.Second
+
+// providerModels are the models of one provider
+type providerModels struct {
+	Provider models.ProviderType `json:"provider"`
+	Models   []string            `json:"models"`
+	Error    string              `json:"error,omitempty"`
+}
+
+func newModelsCommand(flags *globalFlags) *cobra.Command {
+	var asJSON bool
+	cmd := &cobra.Command{
+		Use:   "models",
+		Short: "List the models of the enabled providers",
+		Long: `List the models of the enabled providers, as the providers report them.
+The model used by default is marked with *, and aliases from the config are
+shown next to the models they stand for.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := loadConfig(flags)
+			if err != nil {
+				return err
+			}
+
+			plugins, err := plugin.Load(cmd.Context(), cfg.Plugins.Dir, cfg.Plugins.Disabled)
+			if err != nil {
+				return err
+			}
+			defer plugins.Close()
+
+			var names []string
+			for provider, pc := range cfg.Providers {
+				if pc.Enabled && (flags.provider == "" || string(provider) == flags.provider) {
+					names = append(names, string(provider))
+				}
+			}
+			// Providers plugins serve need no config
+			for _, name := range plugins.Providers() {
+				_, configured := cfg.Providers[models.ProviderType(name)]
+				if !configured && (flags.provider == "" || name == flags.provider) {
+					names = append(names, name)
+				}
+			}
+			sort.Strings(names)
+			switch {
+			case len(names) == 0 && flags.provider != "":
+				return fmt.Errorf("provider %s is not enabled", flags.provider)
+			case len(names) == 0:
+				return errors.New("no provider is enabled")
+			}
+			var list []providerModels
+			for _, name := range names {
+				provider := models.ProviderType(name)
+				found, err := listModels(cmd.Context(), provider, cfg.Providers[provider], plugins)
+				entry := providerModels{Provider: provider, Models: found}
+				if err != nil {
+					entry.Error = err.Error()
+				}
+				list = append(list, entry)
+			}
+
+			out := cmd.OutOrStdout()
+			if asJSON {
+				enc := json.NewEncoder(out)
+				enc.SetIndent("", "  ")
+				return enc.Encode(list)
+			}
+			// The default is what chat and run would use
+			defaultProvider, defaultModel, _, _ := chooseModel(cfg, flags, plugins)
+			var rows [][]string
+			for _, entry := range list {
+				if entry.Error != "" {
+					rows = append(rows, []string{"", string(entry.Provider), "unavailable: " + entry.Error, ""})
+					continue
+				}
+				for _, model := range entry.Models {
+					mark := ""
+					if entry.Provider == defaultProvider && model == defaultModel {
+						mark = "*"
+					}
+					rows = append(rows, []string{mark, string(entry.Provider), model, aliasesOf(cfg, entry.Provider, model)})
+				}
+			}
+			fmt.Fprint(out, display.Table([]string{"", "Provider", "Model", "Aliases"}, rows))
+			return nil
+		},
+	}
+	cmd.Flags().BoolVar(&asJSON, "json", false, "print JSON")
+	return cmd
+}
+
+// aliasesOf returns the aliases for a model of provider, comma separated
+func aliasesOf(cfg *models.Config, provider models.ProviderType, model string) string {
+	var names []string
+	for name, alias := range cfg.Aliases {
+		if alias.Model == model && (alias.Provider == "" || alias.Provider == provider) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// listModels asks a provider for its models. Providers that can't be
+// asked offer the models listed in the config.
+func listModels(ctx context.Context, provider models.ProviderType, pc models.ProviderConfig, plugins *plugin.Set) ([]string, error) {
+	ctx, cancel := context.WithTimeout(ctx, listModelsTimeout)
+	defer cancel()
+	if served := plugins.Provider(provider); served != nil {
+		return served.ListModels(ctx)
+	}
+	switch provider {
+	case models.ProviderOllama:
+		return ollama.NewProvider(pc.BaseURL, "").ListModels(ctx)
+	case models.ProviderOpenAI:
+		if pc.APIKey == "" {
+			return nil, fmt.Errorf("no API key")
+		}
+		return openai.NewProvider(pc.APIKey, "").ListModels(ctx)
+	}
+	return pc.Models, nil
+}
@@ -0,0 +1,111 @@
+package cli
+
+import (
+	"context"
+
+	"github.com/omnitrix-sh/core.sh/internal/config"
+	"github.com/omnitrix-sh/core.sh/internal/events"
+	"github.com/omnitrix-sh/core.sh/internal/format"
+	"github.com/omnitrix-sh/core.sh/internal/permissions"
+	"github.com/omnitrix-sh/core.sh/internal/promptlog"
+	"github.com/omnitrix-sh/core.sh/internal/tools"
+	"github.com/omnitrix-sh/core.sh/pkg/models"
+)
+
+// reloadable are the settings a changed config file applies to the running
+// agent. Others need a restart.
+var reloadable = map[string]bool{
+	"aliases":     true,
+	"commands":    true,
+	"databases":   true,
+	"formatters":  true,
+	"permissions": true,
+	"prompt_log":  true,
+	"tools":       true,
+}
+
+// watch reloads the config whenever its files change until ctx is done,
+// applying what it can to the started agent and publishing a
+// TypeConfigChanged event for each change
+func (b *backend) watch(ctx context.Context) error {
+	loader, err := config.NewLoader(b.config().WorkDir, nil)
+	if err != nil {
+		return err
+	}
+	return loader.Watch(ctx, func(cfg *models.Config, err error) {
+		if change := b.reload(ctx, cfg, err); change != nil {
+			b.bus.Publish(events.Event{Type: events.TypeConfigChanged, Config: change})
+		}
+	})
+}
+
+// reload applies the settings of cfg that are safe to change while
+// sessions run: which tools are offered, the permission policy, model
+// aliases, the prompt log and the formatters. Nothing is applied unless all of them are
+// valid. It returns nil if nothing changed.
+func (b *backend) reload(ctx context.Context, cfg *models.Config, err error) *events.ConfigChange {
+	if err != nil {
+		return &events.ConfigChange{Error: err.Error()}
+	}
+	// Everything else keeps the settings the agent started with
+	current := *b.config()
+	change := &events.ConfigChange{}
+	for _, key := range config.Changed(&current, cfg) {
+		if reloadable[key] {
+			change.Applied = append(change.Applied, key)
+		} else {
+			change.Restart = append(change.Restart, key)
+		}
+	}
+	if len(change.Applied) == 0 && len(change.Restart) == 0 {
+		return nil
+	}
+
+	toolset, report, err := tools.BuildReport(ctx, tools.Options{
+		WorkDir:   current.WorkDir,
+		DataDir:   current.DataDir,
+		Exec:      current.Exec,
+		LSP:       b.lsp,
+		Commands:  cfg.Commands,
+		Roots:     cfg.Tools.Roots,
+		Ignore:    cfg.Tools.Ignore,
+		Databases: cfg.Databases,
+		External:  b.plugins.ToolNames(),
+	}, cfg.Tools.Enabled, cfg.Tools.Disabled)
+	toolset = b.plugins.Tools(toolset, cfg.Tools.Disabled)
+	if err == nil {
+		err = permissions.ValidateConfig(cfg.Permissions)
+	}
+	var logger *promptlog.Logger
+	if err == nil {
+		logger, err = promptlog.New(cfg.PromptLog, current.DataDir)
+	}
+	var formatters *format.Runner
+	if err == nil {
+		formatters, err = format.New(cfg.Formatters, current.WorkDir, tools.NewExecTool(current.WorkDir, current.Exec))
+	}
+	if err == nil {
+		err = b.checker.Update(cfg.Permissions)
+	}
+	if err != nil {
+		return &events.ConfigChange{Error: err.Error()}
+	}
+
+	b.agent.SetTools(toolset)
+	b.agent.SetModelAliases(cfg.Aliases)
+	b.agent.SetPromptLogger(logger)
+	b.agent.SetFormatters(formatters)
+
+	current.Aliases = cfg.Aliases
+	current.Commands = cfg.Commands
+	current.Databases = cfg.Databases
+	current.Formatters = cfg.Formatters
+	current.Permissions = cfg.Permissions
+	current.PromptLog = cfg.PromptLog
+	current.Tools = cfg.Tools
+	b.mu.Lock()
+	b.cfg = &current
+	b.report = report
+	b.mu.Unlock()
+	return change
+}
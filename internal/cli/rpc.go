@@ -0,0 +1,43 @@
+package cli
+
+import (
+	"os"
+
+	"github.com/omnitrix-sh/core.sh/internal/rpc"
+	"github.com/omnitrix-sh/core.sh/internal/version"
+	"github.com/spf13/cobra"
+)
+
+func newRPCCommand(flags *globalFlags) *cobra.Command {
+	return &cobra.Command{
+		Use:   "rpc",
+		Short: "Serve the agent as JSON-RPC over stdin and stdout",
+		Long: `Serve the agent as JSON-RPC 2.0 over stdin and stdout, one message per
+line, for editor plugins that run Omnitrix as a child process. It stops
+when stdin ends. Permission requests and questions wait for the client to
+answer them.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			b, err := open(flags)
+			if err != nil {
+				return err
+			}
+			defer b.Close()
+			if err := b.start(ctx, flags); err != nil {
+				return err
+			}
+			// Without the watcher config changes wait for the next start
+			_ = b.watch(ctx)
+
+			server := rpc.New(b.agent, b.bus, serverName())
+			b.approve(server.Approver())
+			return server.Serve(ctx, os.Stdin, cmd.OutOrStdout())
+		},
+	}
+}
+
+// serverName is the name and version servers send in the handshake
+func serverName() string {
+	return "omnitrix " + version.Get().Version
+}
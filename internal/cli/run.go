@@ -0,0 +1,195 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/omnitrix-sh/core.sh/internal/agent"
+	"github.com/omnitrix-sh/core.sh/internal/permissions"
+	"github.com/omnitrix-sh/core.sh/pkg/models"
+	"github.com/spf13/cobra"
+)
+
+const (
+	outputText = "text"
+	outputJSON = "json"
+	// maxTitleLength is how much of the prompt names a new session
+	maxTitleLength = 60
+)
+
+type runOptions struct {
+	prompt  string
+	output  string
+	session string
+	stream  bool
+	yes     bool
+	mode    string
+}
+
+// runResult is the output of run with --output json
+type runResult struct {
+	SessionID string          `json:"session_id"`
+	Response  string          `json:"response"`
+	Session   *models.Session `json:"session"`
+}
+
+func newRunCommand(flags *globalFlags) *cobra.Command {
+	opts := &runOptions{}
+	cmd := &cobra.Command{
+		Use:   "run",
+		Short: "Answer one prompt and exit",
+		Long: `Answer one prompt and exit, for scripts and editors. The prompt is read
+from standard input when -p is not given.
+
+Tools that need approval are asked about on the terminal; without one they
+are declined unless --yes is given. Project guardrails always apply.`,
+		Example: `  omnitrix run -p "summarize the changes in git diff HEAD~1"
+  omnitrix run < task.md
+  omnitrix run -p "list the TODOs" --output json`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runOnce(cmd, flags, opts)
+		},
+	}
+	cmd.Flags().StringVarP(&opts.prompt, "prompt", "p", "", "the prompt")
+	cmd.Flags().StringVarP(&opts.output, "output", "o", outputText, "output format: text or json")
+	cmd.Flags().StringVarP(&opts.session, "session", "s", "", "session to continue (default: a new one)")
+	cmd.Flags().BoolVar(&opts.stream, "stream", false, "print the reply as it is written; tools don't run")
+	cmd.Flags().BoolVarP(&opts.yes, "yes", "y", false, "approve every tool run the permissions ask about")
+	cmd.Flags().StringVar(&opts.mode, "mode", "", "switch the session to plan (read-only) or build mode")
+	return cmd
+}
+
+func runOnce(cmd *cobra.Command, flags *globalFlags, opts *runOptions) error {
+	ctx := cmd.Context()
+	if opts.output != outputText && opts.output != outputJSON {
+		return fmt.Errorf("invalid output format %q, expected text or json", opts.output)
+	}
+	if _, err := agent.ParseMode(opts.mode); err != nil {
+		return err
+	}
+	prompt, err := readPrompt(opts.prompt, cmd.InOrStdin())
+	if err != nil {
+		return err
+	}
+
+	b, err := open(flags)
+	if err != nil {
+		return err
+	}
+	defer b.Close()
+	if err := b.start(ctx, flags); err != nil {
+		return err
+	}
+	noteUpdate(ctx, b.config(), cmd.ErrOrStderr())
+	switch {
+	case opts.yes:
+		b.approve(permissions.ApproverFunc(func(context.Context, permissions.Request) (bool, error) {
+			return true, nil
+		}))
+	case isTerminal(os.Stdin):
+		b.approve(newTerminalApprover(os.Stdin, cmd.ErrOrStderr()))
+	}
+
+	session, err := b.runSession(ctx, opts.session, prompt)
+	if err != nil {
+		return err
+	}
+	if err := b.switchMode(ctx, session.ID, opts.mode); err != nil {
+		return err
+	}
+
+	out := cmd.OutOrStdout()
+	var response string
+	if opts.stream {
+		chunks, err := b.agent.Stream(ctx, session.ID, prompt)
+		if err != nil {
+			return err
+		}
+		var sb strings.Builder
+		for chunk := range chunks {
+			sb.WriteString(chunk)
+			if opts.output == outputText {
+				io.WriteString(out, chunk)
+			}
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		response = sb.String()
+		if opts.output == outputText {
+			fmt.Fprintln(out)
+		}
+	} else {
+		response, err = b.agent.Chat(ctx, session.ID, prompt)
+		if err != nil {
+			return err
+		}
+		if opts.output == outputText {
+			fmt.Fprintln(out, response)
+		}
+	}
+
+	if opts.output == outputJSON {
+		// Reload for the usage of this run
+		if session, err = b.agent.Session(ctx, session.ID); err != nil {
+			return err
+		}
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		return enc.Encode(runResult{SessionID: session.ID, Response: response, Session: session})
+	}
+	return nil
+}
+
+// readPrompt returns prompt, or reads it from in when it is empty and in
+// isn't a terminal
+func readPrompt(prompt string, in io.Reader) (string, error) {
+	if strings.TrimSpace(prompt) != "" {
+		return prompt, nil
+	}
+	if f, ok := in.(*os.File); ok && isTerminal(f) {
+		return "", errors.New("no prompt: pass one with -p or on standard input")
+	}
+	data, err := io.ReadAll(in)
+	if err != nil {
+		return "", fmt.Errorf("failed to read the prompt: %w", err)
+	}
+	if strings.TrimSpace(string(data)) == "" {
+		return "", errors.New("no prompt: pass one with -p or on standard input")
+	}
+	return string(data), nil
+}
+
+// switchMode switches a session to the named mode, if one is given
+func (b *backend) switchMode(ctx context.Context, sessionID, name string) error {
+	if name == "" {
+		return nil
+	}
+	mode, err := agent.ParseMode(name)
+	if err != nil {
+		return err
+	}
+	return b.agent.SetSessionMode(ctx, sessionID, mode)
+}
+
+// runSession returns the session with ID id, or a new one named after
+// prompt
+func (b *backend) runSession(ctx context.Context, id, prompt string) (*models.Session, error) {
+	if id != "" {
+		return b.agent.Session(ctx, id)
+	}
+	title := strings.TrimSpace(prompt)
+	if i := strings.IndexByte(title, '\n'); i >= 0 {
+		title = strings.TrimSpace(title[:i])
+	}
+	if runes := []rune(title); len(runes) > maxTitleLength {
+		title = string(runes[:maxTitleLength-3]) + "..."
+	}
+	return b.agent.CreateSession(ctx, title)
+}
@@ -0,0 +1,90 @@
+package cli
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net"
+
+	"github.com/omnitrix-sh/core.sh/internal/server"
+	"github.com/omnitrix-sh/core.sh/internal/update"
+	"github.com/spf13/cobra"
+)
+
+func newServeCommand(flags *globalFlags) *cobra.Command {
+	var addr string
+	cmd := &cobra.Command{
+		Use:   "serve",
+		Short: "Serve the agent over HTTP",
+		Long: `Serve the agent over HTTP for other frontends, on server.addr from the
+config or 127.0.0.1:7433. A token is generated on every start and printed;
+clients send it as "Authorization: Bearer <token>". Without TLS configured
+under server.tls only loopback addresses can be served. It runs until
+interrupted.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			b, err := open(flags)
+			if err != nil {
+				return err
+			}
+			defer b.Close()
+			if err := b.start(ctx, flags); err != nil {
+				return err
+			}
+			// Without the watcher config changes wait for the next start
+			_ = b.watch(ctx)
+
+			token, err := newToken()
+			if err != nil {
+				return err
+			}
+			cfg := b.config()
+			serverCfg := cfg.Server
+			if addr != "" {
+				serverCfg.Addr = addr
+			}
+			ln, fingerprint, err := server.Listen(serverCfg, cfg.DataDir)
+			if err != nil {
+				return err
+			}
+			// Clients may use the names of the certificate and the address
+			// listened on
+			hosts := append([]string(nil), serverCfg.TLS.Hosts...)
+			if tcp, ok := ln.Addr().(*net.TCPAddr); ok && !tcp.IP.IsUnspecified() {
+				hosts = append(hosts, tcp.IP.String())
+			}
+			s := server.New(b.agent, b.bus, server.Options{
+				Name:    serverName(),
+				Token:   token,
+				Hosts:   hosts,
+				Updater: update.New(cfg.Update, cfg.DataDir),
+			})
+			b.approve(s.Approver())
+
+			scheme := "http"
+			if serverCfg.TLS.CertFile != "" || serverCfg.TLS.SelfSigned {
+				scheme = "https"
+			}
+			out := cmd.OutOrStdout()
+			fmt.Fprintf(out, "Serving on %s://%s\n", scheme, ln.Addr())
+			fmt.Fprintf(out, "Token: %s\n", token)
+			if fingerprint != "" {
+				fmt.Fprintf(out, "Certificate fingerprint: %s\n", fingerprint)
+			}
+			go noteUpdate(ctx, cfg, cmd.ErrOrStderr())
+			return s.Serve(ctx, ln)
+		},
+	}
+	cmd.Flags().StringVar(&addr, "addr", "", "address to listen on (default: server.addr from the config)")
+	return cmd
+}
+
+// newToken returns a random token for clients of the server
+func newToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate a token: %w", err)
+	}
+	return hex.EncodeToString(buf), nil
+}
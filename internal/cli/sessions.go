@@ -0,0 +1,136 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/omnitrix-sh/core.sh/internal/db"
+	"github.com/omnitrix-sh/core.sh/internal/display"
+	"github.com/omnitrix-sh/core.sh/internal/export"
+	"github.com/spf13/cobra"
+)
+
+func newSessionsCommand(flags *globalFlags) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "sessions",
+		Aliases: []string{"session"},
+		Short:   "List, delete and export sessions",
+	}
+	cmd.AddCommand(
+		newSessionsListCommand(flags),
+		newSessionsDeleteCommand(flags),
+		newSessionsExportCommand(flags),
+	)
+	return cmd
+}
+
+func newSessionsListCommand(flags *globalFlags) *cobra.Command {
+	var limit int
+	var asJSON bool
+	cmd := &cobra.Command{
+		Use:     "list",
+		Aliases: []string{"ls"},
+		Short:   "List sessions, most recent first",
+		Args:    cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			b, err := open(flags)
+			if err != nil {
+				return err
+			}
+			defer b.Close()
+
+			sessions, err := b.sessions().ListSessions(cmd.Context(), limit, 0)
+			if err != nil {
+				return err
+			}
+			out := cmd.OutOrStdout()
+			if asJSON {
+				enc := json.NewEncoder(out)
+				enc.SetIndent("", "  ")
+				return enc.Encode(sessions)
+			}
+			if len(sessions) == 0 {
+				fmt.Fprintln(out, "No sessions yet.")
+				return nil
+			}
+			rows := make([][]string, len(sessions))
+			for i, s := range sessions {
+				rows[i] = []string{s.ID, s.Title, s.Provider + "/" + s.Model, display.Time(s.UpdatedAt)}
+			}
+			fmt.Fprint(out, display.Table([]string{"ID", "Title", "Model", "Updated"}, rows))
+			return nil
+		},
+	}
+	cmd.Flags().IntVarP(&limit, "limit", "n", 20, "how many sessions to list")
+	cmd.Flags().BoolVar(&asJSON, "json", false, "print JSON")
+	return cmd
+}
+
+func newSessionsDeleteCommand(flags *globalFlags) *cobra.Command {
+	return &cobra.Command{
+		Use:     "delete <id>...",
+		Aliases: []string{"rm"},
+		Short:   "Delete sessions with their messages",
+		Args:    cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			b, err := open(flags)
+			if err != nil {
+				return err
+			}
+			defer b.Close()
+
+			a := b.sessions()
+			for _, id := range args {
+				if err := a.DeleteSession(cmd.Context(), id); err != nil {
+					return err
+				}
+				fmt.Fprintf(cmd.OutOrStdout(), "Deleted session %s\n", id)
+			}
+			return nil
+		},
+	}
+}
+
+func newSessionsExportCommand(flags *globalFlags) *cobra.Command {
+	var format, output string
+	var noRedact bool
+	cmd := &cobra.Command{
+		Use:   "export <id>",
+		Short: "Export a session as JSON or a Markdown transcript",
+		Long: `Export a session as JSON, which can be imported into another database, or
+as a Markdown transcript to attach to a bug report. Secrets are masked
+unless --no-redact is given.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			b, err := open(flags)
+			if err != nil {
+				return err
+			}
+			defer b.Close()
+
+			// Check before creating the output file
+			if _, err := b.sessions().Session(cmd.Context(), args[0]); err != nil {
+				return err
+			}
+			var w io.Writer = cmd.OutOrStdout()
+			if output != "" && output != "-" {
+				f, err := os.Create(output)
+				if err != nil {
+					return fmt.Errorf("failed to create %s: %w", output, err)
+				}
+				defer f.Close()
+				w = f
+			}
+			return export.NewExporter(db.New(b.reader)).ExportSession(cmd.Context(), w, args[0], export.SessionExportOptions{
+				Format:           export.SessionFormat(format),
+				DisableRedaction: noRedact,
+			})
+		},
+	}
+	cmd.Flags().StringVarP(&format, "format", "f", string(export.SessionJSON), "json or markdown")
+	cmd.Flags().StringVarP(&output, "output", "o", "", "file to write (default: standard output)")
+	cmd.Flags().BoolVar(&noRedact, "no-redact", false, "keep secrets; only for exports that never leave this machine")
+	return cmd
+}
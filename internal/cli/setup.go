@@ -0,0 +1,362 @@
+package cli
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/omnitrix-sh/core.sh/internal/agent"
+	"github.com/omnitrix-sh/core.sh/internal/archive"
+	"github.com/omnitrix-sh/core.sh/internal/checkpoint"
+	"github.com/omnitrix-sh/core.sh/internal/config"
+	"github.com/omnitrix-sh/core.sh/internal/db"
+	"github.com/omnitrix-sh/core.sh/internal/display"
+	"github.com/omnitrix-sh/core.sh/internal/events"
+	"github.com/omnitrix-sh/core.sh/internal/experiment"
+	"github.com/omnitrix-sh/core.sh/internal/format"
+	"github.com/omnitrix-sh/core.sh/internal/lsp"
+	"github.com/omnitrix-sh/core.sh/internal/permissions"
+	"github.com/omnitrix-sh/core.sh/internal/plugin"
+	"github.com/omnitrix-sh/core.sh/internal/postprocess"
+	"github.com/omnitrix-sh/core.sh/internal/prompt"
+	"github.com/omnitrix-sh/core.sh/internal/promptlog"
+	"github.com/omnitrix-sh/core.sh/internal/pseudonym"
+	"github.com/omnitrix-sh/core.sh/internal/secrets"
+	"github.com/omnitrix-sh/core.sh/internal/stream"
+	"github.com/omnitrix-sh/core.sh/internal/tools"
+	"github.com/omnitrix-sh/core.sh/pkg/models"
+)
+
+// globalFlags are the flags every command takes
+type globalFlags struct {
+	dir      string
+	provider string
+	model    string
+}
+
+// backend is the config and database a command works with, and the agent
+// once started
+type backend struct {
+	// mu guards cfg and report, which reload replaces while commands run
+	mu      sync.Mutex
+	cfg     *models.Config
+	conn    *sql.DB
+	queries *db.Queries
+	// reader is a read-only pool for history, search and exports, so they
+	// don't wait on writes
+	reader *sql.DB
+
+	agent    *agent.Agent
+	provider models.ProviderType
+	model    string
+	bus      *events.Bus
+	checker  *permissions.Checker
+	report   *tools.Report
+	lsp      *lsp.Manager
+	plugins  *plugin.Set
+	writer   *db.MessageWriter
+	// stopSampling ends the experiment's sampling of turns
+	stopSampling func()
+}
+
+// open loads the config of the project and opens the database
+func open(flags *globalFlags) (*backend, error) {
+	cfg, err := loadConfig(flags)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := db.Connect(cfg.DataDir)
+	if err != nil {
+		return nil, err
+	}
+	reader, err := db.ConnectReadOnly(cfg.DataDir)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return &backend{cfg: cfg, conn: conn, queries: db.New(conn), reader: reader}, nil
+}
+
+// loadConfig loads the config of the project in flags.dir, or the current
+// directory, and applies its display settings
+func loadConfig(flags *globalFlags) (*models.Config, error) {
+	dir := flags.dir
+	if dir == "" {
+		wd, err := os.Getwd()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get the working directory: %w", err)
+		}
+		dir = wd
+	}
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, fmt.Errorf("invalid project directory: %w", err)
+	}
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		return nil, fmt.Errorf("project directory %s does not exist", dir)
+	}
+
+	cfg, err := config.Load(dir)
+	if err != nil {
+		return nil, err
+	}
+	formatter, err := display.FromConfig(cfg.Display)
+	if err != nil {
+		return nil, err
+	}
+	display.SetDefault(formatter)
+	return cfg, nil
+}
+
+// config returns the current config, see reload
+func (b *backend) config() *models.Config {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.cfg
+}
+
+// Close stops the language servers and plugins, writes what is still
+// queued and closes the database
+func (b *backend) Close() {
+	if b.stopSampling != nil {
+		b.stopSampling()
+	}
+	b.lsp.Close()
+	b.plugins.Close()
+	if b.writer != nil {
+		b.writer.Close()
+	}
+	b.reader.Close()
+	b.conn.Close()
+}
+
+// sessions returns an agent for managing sessions, which needs no
+// provider. Use start for an agent that can chat.
+func (b *backend) sessions() *agent.Agent {
+	if b.agent != nil {
+		return b.agent
+	}
+	a := agent.New("", "", "", "", b.queries, nil)
+	a.SetReadReplica(b.reader)
+	return a
+}
+
+// start creates the agent with the provider and model chosen in flags or
+// the config, the tools of the project and every setting of the config.
+// Permissions are checked but not asked for; commands set their approver
+// with approve.
+func (b *backend) start(ctx context.Context, flags *globalFlags) error {
+	cfg := b.config()
+	plugins, err := plugin.Load(ctx, cfg.Plugins.Dir, cfg.Plugins.Disabled)
+	if err != nil {
+		return err
+	}
+	b.plugins = plugins
+	provider, model, pc, err := chooseModel(cfg, flags, plugins)
+	if err != nil {
+		return err
+	}
+
+	b.lsp = lsp.NewManager(cfg.WorkDir, cfg.LSP)
+	toolset, report, err := tools.BuildReport(ctx, tools.Options{
+		WorkDir:   cfg.WorkDir,
+		DataDir:   cfg.DataDir,
+		Exec:      cfg.Exec,
+		LSP:       b.lsp,
+		Commands:  cfg.Commands,
+		Roots:     cfg.Tools.Roots,
+		Ignore:    cfg.Tools.Ignore,
+		Databases: cfg.Databases,
+		External:  plugins.ToolNames(),
+	}, cfg.Tools.Enabled, cfg.Tools.Disabled)
+	if err != nil {
+		return err
+	}
+	toolset = plugins.Tools(toolset, cfg.Tools.Disabled)
+	b.mu.Lock()
+	b.report = report
+	b.mu.Unlock()
+
+	a := agent.New(provider, model, pc.BaseURL, pc.APIKey, b.queries, toolset)
+	a.SetReadReplica(b.reader)
+	if served := plugins.Provider(provider); served != nil {
+		a.SetProvider(served)
+	}
+	profile := config.ModelProfileFor(cfg, model)
+	a.SetModelProfile(profile)
+	a.SetModelAliases(cfg.Aliases)
+	a.SetContextLimit(profile.ContextSize, cfg.ContextOverflow)
+	a.SetOllamaOptions(pc.Options, pc.KeepAlive)
+	a.SetPricing(config.Prices(cfg))
+	a.SetSystemPrompt(prompt.FromConfig(cfg))
+	a.SetToolSchemaMode(cfg.ToolSchemas)
+	a.SetRetrieval(cfg.Retrieval)
+	a.SetMessageLimits(cfg.MessageLimits)
+	a.SetToolExecution(cfg.ToolExecution)
+	a.SetTasks(cfg.Tasks)
+	a.SetMemory(cfg.Memory)
+	if err := a.SetCodeSearch(cfg.CodeSearch, cfg.WorkDir); err != nil {
+		return err
+	}
+	a.SetEnv(cfg.Env)
+	a.SetDiagnostics(b.lsp)
+	formatters, err := format.New(cfg.Formatters, cfg.WorkDir, tools.NewExecTool(cfg.WorkDir, cfg.Exec))
+	if err != nil {
+		return err
+	}
+	a.SetFormatters(formatters)
+	if err := a.SetLanguage(cfg.Language); err != nil {
+		return err
+	}
+	if err := a.SetMode(agent.Mode(cfg.Mode)); err != nil {
+		return err
+	}
+
+	pipeline, err := postprocess.FromConfig(cfg.PostProcess)
+	if err != nil {
+		return err
+	}
+	a.SetPostProcessor(pipeline)
+	providerArchive, err := archive.New(cfg.Archive, b.queries)
+	if err != nil {
+		return err
+	}
+	a.SetArchive(providerArchive)
+	guard, err := secrets.New(cfg.Secrets)
+	if err != nil {
+		return err
+	}
+	a.SetSecretsGuard(guard)
+	mapper, err := pseudonym.New(cfg.Pseudonymize)
+	if err != nil {
+		return err
+	}
+	a.SetPseudonymizer(mapper)
+	logger, err := promptlog.New(cfg.PromptLog, cfg.DataDir)
+	if err != nil {
+		return err
+	}
+	a.SetPromptLogger(logger)
+	store, err := checkpoint.New(cfg.Checkpoints, cfg.WorkDir, cfg.DataDir, b.queries)
+	if err != nil {
+		return err
+	}
+	a.SetCheckpoints(store)
+	streamOpts, err := stream.OptionsFromConfig(cfg.Stream)
+	if err != nil {
+		return err
+	}
+	a.SetStreamOptions(streamOpts)
+
+	b.writer = db.NewMessageWriter(b.conn, time.Duration(cfg.WriteBehindMS)*time.Millisecond)
+	a.SetMessageWriter(b.writer)
+	b.bus = events.NewBus()
+	a.SetEventBus(b.bus)
+
+	b.checker, err = permissions.NewChecker(cfg.Permissions, cfg.WorkDir)
+	if err != nil {
+		return err
+	}
+	a.SetPermissions(b.checker, nil)
+
+	// Sampled turns are compared in the background while the command runs
+	e, err := experiment.New(a, cfg.Experiment, cfg.DataDir)
+	if err != nil {
+		return err
+	}
+	b.stopSampling = e.Sample(ctx, b.bus)
+
+	b.agent, b.provider, b.model = a, provider, model
+	return nil
+}
+
+// approve asks approver for the tool executions the permissions say need
+// approval. Without an approver they are denied.
+func (b *backend) approve(approver permissions.Approver) {
+	b.agent.SetPermissions(b.checker, approver)
+}
+
+// chooseModel picks the provider and model from the flags, else the
+// config's defaults. Either model may be an alias, which picks the
+// provider as well. Providers plugins serve need no config.
+func chooseModel(cfg *models.Config, flags *globalFlags, plugins *plugin.Set) (models.ProviderType, string, models.ProviderConfig, error) {
+	provider := models.ProviderType(flags.provider)
+	name := flags.model
+	if name == "" && provider == "" {
+		name = cfg.DefaultModel
+	}
+	if alias, ok := cfg.Aliases[name]; ok && provider == "" {
+		provider = alias.Provider
+	}
+	if provider == "" {
+		provider = models.ProviderType(cfg.DefaultProvider)
+	}
+	if provider == "" {
+		provider = defaultProvider(cfg)
+	}
+	if provider == "" {
+		return "", "", models.ProviderConfig{}, errors.New("no provider is enabled: set one up under providers in the config")
+	}
+	served := plugins.Provider(provider) != nil
+	if provider != models.ProviderOllama && provider != models.ProviderOpenAI && !served {
+		return "", "", models.ProviderConfig{}, fmt.Errorf("provider %s is not supported, use ollama, openai or one a plugin serves", provider)
+	}
+	pc, ok := cfg.Providers[provider]
+	if !ok && !served {
+		return "", "", models.ProviderConfig{}, fmt.Errorf("provider %s is not configured", provider)
+	}
+	if ok && !pc.Enabled {
+		return "", "", models.ProviderConfig{}, fmt.Errorf("provider %s is disabled", provider)
+	}
+	if provider == models.ProviderOpenAI && pc.APIKey == "" {
+		return "", "", models.ProviderConfig{}, errors.New("provider openai needs an API key: set providers.openai.api_key in the config")
+	}
+
+	// The default model may belong to another provider than the one asked
+	// for
+	model := flags.model
+	if model == "" && flags.provider != "" && len(pc.Models) > 0 {
+		model = pc.Models[0]
+	}
+	if model == "" {
+		model = cfg.DefaultModel
+	}
+	if model == "" && len(pc.Models) > 0 {
+		model = pc.Models[0]
+	}
+	if model == "" {
+		return "", "", models.ProviderConfig{}, fmt.Errorf("no model chosen for %s: pass --model or set default_model in the config", provider)
+	}
+	if alias, ok := cfg.Aliases[model]; ok {
+		if alias.Provider != "" && alias.Provider != provider {
+			return "", "", models.ProviderConfig{}, fmt.Errorf("model %s is an alias for %s of %s, not of %s", model, alias.Model, alias.Provider, provider)
+		}
+		model = alias.Model
+	}
+	return provider, model, pc, nil
+}
+
+// defaultProvider returns Ollama if it is enabled, else the first enabled
+// provider by name
+func defaultProvider(cfg *models.Config) models.ProviderType {
+	if pc, ok := cfg.Providers[models.ProviderOllama]; ok && pc.Enabled {
+		return models.ProviderOllama
+	}
+	var enabled []string
+	for provider, pc := range cfg.Providers {
+		if pc.Enabled {
+			enabled = append(enabled, string(provider))
+		}
+	}
+	if len(enabled) == 0 {
+		return ""
+	}
+	sort.Strings(enabled)
+	return models.ProviderType(enabled[0])
+}
@@ -0,0 +1,190 @@
+package cli
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/charmbracelet/x/term"
+	"github.com/omnitrix-sh/core.sh/internal/onboard"
+	"github.com/omnitrix-sh/core.sh/internal/permissions"
+)
+
+// maxPreviewLines bounds the diff shown when asking for approval
+const maxPreviewLines = 100
+
+// isTerminal reports whether f is connected to a terminal
+func isTerminal(f *os.File) bool {
+	return term.IsTerminal(f.Fd())
+}
+
+// lineReader reads answers line by line, giving up when ctx is done. It
+// only reads while asked to, so nothing is taken from the input meant for
+// whatever runs afterwards, like the chat.
+type lineReader struct {
+	r       *bufio.Reader
+	pending chan lineResult // the read still running, if any
+}
+
+type lineResult struct {
+	line string
+	err  error
+}
+
+func newLineReader(r io.Reader) *lineReader {
+	return &lineReader{r: bufio.NewReader(r)}
+}
+
+func (lr *lineReader) readLine(ctx context.Context) (string, error) {
+	if lr.pending == nil {
+		pending := make(chan lineResult, 1)
+		lr.pending = pending
+		go func() {
+			line, err := lr.r.ReadString('\n')
+			pending <- lineResult{line, err}
+		}()
+	}
+	select {
+	case result := <-lr.pending:
+		lr.pending = nil
+		if result.err != nil && result.line == "" {
+			return "", result.err
+		}
+		return strings.TrimSpace(result.line), nil
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+// terminalApprover asks on the terminal whether a tool may run, showing
+// what it would change, and puts the model's questions to the user
+type terminalApprover struct {
+	mu  sync.Mutex // one question at a time
+	in  *lineReader
+	out io.Writer
+}
+
+func newTerminalApprover(in io.Reader, out io.Writer) *terminalApprover {
+	return &terminalApprover{in: newLineReader(in), out: out}
+}
+
+func (t *terminalApprover) Approve(ctx context.Context, req permissions.Request) (bool, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "\nAllow %s (%s)?\n", req.Tool, req.Risk)
+	for _, path := range req.Paths {
+		fmt.Fprintf(&b, "  %s\n", path)
+	}
+	if command, ok := req.Args["command"].(string); ok {
+		fmt.Fprintf(&b, "  $ %s\n", command)
+	}
+	if req.Preview != "" {
+		lines := strings.Split(strings.TrimRight(req.Preview, "\n"), "\n")
+		if len(lines) > maxPreviewLines {
+			lines = append(lines[:maxPreviewLines], fmt.Sprintf("... %d more lines", len(lines)-maxPreviewLines))
+		}
+		b.WriteString(strings.Join(lines, "\n"))
+		b.WriteString("\n")
+	}
+	b.WriteString("[y/N] ")
+	io.WriteString(t.out, b.String())
+
+	answer, err := t.in.readLine(ctx)
+	if err != nil {
+		return false, err
+	}
+	answer = strings.ToLower(answer)
+	return answer == "y" || answer == "yes", nil
+}
+
+// Ask puts the model's question on the terminal. The number of an option
+// stands for the option; an empty line or the end of input skip it.
+func (t *terminalApprover) Ask(ctx context.Context, q permissions.Question) (string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "\n%s\n", q.Question)
+	for i, option := range q.Options {
+		fmt.Fprintf(&b, "  %d) %s\n", i+1, option)
+	}
+	b.WriteString("> ")
+	io.WriteString(t.out, b.String())
+
+	answer, err := t.in.readLine(ctx)
+	if errors.Is(err, io.EOF) || err == nil && answer == "" {
+		return "", permissions.ErrUnanswered
+	}
+	if err != nil {
+		return "", err
+	}
+	if i, err := strconv.Atoi(answer); err == nil && i >= 1 && i <= len(q.Options) {
+		return q.Options[i-1], nil
+	}
+	return answer, nil
+}
+
+// linePrompter runs onboarding on the terminal
+type linePrompter struct {
+	ctx context.Context
+	in  *lineReader
+	out io.Writer
+}
+
+func newLinePrompter(ctx context.Context, in io.Reader, out io.Writer) *linePrompter {
+	return &linePrompter{ctx: ctx, in: newLineReader(in), out: out}
+}
+
+func (p *linePrompter) Info(text string) {
+	fmt.Fprintln(p.out, text)
+}
+
+func (p *linePrompter) Choose(question string, options []string) (int, error) {
+	fmt.Fprintln(p.out, question)
+	for i, option := range options {
+		fmt.Fprintf(p.out, "  %d) %s\n", i+1, option)
+	}
+	for {
+		fmt.Fprintf(p.out, "Choose 1-%d: ", len(options))
+		answer, err := p.in.readLine(p.ctx)
+		if err != nil {
+			return 0, p.cancelled(err)
+		}
+		if i, err := strconv.Atoi(answer); err == nil && i >= 1 && i <= len(options) {
+			return i - 1, nil
+		}
+	}
+}
+
+func (p *linePrompter) Ask(question string, secret bool) (string, error) {
+	fmt.Fprintf(p.out, "%s ", question)
+	if secret && isTerminal(os.Stdin) {
+		answer, err := term.ReadPassword(os.Stdin.Fd())
+		fmt.Fprintln(p.out)
+		if err != nil {
+			return "", p.cancelled(err)
+		}
+		return strings.TrimSpace(string(answer)), nil
+	}
+	answer, err := p.in.readLine(p.ctx)
+	if err != nil {
+		return "", p.cancelled(err)
+	}
+	return answer, nil
+}
+
+// cancelled treats the end of input as giving up
+func (p *linePrompter) cancelled(err error) error {
+	if errors.Is(err, io.EOF) || errors.Is(err, context.Canceled) {
+		return onboard.ErrCancelled
+	}
+	return err
+}
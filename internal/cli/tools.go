@@ -0,0 +1,115 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/omnitrix-sh/core.sh/internal/display"
+	"github.com/omnitrix-sh/core.sh/internal/lsp"
+	"github.com/omnitrix-sh/core.sh/internal/plugin"
+	"github.com/omnitrix-sh/core.sh/internal/tools"
+	"github.com/spf13/cobra"
+)
+
+// maxDescriptionLength is how much of a tool's description is listed
+const maxDescriptionLength = 70
+
+// toolInfo describes an available tool
+type toolInfo struct {
+	Name        string     `json:"name"`
+	Risk        tools.Risk `json:"risk"`
+	Description string     `json:"description"`
+}
+
+func newToolsCommand(flags *globalFlags) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "tools",
+		Short: "Look at the tools the model can use",
+	}
+	cmd.AddCommand(newToolsListCommand(flags))
+	return cmd
+}
+
+func newToolsListCommand(flags *globalFlags) *cobra.Command {
+	var asJSON bool
+	cmd := &cobra.Command{
+		Use:     "list",
+		Aliases: []string{"ls"},
+		Short:   "List the tools of the project and what keeps others from working",
+		Args:    cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := loadConfig(flags)
+			if err != nil {
+				return err
+			}
+			manager := lsp.NewManager(cfg.WorkDir, cfg.LSP)
+			defer manager.Close()
+			plugins, err := plugin.Load(cmd.Context(), cfg.Plugins.Dir, cfg.Plugins.Disabled)
+			if err != nil {
+				return err
+			}
+			defer plugins.Close()
+			toolset, report, err := tools.BuildReport(cmd.Context(), tools.Options{
+				WorkDir:   cfg.WorkDir,
+				DataDir:   cfg.DataDir,
+				Exec:      cfg.Exec,
+				LSP:       manager,
+				Commands:  cfg.Commands,
+				Roots:     cfg.Tools.Roots,
+				Ignore:    cfg.Tools.Ignore,
+				Databases: cfg.Databases,
+				External:  plugins.ToolNames(),
+			}, cfg.Tools.Enabled, cfg.Tools.Disabled)
+			if err != nil {
+				return err
+			}
+			toolset = plugins.Tools(toolset, cfg.Tools.Disabled)
+
+			available := make([]toolInfo, len(toolset))
+			for i, tool := range toolset {
+				available[i] = toolInfo{Name: tool.Name(), Risk: tool.Risk(), Description: tool.Description()}
+			}
+			out := cmd.OutOrStdout()
+			if asJSON {
+				enc := json.NewEncoder(out)
+				enc.SetIndent("", "  ")
+				return enc.Encode(struct {
+					Tools []toolInfo `json:"tools"`
+					*tools.Report
+				}{available, report})
+			}
+
+			rows := make([][]string, len(available))
+			for i, tool := range available {
+				rows[i] = []string{tool.Name, string(tool.Risk), summary(tool.Description)}
+			}
+			fmt.Fprint(out, display.Table([]string{"Tool", "Risk", "Description"}, rows))
+			if len(report.Unconfigured) > 0 {
+				fmt.Fprintf(out, "\nNot configured: %s\n", strings.Join(report.Unconfigured, ", "))
+			}
+			for _, d := range report.Degraded {
+				fmt.Fprintf(out, "\nUnavailable: %s: %s\n  fix: %s\n", d.Tool, d.Missing, d.Fix)
+			}
+			return nil
+		},
+	}
+	cmd.Flags().BoolVar(&asJSON, "json", false, "print JSON")
+	return cmd
+}
+
+// summary returns the first sentence of a description, shortened to fit a
+// table
+func summary(description string) string {
+	s := strings.TrimSpace(description)
+	if i := strings.IndexByte(s, '\n'); i >= 0 {
+		s = s[:i]
+	}
+	if i := strings.Index(s, ". "); i >= 0 {
+		s = s[:i+1]
+	}
+	if runes := []rune(s); len(runes) > maxDescriptionLength {
+		s = string(runes[:maxDescriptionLength-3]) + "..."
+	}
+	return s
+}
@@ -0,0 +1,83 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/omnitrix-sh/core.sh/internal/update"
+	"github.com/omnitrix-sh/core.sh/pkg/models"
+	"github.com/spf13/cobra"
+)
+
+// updateCheckTimeout bounds the background check commands make at start
+const updateCheckTimeout = 5 * time.Second
+
+func newUpdateCommand(flags *globalFlags) *cobra.Command {
+	var check, asJSON bool
+	cmd := &cobra.Command{
+		Use:   "update",
+		Short: "Install the latest release",
+		Long: `Check the configured repository for a newer release and replace this
+binary with it. The download's signature is verified, and releases that
+are not newer than the running version are refused. The new version runs
+from the next start.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := loadConfig(flags)
+			if err != nil {
+				return err
+			}
+			u := update.New(cfg.Update, cfg.DataDir)
+			status, err := u.Check(cmd.Context())
+			if err != nil {
+				return err
+			}
+
+			out := cmd.OutOrStdout()
+			if asJSON {
+				enc := json.NewEncoder(out)
+				enc.SetIndent("", "  ")
+				if err := enc.Encode(status); err != nil {
+					return err
+				}
+			}
+			if !status.Available {
+				if !asJSON {
+					fmt.Fprintf(out, "%s is the latest release\n", status.Current)
+				}
+				return nil
+			}
+			if check {
+				if !asJSON {
+					fmt.Fprintf(out, "%s is out, running %s: %s\n", status.Latest.Version, status.Current, status.Latest.URL)
+				}
+				return nil
+			}
+			if err := u.Apply(cmd.Context(), status.Latest); err != nil {
+				return err
+			}
+			if !asJSON {
+				fmt.Fprintf(out, "Updated to %s\n", status.Latest.Version)
+			}
+			return nil
+		},
+	}
+	cmd.Flags().BoolVar(&check, "check", false, "only report whether a newer release is out")
+	cmd.Flags().BoolVar(&asJSON, "json", false, "print the status as JSON")
+	return cmd
+}
+
+// noteUpdate tells w about a newer release when update checks are turned
+// on and one is due. A failed check is not worth failing the command for.
+func noteUpdate(ctx context.Context, cfg *models.Config, w io.Writer) {
+	ctx, cancel := context.WithTimeout(ctx, updateCheckTimeout)
+	defer cancel()
+	status, err := update.New(cfg.Update, cfg.DataDir).CheckIfDue(ctx)
+	if err != nil || status == nil || !status.Available {
+		return
+	}
+	fmt.Fprintf(w, "%s is out, running %s; install it with omnitrix update\n", status.Latest.Version, status.Current)
+}
@@ -0,0 +1,126 @@
+package clipboard
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// ErrUnavailable is returned when no clipboard utility is installed
+var ErrUnavailable = errors.New("no clipboard utility found")
+
+// backend is a pair of commands that copy to and paste from the clipboard
+type backend struct {
+	name  string
+	copy  []string
+	paste []string
+}
+
+// backends lists the candidates for the current platform in order of preference
+func backends() []backend {
+	switch runtime.GOOS {
+	case "darwin":
+		return []backend{
+			{name: "pbcopy", copy: []string{"pbcopy"}, paste: []string{"pbpaste"}},
+		}
+	case "windows":
+		return []backend{
+			{
+				name:  "powershell",
+				copy:  []string{"powershell", "-NoProfile", "-Command", "$input | Set-Clipboard"},
+				paste: []string{"powershell", "-NoProfile", "-Command", "Get-Clipboard -Raw"},
+			},
+		}
+	}
+
+	var candidates []backend
+	if os.Getenv("WAYLAND_DISPLAY") != "" {
+		candidates = append(candidates, backend{
+			name:  "wl-clipboard",
+			copy:  []string{"wl-copy"},
+			paste: []string{"wl-paste", "--no-newline"},
+		})
+	}
+	candidates = append(candidates,
+		backend{
+			name:  "xclip",
+			copy:  []string{"xclip", "-selection", "clipboard", "-in"},
+			paste: []string{"xclip", "-selection", "clipboard", "-out"},
+		},
+		backend{
+			name:  "xsel",
+			copy:  []string{"xsel", "--clipboard", "--input"},
+			paste: []string{"xsel", "--clipboard", "--output"},
+		},
+		// WSL exposes the Windows clipboard through these
+		backend{
+			name:  "wsl",
+			copy:  []string{"clip.exe"},
+			paste: []string{"powershell.exe", "-NoProfile", "-Command", "Get-Clipboard -Raw"},
+		},
+	)
+	return candidates
+}
+
+func findBackend() (backend, error) {
+	for _, b := range backends() {
+		if _, err := exec.LookPath(b.copy[0]); err != nil {
+			continue
+		}
+		if _, err := exec.LookPath(b.paste[0]); err != nil {
+			continue
+		}
+		return b, nil
+	}
+	return backend{}, ErrUnavailable
+}
+
+// Available reports whether a clipboard utility can be used on this system
+func Available() bool {
+	_, err := findBackend()
+	return err == nil
+}
+
+// Read returns the current text contents of the system clipboard
+func Read(ctx context.Context) (string, error) {
+	b, err := findBackend()
+	if err != nil {
+		return "", err
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, b.paste[0], b.paste[1:]...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("%s paste failed: %w: %s", b.name, err, strings.TrimSpace(stderr.String()))
+	}
+
+	text := stdout.String()
+	if runtime.GOOS == "windows" || b.name == "wsl" {
+		text = strings.ReplaceAll(text, "\r\n", "\n")
+	}
+	return text, nil
+}
+
+// Write replaces the contents of the system clipboard with text
+func Write(ctx context.Context, text string) error {
+	b, err := findBackend()
+	if err != nil {
+		return err
+	}
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, b.copy[0], b.copy[1:]...)
+	cmd.Stdin = strings.NewReader(text)
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s copy failed: %w: %s", b.name, err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
@@ -0,0 +1,327 @@
+// Package codesearch finds code by meaning. Workspace files are cut into
+// chunks of lines whose embeddings are kept in the database, and queries
+// are matched against them by cosine similarity. The similarity is
+// computed in Go over every chunk of the workspace rather than by a
+// vector index such as sqlite-vec: that keeps the database a plain SQLite
+// file any build can open, and a workspace has few enough chunks, some
+// thousands, for a scan to take milliseconds.
+package codesearch
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/omnitrix-sh/core.sh/internal/db"
+	"github.com/omnitrix-sh/core.sh/internal/embeddings"
+)
+
+const (
+	// maxFileSize is the largest file indexed; larger ones are mostly
+	// generated or data
+	maxFileSize = 256 * 1024
+	// chunkLines and chunkBytes bound a chunk, whichever is reached first
+	chunkLines = 60
+	chunkBytes = 2000
+	// embedBatch is how many chunks are embedded per request
+	embedBatch = 32
+	// rescanInterval is how long Search trusts the last look at the files
+	// before walking the tree again
+	rescanInterval = 30 * time.Second
+)
+
+// skipFiles are generated files that would crowd out the code
+var skipFiles = map[string]bool{
+	"go.sum":            true,
+	"package-lock.json": true,
+	"yarn.lock":         true,
+	"pnpm-lock.yaml":    true,
+	"Cargo.lock":        true,
+	"poetry.lock":       true,
+}
+
+// EmbedFunc embeds each input with the index's model
+type EmbedFunc func(ctx context.Context, input []string) ([][]float32, error)
+
+// Index is the embedded chunks of a directory tree for one embedding
+// model. It is updated incrementally: only files whose content hash
+// changed are embedded again.
+type Index struct {
+	mu      sync.Mutex
+	queries *db.Queries
+	root    string
+	model   string
+	embed   EmbedFunc
+	updated time.Time // when Update last went through every file
+}
+
+// Result is a chunk that matched a query
+type Result struct {
+	Path      string // relative to the root, slash separated
+	StartLine int
+	EndLine   int
+	Score     float64 // cosine similarity to the query
+	Content   string
+}
+
+// New returns the index of root for model, stored with queries
+func New(queries *db.Queries, root, model string, embed EmbedFunc) (*Index, error) {
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve root: %w", err)
+	}
+	return &Index{queries: queries, root: absRoot, model: model, embed: embed}, nil
+}
+
+// Root returns the indexed directory
+func (ix *Index) Root() string {
+	return ix.root
+}
+
+// chunk is a range of lines of a file
+type chunk struct {
+	start, end int // 1-based, inclusive
+	text       string
+}
+
+// pendingFile is a file that changed since it was indexed
+type pendingFile struct {
+	path, hash string
+	chunks     []chunk
+}
+
+// Update embeds the files that are new or changed and drops deleted ones,
+// returning how many files were embedded. A file is stored only once all
+// its chunks are embedded, so a failed update is picked up by the next.
+func (ix *Index) Update(ctx context.Context) (int, error) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+
+	rows, err := ix.queries.ListCodeFiles(ctx, db.ListCodeFilesParams{Root: ix.root, Model: ix.model})
+	if err != nil {
+		return 0, fmt.Errorf("failed to list indexed files: %w", err)
+	}
+	stored := make(map[string]string, len(rows))
+	for _, row := range rows {
+		stored[row.Path] = row.FileHash
+	}
+
+	seen := make(map[string]bool)
+	var pending []pendingFile
+	err = filepath.WalkDir(ix.root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		if d.IsDir() {
+			if path != ix.root && skipDir(d.Name()) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() || skipFiles[d.Name()] {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil || info.Size() > maxFileSize {
+			return nil
+		}
+		content, err := os.ReadFile(path)
+		if err != nil || bytes.IndexByte(content, 0) >= 0 {
+			return nil
+		}
+
+		rel, err := filepath.Rel(ix.root, path)
+		if err != nil {
+			return nil
+		}
+		rel = filepath.ToSlash(rel)
+		sum := sha256.Sum256(content)
+		hash := hex.EncodeToString(sum[:])
+		if stored[rel] == hash {
+			seen[rel] = true
+			return nil
+		}
+		// Files left without chunks, such as emptied ones, count as deleted
+		if chunks := split(string(content)); len(chunks) > 0 {
+			seen[rel] = true
+			pending = append(pending, pendingFile{path: rel, hash: hash, chunks: chunks})
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	for path := range stored {
+		if !seen[path] {
+			if err := ix.deleteFile(ctx, path); err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	for i, file := range pending {
+		if err := ix.store(ctx, file); err != nil {
+			return i, err
+		}
+	}
+	ix.updated = time.Now()
+	return len(pending), nil
+}
+
+// store embeds a file's chunks and replaces the ones stored for it
+func (ix *Index) store(ctx context.Context, file pendingFile) error {
+	vectors := make([][]float32, 0, len(file.chunks))
+	for start := 0; start < len(file.chunks); start += embedBatch {
+		batch := file.chunks[start:min(start+embedBatch, len(file.chunks))]
+		input := make([]string, len(batch))
+		for i, c := range batch {
+			// The path often says as much about the code as the code itself
+			input[i] = file.path + "\n" + c.text
+		}
+		result, err := ix.embed(ctx, input)
+		if err != nil {
+			return fmt.Errorf("failed to embed %s: %w", file.path, err)
+		}
+		if len(result) != len(batch) {
+			return fmt.Errorf("failed to embed %s: got %d embeddings for %d chunks", file.path, len(result), len(batch))
+		}
+		vectors = append(vectors, result...)
+	}
+
+	if err := ix.deleteFile(ctx, file.path); err != nil {
+		return err
+	}
+	for i, c := range file.chunks {
+		err := ix.queries.CreateCodeChunk(ctx, db.CreateCodeChunkParams{
+			Root:      ix.root,
+			Model:     ix.model,
+			Path:      file.path,
+			StartLine: int64(c.start),
+			EndLine:   int64(c.end),
+			FileHash:  file.hash,
+			Vector:    embeddings.Encode(vectors[i]),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to save chunk of %s: %w", file.path, err)
+		}
+	}
+	return nil
+}
+
+func (ix *Index) deleteFile(ctx context.Context, path string) error {
+	err := ix.queries.DeleteCodeFile(ctx, db.DeleteCodeFileParams{Root: ix.root, Model: ix.model, Path: path})
+	if err != nil {
+		return fmt.Errorf("failed to delete chunks of %s: %w", path, err)
+	}
+	return nil
+}
+
+// Search returns up to limit chunks most similar to query, most similar
+// first, with their current content. The index is updated first unless
+// that was done in the last 30 seconds, so a burst of searches walks the
+// tree once.
+func (ix *Index) Search(ctx context.Context, query string, limit int) ([]Result, error) {
+	ix.mu.Lock()
+	fresh := !ix.updated.IsZero() && time.Since(ix.updated) < rescanInterval
+	ix.mu.Unlock()
+	if !fresh {
+		if _, err := ix.Update(ctx); err != nil {
+			return nil, err
+		}
+	}
+	queryVectors, err := ix.embed(ctx, []string{query})
+	if err != nil {
+		return nil, fmt.Errorf("failed to embed query: %w", err)
+	}
+	if len(queryVectors) == 0 {
+		return nil, fmt.Errorf("failed to embed query: no embedding returned")
+	}
+
+	rows, err := ix.queries.ListCodeChunks(ctx, db.ListCodeChunksParams{Root: ix.root, Model: ix.model})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list chunks: %w", err)
+	}
+	results := make([]Result, len(rows))
+	for i, row := range rows {
+		results[i] = Result{
+			Path:      row.Path,
+			StartLine: int(row.StartLine),
+			EndLine:   int(row.EndLine),
+			Score:     embeddings.Cosine(queryVectors[0], embeddings.Decode(row.Vector)),
+		}
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Score > results[j].Score
+	})
+
+	var found []Result
+	for _, result := range results {
+		if len(found) == limit {
+			break
+		}
+		content, err := os.ReadFile(filepath.Join(ix.root, filepath.FromSlash(result.Path)))
+		if err != nil {
+			continue
+		}
+		lines := strings.Split(string(content), "\n")
+		if result.StartLine > len(lines) {
+			continue
+		}
+		result.Content = strings.Join(lines[result.StartLine-1:min(result.EndLine, len(lines))], "\n")
+		found = append(found, result)
+	}
+	return found, nil
+}
+
+// split cuts content into chunks of whole lines, skipping blank ones
+func split(content string) []chunk {
+	lines := strings.Split(strings.TrimSuffix(content, "\n"), "\n")
+	var chunks []chunk
+	start, size := 0, 0
+	flush := func(end int) {
+		text := strings.Join(lines[start:end], "\n")
+		if strings.TrimSpace(text) != "" {
+			chunks = append(chunks, chunk{start: start + 1, end: end, text: text})
+		}
+		start, size = end, 0
+	}
+	for i, line := range lines {
+		if i > start && (i-start >= chunkLines || size+len(line) > chunkBytes) {
+			flush(i)
+		}
+		size += len(line) + 1
+	}
+	if start < len(lines) {
+		flush(len(lines))
+	}
+	for i := range chunks {
+		if len(chunks[i].text) > chunkBytes {
+			chunks[i].text = chunks[i].text[:chunkBytes]
+		}
+	}
+	return chunks
+}
+
+func skipDir(name string) bool {
+	if strings.HasPrefix(name, ".") {
+		return true
+	}
+	switch name {
+	case "node_modules", "vendor", "__pycache__", "target", "dist", "build":
+		return true
+	}
+	return false
+}
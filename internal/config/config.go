@@ -1,62 +1,498 @@
 package config
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
 
+	"github.com/omnitrix-sh/core.sh/internal/keyring"
+	"github.com/omnitrix-sh/core.sh/internal/modelinfo"
 	"github.com/omnitrix-sh/core.sh/pkg/models"
 )
 
-var globalConfig *models.Config
+// KeyringPrefix marks API keys kept in the system credential store, as in
+// "api_key": "keyring:openai"
+const KeyringPrefix = "keyring:"
 
+// EnvPrefix marks provider settings read from an environment variable, as
+// in "api_key": "env:OPENAI_API_KEY". ${VAR} references within a value are
+// expanded as well. Only the user's config can set the URLs and keys they
+// are expanded in, see projectSettings, so a project can't send the
+// environment to a server of its choosing.
+const EnvPrefix = "env:"
 
+// Load reads the configuration in layers, each overriding the settings it
+// has of the layers before it:
+//
+//  1. built-in defaults
+//  2. the user config in ~/.config/omnitrix, see UserPath
+//  3. the project's config, see ProjectPath
+//  4. environment variables, see EnvSettings
+//
+// Objects are merged key by key, so a layer only states what differs.
+// Tool selections and prompt fragments accumulate instead, so a project
+// adds to the user's setup. Every call reads the files again and returns
+// a config of its own.
 func Load(workDir string) (*models.Config, error) {
-	if globalConfig != nil {
-		return globalConfig, nil
+	return LoadWith(workDir, nil)
+}
+
+// LoadWith is Load with overrides applied over every layer, keyed like the
+// config file with dots between nested keys, as in
+// {"providers.ollama.base_url": "http://gpu-box:11434"}
+func LoadWith(workDir string, overrides map[string]interface{}) (*models.Config, error) {
+	merged, err := toSettings(defaultConfig())
+	if err != nil {
+		return nil, err
 	}
 
-	
-	cfg, err := loadFromFile(filepath.Join(workDir, ".omnitrix.json"))
-	if err == nil {
-		globalConfig = cfg
-		globalConfig.WorkDir = workDir
-		return globalConfig, nil
+	var dirs [][2]string
+	var projectCommands []string
+	if dir, err := userDir(); err == nil {
+		dirs = append(dirs, [2]string{dir, "config"})
+	}
+	dirs = append(dirs, [2]string{workDir, ".omnitrix"})
+	for _, dir := range dirs {
+		path, err := findFile(dir[0], dir[1])
+		if err != nil {
+			return nil, err
+		}
+		layer, err := readFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if dir[1] == ".omnitrix" {
+			projectLayer(layer)
+			if commands, ok := layer["commands"].(map[string]interface{}); ok {
+				for name := range commands {
+					projectCommands = append(projectCommands, name)
+				}
+			}
+		}
+		mergeLayer(merged, layer)
 	}
+	mergeLayer(merged, nest(EnvSettings()))
+	mergeLayer(merged, nest(overrides))
+
+	cfg, err := fromSettings(merged)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.DataDir != "" {
+		cfg.DataDir = expandHome(cfg.DataDir)
+	}
+	if cfg.Plugins.Dir != "" {
+		cfg.Plugins.Dir = expandHome(cfg.Plugins.Dir)
+	}
+	for _, name := range projectCommands {
+		if command, ok := cfg.Commands[name]; ok {
+			command.Project = true
+			cfg.Commands[name] = command
+		}
+	}
+	if err := resolveKeys(cfg); err != nil {
+		return nil, err
+	}
+
+	cfg.WorkDir = workDir
+	return cfg, nil
+}
+
+// allowed is a tree of settings keys. A nil subtree allows everything
+// below its key, and "*" stands for any key.
+type allowed map[string]allowed
+
+// projectSettings are the settings a project's config may set. The others
+// only the user's config can set: those that run programs, such as
+// plugins, formatters and language servers, those deciding what runs
+// without asking, such as permissions and the exec sandbox, and those
+// sending requests elsewhere, such as provider URLs and keys. So opening a
+// cloned repository never runs its binaries or loosens the user's policy.
+var projectSettings = allowed{
+	"default_model":    nil,
+	"default_provider": nil,
+	"providers": {"*": {
+		"enabled":    nil,
+		"models":     nil,
+		"options":    nil,
+		"keep_alive": nil,
+	}},
+	"aliases":          nil,
+	"model_params":     nil,
+	"models":           nil,
+	"system_prompt":    nil,
+	"prompt_fragments": nil,
+	"context_paths":    nil,
+	"repo_map":         nil,
+	"context_overflow": nil,
+	"tool_schemas":     nil,
+	"language":         nil,
+	"mode":             nil,
+	"prompts":          nil,
+	"message_limits":   nil,
+	"commands":         nil, // never run unasked, see tools.CommandTool
+	"tools": {
+		"enabled":  nil,
+		"disabled": nil,
+		"ignore":   nil,
+	},
+	"secrets": {
+		"allow":    nil,
+		"patterns": nil,
+	},
+}
+
+// projectLayer drops the settings of a project's layer that are not in
+// projectSettings, and context paths outside the project
+func projectLayer(layer map[string]interface{}) {
+	filterLayer(layer, projectSettings)
+	if paths, ok := layer["context_paths"].([]interface{}); ok {
+		var inside []interface{}
+		for _, path := range paths {
+			if p, ok := path.(string); ok && filepath.IsLocal(p) {
+				inside = append(inside, p)
+			}
+		}
+		layer["context_paths"] = inside
+	}
+}
+
+func filterLayer(layer map[string]interface{}, allow allowed) {
+	for key, value := range layer {
+		below, ok := allow[key]
+		if !ok {
+			below, ok = allow["*"]
+		}
+		if !ok {
+			delete(layer, key)
+			continue
+		}
+		if below == nil {
+			continue
+		}
+		if section, isSection := value.(map[string]interface{}); isSection {
+			filterLayer(section, below)
+		} else {
+			delete(layer, key)
+		}
+	}
+}
+
+// Loader keeps the config of one project for processes that outlive a
+// config change, such as servers, and reloads it when asked. It is safe
+// for concurrent use.
+type Loader struct {
+	workDir   string
+	overrides map[string]interface{}
 
+	mu  sync.RWMutex
+	cfg *models.Config
+}
+
+// NewLoader loads the config of the project in workDir, see LoadWith
+func NewLoader(workDir string, overrides map[string]interface{}) (*Loader, error) {
+	l := &Loader{workDir: workDir, overrides: overrides}
+	if _, err := l.Reload(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// Config returns the config last loaded. Reloading replaces it rather than
+// changing it, so callers can keep using the one they have.
+func (l *Loader) Config() *models.Config {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.cfg
+}
+
+// Reload reads the config files again and returns the new config. If they
+// can't be read, the config loaded before stays.
+func (l *Loader) Reload() (*models.Config, error) {
+	cfg, err := LoadWith(l.workDir, l.overrides)
+	if err != nil {
+		return nil, err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.cfg = cfg
+	return cfg, nil
+}
+
+// envSettings maps environment variables to the settings they set
+var envSettings = map[string]string{
+	"OMNITRIX_DATA_DIR": "data_dir",
+	"OMNITRIX_PROVIDER": "default_provider",
+	"OMNITRIX_MODEL":    "default_model",
+	"OMNITRIX_LANGUAGE": "language",
+	"OMNITRIX_MODE":     "mode",
+}
+
+// EnvSettings returns the settings of the environment layer: data_dir,
+// default_provider, default_model, language and mode from
+// OMNITRIX_DATA_DIR, OMNITRIX_PROVIDER, OMNITRIX_MODEL, OMNITRIX_LANGUAGE
+// and OMNITRIX_MODE. Empty variables are ignored.
+func EnvSettings() map[string]interface{} {
+	settings := make(map[string]interface{})
+	for name, key := range envSettings {
+		if value := os.Getenv(name); value != "" {
+			settings[key] = value
+		}
+	}
+	return settings
+}
+
+// UserPath returns the path of the user config file: config.json,
+// config.yaml, config.yml or config.toml in ~/.config/omnitrix, whichever
+// exists, or config.json
+func UserPath() (string, error) {
+	dir, err := userDir()
+	if err != nil {
+		return "", err
+	}
+	path, _ := findFile(dir, "config")
+	return path, nil
+}
+
+func userDir() (string, error) {
 	homeDir, err := os.UserHomeDir()
-	if err == nil {
-		cfg, err = loadFromFile(filepath.Join(homeDir, ".config", "omnitrix", "config.json"))
-		if err == nil {
-			globalConfig = cfg
-			globalConfig.WorkDir = workDir
-			return globalConfig, nil
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(homeDir, ".config", "omnitrix"), nil
+}
+
+// ProjectPath returns the path of the config file of the project in
+// workDir, .omnitrix.json, .omnitrix.yaml, .omnitrix.yml or .omnitrix.toml,
+// as UserPath does
+func ProjectPath(workDir string) string {
+	path, _ := findFile(workDir, ".omnitrix")
+	return path
+}
+
+// SaveUser sets top-level settings in the user config file, keeping the
+// others, and returns its path
+func SaveUser(settings map[string]interface{}) (string, error) {
+	f, err := OpenUser()
+	if err != nil {
+		return "", err
+	}
+	return f.Path(), save(f, settings)
+}
+
+// SaveProject is SaveUser for the config file of the project in workDir
+func SaveProject(workDir string, settings map[string]interface{}) (string, error) {
+	f, err := OpenProject(workDir)
+	if err != nil {
+		return "", err
+	}
+	return f.Path(), save(f, settings)
+}
+
+// save sets top-level settings in a config file and writes it
+func save(f *File, settings map[string]interface{}) error {
+	if err := f.setAll(settings); err != nil {
+		return err
+	}
+	return f.Save()
+}
+
+// resolveKeys replaces API keys kept in the credential store with the keys,
+// and references to environment variables in API keys and base URLs with
+// their values, see EnvPrefix. Disabled providers are left as they are,
+// so their variables need not be set.
+func resolveKeys(cfg *models.Config) error {
+	for provider, pc := range cfg.Providers {
+		if !pc.Enabled {
+			continue
+		}
+		var err error
+		if pc.BaseURL, err = expandEnv(pc.BaseURL); err != nil {
+			return fmt.Errorf("invalid %s base URL: %w", provider, err)
+		}
+		if name, ok := strings.CutPrefix(pc.APIKey, KeyringPrefix); ok {
+			pc.APIKey, err = keyring.Get(context.Background(), name)
+			if err != nil {
+				return fmt.Errorf("failed to read the %s API key from the keyring: %w", provider, err)
+			}
+		} else if pc.APIKey, err = expandEnv(pc.APIKey); err != nil {
+			return fmt.Errorf("invalid %s API key: %w", provider, err)
 		}
+		cfg.Providers[provider] = pc
 	}
+	return nil
+}
 
-	
-	globalConfig = defaultConfig()
-	globalConfig.WorkDir = workDir
-	return globalConfig, nil
+// expandEnv resolves a value that is an env: reference or contains ${VAR}
+// references. Unset variables are an error rather than an empty value, so
+// a missing key is reported where it is configured. $ not followed by {
+// is kept, since keys may contain one.
+func expandEnv(value string) (string, error) {
+	if name, ok := strings.CutPrefix(value, EnvPrefix); ok {
+		return lookupEnv(name)
+	}
+
+	var b strings.Builder
+	for {
+		start := strings.Index(value, "${")
+		if start < 0 {
+			break
+		}
+		end := strings.IndexByte(value[start:], '}')
+		if end < 0 {
+			return "", fmt.Errorf("unterminated ${")
+		}
+		v, err := lookupEnv(value[start+2 : start+end])
+		if err != nil {
+			return "", err
+		}
+		b.WriteString(value[:start])
+		b.WriteString(v)
+		value = value[start+end+1:]
+	}
+	b.WriteString(value)
+	return b.String(), nil
+}
+
+func lookupEnv(name string) (string, error) {
+	if name == "" {
+		return "", fmt.Errorf("empty environment variable name")
+	}
+	v, ok := os.LookupEnv(name)
+	if !ok {
+		return "", fmt.Errorf("environment variable %s is not set", name)
+	}
+	return v, nil
 }
 
-func loadFromFile(path string) (*models.Config, error) {
+// readFile decodes a config file into settings. A missing file has none.
+func readFile(path string) (map[string]interface{}, error) {
 	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config %s: %w", path, err)
+	}
+	settings, err := decodeFile(path, data)
 	if err != nil {
+		return nil, fmt.Errorf("failed to parse config %s: %w", path, err)
+	}
+	return settings, nil
+}
+
+// decodeSettings decodes a JSON object, keeping numbers as written so
+// they survive encoding again
+func decodeSettings(data []byte) (map[string]interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var settings map[string]interface{}
+	if err := decoder.Decode(&settings); err != nil {
 		return nil, err
 	}
+	return settings, nil
+}
+
+// toSettings converts a config to the settings of a layer
+func toSettings(cfg *models.Config) (map[string]interface{}, error) {
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode config: %w", err)
+	}
+	return decodeSettings(data)
+}
 
+// fromSettings converts merged settings to a config
+func fromSettings(settings map[string]interface{}) (*models.Config, error) {
+	data, err := json.Marshal(settings)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode config: %w", err)
+	}
 	var cfg models.Config
 	if err := json.Unmarshal(data, &cfg); err != nil {
-		return nil, fmt.Errorf("failed to parse config: %w", err)
+		return nil, fmt.Errorf("invalid config: %w", err)
 	}
+	return &cfg, nil
+}
 
-	if cfg.DataDir != "" {
-		cfg.DataDir = expandHome(cfg.DataDir)
+// mergeLayer overlays a layer's settings onto merged. A layer enabling a
+// tool overrides an earlier layer disabling it, and the other way round;
+// prompt fragments are appended.
+func mergeLayer(merged, layer map[string]interface{}) {
+	if len(layer) == 0 {
+		return
 	}
+	layer = merge(map[string]interface{}{}, layer) // not to change the caller's
 
-	return &cfg, nil
+	if fragments, ok := layer["prompt_fragments"].([]interface{}); ok {
+		current, _ := merged["prompt_fragments"].([]interface{})
+		layer["prompt_fragments"] = append(append([]interface{}{}, current...), fragments...)
+	}
+	if tools, ok := layer["tools"].(map[string]interface{}); ok {
+		current, _ := merged["tools"].(map[string]interface{})
+		enabled, disabled := stringList(current["enabled"]), stringList(current["disabled"])
+		layerEnabled, layerDisabled := stringList(tools["enabled"]), stringList(tools["disabled"])
+		tools["enabled"] = union(without(enabled, layerDisabled), layerEnabled)
+		tools["disabled"] = union(without(disabled, layerEnabled), layerDisabled)
+	}
+	merge(merged, layer)
+}
+
+// merge copies src into dst, merging objects key by key; other values
+// replace what dst has. It returns dst.
+func merge(dst, src map[string]interface{}) map[string]interface{} {
+	for key, value := range src {
+		if object, ok := value.(map[string]interface{}); ok {
+			current, ok := dst[key].(map[string]interface{})
+			if !ok {
+				current = make(map[string]interface{})
+			}
+			dst[key] = merge(current, object)
+			continue
+		}
+		dst[key] = value
+	}
+	return dst
+}
+
+// stringList returns the strings of a decoded JSON array, or of a list
+// merged by an earlier layer
+func stringList(value interface{}) []string {
+	if list, ok := value.([]string); ok {
+		return list
+	}
+	items, _ := value.([]interface{})
+	var list []string
+	for _, item := range items {
+		if s, ok := item.(string); ok {
+			list = append(list, s)
+		}
+	}
+	return list
+}
+
+// nest turns dotted keys into nested objects
+func nest(flat map[string]interface{}) map[string]interface{} {
+	nested := make(map[string]interface{})
+	for key, value := range flat {
+		parts := strings.Split(key, ".")
+		object := nested
+		for _, part := range parts[:len(parts)-1] {
+			child, ok := object[part].(map[string]interface{})
+			if !ok {
+				child = make(map[string]interface{})
+				object[part] = child
+			}
+			object = child
+		}
+		object[parts[len(parts)-1]] = value
+	}
+	return nested
 }
 
 func defaultConfig() *models.Config {
@@ -78,9 +514,41 @@ func defaultConfig() *models.Config {
 			".github/copilot-instructions.md",
 			"omnitrix.md",
 		},
-		LSP:   make(map[string]models.LSPConfig),
-		Debug: false,
+		LSP:         make(map[string]models.LSPConfig),
+		Checkpoints: models.CheckpointConfig{Enabled: true},
+		Plugins:     models.PluginsConfig{Dir: filepath.Join(homeDir, ".config", "omnitrix", "plugins")},
+		Debug:       false,
+	}
+}
+
+// union returns a followed by the items of b not already in a
+func union(a, b []string) []string {
+	for _, item := range b {
+		if !contains(a, item) {
+			a = append(a, item)
+		}
+	}
+	return a
+}
+
+// without returns the items of list that are not in remove
+func without(list, remove []string) []string {
+	var result []string
+	for _, item := range list {
+		if !contains(remove, item) {
+			result = append(result, item)
+		}
+	}
+	return result
+}
+
+func contains(list []string, item string) bool {
+	for _, v := range list {
+		if v == item {
+			return true
+		}
 	}
+	return false
 }
 
 func expandHome(path string) string {
@@ -93,7 +561,44 @@ func expandHome(path string) string {
 	return path
 }
 
+// SamplingParamsFor returns the configured sampling defaults for a model,
+// falling back to the "*" entry when the model has none of its own.
+func SamplingParamsFor(cfg *models.Config, model string) models.SamplingParams {
+	if cfg == nil {
+		return models.SamplingParams{}
+	}
+	if params, ok := cfg.ModelParams[model]; ok {
+		return params
+	}
+	return cfg.ModelParams["*"]
+}
 
-func Get() *models.Config {
-	return globalConfig
+// ModelProfileFor returns what is known about a model: its built-in
+// profile, with model_params and then the "*" and model's own entries of
+// Config.Models layered over it, each setting only the fields it has.
+func ModelProfileFor(cfg *models.Config, model string) models.ModelProfile {
+	var overrides map[string]models.ModelProfile
+	if cfg != nil {
+		overrides = cfg.Models
+	}
+	profile, _ := modelinfo.NewCatalog(overrides).Lookup(model)
+	// The built-in profiles set no sampling defaults, so model_params can
+	// go under the result
+	params := models.ModelProfile{SamplingParams: SamplingParamsFor(cfg, model)}
+	return modelinfo.Merge(params, profile)
+}
+
+// Prices returns the model prices overriding the built-in ones: those of
+// Config.Models, and Config.Pricing over them
+func Prices(cfg *models.Config) map[string]models.ModelPrice {
+	prices := make(map[string]models.ModelPrice)
+	for name, profile := range cfg.Models {
+		if profile.Price != nil && name != "*" {
+			prices[name] = *profile.Price
+		}
+	}
+	for name, price := range cfg.Pricing {
+		prices[name] = price
+	}
+	return prices
 }
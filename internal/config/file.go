@@ -0,0 +1,334 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/omnitrix-sh/core.sh/pkg/models"
+	"gopkg.in/yaml.v3"
+)
+
+// File is a config file being changed, for settings screens and commands
+// that write the config. Settings keep their order and what isn't changed
+// is written back as it was, comments in YAML files included, so saving
+// only changes what was set. Nothing is written until Save. TOML files
+// can't be changed, since their comments would be lost.
+type File struct {
+	path string
+	perm os.FileMode
+	doc  document
+}
+
+// OpenUser opens the user config file, which need not exist yet
+func OpenUser() (*File, error) {
+	dir, err := userDir()
+	if err != nil {
+		return nil, err
+	}
+	path, err := findFile(dir, "config")
+	if err != nil {
+		return nil, err
+	}
+	// It may hold API keys that aren't in the keyring
+	return openFile(path, 0o600)
+}
+
+// OpenProject opens the config file of the project in workDir, which need
+// not exist yet
+func OpenProject(workDir string) (*File, error) {
+	path, err := findFile(workDir, ".omnitrix")
+	if err != nil {
+		return nil, err
+	}
+	return openFile(path, 0o644)
+}
+
+func openFile(path string, perm os.FileMode) (*File, error) {
+	ext := filepath.Ext(path)
+	if ext == ".toml" {
+		return nil, fmt.Errorf("%s is TOML, which can't be changed without losing its comments; change it by hand", path)
+	}
+	f := &File{path: path, perm: perm, doc: &jsonDocument{root: &object{}}}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		if ext == ".yaml" || ext == ".yml" {
+			f.doc = &yamlDocument{root: &yaml.Node{Kind: yaml.MappingNode}}
+		}
+		return f, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config %s: %w", path, err)
+	}
+
+	if ext == ".yaml" || ext == ".yml" {
+		doc, err := parseYAML(data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse config %s: %w", path, err)
+		}
+		f.doc = doc
+		return f, nil
+	}
+	value, err := parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse config %s: %w", path, err)
+	}
+	root, ok := value.(*object)
+	if !ok {
+		return nil, fmt.Errorf("failed to parse config %s: not a JSON object", path)
+	}
+	f.doc = &jsonDocument{root: root}
+	return f, nil
+}
+
+// Path returns where the file is saved
+func (f *File) Path() string {
+	return f.path
+}
+
+// Set sets a setting, given with dots between nested keys as in
+// "providers.ollama.base_url", to value encoded as JSON. Objects on the
+// way are created as needed.
+func (f *File) Set(key string, value interface{}) error {
+	parsed, err := toValue(key, value)
+	if err != nil {
+		return err
+	}
+	if err := f.doc.set(strings.Split(key, "."), parsed); err != nil {
+		return fmt.Errorf("cannot set %s: %w", key, err)
+	}
+	return nil
+}
+
+// Unset removes a setting, so it falls back to the layers below
+func (f *File) Unset(key string) {
+	f.doc.unset(strings.Split(key, "."))
+}
+
+// SetDefaultModel makes model of provider the one used unless a command
+// asks for another
+func (f *File) SetDefaultModel(provider models.ProviderType, model string) error {
+	if err := f.Set("default_provider", string(provider)); err != nil {
+		return err
+	}
+	return f.Set("default_model", model)
+}
+
+// EnableProvider turns a provider on or off. Its other settings stay.
+func (f *File) EnableProvider(provider models.ProviderType, enabled bool) error {
+	return f.Set("providers."+string(provider)+".enabled", enabled)
+}
+
+// AddCommand adds a tool running a shell command, replacing the one of
+// the same name
+func (f *File) AddCommand(name string, tool models.CommandToolConfig) error {
+	return f.Set("commands."+name, tool)
+}
+
+// AddLSPServer adds a language server, replacing the one of the same name
+func (f *File) AddLSPServer(name string, server models.LSPConfig) error {
+	return f.Set("lsp."+name, server)
+}
+
+// Save writes the file, creating it and its directory if needed. The
+// result must still be a valid config, so a mistyped setting is reported
+// here rather than the next time the config is loaded.
+func (f *File) Save() error {
+	data, err := f.doc.encode()
+	if err != nil {
+		return fmt.Errorf("failed to encode config: %w", err)
+	}
+	settings, err := decodeFile(f.path, data)
+	if err != nil {
+		return fmt.Errorf("invalid config: %w", err)
+	}
+	if _, err := fromSettings(settings); err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(f.path), 0o755); err != nil {
+		return fmt.Errorf("failed to create config directory: %w", err)
+	}
+	if err := os.WriteFile(f.path, data, f.perm); err != nil {
+		return fmt.Errorf("failed to write config %s: %w", f.path, err)
+	}
+	return nil
+}
+
+// object is a JSON object that keeps the order of its keys. Values are
+// *object, []interface{}, string, json.Number, bool or nil.
+type object struct {
+	keys   []string
+	values map[string]interface{}
+}
+
+func (o *object) get(key string) (interface{}, bool) {
+	value, ok := o.values[key]
+	return value, ok
+}
+
+func (o *object) set(key string, value interface{}) {
+	if o.values == nil {
+		o.values = make(map[string]interface{})
+	}
+	if _, ok := o.values[key]; !ok {
+		o.keys = append(o.keys, key)
+	}
+	o.values[key] = value
+}
+
+func (o *object) remove(key string) {
+	if _, ok := o.values[key]; !ok {
+		return
+	}
+	delete(o.values, key)
+	for i, k := range o.keys {
+		if k == key {
+			o.keys = append(o.keys[:i], o.keys[i+1:]...)
+			break
+		}
+	}
+}
+
+// parse decodes JSON, keeping the key order of objects
+func parse(data []byte) (interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	value, err := parseValue(decoder)
+	if err != nil {
+		return nil, err
+	}
+	if decoder.More() {
+		return nil, fmt.Errorf("unexpected data after the top-level value")
+	}
+	return value, nil
+}
+
+func parseValue(decoder *json.Decoder) (interface{}, error) {
+	token, err := decoder.Token()
+	if err != nil {
+		return nil, err
+	}
+	delim, ok := token.(json.Delim)
+	if !ok {
+		return token, nil
+	}
+
+	switch delim {
+	case '{':
+		obj := &object{}
+		for decoder.More() {
+			token, err := decoder.Token()
+			if err != nil {
+				return nil, err
+			}
+			key, _ := token.(string)
+			value, err := parseValue(decoder)
+			if err != nil {
+				return nil, err
+			}
+			obj.set(key, value)
+		}
+		_, err := decoder.Token() // }
+		return obj, err
+	case '[':
+		list := []interface{}{}
+		for decoder.More() {
+			value, err := parseValue(decoder)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, value)
+		}
+		_, err := decoder.Token() // ]
+		return list, err
+	}
+	return nil, fmt.Errorf("unexpected %v", delim)
+}
+
+// write encodes a parsed value indented by two spaces, as
+// json.MarshalIndent does
+func write(buf *bytes.Buffer, value interface{}, indent string) error {
+	switch v := value.(type) {
+	case *object:
+		if len(v.keys) == 0 {
+			buf.WriteString("{}")
+			return nil
+		}
+		buf.WriteString("{\n")
+		for i, key := range v.keys {
+			name, _ := json.Marshal(key)
+			buf.WriteString(indent + "  ")
+			buf.Write(name)
+			buf.WriteString(": ")
+			if err := write(buf, v.values[key], indent+"  "); err != nil {
+				return err
+			}
+			if i < len(v.keys)-1 {
+				buf.WriteByte(',')
+			}
+			buf.WriteByte('\n')
+		}
+		buf.WriteString(indent + "}")
+	case []interface{}:
+		if len(v) == 0 {
+			buf.WriteString("[]")
+			return nil
+		}
+		buf.WriteString("[\n")
+		for i, item := range v {
+			buf.WriteString(indent + "  ")
+			if err := write(buf, item, indent+"  "); err != nil {
+				return err
+			}
+			if i < len(v)-1 {
+				buf.WriteByte(',')
+			}
+			buf.WriteByte('\n')
+		}
+		buf.WriteString(indent + "]")
+	default:
+		data, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		buf.Write(data)
+	}
+	return nil
+}
+
+// setAll sets top-level settings, new ones in the order of their names
+func (f *File) setAll(settings map[string]interface{}) error {
+	keys := make([]string, 0, len(settings))
+	for key := range settings {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		value, err := toValue(key, settings[key])
+		if err != nil {
+			return err
+		}
+		if err := f.doc.set([]string{key}, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// toValue converts the value of a setting to what parse returns
+func toValue(key string, value interface{}) (interface{}, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode %s: %w", key, err)
+	}
+	parsed, err := parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode %s: %w", key, err)
+	}
+	return parsed, nil
+}
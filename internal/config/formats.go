@@ -0,0 +1,259 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// extensions are the config file formats, in the order they are looked for
+var extensions = []string{".json", ".yaml", ".yml", ".toml"}
+
+// findFile returns the config file named name in dir, whichever format it
+// is in, or the JSON one if there is none. A directory may only have one.
+func findFile(dir, name string) (string, error) {
+	var found []string
+	for _, ext := range extensions {
+		path := filepath.Join(dir, name+ext)
+		if _, err := os.Stat(path); err == nil {
+			found = append(found, path)
+		}
+	}
+	switch len(found) {
+	case 0:
+		return filepath.Join(dir, name+".json"), nil
+	case 1:
+		return found[0], nil
+	}
+	return found[0], fmt.Errorf("found config files %s; keep only one", strings.Join(found, " and "))
+}
+
+// decodeFile decodes a config file in the format its extension names
+func decodeFile(path string, data []byte) (map[string]interface{}, error) {
+	var value interface{}
+	switch filepath.Ext(path) {
+	case ".yaml", ".yml":
+		if err := yaml.Unmarshal(data, &value); err != nil {
+			return nil, err
+		}
+	case ".toml":
+		var table map[string]interface{}
+		if err := toml.Unmarshal(data, &table); err != nil {
+			return nil, err
+		}
+		value = table
+	default:
+		return decodeSettings(data)
+	}
+	if value == nil {
+		// An empty or all-comment file sets nothing
+		return map[string]interface{}{}, nil
+	}
+
+	// Through JSON, so every format ends up as decodeSettings returns it
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, fmt.Errorf("not a valid config: %w", err)
+	}
+	settings, err := decodeSettings(data)
+	if err != nil {
+		return nil, fmt.Errorf("not a valid config: %w", err)
+	}
+	return settings, nil
+}
+
+// document is the content of a config file being changed, see File
+type document interface {
+	set(path []string, value interface{}) error
+	unset(path []string)
+	encode() ([]byte, error)
+}
+
+// jsonDocument is a JSON config file
+type jsonDocument struct {
+	root *object
+}
+
+func (d *jsonDocument) set(path []string, value interface{}) error {
+	obj := d.root
+	for i, part := range path[:len(path)-1] {
+		child, ok := obj.get(part)
+		if !ok || child == nil {
+			child = &object{}
+			obj.set(part, child)
+		}
+		next, ok := child.(*object)
+		if !ok {
+			return fmt.Errorf("%s is not an object", strings.Join(path[:i+1], "."))
+		}
+		obj = next
+	}
+	obj.set(path[len(path)-1], value)
+	return nil
+}
+
+func (d *jsonDocument) unset(path []string) {
+	obj := d.root
+	for _, part := range path[:len(path)-1] {
+		child, _ := obj.get(part)
+		next, ok := child.(*object)
+		if !ok {
+			return
+		}
+		obj = next
+	}
+	obj.remove(path[len(path)-1])
+}
+
+func (d *jsonDocument) encode() ([]byte, error) {
+	var buf bytes.Buffer
+	if err := write(&buf, d.root, ""); err != nil {
+		return nil, err
+	}
+	buf.WriteByte('\n')
+	return buf.Bytes(), nil
+}
+
+// yamlDocument is a YAML config file. Changes are made to its nodes, so
+// comments and formatting of the rest are kept.
+type yamlDocument struct {
+	root *yaml.Node // a mapping
+	doc  *yaml.Node // the document holding root, nil for new files
+}
+
+func parseYAML(data []byte) (*yamlDocument, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	if len(doc.Content) == 0 {
+		return &yamlDocument{root: &yaml.Node{Kind: yaml.MappingNode}}, nil
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("not a YAML mapping")
+	}
+	return &yamlDocument{root: root, doc: &doc}, nil
+}
+
+// field returns the value node of key in mapping, or nil
+func field(mapping *yaml.Node, key string) *yaml.Node {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			return mapping.Content[i+1]
+		}
+	}
+	return nil
+}
+
+func (d *yamlDocument) set(path []string, value interface{}) error {
+	node, err := yamlNode(value)
+	if err != nil {
+		return err
+	}
+	mapping := d.root
+	for i, part := range path {
+		child := field(mapping, part)
+		last := i == len(path)-1
+		switch {
+		case child != nil && last:
+			// Keep the comments written next to the old value
+			node.HeadComment, node.LineComment, node.FootComment = child.HeadComment, child.LineComment, child.FootComment
+			*child = *node
+			return nil
+		case child == nil && last:
+			mapping.Content = append(mapping.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: part}, node)
+			return nil
+		case child == nil || (child.Kind == yaml.ScalarNode && child.Tag == "!!null"):
+			next := &yaml.Node{Kind: yaml.MappingNode}
+			if child == nil {
+				mapping.Content = append(mapping.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: part}, next)
+			} else {
+				*child = *next
+				next = child
+			}
+			mapping = next
+		case child.Kind == yaml.MappingNode:
+			mapping = child
+		default:
+			return fmt.Errorf("%s is not an object", strings.Join(path[:i+1], "."))
+		}
+	}
+	return nil
+}
+
+func (d *yamlDocument) unset(path []string) {
+	mapping := d.root
+	for _, part := range path[:len(path)-1] {
+		child := field(mapping, part)
+		if child == nil || child.Kind != yaml.MappingNode {
+			return
+		}
+		mapping = child
+	}
+	key := path[len(path)-1]
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			mapping.Content = append(mapping.Content[:i], mapping.Content[i+2:]...)
+			return
+		}
+	}
+}
+
+func (d *yamlDocument) encode() ([]byte, error) {
+	var node interface{} = d.root
+	if d.doc != nil {
+		node = d.doc
+	}
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(node); err != nil {
+		return nil, err
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// yamlNode converts a value as parse returns it to a YAML node. Keys keep
+// their order.
+func yamlNode(value interface{}) (*yaml.Node, error) {
+	switch v := value.(type) {
+	case *object:
+		node := &yaml.Node{Kind: yaml.MappingNode}
+		for _, key := range v.keys {
+			child, err := yamlNode(v.values[key])
+			if err != nil {
+				return nil, err
+			}
+			node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: key}, child)
+		}
+		return node, nil
+	case []interface{}:
+		node := &yaml.Node{Kind: yaml.SequenceNode}
+		for _, item := range v {
+			child, err := yamlNode(item)
+			if err != nil {
+				return nil, err
+			}
+			node.Content = append(node.Content, child)
+		}
+		return node, nil
+	case json.Number:
+		// Untagged, so it reads as an integer or float as written
+		return &yaml.Node{Kind: yaml.ScalarNode, Value: v.String()}, nil
+	}
+	var node yaml.Node
+	if err := node.Encode(value); err != nil {
+		return nil, err
+	}
+	return &node, nil
+}
@@ -0,0 +1,108 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/omnitrix-sh/core.sh/pkg/models"
+)
+
+// watchDelay is how long the config files must stay unchanged before they
+// are reloaded, so an editor saving in several steps causes one reload
+const watchDelay = 250 * time.Millisecond
+
+// Watch reloads the config whenever the user or project config file is
+// created, changed or removed, and calls onChange with the new config, or
+// the error that kept it from loading, until ctx is done. The directories
+// are watched rather than the files, so files that don't exist yet and
+// editors that save by replacing the file are both noticed.
+func (l *Loader) Watch(ctx context.Context, onChange func(*models.Config, error)) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("failed to watch the config: %w", err)
+	}
+
+	names := make(map[string]bool)
+	dirs := []string{l.workDir}
+	if dir, err := userDir(); err == nil {
+		dirs = append(dirs, dir)
+	}
+	for _, dir := range dirs {
+		// The user config directory need not exist
+		if _, err := os.Stat(dir); err != nil {
+			continue
+		}
+		if err := watcher.Add(dir); err != nil {
+			watcher.Close()
+			return fmt.Errorf("failed to watch %s: %w", dir, err)
+		}
+		name := "config"
+		if dir == l.workDir {
+			name = ".omnitrix"
+		}
+		for _, ext := range extensions {
+			names[filepath.Join(dir, name+ext)] = true
+		}
+	}
+
+	go func() {
+		defer watcher.Close()
+		timer := time.NewTimer(watchDelay)
+		timer.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if names[filepath.Clean(event.Name)] && event.Op != fsnotify.Chmod {
+					timer.Reset(watchDelay)
+				}
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				onChange(nil, fmt.Errorf("failed to watch the config: %w", err))
+			case <-timer.C:
+				cfg, err := l.Reload()
+				onChange(cfg, err)
+			}
+		}
+	}()
+	return nil
+}
+
+// Changed returns the top-level settings that differ between two configs,
+// sorted by name
+func Changed(prev, next *models.Config) []string {
+	before, err := toSettings(prev)
+	if err != nil {
+		return nil
+	}
+	after, err := toSettings(next)
+	if err != nil {
+		return nil
+	}
+	var changed []string
+	for key, value := range after {
+		if !reflect.DeepEqual(before[key], value) {
+			changed = append(changed, key)
+		}
+	}
+	for key := range before {
+		if _, ok := after[key]; !ok {
+			changed = append(changed, key)
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
@@ -0,0 +1,116 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.27.0
+// source: checkpoints.sql
+
+package db
+
+import (
+	"context"
+	"database/sql"
+)
+
+const createCheckpoint = `-- name: CreateCheckpoint :exec
+INSERT INTO checkpoints (id, session_id, message_id, commit_hash, label, created_at)
+VALUES (?, ?, ?, ?, ?, ?)
+`
+
+type CreateCheckpointParams struct {
+	ID         string         `json:"id"`
+	SessionID  string         `json:"session_id"`
+	MessageID  sql.NullString `json:"message_id"`
+	CommitHash string         `json:"commit_hash"`
+	Label      string         `json:"label"`
+	CreatedAt  int64          `json:"created_at"`
+}
+
+func (q *Queries) CreateCheckpoint(ctx context.Context, arg CreateCheckpointParams) error {
+	_, err := q.db.ExecContext(ctx, createCheckpoint,
+		arg.ID,
+		arg.SessionID,
+		arg.MessageID,
+		arg.CommitHash,
+		arg.Label,
+		arg.CreatedAt,
+	)
+	return err
+}
+
+const deleteCheckpointsOverLimit = `-- name: DeleteCheckpointsOverLimit :execrows
+DELETE FROM checkpoints
+WHERE rowid IN (
+    SELECT rowid FROM checkpoints
+    WHERE session_id = CAST(?1 AS TEXT)
+    ORDER BY created_at DESC, rowid DESC
+    LIMIT -1 OFFSET CAST(?2 AS INTEGER)
+)
+`
+
+type DeleteCheckpointsOverLimitParams struct {
+	SessionID string `json:"session_id"`
+	Keep      int64  `json:"keep"`
+}
+
+// Keeps the session's newest checkpoints, deleting everything past the
+// first keep
+func (q *Queries) DeleteCheckpointsOverLimit(ctx context.Context, arg DeleteCheckpointsOverLimitParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteCheckpointsOverLimit, arg.SessionID, arg.Keep)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const getCheckpoint = `-- name: GetCheckpoint :one
+SELECT id, session_id, message_id, commit_hash, label, created_at FROM checkpoints WHERE id = ?
+`
+
+func (q *Queries) GetCheckpoint(ctx context.Context, id string) (Checkpoint, error) {
+	row := q.db.QueryRowContext(ctx, getCheckpoint, id)
+	var i Checkpoint
+	err := row.Scan(
+		&i.ID,
+		&i.SessionID,
+		&i.MessageID,
+		&i.CommitHash,
+		&i.Label,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const listCheckpointsBySession = `-- name: ListCheckpointsBySession :many
+SELECT id, session_id, message_id, commit_hash, label, created_at FROM checkpoints
+WHERE session_id = ?
+ORDER BY created_at DESC, rowid DESC
+`
+
+func (q *Queries) ListCheckpointsBySession(ctx context.Context, sessionID string) ([]Checkpoint, error) {
+	rows, err := q.db.QueryContext(ctx, listCheckpointsBySession, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []Checkpoint{}
+	for rows.Next() {
+		var i Checkpoint
+		if err := rows.Scan(
+			&i.ID,
+			&i.SessionID,
+			&i.MessageID,
+			&i.CommitHash,
+			&i.Label,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
@@ -43,7 +43,40 @@ func Connect(dataDir string) (*sql.DB, error) {
 	if err := runMigrations(db); err != nil {
 		return nil, fmt.Errorf("failed to run migrations: %w", err)
 	}
+	if err := setupSearch(db); err != nil {
+		return nil, err
+	}
+
+	return db, nil
+}
 
+// readerConns is the size of the read-only connection pool
+const readerConns = 4
+
+// ConnectReadOnly opens a pool of query-only connections to the database
+// for search and reporting, so long reads run alongside the agent's writes
+// instead of queueing behind them. WAL mode lets readers proceed while a
+// write is in progress. The database must already have been created and
+// migrated by Connect.
+func ConnectReadOnly(dataDir string) (*sql.DB, error) {
+	dbPath := filepath.Join(dataDir, "omnitrix.db")
+	if _, err := os.Stat(dbPath); err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+
+	// Pragmas go in the DSN so every connection in the pool gets them, not
+	// just the one a PRAGMA statement happens to run on
+	db, err := sql.Open("sqlite3", dbPath+"?_query_only=1&_busy_timeout=5000&_cache_size=-16000")
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+	db.SetMaxOpenConns(readerConns)
+	db.SetMaxIdleConns(readerConns)
+
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
 	return db, nil
 }
 
@@ -0,0 +1,73 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.27.0
+// source: message_embeddings.sql
+
+package db
+
+import (
+	"context"
+)
+
+const listMessageEmbeddings = `-- name: ListMessageEmbeddings :many
+SELECT message_id, vector FROM message_embeddings
+WHERE session_id = ? AND model = ?
+`
+
+type ListMessageEmbeddingsParams struct {
+	SessionID string `json:"session_id"`
+	Model     string `json:"model"`
+}
+
+type ListMessageEmbeddingsRow struct {
+	MessageID string `json:"message_id"`
+	Vector    []byte `json:"vector"`
+}
+
+func (q *Queries) ListMessageEmbeddings(ctx context.Context, arg ListMessageEmbeddingsParams) ([]ListMessageEmbeddingsRow, error) {
+	rows, err := q.db.QueryContext(ctx, listMessageEmbeddings, arg.SessionID, arg.Model)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []ListMessageEmbeddingsRow{}
+	for rows.Next() {
+		var i ListMessageEmbeddingsRow
+		if err := rows.Scan(&i.MessageID, &i.Vector); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const upsertMessageEmbedding = `-- name: UpsertMessageEmbedding :exec
+INSERT INTO message_embeddings (message_id, model, session_id, vector, created_at)
+VALUES (?, ?, ?, ?, ?)
+ON CONFLICT (message_id, model) DO UPDATE SET vector = excluded.vector, created_at = excluded.created_at
+`
+
+type UpsertMessageEmbeddingParams struct {
+	MessageID string `json:"message_id"`
+	Model     string `json:"model"`
+	SessionID string `json:"session_id"`
+	Vector    []byte `json:"vector"`
+	CreatedAt int64  `json:"created_at"`
+}
+
+func (q *Queries) UpsertMessageEmbedding(ctx context.Context, arg UpsertMessageEmbeddingParams) error {
+	_, err := q.db.ExecContext(ctx, upsertMessageEmbedding,
+		arg.MessageID,
+		arg.Model,
+		arg.SessionID,
+		arg.Vector,
+		arg.CreatedAt,
+	)
+	return err
+}
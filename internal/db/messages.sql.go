@@ -22,19 +22,25 @@ func (q *Queries) CountMessagesBySession(ctx context.Context, sessionID string)
 }
 
 const createMessage = `-- name: CreateMessage :one
-INSERT INTO messages (id, session_id, role, content, model, created_at, updated_at)
-VALUES (?, ?, ?, ?, ?, ?, ?)
-RETURNING id, session_id, role, content, model, created_at, updated_at
+INSERT INTO messages (id, session_id, role, content, reasoning, model, params, config, tool_calls, tool_call_id, interrupted, created_at, updated_at)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+RETURNING id, session_id, role, content, model, created_at, updated_at, reasoning, params, forgotten, config, tool_calls, tool_call_id, interrupted
 `
 
 type CreateMessageParams struct {
-	ID        string         `json:"id"`
-	SessionID string         `json:"session_id"`
-	Role      string         `json:"role"`
-	Content   string         `json:"content"`
-	Model     sql.NullString `json:"model"`
-	CreatedAt int64          `json:"created_at"`
-	UpdatedAt int64          `json:"updated_at"`
+	ID          string         `json:"id"`
+	SessionID   string         `json:"session_id"`
+	Role        string         `json:"role"`
+	Content     string         `json:"content"`
+	Reasoning   sql.NullString `json:"reasoning"`
+	Model       sql.NullString `json:"model"`
+	Params      sql.NullString `json:"params"`
+	Config      sql.NullString `json:"config"`
+	ToolCalls   sql.NullString `json:"tool_calls"`
+	ToolCallID  sql.NullString `json:"tool_call_id"`
+	Interrupted int64          `json:"interrupted"`
+	CreatedAt   int64          `json:"created_at"`
+	UpdatedAt   int64          `json:"updated_at"`
 }
 
 func (q *Queries) CreateMessage(ctx context.Context, arg CreateMessageParams) (Message, error) {
@@ -43,7 +49,13 @@ func (q *Queries) CreateMessage(ctx context.Context, arg CreateMessageParams) (M
 		arg.SessionID,
 		arg.Role,
 		arg.Content,
+		arg.Reasoning,
 		arg.Model,
+		arg.Params,
+		arg.Config,
+		arg.ToolCalls,
+		arg.ToolCallID,
+		arg.Interrupted,
 		arg.CreatedAt,
 		arg.UpdatedAt,
 	)
@@ -56,6 +68,13 @@ func (q *Queries) CreateMessage(ctx context.Context, arg CreateMessageParams) (M
 		&i.Model,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.Reasoning,
+		&i.Params,
+		&i.Forgotten,
+		&i.Config,
+		&i.ToolCalls,
+		&i.ToolCallID,
+		&i.Interrupted,
 	)
 	return i, err
 }
@@ -78,8 +97,78 @@ func (q *Queries) DeleteMessagesBySession(ctx context.Context, sessionID string)
 	return err
 }
 
+const deleteMessagesFrom = `-- name: DeleteMessagesFrom :execrows
+DELETE FROM messages
+WHERE messages.session_id = ?1
+  AND messages.rowid >= (SELECT f.rowid FROM messages f WHERE f.id = ?2)
+`
+
+type DeleteMessagesFromParams struct {
+	SessionID string `json:"session_id"`
+	MessageID string `json:"message_id"`
+}
+
+// Deletes a message and every later message of its session
+func (q *Queries) DeleteMessagesFrom(ctx context.Context, arg DeleteMessagesFromParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteMessagesFrom, arg.SessionID, arg.MessageID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const forgetMessage = `-- name: ForgetMessage :execrows
+UPDATE messages
+SET forgotten = 1,
+    updated_at = ?
+WHERE id = ? AND session_id = ?
+`
+
+type ForgetMessageParams struct {
+	UpdatedAt int64  `json:"updated_at"`
+	ID        string `json:"id"`
+	SessionID string `json:"session_id"`
+}
+
+func (q *Queries) ForgetMessage(ctx context.Context, arg ForgetMessageParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, forgetMessage, arg.UpdatedAt, arg.ID, arg.SessionID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const getLatestEvent = `-- name: GetLatestEvent :one
+SELECT id, session_id, role, content, model, created_at, updated_at, reasoning, params, forgotten, config, tool_calls, tool_call_id, interrupted FROM messages
+WHERE session_id = ? AND role = 'event'
+ORDER BY rowid DESC
+LIMIT 1
+`
+
+func (q *Queries) GetLatestEvent(ctx context.Context, sessionID string) (Message, error) {
+	row := q.db.QueryRowContext(ctx, getLatestEvent, sessionID)
+	var i Message
+	err := row.Scan(
+		&i.ID,
+		&i.SessionID,
+		&i.Role,
+		&i.Content,
+		&i.Model,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Reasoning,
+		&i.Params,
+		&i.Forgotten,
+		&i.Config,
+		&i.ToolCalls,
+		&i.ToolCallID,
+		&i.Interrupted,
+	)
+	return i, err
+}
+
 const getMessage = `-- name: GetMessage :one
-SELECT id, session_id, role, content, model, created_at, updated_at FROM messages WHERE id = ?
+SELECT id, session_id, role, content, model, created_at, updated_at, reasoning, params, forgotten, config, tool_calls, tool_call_id, interrupted FROM messages WHERE id = ?
 `
 
 func (q *Queries) GetMessage(ctx context.Context, id string) (Message, error) {
@@ -93,12 +182,222 @@ func (q *Queries) GetMessage(ctx context.Context, id string) (Message, error) {
 		&i.Model,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.Reasoning,
+		&i.Params,
+		&i.Forgotten,
+		&i.Config,
+		&i.ToolCalls,
+		&i.ToolCallID,
+		&i.Interrupted,
 	)
 	return i, err
 }
 
+const insertMessage = `-- name: InsertMessage :exec
+INSERT INTO messages (id, session_id, role, content, reasoning, model, params, config, tool_calls, tool_call_id, interrupted, created_at, updated_at)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+`
+
+type InsertMessageParams struct {
+	ID          string         `json:"id"`
+	SessionID   string         `json:"session_id"`
+	Role        string         `json:"role"`
+	Content     string         `json:"content"`
+	Reasoning   sql.NullString `json:"reasoning"`
+	Model       sql.NullString `json:"model"`
+	Params      sql.NullString `json:"params"`
+	Config      sql.NullString `json:"config"`
+	ToolCalls   sql.NullString `json:"tool_calls"`
+	ToolCallID  sql.NullString `json:"tool_call_id"`
+	Interrupted int64          `json:"interrupted"`
+	CreatedAt   int64          `json:"created_at"`
+	UpdatedAt   int64          `json:"updated_at"`
+}
+
+// InsertMessage is CreateMessage without returning the row, for batches
+func (q *Queries) InsertMessage(ctx context.Context, arg InsertMessageParams) error {
+	_, err := q.db.ExecContext(ctx, insertMessage,
+		arg.ID,
+		arg.SessionID,
+		arg.Role,
+		arg.Content,
+		arg.Reasoning,
+		arg.Model,
+		arg.Params,
+		arg.Config,
+		arg.ToolCalls,
+		arg.ToolCallID,
+		arg.Interrupted,
+		arg.CreatedAt,
+		arg.UpdatedAt,
+	)
+	return err
+}
+
+const listLastTurns = `-- name: ListLastTurns :many
+SELECT id, session_id, role, content, model, created_at, updated_at, reasoning, params, forgotten, config, tool_calls, tool_call_id, interrupted FROM messages
+WHERE messages.session_id = ?1
+  AND messages.rowid >= COALESCE((
+    SELECT u.rowid FROM messages u
+    WHERE u.session_id = ?1 AND u.role = 'user'
+    ORDER BY u.rowid DESC
+    LIMIT 1 OFFSET CAST(?2 AS INTEGER) - 1
+  ), 0)
+ORDER BY messages.rowid ASC
+`
+
+type ListLastTurnsParams struct {
+	SessionID string `json:"session_id"`
+	Turns     int64  `json:"turns"`
+}
+
+func (q *Queries) ListLastTurns(ctx context.Context, arg ListLastTurnsParams) ([]Message, error) {
+	rows, err := q.db.QueryContext(ctx, listLastTurns, arg.SessionID, arg.Turns)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []Message{}
+	for rows.Next() {
+		var i Message
+		if err := rows.Scan(
+			&i.ID,
+			&i.SessionID,
+			&i.Role,
+			&i.Content,
+			&i.Model,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Reasoning,
+			&i.Params,
+			&i.Forgotten,
+			&i.Config,
+			&i.ToolCalls,
+			&i.ToolCallID,
+			&i.Interrupted,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listMessagesAfter = `-- name: ListMessagesAfter :many
+
+SELECT id, session_id, role, content, model, created_at, updated_at, reasoning, params, forgotten, config, tool_calls, tool_call_id, interrupted FROM messages
+WHERE messages.session_id = ?1
+  AND messages.rowid > COALESCE((SELECT m.rowid FROM messages m WHERE m.id = ?2), 0)
+ORDER BY messages.rowid ASC
+LIMIT ?3
+`
+
+type ListMessagesAfterParams struct {
+	SessionID string `json:"session_id"`
+	AfterID   string `json:"after_id"`
+	Limit     int64  `json:"limit"`
+}
+
+// Pagination uses rowid, which follows insertion order and, unlike
+// created_at, has no ties. Cursors are message IDs.
+func (q *Queries) ListMessagesAfter(ctx context.Context, arg ListMessagesAfterParams) ([]Message, error) {
+	rows, err := q.db.QueryContext(ctx, listMessagesAfter, arg.SessionID, arg.AfterID, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []Message{}
+	for rows.Next() {
+		var i Message
+		if err := rows.Scan(
+			&i.ID,
+			&i.SessionID,
+			&i.Role,
+			&i.Content,
+			&i.Model,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Reasoning,
+			&i.Params,
+			&i.Forgotten,
+			&i.Config,
+			&i.ToolCalls,
+			&i.ToolCallID,
+			&i.Interrupted,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listMessagesBefore = `-- name: ListMessagesBefore :many
+SELECT id, session_id, role, content, model, created_at, updated_at, reasoning, params, forgotten, config, tool_calls, tool_call_id, interrupted FROM messages
+WHERE messages.session_id = ?1
+  AND messages.rowid < COALESCE((SELECT m.rowid FROM messages m WHERE m.id = ?2), 9223372036854775807)
+ORDER BY messages.rowid DESC
+LIMIT ?3
+`
+
+type ListMessagesBeforeParams struct {
+	SessionID string `json:"session_id"`
+	BeforeID  string `json:"before_id"`
+	Limit     int64  `json:"limit"`
+}
+
+func (q *Queries) ListMessagesBefore(ctx context.Context, arg ListMessagesBeforeParams) ([]Message, error) {
+	rows, err := q.db.QueryContext(ctx, listMessagesBefore, arg.SessionID, arg.BeforeID, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []Message{}
+	for rows.Next() {
+		var i Message
+		if err := rows.Scan(
+			&i.ID,
+			&i.SessionID,
+			&i.Role,
+			&i.Content,
+			&i.Model,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Reasoning,
+			&i.Params,
+			&i.Forgotten,
+			&i.Config,
+			&i.ToolCalls,
+			&i.ToolCallID,
+			&i.Interrupted,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const listMessagesBySession = `-- name: ListMessagesBySession :many
-SELECT id, session_id, role, content, model, created_at, updated_at FROM messages WHERE session_id = ? ORDER BY created_at ASC
+SELECT id, session_id, role, content, model, created_at, updated_at, reasoning, params, forgotten, config, tool_calls, tool_call_id, interrupted FROM messages WHERE session_id = ? ORDER BY created_at ASC, rowid ASC
 `
 
 func (q *Queries) ListMessagesBySession(ctx context.Context, sessionID string) ([]Message, error) {
@@ -118,6 +417,13 @@ func (q *Queries) ListMessagesBySession(ctx context.Context, sessionID string) (
 			&i.Model,
 			&i.CreatedAt,
 			&i.UpdatedAt,
+			&i.Reasoning,
+			&i.Params,
+			&i.Forgotten,
+			&i.Config,
+			&i.ToolCalls,
+			&i.ToolCallID,
+			&i.Interrupted,
 		); err != nil {
 			return nil, err
 		}
@@ -137,7 +443,7 @@ UPDATE messages
 SET content = ?,
     updated_at = ?
 WHERE id = ?
-RETURNING id, session_id, role, content, model, created_at, updated_at
+RETURNING id, session_id, role, content, model, created_at, updated_at, reasoning, params, forgotten, config, tool_calls, tool_call_id, interrupted
 `
 
 type UpdateMessageParams struct {
@@ -157,6 +463,13 @@ func (q *Queries) UpdateMessage(ctx context.Context, arg UpdateMessageParams) (M
 		&i.Model,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.Reasoning,
+		&i.Params,
+		&i.Forgotten,
+		&i.Config,
+		&i.ToolCalls,
+		&i.ToolCallID,
+		&i.Interrupted,
 	)
 	return i, err
 }
@@ -0,0 +1,2 @@
+-- Thinking output of reasoning models, kept apart from the answer
+ALTER TABLE messages ADD COLUMN reasoning TEXT;
@@ -0,0 +1,2 @@
+-- Accumulated cost of a session in USD
+ALTER TABLE sessions ADD COLUMN cost REAL NOT NULL DEFAULT 0;
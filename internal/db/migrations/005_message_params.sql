@@ -0,0 +1,2 @@
+-- Request parameters an assistant message was generated with, as JSON
+ALTER TABLE messages ADD COLUMN params TEXT;
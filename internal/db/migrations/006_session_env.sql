@@ -0,0 +1,9 @@
+-- Environment variables injected into a session's tool executions
+CREATE TABLE IF NOT EXISTS session_env (
+    session_id TEXT NOT NULL,
+    name TEXT NOT NULL,
+    value TEXT NOT NULL,
+    updated_at INTEGER NOT NULL,
+    PRIMARY KEY (session_id, name),
+    FOREIGN KEY (session_id) REFERENCES sessions(id) ON DELETE CASCADE
+);
@@ -0,0 +1,2 @@
+-- Messages the model dropped from its working context with the forget tool
+ALTER TABLE messages ADD COLUMN forgotten INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,18 @@
+-- Gzipped, redacted provider requests and responses, for replay and debugging
+CREATE TABLE IF NOT EXISTS provider_archive (
+    id TEXT PRIMARY KEY,
+    session_id TEXT NOT NULL,
+    message_id TEXT,
+    provider TEXT NOT NULL,
+    model TEXT NOT NULL,
+    request BLOB NOT NULL,
+    response BLOB,
+    error TEXT,
+    size INTEGER NOT NULL,
+    created_at INTEGER NOT NULL,
+    FOREIGN KEY (session_id) REFERENCES sessions(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_provider_archive_session_id ON provider_archive(session_id);
+CREATE INDEX idx_provider_archive_message_id ON provider_archive(message_id);
+CREATE INDEX idx_provider_archive_created_at ON provider_archive(created_at);
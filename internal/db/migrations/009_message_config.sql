@@ -0,0 +1,2 @@
+-- Session configuration recorded by event messages, as JSON
+ALTER TABLE messages ADD COLUMN config TEXT;
@@ -0,0 +1,2 @@
+-- Language a session's responses are written in, overriding the config
+ALTER TABLE sessions ADD COLUMN language TEXT;
@@ -0,0 +1,14 @@
+-- Embeddings of message content, used to bring back earlier turns that
+-- no longer fit the context window
+CREATE TABLE IF NOT EXISTS message_embeddings (
+    message_id TEXT NOT NULL,
+    model TEXT NOT NULL,
+    session_id TEXT NOT NULL,
+    vector BLOB NOT NULL,
+    created_at INTEGER NOT NULL,
+    PRIMARY KEY (message_id, model),
+    FOREIGN KEY (message_id) REFERENCES messages(id) ON DELETE CASCADE,
+    FOREIGN KEY (session_id) REFERENCES sessions(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_message_embeddings_session_id ON message_embeddings(session_id, model);
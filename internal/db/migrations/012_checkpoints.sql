@@ -0,0 +1,13 @@
+-- Snapshots of the working tree taken before agent turns. The files live
+-- in a shadow git repository; rows link its commits to sessions.
+CREATE TABLE IF NOT EXISTS checkpoints (
+    id TEXT PRIMARY KEY,
+    session_id TEXT NOT NULL,
+    message_id TEXT,
+    commit_hash TEXT NOT NULL,
+    label TEXT NOT NULL DEFAULT '',
+    created_at INTEGER NOT NULL,
+    FOREIGN KEY (session_id) REFERENCES sessions(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_checkpoints_session_id ON checkpoints(session_id, created_at);
@@ -0,0 +1,4 @@
+-- The tool calls an assistant message made, as JSON, and the call a tool
+-- message answers, so restored history keeps its tool conversation
+ALTER TABLE messages ADD COLUMN tool_calls TEXT;
+ALTER TABLE messages ADD COLUMN tool_call_id TEXT;
@@ -0,0 +1,2 @@
+-- Agent mode of a session: plan (read-only) or build, see agent.Mode
+ALTER TABLE sessions ADD COLUMN mode TEXT;
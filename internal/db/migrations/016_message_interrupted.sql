@@ -0,0 +1,2 @@
+-- Assistant messages whose run was cancelled before the reply was complete
+ALTER TABLE messages ADD COLUMN interrupted INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,12 @@
+-- Facts and preferences the agent remembers across sessions. The session
+-- a memory was saved in may be deleted; the memory stays.
+CREATE TABLE IF NOT EXISTS memories (
+    id TEXT PRIMARY KEY,
+    content TEXT NOT NULL,
+    session_id TEXT NOT NULL DEFAULT '',
+    model TEXT NOT NULL DEFAULT '',
+    vector BLOB,
+    created_at INTEGER NOT NULL
+);
+
+CREATE INDEX idx_memories_created_at ON memories(created_at);
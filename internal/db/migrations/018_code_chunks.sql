@@ -0,0 +1,13 @@
+-- Embedded chunks of workspace files, searched by the semantic_search
+-- tool. Each keeps the hash of the file it was cut from, so only files
+-- that changed are embedded again.
+CREATE TABLE IF NOT EXISTS code_chunks (
+    root TEXT NOT NULL,
+    model TEXT NOT NULL,
+    path TEXT NOT NULL,
+    start_line INTEGER NOT NULL,
+    end_line INTEGER NOT NULL,
+    file_hash TEXT NOT NULL,
+    vector BLOB NOT NULL,
+    PRIMARY KEY (root, model, path, start_line)
+);
@@ -8,6 +8,34 @@ import (
 	"database/sql"
 )
 
+type Attachment struct {
+	ID        string `json:"id"`
+	SessionID string `json:"session_id"`
+	MessageID string `json:"message_id"`
+	Content   string `json:"content"`
+	Size      int64  `json:"size"`
+	CreatedAt int64  `json:"created_at"`
+}
+
+type Checkpoint struct {
+	ID         string         `json:"id"`
+	SessionID  string         `json:"session_id"`
+	MessageID  sql.NullString `json:"message_id"`
+	CommitHash string         `json:"commit_hash"`
+	Label      string         `json:"label"`
+	CreatedAt  int64          `json:"created_at"`
+}
+
+type CodeChunk struct {
+	Root      string `json:"root"`
+	Model     string `json:"model"`
+	Path      string `json:"path"`
+	StartLine int64  `json:"start_line"`
+	EndLine   int64  `json:"end_line"`
+	FileHash  string `json:"file_hash"`
+	Vector    []byte `json:"vector"`
+}
+
 type FileChange struct {
 	ID         string         `json:"id"`
 	SessionID  string         `json:"session_id"`
@@ -19,24 +47,80 @@ type FileChange struct {
 	CreatedAt  int64          `json:"created_at"`
 }
 
+type Memory struct {
+	ID        string `json:"id"`
+	Content   string `json:"content"`
+	SessionID string `json:"session_id"`
+	Model     string `json:"model"`
+	Vector    []byte `json:"vector"`
+	CreatedAt int64  `json:"created_at"`
+}
+
 type Message struct {
+	ID          string         `json:"id"`
+	SessionID   string         `json:"session_id"`
+	Role        string         `json:"role"`
+	Content     string         `json:"content"`
+	Model       sql.NullString `json:"model"`
+	CreatedAt   int64          `json:"created_at"`
+	UpdatedAt   int64          `json:"updated_at"`
+	Reasoning   sql.NullString `json:"reasoning"`
+	Params      sql.NullString `json:"params"`
+	Forgotten   int64          `json:"forgotten"`
+	Config      sql.NullString `json:"config"`
+	ToolCalls   sql.NullString `json:"tool_calls"`
+	ToolCallID  sql.NullString `json:"tool_call_id"`
+	Interrupted int64          `json:"interrupted"`
+}
+
+type MessageEmbedding struct {
+	MessageID string `json:"message_id"`
+	Model     string `json:"model"`
+	SessionID string `json:"session_id"`
+	Vector    []byte `json:"vector"`
+	CreatedAt int64  `json:"created_at"`
+}
+
+type ProviderArchive struct {
 	ID        string         `json:"id"`
 	SessionID string         `json:"session_id"`
-	Role      string         `json:"role"`
-	Content   string         `json:"content"`
-	Model     sql.NullString `json:"model"`
+	MessageID sql.NullString `json:"message_id"`
+	Provider  string         `json:"provider"`
+	Model     string         `json:"model"`
+	Request   []byte         `json:"request"`
+	Response  []byte         `json:"response"`
+	Error     sql.NullString `json:"error"`
+	Size      int64          `json:"size"`
 	CreatedAt int64          `json:"created_at"`
-	UpdatedAt int64          `json:"updated_at"`
 }
 
 type Session struct {
-	ID               string        `json:"id"`
-	Title            string        `json:"title"`
-	Model            string        `json:"model"`
-	Provider         string        `json:"provider"`
-	MessageCount     sql.NullInt64 `json:"message_count"`
-	PromptTokens     sql.NullInt64 `json:"prompt_tokens"`
-	CompletionTokens sql.NullInt64 `json:"completion_tokens"`
-	CreatedAt        int64         `json:"created_at"`
-	UpdatedAt        int64         `json:"updated_at"`
+	ID               string         `json:"id"`
+	Title            string         `json:"title"`
+	Model            string         `json:"model"`
+	Provider         string         `json:"provider"`
+	MessageCount     sql.NullInt64  `json:"message_count"`
+	PromptTokens     sql.NullInt64  `json:"prompt_tokens"`
+	CompletionTokens sql.NullInt64  `json:"completion_tokens"`
+	CreatedAt        int64          `json:"created_at"`
+	UpdatedAt        int64          `json:"updated_at"`
+	Cost             float64        `json:"cost"`
+	Language         sql.NullString `json:"language"`
+	Mode             sql.NullString `json:"mode"`
+}
+
+type SessionEnv struct {
+	SessionID string `json:"session_id"`
+	Name      string `json:"name"`
+	Value     string `json:"value"`
+	UpdatedAt int64  `json:"updated_at"`
+}
+
+type SessionSummary struct {
+	ID               string `json:"id"`
+	SessionID        string `json:"session_id"`
+	Content          string `json:"content"`
+	ThroughMessageID string `json:"through_message_id"`
+	MessageCount     int64  `json:"message_count"`
+	CreatedAt        int64  `json:"created_at"`
 }
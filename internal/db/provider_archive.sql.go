@@ -0,0 +1,150 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.27.0
+// source: provider_archive.sql
+
+package db
+
+import (
+	"context"
+	"database/sql"
+)
+
+const createArchiveEntry = `-- name: CreateArchiveEntry :exec
+INSERT INTO provider_archive (id, session_id, message_id, provider, model, request, response, error, size, created_at)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+`
+
+type CreateArchiveEntryParams struct {
+	ID        string         `json:"id"`
+	SessionID string         `json:"session_id"`
+	MessageID sql.NullString `json:"message_id"`
+	Provider  string         `json:"provider"`
+	Model     string         `json:"model"`
+	Request   []byte         `json:"request"`
+	Response  []byte         `json:"response"`
+	Error     sql.NullString `json:"error"`
+	Size      int64          `json:"size"`
+	CreatedAt int64          `json:"created_at"`
+}
+
+func (q *Queries) CreateArchiveEntry(ctx context.Context, arg CreateArchiveEntryParams) error {
+	_, err := q.db.ExecContext(ctx, createArchiveEntry,
+		arg.ID,
+		arg.SessionID,
+		arg.MessageID,
+		arg.Provider,
+		arg.Model,
+		arg.Request,
+		arg.Response,
+		arg.Error,
+		arg.Size,
+		arg.CreatedAt,
+	)
+	return err
+}
+
+const deleteArchiveEntriesBefore = `-- name: DeleteArchiveEntriesBefore :execrows
+DELETE FROM provider_archive WHERE created_at < ?
+`
+
+func (q *Queries) DeleteArchiveEntriesBefore(ctx context.Context, createdAt int64) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteArchiveEntriesBefore, createdAt)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const deleteArchiveEntriesOverLimit = `-- name: DeleteArchiveEntriesOverLimit :execrows
+DELETE FROM provider_archive
+WHERE rowid IN (
+    SELECT rowid FROM provider_archive
+    ORDER BY rowid DESC
+    LIMIT -1 OFFSET CAST(?1 AS INTEGER)
+)
+`
+
+// Keeps the newest entries, deleting everything past the first keep
+func (q *Queries) DeleteArchiveEntriesOverLimit(ctx context.Context, keep int64) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteArchiveEntriesOverLimit, keep)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const getArchiveEntryByMessage = `-- name: GetArchiveEntryByMessage :one
+SELECT id, session_id, message_id, provider, model, request, response, error, size, created_at FROM provider_archive
+WHERE message_id = ?
+ORDER BY created_at DESC, rowid DESC
+LIMIT 1
+`
+
+func (q *Queries) GetArchiveEntryByMessage(ctx context.Context, messageID sql.NullString) (ProviderArchive, error) {
+	row := q.db.QueryRowContext(ctx, getArchiveEntryByMessage, messageID)
+	var i ProviderArchive
+	err := row.Scan(
+		&i.ID,
+		&i.SessionID,
+		&i.MessageID,
+		&i.Provider,
+		&i.Model,
+		&i.Request,
+		&i.Response,
+		&i.Error,
+		&i.Size,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const listArchiveEntriesBySession = `-- name: ListArchiveEntriesBySession :many
+SELECT id, session_id, message_id, provider, model, error, size, created_at
+FROM provider_archive
+WHERE session_id = ?
+ORDER BY rowid ASC
+`
+
+type ListArchiveEntriesBySessionRow struct {
+	ID        string         `json:"id"`
+	SessionID string         `json:"session_id"`
+	MessageID sql.NullString `json:"message_id"`
+	Provider  string         `json:"provider"`
+	Model     string         `json:"model"`
+	Error     sql.NullString `json:"error"`
+	Size      int64          `json:"size"`
+	CreatedAt int64          `json:"created_at"`
+}
+
+func (q *Queries) ListArchiveEntriesBySession(ctx context.Context, sessionID string) ([]ListArchiveEntriesBySessionRow, error) {
+	rows, err := q.db.QueryContext(ctx, listArchiveEntriesBySession, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []ListArchiveEntriesBySessionRow{}
+	for rows.Next() {
+		var i ListArchiveEntriesBySessionRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.SessionID,
+			&i.MessageID,
+			&i.Provider,
+			&i.Model,
+			&i.Error,
+			&i.Size,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
@@ -6,27 +6,84 @@ package db
 
 import (
 	"context"
+	"database/sql"
 )
 
 type Querier interface {
+	AddSessionUsage(ctx context.Context, arg AddSessionUsageParams) (Session, error)
 	CountMessagesBySession(ctx context.Context, sessionID string) (int64, error)
 	CountSessions(ctx context.Context) (int64, error)
+	CreateArchiveEntry(ctx context.Context, arg CreateArchiveEntryParams) error
+	CreateAttachment(ctx context.Context, arg CreateAttachmentParams) error
+	CreateCheckpoint(ctx context.Context, arg CreateCheckpointParams) error
+	CreateCodeChunk(ctx context.Context, arg CreateCodeChunkParams) error
 	CreateFileChange(ctx context.Context, arg CreateFileChangeParams) (FileChange, error)
+	CreateMemory(ctx context.Context, arg CreateMemoryParams) error
 	CreateMessage(ctx context.Context, arg CreateMessageParams) (Message, error)
 	CreateSession(ctx context.Context, arg CreateSessionParams) (Session, error)
+	CreateSessionSummary(ctx context.Context, arg CreateSessionSummaryParams) (SessionSummary, error)
+	DeleteArchiveEntriesBefore(ctx context.Context, createdAt int64) (int64, error)
+	// Keeps the newest entries, deleting everything past the first keep
+	DeleteArchiveEntriesOverLimit(ctx context.Context, keep int64) (int64, error)
+	// Deletes the attachments of a message and of every later message of its
+	// session
+	DeleteAttachmentsFrom(ctx context.Context, arg DeleteAttachmentsFromParams) error
+	// Keeps the session's newest checkpoints, deleting everything past the
+	// first keep
+	DeleteCheckpointsOverLimit(ctx context.Context, arg DeleteCheckpointsOverLimitParams) (int64, error)
+	DeleteCodeFile(ctx context.Context, arg DeleteCodeFileParams) error
 	DeleteFileChange(ctx context.Context, id string) error
 	DeleteFileChangesBySession(ctx context.Context, sessionID string) error
+	DeleteMemory(ctx context.Context, id string) (int64, error)
 	DeleteMessage(ctx context.Context, id string) error
 	DeleteMessagesBySession(ctx context.Context, sessionID string) error
+	// Deletes a message and every later message of its session
+	DeleteMessagesFrom(ctx context.Context, arg DeleteMessagesFromParams) (int64, error)
 	DeleteSession(ctx context.Context, id string) error
+	DeleteSessionEnv(ctx context.Context, arg DeleteSessionEnvParams) error
+	DeleteSessionSummaries(ctx context.Context, sessionID string) error
+	// Deletes the summaries that cover a message or any later message of its
+	// session
+	DeleteSessionSummariesFrom(ctx context.Context, arg DeleteSessionSummariesFromParams) error
+	ForgetMessage(ctx context.Context, arg ForgetMessageParams) (int64, error)
+	GetArchiveEntryByMessage(ctx context.Context, messageID sql.NullString) (ProviderArchive, error)
+	GetAttachment(ctx context.Context, id string) (Attachment, error)
+	GetCheckpoint(ctx context.Context, id string) (Checkpoint, error)
 	GetFileChange(ctx context.Context, id string) (FileChange, error)
+	GetLatestEvent(ctx context.Context, sessionID string) (Message, error)
+	GetLatestSessionSummary(ctx context.Context, sessionID string) (SessionSummary, error)
 	GetMessage(ctx context.Context, id string) (Message, error)
 	GetSession(ctx context.Context, id string) (Session, error)
+	GetSessionCost(ctx context.Context, id string) (GetSessionCostRow, error)
+	GetSessionLanguage(ctx context.Context, id string) (sql.NullString, error)
+	GetSessionMode(ctx context.Context, id string) (sql.NullString, error)
+	// InsertMessage is CreateMessage without returning the row, for batches
+	InsertMessage(ctx context.Context, arg InsertMessageParams) error
+	ListArchiveEntriesBySession(ctx context.Context, sessionID string) ([]ListArchiveEntriesBySessionRow, error)
+	ListCheckpointsBySession(ctx context.Context, sessionID string) ([]Checkpoint, error)
+	ListCodeChunks(ctx context.Context, arg ListCodeChunksParams) ([]ListCodeChunksRow, error)
+	ListCodeFiles(ctx context.Context, arg ListCodeFilesParams) ([]ListCodeFilesRow, error)
 	ListFileChangesBySession(ctx context.Context, sessionID string) ([]FileChange, error)
+	ListLastTurns(ctx context.Context, arg ListLastTurnsParams) ([]Message, error)
+	ListMemories(ctx context.Context) ([]Memory, error)
+	ListMessageEmbeddings(ctx context.Context, arg ListMessageEmbeddingsParams) ([]ListMessageEmbeddingsRow, error)
+	// Pagination uses rowid, which follows insertion order and, unlike
+	// created_at, has no ties. Cursors are message IDs.
+	ListMessagesAfter(ctx context.Context, arg ListMessagesAfterParams) ([]Message, error)
+	ListMessagesBefore(ctx context.Context, arg ListMessagesBeforeParams) ([]Message, error)
 	ListMessagesBySession(ctx context.Context, sessionID string) ([]Message, error)
+	ListSessionEnv(ctx context.Context, sessionID string) ([]SessionEnv, error)
+	ListSessionSummaries(ctx context.Context, sessionID string) ([]SessionSummary, error)
 	ListSessions(ctx context.Context, arg ListSessionsParams) ([]Session, error)
+	// Returns part of an attachment; offset is 0-based, in bytes
+	ReadAttachment(ctx context.Context, arg ReadAttachmentParams) (ReadAttachmentRow, error)
+	SetSessionEnv(ctx context.Context, arg SetSessionEnvParams) error
+	SetSessionLanguage(ctx context.Context, arg SetSessionLanguageParams) error
+	SetSessionMode(ctx context.Context, arg SetSessionModeParams) error
+	UpdateMemoryEmbedding(ctx context.Context, arg UpdateMemoryEmbeddingParams) error
 	UpdateMessage(ctx context.Context, arg UpdateMessageParams) (Message, error)
 	UpdateSession(ctx context.Context, arg UpdateSessionParams) (Session, error)
+	UpsertMessageEmbedding(ctx context.Context, arg UpsertMessageEmbeddingParams) error
 }
 
 var _ Querier = (*Queries)(nil)
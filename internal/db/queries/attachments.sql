@@ -0,0 +1,23 @@
+-- name: CreateAttachment :exec
+INSERT INTO attachments (id, session_id, message_id, content, size, created_at)
+VALUES (?, ?, ?, ?, ?, ?);
+
+-- name: GetAttachment :one
+SELECT * FROM attachments WHERE id = ?;
+
+-- Returns part of an attachment; offset is 0-based, in bytes
+-- name: ReadAttachment :one
+SELECT session_id, size, CAST(substr(CAST(content AS BLOB), CAST(sqlc.arg(offset) AS INTEGER) + 1, CAST(sqlc.arg(length) AS INTEGER)) AS TEXT) AS part
+FROM attachments
+WHERE id = CAST(sqlc.arg(id) AS TEXT);
+
+-- Deletes the attachments of a message and of every later message of its
+-- session
+-- name: DeleteAttachmentsFrom :exec
+DELETE FROM attachments
+WHERE attachments.session_id = sqlc.arg(session_id)
+  AND attachments.message_id IN (
+    SELECT m.id FROM messages m
+    WHERE m.session_id = sqlc.arg(session_id)
+      AND m.rowid >= (SELECT f.rowid FROM messages f WHERE f.id = sqlc.arg(message_id))
+  );
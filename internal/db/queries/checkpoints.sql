@@ -0,0 +1,22 @@
+-- name: CreateCheckpoint :exec
+INSERT INTO checkpoints (id, session_id, message_id, commit_hash, label, created_at)
+VALUES (?, ?, ?, ?, ?, ?);
+
+-- name: GetCheckpoint :one
+SELECT * FROM checkpoints WHERE id = ?;
+
+-- name: ListCheckpointsBySession :many
+SELECT * FROM checkpoints
+WHERE session_id = ?
+ORDER BY created_at DESC, rowid DESC;
+
+-- Keeps the session's newest checkpoints, deleting everything past the
+-- first keep
+-- name: DeleteCheckpointsOverLimit :execrows
+DELETE FROM checkpoints
+WHERE rowid IN (
+    SELECT rowid FROM checkpoints
+    WHERE session_id = CAST(sqlc.arg(session_id) AS TEXT)
+    ORDER BY created_at DESC, rowid DESC
+    LIMIT -1 OFFSET CAST(sqlc.arg(keep) AS INTEGER)
+);
@@ -0,0 +1,14 @@
+-- name: CreateCodeChunk :exec
+INSERT INTO code_chunks (root, model, path, start_line, end_line, file_hash, vector)
+VALUES (?, ?, ?, ?, ?, ?, ?);
+
+-- name: ListCodeFiles :many
+SELECT DISTINCT path, file_hash FROM code_chunks
+WHERE root = ? AND model = ?;
+
+-- name: ListCodeChunks :many
+SELECT path, start_line, end_line, vector FROM code_chunks
+WHERE root = ? AND model = ?;
+
+-- name: DeleteCodeFile :exec
+DELETE FROM code_chunks WHERE root = ? AND model = ? AND path = ?;
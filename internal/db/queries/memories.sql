@@ -0,0 +1,12 @@
+-- name: CreateMemory :exec
+INSERT INTO memories (id, content, session_id, model, vector, created_at)
+VALUES (?, ?, ?, ?, ?, ?);
+
+-- name: ListMemories :many
+SELECT * FROM memories ORDER BY created_at DESC, rowid DESC;
+
+-- name: UpdateMemoryEmbedding :exec
+UPDATE memories SET model = ?, vector = ? WHERE id = ?;
+
+-- name: DeleteMemory :execrows
+DELETE FROM memories WHERE id = ?;
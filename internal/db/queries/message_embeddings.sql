@@ -0,0 +1,8 @@
+-- name: UpsertMessageEmbedding :exec
+INSERT INTO message_embeddings (message_id, model, session_id, vector, created_at)
+VALUES (?, ?, ?, ?, ?)
+ON CONFLICT (message_id, model) DO UPDATE SET vector = excluded.vector, created_at = excluded.created_at;
+
+-- name: ListMessageEmbeddings :many
+SELECT message_id, vector FROM message_embeddings
+WHERE session_id = ? AND model = ?;
@@ -2,13 +2,52 @@
 SELECT * FROM messages WHERE id = ?;
 
 -- name: ListMessagesBySession :many
-SELECT * FROM messages WHERE session_id = ? ORDER BY created_at ASC;
+SELECT * FROM messages WHERE session_id = ? ORDER BY created_at ASC, rowid ASC;
+
+-- Pagination uses rowid, which follows insertion order and, unlike
+-- created_at, has no ties. Cursors are message IDs.
+
+-- name: ListMessagesAfter :many
+SELECT * FROM messages
+WHERE messages.session_id = sqlc.arg(session_id)
+  AND messages.rowid > COALESCE((SELECT m.rowid FROM messages m WHERE m.id = sqlc.arg(after_id)), 0)
+ORDER BY messages.rowid ASC
+LIMIT sqlc.arg(limit);
+
+-- name: ListMessagesBefore :many
+SELECT * FROM messages
+WHERE messages.session_id = sqlc.arg(session_id)
+  AND messages.rowid < COALESCE((SELECT m.rowid FROM messages m WHERE m.id = sqlc.arg(before_id)), 9223372036854775807)
+ORDER BY messages.rowid DESC
+LIMIT sqlc.arg(limit);
+
+-- name: ListLastTurns :many
+SELECT * FROM messages
+WHERE messages.session_id = sqlc.arg(session_id)
+  AND messages.rowid >= COALESCE((
+    SELECT u.rowid FROM messages u
+    WHERE u.session_id = sqlc.arg(session_id) AND u.role = 'user'
+    ORDER BY u.rowid DESC
+    LIMIT 1 OFFSET CAST(sqlc.arg(turns) AS INTEGER) - 1
+  ), 0)
+ORDER BY messages.rowid ASC;
+
+-- name: GetLatestEvent :one
+SELECT * FROM messages
+WHERE session_id = ? AND role = 'event'
+ORDER BY rowid DESC
+LIMIT 1;
 
 -- name: CreateMessage :one
-INSERT INTO messages (id, session_id, role, content, model, created_at, updated_at)
-VALUES (?, ?, ?, ?, ?, ?, ?)
+INSERT INTO messages (id, session_id, role, content, reasoning, model, params, config, tool_calls, tool_call_id, interrupted, created_at, updated_at)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 RETURNING *;
 
+-- InsertMessage is CreateMessage without returning the row, for batches
+-- name: InsertMessage :exec
+INSERT INTO messages (id, session_id, role, content, reasoning, model, params, config, tool_calls, tool_call_id, interrupted, created_at, updated_at)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?);
+
 -- name: UpdateMessage :one
 UPDATE messages
 SET content = ?,
@@ -22,5 +61,17 @@ DELETE FROM messages WHERE id = ?;
 -- name: DeleteMessagesBySession :exec
 DELETE FROM messages WHERE session_id = ?;
 
+-- Deletes a message and every later message of its session
+-- name: DeleteMessagesFrom :execrows
+DELETE FROM messages
+WHERE messages.session_id = sqlc.arg(session_id)
+  AND messages.rowid >= (SELECT f.rowid FROM messages f WHERE f.id = sqlc.arg(message_id));
+
 -- name: CountMessagesBySession :one
 SELECT COUNT(*) FROM messages WHERE session_id = ?;
+
+-- name: ForgetMessage :execrows
+UPDATE messages
+SET forgotten = 1,
+    updated_at = ?
+WHERE id = ? AND session_id = ?;
@@ -0,0 +1,27 @@
+-- name: CreateArchiveEntry :exec
+INSERT INTO provider_archive (id, session_id, message_id, provider, model, request, response, error, size, created_at)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?);
+
+-- name: GetArchiveEntryByMessage :one
+SELECT * FROM provider_archive
+WHERE message_id = ?
+ORDER BY created_at DESC, rowid DESC
+LIMIT 1;
+
+-- name: ListArchiveEntriesBySession :many
+SELECT id, session_id, message_id, provider, model, error, size, created_at
+FROM provider_archive
+WHERE session_id = ?
+ORDER BY rowid ASC;
+
+-- name: DeleteArchiveEntriesBefore :execrows
+DELETE FROM provider_archive WHERE created_at < ?;
+
+-- Keeps the newest entries, deleting everything past the first keep
+-- name: DeleteArchiveEntriesOverLimit :execrows
+DELETE FROM provider_archive
+WHERE rowid IN (
+    SELECT rowid FROM provider_archive
+    ORDER BY rowid DESC
+    LIMIT -1 OFFSET CAST(sqlc.arg(keep) AS INTEGER)
+);
@@ -0,0 +1,10 @@
+-- name: SetSessionEnv :exec
+INSERT INTO session_env (session_id, name, value, updated_at)
+VALUES (?, ?, ?, ?)
+ON CONFLICT (session_id, name) DO UPDATE SET value = excluded.value, updated_at = excluded.updated_at;
+
+-- name: ListSessionEnv :many
+SELECT * FROM session_env WHERE session_id = ? ORDER BY name;
+
+-- name: DeleteSessionEnv :exec
+DELETE FROM session_env WHERE session_id = ? AND name = ?;
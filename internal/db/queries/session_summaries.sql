@@ -0,0 +1,24 @@
+-- name: CreateSessionSummary :one
+INSERT INTO session_summaries (id, session_id, content, through_message_id, message_count, created_at)
+VALUES (?, ?, ?, ?, ?, ?)
+RETURNING *;
+
+-- name: GetLatestSessionSummary :one
+SELECT * FROM session_summaries
+WHERE session_id = ?
+ORDER BY message_count DESC
+LIMIT 1;
+
+-- name: ListSessionSummaries :many
+SELECT * FROM session_summaries WHERE session_id = ? ORDER BY message_count ASC;
+
+-- name: DeleteSessionSummaries :exec
+DELETE FROM session_summaries WHERE session_id = ?;
+
+-- Deletes the summaries that cover a message or any later message of its
+-- session
+-- name: DeleteSessionSummariesFrom :exec
+DELETE FROM session_summaries
+WHERE session_summaries.session_id = sqlc.arg(session_id)
+  AND COALESCE((SELECT t.rowid FROM messages t WHERE t.id = session_summaries.through_message_id), 0)
+    >= (SELECT f.rowid FROM messages f WHERE f.id = sqlc.arg(message_id));
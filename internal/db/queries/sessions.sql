@@ -24,3 +24,37 @@ DELETE FROM sessions WHERE id = ?;
 
 -- name: CountSessions :one
 SELECT COUNT(*) FROM sessions;
+
+-- name: AddSessionUsage :one
+UPDATE sessions
+SET prompt_tokens = COALESCE(prompt_tokens, 0) + CAST(sqlc.arg(prompt_tokens) AS INTEGER),
+    completion_tokens = COALESCE(completion_tokens, 0) + CAST(sqlc.arg(completion_tokens) AS INTEGER),
+    cost = cost + sqlc.arg(cost),
+    updated_at = sqlc.arg(updated_at)
+WHERE id = sqlc.arg(id)
+RETURNING *;
+
+-- name: GetSessionCost :one
+SELECT COALESCE(prompt_tokens, 0) AS prompt_tokens,
+       COALESCE(completion_tokens, 0) AS completion_tokens,
+       cost
+FROM sessions
+WHERE id = ?;
+
+-- name: GetSessionLanguage :one
+SELECT language FROM sessions WHERE id = ?;
+
+-- name: SetSessionLanguage :exec
+UPDATE sessions
+SET language = ?,
+    updated_at = ?
+WHERE id = ?;
+
+-- name: GetSessionMode :one
+SELECT mode FROM sessions WHERE id = ?;
+
+-- name: SetSessionMode :exec
+UPDATE sessions
+SET mode = ?,
+    updated_at = ?
+WHERE id = ?;
@@ -0,0 +1,175 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// The full-text index over message content. FTS5 is only compiled into
+// go-sqlite3 with the sqlite_fts5 build tag, so builds without it get
+// FTS4, which is always there; both read the same queries. The index
+// refers to messages by rowid and is kept in sync by triggers.
+var (
+	fts5Schema = []string{
+		`CREATE VIRTUAL TABLE messages_fts USING fts5(content, content='messages', content_rowid='rowid', tokenize='unicode61 remove_diacritics 2')`,
+		`CREATE TRIGGER messages_fts_insert AFTER INSERT ON messages BEGIN
+			INSERT INTO messages_fts(rowid, content) VALUES (new.rowid, new.content);
+		END`,
+		`CREATE TRIGGER messages_fts_delete AFTER DELETE ON messages BEGIN
+			INSERT INTO messages_fts(messages_fts, rowid, content) VALUES ('delete', old.rowid, old.content);
+		END`,
+		`CREATE TRIGGER messages_fts_update AFTER UPDATE OF content ON messages BEGIN
+			INSERT INTO messages_fts(messages_fts, rowid, content) VALUES ('delete', old.rowid, old.content);
+			INSERT INTO messages_fts(rowid, content) VALUES (new.rowid, new.content);
+		END`,
+	}
+	fts4Schema = []string{
+		`CREATE VIRTUAL TABLE messages_fts USING fts4(content, content='messages', tokenize=unicode61)`,
+		`CREATE TRIGGER messages_fts_insert AFTER INSERT ON messages BEGIN
+			INSERT INTO messages_fts(docid, content) VALUES (new.rowid, new.content);
+		END`,
+		`CREATE TRIGGER messages_fts_delete BEFORE DELETE ON messages BEGIN
+			DELETE FROM messages_fts WHERE docid = old.rowid;
+		END`,
+		`CREATE TRIGGER messages_fts_update_before BEFORE UPDATE OF content ON messages BEGIN
+			DELETE FROM messages_fts WHERE docid = old.rowid;
+		END`,
+		`CREATE TRIGGER messages_fts_update AFTER UPDATE OF content ON messages BEGIN
+			INSERT INTO messages_fts(docid, content) VALUES (new.rowid, new.content);
+		END`,
+	}
+)
+
+// setupSearch creates the full-text index on first use and fills it with
+// the messages already saved
+func setupSearch(db *sql.DB) error {
+	var count int
+	err := db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE name = 'messages_fts'").Scan(&count)
+	if err != nil {
+		return fmt.Errorf("failed to check search index: %w", err)
+	}
+	if count > 0 {
+		return nil
+	}
+
+	err = createSearchIndex(db, fts5Schema)
+	if err != nil && strings.Contains(err.Error(), "no such module") {
+		err = createSearchIndex(db, fts4Schema)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to create search index: %w", err)
+	}
+	return nil
+}
+
+func createSearchIndex(db *sql.DB, schema []string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, stmt := range schema {
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.Exec(`INSERT INTO messages_fts(messages_fts) VALUES ('rebuild')`); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+const searchMessages = `
+SELECT messages.id, messages.session_id, messages.role, messages.content, messages.created_at, sessions.title
+FROM messages_fts
+JOIN messages ON messages.rowid = messages_fts.rowid
+JOIN sessions ON sessions.id = messages.session_id
+WHERE messages_fts MATCH ?1
+  AND messages.role IN ('user', 'assistant')
+  AND (?2 = '' OR messages.session_id = ?2)
+ORDER BY messages.created_at DESC, messages.rowid DESC
+LIMIT ?3
+`
+
+type SearchMessagesParams struct {
+	Query     string `json:"query"` // see MatchQuery
+	SessionID string `json:"session_id"`
+	Limit     int64  `json:"limit"`
+}
+
+type SearchMessagesRow struct {
+	ID        string `json:"id"`
+	SessionID string `json:"session_id"`
+	Role      string `json:"role"`
+	Content   string `json:"content"`
+	CreatedAt int64  `json:"created_at"`
+	Title     string `json:"title"`
+}
+
+// SearchMessages returns the user and assistant messages matching a
+// full-text query, newest first. An empty session_id searches every
+// session. The query is passed to MATCH as is; build it with MatchQuery.
+func (q *Queries) SearchMessages(ctx context.Context, arg SearchMessagesParams) ([]SearchMessagesRow, error) {
+	rows, err := q.db.QueryContext(ctx, searchMessages, arg.Query, arg.SessionID, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []SearchMessagesRow{}
+	for rows.Next() {
+		var i SearchMessagesRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.SessionID,
+			&i.Role,
+			&i.Content,
+			&i.CreatedAt,
+			&i.Title,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// MatchQuery turns what a user typed into a full-text query both FTS4 and
+// FTS5 understand: every word must appear, words match as prefixes, and
+// text in double quotes matches as a phrase. Operators are not passed
+// through, so any input is a valid query. It returns "" when there is
+// nothing to search for.
+func MatchQuery(input string) string {
+	var terms []string
+	for i, part := range strings.Split(input, `"`) {
+		part = strings.ToLower(part)
+		if i%2 == 1 {
+			// Inside quotes
+			if words := searchWords(part); len(words) > 0 {
+				terms = append(terms, `"`+strings.Join(words, " ")+`"`)
+			}
+			continue
+		}
+		for _, word := range searchWords(part) {
+			terms = append(terms, word+"*")
+		}
+	}
+	return strings.Join(terms, " ")
+}
+
+// searchWords splits text into words the way the unicode61 tokenizer does,
+// so every word is a valid bare term
+func searchWords(text string) []string {
+	return strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
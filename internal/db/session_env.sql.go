@@ -0,0 +1,79 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.27.0
+// source: session_env.sql
+
+package db
+
+import (
+	"context"
+)
+
+const deleteSessionEnv = `-- name: DeleteSessionEnv :exec
+DELETE FROM session_env WHERE session_id = ? AND name = ?
+`
+
+type DeleteSessionEnvParams struct {
+	SessionID string `json:"session_id"`
+	Name      string `json:"name"`
+}
+
+func (q *Queries) DeleteSessionEnv(ctx context.Context, arg DeleteSessionEnvParams) error {
+	_, err := q.db.ExecContext(ctx, deleteSessionEnv, arg.SessionID, arg.Name)
+	return err
+}
+
+const listSessionEnv = `-- name: ListSessionEnv :many
+SELECT session_id, name, value, updated_at FROM session_env WHERE session_id = ? ORDER BY name
+`
+
+func (q *Queries) ListSessionEnv(ctx context.Context, sessionID string) ([]SessionEnv, error) {
+	rows, err := q.db.QueryContext(ctx, listSessionEnv, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []SessionEnv{}
+	for rows.Next() {
+		var i SessionEnv
+		if err := rows.Scan(
+			&i.SessionID,
+			&i.Name,
+			&i.Value,
+			&i.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const setSessionEnv = `-- name: SetSessionEnv :exec
+INSERT INTO session_env (session_id, name, value, updated_at)
+VALUES (?, ?, ?, ?)
+ON CONFLICT (session_id, name) DO UPDATE SET value = excluded.value, updated_at = excluded.updated_at
+`
+
+type SetSessionEnvParams struct {
+	SessionID string `json:"session_id"`
+	Name      string `json:"name"`
+	Value     string `json:"value"`
+	UpdatedAt int64  `json:"updated_at"`
+}
+
+func (q *Queries) SetSessionEnv(ctx context.Context, arg SetSessionEnvParams) error {
+	_, err := q.db.ExecContext(ctx, setSessionEnv,
+		arg.SessionID,
+		arg.Name,
+		arg.Value,
+		arg.UpdatedAt,
+	)
+	return err
+}
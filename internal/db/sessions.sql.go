@@ -10,6 +10,50 @@ import (
 	"database/sql"
 )
 
+const addSessionUsage = `-- name: AddSessionUsage :one
+UPDATE sessions
+SET prompt_tokens = COALESCE(prompt_tokens, 0) + CAST(?1 AS INTEGER),
+    completion_tokens = COALESCE(completion_tokens, 0) + CAST(?2 AS INTEGER),
+    cost = cost + ?3,
+    updated_at = ?4
+WHERE id = ?5
+RETURNING id, title, model, provider, message_count, prompt_tokens, completion_tokens, created_at, updated_at, cost, language, mode
+`
+
+type AddSessionUsageParams struct {
+	PromptTokens     int64   `json:"prompt_tokens"`
+	CompletionTokens int64   `json:"completion_tokens"`
+	Cost             float64 `json:"cost"`
+	UpdatedAt        int64   `json:"updated_at"`
+	ID               string  `json:"id"`
+}
+
+func (q *Queries) AddSessionUsage(ctx context.Context, arg AddSessionUsageParams) (Session, error) {
+	row := q.db.QueryRowContext(ctx, addSessionUsage,
+		arg.PromptTokens,
+		arg.CompletionTokens,
+		arg.Cost,
+		arg.UpdatedAt,
+		arg.ID,
+	)
+	var i Session
+	err := row.Scan(
+		&i.ID,
+		&i.Title,
+		&i.Model,
+		&i.Provider,
+		&i.MessageCount,
+		&i.PromptTokens,
+		&i.CompletionTokens,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Cost,
+		&i.Language,
+		&i.Mode,
+	)
+	return i, err
+}
+
 const countSessions = `-- name: CountSessions :one
 SELECT COUNT(*) FROM sessions
 `
@@ -24,7 +68,7 @@ func (q *Queries) CountSessions(ctx context.Context) (int64, error) {
 const createSession = `-- name: CreateSession :one
 INSERT INTO sessions (id, title, model, provider, created_at, updated_at)
 VALUES (?, ?, ?, ?, ?, ?)
-RETURNING id, title, model, provider, message_count, prompt_tokens, completion_tokens, created_at, updated_at
+RETURNING id, title, model, provider, message_count, prompt_tokens, completion_tokens, created_at, updated_at, cost, language, mode
 `
 
 type CreateSessionParams struct {
@@ -56,6 +100,9 @@ func (q *Queries) CreateSession(ctx context.Context, arg CreateSessionParams) (S
 		&i.CompletionTokens,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.Cost,
+		&i.Language,
+		&i.Mode,
 	)
 	return i, err
 }
@@ -70,7 +117,7 @@ func (q *Queries) DeleteSession(ctx context.Context, id string) error {
 }
 
 const getSession = `-- name: GetSession :one
-SELECT id, title, model, provider, message_count, prompt_tokens, completion_tokens, created_at, updated_at FROM sessions WHERE id = ?
+SELECT id, title, model, provider, message_count, prompt_tokens, completion_tokens, created_at, updated_at, cost, language, mode FROM sessions WHERE id = ?
 `
 
 func (q *Queries) GetSession(ctx context.Context, id string) (Session, error) {
@@ -86,12 +133,58 @@ func (q *Queries) GetSession(ctx context.Context, id string) (Session, error) {
 		&i.CompletionTokens,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.Cost,
+		&i.Language,
+		&i.Mode,
 	)
 	return i, err
 }
 
+const getSessionCost = `-- name: GetSessionCost :one
+SELECT COALESCE(prompt_tokens, 0) AS prompt_tokens,
+       COALESCE(completion_tokens, 0) AS completion_tokens,
+       cost
+FROM sessions
+WHERE id = ?
+`
+
+type GetSessionCostRow struct {
+	PromptTokens     int64   `json:"prompt_tokens"`
+	CompletionTokens int64   `json:"completion_tokens"`
+	Cost             float64 `json:"cost"`
+}
+
+func (q *Queries) GetSessionCost(ctx context.Context, id string) (GetSessionCostRow, error) {
+	row := q.db.QueryRowContext(ctx, getSessionCost, id)
+	var i GetSessionCostRow
+	err := row.Scan(&i.PromptTokens, &i.CompletionTokens, &i.Cost)
+	return i, err
+}
+
+const getSessionLanguage = `-- name: GetSessionLanguage :one
+SELECT language FROM sessions WHERE id = ?
+`
+
+func (q *Queries) GetSessionLanguage(ctx context.Context, id string) (sql.NullString, error) {
+	row := q.db.QueryRowContext(ctx, getSessionLanguage, id)
+	var language sql.NullString
+	err := row.Scan(&language)
+	return language, err
+}
+
+const getSessionMode = `-- name: GetSessionMode :one
+SELECT mode FROM sessions WHERE id = ?
+`
+
+func (q *Queries) GetSessionMode(ctx context.Context, id string) (sql.NullString, error) {
+	row := q.db.QueryRowContext(ctx, getSessionMode, id)
+	var mode sql.NullString
+	err := row.Scan(&mode)
+	return mode, err
+}
+
 const listSessions = `-- name: ListSessions :many
-SELECT id, title, model, provider, message_count, prompt_tokens, completion_tokens, created_at, updated_at FROM sessions ORDER BY updated_at DESC LIMIT ? OFFSET ?
+SELECT id, title, model, provider, message_count, prompt_tokens, completion_tokens, created_at, updated_at, cost, language, mode FROM sessions ORDER BY updated_at DESC LIMIT ? OFFSET ?
 `
 
 type ListSessionsParams struct {
@@ -118,6 +211,9 @@ func (q *Queries) ListSessions(ctx context.Context, arg ListSessionsParams) ([]S
 			&i.CompletionTokens,
 			&i.CreatedAt,
 			&i.UpdatedAt,
+			&i.Cost,
+			&i.Language,
+			&i.Mode,
 		); err != nil {
 			return nil, err
 		}
@@ -132,6 +228,42 @@ func (q *Queries) ListSessions(ctx context.Context, arg ListSessionsParams) ([]S
 	return items, nil
 }
 
+const setSessionLanguage = `-- name: SetSessionLanguage :exec
+UPDATE sessions
+SET language = ?,
+    updated_at = ?
+WHERE id = ?
+`
+
+type SetSessionLanguageParams struct {
+	Language  sql.NullString `json:"language"`
+	UpdatedAt int64          `json:"updated_at"`
+	ID        string         `json:"id"`
+}
+
+func (q *Queries) SetSessionLanguage(ctx context.Context, arg SetSessionLanguageParams) error {
+	_, err := q.db.ExecContext(ctx, setSessionLanguage, arg.Language, arg.UpdatedAt, arg.ID)
+	return err
+}
+
+const setSessionMode = `-- name: SetSessionMode :exec
+UPDATE sessions
+SET mode = ?,
+    updated_at = ?
+WHERE id = ?
+`
+
+type SetSessionModeParams struct {
+	Mode      sql.NullString `json:"mode"`
+	UpdatedAt int64          `json:"updated_at"`
+	ID        string         `json:"id"`
+}
+
+func (q *Queries) SetSessionMode(ctx context.Context, arg SetSessionModeParams) error {
+	_, err := q.db.ExecContext(ctx, setSessionMode, arg.Mode, arg.UpdatedAt, arg.ID)
+	return err
+}
+
 const updateSession = `-- name: UpdateSession :one
 UPDATE sessions
 SET title = ?,
@@ -140,7 +272,7 @@ SET title = ?,
     completion_tokens = ?,
     updated_at = ?
 WHERE id = ?
-RETURNING id, title, model, provider, message_count, prompt_tokens, completion_tokens, created_at, updated_at
+RETURNING id, title, model, provider, message_count, prompt_tokens, completion_tokens, created_at, updated_at, cost, language, mode
 `
 
 type UpdateSessionParams struct {
@@ -172,6 +304,9 @@ func (q *Queries) UpdateSession(ctx context.Context, arg UpdateSessionParams) (S
 		&i.CompletionTokens,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.Cost,
+		&i.Language,
+		&i.Mode,
 	)
 	return i, err
 }
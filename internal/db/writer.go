@@ -0,0 +1,214 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// MessageWriter batches message inserts so a tool-heavy turn costs one
+// transaction instead of a roundtrip per message. Added messages are held
+// until Commit or Flush writes them with a single prepared statement.
+//
+// With a write-behind delay, Commit schedules the write in the background
+// instead of waiting for it, which keeps concurrent sessions from queueing
+// on SQLite's single writer. Readers must call Flush first to see every
+// message.
+type MessageWriter struct {
+	conn        *sql.DB
+	writeBehind time.Duration
+
+	mu      sync.Mutex // guards pending, timer and err
+	pending []InsertMessageParams
+	timer   *time.Timer
+	err     error // from the last background write
+
+	flushMu sync.Mutex // keeps batches in order
+}
+
+// NewMessageWriter creates a writer. A writeBehind of 0 makes Commit write
+// immediately.
+func NewMessageWriter(conn *sql.DB, writeBehind time.Duration) *MessageWriter {
+	return &MessageWriter{
+		conn:        conn,
+		writeBehind: writeBehind,
+	}
+}
+
+// Add queues a message for the next batch
+func (w *MessageWriter) Add(arg InsertMessageParams) {
+	w.mu.Lock()
+	w.pending = append(w.pending, arg)
+	w.mu.Unlock()
+}
+
+// Commit ends a batch: it writes the queued messages now, or schedules the
+// write when write-behind is enabled
+func (w *MessageWriter) Commit(ctx context.Context) error {
+	if w.writeBehind <= 0 {
+		return w.Flush(ctx)
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.timer == nil && len(w.pending) > 0 {
+		w.timer = time.AfterFunc(w.writeBehind, func() {
+			w.mu.Lock()
+			w.timer = nil
+			w.mu.Unlock()
+
+			if err := w.Flush(context.Background()); err != nil {
+				w.mu.Lock()
+				w.err = err
+				w.mu.Unlock()
+			}
+		})
+	}
+
+	// Report a failed background write to the next caller
+	err := w.err
+	w.err = nil
+	return err
+}
+
+// Flush writes every queued message in one transaction. If the write fails
+// the messages stay queued for the next attempt, except when a message
+// itself can't be inserted because it violates a constraint, such as one
+// of a deleted session: then the messages are written one by one and
+// those failing are dropped, so one bad message never holds up the others.
+func (w *MessageWriter) Flush(ctx context.Context) error {
+	w.flushMu.Lock()
+	defer w.flushMu.Unlock()
+
+	w.mu.Lock()
+	batch := w.pending
+	w.pending = nil
+	w.mu.Unlock()
+
+	if len(batch) == 0 {
+		return nil
+	}
+
+	err := w.write(ctx, batch)
+	var insertErr *insertError
+	if err == nil || !errors.As(err, &insertErr) {
+		if err != nil {
+			w.requeue(batch)
+		}
+		return err
+	}
+
+	var dropped []error
+	for i := range batch {
+		err := w.write(ctx, batch[i:i+1])
+		if errors.As(err, &insertErr) {
+			dropped = append(dropped, err)
+		} else if err != nil {
+			w.requeue(batch[i:])
+			return err
+		}
+	}
+	if len(dropped) == 0 {
+		return nil
+	}
+	return fmt.Errorf("dropped %d messages that could not be written: %w", len(dropped), errors.Join(dropped...))
+}
+
+// requeue puts a batch that failed back in front of the queue
+func (w *MessageWriter) requeue(batch []InsertMessageParams) {
+	w.mu.Lock()
+	w.pending = append(batch, w.pending...)
+	w.mu.Unlock()
+}
+
+// Discard drops the queued messages of a session, waiting for a write in
+// progress to finish, so none of them is written after it returns
+func (w *MessageWriter) Discard(sessionID string) {
+	w.flushMu.Lock()
+	defer w.flushMu.Unlock()
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	kept := w.pending[:0]
+	for _, arg := range w.pending {
+		if arg.SessionID != sessionID {
+			kept = append(kept, arg)
+		}
+	}
+	w.pending = kept
+}
+
+// insertError is the failure to insert one message because of what it
+// holds, such as its session having been deleted, as opposed to the
+// database being busy or locked, which a later attempt may get past
+type insertError struct {
+	id  string
+	err error
+}
+
+func (e *insertError) Error() string {
+	return fmt.Sprintf("failed to insert message %s: %v", e.id, e.err)
+}
+
+func (e *insertError) Unwrap() error {
+	return e.err
+}
+
+func (w *MessageWriter) write(ctx context.Context, batch []InsertMessageParams) error {
+	tx, err := w.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx, insertMessage)
+	if err != nil {
+		return fmt.Errorf("failed to prepare insert: %w", err)
+	}
+	defer stmt.Close()
+
+	for _, arg := range batch {
+		_, err := stmt.ExecContext(ctx,
+			arg.ID,
+			arg.SessionID,
+			arg.Role,
+			arg.Content,
+			arg.Reasoning,
+			arg.Model,
+			arg.Params,
+			arg.Config,
+			arg.ToolCalls,
+			arg.ToolCallID,
+			arg.Interrupted,
+			arg.CreatedAt,
+			arg.UpdatedAt,
+		)
+		if isConstraint(err) {
+			return &insertError{id: arg.ID, err: err}
+		}
+		if err != nil {
+			return fmt.Errorf("failed to insert message %s: %w", arg.ID, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit messages: %w", err)
+	}
+	return nil
+}
+
+// Close writes anything still queued
+func (w *MessageWriter) Close() error {
+	w.mu.Lock()
+	if w.timer != nil {
+		w.timer.Stop()
+		w.timer = nil
+	}
+	w.mu.Unlock()
+
+	return w.Flush(context.Background())
+}
@@ -0,0 +1,323 @@
+package depgraph
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"go/parser"
+	"go/token"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Package is a node in the graph: a Go package or a JavaScript/TypeScript
+// source file, identified by its slash-separated directory or file path
+// relative to the workspace root
+type Package struct {
+	ID       string   `json:"id"`
+	Language string   `json:"language"`
+	Imports  []string `json:"imports"`  // workspace packages this one depends on
+	External []string `json:"external"` // dependencies outside the workspace
+}
+
+// Graph is the import graph of a workspace
+type Graph struct {
+	Root     string
+	Module   string // Go module path, if any
+	Packages map[string]*Package
+
+	dependents map[string][]string
+}
+
+// Options controls what Build includes
+type Options struct {
+	IncludeTests bool
+}
+
+var jsImportPattern = regexp.MustCompile(`(?:import\s+(?:[^'"]*?\s+from\s+)?|require\s*\(\s*|import\s*\(\s*|export\s+[^'"]*?\s+from\s+)['"]([^'"]+)['"]`)
+
+var jsExtensions = []string{".ts", ".tsx", ".js", ".jsx", ".mjs"}
+
+// Build scans root and computes the dependency graph
+func Build(ctx context.Context, root string, opts Options) (*Graph, error) {
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+
+	g := &Graph{
+		Root:     absRoot,
+		Module:   ModulePath(filepath.Join(absRoot, "go.mod")),
+		Packages: make(map[string]*Package),
+	}
+
+	goImports := make(map[string]map[string]bool)
+	err = filepath.WalkDir(absRoot, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		if d.IsDir() {
+			name := d.Name()
+			if p != absRoot && (strings.HasPrefix(name, ".") || name == "node_modules" || name == "vendor" || name == "testdata") {
+				return filepath.SkipDir
+			}
+			// Nested modules are separate graphs
+			if p != absRoot {
+				if _, err := os.Stat(filepath.Join(p, "go.mod")); err == nil {
+					return filepath.SkipDir
+				}
+			}
+			return nil
+		}
+
+		rel, err := filepath.Rel(absRoot, p)
+		if err != nil {
+			return nil
+		}
+		rel = filepath.ToSlash(rel)
+		ext := filepath.Ext(p)
+
+		switch {
+		case ext == ".go":
+			if !opts.IncludeTests && strings.HasSuffix(p, "_test.go") {
+				return nil
+			}
+			file, err := parser.ParseFile(token.NewFileSet(), p, nil, parser.ImportsOnly)
+			if err != nil {
+				return nil
+			}
+			dir := path.Dir(rel)
+			if goImports[dir] == nil {
+				goImports[dir] = make(map[string]bool)
+			}
+			for _, imp := range file.Imports {
+				if importPath, err := strconv.Unquote(imp.Path.Value); err == nil {
+					goImports[dir][importPath] = true
+				}
+			}
+
+		case isJS(ext):
+			if !opts.IncludeTests && (strings.Contains(rel, ".test.") || strings.Contains(rel, ".spec.")) {
+				return nil
+			}
+			g.addJSFile(absRoot, rel)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for dir, imports := range goImports {
+		pkg := &Package{ID: dir, Language: "go"}
+		for importPath := range imports {
+			if g.Module != "" && (importPath == g.Module || strings.HasPrefix(importPath, g.Module+"/")) {
+				local := strings.TrimPrefix(strings.TrimPrefix(importPath, g.Module), "/")
+				if local == "" {
+					local = "."
+				}
+				pkg.Imports = append(pkg.Imports, local)
+			} else {
+				pkg.External = append(pkg.External, importPath)
+			}
+		}
+		g.Packages[dir] = pkg
+	}
+
+	g.index()
+	return g, nil
+}
+
+func (g *Graph) addJSFile(absRoot, rel string) {
+	f, err := os.Open(filepath.Join(absRoot, filepath.FromSlash(rel)))
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	pkg := &Package{ID: rel, Language: "js"}
+	seen := make(map[string]bool)
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		for _, m := range jsImportPattern.FindAllStringSubmatch(scanner.Text(), -1) {
+			spec := m[1]
+			if seen[spec] {
+				continue
+			}
+			seen[spec] = true
+
+			if !strings.HasPrefix(spec, ".") {
+				pkg.External = append(pkg.External, spec)
+				continue
+			}
+			if target := resolveJSImport(absRoot, path.Dir(rel), spec); target != "" {
+				pkg.Imports = append(pkg.Imports, target)
+			}
+		}
+	}
+	g.Packages[rel] = pkg
+}
+
+// resolveJSImport resolves a relative import to a workspace file, trying the
+// usual extension and index file conventions
+func resolveJSImport(absRoot, fromDir, spec string) string {
+	base := path.Clean(path.Join(fromDir, spec))
+	candidates := []string{base}
+	for _, ext := range jsExtensions {
+		candidates = append(candidates, base+ext)
+	}
+	for _, ext := range jsExtensions {
+		candidates = append(candidates, base+"/index"+ext)
+	}
+
+	for _, c := range candidates {
+		if strings.HasPrefix(c, "../") {
+			return ""
+		}
+		info, err := os.Stat(filepath.Join(absRoot, filepath.FromSlash(c)))
+		if err == nil && !info.IsDir() {
+			return c
+		}
+	}
+	return ""
+}
+
+func isJS(ext string) bool {
+	for _, e := range jsExtensions {
+		if ext == e {
+			return true
+		}
+	}
+	return false
+}
+
+// index sorts edges and builds the reverse adjacency list
+func (g *Graph) index() {
+	g.dependents = make(map[string][]string)
+	for id, pkg := range g.Packages {
+		sort.Strings(pkg.Imports)
+		sort.Strings(pkg.External)
+		for _, dep := range pkg.Imports {
+			g.dependents[dep] = append(g.dependents[dep], id)
+		}
+	}
+	for id := range g.dependents {
+		sort.Strings(g.dependents[id])
+	}
+}
+
+// Resolve finds the package a user-supplied name refers to, accepting a
+// relative directory, a file path, or a full Go import path
+func (g *Graph) Resolve(name string) (string, error) {
+	name = strings.TrimSuffix(strings.TrimPrefix(filepath.ToSlash(name), "./"), "/")
+	if g.Module != "" && strings.HasPrefix(name, g.Module) {
+		name = strings.TrimPrefix(strings.TrimPrefix(name, g.Module), "/")
+	}
+	if name == "" {
+		name = "."
+	}
+	if _, ok := g.Packages[name]; ok {
+		return name, nil
+	}
+
+	var matches []string
+	for id := range g.Packages {
+		if strings.HasSuffix(id, "/"+name) {
+			matches = append(matches, id)
+		}
+	}
+	sort.Strings(matches)
+	switch len(matches) {
+	case 0:
+		return "", fmt.Errorf("package not found: %s", name)
+	case 1:
+		return matches[0], nil
+	}
+	return "", fmt.Errorf("%s is ambiguous: %s", name, strings.Join(matches, ", "))
+}
+
+// Dependencies returns what id imports, recursively if transitive is set
+func (g *Graph) Dependencies(id string, transitive bool) []string {
+	return g.walk(id, transitive, func(n string) []string {
+		if pkg, ok := g.Packages[n]; ok {
+			return pkg.Imports
+		}
+		return nil
+	})
+}
+
+// Dependents returns what imports id, recursively if transitive is set
+func (g *Graph) Dependents(id string, transitive bool) []string {
+	return g.walk(id, transitive, func(n string) []string {
+		return g.dependents[n]
+	})
+}
+
+func (g *Graph) walk(start string, transitive bool, next func(string) []string) []string {
+	seen := map[string]bool{start: true}
+	queue := []string{start}
+	var result []string
+
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		for _, n := range next(current) {
+			if seen[n] {
+				continue
+			}
+			seen[n] = true
+			result = append(result, n)
+			if transitive {
+				queue = append(queue, n)
+			}
+		}
+	}
+
+	sort.Strings(result)
+	return result
+}
+
+// DependentCount returns how many packages directly import id
+func (g *Graph) DependentCount(id string) int {
+	return len(g.dependents[id])
+}
+
+// IDs returns all package IDs in sorted order
+func (g *Graph) IDs() []string {
+	ids := make([]string, 0, len(g.Packages))
+	for id := range g.Packages {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// ModulePath returns the module path declared in a go.mod file, or "" if
+// the file can't be read
+func ModulePath(goModPath string) string {
+	f, err := os.Open(goModPath)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "module ") {
+			return strings.Trim(strings.TrimSpace(strings.TrimPrefix(line, "module")), `"`)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,260 @@
+package display
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/omnitrix-sh/core.sh/pkg/models"
+)
+
+// Formatter renders times, sizes and durations for people, in the user's
+// locale and time zone. Anything read by programs, such as stored rows and
+// JSON exports, keeps Unix seconds or RFC 3339 instead.
+type Formatter struct {
+	location *time.Location
+	style    style
+	plain    bool
+}
+
+// style holds the conventions of a locale
+type style struct {
+	dateTime string // time layout with minutes
+	date     string
+	decimal  string // decimal separator
+}
+
+var (
+	styleISO = style{dateTime: "2006-01-02 15:04", date: "2006-01-02", decimal: "."}
+	styleUS  = style{dateTime: "Jan 2, 2006 3:04 PM", date: "Jan 2, 2006", decimal: "."}
+	styleUK  = style{dateTime: "2 Jan 2006 15:04", date: "2 Jan 2006", decimal: "."}
+	// Most of continental Europe writes 02.01.2006 and a decimal comma
+	styleEU = style{dateTime: "02.01.2006 15:04", date: "02.01.2006", decimal: ","}
+	// As in France, Spain, Italy and Latin America
+	styleSlash = style{dateTime: "02/01/2006 15:04", date: "02/01/2006", decimal: ","}
+)
+
+// styles maps languages, and language_REGION where the region matters, to
+// their conventions. Unknown locales use ISO 8601 dates.
+var styles = map[string]style{
+	"en_us": styleUS,
+	"en_gb": styleUK,
+	"en_au": styleUK,
+	"en_ie": styleUK,
+	"en_nz": styleUK,
+	"en_in": styleUK,
+	"de":    styleEU,
+	"da":    styleEU,
+	"fi":    styleEU,
+	"nb":    styleEU,
+	"no":    styleEU,
+	"pl":    styleEU,
+	"ru":    styleEU,
+	"tr":    styleEU,
+	"uk":    styleEU,
+	"cs":    styleEU,
+	"fr":    styleSlash,
+	"es":    styleSlash,
+	"it":    styleSlash,
+	"pt":    styleSlash,
+	"el":    styleSlash,
+	"nl":    {dateTime: "02-01-2006 15:04", date: "02-01-2006", decimal: ","},
+	"sv":    {dateTime: "2006-01-02 15:04", date: "2006-01-02", decimal: ","},
+}
+
+// New creates a Formatter for a locale such as "de_DE" or "en-US" and an
+// IANA time zone such as "Europe/Berlin". Empty values fall back to the
+// LC_ALL, LC_TIME or LANG environment variables and the local time zone.
+func New(locale, timezone string) (*Formatter, error) {
+	location := time.Local
+	if timezone != "" {
+		loc, err := time.LoadLocation(timezone)
+		if err != nil {
+			return nil, fmt.Errorf("invalid timezone %q: %w", timezone, err)
+		}
+		location = loc
+	}
+
+	if locale == "" {
+		locale = envLocale()
+	}
+
+	return &Formatter{
+		location: location,
+		style:    lookupStyle(locale),
+	}, nil
+}
+
+// FromConfig creates a Formatter from the display settings
+func FromConfig(cfg models.DisplayConfig) (*Formatter, error) {
+	f, err := New(cfg.Locale, cfg.Timezone)
+	if err != nil {
+		return nil, err
+	}
+	f.plain = cfg.Plain
+	return f, nil
+}
+
+// WithPlain returns a copy of the formatter with plain output switched on
+// or off
+func (f *Formatter) WithPlain(plain bool) *Formatter {
+	c := *f
+	c.plain = plain
+	return &c
+}
+
+// Plain reports whether output should avoid layout that screen readers
+// handle badly: colors and other escape codes, box drawing and aligned
+// tables
+func (f *Formatter) Plain() bool {
+	return f.plain
+}
+
+func envLocale() string {
+	for _, name := range []string{"LC_ALL", "LC_TIME", "LANG"} {
+		if value := os.Getenv(name); value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// lookupStyle normalizes locale, dropping any encoding or modifier as in
+// "de_DE.UTF-8@euro", and finds its conventions
+func lookupStyle(locale string) style {
+	locale = strings.ToLower(strings.ReplaceAll(locale, "-", "_"))
+	if i := strings.IndexAny(locale, ".@"); i >= 0 {
+		locale = locale[:i]
+	}
+	if s, ok := styles[locale]; ok {
+		return s
+	}
+	language, _, _ := strings.Cut(locale, "_")
+	if s, ok := styles[language]; ok {
+		return s
+	}
+	if language == "en" {
+		return styleUS
+	}
+	return styleISO
+}
+
+// Time formats a time to the minute in the user's time zone
+func (f *Formatter) Time(t time.Time) string {
+	return t.In(f.location).Format(f.style.dateTime)
+}
+
+// Date formats the date of a time in the user's time zone
+func (f *Formatter) Date(t time.Time) string {
+	return t.In(f.location).Format(f.style.date)
+}
+
+// Unix formats a stored Unix timestamp
+func (f *Formatter) Unix(seconds int64) string {
+	return f.Time(time.Unix(seconds, 0))
+}
+
+// Size formats a byte count with binary units, e.g. "1.5 MB"
+func (f *Formatter) Size(bytes int64) string {
+	const (
+		KB = 1024
+		MB = 1024 * KB
+		GB = 1024 * MB
+	)
+
+	switch {
+	case bytes >= GB:
+		return f.Decimal(float64(bytes)/GB, 1) + " GB"
+	case bytes >= MB:
+		return f.Decimal(float64(bytes)/MB, 1) + " MB"
+	case bytes >= KB:
+		return f.Decimal(float64(bytes)/KB, 1) + " KB"
+	default:
+		return fmt.Sprintf("%d B", bytes)
+	}
+}
+
+// Duration formats a duration with at most two units, e.g. "850ms",
+// "4.2s", "3m 5s" or "2h 10m"
+func (f *Formatter) Duration(d time.Duration) string {
+	if d < 0 {
+		return "-" + f.Duration(-d)
+	}
+
+	switch {
+	case d < time.Second:
+		return fmt.Sprintf("%dms", d.Milliseconds())
+	case d < time.Minute:
+		return f.Decimal(d.Seconds(), 1) + "s"
+	case d < time.Hour:
+		d = d.Round(time.Second)
+		return fmt.Sprintf("%dm %ds", int(d.Minutes()), int(d.Seconds())%60)
+	default:
+		d = d.Round(time.Minute)
+		return fmt.Sprintf("%dh %dm", int(d.Hours()), int(d.Minutes())%60)
+	}
+}
+
+// Decimal formats a number with the given number of decimals and the
+// locale's decimal separator
+func (f *Formatter) Decimal(value float64, decimals int) string {
+	s := fmt.Sprintf("%.*f", decimals, value)
+	if f.style.decimal != "." {
+		s = strings.Replace(s, ".", f.style.decimal, 1)
+	}
+	return s
+}
+
+var (
+	mu         sync.RWMutex
+	defaultFmt = mustNew("", "")
+)
+
+func mustNew(locale, timezone string) *Formatter {
+	f, err := New(locale, timezone)
+	if err != nil {
+		panic(err)
+	}
+	return f
+}
+
+// SetDefault replaces the formatter used by the package functions, usually
+// once at startup with one created from config
+func SetDefault(f *Formatter) {
+	mu.Lock()
+	defer mu.Unlock()
+	defaultFmt = f
+}
+
+// Default returns the formatter used by the package functions
+func Default() *Formatter {
+	mu.RLock()
+	defer mu.RUnlock()
+	return defaultFmt
+}
+
+// Time formats t with the default formatter
+func Time(t time.Time) string { return Default().Time(t) }
+
+// Date formats the date of t with the default formatter
+func Date(t time.Time) string { return Default().Date(t) }
+
+// Unix formats a Unix timestamp with the default formatter
+func Unix(seconds int64) string { return Default().Unix(seconds) }
+
+// Size formats a byte count with the default formatter
+func Size(bytes int64) string { return Default().Size(bytes) }
+
+// Duration formats d with the default formatter
+func Duration(d time.Duration) string { return Default().Duration(d) }
+
+// Plain reports whether the default formatter is in plain mode
+func Plain() bool { return Default().Plain() }
+
+// Table renders rows with the default formatter
+func Table(headers []string, rows [][]string) string { return Default().Table(headers, rows) }
+
+// Text cleans program output with the default formatter
+func Text(s string) string { return Default().Text(s) }
@@ -0,0 +1,122 @@
+package display
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// columnGap separates table columns
+const columnGap = "  "
+
+// Table renders rows as columns under headers, which may be nil. Columns
+// holding only numbers are right-aligned. In plain mode each row becomes a
+// line of "header value" pairs instead, which reads naturally aloud.
+func (f *Formatter) Table(headers []string, rows [][]string) string {
+	if f.plain {
+		return plainTable(headers, rows)
+	}
+
+	columns := len(headers)
+	for _, row := range rows {
+		if len(row) > columns {
+			columns = len(row)
+		}
+	}
+
+	widths := make([]int, columns)
+	numeric := make([]bool, columns)
+	for i := range numeric {
+		numeric[i] = len(rows) > 0
+	}
+	measure := func(row []string, header bool) {
+		for i, cell := range row {
+			if n := utf8.RuneCountInString(cell); n > widths[i] {
+				widths[i] = n
+			}
+			if !header && !isNumber(cell) {
+				numeric[i] = false
+			}
+		}
+	}
+	measure(headers, true)
+	for _, row := range rows {
+		measure(row, false)
+	}
+
+	var sb strings.Builder
+	writeRow := func(row []string) {
+		var line strings.Builder
+		for i := 0; i < columns; i++ {
+			cell := ""
+			if i < len(row) {
+				cell = row[i]
+			}
+			pad := strings.Repeat(" ", widths[i]-utf8.RuneCountInString(cell))
+			if i > 0 {
+				line.WriteString(columnGap)
+			}
+			if numeric[i] {
+				line.WriteString(pad + cell)
+			} else {
+				line.WriteString(cell + pad)
+			}
+		}
+		sb.WriteString(strings.TrimRight(line.String(), " "))
+		sb.WriteString("\n")
+	}
+
+	if len(headers) > 0 {
+		writeRow(headers)
+	}
+	for _, row := range rows {
+		writeRow(row)
+	}
+	return sb.String()
+}
+
+func plainTable(headers []string, rows [][]string) string {
+	var sb strings.Builder
+	for _, row := range rows {
+		var cells []string
+		for i, cell := range row {
+			if cell == "" {
+				continue
+			}
+			if i < len(headers) && headers[i] != "" {
+				cell = strings.ToLower(headers[i]) + " " + cell
+			}
+			cells = append(cells, cell)
+		}
+		sb.WriteString(strings.Join(cells, ", "))
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
+func isNumber(s string) bool {
+	_, err := strconv.ParseFloat(s, 64)
+	return err == nil
+}
+
+// ansiEscape matches terminal escape sequences: CSI sequences such as
+// colors and cursor movement, and OSC sequences such as hyperlinks
+var ansiEscape = regexp.MustCompile(`\x1b\[[0-9;?]*[ -/]*[@-~]|\x1b\][^\x07\x1b]*(?:\x07|\x1b\\)|\x1b[@-Z\\-_]`)
+
+// Text cleans program output for display. In plain mode escape sequences
+// are removed, so colored output is not read out as control codes.
+func (f *Formatter) Text(s string) string {
+	if !f.plain {
+		return s
+	}
+	return StripANSI(s)
+}
+
+// StripANSI removes terminal escape sequences from s
+func StripANSI(s string) string {
+	if !strings.Contains(s, "\x1b") {
+		return s
+	}
+	return ansiEscape.ReplaceAllString(s, "")
+}
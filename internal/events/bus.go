@@ -0,0 +1,179 @@
+// Package events lets frontends follow what the agent is doing as it
+// happens instead of polling the database
+package events
+
+import (
+	"sync"
+	"time"
+
+	"github.com/omnitrix-sh/core.sh/internal/permissions"
+	"github.com/omnitrix-sh/core.sh/pkg/models"
+)
+
+// defaultBuffer is how many events a subscriber can fall behind before
+// events are dropped for it
+const defaultBuffer = 64
+
+// Type identifies what an event reports
+type Type string
+
+const (
+	// TypeStatus reports what a run is waiting on, see Status
+	TypeStatus Type = "status"
+	// TypeMessage reports a message added to the session, in Message
+	TypeMessage Type = "message"
+	// TypeToolStarted and TypeToolFinished report a tool run, in Tool
+	TypeToolStarted  Type = "tool_started"
+	TypeToolFinished Type = "tool_finished"
+	// TypeToolOutput reports output of a running tool as it is produced,
+	// such as a command's, in Tool.Output
+	TypeToolOutput Type = "tool_output"
+	// TypeDelta reports a piece of a streamed response, in Delta
+	TypeDelta Type = "delta"
+	// TypePermission reports that a tool run waits for the user's
+	// approval, in Permission
+	TypePermission Type = "permission"
+	// TypeQuestion reports that the model asked the user a question with
+	// the ask_user tool and waits for the answer, in Question
+	TypeQuestion Type = "question"
+	// TypeRunCompleted reports the end of a run with its answer, in Run
+	TypeRunCompleted Type = "run_completed"
+	// TypeError reports a run that failed, in Error
+	TypeError Type = "error"
+	// TypeConfigChanged reports that the config files changed and what of
+	// it running agents picked up, in Config. It belongs to no session.
+	TypeConfigChanged Type = "config_changed"
+)
+
+// Event is published on a Bus. The field matching Type carries the details.
+type Event struct {
+	Type      Type      `json:"type"`
+	SessionID string    `json:"session_id"`
+	Time      time.Time `json:"time"`
+
+	Status     *Status               `json:"status,omitempty"`
+	Message    *models.Message       `json:"message,omitempty"`
+	Tool       *Tool                 `json:"tool,omitempty"`
+	Delta      *Delta                `json:"delta,omitempty"`
+	Permission *permissions.Request  `json:"permission,omitempty"`
+	Question   *permissions.Question `json:"question,omitempty"`
+	Run        *Run                  `json:"run,omitempty"`
+	Error      *Error                `json:"error,omitempty"`
+	Config     *ConfigChange         `json:"config,omitempty"`
+}
+
+// Tool is a tool call being run. Result, Error and DurationMS are set once
+// it finished.
+type Tool struct {
+	CallID     string                 `json:"call_id"`
+	Name       string                 `json:"name"`
+	Arguments  map[string]interface{} `json:"arguments,omitempty"`
+	Result     string                 `json:"result,omitempty"`
+	Output     string                 `json:"output,omitempty"`
+	Error      string                 `json:"error,omitempty"`
+	DurationMS int64                  `json:"duration_ms,omitempty"`
+}
+
+// Delta is a piece of a streamed response
+type Delta struct {
+	Kind models.ChunkKind `json:"kind,omitempty"`
+	Text string           `json:"text"`
+}
+
+// Run is a finished run
+type Run struct {
+	Content    string `json:"content"` // the final answer
+	DurationMS int64  `json:"duration_ms"`
+}
+
+// ConfigChange is a reload of the config. Settings in Applied took effect
+// at once; those in Restart only do once Omnitrix is started again. Error
+// is set instead when the new config couldn't be loaded or applied, and
+// the old one stays.
+type ConfigChange struct {
+	Applied []string `json:"applied,omitempty"`
+	Restart []string `json:"restart,omitempty"`
+	Error   string   `json:"error,omitempty"`
+}
+
+// Error is why a run failed
+type Error struct {
+	Message string `json:"message"`
+}
+
+// Bus delivers events to subscribers. Publishing never blocks: a
+// subscriber that falls behind misses events rather than holding up the
+// agent. A nil Bus discards everything.
+type Bus struct {
+	mu   sync.RWMutex
+	subs map[*subscriber]struct{}
+}
+
+type subscriber struct {
+	sessionID string
+	types     map[Type]bool // nil for every type
+	ch        chan Event
+}
+
+// NewBus creates an empty bus
+func NewBus() *Bus {
+	return &Bus{subs: make(map[*subscriber]struct{})}
+}
+
+// Subscribe returns a channel receiving the events of a session, or of
+// every session if sessionID is "", and a function that ends the
+// subscription and closes the channel. Events of no session, such as
+// TypeConfigChanged, are received either way. A buffer of 0 uses the default.
+// With types, only events of those types are received.
+func (b *Bus) Subscribe(sessionID string, buffer int, types ...Type) (<-chan Event, func()) {
+	if buffer <= 0 {
+		buffer = defaultBuffer
+	}
+	sub := &subscriber{sessionID: sessionID, ch: make(chan Event, buffer)}
+	if len(types) > 0 {
+		sub.types = make(map[Type]bool, len(types))
+		for _, t := range types {
+			sub.types[t] = true
+		}
+	}
+
+	b.mu.Lock()
+	b.subs[sub] = struct{}{}
+	b.mu.Unlock()
+
+	var once sync.Once
+	return sub.ch, func() {
+		once.Do(func() {
+			b.mu.Lock()
+			delete(b.subs, sub)
+			b.mu.Unlock()
+			close(sub.ch)
+		})
+	}
+}
+
+// Publish sends an event to the subscribers of its session, or to every
+// subscriber if it belongs to none
+func (b *Bus) Publish(e Event) {
+	if b == nil {
+		return
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for sub := range b.subs {
+		if sub.sessionID != "" && e.SessionID != "" && sub.sessionID != e.SessionID {
+			continue
+		}
+		if sub.types != nil && !sub.types[e.Type] {
+			continue
+		}
+		select {
+		case sub.ch <- e:
+		default:
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package events
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/omnitrix-sh/core.sh/internal/display"
+)
+
+// statusInterval is how often a status is republished while a run stays
+// in the same state
+const statusInterval = time.Second
+
+// State is what a run is doing while the user waits
+type State string
+
+const (
+	// StateQueued: the request was sent and the provider hasn't started
+	// answering, e.g. while a local model loads
+	StateQueued State = "queued"
+	// StateWaiting: the provider is working on the request and the first
+	// token is pending
+	StateWaiting State = "waiting"
+	// StateThinking: the model is producing reasoning before its answer
+	StateThinking State = "thinking"
+	// StateStreaming: the answer is arriving
+	StateStreaming State = "streaming"
+	// StateTool: a tool is running
+	StateTool State = "tool"
+	// StateDone: the run finished
+	StateDone State = "done"
+)
+
+// Status is published when a run changes state, and every second while it
+// stays in a state other than streaming, so frontends can show that a slow
+// model is still working
+type Status struct {
+	State     State  `json:"state"`
+	Tool      string `json:"tool,omitempty"`
+	ElapsedMS int64  `json:"elapsed_ms"` // time spent in the state
+	Message   string `json:"message"`    // for display, e.g. "Running exec (3.2s)"
+}
+
+// Reporter publishes the status of one run. A nil Reporter does nothing.
+type Reporter struct {
+	bus       *Bus
+	sessionID string
+	provider  string
+
+	mu    sync.Mutex
+	state State
+	tool  string
+	since time.Time
+
+	stop chan struct{}
+	once sync.Once
+}
+
+// NewReporter starts reporting the status of a run on the bus, or returns
+// nil if bus is nil. Stop must be called when the run ends.
+func NewReporter(bus *Bus, sessionID, provider string) *Reporter {
+	if bus == nil {
+		return nil
+	}
+	r := &Reporter{
+		bus:       bus,
+		sessionID: sessionID,
+		provider:  provider,
+		stop:      make(chan struct{}),
+	}
+	go r.run()
+	return r
+}
+
+// Set moves the run to a state, publishing it if it changed. tool names
+// the running tool for StateTool.
+func (r *Reporter) Set(state State, tool string) {
+	if r == nil {
+		return
+	}
+
+	r.mu.Lock()
+	if r.state == state && r.tool == tool {
+		r.mu.Unlock()
+		return
+	}
+	r.state, r.tool, r.since = state, tool, time.Now()
+	r.mu.Unlock()
+
+	r.publish()
+}
+
+// Stop publishes StateDone and ends the periodic updates
+func (r *Reporter) Stop() {
+	if r == nil {
+		return
+	}
+	r.once.Do(func() {
+		close(r.stop)
+		r.Set(StateDone, "")
+	})
+}
+
+func (r *Reporter) run() {
+	ticker := time.NewTicker(statusInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			r.mu.Lock()
+			state := r.state
+			r.mu.Unlock()
+			// Streamed text shows progress by itself
+			if state != "" && state != StateStreaming {
+				r.publish()
+			}
+		case <-r.stop:
+			return
+		}
+	}
+}
+
+func (r *Reporter) publish() {
+	r.mu.Lock()
+	elapsed := time.Since(r.since)
+	status := Status{
+		State:     r.state,
+		Tool:      r.tool,
+		ElapsedMS: elapsed.Milliseconds(),
+	}
+	r.mu.Unlock()
+	status.Message = describe(status, r.provider, elapsed)
+
+	r.bus.Publish(Event{Type: TypeStatus, SessionID: r.sessionID, Status: &status})
+}
+
+func describe(s Status, provider string, elapsed time.Duration) string {
+	d := display.Duration(elapsed.Round(100 * time.Millisecond))
+	switch s.State {
+	case StateQueued:
+		return fmt.Sprintf("Waiting for %s to start (%s)", provider, d)
+	case StateWaiting:
+		return fmt.Sprintf("Waiting for the first token (%s)", d)
+	case StateThinking:
+		return fmt.Sprintf("Thinking (%s)", d)
+	case StateStreaming:
+		return "Writing the response"
+	case StateTool:
+		return fmt.Sprintf("Running %s (%s)", s.Tool, d)
+	case StateDone:
+		return "Done"
+	}
+	return string(s.State)
+}
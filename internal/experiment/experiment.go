@@ -0,0 +1,417 @@
+// Package experiment compares two variants of the system prompt or the
+// sampling parameters on real turns. Recorded assistant turns are sent
+// again under both variants, on demand or sampled in the background as
+// they happen, and the metrics of each run are appended to a JSONL file
+// that Summarize turns into a report.
+package experiment
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/omnitrix-sh/core.sh/internal/agent"
+	"github.com/omnitrix-sh/core.sh/internal/display"
+	"github.com/omnitrix-sh/core.sh/internal/events"
+	"github.com/omnitrix-sh/core.sh/pkg/models"
+)
+
+const (
+	VariantA = "a"
+	VariantB = "b"
+)
+
+// pageSize is how many messages CompareSession reads at once
+const pageSize = 100
+
+var validName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// Experiment runs the two variants of a config against an agent
+type Experiment struct {
+	agent *agent.Agent
+	cfg   models.ExperimentConfig
+	path  string
+
+	mu sync.Mutex // guards appending to path
+	wg sync.WaitGroup
+	// sem holds a slot while a sampled comparison runs
+	sem chan struct{}
+}
+
+// Result is the outcome of running one variant on one turn
+type Result struct {
+	Experiment string    `json:"experiment"`
+	Variant    string    `json:"variant"`
+	MessageID  string    `json:"message_id"`
+	SessionID  string    `json:"session_id"`
+	Time       time.Time `json:"time"`
+	DurationMS int64     `json:"duration_ms"`
+
+	PromptTokens     int      `json:"prompt_tokens,omitempty"`
+	CompletionTokens int      `json:"completion_tokens,omitempty"`
+	ResponseLength   int      `json:"response_length"`
+	ToolCalls        []string `json:"tool_calls,omitempty"`
+	// SameTools tells whether the variant called the same tools, in the
+	// same order, as the recorded turn
+	SameTools bool `json:"same_tools"`
+
+	Error string `json:"error,omitempty"`
+}
+
+// New creates an Experiment from config, writing its results under
+// dataDir. It returns nil when no experiment is configured.
+func New(a *agent.Agent, cfg models.ExperimentConfig, dataDir string) (*Experiment, error) {
+	if cfg.Name == "" {
+		return nil, nil
+	}
+	if !validName.MatchString(cfg.Name) {
+		return nil, fmt.Errorf("invalid experiment name %q: use letters, digits, '.', '_' and '-'", cfg.Name)
+	}
+	if cfg.SampleRate < 0 || cfg.SampleRate > 1 {
+		return nil, fmt.Errorf("invalid experiment sample rate %v: must be between 0 and 1", cfg.SampleRate)
+	}
+	a1, b1 := cfg.A, cfg.B
+	a1.Name, b1.Name = "", ""
+	if reflect.DeepEqual(a1, b1) {
+		return nil, fmt.Errorf("experiment %s: variants a and b are the same", cfg.Name)
+	}
+
+	dir := filepath.Join(dataDir, "experiments")
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create experiment directory: %w", err)
+	}
+	return &Experiment{
+		agent: a,
+		cfg:   cfg,
+		path:  filepath.Join(dir, cfg.Name+".jsonl"),
+		sem:   make(chan struct{}, 1),
+	}, nil
+}
+
+// Path returns the file the results are appended to
+func (e *Experiment) Path() string {
+	return e.path
+}
+
+// Compare runs both variants on a recorded assistant message and records
+// the results. The variants run one after the other, in random order, so
+// neither always gets a warm provider.
+func (e *Experiment) Compare(ctx context.Context, msg models.Message) ([]Result, error) {
+	if msg.Role != models.RoleAssistant || msg.Params == nil {
+		return nil, fmt.Errorf("message %s has no recorded run parameters", msg.ID)
+	}
+
+	order := []string{VariantA, VariantB}
+	if rand.Intn(2) == 1 {
+		order[0], order[1] = order[1], order[0]
+	}
+	results := make([]Result, 0, len(order))
+	for _, name := range order {
+		variant := e.cfg.A
+		if name == VariantB {
+			variant = e.cfg.B
+		}
+		results = append(results, e.run(ctx, msg, name, variant))
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+	}
+	sort.Slice(results, func(i, j int) bool { return results[i].Variant < results[j].Variant })
+
+	if err := e.record(results); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// CompareSession runs Compare on every recorded assistant turn of a
+// session, oldest first
+func (e *Experiment) CompareSession(ctx context.Context, sessionID string) ([]Result, error) {
+	var turns []models.Message
+	before := ""
+	for {
+		page, err := e.agent.Messages(ctx, sessionID, before, pageSize)
+		if err != nil {
+			return nil, err
+		}
+		for i := len(page.Messages) - 1; i >= 0; i-- {
+			msg := page.Messages[i]
+			if msg.Role == models.RoleAssistant && msg.Params != nil {
+				turns = append(turns, msg)
+			}
+		}
+		if page.Older == "" {
+			break
+		}
+		before = page.Older
+	}
+
+	var results []Result
+	for i := len(turns) - 1; i >= 0; i-- {
+		r, err := e.Compare(ctx, turns[i])
+		if err != nil {
+			return results, err
+		}
+		results = append(results, r...)
+	}
+	return results, nil
+}
+
+// Sample compares a share of the assistant turns published on bus, as
+// given by the config's sample rate. Only one comparison runs at a time;
+// turns arriving meanwhile are skipped rather than queued. Call stop to
+// end sampling; it lets a running comparison finish, so cancel ctx to
+// abandon it.
+func (e *Experiment) Sample(ctx context.Context, bus *events.Bus) (stop func()) {
+	if e == nil || bus == nil || e.cfg.SampleRate <= 0 {
+		return func() {}
+	}
+	ch, unsubscribe := bus.Subscribe("", 16, events.TypeMessage)
+
+	e.wg.Add(1)
+	go func() {
+		defer e.wg.Done()
+		for event := range ch {
+			msg := event.Message
+			if msg == nil || msg.ID == "" || msg.Role != models.RoleAssistant || msg.Params == nil {
+				continue
+			}
+			if rand.Float64() >= e.cfg.SampleRate {
+				continue
+			}
+			select {
+			case e.sem <- struct{}{}:
+			default:
+				continue
+			}
+			e.wg.Add(1)
+			go func(msg models.Message) {
+				defer e.wg.Done()
+				defer func() { <-e.sem }()
+				e.Compare(ctx, msg)
+			}(*msg)
+		}
+	}()
+
+	return func() {
+		unsubscribe()
+		e.wg.Wait()
+	}
+}
+
+// run sends a turn again under one variant
+func (e *Experiment) run(ctx context.Context, msg models.Message, name string, variant models.PromptVariant) Result {
+	r := Result{
+		Experiment: e.cfg.Name,
+		Variant:    name,
+		MessageID:  msg.ID,
+		SessionID:  msg.SessionID,
+		Time:       time.Now(),
+	}
+	started := time.Now()
+	response, err := e.agent.ReplayVariant(ctx, msg.ID, variant)
+	r.DurationMS = time.Since(started).Milliseconds()
+	if err != nil {
+		r.Error = err.Error()
+		return r
+	}
+
+	r.PromptTokens = response.Usage.PromptTokens
+	r.CompletionTokens = response.Usage.CompletionTokens
+	r.ResponseLength = len([]rune(response.Content))
+	for _, call := range response.ToolCalls {
+		r.ToolCalls = append(r.ToolCalls, call.Function.Name)
+	}
+	recorded := make([]string, 0, len(msg.ToolCalls))
+	for _, call := range msg.ToolCalls {
+		recorded = append(recorded, call.Function.Name)
+	}
+	r.SameTools = strings.Join(r.ToolCalls, "\n") == strings.Join(recorded, "\n")
+	return r
+}
+
+// record appends results to the experiment's file
+func (e *Experiment) record(results []Result) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	f, err := os.OpenFile(e.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open experiment results: %w", err)
+	}
+	defer f.Close()
+	enc := json.NewEncoder(f)
+	for _, r := range results {
+		if err := enc.Encode(r); err != nil {
+			return fmt.Errorf("failed to write experiment results: %w", err)
+		}
+	}
+	return nil
+}
+
+// Load reads the results of an experiment file
+func Load(path string) ([]Result, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open experiment results: %w", err)
+	}
+	defer f.Close()
+
+	var results []Result
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		var r Result
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		results = append(results, r)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read experiment results: %w", err)
+	}
+	return results, nil
+}
+
+// Summary aggregates the runs of one variant. Means leave out failed runs.
+type Summary struct {
+	Runs                 int     `json:"runs"`
+	Errors               int     `json:"errors"`
+	MeanDurationMS       float64 `json:"mean_duration_ms"`
+	MeanPromptTokens     float64 `json:"mean_prompt_tokens"`
+	MeanCompletionTokens float64 `json:"mean_completion_tokens"`
+	MeanResponseLength   float64 `json:"mean_response_length"`
+	// ToolCallRate is the share of runs that called a tool
+	ToolCallRate float64 `json:"tool_call_rate"`
+	// SameToolsRate is the share of runs that called the tools of the
+	// recorded turn
+	SameToolsRate float64 `json:"same_tools_rate"`
+}
+
+// Report compares the variants of an experiment
+type Report struct {
+	Experiment string  `json:"experiment"`
+	Turns      int     `json:"turns"`
+	A          Summary `json:"a"`
+	B          Summary `json:"b"`
+	// Disagreements counts the turns where both variants succeeded but
+	// called different tools
+	Disagreements int `json:"disagreements"`
+}
+
+// Summarize aggregates results per variant
+func Summarize(results []Result) *Report {
+	report := &Report{}
+	type pair struct{ a, b *Result }
+	turns := make(map[string]*pair)
+	var sumA, sumB sums
+	for i := range results {
+		r := &results[i]
+		if report.Experiment == "" {
+			report.Experiment = r.Experiment
+		}
+		p := turns[r.MessageID]
+		if p == nil {
+			p = &pair{}
+			turns[r.MessageID] = p
+		}
+		switch r.Variant {
+		case VariantA:
+			p.a = r
+			sumA.add(r)
+		case VariantB:
+			p.b = r
+			sumB.add(r)
+		}
+	}
+	report.Turns = len(turns)
+	report.A = sumA.summary()
+	report.B = sumB.summary()
+	for _, p := range turns {
+		if p.a == nil || p.b == nil || p.a.Error != "" || p.b.Error != "" {
+			continue
+		}
+		if strings.Join(p.a.ToolCalls, "\n") != strings.Join(p.b.ToolCalls, "\n") {
+			report.Disagreements++
+		}
+	}
+	return report
+}
+
+// sums accumulates the results of one variant
+type sums struct {
+	runs, errors, ok, toolRuns, sameTools int
+	duration, prompt, completion, length  float64
+}
+
+func (s *sums) add(r *Result) {
+	s.runs++
+	if r.Error != "" {
+		s.errors++
+		return
+	}
+	s.ok++
+	s.duration += float64(r.DurationMS)
+	s.prompt += float64(r.PromptTokens)
+	s.completion += float64(r.CompletionTokens)
+	s.length += float64(r.ResponseLength)
+	if len(r.ToolCalls) > 0 {
+		s.toolRuns++
+	}
+	if r.SameTools {
+		s.sameTools++
+	}
+}
+
+func (s *sums) summary() Summary {
+	summary := Summary{Runs: s.runs, Errors: s.errors}
+	if s.ok == 0 {
+		return summary
+	}
+	n := float64(s.ok)
+	summary.MeanDurationMS = s.duration / n
+	summary.MeanPromptTokens = s.prompt / n
+	summary.MeanCompletionTokens = s.completion / n
+	summary.MeanResponseLength = s.length / n
+	summary.ToolCallRate = float64(s.toolRuns) / n
+	summary.SameToolsRate = float64(s.sameTools) / n
+	return summary
+}
+
+// String renders the report as a table
+func (r *Report) String() string {
+	row := func(name string, a, b string) []string { return []string{name, a, b} }
+	number := func(v float64) string { return fmt.Sprintf("%.1f", v) }
+	percent := func(v float64) string { return fmt.Sprintf("%.0f%%", v*100) }
+	rows := [][]string{
+		row("Runs", fmt.Sprint(r.A.Runs), fmt.Sprint(r.B.Runs)),
+		row("Errors", fmt.Sprint(r.A.Errors), fmt.Sprint(r.B.Errors)),
+		row("Duration (ms)", number(r.A.MeanDurationMS), number(r.B.MeanDurationMS)),
+		row("Prompt tokens", number(r.A.MeanPromptTokens), number(r.B.MeanPromptTokens)),
+		row("Completion tokens", number(r.A.MeanCompletionTokens), number(r.B.MeanCompletionTokens)),
+		row("Response length", number(r.A.MeanResponseLength), number(r.B.MeanResponseLength)),
+		row("Called a tool", percent(r.A.ToolCallRate), percent(r.B.ToolCallRate)),
+		row("Same tools as recorded", percent(r.A.SameToolsRate), percent(r.B.SameToolsRate)),
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Experiment %s: %d turns, variants disagree on tools in %d\n\n", r.Experiment, r.Turns, r.Disagreements)
+	sb.WriteString(display.Table([]string{"", "A", "B"}, rows))
+	return sb.String()
+}
@@ -0,0 +1,335 @@
+package export
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/omnitrix-sh/core.sh/internal/db"
+	"github.com/omnitrix-sh/core.sh/internal/redact"
+	"github.com/omnitrix-sh/core.sh/pkg/models"
+)
+
+// Format is a fine-tuning dataset format
+type Format string
+
+const (
+	// FormatOpenAI is the chat fine-tuning format: {"messages": [...]}
+	FormatOpenAI Format = "openai"
+	// FormatShareGPT is the {"conversations": [{"from", "value"}]} format
+	// used by most local fine-tuning tools
+	FormatShareGPT Format = "sharegpt"
+)
+
+// FineTuneOptions controls how sessions are converted
+type FineTuneOptions struct {
+	Format Format
+
+	// SystemPrompt is prepended to every example when set
+	SystemPrompt string
+
+	// Tools are the tool definitions included with every example, so the
+	// fine-tuned model learns the same schema it will be served with
+	Tools []models.Tool
+
+	// MinAssistantTurns skips sessions with fewer assistant replies
+	MinAssistantTurns int
+
+	// DisableRedaction keeps secrets in the output. Only use this for data
+	// that never leaves the machine.
+	DisableRedaction bool
+}
+
+// FineTuneStats summarizes an export
+type FineTuneStats struct {
+	Sessions   int
+	Skipped    int
+	Messages   int
+	Redactions int
+}
+
+// Exporter converts stored sessions into other formats
+type Exporter struct {
+	queries  *db.Queries
+	redactor *redact.Redactor
+}
+
+// NewExporter creates an exporter reading through queries. Exports scan
+// whole sessions, so prefer queries on a db.ConnectReadOnly pool.
+func NewExporter(queries *db.Queries) *Exporter {
+	return &Exporter{
+		queries:  queries,
+		redactor: redact.New(),
+	}
+}
+
+// FineTune writes one JSONL example per session. If sessionIDs is empty every
+// session is exported. Sessions without a complete assistant reply are
+// skipped rather than failing the whole export.
+func (e *Exporter) FineTune(ctx context.Context, w io.Writer, sessionIDs []string, opts FineTuneOptions) (FineTuneStats, error) {
+	var stats FineTuneStats
+
+	if opts.Format == "" {
+		opts.Format = FormatOpenAI
+	}
+	if opts.Format != FormatOpenAI && opts.Format != FormatShareGPT {
+		return stats, fmt.Errorf("unsupported format: %s (use openai or sharegpt)", opts.Format)
+	}
+
+	if len(sessionIDs) == 0 {
+		ids, err := e.allSessionIDs(ctx)
+		if err != nil {
+			return stats, err
+		}
+		sessionIDs = ids
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+
+	for _, id := range sessionIDs {
+		if err := ctx.Err(); err != nil {
+			return stats, err
+		}
+
+		messages, err := e.loadMessages(ctx, id)
+		if err != nil {
+			return stats, err
+		}
+
+		messages = trimTrajectory(messages)
+		if countRole(messages, models.RoleAssistant) < max(opts.MinAssistantTurns, 1) {
+			stats.Skipped++
+			continue
+		}
+
+		if opts.SystemPrompt != "" && (len(messages) == 0 || messages[0].Role != models.RoleSystem) {
+			messages = append([]models.Message{{Role: models.RoleSystem, Content: opts.SystemPrompt}}, messages...)
+		}
+
+		if !opts.DisableRedaction {
+			stats.Redactions += e.redactMessages(messages)
+		}
+
+		var example interface{}
+		switch opts.Format {
+		case FormatShareGPT:
+			example = toShareGPT(messages, opts.Tools)
+		default:
+			example = toOpenAI(messages, opts.Tools)
+		}
+
+		if err := encoder.Encode(example); err != nil {
+			return stats, fmt.Errorf("failed to write example: %w", err)
+		}
+		stats.Sessions++
+		stats.Messages += len(messages)
+	}
+
+	return stats, nil
+}
+
+func (e *Exporter) allSessionIDs(ctx context.Context) ([]string, error) {
+	count, err := e.queries.CountSessions(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count sessions: %w", err)
+	}
+
+	sessions, err := e.queries.ListSessions(ctx, db.ListSessionsParams{Limit: count, Offset: 0})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sessions: %w", err)
+	}
+
+	ids := make([]string, len(sessions))
+	for i, s := range sessions {
+		ids[i] = s.ID
+	}
+	return ids, nil
+}
+
+func (e *Exporter) loadMessages(ctx context.Context, sessionID string) ([]models.Message, error) {
+	rows, err := e.queries.ListMessagesBySession(ctx, sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load messages for session %s: %w", sessionID, err)
+	}
+
+	messages := make([]models.Message, 0, len(rows))
+	for _, row := range rows {
+		// Configuration events are not part of the conversation
+		if models.Role(row.Role) == models.RoleEvent {
+			continue
+		}
+		messages = append(messages, fromRow(row))
+	}
+	return messages, nil
+}
+
+func (e *Exporter) redactMessages(messages []models.Message) int {
+	total := 0
+	for i := range messages {
+		var n int
+		messages[i].Content, n = e.redactor.Redact(messages[i].Content)
+		total += n
+
+		for j := range messages[i].ToolCalls {
+			args := messages[i].ToolCalls[j].Function.Arguments
+			for key, val := range args {
+				if s, ok := val.(string); ok {
+					args[key], n = e.redactor.Redact(s)
+					total += n
+				}
+			}
+		}
+	}
+	return total
+}
+
+// trimTrajectory drops anything after the last assistant reply without tool
+// calls, so an example never ends on an unanswered prompt or a tool call
+// whose result was never recorded
+func trimTrajectory(messages []models.Message) []models.Message {
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].Role == models.RoleAssistant && len(messages[i].ToolCalls) == 0 {
+			return messages[:i+1]
+		}
+	}
+	return nil
+}
+
+func countRole(messages []models.Message, role models.Role) int {
+	n := 0
+	for _, msg := range messages {
+		if msg.Role == role {
+			n++
+		}
+	}
+	return n
+}
+
+type openaiExample struct {
+	Messages []openaiMessage `json:"messages"`
+	Tools    []models.Tool   `json:"tools,omitempty"`
+}
+
+type openaiMessage struct {
+	Role       string           `json:"role"`
+	Content    string           `json:"content"`
+	ToolCalls  []openaiToolCall `json:"tool_calls,omitempty"`
+	ToolCallID string           `json:"tool_call_id,omitempty"`
+}
+
+type openaiToolCall struct {
+	ID       string `json:"id"`
+	Type     string `json:"type"`
+	Function struct {
+		Name      string `json:"name"`
+		Arguments string `json:"arguments"`
+	} `json:"function"`
+}
+
+func toOpenAI(messages []models.Message, tools []models.Tool) openaiExample {
+	example := openaiExample{Tools: tools}
+	for _, msg := range messages {
+		om := openaiMessage{
+			Role:       string(msg.Role),
+			Content:    msg.Content,
+			ToolCallID: msg.ToolCallID,
+		}
+		for _, tc := range msg.ToolCalls {
+			call := openaiToolCall{ID: tc.ID, Type: "function"}
+			call.Function.Name = tc.Function.Name
+			call.Function.Arguments = encodeArguments(tc.Function.Arguments)
+			om.ToolCalls = append(om.ToolCalls, call)
+		}
+		example.Messages = append(example.Messages, om)
+	}
+	return example
+}
+
+type shareGPTExample struct {
+	Conversations []shareGPTTurn `json:"conversations"`
+	System        string         `json:"system,omitempty"`
+	Tools         string         `json:"tools,omitempty"`
+}
+
+type shareGPTTurn struct {
+	From  string `json:"from"`
+	Value string `json:"value"`
+}
+
+// toShareGPT follows the function calling variant of ShareGPT: tool calls
+// become "function_call" turns and tool results "observation" turns
+func toShareGPT(messages []models.Message, tools []models.Tool) shareGPTExample {
+	var example shareGPTExample
+	if len(tools) > 0 {
+		functions := make([]models.ToolFunction, len(tools))
+		for i, tool := range tools {
+			functions[i] = tool.Function
+		}
+		if data, err := json.Marshal(functions); err == nil {
+			example.Tools = string(data)
+		}
+	}
+
+	var pending []string
+	for _, msg := range messages {
+		switch msg.Role {
+		case models.RoleSystem:
+			example.System = msg.Content
+		case models.RoleUser:
+			example.Conversations = append(example.Conversations, shareGPTTurn{From: "human", Value: msg.Content})
+		case models.RoleAssistant:
+			if len(msg.ToolCalls) == 0 {
+				example.Conversations = append(example.Conversations, shareGPTTurn{From: "gpt", Value: msg.Content})
+				continue
+			}
+			calls := make([]map[string]interface{}, len(msg.ToolCalls))
+			for i, tc := range msg.ToolCalls {
+				calls[i] = map[string]interface{}{
+					"name":      tc.Function.Name,
+					"arguments": tc.Function.Arguments,
+				}
+			}
+			example.Conversations = append(example.Conversations, shareGPTTurn{From: "function_call", Value: encodeTurn(calls)})
+		case models.RoleTool:
+			// Results of parallel calls share one observation turn so turns
+			// keep alternating between the model and its inputs
+			if n := len(example.Conversations); n > 0 && example.Conversations[n-1].From == "observation" {
+				pending = append(pending, msg.Content)
+				example.Conversations[n-1].Value = encodeTurn(pending)
+				continue
+			}
+			pending = []string{msg.Content}
+			example.Conversations = append(example.Conversations, shareGPTTurn{From: "observation", Value: msg.Content})
+		}
+	}
+	return example
+}
+
+// encodeTurn encodes a single item as itself and several as a JSON array
+func encodeTurn[T any](items []T) string {
+	var v interface{} = items
+	if len(items) == 1 {
+		v = items[0]
+	}
+	if s, ok := v.(string); ok {
+		return s
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+func encodeArguments(args map[string]interface{}) string {
+	if args == nil {
+		return "{}"
+	}
+	data, err := json.Marshal(args)
+	if err != nil {
+		return "{}"
+	}
+	return string(data)
+}
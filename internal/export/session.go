@@ -0,0 +1,466 @@
+package export
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/omnitrix-sh/core.sh/internal/db"
+	"github.com/omnitrix-sh/core.sh/pkg/models"
+)
+
+// SessionFormat is a format a session can be exported in
+type SessionFormat string
+
+const (
+	// SessionJSON is the portable format ImportSession reads
+	SessionJSON SessionFormat = "json"
+	// SessionMarkdown is a transcript for people to read, e.g. in a bug
+	// report. It can't be imported.
+	SessionMarkdown SessionFormat = "markdown"
+)
+
+// sessionFormatVersion is the version of the JSON format. It changes when
+// fields change incompatibly.
+const sessionFormatVersion = 1
+
+// SessionExport is a session with everything needed to restore it into
+// another database
+type SessionExport struct {
+	Version     int                 `json:"version"`
+	ExportedAt  time.Time           `json:"exported_at"`
+	Session     ExportedSession     `json:"session"`
+	Messages    []ExportedMessage   `json:"messages"`
+	FileChanges []models.FileChange `json:"file_changes,omitempty"`
+}
+
+// ExportedSession is a session's metadata and usage
+type ExportedSession struct {
+	models.Session
+	Language string `json:"language,omitempty"`
+	Mode     string `json:"mode,omitempty"`
+}
+
+// ExportedMessage is a stored message
+type ExportedMessage struct {
+	models.Message
+	// Forgotten messages are kept but left out of prompts
+	Forgotten bool `json:"forgotten,omitempty"`
+}
+
+// SessionExportOptions controls how a session is exported
+type SessionExportOptions struct {
+	Format SessionFormat
+
+	// DisableRedaction keeps secrets in the output. Only use this for
+	// exports that never leave the machine.
+	DisableRedaction bool
+}
+
+// ExportSession writes a session with its messages, tool calls, usage and
+// file changes. Secrets are masked unless redaction is disabled.
+func (e *Exporter) ExportSession(ctx context.Context, w io.Writer, sessionID string, opts SessionExportOptions) error {
+	if opts.Format == "" {
+		opts.Format = SessionJSON
+	}
+	if opts.Format != SessionJSON && opts.Format != SessionMarkdown {
+		return fmt.Errorf("unsupported format: %s (use json or markdown)", opts.Format)
+	}
+
+	export, err := e.loadSession(ctx, sessionID)
+	if err != nil {
+		return err
+	}
+	if !opts.DisableRedaction {
+		e.redactExport(export)
+	}
+
+	if opts.Format == SessionMarkdown {
+		_, err = io.WriteString(w, markdownTranscript(export))
+	} else {
+		encoder := json.NewEncoder(w)
+		encoder.SetEscapeHTML(false)
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(export)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write session: %w", err)
+	}
+	return nil
+}
+
+func (e *Exporter) loadSession(ctx context.Context, sessionID string) (*SessionExport, error) {
+	session, err := e.queries.GetSession(ctx, sessionID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("session %s not found", sessionID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load session: %w", err)
+	}
+
+	rows, err := e.queries.ListMessagesBySession(ctx, sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load messages for session %s: %w", sessionID, err)
+	}
+	changes, err := e.queries.ListFileChangesBySession(ctx, sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load file changes for session %s: %w", sessionID, err)
+	}
+
+	export := &SessionExport{
+		Version:    sessionFormatVersion,
+		ExportedAt: time.Now(),
+		Session: ExportedSession{
+			Session: models.Session{
+				ID:               session.ID,
+				Title:            session.Title,
+				Model:            session.Model,
+				Provider:         session.Provider,
+				MessageCount:     len(rows),
+				PromptTokens:     session.PromptTokens.Int64,
+				CompletionTokens: session.CompletionTokens.Int64,
+				Cost:             session.Cost,
+				CreatedAt:        time.Unix(session.CreatedAt, 0),
+				UpdatedAt:        time.Unix(session.UpdatedAt, 0),
+			},
+			Language: session.Language.String,
+			Mode:     session.Mode.String,
+		},
+		Messages: make([]ExportedMessage, len(rows)),
+	}
+	for i, row := range rows {
+		export.Messages[i] = ExportedMessage{Message: fromRow(row), Forgotten: row.Forgotten != 0}
+	}
+	for _, change := range changes {
+		export.FileChanges = append(export.FileChanges, models.FileChange{
+			ID:         change.ID,
+			SessionID:  change.SessionID,
+			FilePath:   change.FilePath,
+			Operation:  change.Operation,
+			OldContent: change.OldContent.String,
+			NewContent: change.NewContent.String,
+			Diff:       change.Diff.String,
+			CreatedAt:  time.Unix(change.CreatedAt, 0),
+		})
+	}
+	return export, nil
+}
+
+func (e *Exporter) redactExport(export *SessionExport) {
+	messages := make([]models.Message, len(export.Messages))
+	for i, msg := range export.Messages {
+		messages[i] = msg.Message
+	}
+	e.redactMessages(messages)
+	for i := range messages {
+		messages[i].Reasoning, _ = e.redactor.Redact(messages[i].Reasoning)
+		export.Messages[i].Message = messages[i]
+	}
+
+	for i := range export.FileChanges {
+		change := &export.FileChanges[i]
+		change.OldContent, _ = e.redactor.Redact(change.OldContent)
+		change.NewContent, _ = e.redactor.Redact(change.NewContent)
+		change.Diff, _ = e.redactor.Redact(change.Diff)
+	}
+}
+
+// ImportSession restores a session exported as JSON into the database conn
+// is connected to, in a single transaction. IDs are kept so a session moved
+// between machines stays the same session, unless the session already
+// exists there; then the copy gets new IDs. It returns the imported
+// session.
+func ImportSession(ctx context.Context, conn *sql.DB, r io.Reader) (*models.Session, error) {
+	var export SessionExport
+	if err := json.NewDecoder(r).Decode(&export); err != nil {
+		return nil, fmt.Errorf("failed to read session: %w", err)
+	}
+	if export.Version < 1 || export.Version > sessionFormatVersion {
+		return nil, fmt.Errorf("unsupported session format version %d", export.Version)
+	}
+	if export.Session.ID == "" {
+		return nil, fmt.Errorf("session export has no session")
+	}
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin import: %w", err)
+	}
+	defer tx.Rollback()
+	q := db.New(tx)
+
+	session := export.Session.Session
+	newIDs := false
+	if _, err := q.GetSession(ctx, session.ID); err == nil {
+		newIDs = true
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("failed to check session: %w", err)
+	}
+	id := func(old string) string {
+		if newIDs || old == "" {
+			return uuid.New().String()
+		}
+		return old
+	}
+	session.ID = id(session.ID)
+
+	if _, err := q.CreateSession(ctx, db.CreateSessionParams{
+		ID:        session.ID,
+		Title:     session.Title,
+		Model:     session.Model,
+		Provider:  session.Provider,
+		CreatedAt: session.CreatedAt.Unix(),
+		UpdatedAt: session.UpdatedAt.Unix(),
+	}); err != nil {
+		return nil, fmt.Errorf("failed to create session: %w", err)
+	}
+
+	for _, msg := range export.Messages {
+		arg, err := messageParams(msg.Message)
+		if err != nil {
+			return nil, err
+		}
+		arg.ID = id(msg.ID)
+		arg.SessionID = session.ID
+		if _, err := q.CreateMessage(ctx, arg); err != nil {
+			return nil, fmt.Errorf("failed to import message: %w", err)
+		}
+		if msg.Forgotten {
+			if _, err := q.ForgetMessage(ctx, db.ForgetMessageParams{
+				UpdatedAt: arg.UpdatedAt,
+				ID:        arg.ID,
+				SessionID: session.ID,
+			}); err != nil {
+				return nil, fmt.Errorf("failed to import message: %w", err)
+			}
+		}
+	}
+
+	for _, change := range export.FileChanges {
+		if _, err := q.CreateFileChange(ctx, db.CreateFileChangeParams{
+			ID:         id(change.ID),
+			SessionID:  session.ID,
+			FilePath:   change.FilePath,
+			Operation:  change.Operation,
+			OldContent: sql.NullString{String: change.OldContent, Valid: change.OldContent != ""},
+			NewContent: sql.NullString{String: change.NewContent, Valid: change.NewContent != ""},
+			Diff:       sql.NullString{String: change.Diff, Valid: change.Diff != ""},
+			CreatedAt:  change.CreatedAt.Unix(),
+		}); err != nil {
+			return nil, fmt.Errorf("failed to import file change: %w", err)
+		}
+	}
+
+	// Usage and counts are restored as recorded rather than recomputed
+	session.MessageCount = len(export.Messages)
+	if _, err := q.UpdateSession(ctx, db.UpdateSessionParams{
+		Title:            session.Title,
+		MessageCount:     sql.NullInt64{Int64: int64(session.MessageCount), Valid: true},
+		PromptTokens:     sql.NullInt64{Int64: session.PromptTokens, Valid: true},
+		CompletionTokens: sql.NullInt64{Int64: session.CompletionTokens, Valid: true},
+		UpdatedAt:        session.UpdatedAt.Unix(),
+		ID:               session.ID,
+	}); err != nil {
+		return nil, fmt.Errorf("failed to import session usage: %w", err)
+	}
+	if _, err := q.AddSessionUsage(ctx, db.AddSessionUsageParams{
+		Cost:      session.Cost,
+		UpdatedAt: session.UpdatedAt.Unix(),
+		ID:        session.ID,
+	}); err != nil {
+		return nil, fmt.Errorf("failed to import session usage: %w", err)
+	}
+	if export.Session.Language != "" {
+		if err := q.SetSessionLanguage(ctx, db.SetSessionLanguageParams{
+			Language:  sql.NullString{String: export.Session.Language, Valid: true},
+			UpdatedAt: session.UpdatedAt.Unix(),
+			ID:        session.ID,
+		}); err != nil {
+			return nil, fmt.Errorf("failed to import session language: %w", err)
+		}
+	}
+	if export.Session.Mode != "" {
+		if err := q.SetSessionMode(ctx, db.SetSessionModeParams{
+			Mode:      sql.NullString{String: export.Session.Mode, Valid: true},
+			UpdatedAt: session.UpdatedAt.Unix(),
+			ID:        session.ID,
+		}); err != nil {
+			return nil, fmt.Errorf("failed to import session mode: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit import: %w", err)
+	}
+	return &session, nil
+}
+
+// fromRow converts a stored message, decoding its JSON columns
+func fromRow(row db.Message) models.Message {
+	msg := models.Message{
+		ID:          row.ID,
+		SessionID:   row.SessionID,
+		Role:        models.Role(row.Role),
+		Content:     row.Content,
+		Reasoning:   row.Reasoning.String,
+		Model:       row.Model.String,
+		ToolCallID:  row.ToolCallID.String,
+		Interrupted: row.Interrupted != 0,
+		CreatedAt:   time.Unix(row.CreatedAt, 0),
+		UpdatedAt:   time.Unix(row.UpdatedAt, 0),
+	}
+	if row.ToolCalls.Valid {
+		json.Unmarshal([]byte(row.ToolCalls.String), &msg.ToolCalls)
+	}
+	if row.Params.Valid {
+		var params models.RunParams
+		if json.Unmarshal([]byte(row.Params.String), &params) == nil {
+			msg.Params = &params
+		}
+	}
+	if row.Config.Valid {
+		var config models.SessionConfig
+		if json.Unmarshal([]byte(row.Config.String), &config) == nil {
+			msg.Config = &config
+		}
+	}
+	return msg
+}
+
+// messageParams encodes a message for storage
+func messageParams(msg models.Message) (db.CreateMessageParams, error) {
+	arg := db.CreateMessageParams{
+		Role:       string(msg.Role),
+		Content:    msg.Content,
+		Reasoning:  sql.NullString{String: msg.Reasoning, Valid: msg.Reasoning != ""},
+		Model:      sql.NullString{String: msg.Model, Valid: msg.Model != ""},
+		ToolCallID: sql.NullString{String: msg.ToolCallID, Valid: msg.ToolCallID != ""},
+		CreatedAt:  msg.CreatedAt.Unix(),
+		UpdatedAt:  msg.UpdatedAt.Unix(),
+	}
+	if msg.UpdatedAt.IsZero() {
+		arg.UpdatedAt = arg.CreatedAt
+	}
+	if msg.Interrupted {
+		arg.Interrupted = 1
+	}
+
+	encode := func(v interface{}, what string) (sql.NullString, error) {
+		data, err := json.Marshal(v)
+		if err != nil {
+			return sql.NullString{}, fmt.Errorf("failed to encode %s: %w", what, err)
+		}
+		return sql.NullString{String: string(data), Valid: true}, nil
+	}
+	var err error
+	if msg.Params != nil {
+		if arg.Params, err = encode(msg.Params, "run parameters"); err != nil {
+			return arg, err
+		}
+	}
+	if msg.Config != nil {
+		if arg.Config, err = encode(msg.Config, "session config"); err != nil {
+			return arg, err
+		}
+	}
+	if len(msg.ToolCalls) > 0 {
+		if arg.ToolCalls, err = encode(msg.ToolCalls, "tool calls"); err != nil {
+			return arg, err
+		}
+	}
+	return arg, nil
+}
+
+// markdownTranscript renders a session for reading
+func markdownTranscript(export *SessionExport) string {
+	var b strings.Builder
+	s := export.Session
+	title := s.Title
+	if title == "" {
+		title = "Session " + s.ID
+	}
+	fmt.Fprintf(&b, "# %s\n\n", title)
+	fmt.Fprintf(&b, "- Session: `%s`\n", s.ID)
+	fmt.Fprintf(&b, "- Model: %s (%s)\n", s.Model, s.Provider)
+	fmt.Fprintf(&b, "- Created: %s\n", s.CreatedAt.UTC().Format(time.RFC3339))
+	fmt.Fprintf(&b, "- Messages: %d\n", s.MessageCount)
+	fmt.Fprintf(&b, "- Tokens: %d prompt, %d completion\n", s.PromptTokens, s.CompletionTokens)
+	if s.Cost > 0 {
+		fmt.Fprintf(&b, "- Cost: $%.4f\n", s.Cost)
+	}
+
+	for _, msg := range export.Messages {
+		b.WriteString("\n")
+		stamp := msg.CreatedAt.UTC().Format(time.RFC3339)
+		switch msg.Role {
+		case models.RoleEvent:
+			if msg.Config != nil {
+				fmt.Fprintf(&b, "_%s: configuration changed to %s (%s)_\n", stamp, msg.Config.Model, msg.Config.Provider)
+			} else {
+				fmt.Fprintf(&b, "_%s: %s_\n", stamp, msg.Content)
+			}
+			continue
+		case models.RoleTool:
+			fmt.Fprintf(&b, "### Tool result `%s` · %s\n\n", msg.ToolCallID, stamp)
+			b.WriteString(fenced("", msg.Content))
+			continue
+		}
+
+		heading := strings.ToUpper(string(msg.Role[:1])) + string(msg.Role[1:])
+		if msg.Model != "" {
+			heading += " (" + msg.Model + ")"
+		}
+		fmt.Fprintf(&b, "## %s · %s\n", heading, stamp)
+		if msg.Forgotten {
+			b.WriteString("\n_Forgotten: left out of prompts._\n")
+		}
+		if msg.Interrupted {
+			b.WriteString("\n_Interrupted: the run was cancelled before this reply was complete._\n")
+		}
+		if msg.Reasoning != "" {
+			b.WriteString("\n<details><summary>Reasoning</summary>\n\n")
+			b.WriteString(strings.TrimSpace(msg.Reasoning))
+			b.WriteString("\n\n</details>\n")
+		}
+		if content := strings.TrimSpace(msg.Content); content != "" {
+			b.WriteString("\n" + content + "\n")
+		}
+		for _, call := range msg.ToolCalls {
+			fmt.Fprintf(&b, "\n**Tool call** `%s` `%s`\n\n", call.Function.Name, call.ID)
+			args, _ := json.MarshalIndent(call.Function.Arguments, "", "  ")
+			b.WriteString(fenced("json", string(args)))
+		}
+	}
+
+	if len(export.FileChanges) > 0 {
+		b.WriteString("\n## File changes\n")
+		for _, change := range export.FileChanges {
+			fmt.Fprintf(&b, "\n### %s `%s` · %s\n\n", change.Operation, change.FilePath, change.CreatedAt.UTC().Format(time.RFC3339))
+			if change.Diff != "" {
+				b.WriteString(fenced("diff", change.Diff))
+			}
+		}
+	}
+	return b.String()
+}
+
+// fenced wraps text in a code fence longer than any backtick run in it
+func fenced(lang, text string) string {
+	longest, run := 0, 0
+	for _, r := range text {
+		if r == '`' {
+			run++
+			longest = max(longest, run)
+		} else {
+			run = 0
+		}
+	}
+	fence := strings.Repeat("`", max(3, longest+1))
+	return fence + lang + "\n" + strings.TrimRight(text, "\n") + "\n" + fence + "\n"
+}
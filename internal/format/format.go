@@ -0,0 +1,199 @@
+// Package format runs the project's formatters and linters, such as gofmt
+// or eslint --fix, on the files the agent writes, so its changes follow
+// the project's style and the model learns of what they can't fix. They
+// run like the model's commands, in the exec tool's sandbox and only once
+// the permissions allow them.
+package format
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/omnitrix-sh/core.sh/internal/tools"
+	"github.com/omnitrix-sh/core.sh/pkg/models"
+)
+
+const (
+	defaultTimeout = 30 * time.Second
+	// maxOutput bounds what one formatter reports, in bytes
+	maxOutput = 4000
+)
+
+// Runner runs the configured formatters. A nil Runner runs none.
+type Runner struct {
+	workDir    string
+	exec       *tools.ExecTool
+	formatters []formatter
+}
+
+type formatter struct {
+	command string
+	files   []string
+	timeout time.Duration
+}
+
+// Authorizer decides whether a formatter's command may run, asking the
+// user if the permissions say so
+type Authorizer func(ctx context.Context, command string) error
+
+// New creates a runner for the formatters of the config, run in workDir by
+// exec. It returns nil if there are none.
+func New(cfg []models.FormatterConfig, workDir string, exec *tools.ExecTool) (*Runner, error) {
+	if len(cfg) == 0 {
+		return nil, nil
+	}
+	r := &Runner{workDir: workDir, exec: exec}
+	for i, fc := range cfg {
+		if strings.TrimSpace(fc.Command) == "" {
+			return nil, fmt.Errorf("formatter %d has no command", i+1)
+		}
+		if len(fc.Files) == 0 {
+			return nil, fmt.Errorf("formatter %q applies to no files", fc.Command)
+		}
+		for _, pattern := range fc.Files {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("formatter %q: invalid pattern %q: %w", fc.Command, pattern, err)
+			}
+		}
+		timeout := defaultTimeout
+		if fc.Timeout > 0 {
+			timeout = time.Duration(fc.Timeout) * time.Second
+		}
+		r.formatters = append(r.formatters, formatter{command: fc.Command, files: fc.Files, timeout: timeout})
+	}
+	return r, nil
+}
+
+// Run runs each formatter, in order, on the files it applies to among
+// paths, once authorize lets it. It returns what the model should know for
+// the tool result: which files were reformatted and what formatters
+// reported when they failed or weren't allowed, or "" if there is nothing
+// to tell.
+func (r *Runner) Run(ctx context.Context, paths []string, authorize Authorizer) string {
+	if r == nil || len(paths) == 0 {
+		return ""
+	}
+	before := hashFiles(paths)
+
+	var b strings.Builder
+	for _, f := range r.formatters {
+		var files []string
+		for _, p := range paths {
+			if rel := r.rel(p); f.applies(rel) {
+				files = append(files, rel)
+			}
+		}
+		if len(files) == 0 {
+			continue
+		}
+		script := f.command
+		for _, file := range files {
+			script += " " + shellQuote(file)
+		}
+		if err := authorize(ctx, script); err != nil {
+			fmt.Fprintf(&b, "%s did not run: %v\n", f.command, err)
+			continue
+		}
+		output, err := r.run(ctx, f, script)
+		if err == nil {
+			continue
+		}
+		fmt.Fprintf(&b, "%s reported problems (%v):\n", f.command, err)
+		if output != "" {
+			b.WriteString(output)
+			b.WriteString("\n")
+		}
+	}
+
+	var changed []string
+	for _, p := range paths {
+		if sum, ok := hashFile(p); ok && sum != before[p] {
+			changed = append(changed, r.rel(p))
+		}
+	}
+	if len(changed) > 0 {
+		note := fmt.Sprintf("Formatters changed these files after this change, read them again before editing further: %s\n", strings.Join(changed, ", "))
+		return note + b.String()
+	}
+	return b.String()
+}
+
+// run runs a formatter's script, returning its output when it fails
+func (r *Runner) run(ctx context.Context, f formatter, script string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, f.timeout)
+	defer cancel()
+
+	cmd, cleanup, err := r.exec.Command(ctx, script)
+	if err != nil {
+		return "", err
+	}
+	defer cleanup()
+	output, err := cmd.CombinedOutput()
+	if err == nil {
+		return "", nil
+	}
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		err = fmt.Errorf("timed out after %s", f.timeout)
+	}
+	text := strings.TrimSpace(string(output))
+	if len(text) > maxOutput {
+		text = text[:maxOutput] + fmt.Sprintf("\n[... %d more bytes]", len(text)-maxOutput)
+	}
+	return text, err
+}
+
+// applies tells whether the formatter handles the file at rel. Patterns
+// with a slash match the whole path, others the file name.
+func (f formatter) applies(rel string) bool {
+	rel = filepath.ToSlash(rel)
+	for _, pattern := range f.files {
+		name := path.Base(rel)
+		if strings.Contains(pattern, "/") {
+			name = rel
+		}
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// rel returns p relative to the working directory, or as is if it lies
+// outside it
+func (r *Runner) rel(p string) string {
+	rel, err := filepath.Rel(r.workDir, p)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return p
+	}
+	return rel
+}
+
+func hashFiles(paths []string) map[string][sha256.Size]byte {
+	sums := make(map[string][sha256.Size]byte, len(paths))
+	for _, p := range paths {
+		if sum, ok := hashFile(p); ok {
+			sums[p] = sum
+		}
+	}
+	return sums
+}
+
+func hashFile(p string) ([sha256.Size]byte, bool) {
+	data, err := os.ReadFile(p)
+	if err != nil {
+		return [sha256.Size]byte{}, false
+	}
+	return sha256.Sum256(data), true
+}
+
+// shellQuote quotes s as a single word for POSIX shells
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
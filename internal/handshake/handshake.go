@@ -0,0 +1,215 @@
+// Package handshake negotiates what a frontend connected to the server can
+// do, so the core adapts to it instead of assuming a full terminal UI
+package handshake
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/omnitrix-sh/core.sh/internal/events"
+	"github.com/omnitrix-sh/core.sh/internal/permissions"
+)
+
+// ProtocolVersion is the version of the client protocol the server speaks.
+// It changes when messages change incompatibly.
+const ProtocolVersion = 1
+
+// minProtocolVersion is the oldest version clients may still use
+const minProtocolVersion = 1
+
+// Feature is something a client can handle
+type Feature string
+
+const (
+	// FeatureApproval means the client can ask its user to approve tool
+	// runs and answer the model's questions. Without it runs that need
+	// approval are denied at once instead of waiting for an answer that
+	// never comes, and the model is told nobody can answer questions.
+	FeatureApproval Feature = "approval"
+	// FeatureImages means the client can render images in messages
+	FeatureImages Feature = "images"
+	// FeatureStreaming means the client handles responses piece by piece;
+	// without it it gets each response once complete
+	FeatureStreaming Feature = "streaming"
+	// FeatureStatus means the client shows status events, see events.Status
+	FeatureStatus Feature = "status"
+)
+
+// serverFeatures are the features this server supports
+var serverFeatures = []Feature{FeatureApproval, FeatureImages, FeatureStreaming, FeatureStatus}
+
+// Hello is the first message a client sends
+type Hello struct {
+	ProtocolVersion int       `json:"protocol_version"`
+	Client          string    `json:"client,omitempty"` // name and version, for logs
+	Features        []Feature `json:"features"`
+}
+
+// Welcome is the server's answer to Hello
+type Welcome struct {
+	ProtocolVersion int       `json:"protocol_version"`
+	Server          string    `json:"server,omitempty"`
+	Features        []Feature `json:"features"` // those both sides support
+	Ignored         []Feature `json:"ignored,omitempty"`
+}
+
+// Features are the features negotiated for one client
+type Features map[Feature]bool
+
+// Has reports whether the client and server both support f
+func (f Features) Has(feature Feature) bool {
+	return f[feature]
+}
+
+// List returns the features sorted by name
+func (f Features) List() []Feature {
+	result := make([]Feature, 0, len(f))
+	for feature := range f {
+		result = append(result, feature)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i] < result[j] })
+	return result
+}
+
+// Approver returns approver if the client can prompt its user, or nil so
+// the agent denies runs needing approval instead of blocking on them
+func (f Features) Approver(approver permissions.Approver) permissions.Approver {
+	if !f.Has(FeatureApproval) {
+		return nil
+	}
+	return approver
+}
+
+// EventTypes returns the event types the client handles: deltas and tool
+// output need streaming, status events status, and permission requests
+// and questions approval
+func (f Features) EventTypes() []events.Type {
+	types := []events.Type{events.TypeMessage, events.TypeToolStarted, events.TypeToolFinished, events.TypeRunCompleted, events.TypeError, events.TypeConfigChanged}
+	if f.Has(FeatureStreaming) {
+		types = append(types, events.TypeDelta, events.TypeToolOutput)
+	}
+	if f.Has(FeatureStatus) {
+		types = append(types, events.TypeStatus)
+	}
+	if f.Has(FeatureApproval) {
+		types = append(types, events.TypePermission, events.TypeQuestion)
+	}
+	return types
+}
+
+// Negotiate answers a client's Hello. Features the server doesn't know are
+// ignored rather than refused, so newer clients keep working with older
+// servers. Protocol versions the server can't speak are an error.
+func Negotiate(hello Hello, server string) (Features, Welcome, error) {
+	if hello.ProtocolVersion < minProtocolVersion || hello.ProtocolVersion > ProtocolVersion {
+		return nil, Welcome{}, fmt.Errorf("unsupported protocol version %d: this server speaks %d to %d",
+			hello.ProtocolVersion, minProtocolVersion, ProtocolVersion)
+	}
+
+	supported := make(map[Feature]bool, len(serverFeatures))
+	for _, feature := range serverFeatures {
+		supported[feature] = true
+	}
+
+	features := make(Features)
+	var ignored []Feature
+	for _, feature := range hello.Features {
+		if supported[feature] {
+			features[feature] = true
+		} else {
+			ignored = append(ignored, feature)
+		}
+	}
+
+	return features, Welcome{
+		ProtocolVersion: hello.ProtocolVersion,
+		Server:          server,
+		Features:        features.List(),
+		Ignored:         ignored,
+	}, nil
+}
+
+// ErrNoApprover is returned for permission requests in sessions no client
+// handling approval is connected to
+var ErrNoApprover = errors.New("no connected client can approve tool runs")
+
+// Clients keeps the features of the clients connected to each session, so
+// that permission requests and questions only wait for an answer when
+// one of them can give it
+type Clients struct {
+	mu       sync.Mutex
+	next     int
+	sessions map[string]map[int]Features // session ID -> client -> features
+}
+
+// NewClients creates an empty set of clients
+func NewClients() *Clients {
+	return &Clients{sessions: make(map[string]map[int]Features)}
+}
+
+// Add records a client with the features negotiated for it as connected
+// to a session, until the returned function is called
+func (c *Clients) Add(sessionID string, features Features) func() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	id := c.next
+	c.next++
+	if c.sessions[sessionID] == nil {
+		c.sessions[sessionID] = make(map[int]Features)
+	}
+	c.sessions[sessionID][id] = features
+
+	return func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		delete(c.sessions[sessionID], id)
+		if len(c.sessions[sessionID]) == 0 {
+			delete(c.sessions, sessionID)
+		}
+	}
+}
+
+// Features returns the features any client connected to a session has
+func (c *Clients) Features(sessionID string) Features {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	features := make(Features)
+	for _, client := range c.sessions[sessionID] {
+		for feature := range client {
+			features[feature] = true
+		}
+	}
+	return features
+}
+
+// Approver returns an approver passing requests and questions on to
+// approver, see Features.Approver, when a client connected to their
+// session can answer them. Other requests are denied and questions left
+// unanswered at once.
+func (c *Clients) Approver(approver permissions.Approver) permissions.Approver {
+	return &gate{clients: c, approver: approver}
+}
+
+type gate struct {
+	clients  *Clients
+	approver permissions.Approver
+}
+
+func (g *gate) Approve(ctx context.Context, req permissions.Request) (bool, error) {
+	approver := g.clients.Features(req.SessionID).Approver(g.approver)
+	if approver == nil {
+		return false, ErrNoApprover
+	}
+	return approver.Approve(ctx, req)
+}
+
+func (g *gate) Ask(ctx context.Context, q permissions.Question) (string, error) {
+	asker, ok := g.clients.Features(q.SessionID).Approver(g.approver).(permissions.Asker)
+	if !ok {
+		return "", permissions.ErrUnanswered
+	}
+	return asker.Ask(ctx, q)
+}
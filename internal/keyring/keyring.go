@@ -0,0 +1,155 @@
+// Package keyring keeps credentials such as API keys in the operating
+// system's credential store instead of config files
+package keyring
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// Service is the name Omnitrix's entries are stored under
+const Service = "omnitrix"
+
+const commandTimeout = 10 * time.Second
+
+var (
+	// ErrUnavailable is returned when no credential store can be used
+	ErrUnavailable = errors.New("no credential store found")
+	// ErrNotFound is returned for entries that don't exist
+	ErrNotFound = errors.New("credential not found")
+)
+
+// backend stores credentials through a command line tool
+type backend struct {
+	name   string
+	binary string
+	set    func(name, secret string) (args []string, stdin string)
+	get    func(name string) []string
+	delete func(name string) []string
+	// missing reports whether a failed get means the entry doesn't exist
+	missing func(exitCode int, stderr string) bool
+}
+
+// backends lists the candidates for the current platform in order of
+// preference
+func backends() []backend {
+	switch runtime.GOOS {
+	case "darwin":
+		return []backend{{
+			name:   "keychain",
+			binary: "security",
+			set: func(name, secret string) ([]string, string) {
+				// -U updates an existing entry. The secret has to be an
+				// argument; security can't read it from stdin.
+				return []string{"add-generic-password", "-U", "-s", Service, "-a", name, "-w", secret}, ""
+			},
+			get:    func(name string) []string { return []string{"find-generic-password", "-s", Service, "-a", name, "-w"} },
+			delete: func(name string) []string { return []string{"delete-generic-password", "-s", Service, "-a", name} },
+			missing: func(exitCode int, stderr string) bool {
+				return exitCode == 44 || strings.Contains(stderr, "could not be found")
+			},
+		}}
+	case "linux", "freebsd", "openbsd", "netbsd":
+		return []backend{{
+			name:   "secret-service",
+			binary: "secret-tool",
+			set: func(name, secret string) ([]string, string) {
+				return []string{"store", "--label", Service + " " + name, "service", Service, "account", name}, secret
+			},
+			get:    func(name string) []string { return []string{"lookup", "service", Service, "account", name} },
+			delete: func(name string) []string { return []string{"clear", "service", Service, "account", name} },
+			// lookup fails without output for missing entries
+			missing: func(exitCode int, stderr string) bool {
+				return exitCode == 1 && strings.TrimSpace(stderr) == ""
+			},
+		}}
+	}
+	return nil
+}
+
+func findBackend() (backend, error) {
+	for _, b := range backends() {
+		if _, err := exec.LookPath(b.binary); err == nil {
+			return b, nil
+		}
+	}
+	return backend{}, ErrUnavailable
+}
+
+// Available reports whether credentials can be stored on this system
+func Available() bool {
+	_, err := findBackend()
+	return err == nil
+}
+
+// Set stores a secret under name, replacing any earlier one
+func Set(ctx context.Context, name, secret string) error {
+	b, err := findBackend()
+	if err != nil {
+		return err
+	}
+	args, stdin := b.set(name, secret)
+	if _, _, err := run(ctx, b, args, stdin); err != nil {
+		return fmt.Errorf("%s: failed to store %s: %w", b.name, name, err)
+	}
+	return nil
+}
+
+// Get returns the secret stored under name
+func Get(ctx context.Context, name string) (string, error) {
+	b, err := findBackend()
+	if err != nil {
+		return "", err
+	}
+	stdout, stderr, err := run(ctx, b, b.get(name), "")
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && b.missing(exitErr.ExitCode(), stderr) {
+			return "", ErrNotFound
+		}
+		return "", fmt.Errorf("%s: failed to read %s: %w", b.name, name, err)
+	}
+	secret := strings.TrimRight(stdout, "\r\n")
+	if secret == "" {
+		return "", ErrNotFound
+	}
+	return secret, nil
+}
+
+// Delete removes the secret stored under name
+func Delete(ctx context.Context, name string) error {
+	b, err := findBackend()
+	if err != nil {
+		return err
+	}
+	if _, _, err := run(ctx, b, b.delete(name), ""); err != nil {
+		return fmt.Errorf("%s: failed to delete %s: %w", b.name, name, err)
+	}
+	return nil
+}
+
+// run runs the backend's binary, returning its stdout and stderr. Errors
+// carry the stderr.
+func run(ctx context.Context, b backend, args []string, stdin string) (string, string, error) {
+	ctx, cancel := context.WithTimeout(ctx, commandTimeout)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, b.binary, args...)
+	cmd.Stdin = strings.NewReader(stdin)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", stderr.String(), fmt.Errorf("%w: %s", err, msg)
+		}
+		return "", "", err
+	}
+	return stdout.String(), stderr.String(), nil
+}
@@ -0,0 +1,420 @@
+package lsp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/omnitrix-sh/core.sh/pkg/models"
+)
+
+// errClosed is returned for requests to a server that has exited
+var errClosed = errors.New("language server exited")
+
+// Client talks JSON-RPC to one language server process over stdio
+type Client struct {
+	name string
+	cmd  *exec.Cmd
+
+	writeMu sync.Mutex
+	stdin   io.WriteCloser
+
+	mu          sync.Mutex
+	nextID      int64
+	pending     map[int64]chan message
+	versions    map[string]int // open document URI -> version
+	diagnostics map[string][]Diagnostic
+	published   map[string]int // URI -> number of diagnostics notifications
+	changed     chan struct{}  // closed and replaced on every notification
+
+	done   chan struct{}
+	stderr *limitedWriter
+}
+
+// Start launches a language server rooted at rootDir and initializes it
+func Start(ctx context.Context, name string, cfg models.LSPConfig, rootDir string) (*Client, error) {
+	cmd := exec.Command(cfg.Command, cfg.Args...)
+	cmd.Dir = rootDir
+	cmd.Env = os.Environ()
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Client{
+		name:        name,
+		cmd:         cmd,
+		stdin:       stdin,
+		pending:     make(map[int64]chan message),
+		versions:    make(map[string]int),
+		diagnostics: make(map[string][]Diagnostic),
+		published:   make(map[string]int),
+		changed:     make(chan struct{}),
+		done:        make(chan struct{}),
+		stderr:      &limitedWriter{max: 4096},
+	}
+	cmd.Stderr = c.stderr
+
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start %s: %w", cfg.Command, err)
+	}
+	go c.read(stdout)
+
+	if err := c.initialize(ctx, rootDir); err != nil {
+		c.kill()
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *Client) initialize(ctx context.Context, rootDir string) error {
+	params := map[string]interface{}{
+		"processId": os.Getpid(),
+		"rootUri":   pathToURI(rootDir),
+		"workspaceFolders": []map[string]string{
+			{"uri": pathToURI(rootDir), "name": rootDir},
+		},
+		"capabilities": map[string]interface{}{
+			"textDocument": map[string]interface{}{
+				"synchronization": map[string]interface{}{
+					"didSave": true,
+				},
+				"publishDiagnostics": map[string]interface{}{
+					"versionSupport": true,
+				},
+				"definition": map[string]interface{}{
+					"linkSupport": true,
+				},
+				"references": map[string]interface{}{},
+				"documentSymbol": map[string]interface{}{
+					"hierarchicalDocumentSymbolSupport": true,
+				},
+			},
+			"workspace": map[string]interface{}{
+				"workspaceFolders": true,
+				"configuration":    true,
+				"symbol":           map[string]interface{}{},
+			},
+		},
+	}
+	if _, err := c.call(ctx, "initialize", params); err != nil {
+		return fmt.Errorf("failed to initialize %s: %w", c.name, err)
+	}
+	return c.notify("initialized", map[string]interface{}{})
+}
+
+// Sync sends the current content of a file to the server, opening it on
+// first use, and returns the number of diagnostics notifications received
+// for it before the update
+func (c *Client) Sync(path, content string) (int, error) {
+	uri := pathToURI(path)
+
+	c.mu.Lock()
+	version, open := c.versions[uri]
+	version++
+	c.versions[uri] = version
+	seen := c.published[uri]
+	c.mu.Unlock()
+
+	var err error
+	if !open {
+		err = c.notify("textDocument/didOpen", map[string]interface{}{
+			"textDocument": map[string]interface{}{
+				"uri":        uri,
+				"languageId": languageID(path, c.name),
+				"version":    version,
+				"text":       content,
+			},
+		})
+	} else {
+		err = c.notify("textDocument/didChange", map[string]interface{}{
+			"textDocument":   map[string]interface{}{"uri": uri, "version": version},
+			"contentChanges": []map[string]string{{"text": content}},
+		})
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	// Some servers only check files when they are saved
+	err = c.notify("textDocument/didSave", map[string]interface{}{
+		"textDocument": map[string]string{"uri": uri},
+	})
+	return seen, err
+}
+
+// Wait returns the file's diagnostics once the server has published more
+// than seen notifications for it and then stayed quiet for settle, or
+// when timeout passes
+func (c *Client) Wait(ctx context.Context, path string, seen int, settle, timeout time.Duration) ([]Diagnostic, error) {
+	uri := pathToURI(path)
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+
+	for {
+		c.mu.Lock()
+		count := c.published[uri]
+		changed := c.changed
+		c.mu.Unlock()
+
+		var quiet <-chan time.Time
+		if count > seen {
+			// Servers often publish several times while they catch up, so
+			// wait for the last one
+			quiet = time.After(settle)
+		}
+
+		select {
+		case <-changed:
+			continue
+		case <-quiet:
+			return c.Diagnostics(path), nil
+		case <-deadline.C:
+			return c.Diagnostics(path), nil
+		case <-c.done:
+			return nil, c.exited()
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// Diagnostics returns the last diagnostics published for a file
+func (c *Client) Diagnostics(path string) []Diagnostic {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]Diagnostic(nil), c.diagnostics[pathToURI(path)]...)
+}
+
+// All returns the last diagnostics published for every file
+func (c *Client) All() []Diagnostic {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var result []Diagnostic
+	for _, diagnostics := range c.diagnostics {
+		result = append(result, diagnostics...)
+	}
+	return result
+}
+
+// Close asks the server to shut down, killing it if it doesn't
+func (c *Client) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	if _, err := c.call(ctx, "shutdown", nil); err == nil {
+		c.notify("exit", nil)
+	}
+	select {
+	case <-c.done:
+	case <-ctx.Done():
+		c.kill()
+	}
+	return nil
+}
+
+func (c *Client) kill() {
+	c.cmd.Process.Kill()
+	<-c.done
+}
+
+func (c *Client) exited() error {
+	if stderr := strings.TrimSpace(c.stderr.String()); stderr != "" {
+		return fmt.Errorf("%w: %s", errClosed, stderr)
+	}
+	return errClosed
+}
+
+func (c *Client) call(ctx context.Context, method string, params interface{}) (json.RawMessage, error) {
+	c.mu.Lock()
+	c.nextID++
+	id := c.nextID
+	response := make(chan message, 1)
+	c.pending[id] = response
+	c.mu.Unlock()
+
+	defer func() {
+		c.mu.Lock()
+		delete(c.pending, id)
+		c.mu.Unlock()
+	}()
+
+	raw := json.RawMessage(strconv.FormatInt(id, 10))
+	if err := c.write(message{ID: &raw, Method: method, Params: marshal(params)}); err != nil {
+		return nil, err
+	}
+
+	select {
+	case msg := <-response:
+		if msg.Error != nil {
+			return nil, msg.Error
+		}
+		return msg.Result, nil
+	case <-c.done:
+		return nil, c.exited()
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (c *Client) notify(method string, params interface{}) error {
+	return c.write(message{Method: method, Params: marshal(params)})
+}
+
+func (c *Client) write(msg message) error {
+	msg.JSONRPC = "2.0"
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if _, err := fmt.Fprintf(c.stdin, "Content-Length: %d\r\n\r\n%s", len(body), body); err != nil {
+		return fmt.Errorf("failed to write to %s: %w", c.name, err)
+	}
+	return nil
+}
+
+// read handles the server's messages until it exits
+func (c *Client) read(stdout io.Reader) {
+	defer func() {
+		c.cmd.Wait()
+		close(c.done)
+	}()
+
+	r := bufio.NewReader(stdout)
+	for {
+		body, err := readMessage(r)
+		if err != nil {
+			return
+		}
+		var msg message
+		if err := json.Unmarshal(body, &msg); err != nil {
+			continue
+		}
+
+		switch {
+		case msg.ID != nil && msg.Method != "":
+			c.answer(msg)
+		case msg.ID != nil:
+			id, err := strconv.ParseInt(string(*msg.ID), 10, 64)
+			if err != nil {
+				continue
+			}
+			c.mu.Lock()
+			response, ok := c.pending[id]
+			c.mu.Unlock()
+			if ok {
+				response <- msg
+			}
+		case msg.Method == "textDocument/publishDiagnostics":
+			var params publishDiagnosticsParams
+			if err := json.Unmarshal(msg.Params, &params); err != nil {
+				continue
+			}
+			c.mu.Lock()
+			c.diagnostics[params.URI] = params.convert()
+			c.published[params.URI]++
+			close(c.changed)
+			c.changed = make(chan struct{})
+			c.mu.Unlock()
+		}
+	}
+}
+
+// answer replies to requests from the server. None of them matter for
+// diagnostics, so they get empty results that keep servers going.
+func (c *Client) answer(msg message) {
+	result := json.RawMessage("null")
+	if msg.Method == "workspace/configuration" {
+		var params struct {
+			Items []json.RawMessage `json:"items"`
+		}
+		json.Unmarshal(msg.Params, &params)
+		result = marshal(make([]interface{}, len(params.Items)))
+	}
+	c.write(message{ID: msg.ID, Result: result})
+}
+
+func readMessage(r *bufio.Reader) ([]byte, error) {
+	length := -1
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			break
+		}
+		if name, value, ok := strings.Cut(line, ":"); ok && strings.EqualFold(name, "Content-Length") {
+			length, err = strconv.Atoi(strings.TrimSpace(value))
+			if err != nil {
+				return nil, fmt.Errorf("invalid content length: %s", value)
+			}
+		}
+	}
+	if length < 0 {
+		return nil, errors.New("message without content length")
+	}
+	body := make([]byte, length)
+	_, err := io.ReadFull(r, body)
+	return body, err
+}
+
+func marshal(v interface{}) json.RawMessage {
+	if v == nil {
+		return nil
+	}
+	data, _ := json.Marshal(v)
+	return data
+}
+
+func languageID(path, fallback string) string {
+	if id, ok := languageIDs[filepath.Ext(path)]; ok {
+		return id
+	}
+	return fallback
+}
+
+// limitedWriter keeps the start of a server's stderr for error messages
+type limitedWriter struct {
+	mu  sync.Mutex
+	b   strings.Builder
+	max int
+}
+
+func (w *limitedWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if room := w.max - w.b.Len(); room > 0 {
+		if len(p) > room {
+			w.b.Write(p[:room])
+		} else {
+			w.b.Write(p)
+		}
+	}
+	return len(p), nil
+}
+
+func (w *limitedWriter) String() string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.b.String()
+}
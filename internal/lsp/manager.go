@@ -0,0 +1,282 @@
+// Package lsp runs the configured language servers and collects the
+// diagnostics they report for files the agent changes
+package lsp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/omnitrix-sh/core.sh/pkg/models"
+)
+
+const (
+	// startTimeout bounds a server's initialization, which includes
+	// loading the workspace for some servers
+	startTimeout = 30 * time.Second
+	// checkTimeout is the longest Check waits for a server to report on
+	// the files it was given
+	checkTimeout = 5 * time.Second
+	// settleDelay is how long a server must stay quiet after reporting
+	// before its diagnostics are taken as final
+	settleDelay = 300 * time.Millisecond
+)
+
+// Manager starts language servers on first use and routes files to them by
+// extension. A nil Manager has no servers.
+type Manager struct {
+	workDir    string
+	names      []string // enabled servers, sorted
+	configs    map[string]models.LSPConfig
+	extensions map[string]string // extension -> server name
+
+	mu      sync.Mutex
+	clients map[string]*Client
+	failed  map[string]error
+	checked map[string]bool // files synced with a server
+}
+
+// NewManager returns a manager for the enabled servers in configs, or nil
+// if there are none
+func NewManager(workDir string, configs map[string]models.LSPConfig) *Manager {
+	m := &Manager{
+		workDir:    workDir,
+		configs:    make(map[string]models.LSPConfig),
+		extensions: make(map[string]string),
+		clients:    make(map[string]*Client),
+		failed:     make(map[string]error),
+		checked:    make(map[string]bool),
+	}
+	for name, cfg := range configs {
+		if cfg.Enabled && cfg.Command != "" {
+			m.names = append(m.names, name)
+			m.configs[name] = cfg
+		}
+	}
+	if len(m.names) == 0 {
+		return nil
+	}
+	sort.Strings(m.names)
+
+	for _, name := range m.names {
+		extensions := m.configs[name].Extensions
+		if len(extensions) == 0 {
+			extensions = defaultExtensions[strings.ToLower(name)]
+		}
+		for _, ext := range extensions {
+			if !strings.HasPrefix(ext, ".") {
+				ext = "." + ext
+			}
+			// The first server configured for an extension wins
+			if _, ok := m.extensions[ext]; !ok {
+				m.extensions[ext] = name
+			}
+		}
+	}
+	return m
+}
+
+// WorkDir returns the directory the servers are rooted at
+func (m *Manager) WorkDir() string {
+	if m == nil {
+		return ""
+	}
+	return m.workDir
+}
+
+// Missing returns the commands of the servers that aren't installed, by
+// server name
+func (m *Manager) Missing() map[string]string {
+	if m == nil {
+		return nil
+	}
+	missing := make(map[string]string)
+	for _, name := range m.names {
+		command := m.configs[name].Command
+		if _, err := exec.LookPath(command); err != nil {
+			missing[name] = command
+		}
+	}
+	return missing
+}
+
+// Servers returns the names of the enabled servers, sorted
+func (m *Manager) Servers() []string {
+	if m == nil {
+		return nil
+	}
+	return m.names
+}
+
+// Handles reports whether a server is configured for the file
+func (m *Manager) Handles(path string) bool {
+	if m == nil {
+		return false
+	}
+	_, ok := m.extensions[filepath.Ext(path)]
+	return ok
+}
+
+// Check sends the current content of the files to their servers and
+// returns the diagnostics reported for them. Files no server handles are
+// skipped. Servers that fail are reported in the error alongside the
+// diagnostics of the others.
+func (m *Manager) Check(ctx context.Context, paths ...string) ([]Diagnostic, error) {
+	if m == nil {
+		return nil, nil
+	}
+
+	type pending struct {
+		client *Client
+		path   string
+		seen   int
+	}
+	var waits []pending
+	var errs []error
+
+	for _, path := range paths {
+		if !m.Handles(path) {
+			continue
+		}
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(m.workDir, path)
+		}
+		client, seen, err := m.open(ctx, path)
+		if err != nil {
+			if !os.IsNotExist(err) {
+				errs = append(errs, err)
+			}
+			continue
+		}
+		waits = append(waits, pending{client: client, path: path, seen: seen})
+	}
+
+	var result []Diagnostic
+	deadline := time.Now().Add(checkTimeout)
+	for _, w := range waits {
+		diagnostics, err := w.client.Wait(ctx, w.path, w.seen, settleDelay, time.Until(deadline))
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", w.client.name, err))
+			continue
+		}
+		result = append(result, diagnostics...)
+	}
+	sortDiagnostics(result)
+	return result, errors.Join(errs...)
+}
+
+// open sends the current content of a file to its server. It returns the
+// number of diagnostics notifications seen for the file before, see
+// Client.Sync.
+func (m *Manager) open(ctx context.Context, path string) (*Client, int, error) {
+	name, ok := m.extensions[filepath.Ext(path)]
+	if !ok {
+		return nil, 0, fmt.Errorf("no language server is configured for %s", path)
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	client, err := m.client(ctx, name)
+	if err != nil {
+		return nil, 0, err
+	}
+	seen, err := client.Sync(path, string(content))
+	if err != nil {
+		return nil, 0, err
+	}
+	m.mu.Lock()
+	m.checked[path] = true
+	m.mu.Unlock()
+	return client, seen, nil
+}
+
+// Diagnostics returns the latest diagnostics for every file checked so far,
+// including files the servers report on by themselves
+func (m *Manager) Diagnostics() []Diagnostic {
+	if m == nil {
+		return nil
+	}
+
+	m.mu.Lock()
+	clients := make([]*Client, 0, len(m.clients))
+	for _, client := range m.clients {
+		clients = append(clients, client)
+	}
+	m.mu.Unlock()
+
+	var result []Diagnostic
+	for _, client := range clients {
+		result = append(result, client.All()...)
+	}
+	sortDiagnostics(result)
+	return result
+}
+
+// Close shuts down the running servers
+func (m *Manager) Close() error {
+	if m == nil {
+		return nil
+	}
+
+	m.mu.Lock()
+	clients := m.clients
+	m.clients = make(map[string]*Client)
+	m.mu.Unlock()
+
+	for _, client := range clients {
+		client.Close()
+	}
+	return nil
+}
+
+// client returns the named server's client, starting the server if needed.
+// A server that failed to start isn't retried.
+func (m *Manager) client(ctx context.Context, name string) (*Client, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if client, ok := m.clients[name]; ok {
+		select {
+		case <-client.done:
+			// Restart servers that crashed
+			delete(m.clients, name)
+		default:
+			return client, nil
+		}
+	}
+	if err, ok := m.failed[name]; ok {
+		return nil, err
+	}
+
+	startCtx, cancel := context.WithTimeout(ctx, startTimeout)
+	defer cancel()
+	client, err := Start(startCtx, name, m.configs[name], m.workDir)
+	if err != nil {
+		err = fmt.Errorf("language server %s: %w", name, err)
+		if ctx.Err() == nil {
+			m.failed[name] = err
+		}
+		return nil, err
+	}
+	m.clients[name] = client
+
+	// A restarted server needs the files it was checking reopened
+	for path := range m.checked {
+		if m.extensions[filepath.Ext(path)] != name {
+			continue
+		}
+		if content, err := os.ReadFile(path); err == nil {
+			client.Sync(path, string(content))
+		}
+	}
+	return client, nil
+}
@@ -0,0 +1,256 @@
+package lsp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"unicode/utf16"
+)
+
+// Location is a position in a file
+type Location struct {
+	Path   string // absolute
+	Line   int    // 1-based
+	Column int    // 1-based, in UTF-16 code units as servers count them
+}
+
+// Symbol is a declaration a server reported
+type Symbol struct {
+	Name      string
+	Kind      string
+	Detail    string
+	Container string // enclosing symbol, if any
+	Location
+}
+
+// Definition returns where the symbol at a position in a file is defined.
+// line and column are 1-based; see Column to find the column of a name.
+func (m *Manager) Definition(ctx context.Context, path string, line, column int) ([]Location, error) {
+	result, err := m.positionRequest(ctx, "textDocument/definition", path, line, column, nil)
+	if err != nil {
+		return nil, err
+	}
+	return parseLocations(result), nil
+}
+
+// References returns where the symbol at a position in a file is used,
+// including its declaration
+func (m *Manager) References(ctx context.Context, path string, line, column int) ([]Location, error) {
+	result, err := m.positionRequest(ctx, "textDocument/references", path, line, column, map[string]interface{}{
+		"context": map[string]bool{"includeDeclaration": true},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return parseLocations(result), nil
+}
+
+// DocumentSymbols returns the symbols declared in a file, outermost first
+func (m *Manager) DocumentSymbols(ctx context.Context, path string) ([]Symbol, error) {
+	if m == nil {
+		return nil, errors.New("no language servers are configured")
+	}
+	client, _, err := m.open(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	result, err := client.call(ctx, "textDocument/documentSymbol", map[string]interface{}{
+		"textDocument": map[string]string{"uri": pathToURI(path)},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", client.name, err)
+	}
+	return parseSymbols(result, path), nil
+}
+
+// WorkspaceSymbols searches every configured server for symbols matching
+// query. Servers that fail are reported in the error alongside the symbols
+// of the others.
+func (m *Manager) WorkspaceSymbols(ctx context.Context, query string) ([]Symbol, error) {
+	if m == nil {
+		return nil, errors.New("no language servers are configured")
+	}
+
+	var symbols []Symbol
+	var errs []error
+	for _, name := range m.names {
+		client, err := m.client(ctx, name)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		result, err := client.call(ctx, "workspace/symbol", map[string]string{"query": query})
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+			continue
+		}
+		symbols = append(symbols, parseSymbols(result, "")...)
+	}
+	return symbols, errors.Join(errs...)
+}
+
+// Column returns the 1-based column, as servers count it, of byteOffset in
+// a line of text
+func Column(text string, byteOffset int) int {
+	if byteOffset > len(text) {
+		byteOffset = len(text)
+	}
+	return len(utf16.Encode([]rune(text[:byteOffset]))) + 1
+}
+
+func (m *Manager) positionRequest(ctx context.Context, method, path string, line, column int, extra map[string]interface{}) (json.RawMessage, error) {
+	if m == nil {
+		return nil, errors.New("no language servers are configured")
+	}
+	client, _, err := m.open(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+
+	params := map[string]interface{}{
+		"textDocument": map[string]string{"uri": pathToURI(path)},
+		"position":     position{Line: line - 1, Character: column - 1},
+	}
+	for k, v := range extra {
+		params[k] = v
+	}
+	result, err := client.call(ctx, method, params)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", client.name, err)
+	}
+	return result, nil
+}
+
+type lspRange struct {
+	Start position `json:"start"`
+}
+
+type lspLocation struct {
+	URI   string   `json:"uri"`
+	Range lspRange `json:"range"`
+
+	// LocationLink fields
+	TargetURI            string   `json:"targetUri"`
+	TargetSelectionRange lspRange `json:"targetSelectionRange"`
+}
+
+func (l lspLocation) convert() Location {
+	if l.TargetURI != "" {
+		return Location{
+			Path:   uriToPath(l.TargetURI),
+			Line:   l.TargetSelectionRange.Start.Line + 1,
+			Column: l.TargetSelectionRange.Start.Character + 1,
+		}
+	}
+	return Location{
+		Path:   uriToPath(l.URI),
+		Line:   l.Range.Start.Line + 1,
+		Column: l.Range.Start.Character + 1,
+	}
+}
+
+// parseLocations accepts a Location, a list of them or a list of
+// LocationLinks
+func parseLocations(result json.RawMessage) []Location {
+	var list []lspLocation
+	if err := json.Unmarshal(result, &list); err != nil {
+		var single lspLocation
+		if err := json.Unmarshal(result, &single); err != nil || (single.URI == "" && single.TargetURI == "") {
+			return nil
+		}
+		list = []lspLocation{single}
+	}
+
+	locations := make([]Location, 0, len(list))
+	for _, l := range list {
+		locations = append(locations, l.convert())
+	}
+	sort.SliceStable(locations, func(i, j int) bool {
+		a, b := locations[i], locations[j]
+		if a.Path != b.Path {
+			return a.Path < b.Path
+		}
+		return a.Line < b.Line
+	})
+	return locations
+}
+
+type lspSymbol struct {
+	Name   string `json:"name"`
+	Kind   int    `json:"kind"`
+	Detail string `json:"detail"`
+
+	// DocumentSymbol fields
+	SelectionRange *lspRange    `json:"selectionRange"`
+	Children       []*lspSymbol `json:"children"`
+
+	// SymbolInformation and WorkspaceSymbol fields
+	Location      *lspLocation `json:"location"`
+	ContainerName string       `json:"containerName"`
+}
+
+// parseSymbols accepts DocumentSymbols, which are nested and located in
+// path, or SymbolInformation and WorkspaceSymbols, which carry their
+// location
+func parseSymbols(result json.RawMessage, path string) []Symbol {
+	var list []*lspSymbol
+	if err := json.Unmarshal(result, &list); err != nil {
+		return nil
+	}
+
+	var symbols []Symbol
+	var walk func(s *lspSymbol, container string)
+	walk = func(s *lspSymbol, container string) {
+		symbol := Symbol{
+			Name:      s.Name,
+			Kind:      symbolKind(s.Kind),
+			Detail:    s.Detail,
+			Container: container,
+		}
+		switch {
+		case s.Location != nil:
+			symbol.Location = s.Location.convert()
+			if s.ContainerName != "" {
+				symbol.Container = s.ContainerName
+			}
+		case s.SelectionRange != nil:
+			symbol.Location = Location{
+				Path:   path,
+				Line:   s.SelectionRange.Start.Line + 1,
+				Column: s.SelectionRange.Start.Character + 1,
+			}
+		}
+		symbols = append(symbols, symbol)
+		for _, child := range s.Children {
+			walk(child, s.Name)
+		}
+	}
+	for _, s := range list {
+		walk(s, "")
+	}
+	return symbols
+}
+
+var symbolKinds = []string{
+	"file", "module", "namespace", "package", "class", "method", "property",
+	"field", "constructor", "enum", "interface", "function", "variable",
+	"constant", "string", "number", "boolean", "array", "object", "key",
+	"null", "enum member", "struct", "event", "operator", "type parameter",
+}
+
+func symbolKind(kind int) string {
+	if kind >= 1 && kind <= len(symbolKinds) {
+		return symbolKinds[kind-1]
+	}
+	return "symbol"
+}
+
+// RelPath returns path relative to the servers' root when it is inside it
+func (m *Manager) RelPath(path string) string {
+	if m == nil {
+		return path
+	}
+	return relPath(m.workDir, path)
+}
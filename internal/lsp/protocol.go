@@ -0,0 +1,218 @@
+package lsp
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Severity of a diagnostic, as defined by the protocol
+type Severity int
+
+const (
+	SeverityError   Severity = 1
+	SeverityWarning Severity = 2
+	SeverityInfo    Severity = 3
+	SeverityHint    Severity = 4
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityError:
+		return "error"
+	case SeverityWarning:
+		return "warning"
+	case SeverityInfo:
+		return "info"
+	case SeverityHint:
+		return "hint"
+	}
+	return "error"
+}
+
+// Diagnostic is a problem a language server reported in a file
+type Diagnostic struct {
+	Path     string // absolute
+	Line     int    // 1-based
+	Column   int    // 1-based
+	Severity Severity
+	Source   string
+	Code     string
+	Message  string
+}
+
+// Format renders diagnostics one per line as path:line:col: severity: message,
+// with paths relative to workDir
+func Format(diagnostics []Diagnostic, workDir string) string {
+	var b strings.Builder
+	for _, d := range diagnostics {
+		fmt.Fprintf(&b, "%s:%d:%d: %s: %s", relPath(workDir, d.Path), d.Line, d.Column, d.Severity, strings.TrimSpace(d.Message))
+		switch {
+		case d.Source != "" && d.Code != "":
+			fmt.Fprintf(&b, " (%s %s)", d.Source, d.Code)
+		case d.Source != "":
+			fmt.Fprintf(&b, " (%s)", d.Source)
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// Errors returns the diagnostics with error severity
+func Errors(diagnostics []Diagnostic) []Diagnostic {
+	var result []Diagnostic
+	for _, d := range diagnostics {
+		if d.Severity == SeverityError {
+			result = append(result, d)
+		}
+	}
+	return result
+}
+
+// relPath returns path relative to workDir when it is inside it
+func relPath(workDir, path string) string {
+	rel, err := filepath.Rel(workDir, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return path
+	}
+	return filepath.ToSlash(rel)
+}
+
+func sortDiagnostics(diagnostics []Diagnostic) {
+	sort.SliceStable(diagnostics, func(i, j int) bool {
+		a, b := diagnostics[i], diagnostics[j]
+		if a.Path != b.Path {
+			return a.Path < b.Path
+		}
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Column < b.Column
+	})
+}
+
+// Wire format of the messages exchanged with servers
+
+type message struct {
+	JSONRPC string           `json:"jsonrpc"`
+	ID      *json.RawMessage `json:"id,omitempty"`
+	Method  string           `json:"method,omitempty"`
+	Params  json.RawMessage  `json:"params,omitempty"`
+	Result  json.RawMessage  `json:"result,omitempty"`
+	Error   *responseError   `json:"error,omitempty"`
+}
+
+type responseError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *responseError) Error() string {
+	return fmt.Sprintf("%s (code %d)", e.Message, e.Code)
+}
+
+type position struct {
+	Line      int `json:"line"`
+	Character int `json:"character"`
+}
+
+type publishDiagnosticsParams struct {
+	URI         string `json:"uri"`
+	Diagnostics []struct {
+		Range struct {
+			Start position `json:"start"`
+		} `json:"range"`
+		Severity Severity        `json:"severity"`
+		Code     json.RawMessage `json:"code"`
+		Source   string          `json:"source"`
+		Message  string          `json:"message"`
+	} `json:"diagnostics"`
+}
+
+func (p publishDiagnosticsParams) convert() []Diagnostic {
+	path := uriToPath(p.URI)
+	result := make([]Diagnostic, 0, len(p.Diagnostics))
+	for _, d := range p.Diagnostics {
+		severity := d.Severity
+		if severity == 0 {
+			// Clients decide when a server doesn't say
+			severity = SeverityError
+		}
+		var code string
+		if len(d.Code) > 0 && string(d.Code) != "null" {
+			if err := json.Unmarshal(d.Code, &code); err != nil {
+				code = string(d.Code) // numeric codes
+			}
+		}
+		result = append(result, Diagnostic{
+			Path:     path,
+			Line:     d.Range.Start.Line + 1,
+			Column:   d.Range.Start.Character + 1,
+			Severity: severity,
+			Source:   d.Source,
+			Code:     code,
+			Message:  d.Message,
+		})
+	}
+	sortDiagnostics(result)
+	return result
+}
+
+func pathToURI(path string) string {
+	return (&url.URL{Scheme: "file", Path: filepath.ToSlash(path)}).String()
+}
+
+func uriToPath(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme != "file" {
+		return uri
+	}
+	return filepath.FromSlash(u.Path)
+}
+
+// languageIDs maps file extensions to the protocol's language identifiers
+var languageIDs = map[string]string{
+	".go":    "go",
+	".py":    "python",
+	".rs":    "rust",
+	".ts":    "typescript",
+	".tsx":   "typescriptreact",
+	".js":    "javascript",
+	".jsx":   "javascriptreact",
+	".c":     "c",
+	".h":     "c",
+	".cc":    "cpp",
+	".cpp":   "cpp",
+	".hpp":   "cpp",
+	".java":  "java",
+	".rb":    "ruby",
+	".lua":   "lua",
+	".zig":   "zig",
+	".cs":    "csharp",
+	".php":   "php",
+	".swift": "swift",
+	".kt":    "kotlin",
+}
+
+// defaultExtensions are the extensions of servers configured under a
+// language name without listing their own
+var defaultExtensions = map[string][]string{
+	"go":         {".go"},
+	"python":     {".py"},
+	"rust":       {".rs"},
+	"typescript": {".ts", ".tsx", ".js", ".jsx"},
+	"javascript": {".js", ".jsx"},
+	"c":          {".c", ".h"},
+	"cpp":        {".cc", ".cpp", ".hpp", ".h"},
+	"java":       {".java"},
+	"ruby":       {".rb"},
+	"lua":        {".lua"},
+	"zig":        {".zig"},
+	"csharp":     {".cs"},
+	"php":        {".php"},
+	"swift":      {".swift"},
+	"kotlin":     {".kt"},
+}
@@ -0,0 +1,162 @@
+// Package modelinfo is the catalog of model profiles: context windows and
+// capabilities of common models, with the config's profiles layered over
+// them. Prices are kept by the pricing package.
+package modelinfo
+
+import (
+	"strings"
+
+	"github.com/omnitrix-sh/core.sh/pkg/models"
+)
+
+var (
+	yes = func() *bool { b := true; return &b }()
+	no  = func() *bool { b := false; return &b }()
+)
+
+// builtinProfiles are the profiles of common models. Local models have no
+// context size: Ollama runs them with its num_ctx option, not the most
+// the model supports.
+var builtinProfiles = map[string]models.ModelProfile{
+	"gpt-4o":            {ContextSize: 128000, SupportsTools: yes, SupportsVision: yes},
+	"gpt-4o-mini":       {ContextSize: 128000, SupportsTools: yes, SupportsVision: yes},
+	"gpt-4.1":           {ContextSize: 1047576, SupportsTools: yes, SupportsVision: yes},
+	"gpt-4.1-mini":      {ContextSize: 1047576, SupportsTools: yes, SupportsVision: yes},
+	"gpt-4.1-nano":      {ContextSize: 1047576, SupportsTools: yes, SupportsVision: yes},
+	"gpt-4-turbo":       {ContextSize: 128000, SupportsTools: yes, SupportsVision: yes},
+	"gpt-3.5-turbo":     {ContextSize: 16385, SupportsTools: yes, SupportsVision: no},
+	"o1":                {ContextSize: 200000, SupportsTools: yes, SupportsVision: yes},
+	"o1-mini":           {ContextSize: 128000, SupportsTools: no, SupportsVision: no},
+	"o3":                {ContextSize: 200000, SupportsTools: yes, SupportsVision: yes},
+	"o3-mini":           {ContextSize: 200000, SupportsTools: yes, SupportsVision: no},
+	"o4-mini":           {ContextSize: 200000, SupportsTools: yes, SupportsVision: yes},
+	"claude-3-5-haiku":  {ContextSize: 200000, SupportsTools: yes, SupportsVision: yes},
+	"claude-3-5-sonnet": {ContextSize: 200000, SupportsTools: yes, SupportsVision: yes},
+	"claude-3-7-sonnet": {ContextSize: 200000, SupportsTools: yes, SupportsVision: yes},
+	"claude-3-opus":     {ContextSize: 200000, SupportsTools: yes, SupportsVision: yes},
+	"claude-sonnet-4":   {ContextSize: 200000, SupportsTools: yes, SupportsVision: yes},
+	"claude-opus-4":     {ContextSize: 200000, SupportsTools: yes, SupportsVision: yes},
+	"deepseek-chat":     {ContextSize: 64000, SupportsTools: yes, SupportsVision: no},
+	"deepseek-reasoner": {ContextSize: 64000, SupportsTools: no, SupportsVision: no},
+
+	"llama3.1":        {SupportsTools: yes, SupportsVision: no},
+	"llama3.2":        {SupportsTools: yes, SupportsVision: no},
+	"llama3.2-vision": {SupportsTools: no, SupportsVision: yes},
+	"llama3.3":        {SupportsTools: yes, SupportsVision: no},
+	"qwen2.5":         {SupportsTools: yes, SupportsVision: no},
+	"qwen2.5-coder":   {SupportsTools: yes, SupportsVision: no},
+	"qwen3":           {SupportsTools: yes, SupportsVision: no},
+	"mistral":         {SupportsTools: yes, SupportsVision: no},
+	"mistral-nemo":    {SupportsTools: yes, SupportsVision: no},
+	"llava":           {SupportsTools: no, SupportsVision: yes},
+	"gemma2":          {SupportsTools: no, SupportsVision: no},
+	"gemma3":          {SupportsTools: no, SupportsVision: yes},
+	"deepseek-r1":     {SupportsTools: no, SupportsVision: no},
+	"phi4":            {SupportsTools: no, SupportsVision: no},
+	"codellama":       {SupportsTools: no, SupportsVision: no},
+}
+
+// Catalog looks up model profiles
+type Catalog struct {
+	overrides map[string]models.ModelProfile
+}
+
+// NewCatalog creates a catalog of the built-in profiles with overrides,
+// usually Config.Models, layered over them field by field. The "*"
+// override applies to every model, under the model's own.
+func NewCatalog(overrides map[string]models.ModelProfile) *Catalog {
+	lowered := make(map[string]models.ModelProfile, len(overrides))
+	for name, profile := range overrides {
+		lowered[strings.ToLower(name)] = profile
+	}
+	return &Catalog{overrides: lowered}
+}
+
+// Lookup returns the profile of a model and whether anything is known
+// about it. Names match as in the pricing catalog: dated snapshots such as
+// gpt-4o-2024-08-06 match their base name and a "provider/" prefix is
+// ignored, as is an Ollama tag such as ":8b".
+func (c *Catalog) Lookup(model string) (models.ModelProfile, bool) {
+	name := strings.ToLower(model)
+	if i := strings.LastIndex(name, "/"); i >= 0 {
+		name = name[i+1:]
+	}
+	if i := strings.Index(name, ":"); i >= 0 {
+		name = name[:i]
+	}
+
+	builtin := match(builtinProfiles, name)
+	profile, found := builtinProfiles[builtin]
+	if wildcard, ok := c.overrides["*"]; ok {
+		profile = Merge(profile, wildcard)
+		found = true
+	}
+	// An override applies unless a built-in name is more specific, so one
+	// of gpt-4o leaves gpt-4o-mini alone
+	if key := match(c.overrides, name); key != "" && len(key) >= len(builtin) {
+		profile = Merge(profile, c.overrides[key])
+		found = true
+	}
+	return profile, found
+}
+
+// match returns the name among profiles that name is, or the longest one
+// it extends with a "-" suffix, so gpt-4o-mini-x is not taken for gpt-4o.
+// It returns "" if there is none.
+func match(profiles map[string]models.ModelProfile, name string) string {
+	if _, ok := profiles[name]; ok {
+		return name
+	}
+	best := ""
+	for candidate := range profiles {
+		if len(candidate) > len(best) && strings.HasPrefix(name, candidate+"-") {
+			best = candidate
+		}
+	}
+	return best
+}
+
+// Merge returns base with the fields over sets replacing its own
+func Merge(base, over models.ModelProfile) models.ModelProfile {
+	p := base
+	if over.MaxTokens > 0 {
+		p.MaxTokens = over.MaxTokens
+	}
+	if over.Temperature != nil {
+		p.Temperature = over.Temperature
+	}
+	if over.TopP != nil {
+		p.TopP = over.TopP
+	}
+	if len(over.Stop) > 0 {
+		p.Stop = over.Stop
+	}
+	if over.Seed != nil {
+		p.Seed = over.Seed
+	}
+	if over.FrequencyPenalty != nil {
+		p.FrequencyPenalty = over.FrequencyPenalty
+	}
+	if over.PresencePenalty != nil {
+		p.PresencePenalty = over.PresencePenalty
+	}
+	if over.ReasoningEffort != "" {
+		p.ReasoningEffort = over.ReasoningEffort
+	}
+	if over.ThinkingBudget > 0 {
+		p.ThinkingBudget = over.ThinkingBudget
+	}
+	if over.ContextSize > 0 {
+		p.ContextSize = over.ContextSize
+	}
+	if over.SupportsTools != nil {
+		p.SupportsTools = over.SupportsTools
+	}
+	if over.SupportsVision != nil {
+		p.SupportsVision = over.SupportsVision
+	}
+	if over.Price != nil {
+		p.Price = over.Price
+	}
+	return p
+}
@@ -0,0 +1,159 @@
+package onboard
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/omnitrix-sh/core.sh/internal/db"
+	"github.com/omnitrix-sh/core.sh/internal/keyring"
+	"github.com/omnitrix-sh/core.sh/pkg/models"
+)
+
+// ErrCancelled is returned when the user gives up on onboarding
+var ErrCancelled = errors.New("onboarding cancelled")
+
+// Prompter asks the user questions. Frontends implement it to run the
+// onboarding flow in their own way.
+type Prompter interface {
+	// Info shows a message
+	Info(text string)
+	// Choose asks for one of options and returns its index
+	Choose(question string, options []string) (int, error)
+	// Ask asks for text; secret input such as API keys should be hidden
+	Ask(question string, secret bool) (string, error)
+}
+
+// Result is what onboarding set up
+type Result struct {
+	Choice     Choice          `json:"choice"`
+	ConfigPath string          `json:"config_path"`
+	Session    *models.Session `json:"session"`
+}
+
+// Run walks the user through setup: picking a provider and model among
+// those detected, testing them, saving the config and creating a demo
+// session
+func Run(ctx context.Context, p Prompter, queries *db.Queries) (*Result, error) {
+	p.Info("Let's set up Omnitrix. Looking for AI providers...")
+	for {
+		candidates := Detect(ctx)
+		choice, retry, err := choose(p, candidates)
+		if err != nil {
+			return nil, err
+		}
+		if retry {
+			continue
+		}
+
+		p.Info(fmt.Sprintf("Testing %s with %s...", choice.Provider, choice.Model))
+		if err := Test(ctx, choice); err != nil {
+			p.Info(err.Error())
+			i, err := p.Choose("The test failed. What now?", []string{"Choose again", "Save anyway", "Cancel"})
+			if err != nil {
+				return nil, err
+			}
+			switch i {
+			case 0:
+				continue
+			case 2:
+				return nil, ErrCancelled
+			}
+		} else {
+			p.Info("It works.")
+		}
+
+		if choice.APIKey != "" && !keyring.Available() {
+			i, err := p.Choose("There is no keyring to keep the API key in. Write it into the config file?", []string{"Yes", "No, cancel"})
+			if err != nil {
+				return nil, err
+			}
+			if i != 0 {
+				return nil, ErrCancelled
+			}
+			choice.KeyInConfig = true
+		}
+		path, err := Save(ctx, choice)
+		if err != nil {
+			return nil, err
+		}
+		p.Info("Saved your settings to " + path)
+
+		session, err := DemoSession(ctx, queries, choice)
+		if err != nil {
+			return nil, err
+		}
+		return &Result{Choice: choice, ConfigPath: path, Session: session}, nil
+	}
+}
+
+// choose lets the user pick a provider and model. retry is true when the
+// user wants to look for providers again, e.g. after starting Ollama.
+func choose(p Prompter, candidates []Candidate) (choice Choice, retry bool, err error) {
+	var options []string
+	for _, c := range candidates {
+		option := string(c.Provider)
+		switch {
+		case c.Ready:
+			option += " (ready)"
+		case c.NeedsKey:
+			option += " (needs an API key)"
+		default:
+			option += " (not available: " + c.Problem + ")"
+		}
+		options = append(options, option)
+	}
+	options = append(options, "Look again", "Cancel")
+
+	i, err := p.Choose("Which provider should Omnitrix use?", options)
+	if err != nil {
+		return Choice{}, false, err
+	}
+	switch {
+	case i == len(candidates):
+		return Choice{}, true, nil
+	case i < 0 || i > len(candidates):
+		return Choice{}, false, ErrCancelled
+	}
+
+	c := candidates[i]
+	if !c.Ready && !c.NeedsKey {
+		p.Info(c.Problem)
+		return Choice{}, true, nil
+	}
+	choice = Choice{Provider: c.Provider, BaseURL: c.BaseURL, APIKey: c.apiKey}
+	if c.NeedsKey {
+		key, err := p.Ask(fmt.Sprintf("%s API key:", c.Provider), true)
+		if err != nil {
+			return Choice{}, false, err
+		}
+		if choice.APIKey = strings.TrimSpace(key); choice.APIKey == "" {
+			return Choice{}, true, nil
+		}
+	}
+
+	switch len(c.Models) {
+	case 0:
+		model, err := p.Ask("Model:", false)
+		if err != nil {
+			return Choice{}, false, err
+		}
+		choice.Model = strings.TrimSpace(model)
+	case 1:
+		choice.Model = c.Models[0]
+	default:
+		i, err := p.Choose("Which model?", c.Models)
+		if err != nil {
+			return Choice{}, false, err
+		}
+		if i < 0 || i >= len(c.Models) {
+			return Choice{}, false, ErrCancelled
+		}
+		choice.Model = c.Models[i]
+	}
+	if choice.Model == "" {
+		return Choice{}, true, nil
+	}
+	return choice, false, nil
+}
@@ -0,0 +1,243 @@
+// Package onboard sets Omnitrix up on first run: it finds the providers
+// that can be used, checks that the chosen one answers, saves the choice
+// and creates a session to start from, instead of leaving new users with
+// defaults that may not work on their machine.
+package onboard
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/omnitrix-sh/core.sh/internal/config"
+	"github.com/omnitrix-sh/core.sh/internal/db"
+	"github.com/omnitrix-sh/core.sh/internal/keyring"
+	"github.com/omnitrix-sh/core.sh/internal/providers/ollama"
+	"github.com/omnitrix-sh/core.sh/internal/providers/openai"
+	"github.com/omnitrix-sh/core.sh/pkg/models"
+)
+
+const (
+	defaultOllamaURL = "http://localhost:11434"
+	// detectTimeout bounds looking for a local provider
+	detectTimeout = 3 * time.Second
+	// testTimeout bounds the test request, which may wait for a local
+	// model to load
+	testTimeout = 2 * time.Minute
+	// suggestedOllamaModel is what to pull when Ollama has no models
+	suggestedOllamaModel = "qwen2.5-coder:7b"
+)
+
+// openaiModels are offered for OpenAI, cheapest first
+var openaiModels = []string{"gpt-4o-mini", "gpt-4o"}
+
+// Needed reports whether Omnitrix hasn't been set up yet, i.e. there is no
+// user config file
+func Needed() bool {
+	path, err := config.UserPath()
+	if err != nil {
+		return false
+	}
+	_, err = os.Stat(path)
+	return os.IsNotExist(err)
+}
+
+// Candidate is a provider that was looked for
+type Candidate struct {
+	Provider models.ProviderType `json:"provider"`
+	BaseURL  string              `json:"base_url,omitempty"`
+	Models   []string            `json:"models,omitempty"`
+	// Ready means it can be used as it is. Otherwise Problem says what is
+	// missing, unless only an API key is, see NeedsKey.
+	Ready    bool   `json:"ready"`
+	NeedsKey bool   `json:"needs_key,omitempty"`
+	Problem  string `json:"problem,omitempty"`
+
+	apiKey string // found in the environment
+}
+
+// Detect looks for the providers Omnitrix supports, ready ones first
+func Detect(ctx context.Context) []Candidate {
+	candidates := []Candidate{detectOllama(ctx), detectOpenAI()}
+	if !candidates[0].Ready && candidates[1].Ready {
+		candidates[0], candidates[1] = candidates[1], candidates[0]
+	}
+	return candidates
+}
+
+// detectOllama asks a local Ollama server for its models
+func detectOllama(ctx context.Context) Candidate {
+	baseURL := defaultOllamaURL
+	if host := os.Getenv("OLLAMA_HOST"); host != "" {
+		baseURL = host
+		if !strings.Contains(baseURL, "://") {
+			baseURL = "http://" + baseURL
+		}
+	}
+	c := Candidate{Provider: models.ProviderOllama, BaseURL: baseURL}
+
+	ctx, cancel := context.WithTimeout(ctx, detectTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(baseURL, "/")+"/api/tags", nil)
+	if err != nil {
+		c.Problem = fmt.Sprintf("invalid Ollama address %s", baseURL)
+		return c
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		c.Problem = fmt.Sprintf("Ollama is not running at %s: install it from https://ollama.com and start it with `ollama serve`", baseURL)
+		return c
+	}
+	defer resp.Body.Close()
+
+	var tags struct {
+		Models []struct {
+			Name string `json:"name"`
+		} `json:"models"`
+	}
+	if resp.StatusCode != http.StatusOK || json.NewDecoder(resp.Body).Decode(&tags) != nil {
+		c.Problem = fmt.Sprintf("%s does not answer like Ollama (%s)", baseURL, resp.Status)
+		return c
+	}
+	for _, model := range tags.Models {
+		c.Models = append(c.Models, model.Name)
+	}
+	if len(c.Models) == 0 {
+		c.Problem = fmt.Sprintf("Ollama has no models: pull one, e.g. `ollama pull %s`", suggestedOllamaModel)
+		return c
+	}
+	c.Ready = true
+	return c
+}
+
+// detectOpenAI checks the environment for an API key. Without one OpenAI
+// can still be chosen by entering a key.
+func detectOpenAI() Candidate {
+	c := Candidate{Provider: models.ProviderOpenAI, Models: openaiModels}
+	if key := os.Getenv("OPENAI_API_KEY"); key != "" {
+		c.apiKey = key
+		c.Ready = true
+	} else {
+		c.NeedsKey = true
+	}
+	return c
+}
+
+// Choice is what the user picked
+type Choice struct {
+	Provider models.ProviderType `json:"provider"`
+	BaseURL  string              `json:"base_url,omitempty"`
+	Model    string              `json:"model"`
+	APIKey   string              `json:"-"`
+	// KeyInConfig writes the API key into the config file when there is
+	// no keyring to keep it in, instead of failing
+	KeyInConfig bool `json:"-"`
+}
+
+// Test sends a tiny request to check that the provider answers with the
+// chosen model
+func Test(ctx context.Context, choice Choice) error {
+	ctx, cancel := context.WithTimeout(ctx, testTimeout)
+	defer cancel()
+
+	req := models.ChatRequest{
+		Model:     choice.Model,
+		MaxTokens: 5,
+		Messages:  []models.Message{{Role: models.RoleUser, Content: "Reply with the word OK."}},
+	}
+	var err error
+	switch choice.Provider {
+	case models.ProviderOllama:
+		_, err = ollama.NewProvider(choice.BaseURL, choice.Model).Chat(ctx, req)
+	case models.ProviderOpenAI:
+		_, err = openai.NewProvider(choice.APIKey, choice.Model).Chat(ctx, req)
+	default:
+		return fmt.Errorf("unsupported provider: %s", choice.Provider)
+	}
+	if err != nil {
+		return fmt.Errorf("%s did not answer with %s: %w", choice.Provider, choice.Model, err)
+	}
+	return nil
+}
+
+// Save writes the choice to the user config, with the API key in the
+// system keyring, and returns the config's path
+func Save(ctx context.Context, choice Choice) (string, error) {
+	apiKey := choice.APIKey
+	if apiKey != "" {
+		name := string(choice.Provider)
+		err := keyring.Set(ctx, name, apiKey)
+		switch {
+		case err == nil:
+			apiKey = config.KeyringPrefix + name
+		case errors.Is(err, keyring.ErrUnavailable) && choice.KeyInConfig:
+		default:
+			return "", fmt.Errorf("failed to store the API key: %w", err)
+		}
+	}
+
+	return config.SaveUser(map[string]interface{}{
+		"providers": map[models.ProviderType]models.ProviderConfig{
+			choice.Provider: {
+				Enabled: true,
+				BaseURL: choice.BaseURL,
+				APIKey:  apiKey,
+				Models:  []string{choice.Model},
+			},
+		},
+		"default_provider": string(choice.Provider),
+		"default_model":    choice.Model,
+	})
+}
+
+// welcome is the first message of the demo session
+const welcome = `Welcome to Omnitrix! I'm set up with %s on %s and ready to work in your project.
+
+Some things to try:
+- "Give me an overview of this project"
+- "Find where configuration is loaded"
+- "Run the tests and explain any failures"
+- "Add a README section describing the build steps"
+
+I ask before changing files or running commands, and every turn can be rolled back.`
+
+// DemoSession creates a session that starts with a short introduction
+func DemoSession(ctx context.Context, queries *db.Queries, choice Choice) (*models.Session, error) {
+	now := time.Now()
+	row, err := queries.CreateSession(ctx, db.CreateSessionParams{
+		ID:        uuid.New().String(),
+		Title:     "Welcome to Omnitrix",
+		Model:     choice.Model,
+		Provider:  string(choice.Provider),
+		CreatedAt: now.Unix(),
+		UpdatedAt: now.Unix(),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create session: %w", err)
+	}
+	_, err = queries.CreateMessage(ctx, db.CreateMessageParams{
+		ID:        uuid.New().String(),
+		SessionID: row.ID,
+		Role:      string(models.RoleAssistant),
+		Content:   fmt.Sprintf(welcome, choice.Model, choice.Provider),
+		CreatedAt: now.Unix(),
+		UpdatedAt: now.Unix(),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create welcome message: %w", err)
+	}
+	return &models.Session{
+		ID:        row.ID,
+		Title:     row.Title,
+		Model:     row.Model,
+		Provider:  row.Provider,
+		CreatedAt: time.Unix(row.CreatedAt, 0),
+		UpdatedAt: time.Unix(row.UpdatedAt, 0),
+	}, nil
+}
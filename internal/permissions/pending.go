@@ -0,0 +1,114 @@
+package permissions
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Pending is an approver for frontends that answer requests out of band,
+// such as clients of the HTTP server: every request waits until Answer is
+// called with its ID, and counts as declined if that takes longer than the
+// timeout. The frontend learns of requests from the event bus. Questions
+// from the model wait for AnswerQuestion the same way.
+type Pending struct {
+	timeout time.Duration
+
+	mu        sync.Mutex
+	waiting   map[string]chan bool   // request ID -> answer
+	questions map[string]chan string // question ID -> answer
+}
+
+// NewPending creates a Pending approver. A timeout of 0 waits as long as
+// the run does.
+func NewPending(timeout time.Duration) *Pending {
+	return &Pending{
+		timeout:   timeout,
+		waiting:   make(map[string]chan bool),
+		questions: make(map[string]chan string),
+	}
+}
+
+func (p *Pending) Approve(ctx context.Context, req Request) (bool, error) {
+	answer := make(chan bool, 1)
+	p.mu.Lock()
+	p.waiting[req.ID] = answer
+	p.mu.Unlock()
+	defer func() {
+		p.mu.Lock()
+		delete(p.waiting, req.ID)
+		p.mu.Unlock()
+	}()
+
+	approved, ok, err := wait(ctx, p.timeout, answer)
+	return ok && approved, err
+}
+
+// Answer decides the request with ID id. It reports false if no such
+// request is waiting; only the first answer to a request counts.
+func (p *Pending) Answer(id string, approved bool) bool {
+	p.mu.Lock()
+	answer, ok := p.waiting[id]
+	delete(p.waiting, id)
+	p.mu.Unlock()
+	if ok {
+		answer <- approved
+	}
+	return ok
+}
+
+// Ask waits for AnswerQuestion to be called with the question's ID. An
+// empty answer or none within the timeout leave it unanswered.
+func (p *Pending) Ask(ctx context.Context, q Question) (string, error) {
+	answer := make(chan string, 1)
+	p.mu.Lock()
+	p.questions[q.ID] = answer
+	p.mu.Unlock()
+	defer func() {
+		p.mu.Lock()
+		delete(p.questions, q.ID)
+		p.mu.Unlock()
+	}()
+
+	text, ok, err := wait(ctx, p.timeout, answer)
+	if err != nil {
+		return "", err
+	}
+	if !ok || text == "" {
+		return "", ErrUnanswered
+	}
+	return text, nil
+}
+
+// AnswerQuestion answers the question with ID id. It reports false if no
+// such question is waiting; only the first answer to a question counts.
+func (p *Pending) AnswerQuestion(id, text string) bool {
+	p.mu.Lock()
+	answer, ok := p.questions[id]
+	delete(p.questions, id)
+	p.mu.Unlock()
+	if ok {
+		answer <- text
+	}
+	return ok
+}
+
+// wait returns the answer sent on answer. It reports false if none came
+// within the timeout, and ctx's error if it was done first.
+func wait[T any](ctx context.Context, timeout time.Duration, answer <-chan T) (T, bool, error) {
+	var zero T
+	var expired <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		expired = timer.C
+	}
+	select {
+	case value := <-answer:
+		return value, true, nil
+	case <-expired:
+		return zero, false, nil
+	case <-ctx.Done():
+		return zero, false, ctx.Err()
+	}
+}
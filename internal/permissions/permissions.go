@@ -0,0 +1,315 @@
+package permissions
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/google/uuid"
+	"github.com/omnitrix-sh/core.sh/internal/tools"
+	"github.com/omnitrix-sh/core.sh/pkg/models"
+)
+
+// Action is what happens when a tool is about to run
+type Action string
+
+const (
+	Allow Action = "allow"
+	Deny  Action = "deny"
+	Ask   Action = "ask"
+)
+
+// defaultActions apply to risk levels the config does not mention
+var defaultActions = map[tools.Risk]Action{
+	tools.RiskRead:    Allow,
+	tools.RiskWrite:   Ask,
+	tools.RiskExecute: Ask,
+	tools.RiskNetwork: Ask,
+}
+
+// pathArgs are the tool arguments that name files or directories
+var pathArgs = []string{"file_path", "dir_path", "dest_dir", "archive_path", "paths"}
+
+// Request describes a tool execution awaiting a decision
+type Request struct {
+	// ID tells requests apart, so an answer given elsewhere, such as by an
+	// HTTP client, can be matched to its request
+	ID        string                 `json:"id"`
+	SessionID string                 `json:"session_id"`
+	Tool      string                 `json:"tool"`
+	Risk      tools.Risk             `json:"risk"`
+	Paths     []string               `json:"paths,omitempty"`
+	Args      map[string]interface{} `json:"args"`
+	// Preview shows what the tool would change, such as a diff, for tools
+	// that can tell, see tools.Previewer
+	Preview string `json:"preview,omitempty"`
+}
+
+// Approver asks the user whether a tool may run. UIs implement it to show a
+// prompt; it should block until the user answers or ctx is done.
+type Approver interface {
+	Approve(ctx context.Context, req Request) (bool, error)
+}
+
+// ApproverFunc adapts a function to the Approver interface
+type ApproverFunc func(ctx context.Context, req Request) (bool, error)
+
+func (f ApproverFunc) Approve(ctx context.Context, req Request) (bool, error) {
+	return f(ctx, req)
+}
+
+// Question is a question the model asks the user mid-run with the ask_user
+// tool
+type Question struct {
+	ID        string `json:"id"`
+	SessionID string `json:"session_id"`
+	Question  string `json:"question"`
+	// Options are likely answers the user may pick from; any other answer
+	// is fine too
+	Options []string `json:"options,omitempty"`
+}
+
+// Asker puts the model's questions to the user. Approvers that can take a
+// free-form answer implement it too; without one, the model is told to
+// carry on without asking. Ask should block until the user answers or ctx
+// is done, and return ErrUnanswered if the user won't answer.
+type Asker interface {
+	Ask(ctx context.Context, q Question) (string, error)
+}
+
+// ErrUnanswered is returned by an Asker when the user leaves a question
+// unanswered
+var ErrUnanswered = errors.New("the user did not answer")
+
+// Checker decides tool executions from the configured policies. It is
+// safe for concurrent use, and Update changes the policies of running
+// agents.
+type Checker struct {
+	workDir string
+
+	mu    sync.RWMutex
+	risks map[tools.Risk]Action
+	tools map[string]Action
+	paths []models.PathPermission
+	rules []Rule // the project's guardrails, see RulesFile
+}
+
+// NewChecker creates a checker from the permissions config and the
+// project's rules file. Paths in requests and patterns are relative to
+// workDir.
+func NewChecker(cfg models.PermissionsConfig, workDir string) (*Checker, error) {
+	c := &Checker{workDir: workDir}
+	if err := c.Update(cfg); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Update replaces the policies with those of cfg and the project's rules
+// file as it is now. If either is invalid the policies stay as they were.
+func (c *Checker) Update(cfg models.PermissionsConfig) error {
+	if err := ValidateConfig(cfg); err != nil {
+		return err
+	}
+	rules, err := LoadRules(c.workDir)
+	if err != nil {
+		return err
+	}
+	risks := make(map[tools.Risk]Action)
+	for risk, action := range defaultActions {
+		risks[risk] = action
+	}
+	for risk, action := range cfg.Risks {
+		risks[tools.Risk(risk)] = Action(action)
+	}
+	toolActions := make(map[string]Action)
+	for name, action := range cfg.Tools {
+		toolActions[name] = Action(action)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.risks, c.tools, c.paths, c.rules = risks, toolActions, cfg.Paths, rules
+	return nil
+}
+
+// ValidateConfig checks that every action in the permissions config is
+// one of allow, deny and ask
+func ValidateConfig(cfg models.PermissionsConfig) error {
+	for risk, action := range cfg.Risks {
+		if err := validAction(action); err != nil {
+			return fmt.Errorf("risk %q: %w", risk, err)
+		}
+	}
+	for name, action := range cfg.Tools {
+		if err := validAction(action); err != nil {
+			return fmt.Errorf("tool %q: %w", name, err)
+		}
+	}
+	for _, rule := range cfg.Paths {
+		if err := validAction(rule.Action); err != nil {
+			return fmt.Errorf("path %q: %w", rule.Pattern, err)
+		}
+	}
+	return nil
+}
+
+// Policy summarizes the rules in a stable form, for recording and comparing
+// the policy a session runs under
+func (c *Checker) Policy() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	var rules []string
+	for risk, action := range c.risks {
+		rules = append(rules, fmt.Sprintf("%s=%s", risk, action))
+	}
+	sort.Strings(rules)
+
+	var toolRules []string
+	for name, action := range c.tools {
+		toolRules = append(toolRules, fmt.Sprintf("tool:%s=%s", name, action))
+	}
+	sort.Strings(toolRules)
+	rules = append(rules, toolRules...)
+
+	// Path rules keep their order, though the strictest match wins anyway
+	for _, rule := range c.paths {
+		rules = append(rules, fmt.Sprintf("path:%s=%s", rule.Pattern, rule.Action))
+	}
+	for _, rule := range c.rules {
+		kind := "guard"
+		if rule.Command {
+			kind = "guard-command"
+		}
+		rules = append(rules, fmt.Sprintf("%s:%s=%s", kind, rule.Pattern, rule.Guard))
+	}
+	return strings.Join(rules, " ")
+}
+
+func validAction(action string) error {
+	switch Action(action) {
+	case Allow, Deny, Ask:
+		return nil
+	}
+	return fmt.Errorf("invalid action %q, expected allow, deny or ask", action)
+}
+
+// NewRequest describes running tool with args. Its paths are those of the
+// path arguments plus, for a tools.PathLister, the files the tool says it
+// changes; it fails when the tool can't tell.
+func NewRequest(ctx context.Context, sessionID string, tool tools.Tool, args map[string]interface{}) (Request, error) {
+	req := Request{
+		ID:        uuid.New().String(),
+		SessionID: sessionID,
+		Tool:      tool.Name(),
+		Risk:      tool.Risk(),
+		Args:      args,
+	}
+	for _, key := range pathArgs {
+		req.Paths = append(req.Paths, tools.GetStringSliceArg(args, key)...)
+	}
+	if lister, ok := tool.(tools.PathLister); ok {
+		paths, err := lister.Paths(ctx, args)
+		if err != nil {
+			return Request{}, err
+		}
+		req.Paths = append(req.Paths, paths...)
+	}
+	return req, nil
+}
+
+// Guard returns the guardrail a request breaks, if any. Such requests are
+// denied whatever else the policy says and must not be put to the user.
+func (c *Checker) Guard(req Request) (Rule, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return guard(c.rules, req, c.relative)
+}
+
+// Check decides a request. Requests breaking a guardrail are denied, see
+// Guard. Otherwise every rule that applies is considered and the
+// most restrictive wins, so a path rule can require approval for a tool
+// that is otherwise allowed. Without a tool or path rule the tool's risk
+// level decides.
+func (c *Checker) Check(req Request) Action {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if _, ok := guard(c.rules, req, c.relative); ok {
+		return Deny
+	}
+
+	var actions []Action
+	if action, ok := c.tools[req.Tool]; ok {
+		actions = append(actions, action)
+	}
+	for _, path := range req.Paths {
+		for _, rel := range c.relative(path) {
+			for _, rule := range c.paths {
+				if tools.MatchGlob(rule.Pattern, rel) {
+					actions = append(actions, Action(rule.Action))
+				}
+			}
+		}
+	}
+
+	if len(actions) == 0 {
+		if action, ok := c.risks[req.Risk]; ok {
+			return action
+		}
+		return Ask
+	}
+	return strictest(actions)
+}
+
+// relative returns a path relative to the working directory in slash form,
+// followed by the path it resolves to if a symlink leads elsewhere, so a
+// rule on a file also holds when it is reached through a link
+func (c *Checker) relative(path string) []string {
+	lexical := slashRel(c.workDir, path)
+	workDir, err := filepath.Abs(c.workDir)
+	if err != nil {
+		return []string{lexical}
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(workDir, path)
+	}
+	real, err := tools.EvalExisting(path)
+	if err != nil {
+		return []string{lexical}
+	}
+	if resolved, err := filepath.EvalSymlinks(workDir); err == nil {
+		workDir = resolved
+	}
+	if resolved := slashRel(workDir, real); resolved != lexical {
+		return []string{lexical, resolved}
+	}
+	return []string{lexical}
+}
+
+// slashRel returns path relative to dir in slash form, if it can be
+func slashRel(dir, path string) string {
+	if filepath.IsAbs(path) {
+		if rel, err := filepath.Rel(dir, path); err == nil {
+			path = rel
+		}
+	}
+	return strings.TrimPrefix(filepath.ToSlash(filepath.Clean(path)), "./")
+}
+
+func strictest(actions []Action) Action {
+	result := Allow
+	for _, action := range actions {
+		switch action {
+		case Deny:
+			return Deny
+		case Ask:
+			result = Ask
+		}
+	}
+	return result
+}
@@ -0,0 +1,229 @@
+package permissions
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/omnitrix-sh/core.sh/internal/tools"
+)
+
+// RulesFile is where a project keeps its guardrails, relative to its root.
+// Each line holds a pattern and a guard, separated by white space:
+//
+//	# paths the agent may read but never modify
+//	migrations/       readonly
+//	vendor/           readonly
+//	*.lock            readonly
+//	# paths it may not touch at all
+//	secrets/**        deny
+//	# commands it may never run, where * matches anything
+//	$ git push *      deny
+//	$ rm -rf *        deny
+//
+// A pattern ending in a slash covers everything in that directory.
+// Guardrails are checked before any other policy and can't be approved,
+// so they hold even when everything else is allowed. The rules file itself
+// is always read-only, see protectedPaths.
+const RulesFile = ".omnitrix/rules"
+
+// protectedPaths are read-only whatever the rules say: the project's
+// config, everything in .omnitrix including the rules file, so the agent
+// can't write itself a looser policy that a reload would then apply
+var protectedPaths = []string{
+	".omnitrix/**",
+	".omnitrix.json",
+	".omnitrix.yaml",
+	".omnitrix.yml",
+	".omnitrix.toml",
+}
+
+// Guard is what a rule keeps the agent from doing
+type Guard string
+
+const (
+	// GuardReadOnly lets tools read matching paths but not modify them
+	GuardReadOnly Guard = "readonly"
+	// GuardDeny keeps tools away from matching paths, or commands from
+	// running
+	GuardDeny Guard = "deny"
+)
+
+// commandPrefix marks a rule's pattern as a command
+const commandPrefix = "$"
+
+// commandArg is the tool argument holding a shell command
+const commandArg = "command"
+
+// commandSeparator splits a command line into the commands it runs
+var commandSeparator = regexp.MustCompile(`&&|\|\||[;|&\n]`)
+
+// Rule is one line of the rules file
+type Rule struct {
+	Pattern string `json:"pattern"`
+	Command bool   `json:"command,omitempty"`
+	Guard   Guard  `json:"guard"`
+
+	command *regexp.Regexp
+}
+
+// String returns the rule as written in the rules file
+func (r Rule) String() string {
+	if r.Command {
+		return fmt.Sprintf("%s %s %s", commandPrefix, r.Pattern, r.Guard)
+	}
+	return fmt.Sprintf("%s %s", r.Pattern, r.Guard)
+}
+
+// LoadRules reads the rules file of the project in workDir. Projects
+// without one get no rules and no error.
+func LoadRules(workDir string) ([]Rule, error) {
+	path := filepath.Join(workDir, RulesFile)
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", RulesFile, err)
+	}
+	rules, err := ParseRules(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", RulesFile, err)
+	}
+	return rules, nil
+}
+
+// ParseRules parses the contents of a rules file. Blank lines and lines
+// starting with # are skipped.
+func ParseRules(data string) ([]Rule, error) {
+	var rules []Rule
+	scanner := bufio.NewScanner(strings.NewReader(data))
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		rule, err := parseRule(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, scanner.Err()
+}
+
+func parseRule(line string) (Rule, error) {
+	i := strings.LastIndexAny(line, " \t")
+	if i < 0 {
+		return Rule{}, fmt.Errorf("expected a pattern and a guard, got %q", line)
+	}
+	rule := Rule{
+		Pattern: strings.TrimSpace(line[:i]),
+		Guard:   Guard(line[i+1:]),
+	}
+	if strings.HasPrefix(rule.Pattern, commandPrefix) {
+		rule.Command = true
+		rule.Pattern = strings.TrimSpace(strings.TrimPrefix(rule.Pattern, commandPrefix))
+	}
+	if rule.Pattern == "" {
+		return Rule{}, fmt.Errorf("expected a pattern and a guard, got %q", line)
+	}
+
+	switch {
+	case rule.Command && rule.Guard != GuardDeny:
+		return Rule{}, fmt.Errorf("invalid guard %q for a command, expected deny", rule.Guard)
+	case !rule.Command && rule.Guard != GuardReadOnly && rule.Guard != GuardDeny:
+		return Rule{}, fmt.Errorf("invalid guard %q, expected readonly or deny", rule.Guard)
+	}
+	if rule.Command {
+		rule.command = compileCommand(rule.Pattern)
+	} else if strings.HasSuffix(rule.Pattern, "/") {
+		rule.Pattern += "**"
+	}
+	return rule, nil
+}
+
+// compileCommand turns a command pattern into a regexp matching whole
+// commands, where * matches anything and runs of white space any white
+// space. A trailing " *" also matches nothing, so "git push *" catches a
+// bare "git push".
+func compileCommand(pattern string) *regexp.Regexp {
+	var b strings.Builder
+	b.WriteString(`^`)
+	words := strings.Fields(pattern)
+	for i, word := range words {
+		if i > 0 && i == len(words)-1 && word == "*" {
+			b.WriteString(`(\s+.*)?`)
+			break
+		}
+		if i > 0 {
+			b.WriteString(`\s+`)
+		}
+		parts := strings.Split(word, "*")
+		for j, part := range parts {
+			if j > 0 {
+				b.WriteString(`.*`)
+			}
+			b.WriteString(regexp.QuoteMeta(part))
+		}
+	}
+	b.WriteString(`$`)
+	return regexp.MustCompile(b.String())
+}
+
+// guard returns the rule a request breaks, if any. rel turns each of the
+// request's paths into the slash-separated paths relative to the project
+// it stands for.
+func guard(rules []Rule, req Request, rel func(string) []string) (Rule, bool) {
+	var paths []string
+	for _, path := range req.Paths {
+		paths = append(paths, rel(path)...)
+	}
+	commands := splitCommands(tools.GetStringArg(req.Args, commandArg, ""))
+
+	for _, rule := range rules {
+		if rule.Command {
+			for _, command := range commands {
+				if rule.command.MatchString(command) {
+					return rule, true
+				}
+			}
+			continue
+		}
+		if rule.Guard == GuardReadOnly && req.Risk == tools.RiskRead {
+			continue
+		}
+		for _, path := range paths {
+			if tools.MatchGlob(rule.Pattern, path) {
+				return rule, true
+			}
+		}
+	}
+
+	if req.Risk != tools.RiskRead {
+		for _, pattern := range protectedPaths {
+			for _, path := range paths {
+				if tools.MatchGlob(pattern, path) {
+					return Rule{Pattern: pattern, Guard: GuardReadOnly}, true
+				}
+			}
+		}
+	}
+	return Rule{}, false
+}
+
+// splitCommands returns the commands a shell command line runs, so a rule
+// also catches commands chained after others
+func splitCommands(line string) []string {
+	var commands []string
+	for _, command := range commandSeparator.Split(line, -1) {
+		if command = strings.TrimSpace(command); command != "" {
+			commands = append(commands, command)
+		}
+	}
+	return commands
+}
@@ -0,0 +1,80 @@
+package permissions
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/omnitrix-sh/core.sh/internal/tools"
+)
+
+func TestGuard(t *testing.T) {
+	workDir := t.TempDir()
+	for _, dir := range []string{"secrets", "migrations"} {
+		if err := os.Mkdir(filepath.Join(workDir, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink("secrets", filepath.Join(workDir, "docs")); err != nil {
+		t.Fatal(err)
+	}
+
+	rules, err := ParseRules(`
+migrations/   readonly
+*.lock        readonly
+secrets/**    deny
+$ git push *  deny
+$ rm -rf *    deny
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &Checker{workDir: workDir}
+
+	tests := []struct {
+		name  string
+		risk  tools.Risk
+		paths []string
+		cmd   string
+		want  string // the pattern of the rule broken, empty for none
+	}{
+		{"read of readonly path", tools.RiskRead, []string{"migrations/001.sql"}, "", ""},
+		{"write to readonly path", tools.RiskWrite, []string{"migrations/001.sql"}, "", "migrations/**"},
+		{"write to readonly glob", tools.RiskWrite, []string{"go.lock"}, "", "*.lock"},
+		{"read of denied path", tools.RiskRead, []string{"secrets/key"}, "", "secrets/**"},
+		{"absolute denied path", tools.RiskRead, []string{filepath.Join(workDir, "secrets/key")}, "", "secrets/**"},
+		{"denied path through symlink", tools.RiskRead, []string{"docs/key"}, "", "secrets/**"},
+		{"unguarded path", tools.RiskWrite, []string{"main.go"}, "", ""},
+		{"prefix sibling", tools.RiskWrite, []string{"migrations2/001.sql"}, "", ""},
+		{"one of several paths", tools.RiskWrite, []string{"main.go", "secrets/key"}, "", "secrets/**"},
+		{"denied command", tools.RiskExecute, nil, "git push origin main", "git push *"},
+		{"bare denied command", tools.RiskExecute, nil, "git push", "git push *"},
+		{"chained denied command", tools.RiskExecute, nil, "go test ./... && rm -rf /", "rm -rf *"},
+		{"piped denied command", tools.RiskExecute, nil, "echo y | git push", "git push *"},
+		{"allowed command", tools.RiskExecute, nil, "git pull", ""},
+		{"write to rules file", tools.RiskWrite, []string{RulesFile}, "", ".omnitrix/**"},
+		{"write to project config", tools.RiskWrite, []string{".omnitrix.yaml"}, "", ".omnitrix.yaml"},
+		{"read of rules file", tools.RiskRead, []string{RulesFile}, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := Request{Risk: tt.risk, Paths: tt.paths, Args: map[string]interface{}{}}
+			if tt.cmd != "" {
+				req.Args[commandArg] = tt.cmd
+			}
+			rule, ok := guard(rules, req, c.relative)
+			if tt.want == "" {
+				if ok {
+					t.Fatalf("guard broke %q, want no rule", rule)
+				}
+				return
+			}
+			if !ok {
+				t.Fatalf("guard broke no rule, want %q", tt.want)
+			}
+			if rule.Pattern != tt.want {
+				t.Errorf("guard broke %q, want pattern %q", rule, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,181 @@
+package plugin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/omnitrix-sh/core.sh/internal/tools"
+	"github.com/omnitrix-sh/core.sh/pkg/models"
+)
+
+var toolName = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// Set is the plugins started from a directory. A nil Set has no plugins.
+type Set struct {
+	plugins   []*Plugin
+	providers map[string]*Provider
+}
+
+// Load starts the executables in dir, except those named in disabled, and
+// checks what they offer. A missing dir has no plugins. A plugin that
+// fails to start fails loading, so a broken plugin is noticed rather than
+// its tools quietly missing.
+func Load(ctx context.Context, dir string, disabled []string) (*Set, error) {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return &Set{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read plugins directory: %w", err)
+	}
+	skip := make(map[string]bool, len(disabled))
+	for _, name := range disabled {
+		skip[name] = true
+	}
+
+	set := &Set{providers: make(map[string]*Provider)}
+	builtins := make(map[string]bool)
+	for _, name := range tools.Builtins() {
+		builtins[name] = true
+	}
+	offered := make(map[string]string) // tool name -> plugin
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	for _, entry := range entries {
+		name := entry.Name()
+		if strings.HasPrefix(name, ".") || skip[name] {
+			continue
+		}
+		path := filepath.Join(dir, name)
+		info, err := os.Stat(path) // follows links
+		if err != nil || !info.Mode().IsRegular() || info.Mode().Perm()&0o111 == 0 {
+			continue
+		}
+
+		p, err := Start(ctx, path)
+		if err != nil {
+			set.Close()
+			return nil, fmt.Errorf("plugin %s: %w (add it to plugins.disabled to skip it)", name, err)
+		}
+		if skip[p.Manifest.Name] {
+			p.Close()
+			continue
+		}
+		set.plugins = append(set.plugins, p)
+
+		for _, spec := range p.Manifest.Tools {
+			err := checkTool(spec, builtins)
+			if other, ok := offered[spec.Name]; ok && err == nil {
+				err = fmt.Errorf("tool %q is offered by plugin %s too", spec.Name, other)
+			}
+			if err != nil {
+				set.Close()
+				return nil, fmt.Errorf("plugin %s: %w", name, err)
+			}
+			offered[spec.Name] = name
+		}
+		for _, provider := range p.Manifest.Providers {
+			if _, ok := set.providers[provider]; ok {
+				set.Close()
+				return nil, fmt.Errorf("plugin %s: provider %q is served by another plugin too", name, provider)
+			}
+			set.providers[provider] = &Provider{plugin: p, name: provider}
+		}
+	}
+	return set, nil
+}
+
+func checkTool(spec ToolSpec, builtins map[string]bool) error {
+	if !toolName.MatchString(spec.Name) {
+		return fmt.Errorf("tool %q: names may only contain letters, digits, _ and -", spec.Name)
+	}
+	if builtins[spec.Name] {
+		return fmt.Errorf("tool %q: there is a built-in tool of that name", spec.Name)
+	}
+	switch tools.Risk(spec.Risk) {
+	case "", tools.RiskRead, tools.RiskWrite, tools.RiskExecute, tools.RiskNetwork:
+	default:
+		return fmt.Errorf("tool %q: invalid risk %q", spec.Name, spec.Risk)
+	}
+	if spec.Parameters != nil {
+		if typ, _ := spec.Parameters["type"].(string); typ != "object" {
+			return fmt.Errorf("tool %q: parameters must be a schema of type object", spec.Name)
+		}
+	}
+	return nil
+}
+
+// Tools appends the plugins' tools to toolset, except those in disabled.
+// Tools already in it, such as command tools from the config, take
+// precedence over plugins' of the same name.
+func (s *Set) Tools(toolset []tools.Tool, disabled []string) []tools.Tool {
+	if s == nil {
+		return toolset
+	}
+	have := make(map[string]bool, len(toolset)+len(disabled))
+	for _, t := range toolset {
+		have[t.Name()] = true
+	}
+	for _, name := range disabled {
+		have[name] = true
+	}
+	for _, p := range s.plugins {
+		for _, spec := range p.Manifest.Tools {
+			if !have[spec.Name] {
+				toolset = append(toolset, &tool{plugin: p, spec: spec})
+			}
+		}
+	}
+	return toolset
+}
+
+// ToolNames returns the names of the plugins' tools
+func (s *Set) ToolNames() []string {
+	if s == nil {
+		return nil
+	}
+	var names []string
+	for _, p := range s.plugins {
+		for _, spec := range p.Manifest.Tools {
+			names = append(names, spec.Name)
+		}
+	}
+	return names
+}
+
+// Provider returns the provider of that name a plugin serves, or nil
+func (s *Set) Provider(name models.ProviderType) *Provider {
+	if s == nil {
+		return nil
+	}
+	return s.providers[string(name)]
+}
+
+// Providers returns the names of the providers plugins serve, sorted
+func (s *Set) Providers() []string {
+	if s == nil {
+		return nil
+	}
+	names := make([]string, 0, len(s.providers))
+	for name := range s.providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Close stops all plugins
+func (s *Set) Close() error {
+	if s == nil {
+		return nil
+	}
+	for _, p := range s.plugins {
+		p.Close()
+	}
+	return nil
+}
@@ -0,0 +1,372 @@
+// Package plugin runs tools and providers shipped as separate programs.
+// Each executable in the plugins directory is started as a child process
+// and spoken to in JSON-RPC 2.0 over its stdin and stdout, one message per
+// line, so plugins can be written in any language.
+//
+// Omnitrix calls these methods:
+//
+//	initialize   {"protocol_version": 1}, answered with a Manifest: the
+//	             plugin's name and the tools and providers it offers
+//	callTool     {"name", "arguments", "session_id"}, answered with
+//	             {"output": "..."}
+//	chat         {"provider", "request"} with a models.ChatRequest,
+//	             answered with a models.ChatResponse
+//	stream       like chat; the plugin sends the reply as "chunk"
+//	             notifications, {"request_id", "chunk"} with a
+//	             models.StreamChunk, the last one done, then answers null
+//	embed        {"provider", "model", "input"}, answered with
+//	             {"embeddings": [[...], ...]}
+//	listModels   {"provider"}, answered with {"models": [...]}
+//
+// and sends a "cancel" notification, {"request_id"}, when it stops waiting
+// for an answer. Errors are JSON-RPC errors; providers report rate limits
+// with CodeRateLimited and overload with CodeOverloaded, so requests are
+// retried. What a plugin writes to stderr shows in the error when it
+// fails.
+package plugin
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/omnitrix-sh/core.sh/pkg/models"
+)
+
+// ProtocolVersion is the version of the protocol this package speaks
+const ProtocolVersion = 1
+
+const (
+	// startTimeout bounds how long a plugin may take to answer initialize
+	startTimeout = 10 * time.Second
+	// stopTimeout is how long a plugin gets to exit once its stdin closes
+	stopTimeout = 2 * time.Second
+	// maxMessageSize bounds a single message, which may carry images
+	maxMessageSize = 32 << 20
+	// maxStderr is how much of the end of a plugin's stderr is kept
+	maxStderr = 4096
+)
+
+// Error codes plugins answer with, besides the JSON-RPC spec's
+const (
+	CodeRateLimited = -32001
+	CodeOverloaded  = -32002
+)
+
+// Error is a JSON-RPC error a plugin answered with
+type Error struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// Manifest is what a plugin offers, as it answers initialize
+type Manifest struct {
+	Name      string     `json:"name"`
+	Version   string     `json:"version,omitempty"`
+	Tools     []ToolSpec `json:"tools,omitempty"`
+	Providers []string   `json:"providers,omitempty"`
+}
+
+// ToolSpec describes a tool of a plugin as the model is told about it
+type ToolSpec struct {
+	Name        string                 `json:"name"`
+	Description string                 `json:"description"`
+	Parameters  map[string]interface{} `json:"parameters,omitempty"` // JSON schema, an object
+	Risk        string                 `json:"risk,omitempty"`       // "execute" if unset
+}
+
+type message struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      *int64          `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *Error          `json:"error,omitempty"`
+}
+
+type outgoing struct {
+	JSONRPC string      `json:"jsonrpc"`
+	ID      *int64      `json:"id,omitempty"`
+	Method  string      `json:"method"`
+	Params  interface{} `json:"params"`
+}
+
+type requestRef struct {
+	RequestID int64 `json:"request_id"`
+}
+
+type chunkParams struct {
+	RequestID int64              `json:"request_id"`
+	Chunk     models.StreamChunk `json:"chunk"`
+}
+
+// Plugin is a running plugin process
+type Plugin struct {
+	Manifest Manifest
+	path     string
+
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stderr *tail
+
+	writeMu sync.Mutex
+	enc     *json.Encoder
+
+	mu      sync.Mutex
+	nextID  int64
+	pending map[int64]chan message // request ID -> answer
+	streams map[int64]*stream      // request ID -> chunks of a stream
+	err     error                  // why the plugin stopped
+	done    chan struct{}          // closed once it stopped
+}
+
+// stream queues the chunks of a stream request. The queue is unbounded so
+// a slow reader never holds up the answers to other requests.
+type stream struct {
+	mu     sync.Mutex
+	queued []models.StreamChunk
+	ready  chan struct{} // signalled when chunks are queued
+}
+
+func (s *stream) push(chunk models.StreamChunk) {
+	s.mu.Lock()
+	s.queued = append(s.queued, chunk)
+	s.mu.Unlock()
+	select {
+	case s.ready <- struct{}{}:
+	default:
+	}
+}
+
+// take returns the chunks queued so far and empties the queue
+func (s *stream) take() []models.StreamChunk {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	chunks := s.queued
+	s.queued = nil
+	return chunks
+}
+
+// Start starts the plugin at path and asks it what it offers
+func Start(ctx context.Context, path string) (*Plugin, error) {
+	cmd := exec.Command(path)
+	cmd.Dir = filepath.Dir(path)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	p := &Plugin{
+		path:    path,
+		cmd:     cmd,
+		stdin:   stdin,
+		stderr:  &tail{},
+		enc:     json.NewEncoder(stdin),
+		pending: make(map[int64]chan message),
+		streams: make(map[int64]*stream),
+		done:    make(chan struct{}),
+	}
+	cmd.Stderr = p.stderr
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start: %w", err)
+	}
+	go p.read(stdout)
+
+	ctx, cancel := context.WithTimeout(ctx, startTimeout)
+	defer cancel()
+	var manifest Manifest
+	if err := p.call(ctx, "initialize", map[string]int{"protocol_version": ProtocolVersion}, &manifest); err != nil {
+		p.Close()
+		return nil, fmt.Errorf("failed to initialize: %w", err)
+	}
+	if manifest.Name == "" {
+		manifest.Name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+	p.Manifest = manifest
+	return p, nil
+}
+
+// Close stops the plugin, giving it a moment to exit on its own after its
+// stdin is closed
+func (p *Plugin) Close() error {
+	p.stdin.Close()
+	select {
+	case <-p.done:
+	case <-time.After(stopTimeout):
+		p.cmd.Process.Kill()
+		<-p.done
+	}
+	return nil
+}
+
+// read dispatches the plugin's answers and notifications until its
+// stdout ends
+func (p *Plugin) read(stdout io.Reader) {
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(make([]byte, 64*1024), maxMessageSize)
+	for scanner.Scan() {
+		var msg message
+		if err := json.Unmarshal(scanner.Bytes(), &msg); err != nil {
+			continue // not ours, such as a stray print
+		}
+		switch {
+		case msg.Method == "chunk":
+			var params chunkParams
+			if json.Unmarshal(msg.Params, &params) == nil {
+				p.deliver(params)
+			}
+		case msg.Method == "" && msg.ID != nil:
+			p.mu.Lock()
+			answer, ok := p.pending[*msg.ID]
+			delete(p.pending, *msg.ID)
+			p.mu.Unlock()
+			if ok {
+				answer <- msg
+			}
+		}
+	}
+
+	err := scanner.Err()
+	waitErr := p.cmd.Wait()
+	if err == nil {
+		err = waitErr
+	}
+	if err == nil {
+		err = errors.New("exited")
+	}
+	if text := p.stderr.String(); text != "" {
+		err = fmt.Errorf("%w: %s", err, text)
+	}
+	p.mu.Lock()
+	p.err = fmt.Errorf("plugin %s stopped: %w", filepath.Base(p.path), err)
+	p.mu.Unlock()
+	close(p.done)
+}
+
+// deliver passes a chunk on to the stream it belongs to
+func (p *Plugin) deliver(params chunkParams) {
+	p.mu.Lock()
+	s, ok := p.streams[params.RequestID]
+	p.mu.Unlock()
+	if ok {
+		s.push(params.Chunk)
+	}
+}
+
+// call sends a request and decodes the answer into result
+func (p *Plugin) call(ctx context.Context, method string, params, result interface{}) error {
+	return p.callID(ctx, p.newID(), method, params, result)
+}
+
+func (p *Plugin) newID() int64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.nextID++
+	return p.nextID
+}
+
+func (p *Plugin) callID(ctx context.Context, id int64, method string, params, result interface{}) error {
+	answer := make(chan message, 1)
+	p.mu.Lock()
+	if p.err != nil {
+		p.mu.Unlock()
+		return p.err
+	}
+	p.pending[id] = answer
+	p.mu.Unlock()
+	defer func() {
+		p.mu.Lock()
+		delete(p.pending, id)
+		p.mu.Unlock()
+	}()
+
+	if err := p.send(outgoing{JSONRPC: "2.0", ID: &id, Method: method, Params: params}); err != nil {
+		return err
+	}
+	select {
+	case msg := <-answer:
+		if msg.Error != nil {
+			return msg.Error
+		}
+		if result == nil || len(msg.Result) == 0 {
+			return nil
+		}
+		if err := json.Unmarshal(msg.Result, result); err != nil {
+			return fmt.Errorf("invalid answer to %s: %w", method, err)
+		}
+		return nil
+	case <-ctx.Done():
+		p.send(outgoing{JSONRPC: "2.0", Method: "cancel", Params: requestRef{RequestID: id}})
+		return ctx.Err()
+	case <-p.done:
+		return p.err
+	}
+}
+
+func (p *Plugin) send(msg outgoing) error {
+	p.writeMu.Lock()
+	defer p.writeMu.Unlock()
+	if err := p.enc.Encode(msg); err != nil {
+		select {
+		case <-p.done:
+			return p.err
+		default:
+		}
+		return fmt.Errorf("failed to write to plugin: %w", err)
+	}
+	return nil
+}
+
+// openStream registers a stream request before it is sent, so no chunk is
+// missed
+func (p *Plugin) openStream() (int64, *stream) {
+	id := p.newID()
+	s := &stream{ready: make(chan struct{}, 1)}
+	p.mu.Lock()
+	p.streams[id] = s
+	p.mu.Unlock()
+	return id, s
+}
+
+func (p *Plugin) closeStream(id int64) {
+	p.mu.Lock()
+	delete(p.streams, id)
+	p.mu.Unlock()
+}
+
+// tail keeps the end of what is written to it
+type tail struct {
+	mu  sync.Mutex
+	buf []byte
+}
+
+func (t *tail) Write(data []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.buf = append(t.buf, data...)
+	if len(t.buf) > maxStderr {
+		t.buf = append([]byte(nil), t.buf[len(t.buf)-maxStderr:]...)
+	}
+	return len(data), nil
+}
+
+func (t *tail) String() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return strings.TrimSpace(string(t.buf))
+}
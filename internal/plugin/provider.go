@@ -0,0 +1,148 @@
+package plugin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/omnitrix-sh/core.sh/pkg/models"
+)
+
+// Provider is a model provider a plugin serves
+type Provider struct {
+	plugin *Plugin
+	name   string
+}
+
+type chatParams struct {
+	Provider string             `json:"provider"`
+	Request  models.ChatRequest `json:"request"`
+}
+
+type embedParams struct {
+	Provider string   `json:"provider"`
+	Model    string   `json:"model"`
+	Input    []string `json:"input"`
+}
+
+type embedResult struct {
+	Embeddings [][]float32 `json:"embeddings"`
+}
+
+type listModelsParams struct {
+	Provider string `json:"provider"`
+}
+
+type listModelsResult struct {
+	Models []string `json:"models"`
+}
+
+func (p *Provider) Chat(ctx context.Context, req models.ChatRequest) (*models.ChatResponse, error) {
+	var response models.ChatResponse
+	if err := p.plugin.call(ctx, "chat", chatParams{Provider: p.name, Request: req}, &response); err != nil {
+		return nil, providerError(err)
+	}
+	return &response, nil
+}
+
+// Stream sends the request and returns the reply as the plugin streams
+// it. An error the plugin answers with before the first chunk is returned,
+// later ones end the stream with an error chunk like other providers.
+func (p *Provider) Stream(ctx context.Context, req models.ChatRequest) (<-chan models.StreamChunk, error) {
+	req.Stream = true
+	id, s := p.plugin.openStream()
+	finished := make(chan error, 1)
+	go func() {
+		finished <- p.plugin.callID(ctx, id, "stream", chatParams{Provider: p.name, Request: req}, nil)
+	}()
+
+	// Chunks are queued before the answer is read, so an answer without any
+	// is an error before the first chunk
+	select {
+	case <-s.ready:
+	case err := <-finished:
+		s.mu.Lock()
+		empty := len(s.queued) == 0
+		s.mu.Unlock()
+		if err != nil && empty {
+			p.plugin.closeStream(id)
+			return nil, providerError(err)
+		}
+		finished <- err
+	}
+
+	chunks := make(chan models.StreamChunk)
+	go func() {
+		defer close(chunks)
+		defer p.plugin.closeStream(id)
+		// send forwards chunks, telling whether to go on
+		send := func(queued ...models.StreamChunk) bool {
+			for _, chunk := range queued {
+				select {
+				case chunks <- chunk:
+				case <-ctx.Done():
+					return false
+				}
+				if chunk.Done {
+					return false
+				}
+			}
+			return true
+		}
+		for {
+			if !send(s.take()...) {
+				return
+			}
+			select {
+			case <-s.ready:
+			case err := <-finished:
+				if !send(s.take()...) {
+					return
+				}
+				last := models.StreamChunk{Done: true, FinishReason: "stop"}
+				if err != nil {
+					last = models.StreamChunk{Delta: fmt.Sprintf("[Stream error: %v]", err), Done: true}
+				}
+				send(last)
+				return
+			}
+		}
+	}()
+	return chunks, nil
+}
+
+func (p *Provider) Embed(ctx context.Context, model string, input []string) ([][]float32, error) {
+	var result embedResult
+	if err := p.plugin.call(ctx, "embed", embedParams{Provider: p.name, Model: model, Input: input}, &result); err != nil {
+		return nil, providerError(err)
+	}
+	if len(result.Embeddings) != len(input) {
+		return nil, fmt.Errorf("plugin returned %d embeddings for %d inputs", len(result.Embeddings), len(input))
+	}
+	return result.Embeddings, nil
+}
+
+// ListModels asks the plugin for the provider's models
+func (p *Provider) ListModels(ctx context.Context) ([]string, error) {
+	var result listModelsResult
+	if err := p.plugin.call(ctx, "listModels", listModelsParams{Provider: p.name}, &result); err != nil {
+		return nil, providerError(err)
+	}
+	return result.Models, nil
+}
+
+// providerError maps the error codes of rate limits and overload to the
+// errors the agent retries on
+func providerError(err error) error {
+	var rpcErr *Error
+	if !errors.As(err, &rpcErr) {
+		return err
+	}
+	switch rpcErr.Code {
+	case CodeRateLimited:
+		return fmt.Errorf("%w: %s", models.ErrRateLimited, rpcErr.Message)
+	case CodeOverloaded:
+		return fmt.Errorf("%w: %s", models.ErrOverloaded, rpcErr.Message)
+	}
+	return err
+}
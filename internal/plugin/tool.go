@@ -0,0 +1,57 @@
+package plugin
+
+import (
+	"context"
+
+	"github.com/omnitrix-sh/core.sh/internal/tools"
+)
+
+// tool is a tool a plugin offers
+type tool struct {
+	plugin *Plugin
+	spec   ToolSpec
+}
+
+type callToolParams struct {
+	Name      string                 `json:"name"`
+	Arguments map[string]interface{} `json:"arguments"`
+	SessionID string                 `json:"session_id,omitempty"`
+}
+
+type callToolResult struct {
+	Output string `json:"output"`
+}
+
+func (t *tool) Name() string {
+	return t.spec.Name
+}
+
+func (t *tool) Description() string {
+	return t.spec.Description
+}
+
+func (t *tool) Parameters() map[string]interface{} {
+	if t.spec.Parameters == nil {
+		return map[string]interface{}{"type": "object", "properties": map[string]interface{}{}}
+	}
+	return t.spec.Parameters
+}
+
+func (t *tool) Risk() tools.Risk {
+	if t.spec.Risk == "" {
+		return tools.RiskExecute
+	}
+	return tools.Risk(t.spec.Risk)
+}
+
+func (t *tool) Execute(ctx context.Context, args map[string]interface{}) (string, error) {
+	if args == nil {
+		args = map[string]interface{}{}
+	}
+	var result callToolResult
+	params := callToolParams{Name: t.spec.Name, Arguments: args, SessionID: tools.SessionIDFromContext(ctx)}
+	if err := t.plugin.call(ctx, "callTool", params, &result); err != nil {
+		return "", err
+	}
+	return result.Output, nil
+}
@@ -0,0 +1,263 @@
+package postprocess
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/omnitrix-sh/core.sh/pkg/models"
+)
+
+// Processor rewrites final assistant output before it is persisted and
+// returned. A processor that cannot fix the output itself returns a
+// *RetryError asking the model to try again.
+type Processor interface {
+	Name() string
+	Process(content string) (string, error)
+}
+
+// RetryError reports output the model should regenerate, with the
+// instruction to send it
+type RetryError struct {
+	Processor   string
+	Instruction string
+}
+
+func (e *RetryError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Processor, e.Instruction)
+}
+
+// Pipeline runs processors in order
+type Pipeline struct {
+	processors []Processor
+}
+
+// New creates a pipeline of processors
+func New(processors ...Processor) *Pipeline {
+	return &Pipeline{processors: processors}
+}
+
+// FromConfig builds the pipeline described by the config
+func FromConfig(cfg models.PostProcessConfig) (*Pipeline, error) {
+	var processors []Processor
+	if !cfg.KeepThinking {
+		processors = append(processors, StripThinking{})
+	}
+	if cfg.NormalizeFences {
+		processors = append(processors, NormalizeFences{})
+	}
+	for _, rule := range cfg.Rules {
+		processor, err := NewRegexRule(rule.Pattern, rule.Replacement)
+		if err != nil {
+			return nil, err
+		}
+		processors = append(processors, processor)
+	}
+	if cfg.Language != "" {
+		processor, err := NewEnforceLanguage(cfg.Language)
+		if err != nil {
+			return nil, err
+		}
+		processors = append(processors, processor)
+	}
+	return New(processors...), nil
+}
+
+// WithLanguage returns a copy of the pipeline enforcing code instead of any
+// language it was configured with. An empty code returns the pipeline as is.
+func (p *Pipeline) WithLanguage(code string) (*Pipeline, error) {
+	if code == "" {
+		return p, nil
+	}
+	enforce, err := NewEnforceLanguage(code)
+	if err != nil {
+		return nil, err
+	}
+
+	var processors []Processor
+	if p != nil {
+		for _, processor := range p.processors {
+			if _, ok := processor.(*EnforceLanguage); !ok {
+				processors = append(processors, processor)
+			}
+		}
+	}
+	return New(append(processors, enforce)...), nil
+}
+
+// Run passes content through every processor. On a *RetryError the content
+// processed so far is returned with it, so callers can fall back to it.
+func (p *Pipeline) Run(content string) (string, error) {
+	if p == nil {
+		return content, nil
+	}
+
+	var retry *RetryError
+	for _, processor := range p.processors {
+		processed, err := processor.Process(content)
+		if errors.As(err, &retry) {
+			continue
+		}
+		if err != nil {
+			return content, fmt.Errorf("%s: %w", processor.Name(), err)
+		}
+		content = processed
+	}
+
+	if retry != nil {
+		return content, retry
+	}
+	return content, nil
+}
+
+var (
+	thinkBlock = regexp.MustCompile(`(?is)<(?:think|thinking|reasoning)>.*?</(?:think|thinking|reasoning)>`)
+	thinkTail  = regexp.MustCompile(`(?is)^.*?</(?:think|thinking|reasoning)>`)
+	thinkTag   = regexp.MustCompile(`(?i)</?(?:think|thinking|reasoning)>`)
+)
+
+// StripThinking removes chain-of-thought that models emit inline in <think>
+// tags, along with stray tags left behind when a server splits reasoning off
+type StripThinking struct{}
+
+func (StripThinking) Name() string { return "strip_thinking" }
+
+func (StripThinking) Process(content string) (string, error) {
+	content = thinkBlock.ReplaceAllString(content, "")
+	// A closing tag without an opening one ends reasoning whose start was cut
+	content = thinkTail.ReplaceAllString(content, "")
+	content = thinkTag.ReplaceAllString(content, "")
+	return strings.TrimSpace(content), nil
+}
+
+var fenceLine = regexp.MustCompile("^(\\s*)(`{3,}|~{3,})\\s*([\\w+#.-]*)\\s*$")
+
+// NormalizeFences rewrites code fences to plain ``` fences with the language
+// tag directly after them, and closes a fence left open at the end
+type NormalizeFences struct{}
+
+func (NormalizeFences) Name() string { return "normalize_fences" }
+
+func (NormalizeFences) Process(content string) (string, error) {
+	lines := strings.Split(content, "\n")
+	open := false
+	for i, line := range lines {
+		m := fenceLine.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		if open {
+			lines[i] = m[1] + "```"
+		} else {
+			lines[i] = m[1] + "```" + strings.ToLower(m[3])
+		}
+		open = !open
+	}
+	if open {
+		lines = append(lines, "```")
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+// RegexRule replaces matches of a pattern, e.g. to strip boilerplate
+// sign-offs a model keeps adding
+type RegexRule struct {
+	pattern     *regexp.Regexp
+	replacement string
+}
+
+// NewRegexRule creates a rule. The replacement may refer to submatches as $1.
+func NewRegexRule(pattern, replacement string) (*RegexRule, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid post-processing pattern %q: %w", pattern, err)
+	}
+	return &RegexRule{pattern: re, replacement: replacement}, nil
+}
+
+func (r *RegexRule) Name() string { return "regex:" + r.pattern.String() }
+
+func (r *RegexRule) Process(content string) (string, error) {
+	return r.pattern.ReplaceAllString(content, r.replacement), nil
+}
+
+// languageScripts maps language codes to the script their text is written
+// in. Detection works on scripts, so languages sharing one, like English and
+// German, cannot be told apart.
+var languageScripts = map[string]*unicode.RangeTable{
+	"en": unicode.Latin, "de": unicode.Latin, "fr": unicode.Latin, "es": unicode.Latin,
+	"it": unicode.Latin, "pt": unicode.Latin, "nl": unicode.Latin, "pl": unicode.Latin,
+	"tr": unicode.Latin, "vi": unicode.Latin, "id": unicode.Latin,
+	"ru": unicode.Cyrillic, "uk": unicode.Cyrillic, "bg": unicode.Cyrillic,
+	"el": unicode.Greek, "ar": unicode.Arabic, "fa": unicode.Arabic, "he": unicode.Hebrew,
+	"hi": unicode.Devanagari, "th": unicode.Thai, "ko": unicode.Hangul, "zh": unicode.Han,
+}
+
+var languageNames = map[string]string{
+	"en": "English", "de": "German", "fr": "French", "es": "Spanish", "it": "Italian",
+	"pt": "Portuguese", "nl": "Dutch", "pl": "Polish", "tr": "Turkish", "vi": "Vietnamese",
+	"id": "Indonesian", "ru": "Russian", "uk": "Ukrainian", "bg": "Bulgarian", "el": "Greek",
+	"ar": "Arabic", "fa": "Persian", "he": "Hebrew", "hi": "Hindi", "th": "Thai",
+	"ko": "Korean", "zh": "Chinese", "ja": "Japanese",
+}
+
+// LanguageName returns the English name of a supported language code
+func LanguageName(code string) (string, bool) {
+	name, ok := languageNames[strings.ToLower(code)]
+	return name, ok
+}
+
+// minLetters is how many letters of prose a response needs before its
+// language is judged
+const minLetters = 20
+
+var codeBlock = regexp.MustCompile("(?s)```.*?```|`[^`\n]*`")
+
+// EnforceLanguage asks the model to answer again when most of the prose in
+// its response, outside code, is not in the expected language's script
+type EnforceLanguage struct {
+	code string
+}
+
+// NewEnforceLanguage creates the processor for a language code such as "en"
+func NewEnforceLanguage(code string) (*EnforceLanguage, error) {
+	code = strings.ToLower(code)
+	if _, ok := languageNames[code]; !ok {
+		return nil, fmt.Errorf("unsupported response language: %s", code)
+	}
+	return &EnforceLanguage{code: code}, nil
+}
+
+func (e *EnforceLanguage) Name() string { return "language" }
+
+func (e *EnforceLanguage) Process(content string) (string, error) {
+	prose := codeBlock.ReplaceAllString(content, "")
+
+	letters, matching := 0, 0
+	for _, r := range prose {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		letters++
+		if e.inScript(r) {
+			matching++
+		}
+	}
+
+	if letters < minLetters || matching*2 >= letters {
+		return content, nil
+	}
+	return content, &RetryError{
+		Processor:   e.Name(),
+		Instruction: fmt.Sprintf("Please write your previous answer again in %s.", languageNames[e.code]),
+	}
+}
+
+func (e *EnforceLanguage) inScript(r rune) bool {
+	if e.code == "ja" {
+		return unicode.In(r, unicode.Hiragana, unicode.Katakana, unicode.Han)
+	}
+	return unicode.Is(languageScripts[e.code], r)
+}
@@ -0,0 +1,86 @@
+package pricing
+
+import (
+	"strings"
+
+	"github.com/omnitrix-sh/core.sh/pkg/models"
+)
+
+// builtinPrices are list prices in USD per million tokens. Local models are
+// free and simply have no entry.
+var builtinPrices = map[string]models.ModelPrice{
+	"gpt-4o":            {Input: 2.50, Output: 10.00},
+	"gpt-4o-mini":       {Input: 0.15, Output: 0.60},
+	"gpt-4.1":           {Input: 2.00, Output: 8.00},
+	"gpt-4.1-mini":      {Input: 0.40, Output: 1.60},
+	"gpt-4.1-nano":      {Input: 0.10, Output: 0.40},
+	"gpt-4-turbo":       {Input: 10.00, Output: 30.00},
+	"gpt-3.5-turbo":     {Input: 0.50, Output: 1.50},
+	"o1":                {Input: 15.00, Output: 60.00},
+	"o1-mini":           {Input: 1.10, Output: 4.40},
+	"o3":                {Input: 2.00, Output: 8.00},
+	"o3-mini":           {Input: 1.10, Output: 4.40},
+	"o4-mini":           {Input: 1.10, Output: 4.40},
+	"claude-3-5-haiku":  {Input: 0.80, Output: 4.00},
+	"claude-3-5-sonnet": {Input: 3.00, Output: 15.00},
+	"claude-3-7-sonnet": {Input: 3.00, Output: 15.00},
+	"claude-3-opus":     {Input: 15.00, Output: 75.00},
+	"claude-sonnet-4":   {Input: 3.00, Output: 15.00},
+	"claude-opus-4":     {Input: 15.00, Output: 75.00},
+	"deepseek-chat":     {Input: 0.27, Output: 1.10},
+	"deepseek-reasoner": {Input: 0.55, Output: 2.19},
+}
+
+// Catalog looks up model prices
+type Catalog struct {
+	prices map[string]models.ModelPrice
+}
+
+// NewCatalog creates a catalog of the built-in prices with overrides, usually
+// Config.Pricing, taking precedence
+func NewCatalog(overrides map[string]models.ModelPrice) *Catalog {
+	prices := make(map[string]models.ModelPrice, len(builtinPrices)+len(overrides))
+	for name, price := range builtinPrices {
+		prices[name] = price
+	}
+	for name, price := range overrides {
+		prices[strings.ToLower(name)] = price
+	}
+	return &Catalog{prices: prices}
+}
+
+// Lookup returns the price of a model. Dated snapshots such as
+// gpt-4o-mini-2024-07-18 match their base name, and a "provider/" prefix is
+// ignored.
+func (c *Catalog) Lookup(model string) (models.ModelPrice, bool) {
+	name := strings.ToLower(model)
+	if i := strings.LastIndex(name, "/"); i >= 0 {
+		name = name[i+1:]
+	}
+
+	if price, ok := c.prices[name]; ok {
+		return price, true
+	}
+
+	// Longest prefix wins, so gpt-4o-mini-x is not priced as gpt-4o
+	best := ""
+	for candidate := range c.prices {
+		if len(candidate) > len(best) && strings.HasPrefix(name, candidate+"-") {
+			best = candidate
+		}
+	}
+	if best == "" {
+		return models.ModelPrice{}, false
+	}
+	return c.prices[best], true
+}
+
+// Cost returns the cost in USD of a request's token usage, or 0 for models
+// without a known price
+func (c *Catalog) Cost(model string, usage models.TokenUsage) float64 {
+	price, ok := c.Lookup(model)
+	if !ok {
+		return 0
+	}
+	return (float64(usage.PromptTokens)*price.Input + float64(usage.CompletionTokens)*price.Output) / 1_000_000
+}
@@ -0,0 +1,141 @@
+package prompt
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/omnitrix-sh/core.sh/pkg/models"
+)
+
+// maxContextFileSize caps how much of a single context file is included
+const maxContextFileSize = 32 * 1024
+
+// DefaultSystemPrompt is used when the config does not set one
+const DefaultSystemPrompt = `You are Omnitrix, a coding assistant running in the user's terminal.
+
+Help the user with software engineering tasks in their project. Use the available tools to read and change files rather than guessing at their contents. Keep answers concise, make the smallest change that does the job, and follow the conventions of the surrounding code.`
+
+// Builder assembles the system prompt sent as the first message of every
+// request: the configured prompt and fragments, information about the
+// environment, the repo map and the project's context files
+type Builder struct {
+	workDir      string
+	systemPrompt string
+	fragments    []string
+	contextPaths []string
+	repoMap      *repoMap // nil unless enabled, shared by copies
+}
+
+// NewBuilder creates a builder. An empty systemPrompt uses
+// DefaultSystemPrompt; fragments are appended to it. contextPaths are
+// relative to workDir unless absolute.
+func NewBuilder(workDir, systemPrompt string, fragments, contextPaths []string) *Builder {
+	if systemPrompt == "" {
+		systemPrompt = DefaultSystemPrompt
+	}
+	return &Builder{
+		workDir:      workDir,
+		systemPrompt: systemPrompt,
+		fragments:    fragments,
+		contextPaths: contextPaths,
+	}
+}
+
+// FromConfig creates a builder from the loaded configuration
+func FromConfig(cfg *models.Config) *Builder {
+	return NewBuilder(cfg.WorkDir, cfg.SystemPrompt, cfg.PromptFragments, cfg.ContextPaths).
+		WithRepoMap(cfg.RepoMap, cfg.DataDir)
+}
+
+// WithPrompt returns a copy of the builder with another system prompt and
+// fragments. An empty systemPrompt keeps the current one, and nil
+// fragments keep the current fragments.
+func (b *Builder) WithPrompt(systemPrompt string, fragments []string) *Builder {
+	c := *b
+	if systemPrompt != "" {
+		c.systemPrompt = systemPrompt
+	}
+	if fragments != nil {
+		c.fragments = fragments
+	}
+	return &c
+}
+
+// ContextFile is a project file included in the system prompt
+type ContextFile struct {
+	Path      string
+	Content   string
+	Truncated bool
+}
+
+// Build returns the system prompt. Context files are read on every call so
+// edits to them apply to the next request.
+func (b *Builder) Build() string {
+	var sb strings.Builder
+	sb.WriteString(strings.TrimSpace(b.systemPrompt))
+	for _, fragment := range b.fragments {
+		if fragment = strings.TrimSpace(fragment); fragment != "" {
+			sb.WriteString("\n\n")
+			sb.WriteString(fragment)
+		}
+	}
+	sb.WriteString("\n\n")
+	sb.WriteString(b.environment())
+
+	if repoMap := b.RepoMap(); repoMap != "" {
+		sb.WriteString("\n\n<repo_map>\n")
+		sb.WriteString(repoMap)
+		sb.WriteString("\n</repo_map>")
+	}
+
+	for _, file := range b.ContextFiles() {
+		sb.WriteString(fmt.Sprintf("\n\n<context_file path=%q>\n", file.Path))
+		sb.WriteString(file.Content)
+		if file.Truncated {
+			sb.WriteString("\n[truncated]")
+		}
+		sb.WriteString("\n</context_file>")
+	}
+
+	return sb.String()
+}
+
+// environment describes where the assistant is running
+func (b *Builder) environment() string {
+	return fmt.Sprintf("<environment>\nOS: %s/%s\nWorking directory: %s\nDate: %s\n</environment>",
+		runtime.GOOS, runtime.GOARCH, b.workDir, time.Now().Format("2006-01-02"))
+}
+
+// ContextFiles reads the configured context files, skipping those that do
+// not exist or are empty
+func (b *Builder) ContextFiles() []ContextFile {
+	var files []ContextFile
+	for _, path := range b.contextPaths {
+		full := path
+		if !filepath.IsAbs(full) {
+			full = filepath.Join(b.workDir, path)
+		}
+
+		data, err := os.ReadFile(full)
+		if err != nil {
+			continue
+		}
+
+		content := strings.TrimSpace(string(data))
+		if content == "" {
+			continue
+		}
+
+		file := ContextFile{Path: path, Content: content}
+		if len(content) > maxContextFileSize {
+			file.Content = content[:maxContextFileSize]
+			file.Truncated = true
+		}
+		files = append(files, file)
+	}
+	return files
+}
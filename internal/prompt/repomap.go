@@ -0,0 +1,88 @@
+package prompt
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/omnitrix-sh/core.sh/internal/symbols"
+	"github.com/omnitrix-sh/core.sh/pkg/models"
+)
+
+// defaultRepoMapTokens is the size of the repo map unless the config says
+// otherwise
+const defaultRepoMapTokens = 1024
+
+// repoMapRefresh is how long a repo map is reused before the workspace is
+// checked for changes, so the tool loop's requests don't each walk it
+const repoMapRefresh = 30 * time.Second
+
+// repoMap builds the outline of the workspace from its symbol index, the
+// one the find_symbol tool keeps
+type repoMap struct {
+	mu       sync.Mutex
+	dataDir  string
+	workDir  string
+	maxBytes int
+	index    *symbols.Index
+	content  string
+	built    time.Time
+}
+
+// WithRepoMap returns a copy of the builder that adds an outline of the
+// workspace's source files and exported symbols to the system prompt, if
+// cfg enables it. The symbol index is kept in dataDir.
+func (b *Builder) WithRepoMap(cfg models.RepoMapConfig, dataDir string) *Builder {
+	if !cfg.Enabled {
+		return b
+	}
+	maxTokens := cfg.MaxTokens
+	if maxTokens <= 0 {
+		maxTokens = defaultRepoMapTokens
+	}
+	c := *b
+	c.repoMap = &repoMap{
+		dataDir: dataDir,
+		workDir: b.workDir,
+		// Paths and identifiers average about four bytes per token
+		maxBytes: maxTokens * 4,
+	}
+	return &c
+}
+
+// RepoMap returns the outline of the workspace added to the system prompt,
+// or "" if the repo map is disabled or the workspace has no source files
+func (b *Builder) RepoMap() string {
+	if b.repoMap == nil {
+		return ""
+	}
+	return b.repoMap.get()
+}
+
+// get returns the repo map, rebuilding it if it is older than
+// repoMapRefresh. If the workspace can't be indexed the last map is kept.
+func (m *repoMap) get() string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.built.IsZero() && time.Since(m.built) < repoMapRefresh {
+		return m.content
+	}
+	m.built = time.Now()
+
+	if m.index == nil {
+		index, err := symbols.Open(m.dataDir, m.workDir)
+		if err != nil {
+			return m.content
+		}
+		m.index = index
+	}
+	if _, err := m.index.Update(context.Background()); err != nil {
+		return m.content
+	}
+	// The index is a cache, failing to persist it only costs a rebuild
+	m.index.Save()
+
+	m.content = m.index.Map(m.maxBytes)
+	return m.content
+}
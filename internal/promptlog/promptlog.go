@@ -0,0 +1,269 @@
+package promptlog
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/omnitrix-sh/core.sh/internal/redact"
+	"github.com/omnitrix-sh/core.sh/pkg/models"
+)
+
+// Mode is how much of a prompt is kept in the log
+type Mode string
+
+const (
+	ModeFull      Mode = "full"
+	ModeRedacted  Mode = "redacted"
+	ModePathsOnly Mode = "paths_only"
+)
+
+// maxArgLength is the longest tool call argument kept in redacted mode,
+// longer values are usually file contents
+const maxArgLength = 200
+
+// Logger appends prompts sent to providers to daily JSONL files
+type Logger struct {
+	mu       sync.Mutex
+	dir      string
+	mode     Mode
+	redactor *redact.Redactor
+}
+
+// Entry is one logged request
+type Entry struct {
+	Time      time.Time `json:"time"`
+	SessionID string    `json:"session_id,omitempty"`
+	Provider  string    `json:"provider"`
+	Model     string    `json:"model"`
+	Mode      Mode      `json:"mode"`
+	Chars     int       `json:"chars"`
+	Tools     []string  `json:"tools,omitempty"`
+	Messages  []Message `json:"messages"`
+}
+
+// Message is a logged message. Chars is the size of the original content so
+// context growth stays visible even when the content itself is stripped.
+type Message struct {
+	Role       string     `json:"role"`
+	Chars      int        `json:"chars"`
+	Content    string     `json:"content,omitempty"`
+	ToolCalls  []ToolCall `json:"tool_calls,omitempty"`
+	ToolCallID string     `json:"tool_call_id,omitempty"`
+	Images     int        `json:"images,omitempty"`
+	Paths      []string   `json:"paths,omitempty"`
+}
+
+// ToolCall is a logged tool call
+type ToolCall struct {
+	Name      string                 `json:"name"`
+	Arguments map[string]interface{} `json:"arguments,omitempty"`
+}
+
+// New creates a Logger from config. It returns nil when logging is disabled;
+// a nil Logger ignores every call, so callers need no checks of their own.
+func New(cfg models.PromptLogConfig, dataDir string) (*Logger, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+
+	mode := Mode(cfg.Mode)
+	switch mode {
+	case "":
+		mode = ModeRedacted
+	case ModeFull, ModeRedacted, ModePathsOnly:
+	default:
+		return nil, fmt.Errorf("invalid prompt log mode: %s (use full, redacted or paths_only)", cfg.Mode)
+	}
+
+	dir := cfg.Dir
+	if dir == "" {
+		dir = filepath.Join(dataDir, "prompts")
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create prompt log directory: %w", err)
+	}
+
+	rules, err := redact.WithPatterns(cfg.RedactPatterns)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Logger{
+		dir:      dir,
+		mode:     mode,
+		redactor: redact.New(rules...),
+	}, nil
+}
+
+// Log records a request about to be sent
+func (l *Logger) Log(sessionID string, provider models.ProviderType, req models.ChatRequest) error {
+	if l == nil {
+		return nil
+	}
+
+	entry := Entry{
+		Time:      time.Now(),
+		SessionID: sessionID,
+		Provider:  string(provider),
+		Model:     req.Model,
+		Mode:      l.mode,
+	}
+	for _, tool := range req.Tools {
+		entry.Tools = append(entry.Tools, tool.Function.Name)
+	}
+	for _, msg := range req.Messages {
+		logged := l.convertMessage(msg)
+		entry.Chars += logged.Chars
+		entry.Messages = append(entry.Messages, logged)
+	}
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to encode prompt log entry: %w", err)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	path := filepath.Join(l.dir, entry.Time.Format("2006-01-02")+".jsonl")
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open prompt log: %w", err)
+	}
+	defer f.Close()
+
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write prompt log: %w", err)
+	}
+	return nil
+}
+
+func (l *Logger) convertMessage(msg models.Message) Message {
+	logged := Message{
+		Role:       string(msg.Role),
+		Chars:      len(msg.Content),
+		ToolCallID: msg.ToolCallID,
+	}
+	for _, part := range msg.Parts {
+		if part.Type() == "image" {
+			logged.Images++
+		}
+	}
+
+	switch l.mode {
+	case ModeFull:
+		logged.Content = l.redact(msg.Content)
+	case ModeRedacted:
+		if msg.Role == models.RoleTool {
+			logged.Content = fmt.Sprintf("[tool output stripped, %d bytes]", len(msg.Content))
+		} else {
+			logged.Content = l.redact(stripCodeBlocks(msg.Content))
+		}
+	case ModePathsOnly:
+		logged.Paths = extractPaths(msg.Content)
+	}
+
+	for _, tc := range msg.ToolCalls {
+		call := ToolCall{Name: tc.Function.Name}
+		if l.mode != ModePathsOnly {
+			call.Arguments = l.convertArguments(tc.Function.Arguments)
+		} else {
+			logged.Paths = mergePaths(logged.Paths, argumentPaths(tc.Function.Arguments))
+		}
+		logged.ToolCalls = append(logged.ToolCalls, call)
+	}
+
+	return logged
+}
+
+func (l *Logger) convertArguments(args map[string]interface{}) map[string]interface{} {
+	converted := make(map[string]interface{}, len(args))
+	for key, val := range args {
+		s, ok := val.(string)
+		if !ok {
+			converted[key] = val
+			continue
+		}
+		if l.mode == ModeRedacted && (len(s) > maxArgLength || strings.Contains(s, "\n")) {
+			converted[key] = fmt.Sprintf("[stripped, %d bytes]", len(s))
+			continue
+		}
+		converted[key] = l.redact(s)
+	}
+	return converted
+}
+
+func (l *Logger) redact(text string) string {
+	redacted, _ := l.redactor.Redact(text)
+	return redacted
+}
+
+var codeBlockPattern = regexp.MustCompile("(?s)```[^\\n]*\\n.*?```")
+
+// stripCodeBlocks replaces fenced code blocks with a line count
+func stripCodeBlocks(text string) string {
+	return codeBlockPattern.ReplaceAllStringFunc(text, func(block string) string {
+		return fmt.Sprintf("[code block stripped, %d lines]", strings.Count(block, "\n")-1)
+	})
+}
+
+var (
+	slashPathPattern = regexp.MustCompile(`(?:\.{1,2}/|/)?(?:[\w.-]+/)+[\w.-]+`)
+	fileNamePattern  = regexp.MustCompile(`\b[\w-]+\.(?:go|py|js|jsx|ts|tsx|rs|java|kt|cs|rb|c|h|cpp|hpp|json|yaml|yml|toml|md|sql|sh|html|css)\b`)
+)
+
+// extractPaths returns the file paths mentioned in text
+func extractPaths(text string) []string {
+	var paths []string
+	bases := make(map[string]bool)
+	for _, p := range slashPathPattern.FindAllString(text, -1) {
+		if !strings.Contains(p, "://") {
+			paths = append(paths, p)
+			bases[filepath.Base(p)] = true
+		}
+	}
+	for _, name := range fileNamePattern.FindAllString(text, -1) {
+		if !bases[name] {
+			paths = append(paths, name)
+		}
+	}
+	return mergePaths(nil, paths)
+}
+
+// argumentPaths returns tool call arguments that name files or directories
+func argumentPaths(args map[string]interface{}) []string {
+	var paths []string
+	for key, val := range args {
+		s, ok := val.(string)
+		if !ok || s == "" {
+			continue
+		}
+		if strings.HasSuffix(key, "path") || strings.HasSuffix(key, "dir") || key == "glob" {
+			paths = append(paths, s)
+		}
+	}
+	return paths
+}
+
+// mergePaths adds paths to existing, keeping the result sorted and unique
+func mergePaths(existing, paths []string) []string {
+	seen := make(map[string]bool, len(existing))
+	for _, p := range existing {
+		seen[p] = true
+	}
+	for _, p := range paths {
+		if !seen[p] {
+			seen[p] = true
+			existing = append(existing, p)
+		}
+	}
+	sort.Strings(existing)
+	return existing
+}
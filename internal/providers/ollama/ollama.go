@@ -8,27 +8,48 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"strconv"
 	"strings"
 
+	"github.com/google/uuid"
 	"github.com/omnitrix-sh/core.sh/pkg/models"
 )
 
 type Provider struct {
-	baseURL string
-	client  *http.Client
-	model   string
+	baseURL   string
+	client    *http.Client
+	model     string
+	options   map[string]interface{}
+	keepAlive string
 }
 
 type ollamaMessage struct {
-	Role    string `json:"role"`
-	Content string `json:"content"`
+	Role      string           `json:"role"`
+	Content   string           `json:"content"`
+	Thinking  string           `json:"thinking,omitempty"`
+	ToolCalls []ollamaToolCall `json:"tool_calls,omitempty"`
+	ToolName  string           `json:"tool_name,omitempty"`
+	Images    []string         `json:"images,omitempty"` // base64 encoded
+}
+
+type ollamaToolCall struct {
+	ID       string             `json:"id,omitempty"`
+	Function ollamaFunctionCall `json:"function"`
+}
+
+type ollamaFunctionCall struct {
+	Name      string                 `json:"name"`
+	Arguments map[string]interface{} `json:"arguments"`
 }
 
 type ollamaChatRequest struct {
-	Model    string          `json:"model"`
-	Messages []ollamaMessage `json:"messages"`
-	Stream   bool            `json:"stream"`
-	Tools    []ollamaTool    `json:"tools,omitempty"`
+	Model     string                 `json:"model"`
+	Messages  []ollamaMessage        `json:"messages"`
+	Stream    bool                   `json:"stream"`
+	Tools     []ollamaTool           `json:"tools,omitempty"`
+	Options   map[string]interface{} `json:"options,omitempty"`
+	KeepAlive interface{}            `json:"keep_alive,omitempty"`
+	Think     interface{}            `json:"think,omitempty"` // bool or "low", "medium", "high"
 }
 
 type ollamaTool struct {
@@ -63,6 +84,13 @@ func NewProvider(baseURL, model string) *Provider {
 	}
 }
 
+// SetOptions sets the default model options and keep_alive sent with every
+// request. Sampling parameters and per-request options take precedence.
+func (p *Provider) SetOptions(options map[string]interface{}, keepAlive string) {
+	p.options = options
+	p.keepAlive = keepAlive
+}
+
 func (p *Provider) Chat(ctx context.Context, req models.ChatRequest) (*models.ChatResponse, error) {
 	// Convert to Ollama format
 	ollamaReq := p.convertRequest(req)
@@ -95,7 +123,7 @@ func (p *Provider) Chat(ctx context.Context, req models.ChatRequest) (*models.Ch
 
 	if resp.StatusCode != http.StatusOK {
 		bodyBytes, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("ollama API error (status %d): %s", resp.StatusCode, string(bodyBytes))
+		return nil, models.NewProviderError(models.ProviderOllama, resp.StatusCode, bodyBytes)
 	}
 
 	// Parse response
@@ -104,11 +132,19 @@ func (p *Provider) Chat(ctx context.Context, req models.ChatRequest) (*models.Ch
 		return nil, fmt.Errorf("failed to decode response: %w", err)
 	}
 
+	toolCalls := convertToolCalls(ollamaResp.Message.ToolCalls)
+	finishReason := "stop"
+	if len(toolCalls) > 0 {
+		finishReason = "tool_calls"
+	}
+
 	return &models.ChatResponse{
 		ID:           ollamaResp.CreatedAt,
 		Model:        ollamaResp.Model,
 		Content:      ollamaResp.Message.Content,
-		FinishReason: "stop",
+		Reasoning:    ollamaResp.Message.Thinking,
+		ToolCalls:    toolCalls,
+		FinishReason: finishReason,
 		Usage: models.TokenUsage{
 			PromptTokens:     ollamaResp.PromptEvalCount,
 			CompletionTokens: ollamaResp.EvalCount,
@@ -149,7 +185,7 @@ func (p *Provider) Stream(ctx context.Context, req models.ChatRequest) (<-chan m
 	if resp.StatusCode != http.StatusOK {
 		bodyBytes, _ := io.ReadAll(resp.Body)
 		resp.Body.Close()
-		return nil, fmt.Errorf("ollama API error (status %d): %s", resp.StatusCode, string(bodyBytes))
+		return nil, models.NewProviderError(models.ProviderOllama, resp.StatusCode, bodyBytes)
 	}
 
 	// Create channel for streaming
@@ -159,6 +195,7 @@ func (p *Provider) Stream(ctx context.Context, req models.ChatRequest) (<-chan m
 		defer close(chunks)
 		defer resp.Body.Close()
 
+		sawToolCalls := false
 		scanner := bufio.NewScanner(resp.Body)
 		for scanner.Scan() {
 			line := scanner.Bytes()
@@ -176,15 +213,38 @@ func (p *Provider) Stream(ctx context.Context, req models.ChatRequest) (<-chan m
 				return
 			}
 
+			if ollamaResp.Message.Thinking != "" {
+				chunks <- models.StreamChunk{
+					ID:    ollamaResp.CreatedAt,
+					Kind:  models.ChunkReasoning,
+					Delta: ollamaResp.Message.Thinking,
+				}
+			}
+
 			chunk := models.StreamChunk{
 				ID:           ollamaResp.CreatedAt,
 				Delta:        ollamaResp.Message.Content,
+				ToolCalls:    convertToolCalls(ollamaResp.Message.ToolCalls),
 				Done:         ollamaResp.Done,
 				FinishReason: "",
 			}
 
+			// Ollama sends tool calls in a chunk of their own before the final one
+			if len(chunk.ToolCalls) > 0 {
+				sawToolCalls = true
+			}
+
 			if ollamaResp.Done {
+				chunk.Model = ollamaResp.Model
 				chunk.FinishReason = "stop"
+				if sawToolCalls {
+					chunk.FinishReason = "tool_calls"
+				}
+				chunk.Usage = &models.TokenUsage{
+					PromptTokens:     ollamaResp.PromptEvalCount,
+					CompletionTokens: ollamaResp.EvalCount,
+					TotalTokens:      ollamaResp.PromptEvalCount + ollamaResp.EvalCount,
+				}
 			}
 
 			chunks <- chunk
@@ -206,17 +266,59 @@ func (p *Provider) Stream(ctx context.Context, req models.ChatRequest) (<-chan m
 }
 
 func (p *Provider) convertRequest(req models.ChatRequest) ollamaChatRequest {
+	// Ollama matches tool results by function name rather than call ID
+	toolNames := make(map[string]string)
+
 	messages := make([]ollamaMessage, len(req.Messages))
 	for i, msg := range req.Messages {
-		messages[i] = ollamaMessage{
+		ollamaMsg := ollamaMessage{
 			Role:    string(msg.Role),
 			Content: msg.Content,
 		}
+
+		if len(msg.ToolCalls) > 0 {
+			ollamaMsg.ToolCalls = make([]ollamaToolCall, len(msg.ToolCalls))
+			for j, tc := range msg.ToolCalls {
+				toolNames[tc.ID] = tc.Function.Name
+				ollamaMsg.ToolCalls[j] = ollamaToolCall{
+					Function: ollamaFunctionCall{
+						Name:      tc.Function.Name,
+						Arguments: tc.Function.Arguments,
+					},
+				}
+			}
+		}
+
+		if msg.Role == models.RoleTool {
+			ollamaMsg.ToolName = toolNames[msg.ToolCallID]
+		}
+
+		for _, part := range msg.Parts {
+			switch p := part.(type) {
+			case models.ImagePart:
+				// Ollama only accepts inline image data
+				if data := p.InlineData(); data != "" {
+					ollamaMsg.Images = append(ollamaMsg.Images, data)
+				} else {
+					ollamaMsg.Content += fmt.Sprintf("\n[Image not attached, remote URLs are unsupported: %s]", p.URL)
+				}
+			default:
+				ollamaMsg.Content += "\n" + part.String()
+			}
+		}
+
+		messages[i] = ollamaMsg
 	}
 
 	ollamaReq := ollamaChatRequest{
-		Model:    req.Model,
-		Messages: messages,
+		Model:     req.Model,
+		Messages:  messages,
+		Options:   p.mergeOptions(req),
+		KeepAlive: keepAliveValue(p.keepAlive),
+		Think:     thinkValue(req),
+	}
+	if req.KeepAlive != "" {
+		ollamaReq.KeepAlive = keepAliveValue(req.KeepAlive)
 	}
 
 	// Convert tools if present
@@ -237,6 +339,203 @@ func (p *Provider) convertRequest(req models.ChatRequest) ollamaChatRequest {
 	return ollamaReq
 }
 
+// thinkValue maps the reasoning settings to Ollama's think parameter. Ollama
+// has no token budget, so a budget alone just enables thinking.
+func thinkValue(req models.ChatRequest) interface{} {
+	switch req.ReasoningEffort {
+	case "":
+		if req.ThinkingBudget > 0 {
+			return true
+		}
+		return nil
+	case "none":
+		return false
+	default:
+		return req.ReasoningEffort
+	}
+}
+
+// convertToolCalls converts Ollama tool calls, generating IDs since Ollama
+// does not always assign them
+func convertToolCalls(calls []ollamaToolCall) []models.ToolCall {
+	if len(calls) == 0 {
+		return nil
+	}
+
+	toolCalls := make([]models.ToolCall, len(calls))
+	for i, tc := range calls {
+		id := tc.ID
+		if id == "" {
+			id = "call_" + uuid.New().String()
+		}
+
+		args := tc.Function.Arguments
+		if args == nil {
+			args = make(map[string]interface{})
+		}
+
+		toolCalls[i] = models.ToolCall{
+			ID:   id,
+			Type: "function",
+			Function: models.FunctionCall{
+				Name:      tc.Function.Name,
+				Arguments: args,
+			},
+		}
+	}
+	return toolCalls
+}
+
+// mergeOptions layers the provider defaults, the request's sampling
+// parameters and the request's explicit options, in increasing precedence
+// EffectiveOptions returns the model options a request is sent with: the
+// provider defaults overridden by the request's sampling parameters and options
+func (p *Provider) EffectiveOptions(req models.ChatRequest) map[string]interface{} {
+	return p.mergeOptions(req)
+}
+
+func (p *Provider) mergeOptions(req models.ChatRequest) map[string]interface{} {
+	options := make(map[string]interface{})
+	for k, v := range p.options {
+		options[k] = v
+	}
+	for k, v := range samplingOptions(req) {
+		options[k] = v
+	}
+	for k, v := range req.Options {
+		options[k] = v
+	}
+
+	if len(options) == 0 {
+		return nil
+	}
+	return options
+}
+
+// keepAliveValue converts a keep_alive setting to what Ollama expects: plain
+// numbers are seconds, anything else is a duration string like "10m"
+func keepAliveValue(keepAlive string) interface{} {
+	if keepAlive == "" {
+		return nil
+	}
+	if seconds, err := strconv.Atoi(keepAlive); err == nil {
+		return seconds
+	}
+	return keepAlive
+}
+
+// samplingOptions maps the request's sampling parameters onto Ollama's
+// model options, which use their own names for some fields
+func samplingOptions(req models.ChatRequest) map[string]interface{} {
+	options := make(map[string]interface{})
+	if req.MaxTokens > 0 {
+		options["num_predict"] = req.MaxTokens
+	}
+	if req.Temperature != nil {
+		options["temperature"] = *req.Temperature
+	}
+	if req.TopP != nil {
+		options["top_p"] = *req.TopP
+	}
+	if len(req.Stop) > 0 {
+		options["stop"] = req.Stop
+	}
+	if req.Seed != nil {
+		options["seed"] = *req.Seed
+	}
+	if req.FrequencyPenalty != nil {
+		options["frequency_penalty"] = *req.FrequencyPenalty
+	}
+	if req.PresencePenalty != nil {
+		options["presence_penalty"] = *req.PresencePenalty
+	}
+	return options
+}
+
 func (p *Provider) Model() string {
 	return p.model
 }
+
+type ollamaEmbedRequest struct {
+	Model     string      `json:"model"`
+	Input     []string    `json:"input"`
+	KeepAlive interface{} `json:"keep_alive,omitempty"`
+}
+
+type ollamaEmbedResponse struct {
+	Embeddings [][]float32 `json:"embeddings"`
+}
+
+// Embed returns an embedding of each input computed with model
+func (p *Provider) Embed(ctx context.Context, model string, input []string) ([][]float32, error) {
+	embedReq := ollamaEmbedRequest{Model: model, Input: input}
+	if p.keepAlive != "" {
+		embedReq.KeepAlive = p.keepAlive
+	}
+
+	body, err := json.Marshal(embedReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", p.baseURL+"/api/embed", bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	resp, err := p.client.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		return nil, models.NewProviderError(models.ProviderOllama, resp.StatusCode, bodyBytes)
+	}
+
+	var embedResp ollamaEmbedResponse
+	if err := json.NewDecoder(resp.Body).Decode(&embedResp); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	if len(embedResp.Embeddings) != len(input) {
+		return nil, fmt.Errorf("expected %d embeddings, got %d", len(input), len(embedResp.Embeddings))
+	}
+	return embedResp.Embeddings, nil
+}
+
+type ollamaTagsResponse struct {
+	Models []struct {
+		Name string `json:"name"`
+	} `json:"models"`
+}
+
+// ListModels returns the names of the models pulled into the Ollama server
+func (p *Provider) ListModels(ctx context.Context) ([]string, error) {
+	httpReq, err := http.NewRequestWithContext(ctx, "GET", p.baseURL+"/api/tags", nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	resp, err := p.client.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		return nil, models.NewProviderError(models.ProviderOllama, resp.StatusCode, bodyBytes)
+	}
+
+	var tags ollamaTagsResponse
+	if err := json.NewDecoder(resp.Body).Decode(&tags); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	names := make([]string, len(tags.Models))
+	for i, model := range tags.Models {
+		names[i] = model.Name
+	}
+	return names, nil
+}
@@ -8,6 +8,7 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"sort"
 
 	"github.com/omnitrix-sh/core.sh/pkg/models"
 )
@@ -21,9 +22,23 @@ type Provider struct {
 
 type openaiMessage struct {
 	Role       string            `json:"role"`
-	Content    *string           `json:"content,omitempty"`
+	Content    interface{}       `json:"content,omitempty"` // string or []openaiContentPart
 	ToolCalls  []openaiToolCall  `json:"tool_calls,omitempty"`
 	ToolCallID string            `json:"tool_call_id,omitempty"`
+
+	// Reasoning output, named differently by OpenAI compatible servers
+	ReasoningContent string `json:"reasoning_content,omitempty"`
+	Reasoning        string `json:"reasoning,omitempty"`
+}
+
+type openaiContentPart struct {
+	Type     string          `json:"type"`
+	Text     string          `json:"text,omitempty"`
+	ImageURL *openaiImageURL `json:"image_url,omitempty"`
+}
+
+type openaiImageURL struct {
+	URL string `json:"url"`
 }
 
 type openaiToolCall struct {
@@ -38,10 +53,24 @@ type openaiToolFunction struct {
 }
 
 type openaiChatRequest struct {
-	Model    string          `json:"model"`
-	Messages []openaiMessage `json:"messages"`
-	Tools    []openaiTool    `json:"tools,omitempty"`
-	Stream   bool            `json:"stream"`
+	Model            string               `json:"model"`
+	Messages         []openaiMessage      `json:"messages"`
+	Tools            []openaiTool         `json:"tools,omitempty"`
+	Stream           bool                 `json:"stream"`
+	StreamOptions    *openaiStreamOptions `json:"stream_options,omitempty"`
+	MaxTokens        int                  `json:"max_tokens,omitempty"`
+	MaxCompletion    int                  `json:"max_completion_tokens,omitempty"`
+	ReasoningEffort  string               `json:"reasoning_effort,omitempty"`
+	Temperature      *float32             `json:"temperature,omitempty"`
+	TopP             *float32             `json:"top_p,omitempty"`
+	Stop             []string             `json:"stop,omitempty"`
+	Seed             *int                 `json:"seed,omitempty"`
+	FrequencyPenalty *float32             `json:"frequency_penalty,omitempty"`
+	PresencePenalty  *float32             `json:"presence_penalty,omitempty"`
+}
+
+type openaiStreamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
 }
 
 type openaiTool struct {
@@ -50,8 +79,9 @@ type openaiTool struct {
 }
 
 type openaiChatResponse struct {
-	ID      string `json:"id"`
-	Model   string `json:"model"`
+	ID                string `json:"id"`
+	Model             string `json:"model"`
+	SystemFingerprint string `json:"system_fingerprint"`
 	Choices []struct {
 		Index        int           `json:"index"`
 		Message      openaiMessage `json:"message"`
@@ -65,16 +95,24 @@ type openaiChatResponse struct {
 }
 
 type openaiStreamChunk struct {
-	ID      string `json:"id"`
-	Model   string `json:"model"`
+	ID                string `json:"id"`
+	Model             string `json:"model"`
+	SystemFingerprint string `json:"system_fingerprint"`
 	Choices []struct {
 		Index int `json:"index"`
 		Delta struct {
-			Content   string             `json:"content,omitempty"`
-			ToolCalls []openaiToolCall   `json:"tool_calls,omitempty"`
+			Content          string           `json:"content,omitempty"`
+			ReasoningContent string           `json:"reasoning_content,omitempty"`
+			Reasoning        string           `json:"reasoning,omitempty"`
+			ToolCalls        []openaiToolCall `json:"tool_calls,omitempty"`
 		} `json:"delta"`
 		FinishReason *string `json:"finish_reason"`
 	} `json:"choices"`
+	Usage *struct {
+		PromptTokens     int `json:"prompt_tokens"`
+		CompletionTokens int `json:"completion_tokens"`
+		TotalTokens      int `json:"total_tokens"`
+	} `json:"usage"`
 }
 
 func NewProvider(apiKey, model string) *Provider {
@@ -111,7 +149,7 @@ func (p *Provider) Chat(ctx context.Context, req models.ChatRequest) (*models.Ch
 
 	if resp.StatusCode != http.StatusOK {
 		bodyBytes, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("openai API error (status %d): %s", resp.StatusCode, string(bodyBytes))
+		return nil, models.NewProviderError(models.ProviderOpenAI, resp.StatusCode, bodyBytes)
 	}
 
 	var openaiResp openaiChatResponse
@@ -144,15 +182,14 @@ func (p *Provider) Chat(ctx context.Context, req models.ChatRequest) (*models.Ch
 		}
 	}
 
-	content := ""
-	if choice.Message.Content != nil {
-		content = *choice.Message.Content
-	}
+	content, _ := choice.Message.Content.(string)
 	
 	return &models.ChatResponse{
 		ID:           openaiResp.ID,
 		Model:        openaiResp.Model,
 		Content:      content,
+		Reasoning:    firstNonEmpty(choice.Message.ReasoningContent, choice.Message.Reasoning),
+		Fingerprint:  openaiResp.SystemFingerprint,
 		ToolCalls:    toolCalls,
 		FinishReason: choice.FinishReason,
 		Usage: models.TokenUsage{
@@ -166,6 +203,7 @@ func (p *Provider) Chat(ctx context.Context, req models.ChatRequest) (*models.Ch
 func (p *Provider) Stream(ctx context.Context, req models.ChatRequest) (<-chan models.StreamChunk, error) {
 	openaiReq := p.convertRequest(req)
 	openaiReq.Stream = true
+	openaiReq.StreamOptions = &openaiStreamOptions{IncludeUsage: true}
 
 	body, err := json.Marshal(openaiReq)
 	if err != nil {
@@ -188,7 +226,7 @@ func (p *Provider) Stream(ctx context.Context, req models.ChatRequest) (<-chan m
 	if resp.StatusCode != http.StatusOK {
 		bodyBytes, _ := io.ReadAll(resp.Body)
 		resp.Body.Close()
-		return nil, fmt.Errorf("openai API error (status %d): %s", resp.StatusCode, string(bodyBytes))
+		return nil, models.NewProviderError(models.ProviderOpenAI, resp.StatusCode, bodyBytes)
 	}
 
 	chunks := make(chan models.StreamChunk)
@@ -197,6 +235,11 @@ func (p *Provider) Stream(ctx context.Context, req models.ChatRequest) (<-chan m
 		defer close(chunks)
 		defer resp.Body.Close()
 
+		// finish_reason and usage arrive in separate events before [DONE],
+		// so both are held back and reported on a single final chunk
+		var finishReason, model, fingerprint string
+		var usage *models.TokenUsage
+
 		scanner := bufio.NewScanner(resp.Body)
 		for scanner.Scan() {
 			line := scanner.Text()
@@ -208,8 +251,7 @@ func (p *Provider) Stream(ctx context.Context, req models.ChatRequest) (<-chan m
 			line = line[6:] // Remove "data: " prefix
 			
 			if line == "[DONE]" {
-				chunks <- models.StreamChunk{Done: true}
-				return
+				break
 			}
 
 			var streamChunk openaiStreamChunk
@@ -217,23 +259,45 @@ func (p *Provider) Stream(ctx context.Context, req models.ChatRequest) (<-chan m
 				continue
 			}
 
+			if streamChunk.Model != "" {
+				model = streamChunk.Model
+			}
+			if streamChunk.SystemFingerprint != "" {
+				fingerprint = streamChunk.SystemFingerprint
+			}
+
+			if streamChunk.Usage != nil {
+				usage = &models.TokenUsage{
+					PromptTokens:     streamChunk.Usage.PromptTokens,
+					CompletionTokens: streamChunk.Usage.CompletionTokens,
+					TotalTokens:      streamChunk.Usage.TotalTokens,
+				}
+			}
+
 			if len(streamChunk.Choices) == 0 {
 				continue
 			}
 
 			choice := streamChunk.Choices[0]
-			
-			chunk := models.StreamChunk{
-				ID:    streamChunk.ID,
-				Delta: choice.Delta.Content,
-				Done:  choice.FinishReason != nil,
+
+			if reasoning := firstNonEmpty(choice.Delta.ReasoningContent, choice.Delta.Reasoning); reasoning != "" {
+				chunks <- models.StreamChunk{
+					ID:    streamChunk.ID,
+					Kind:  models.ChunkReasoning,
+					Delta: reasoning,
+				}
 			}
 
 			if choice.FinishReason != nil {
-				chunk.FinishReason = *choice.FinishReason
+				finishReason = *choice.FinishReason
 			}
 
-			chunks <- chunk
+			if choice.Delta.Content != "" {
+				chunks <- models.StreamChunk{
+					ID:    streamChunk.ID,
+					Delta: choice.Delta.Content,
+				}
+			}
 		}
 
 		if err := scanner.Err(); err != nil {
@@ -241,6 +305,15 @@ func (p *Provider) Stream(ctx context.Context, req models.ChatRequest) (<-chan m
 				Delta: fmt.Sprintf("[Stream error: %v]", err),
 				Done:  true,
 			}
+			return
+		}
+
+		chunks <- models.StreamChunk{
+			FinishReason: finishReason,
+			Usage:        usage,
+			Model:        model,
+			Fingerprint:  fingerprint,
+			Done:         true,
 		}
 	}()
 
@@ -256,9 +329,10 @@ func (p *Provider) convertRequest(req models.ChatRequest) openaiChatRequest {
 		}
 		
 		// Only set content if not empty
-		if msg.Content != "" {
-			contentStr := msg.Content
-			openaiMsg.Content = &contentStr
+		if len(msg.Parts) > 0 {
+			openaiMsg.Content = convertContentParts(msg)
+		} else if msg.Content != "" {
+			openaiMsg.Content = msg.Content
 		}
 		
 		// Convert tool calls in message
@@ -281,8 +355,24 @@ func (p *Provider) convertRequest(req models.ChatRequest) openaiChatRequest {
 	}
 
 	openaiReq := openaiChatRequest{
-		Model:    req.Model,
-		Messages: messages,
+		Model:            req.Model,
+		Messages:         messages,
+		MaxTokens:        req.MaxTokens,
+		Temperature:      req.Temperature,
+		TopP:             req.TopP,
+		Stop:             req.Stop,
+		Seed:             req.Seed,
+		FrequencyPenalty: req.FrequencyPenalty,
+		PresencePenalty:  req.PresencePenalty,
+	}
+
+	// Reasoning models reject max_tokens and most sampling parameters
+	if effort := req.EffectiveReasoningEffort(); effort != "" && effort != "none" {
+		openaiReq.ReasoningEffort = effort
+		openaiReq.MaxCompletion = openaiReq.MaxTokens
+		openaiReq.MaxTokens = 0
+		openaiReq.Temperature = nil
+		openaiReq.TopP = nil
 	}
 
 	// Convert tools
@@ -303,6 +393,130 @@ func (p *Provider) convertRequest(req models.ChatRequest) openaiChatRequest {
 	return openaiReq
 }
 
+// convertContentParts builds a content array for multimodal messages, with
+// the message's text first followed by its parts in order
+func convertContentParts(msg models.Message) []openaiContentPart {
+	var parts []openaiContentPart
+	if msg.Content != "" {
+		parts = append(parts, openaiContentPart{Type: "text", Text: msg.Content})
+	}
+
+	for _, part := range msg.Parts {
+		switch p := part.(type) {
+		case models.ImagePart:
+			parts = append(parts, openaiContentPart{
+				Type:     "image_url",
+				ImageURL: &openaiImageURL{URL: p.DataURL()},
+			})
+		default:
+			parts = append(parts, openaiContentPart{Type: "text", Text: part.String()})
+		}
+	}
+	return parts
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
 func (p *Provider) Model() string {
 	return p.model
 }
+
+type openaiEmbedRequest struct {
+	Model string   `json:"model"`
+	Input []string `json:"input"`
+}
+
+type openaiEmbedResponse struct {
+	Data []struct {
+		Index     int       `json:"index"`
+		Embedding []float32 `json:"embedding"`
+	} `json:"data"`
+}
+
+// Embed returns an embedding of each input computed with model
+func (p *Provider) Embed(ctx context.Context, model string, input []string) ([][]float32, error) {
+	body, err := json.Marshal(openaiEmbedRequest{Model: model, Input: input})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", p.baseURL+"/embeddings", bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("Authorization", "Bearer "+p.apiKey)
+
+	resp, err := p.client.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		return nil, models.NewProviderError(models.ProviderOpenAI, resp.StatusCode, bodyBytes)
+	}
+
+	var embedResp openaiEmbedResponse
+	if err := json.NewDecoder(resp.Body).Decode(&embedResp); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	embeddings := make([][]float32, len(input))
+	for _, d := range embedResp.Data {
+		if d.Index >= 0 && d.Index < len(embeddings) {
+			embeddings[d.Index] = d.Embedding
+		}
+	}
+	for i, e := range embeddings {
+		if e == nil {
+			return nil, fmt.Errorf("missing embedding for input %d", i)
+		}
+	}
+	return embeddings, nil
+}
+
+type openaiModelsResponse struct {
+	Data []struct {
+		ID string `json:"id"`
+	} `json:"data"`
+}
+
+// ListModels returns the IDs of the models the API key can use
+func (p *Provider) ListModels(ctx context.Context) ([]string, error) {
+	httpReq, err := http.NewRequestWithContext(ctx, "GET", p.baseURL+"/models", nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	httpReq.Header.Set("Authorization", "Bearer "+p.apiKey)
+
+	resp, err := p.client.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		return nil, models.NewProviderError(models.ProviderOpenAI, resp.StatusCode, bodyBytes)
+	}
+
+	var list openaiModelsResponse
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	ids := make([]string, len(list.Data))
+	for i, model := range list.Data {
+		ids[i] = model.ID
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
@@ -0,0 +1,383 @@
+// Package pseudonym replaces identifying details in requests to cloud
+// providers with stand-ins, and puts the originals back in what the
+// provider answers. The model works with "Anon1" and "host2.example"
+// while the user and the tools see the real names.
+package pseudonym
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/omnitrix-sh/core.sh/pkg/models"
+)
+
+// Kinds of detail detected on top of the configured terms
+const (
+	DetectEmails = "emails"
+	DetectHosts  = "hosts"
+	DetectIPs    = "ips"
+)
+
+// defaultAllow are public hosts that identify no one and that the model
+// needs to see to be useful, such as package registries
+var defaultAllow = []string{
+	"localhost", "example.com", "example.org", "example.net",
+	"github.com", "githubusercontent.com", "gitlab.com", "bitbucket.org",
+	"golang.org", "go.dev", "npmjs.com", "npmjs.org", "pypi.org",
+	"python.org", "crates.io", "rubygems.org", "docker.io", "docker.com",
+	"googleapis.com", "stackoverflow.com", "mozilla.org", "wikipedia.org",
+	"127.0.0.1", "0.0.0.0",
+}
+
+var (
+	emailPattern = regexp.MustCompile(`[A-Za-z0-9._%+-]+@(?:[A-Za-z0-9](?:[A-Za-z0-9-]*[A-Za-z0-9])?\.)+[A-Za-z]{2,}`)
+	// Only top-level domains that aren't also common file extensions, so
+	// main.go and app.py are left alone
+	hostPattern = regexp.MustCompile(`(?i)\b(?:[a-z0-9](?:[a-z0-9-]*[a-z0-9])?\.)+(?:com|net|org|io|dev|app|cloud|ai|co|biz|info|internal|local|lan|corp|intra|intranet|home|private|us|uk|de|fr|nl|eu|ch|se|no|dk|fi|jp|cn|in|au|ca)\b`)
+	ipPattern   = regexp.MustCompile(`\b(?:(?:25[0-5]|2[0-4][0-9]|1[0-9][0-9]|[1-9]?[0-9])\.){3}(?:25[0-5]|2[0-4][0-9]|1[0-9][0-9]|[1-9]?[0-9])\b`)
+)
+
+// Mapper keeps the mapping between details and their stand-ins. The same
+// detail always gets the same stand-in, across requests and sessions, so
+// history resent with each request stays consistent.
+type Mapper struct {
+	terms     *regexp.Regexp
+	detect    map[string]bool
+	allow     []string
+	providers map[string]bool
+
+	mu      sync.Mutex
+	forward map[string]string // detail -> stand-in
+	reverse map[string]string // stand-in -> detail
+	counts  map[string]int    // stand-ins handed out per kind
+	// restorer is rebuilt when stand-ins are added
+	restorer *strings.Replacer
+}
+
+// New creates a Mapper from config. It returns nil when pseudonymization is
+// disabled; a nil Mapper leaves requests unchanged.
+func New(cfg models.PseudonymizeConfig) (*Mapper, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+
+	m := &Mapper{
+		detect:  make(map[string]bool),
+		forward: make(map[string]string),
+		reverse: make(map[string]string),
+		counts:  make(map[string]int),
+	}
+
+	detect := cfg.Detect
+	if detect == nil {
+		detect = []string{DetectEmails, DetectHosts, DetectIPs}
+	}
+	for _, kind := range detect {
+		switch kind {
+		case DetectEmails, DetectHosts, DetectIPs:
+			m.detect[kind] = true
+		default:
+			return nil, fmt.Errorf("invalid pseudonymize detector %q, expected emails, hosts or ips", kind)
+		}
+	}
+
+	var terms []string
+	for _, term := range cfg.Terms {
+		if term = strings.TrimSpace(term); term != "" {
+			terms = append(terms, regexp.QuoteMeta(term))
+		}
+	}
+	if len(terms) > 0 {
+		// Longest first, so a term containing another wins
+		sort.Slice(terms, func(i, j int) bool { return len(terms[i]) > len(terms[j]) })
+		m.terms = regexp.MustCompile(`(?i)` + strings.Join(terms, "|"))
+	}
+
+	for _, host := range append(defaultAllow, cfg.Allow...) {
+		m.allow = append(m.allow, strings.ToLower(host))
+	}
+
+	if len(cfg.Providers) > 0 {
+		m.providers = make(map[string]bool, len(cfg.Providers))
+		for _, provider := range cfg.Providers {
+			m.providers[provider] = true
+		}
+	}
+	return m, nil
+}
+
+// Applies reports whether requests to provider are pseudonymized. Ollama
+// runs locally, so unless providers are configured it is the exception.
+func (m *Mapper) Applies(provider string) bool {
+	if m == nil {
+		return false
+	}
+	if m.providers != nil {
+		return m.providers[provider]
+	}
+	return provider != string(models.ProviderOllama)
+}
+
+// Request replaces the details in a request to provider with stand-ins
+func (m *Mapper) Request(provider string, req models.ChatRequest) models.ChatRequest {
+	if !m.Applies(provider) {
+		return req
+	}
+	return req.MapText(m.Hide)
+}
+
+// Response puts the originals back in a response from provider, including
+// tool call arguments so tools act on the real names
+func (m *Mapper) Response(provider string, resp *models.ChatResponse) {
+	if resp == nil || !m.Applies(provider) {
+		return
+	}
+	resp.Content = m.Restore(resp.Content)
+	resp.Reasoning = m.Restore(resp.Reasoning)
+	resp.ToolCalls = m.restoreToolCalls(resp.ToolCalls)
+}
+
+// Stream puts the originals back in a streamed response from provider.
+// Text that could be the start of a stand-in split across chunks is held
+// back until the next chunk shows whether it is.
+func (m *Mapper) Stream(provider string, chunks <-chan models.StreamChunk) <-chan models.StreamChunk {
+	if !m.Applies(provider) {
+		return chunks
+	}
+
+	out := make(chan models.StreamChunk)
+	go func() {
+		defer close(out)
+		pending := make(map[models.ChunkKind]string)
+		for chunk := range chunks {
+			if chunk.Delta != "" {
+				text := pending[chunk.Kind] + chunk.Delta
+				held := m.partial(text)
+				pending[chunk.Kind] = text[len(text)-held:]
+				chunk.Delta = m.Restore(text[:len(text)-held])
+			}
+			chunk.ToolCalls = m.restoreToolCalls(chunk.ToolCalls)
+
+			if chunk.Done {
+				// Flush what was held back
+				for kind, text := range pending {
+					if kind != chunk.Kind && text != "" {
+						out <- models.StreamChunk{ID: chunk.ID, Kind: kind, Delta: m.Restore(text)}
+					}
+				}
+				chunk.Delta += m.Restore(pending[chunk.Kind])
+			}
+			out <- chunk
+		}
+	}()
+	return out
+}
+
+// Hide replaces the details in text with stand-ins
+func (m *Mapper) Hide(text string) string {
+	if m == nil || text == "" {
+		return text
+	}
+
+	type match struct {
+		start, end int
+		kind       string
+	}
+	var matches []match
+	add := func(kind string, pattern *regexp.Regexp) {
+		for _, loc := range pattern.FindAllStringIndex(text, -1) {
+			matches = append(matches, match{loc[0], loc[1], kind})
+		}
+	}
+	if m.terms != nil {
+		add("term", m.terms)
+	}
+	if m.detect[DetectEmails] {
+		add(DetectEmails, emailPattern)
+	}
+	if m.detect[DetectHosts] {
+		add(DetectHosts, hostPattern)
+	}
+	if m.detect[DetectIPs] {
+		add(DetectIPs, ipPattern)
+	}
+	if len(matches) == 0 {
+		return text
+	}
+
+	// Earliest first, and of those starting together the longest, so an
+	// email wins over the host in it
+	sort.SliceStable(matches, func(i, j int) bool {
+		if matches[i].start != matches[j].start {
+			return matches[i].start < matches[j].start
+		}
+		return matches[i].end > matches[j].end
+	})
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var out strings.Builder
+	last := 0
+	for _, mt := range matches {
+		if mt.start < last {
+			continue
+		}
+		detail := text[mt.start:mt.end]
+		out.WriteString(text[last:mt.start])
+		out.WriteString(m.standIn(mt.kind, detail))
+		last = mt.end
+	}
+	out.WriteString(text[last:])
+	return out.String()
+}
+
+// Restore puts the originals back in text
+func (m *Mapper) Restore(text string) string {
+	if m == nil || text == "" {
+		return text
+	}
+	m.mu.Lock()
+	restorer := m.restorer
+	m.mu.Unlock()
+	if restorer == nil {
+		return text
+	}
+	return restorer.Replace(text)
+}
+
+// standIn returns the stand-in for a detail, handing out a new one the
+// first time it is seen. Details that are allowed, or are stand-ins
+// already, are returned as they are. Callers hold m.mu.
+func (m *Mapper) standIn(kind, detail string) string {
+	if kind != "term" && m.allowed(kind, detail) {
+		return detail
+	}
+	if _, ok := m.reverse[detail]; ok {
+		return detail
+	}
+	key := detail
+	if kind != "term" {
+		// Host names and emails are case-insensitive
+		key = strings.ToLower(detail)
+	}
+	if standIn, ok := m.forward[key]; ok {
+		return standIn
+	}
+
+	var standIn string
+	switch kind {
+	case DetectEmails:
+		m.counts[kind]++
+		standIn = fmt.Sprintf("user%d@example.invalid", m.counts[kind])
+	case DetectHosts:
+		m.counts[kind]++
+		standIn = fmt.Sprintf("host%d.example", m.counts[kind])
+	case DetectIPs:
+		// From 198.18.0.0/15, reserved for benchmarking and never routed
+		m.counts[kind]++
+		n := m.counts[kind]
+		standIn = fmt.Sprintf("198.%d.%d.%d", 18+(n>>16)&1, (n>>8)&255, n&255)
+	default:
+		// Every spelling of a term counts as the same term, and its
+		// stand-in follows the spelling's case
+		lower := strings.ToLower(detail)
+		n, ok := m.counts["term:"+lower]
+		if !ok {
+			m.counts[kind]++
+			n = m.counts[kind]
+			m.counts["term:"+lower] = n
+		}
+		standIn = fmt.Sprintf("Anon%d", n)
+		switch detail {
+		case strings.ToUpper(detail):
+			standIn = strings.ToUpper(standIn)
+		case lower:
+			standIn = strings.ToLower(standIn)
+		}
+	}
+
+	if original, ok := m.reverse[standIn]; ok && original != detail {
+		// Another spelling mapped to the same case form first; keep the
+		// first so restoring stays unambiguous
+		m.forward[key] = standIn
+		return standIn
+	}
+	m.forward[key] = standIn
+	m.reverse[standIn] = detail
+	m.rebuild()
+	return standIn
+}
+
+// allowed reports whether a detected host or address is one of the allowed
+// ones or a subdomain of one
+func (m *Mapper) allowed(kind, detail string) bool {
+	host := strings.ToLower(detail)
+	if kind == DetectEmails {
+		host = host[strings.LastIndex(host, "@")+1:]
+	}
+	for _, allowed := range m.allow {
+		if host == allowed || strings.HasSuffix(host, "."+allowed) {
+			return true
+		}
+	}
+	return false
+}
+
+// rebuild updates the restorer after stand-ins were added. Longer stand-ins
+// come first so Anon12 isn't restored as Anon1 followed by 2. Callers hold
+// m.mu.
+func (m *Mapper) rebuild() {
+	standIns := make([]string, 0, len(m.reverse))
+	for standIn := range m.reverse {
+		standIns = append(standIns, standIn)
+	}
+	sort.Slice(standIns, func(i, j int) bool {
+		if len(standIns[i]) != len(standIns[j]) {
+			return len(standIns[i]) > len(standIns[j])
+		}
+		return standIns[i] < standIns[j]
+	})
+
+	pairs := make([]string, 0, 2*len(standIns))
+	for _, standIn := range standIns {
+		pairs = append(pairs, standIn, m.reverse[standIn])
+	}
+	m.restorer = strings.NewReplacer(pairs...)
+}
+
+// partial returns the length of the end of text that could be the start of
+// a stand-in, or a stand-in that a longer one starts with. Text is read
+// left to right the way the restorer reads it, so complete stand-ins are
+// never split.
+func (m *Mapper) partial(text string) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := 0; i < len(text); {
+		rest := text[i:]
+		skip := 1
+		for standIn := range m.reverse {
+			if len(standIn) > len(rest) && strings.HasPrefix(standIn, rest) {
+				return len(rest)
+			}
+			if strings.HasPrefix(rest, standIn) {
+				skip = max(skip, len(standIn))
+			}
+		}
+		i += skip
+	}
+	return 0
+}
+
+func (m *Mapper) restoreToolCalls(calls []models.ToolCall) []models.ToolCall {
+	if len(calls) == 0 {
+		return calls
+	}
+	// Run the calls through an otherwise empty request to reuse its walk
+	// over argument values
+	restored := models.ChatRequest{Messages: []models.Message{{ToolCalls: calls}}}.MapText(m.Restore)
+	return restored.Messages[0].ToolCalls
+}
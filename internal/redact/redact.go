@@ -0,0 +1,154 @@
+package redact
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Rule is a named pattern for a kind of secret. If Group is set, only that
+// submatch is masked, so "password = hunter22" keeps its key.
+type Rule struct {
+	Name    string
+	Pattern *regexp.Regexp
+	Group   int
+}
+
+// DefaultRules cover common credential formats
+var DefaultRules = []Rule{
+	{Name: "private_key", Pattern: regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----[\s\S]*?-----END [A-Z ]*PRIVATE KEY-----`)},
+	{Name: "aws_access_key", Pattern: regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`)},
+	{Name: "github_token", Pattern: regexp.MustCompile(`\b(?:gh[pousr]_[A-Za-z0-9]{36,}|github_pat_[A-Za-z0-9_]{22,})\b`)},
+	{Name: "anthropic_key", Pattern: regexp.MustCompile(`\bsk-ant-[A-Za-z0-9_-]{20,}`)},
+	{Name: "openai_key", Pattern: regexp.MustCompile(`\bsk-(?:proj-)?[A-Za-z0-9_-]{20,}`)},
+	{Name: "huggingface_token", Pattern: regexp.MustCompile(`\bhf_[A-Za-z0-9]{30,}\b`)},
+	{Name: "slack_token", Pattern: regexp.MustCompile(`\bxox[abprs]-[A-Za-z0-9-]{10,}`)},
+	{Name: "google_api_key", Pattern: regexp.MustCompile(`\bAIza[0-9A-Za-z_-]{35}\b`)},
+	{Name: "stripe_key", Pattern: regexp.MustCompile(`\b[rs]k_(?:live|test)_[0-9a-zA-Z]{20,}\b`)},
+	{Name: "jwt", Pattern: regexp.MustCompile(`\beyJ[A-Za-z0-9_-]{10,}\.[A-Za-z0-9_-]{10,}\.[A-Za-z0-9_-]{10,}`)},
+	// Variables in .env files and shell exports named like credentials
+	// that the assignment rule doesn't know, such as STRIPE_KEY or DB_PASS
+	{Name: "env_secret", Pattern: regexp.MustCompile(`\b[A-Z][A-Z0-9_]*_(?:KEY|PASS|PWD|DSN|CREDENTIALS?)=["']?([^\s"'#]{8,})`), Group: 1},
+	{Name: "url_credentials", Pattern: regexp.MustCompile(`[a-zA-Z][a-zA-Z0-9+.-]*://[^/\s:@]+:([^/\s:@]+)@`), Group: 1},
+	{
+		Name:    "assignment",
+		Pattern: regexp.MustCompile(`(?i)\b[\w.-]*(?:password|passwd|secret|token|api[_-]?key|access[_-]?key|auth)[\w.-]*["']?\s*[:=]\s*["']?([^\s"',;]{8,})`),
+		Group:   1,
+	},
+}
+
+// WithPatterns returns DefaultRules plus a rule for each extra regular
+// expression, named custom_1, custom_2 and so on
+func WithPatterns(patterns []string) ([]Rule, error) {
+	rules := append([]Rule(nil), DefaultRules...)
+	for i, pattern := range patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redact pattern %q: %w", pattern, err)
+		}
+		rules = append(rules, Rule{Name: fmt.Sprintf("custom_%d", i+1), Pattern: re})
+	}
+	return rules, nil
+}
+
+// Redactor masks secrets in text
+type Redactor struct {
+	rules []Rule
+}
+
+// New creates a Redactor using the given rules, or DefaultRules if none
+func New(rules ...Rule) *Redactor {
+	if len(rules) == 0 {
+		rules = DefaultRules
+	}
+	return &Redactor{rules: rules}
+}
+
+// Finding is a secret located in text
+type Finding struct {
+	Rule  string
+	Start int
+	End   int
+}
+
+// Find returns the locations of secrets in text, in order and without overlaps
+func (r *Redactor) Find(text string) []Finding {
+	var findings []Finding
+	for _, rule := range r.rules {
+		for _, m := range rule.Pattern.FindAllStringSubmatchIndex(text, -1) {
+			start, end := m[0], m[1]
+			if rule.Group > 0 && len(m) > 2*rule.Group+1 && m[2*rule.Group] >= 0 {
+				start, end = m[2*rule.Group], m[2*rule.Group+1]
+			}
+			if isPlaceholder(text[start:end]) {
+				continue
+			}
+			findings = append(findings, Finding{Rule: rule.Name, Start: start, End: end})
+		}
+	}
+	return dedupe(findings)
+}
+
+// Redact replaces every secret in text with a [REDACTED:<rule>] marker and
+// returns the number of replacements
+func (r *Redactor) Redact(text string) (string, int) {
+	findings := r.Find(text)
+	if len(findings) == 0 {
+		return text, 0
+	}
+
+	var out strings.Builder
+	last := 0
+	for _, f := range findings {
+		out.WriteString(text[last:f.Start])
+		out.WriteString("[REDACTED:" + f.Rule + "]")
+		last = f.End
+	}
+	out.WriteString(text[last:])
+	return out.String(), len(findings)
+}
+
+// String redacts text with the default rules
+func String(text string) string {
+	redacted, _ := defaultRedactor.Redact(text)
+	return redacted
+}
+
+var defaultRedactor = New()
+
+// isPlaceholder skips values that are obviously not real secrets, such as
+// already redacted text or environment variable references
+func isPlaceholder(value string) bool {
+	return strings.HasPrefix(value, "[REDACTED") ||
+		strings.HasPrefix(value, "${") ||
+		strings.HasPrefix(value, "$") ||
+		strings.HasPrefix(value, "env:") ||
+		strings.Trim(value, "*xX.") == ""
+}
+
+// dedupe sorts findings by position and drops ones overlapping an earlier,
+// longer match
+func dedupe(findings []Finding) []Finding {
+	if len(findings) < 2 {
+		return findings
+	}
+
+	// Stable, so of equal matches the earlier rule's is kept
+	sort.SliceStable(findings, func(i, j int) bool {
+		a, b := findings[i], findings[j]
+		if a.Start != b.Start {
+			return a.Start < b.Start
+		}
+		return a.End-a.Start > b.End-b.Start
+	})
+
+	result := findings[:1]
+	for _, f := range findings[1:] {
+		if f.Start < result[len(result)-1].End {
+			continue
+		}
+		result = append(result, f)
+	}
+	return result
+}
@@ -0,0 +1,523 @@
+// Package rpc serves the agent as JSON-RPC 2.0 over a pair of streams, one
+// message per line, so editor plugins can run Omnitrix as a child process
+// and talk to it over stdin and stdout.
+//
+//	initialize     negotiate features, see handshake.Hello
+//	startSession   create a session
+//	listSessions   list sessions, newest first
+//	sendMessage    send a message and wait for the reply, or queue it
+//	               while the session runs
+//	cancel         stop a session's run
+//	approve        answer a permission request
+//	answer         answer a question from the model
+//
+// While a client uses a session it gets the session's events as "event"
+// notifications, see events.Event: replies as they stream in, tool runs,
+// permission requests and questions.
+package rpc
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/omnitrix-sh/core.sh/internal/agent"
+	"github.com/omnitrix-sh/core.sh/internal/events"
+	"github.com/omnitrix-sh/core.sh/internal/handshake"
+	"github.com/omnitrix-sh/core.sh/internal/permissions"
+	"github.com/omnitrix-sh/core.sh/pkg/models"
+)
+
+const (
+	// maxMessageSize bounds a single message, which may carry images
+	maxMessageSize = 32 << 20
+	// eventBuffer is how many events a slow client can fall behind before
+	// it misses some
+	eventBuffer = 1024
+	// defaultSessionLimit is how many sessions listSessions returns unless
+	// asked for more
+	defaultSessionLimit = 50
+)
+
+// Error codes, from the JSON-RPC spec and for runs that were cancelled
+const (
+	CodeParseError     = -32700
+	CodeInvalidRequest = -32600
+	CodeMethodNotFound = -32601
+	CodeInvalidParams  = -32602
+	CodeInternalError  = -32603
+	CodeCancelled      = -32800
+)
+
+// Error is a JSON-RPC error
+type Error struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+type request struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+type response struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *Error          `json:"error,omitempty"`
+}
+
+type notification struct {
+	JSONRPC string      `json:"jsonrpc"`
+	Method  string      `json:"method"`
+	Params  interface{} `json:"params"`
+}
+
+// Server serves an agent over JSON-RPC. Like the HTTP server, the agent
+// must publish on the same bus for clients to get events, and should ask
+// Approver for approvals.
+type Server struct {
+	agent     *agent.Agent
+	bus       *events.Bus
+	name      string
+	approvals *permissions.Pending
+	clients   *handshake.Clients // those watching each session, see Approver
+}
+
+// New creates a server for the agent. name is the server's name and
+// version, sent in the handshake.
+func New(a *agent.Agent, bus *events.Bus, name string) *Server {
+	return &Server{
+		agent:     a,
+		bus:       bus,
+		name:      name,
+		approvals: permissions.NewPending(0),
+		clients:   handshake.NewClients(),
+	}
+}
+
+// Approver returns the approver to give the agent, see
+// agent.SetPermissions. Requests wait until a client answers them with
+// approve, and questions with answer, or the run ends. While no client
+// watching the session negotiated approval, requests are denied and
+// questions left unanswered right away.
+func (s *Server) Approver() permissions.Approver {
+	return s.clients.Approver(s.approvals)
+}
+
+// conn is one client's connection
+type conn struct {
+	server *Server
+	ctx    context.Context
+
+	writeMu sync.Mutex
+	enc     *json.Encoder
+
+	mu       sync.Mutex
+	features handshake.Features
+	watching map[string]func()             // session ID -> unsubscribe
+	running  map[string]context.CancelFunc // session ID -> cancels its run
+}
+
+// Serve reads requests from r and writes responses and notifications to w
+// until r ends or ctx is done. Requests are handled concurrently, so a
+// client can cancel a run while it waits for the reply. Runs still going
+// when the client goes away are cancelled.
+func (s *Server) Serve(ctx context.Context, r io.Reader, w io.Writer) error {
+	ctx, cancel := context.WithCancel(ctx)
+	c := &conn{
+		server:   s,
+		ctx:      ctx,
+		enc:      json.NewEncoder(w),
+		features: handshake.Features{},
+		watching: make(map[string]func()),
+		running:  make(map[string]context.CancelFunc),
+	}
+
+	var wg sync.WaitGroup
+	defer func() {
+		cancel()
+		c.close()
+		wg.Wait()
+	}()
+
+	lines := make(chan []byte)
+	readErr := make(chan error, 1)
+	go func() {
+		scanner := bufio.NewScanner(r)
+		scanner.Buffer(make([]byte, 64*1024), maxMessageSize)
+		for scanner.Scan() {
+			line := append([]byte(nil), scanner.Bytes()...)
+			select {
+			case lines <- line:
+			case <-ctx.Done():
+				return
+			}
+		}
+		readErr <- scanner.Err()
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case err := <-readErr:
+			return err
+		case line := <-lines:
+			if len(strings.TrimSpace(string(line))) == 0 {
+				continue
+			}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				c.handle(line)
+			}()
+		}
+	}
+}
+
+// close cancels the client's runs and stops its subscriptions
+func (c *conn) close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, cancel := range c.running {
+		cancel()
+	}
+	for _, stop := range c.watching {
+		stop()
+	}
+	c.watching = map[string]func(){}
+}
+
+func (c *conn) handle(line []byte) {
+	var req request
+	if err := json.Unmarshal(line, &req); err != nil {
+		c.write(response{JSONRPC: "2.0", ID: json.RawMessage("null"), Error: &Error{CodeParseError, err.Error()}})
+		return
+	}
+	if req.JSONRPC != "2.0" || req.Method == "" {
+		c.reply(req.ID, nil, &Error{CodeInvalidRequest, "invalid request"})
+		return
+	}
+
+	result, err := c.call(req.Method, req.Params)
+	if req.ID == nil {
+		return // a notification, which gets no answer
+	}
+	var rpcErr *Error
+	if err != nil && !errors.As(err, &rpcErr) {
+		rpcErr = &Error{CodeInternalError, err.Error()}
+	}
+	c.reply(req.ID, result, rpcErr)
+}
+
+func (c *conn) call(method string, params json.RawMessage) (interface{}, error) {
+	switch method {
+	case "initialize":
+		var hello handshake.Hello
+		if err := decode(params, &hello); err != nil {
+			return nil, err
+		}
+		return c.initialize(hello)
+	case "startSession":
+		var p startSessionParams
+		if err := decode(params, &p); err != nil {
+			return nil, err
+		}
+		return c.startSession(p)
+	case "listSessions":
+		var p listSessionsParams
+		if err := decode(params, &p); err != nil {
+			return nil, err
+		}
+		return c.listSessions(p)
+	case "sendMessage":
+		var p sendMessageParams
+		if err := decode(params, &p); err != nil {
+			return nil, err
+		}
+		return c.sendMessage(p)
+	case "cancel":
+		var p cancelParams
+		if err := decode(params, &p); err != nil {
+			return nil, err
+		}
+		return c.cancel(p)
+	case "approve":
+		var p approveParams
+		if err := decode(params, &p); err != nil {
+			return nil, err
+		}
+		return c.approve(p)
+	case "answer":
+		var p answerParams
+		if err := decode(params, &p); err != nil {
+			return nil, err
+		}
+		return c.answer(p)
+	}
+	return nil, &Error{CodeMethodNotFound, fmt.Sprintf("method %q not found", method)}
+}
+
+// initialize negotiates features. Clients that never call it get the
+// events every client handles, without deltas, status or permission
+// requests.
+func (c *conn) initialize(hello handshake.Hello) (*handshake.Welcome, error) {
+	if hello.ProtocolVersion == 0 {
+		hello.ProtocolVersion = handshake.ProtocolVersion
+	}
+	features, welcome, err := handshake.Negotiate(hello, c.server.name)
+	if err != nil {
+		return nil, &Error{CodeInvalidParams, err.Error()}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.features = features
+	// resubscribe so sessions already watched get the new event types
+	for sessionID, stop := range c.watching {
+		stop()
+		c.watching[sessionID] = c.subscribe(sessionID)
+	}
+	return &welcome, nil
+}
+
+type startSessionParams struct {
+	Title string `json:"title"`
+}
+
+func (c *conn) startSession(p startSessionParams) (*models.Session, error) {
+	session, err := c.server.agent.CreateSession(c.ctx, strings.TrimSpace(p.Title))
+	if err != nil {
+		return nil, err
+	}
+	c.watch(session.ID)
+	return session, nil
+}
+
+type listSessionsParams struct {
+	Limit  int `json:"limit"`
+	Offset int `json:"offset"`
+}
+
+func (c *conn) listSessions(p listSessionsParams) ([]models.Session, error) {
+	if p.Limit <= 0 {
+		p.Limit = defaultSessionLimit
+	}
+	return c.server.agent.ListSessions(c.ctx, p.Limit, max(p.Offset, 0))
+}
+
+type sendMessageParams struct {
+	SessionID string             `json:"session_id"`
+	Content   string             `json:"content"`
+	Images    []models.ImagePart `json:"images,omitempty"`
+	// Stream publishes the reply as delta events while it arrives. Tools
+	// are only run without it.
+	Stream bool `json:"stream,omitempty"`
+}
+
+type sendMessageResult struct {
+	Content string `json:"content"`
+	// Queued is set when the message joined the session's run in
+	// progress, see agent.Enqueue; the reply arrives as events
+	Queued bool `json:"queued,omitempty"`
+}
+
+// sendMessage runs a turn and answers with the reply once it is complete.
+// What happens meanwhile is sent as event notifications. While the session
+// is running, the message is queued for that run instead.
+func (c *conn) sendMessage(p sendMessageParams) (*sendMessageResult, error) {
+	if strings.TrimSpace(p.Content) == "" && len(p.Images) == 0 {
+		return nil, &Error{CodeInvalidParams, "content is required"}
+	}
+	session, err := c.session(p.SessionID)
+	if err != nil {
+		return nil, err
+	}
+	c.watch(session.ID)
+
+	parts := make([]models.ContentPart, len(p.Images))
+	for i, image := range p.Images {
+		parts[i] = image
+	}
+	ctx, ok := c.startRun(session.ID)
+	if !ok {
+		if !p.Stream && c.server.agent.Enqueue(session.ID, p.Content, parts...) {
+			return &sendMessageResult{Queued: true}, nil
+		}
+		return nil, &Error{CodeInvalidRequest, fmt.Sprintf("session %s is already running", session.ID)}
+	}
+	defer c.endRun(session.ID)
+
+	var reply string
+	if p.Stream {
+		var chunks <-chan string
+		chunks, err = c.server.agent.Stream(ctx, session.ID, p.Content, parts...)
+		if err == nil {
+			var b strings.Builder
+			for chunk := range chunks {
+				b.WriteString(chunk)
+			}
+			reply = b.String()
+			err = ctx.Err()
+		}
+	} else {
+		reply, err = c.server.agent.Chat(ctx, session.ID, p.Content, parts...)
+	}
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, &Error{CodeCancelled, "cancelled"}
+		}
+		return nil, err
+	}
+	return &sendMessageResult{Content: reply}, nil
+}
+
+type cancelParams struct {
+	SessionID string `json:"session_id"`
+}
+
+type cancelResult struct {
+	// Cancelled is false when the session had no run to cancel
+	Cancelled bool `json:"cancelled"`
+}
+
+// cancel stops the session's run, whichever client started it, see
+// agent.Cancel
+func (c *conn) cancel(p cancelParams) (*cancelResult, error) {
+	return &cancelResult{Cancelled: c.server.agent.Cancel(p.SessionID)}, nil
+}
+
+type approveParams struct {
+	ID       string `json:"id"`
+	Approved bool   `json:"approved"`
+}
+
+func (c *conn) approve(p approveParams) (struct{}, error) {
+	if !c.server.approvals.Answer(p.ID, p.Approved) {
+		return struct{}{}, &Error{CodeInvalidParams, fmt.Sprintf("permission request %s is not pending", p.ID)}
+	}
+	return struct{}{}, nil
+}
+
+type answerParams struct {
+	ID     string `json:"id"`
+	Answer string `json:"answer"`
+}
+
+func (c *conn) answer(p answerParams) (struct{}, error) {
+	if !c.server.approvals.AnswerQuestion(p.ID, p.Answer) {
+		return struct{}{}, &Error{CodeInvalidParams, fmt.Sprintf("question %s is not pending", p.ID)}
+	}
+	return struct{}{}, nil
+}
+
+// session loads a session, with an invalid params error when it doesn't
+// exist
+func (c *conn) session(id string) (*models.Session, error) {
+	session, err := c.server.agent.Session(c.ctx, id)
+	if errors.Is(err, agent.ErrSessionNotFound) {
+		return nil, &Error{CodeInvalidParams, err.Error()}
+	}
+	return session, err
+}
+
+// startRun claims a session for a run, reporting false if one is running.
+// The returned context is cancelled by cancel.
+func (c *conn) startRun(sessionID string) (context.Context, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.running[sessionID]; ok {
+		return nil, false
+	}
+	ctx, cancel := context.WithCancel(c.ctx)
+	c.running[sessionID] = cancel
+	return ctx, true
+}
+
+func (c *conn) endRun(sessionID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if cancel, ok := c.running[sessionID]; ok {
+		cancel()
+		delete(c.running, sessionID)
+	}
+}
+
+// watch sends the session's events to the client from now on
+func (c *conn) watch(sessionID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.watching[sessionID]; !ok {
+		c.watching[sessionID] = c.subscribe(sessionID)
+	}
+}
+
+// subscribe forwards the session's events, of the types the client
+// handles, and counts the client as connected to the session for
+// approvals, until the returned function is called. The caller holds c.mu.
+func (c *conn) subscribe(sessionID string) func() {
+	ch, stop := c.server.bus.Subscribe(sessionID, eventBuffer, c.features.EventTypes()...)
+	remove := c.server.clients.Add(sessionID, c.features)
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			case e := <-ch:
+				c.write(notification{JSONRPC: "2.0", Method: "event", Params: e})
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		stop()
+		remove()
+	}
+}
+
+func (c *conn) reply(id json.RawMessage, result interface{}, err *Error) {
+	if id == nil {
+		id = json.RawMessage("null")
+	}
+	resp := response{JSONRPC: "2.0", ID: id, Error: err}
+	if err == nil {
+		data, marshalErr := json.Marshal(result)
+		if marshalErr != nil {
+			resp.Error = &Error{CodeInternalError, marshalErr.Error()}
+		} else {
+			resp.Result = data
+		}
+	}
+	c.write(resp)
+}
+
+// write sends one message on its own line. Writes from concurrent
+// handlers and subscriptions are serialized.
+func (c *conn) write(v interface{}) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	c.enc.Encode(v)
+}
+
+// decode reads params into v. Missing params leave v as it is.
+func decode(params json.RawMessage, v interface{}) error {
+	if len(params) == 0 || string(params) == "null" {
+		return nil
+	}
+	if err := json.Unmarshal(params, v); err != nil {
+		return &Error{CodeInvalidParams, fmt.Sprintf("invalid params: %v", err)}
+	}
+	return nil
+}
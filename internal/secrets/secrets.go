@@ -0,0 +1,338 @@
+// Package secrets keeps credentials out of requests to providers. Every
+// piece of text is run through a chain of scanners, and what they find is
+// masked or the request refused, depending on how far the provider is
+// trusted.
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/omnitrix-sh/core.sh/internal/redact"
+	"github.com/omnitrix-sh/core.sh/pkg/models"
+)
+
+// Policy is what happens to requests containing secrets
+type Policy string
+
+const (
+	PolicyRedact Policy = "redact" // mask them
+	PolicyBlock  Policy = "block"  // refuse to send the request
+	PolicyOff    Policy = "off"    // send the request unchanged
+)
+
+const (
+	commandTimeout = 30 * time.Second
+	// maxCached is how many scanned texts the external scanner's results
+	// are kept for, since history is resent with every request
+	maxCached = 4096
+)
+
+// ErrBlocked is returned for requests refused under the block policy
+var ErrBlocked = errors.New("request contains secrets")
+
+// Scanner finds secrets in text
+type Scanner interface {
+	Scan(ctx context.Context, text string) ([]redact.Finding, error)
+}
+
+// PatternScanner finds secrets with regular expressions
+type PatternScanner struct {
+	redactor *redact.Redactor
+}
+
+// NewPatternScanner creates a scanner from rules, or redact.DefaultRules
+// if none
+func NewPatternScanner(rules ...redact.Rule) *PatternScanner {
+	return &PatternScanner{redactor: redact.New(rules...)}
+}
+
+func (s *PatternScanner) Scan(ctx context.Context, text string) ([]redact.Finding, error) {
+	return s.redactor.Find(text), nil
+}
+
+// CommandScanner runs an external scanner such as gitleaks with the text on
+// stdin. It understands gitleaks' JSON report; any other output is read as
+// one secret per line. Results are cached by text.
+type CommandScanner struct {
+	command []string
+
+	mu    sync.Mutex
+	cache map[[sha256.Size]byte][]string
+}
+
+// NewCommandScanner creates a scanner running command
+func NewCommandScanner(command []string) *CommandScanner {
+	return &CommandScanner{
+		command: command,
+		cache:   make(map[[sha256.Size]byte][]string),
+	}
+}
+
+func (s *CommandScanner) Scan(ctx context.Context, text string) ([]redact.Finding, error) {
+	if strings.TrimSpace(text) == "" {
+		return nil, nil
+	}
+
+	key := sha256.Sum256([]byte(text))
+	s.mu.Lock()
+	found, ok := s.cache[key]
+	s.mu.Unlock()
+	if !ok {
+		var err error
+		found, err = s.run(ctx, text)
+		if err != nil {
+			return nil, err
+		}
+		s.mu.Lock()
+		if len(s.cache) >= maxCached {
+			s.cache = make(map[[sha256.Size]byte][]string)
+		}
+		s.cache[key] = found
+		s.mu.Unlock()
+	}
+
+	var findings []redact.Finding
+	for _, secret := range found {
+		for start := 0; ; {
+			i := strings.Index(text[start:], secret)
+			if i < 0 {
+				break
+			}
+			findings = append(findings, redact.Finding{Rule: "scanner", Start: start + i, End: start + i + len(secret)})
+			start += i + len(secret)
+		}
+	}
+	return findings, nil
+}
+
+// run returns the secrets the command reports in text. Scanners such as
+// gitleaks exit non-zero when they find something, so the exit code only
+// matters when nothing was printed.
+func (s *CommandScanner) run(ctx context.Context, text string) ([]string, error) {
+	ctx, cancel := context.WithTimeout(ctx, commandTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, s.command[0], s.command[1:]...)
+	cmd.Stdin = strings.NewReader(text)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+
+	output := bytes.TrimSpace(stdout.Bytes())
+	if len(output) == 0 {
+		if err != nil {
+			return nil, fmt.Errorf("secret scanner %s failed: %w: %s", s.command[0], err, strings.TrimSpace(stderr.String()))
+		}
+		return nil, nil
+	}
+
+	var report []struct {
+		Secret string `json:"Secret"`
+	}
+	if json.Unmarshal(output, &report) == nil {
+		var secrets []string
+		for _, r := range report {
+			if r.Secret != "" {
+				secrets = append(secrets, r.Secret)
+			}
+		}
+		return secrets, nil
+	}
+
+	var secrets []string
+	for _, line := range strings.Split(string(output), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			secrets = append(secrets, line)
+		}
+	}
+	return secrets, nil
+}
+
+// Guard applies the secrets policy to requests
+type Guard struct {
+	scanners  []Scanner
+	policy    Policy
+	providers map[string]Policy
+
+	// Findings let through, see SecretsConfig.Allow
+	allowRules  map[string]bool
+	allowValues []*regexp.Regexp
+}
+
+// New creates a Guard from config. It returns nil when the policy is off
+// for every provider; a nil Guard lets every request through.
+func New(cfg models.SecretsConfig) (*Guard, error) {
+	g := &Guard{
+		policy:    PolicyRedact,
+		providers: map[string]Policy{string(models.ProviderOllama): PolicyOff},
+	}
+	if cfg.Policy != "" {
+		policy, err := parsePolicy(cfg.Policy)
+		if err != nil {
+			return nil, err
+		}
+		g.policy = policy
+	}
+	for provider, value := range cfg.Providers {
+		policy, err := parsePolicy(value)
+		if err != nil {
+			return nil, fmt.Errorf("provider %q: %w", provider, err)
+		}
+		g.providers[provider] = policy
+	}
+
+	enabled := g.policy != PolicyOff
+	for _, policy := range g.providers {
+		enabled = enabled || policy != PolicyOff
+	}
+	if !enabled {
+		return nil, nil
+	}
+
+	rules, err := redact.WithPatterns(cfg.Patterns)
+	if err != nil {
+		return nil, err
+	}
+	g.scanners = append(g.scanners, NewPatternScanner(rules...))
+	if len(cfg.Command) > 0 {
+		g.scanners = append(g.scanners, NewCommandScanner(cfg.Command))
+	}
+
+	names := map[string]bool{"scanner": true}
+	for _, rule := range rules {
+		names[rule.Name] = true
+	}
+	g.allowRules = make(map[string]bool)
+	for _, allow := range cfg.Allow {
+		if names[allow] {
+			g.allowRules[allow] = true
+			continue
+		}
+		re, err := regexp.Compile("^(?:" + allow + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("invalid secrets allow pattern %q: %w", allow, err)
+		}
+		g.allowValues = append(g.allowValues, re)
+	}
+	return g, nil
+}
+
+func parsePolicy(value string) (Policy, error) {
+	switch Policy(value) {
+	case PolicyRedact, PolicyBlock, PolicyOff:
+		return Policy(value), nil
+	}
+	return "", fmt.Errorf("invalid secrets policy %q, expected redact, block or off", value)
+}
+
+// PolicyFor returns the policy for requests to provider
+func (g *Guard) PolicyFor(provider string) Policy {
+	if g == nil {
+		return PolicyOff
+	}
+	if policy, ok := g.providers[provider]; ok {
+		return policy
+	}
+	return g.policy
+}
+
+// Check scans a request to provider. Under the redact policy secrets are
+// replaced with [REDACTED:<rule>] markers in req; under the block policy
+// an error wrapping ErrBlocked names the kinds found. A scanner that fails
+// fails the request, so secrets are never sent because a scan didn't run.
+func (g *Guard) Check(ctx context.Context, provider string, req *models.ChatRequest) error {
+	policy := g.PolicyFor(provider)
+	if policy == PolicyOff {
+		return nil
+	}
+
+	var scanErr error
+	found := make(map[string]bool)
+	redacted := req.MapText(func(text string) string {
+		if scanErr != nil || text == "" {
+			return text
+		}
+		var findings []redact.Finding
+		for _, scanner := range g.scanners {
+			result, err := scanner.Scan(ctx, text)
+			if err != nil {
+				scanErr = err
+				return text
+			}
+			for _, f := range result {
+				if !g.allowed(f, text) {
+					findings = append(findings, f)
+				}
+			}
+		}
+		for _, f := range findings {
+			found[f.Rule] = true
+		}
+		return mask(text, findings)
+	})
+	if scanErr != nil {
+		return scanErr
+	}
+	if len(found) == 0 {
+		return nil
+	}
+
+	if policy == PolicyBlock {
+		rules := make([]string, 0, len(found))
+		for rule := range found {
+			rules = append(rules, rule)
+		}
+		sort.Strings(rules)
+		return fmt.Errorf("%w (%s); not sent to %s", ErrBlocked, strings.Join(rules, ", "), provider)
+	}
+	*req = redacted
+	return nil
+}
+
+// allowed reports whether a finding in text is let through by the allowlist
+func (g *Guard) allowed(f redact.Finding, text string) bool {
+	if g.allowRules[f.Rule] {
+		return true
+	}
+	for _, re := range g.allowValues {
+		if re.MatchString(text[f.Start:f.End]) {
+			return true
+		}
+	}
+	return false
+}
+
+// mask replaces findings in text, keeping the first of overlapping ones
+func mask(text string, findings []redact.Finding) string {
+	if len(findings) == 0 {
+		return text
+	}
+	sort.SliceStable(findings, func(i, j int) bool {
+		return findings[i].Start < findings[j].Start
+	})
+
+	var out strings.Builder
+	last := 0
+	for _, f := range findings {
+		if f.Start < last {
+			continue
+		}
+		out.WriteString(text[last:f.Start])
+		out.WriteString("[REDACTED:" + f.Rule + "]")
+		last = f.End
+	}
+	out.WriteString(text[last:])
+	return out.String()
+}
@@ -0,0 +1,53 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/omnitrix-sh/core.sh/internal/permissions"
+)
+
+// Approver returns the approver to give the agent, see
+// agent.SetPermissions. Each request is published on the event stream, to
+// clients handling approval, and waits for one of them to answer it with
+// POST /approvals/{id}. Questions from the model are answered the same way
+// with POST /questions/{id}. While no client on the session's event stream
+// handles approval, requests are denied and questions left unanswered
+// right away.
+func (s *Server) Approver() permissions.Approver {
+	return s.clients.Approver(s.approvals)
+}
+
+type approvalRequest struct {
+	Approved bool `json:"approved"`
+}
+
+func (s *Server) answerApproval(w http.ResponseWriter, r *http.Request) {
+	var req approvalRequest
+	if !decode(w, r, &req) {
+		return
+	}
+	id := r.PathValue("id")
+	if !s.approvals.Answer(id, req.Approved) {
+		writeError(w, http.StatusNotFound, fmt.Errorf("permission request %s is not pending", id))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type questionAnswer struct {
+	Answer string `json:"answer"`
+}
+
+func (s *Server) answerQuestion(w http.ResponseWriter, r *http.Request) {
+	var req questionAnswer
+	if !decode(w, r, &req) {
+		return
+	}
+	id := r.PathValue("id")
+	if !s.approvals.AnswerQuestion(id, req.Answer) {
+		writeError(w, http.StatusNotFound, fmt.Errorf("question %s is not pending", id))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
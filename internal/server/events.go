@@ -0,0 +1,110 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/omnitrix-sh/core.sh/internal/handshake"
+)
+
+const (
+	// eventBuffer is how many events a slow client can fall behind before
+	// it misses some; it can catch up on messages with GET .../messages
+	eventBuffer = 1024
+	// keepAliveInterval is how often an idle event stream sends a comment,
+	// so proxies don't close it
+	keepAliveInterval = 15 * time.Second
+)
+
+// streamEvents sends the session's events as server-sent events until the
+// client goes away. The first event is the handshake's welcome. Clients
+// give their protocol version and the features they handle in the
+// version and features query parameters, the latter comma-separated, and
+// only get the events they handle: deltas need streaming, status events
+// status and permission requests approval.
+func (s *Server) streamEvents(w http.ResponseWriter, r *http.Request) {
+	session, ok := s.session(w, r)
+	if !ok {
+		return
+	}
+	hello, err := helloFromQuery(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	features, welcome, err := handshake.Negotiate(hello, s.opts.Name)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, errors.New("streaming is not supported"))
+		return
+	}
+
+	ch, stop := s.bus.Subscribe(session.ID, eventBuffer, features.EventTypes()...)
+	defer stop()
+	defer s.clients.Add(session.ID, features)()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	if err := writeEvent(w, 0, "welcome", welcome); err != nil {
+		return
+	}
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(keepAliveInterval)
+	defer keepAlive.Stop()
+	for id := 1; ; id++ {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+		case e := <-ch:
+			if err := writeEvent(w, id, string(e.Type), e); err != nil {
+				return
+			}
+		}
+		flusher.Flush()
+	}
+}
+
+// helloFromQuery reads the handshake from the query parameters. Clients
+// that leave out the version speak the current one.
+func helloFromQuery(r *http.Request) (handshake.Hello, error) {
+	query := r.URL.Query()
+	hello := handshake.Hello{ProtocolVersion: handshake.ProtocolVersion, Client: query.Get("client")}
+	if version := query.Get("version"); version != "" {
+		n, err := strconv.Atoi(version)
+		if err != nil {
+			return hello, fmt.Errorf("invalid version: %q", version)
+		}
+		hello.ProtocolVersion = n
+	}
+	for _, feature := range strings.Split(query.Get("features"), ",") {
+		if feature = strings.TrimSpace(feature); feature != "" {
+			hello.Features = append(hello.Features, handshake.Feature(feature))
+		}
+	}
+	return hello, nil
+}
+
+func writeEvent(w http.ResponseWriter, id int, name string, data interface{}) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", id, name, payload)
+	return err
+}
@@ -0,0 +1,461 @@
+// Package server serves sessions and chat over HTTP, so frontends other
+// than the terminal can drive the agent: a REST API for sessions and
+// messages, and server-sent events for what runs do as they happen.
+//
+//	GET  /version                    the running build, see version.Info
+//	GET  /update                     whether a newer release is out, see
+//	                                 update.Status
+//	POST /handshake                  negotiate features, see handshake.Hello
+//	POST /sessions                   create a session
+//	GET  /sessions                   list sessions, newest first
+//	GET  /sessions/{id}              get a session
+//	GET  /sessions/{id}/messages     page through a session's messages
+//	POST /sessions/{id}/messages     send a message and wait for the reply,
+//	                                 or queue it while the session runs
+//	POST /sessions/{id}/cancel       stop the session's run
+//	GET  /sessions/{id}/events       stream the session's events (SSE)
+//	POST /approvals/{id}             answer a permission request
+//	POST /questions/{id}             answer a question from the model
+//
+// With a token set every request must carry it as a bearer token. Requests
+// for other hosts than localhost, the loopback addresses and Options.Hosts
+// are refused, as are request bodies that aren't application/json, so web
+// pages the user opens can't drive the server.
+package server
+
+import (
+	"context"
+	"crypto/subtle"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/omnitrix-sh/core.sh/internal/agent"
+	"github.com/omnitrix-sh/core.sh/internal/events"
+	"github.com/omnitrix-sh/core.sh/internal/handshake"
+	"github.com/omnitrix-sh/core.sh/internal/permissions"
+	"github.com/omnitrix-sh/core.sh/internal/tlsutil"
+	"github.com/omnitrix-sh/core.sh/internal/update"
+	"github.com/omnitrix-sh/core.sh/internal/version"
+	"github.com/omnitrix-sh/core.sh/pkg/models"
+)
+
+const (
+	// DefaultAddr is where the server listens unless configured otherwise
+	DefaultAddr = "127.0.0.1:7433"
+
+	defaultSessionLimit = 50
+	maxSessionLimit     = 500
+	// maxBodySize bounds request bodies, which may carry images
+	maxBodySize = 32 << 20
+	// shutdownTimeout is how long running requests get to finish when the
+	// server stops
+	shutdownTimeout = 10 * time.Second
+)
+
+// approvalTimeout is how long a permission request waits for a client to
+// answer before it counts as declined
+const approvalTimeout = 5 * time.Minute
+
+// Options describe what the server runs
+type Options struct {
+	// Name is the server's name and version, sent in the handshake
+	Name string
+	// Token, when set, must be sent with every request as
+	// "Authorization: Bearer <token>"
+	Token string
+	// Hosts are the names the server is reached by, accepted in the Host
+	// header besides localhost and the loopback addresses. Other hosts are
+	// refused so web pages can't reach the server by DNS rebinding.
+	Hosts []string
+	// Updater checks for new releases; without it /update is not found
+	Updater *update.Updater
+}
+
+// Server serves an agent over HTTP. The agent must publish on the same bus
+// for the event stream to see its runs, and should ask Approver for
+// approvals.
+type Server struct {
+	agent     *agent.Agent
+	bus       *events.Bus
+	opts      Options
+	mux       *http.ServeMux
+	approvals *permissions.Pending
+	clients   *handshake.Clients // those on the event stream, see Approver
+
+	mu      sync.Mutex
+	running map[string]bool // session IDs with a run in progress
+}
+
+// New creates a server for the agent
+func New(a *agent.Agent, bus *events.Bus, opts Options) *Server {
+	s := &Server{
+		agent:     a,
+		bus:       bus,
+		opts:      opts,
+		mux:       http.NewServeMux(),
+		approvals: permissions.NewPending(approvalTimeout),
+		clients:   handshake.NewClients(),
+		running:   make(map[string]bool),
+	}
+	s.mux.HandleFunc("GET /version", s.version)
+	s.mux.HandleFunc("GET /update", s.checkUpdate)
+	s.mux.HandleFunc("POST /handshake", s.handshake)
+	s.mux.HandleFunc("POST /sessions", s.createSession)
+	s.mux.HandleFunc("GET /sessions", s.listSessions)
+	s.mux.HandleFunc("GET /sessions/{id}", s.getSession)
+	s.mux.HandleFunc("GET /sessions/{id}/messages", s.listMessages)
+	s.mux.HandleFunc("POST /sessions/{id}/messages", s.sendMessage)
+	s.mux.HandleFunc("POST /sessions/{id}/cancel", s.cancelRun)
+	s.mux.HandleFunc("GET /sessions/{id}/events", s.streamEvents)
+	s.mux.HandleFunc("POST /approvals/{id}", s.answerApproval)
+	s.mux.HandleFunc("POST /questions/{id}", s.answerQuestion)
+	return s
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !s.allowedHost(r.Host) {
+		writeError(w, http.StatusForbidden, fmt.Errorf("host %s is not allowed", r.Host))
+		return
+	}
+	if s.opts.Token != "" {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(s.opts.Token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeError(w, http.StatusUnauthorized, errors.New("missing or wrong token"))
+			return
+		}
+	}
+	// Browsers send forms and text/plain across sites without asking, so
+	// bodies must be declared JSON
+	if r.ContentLength != 0 && r.Body != http.NoBody {
+		if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType != "application/json" {
+			writeError(w, http.StatusUnsupportedMediaType, errors.New("request bodies must be application/json"))
+			return
+		}
+	}
+	s.mux.ServeHTTP(w, r)
+}
+
+// allowedHost reports whether the server may be reached by host, the
+// request's Host header
+func (s *Server) allowedHost(host string) bool {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.TrimSuffix(strings.Trim(host, "[]"), ".")
+	if strings.EqualFold(host, "localhost") {
+		return true
+	}
+	if ip := net.ParseIP(host); ip != nil && ip.IsLoopback() {
+		return true
+	}
+	for _, allowed := range s.opts.Hosts {
+		if strings.EqualFold(host, allowed) {
+			return true
+		}
+	}
+	return false
+}
+
+// Listen opens the configured address, with TLS when configured. Without
+// TLS only loopback addresses are allowed. It returns the fingerprint of
+// the certificate for clients to pin, or "" without TLS.
+func Listen(cfg models.ServerConfig, dataDir string) (net.Listener, string, error) {
+	addr := cfg.Addr
+	if addr == "" {
+		addr = DefaultAddr
+	}
+	tlsConfig, fingerprint, err := tlsutil.ServerConfig(cfg.TLS, dataDir)
+	if err != nil {
+		return nil, "", err
+	}
+	if tlsConfig == nil {
+		if err := tlsutil.CheckPlainAddr(addr); err != nil {
+			return nil, "", err
+		}
+	}
+
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to listen on %s: %w", addr, err)
+	}
+	if tlsConfig != nil {
+		ln = tls.NewListener(ln, tlsConfig)
+	}
+	return ln, fingerprint, nil
+}
+
+// Serve handles connections on ln until ctx is done, then lets running
+// requests finish
+func (s *Server) Serve(ctx context.Context, ln net.Listener) error {
+	srv := &http.Server{
+		Handler:           s,
+		ReadHeaderTimeout: 10 * time.Second,
+		BaseContext:       func(net.Listener) context.Context { return ctx },
+	}
+	done := make(chan error, 1)
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		done <- srv.Shutdown(shutdownCtx)
+	}()
+
+	if err := srv.Serve(ln); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return <-done
+}
+
+func (s *Server) version(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, version.Get())
+}
+
+func (s *Server) checkUpdate(w http.ResponseWriter, r *http.Request) {
+	if s.opts.Updater == nil {
+		writeError(w, http.StatusNotFound, errors.New("update checks are not enabled"))
+		return
+	}
+	status, err := s.opts.Updater.Check(r.Context())
+	if err != nil {
+		writeError(w, http.StatusBadGateway, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, status)
+}
+
+func (s *Server) handshake(w http.ResponseWriter, r *http.Request) {
+	var hello handshake.Hello
+	if !decode(w, r, &hello) {
+		return
+	}
+	_, welcome, err := handshake.Negotiate(hello, s.opts.Name)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, welcome)
+}
+
+type createSessionRequest struct {
+	Title string `json:"title"`
+}
+
+func (s *Server) createSession(w http.ResponseWriter, r *http.Request) {
+	var req createSessionRequest
+	if !decode(w, r, &req) {
+		return
+	}
+	session, err := s.agent.CreateSession(r.Context(), strings.TrimSpace(req.Title))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, session)
+}
+
+func (s *Server) listSessions(w http.ResponseWriter, r *http.Request) {
+	limit, ok := intParam(w, r, "limit", defaultSessionLimit)
+	if !ok {
+		return
+	}
+	offset, ok := intParam(w, r, "offset", 0)
+	if !ok {
+		return
+	}
+	sessions, err := s.agent.ListSessions(r.Context(), min(max(limit, 1), maxSessionLimit), max(offset, 0))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, sessions)
+}
+
+func (s *Server) getSession(w http.ResponseWriter, r *http.Request) {
+	session, ok := s.session(w, r)
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, session)
+}
+
+func (s *Server) listMessages(w http.ResponseWriter, r *http.Request) {
+	if _, ok := s.session(w, r); !ok {
+		return
+	}
+	limit, ok := intParam(w, r, "limit", 0)
+	if !ok {
+		return
+	}
+	page, err := s.agent.Messages(r.Context(), r.PathValue("id"), r.URL.Query().Get("before"), limit)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, page)
+}
+
+type sendMessageRequest struct {
+	Content string             `json:"content"`
+	Images  []models.ImagePart `json:"images,omitempty"`
+	// Stream publishes the reply as delta events while it arrives. Tools
+	// are only run without it.
+	Stream bool `json:"stream,omitempty"`
+}
+
+type sendMessageResponse struct {
+	Content string `json:"content"`
+	// Queued is set when the message joined the session's run in
+	// progress, see agent.Enqueue; the reply arrives as events
+	Queued bool `json:"queued,omitempty"`
+}
+
+// sendMessage runs a turn and answers with the reply once it is complete.
+// What happens meanwhile is published on the session's event stream. While
+// the session is running, the message is queued for that run instead.
+func (s *Server) sendMessage(w http.ResponseWriter, r *http.Request) {
+	var req sendMessageRequest
+	if !decode(w, r, &req) {
+		return
+	}
+	if strings.TrimSpace(req.Content) == "" && len(req.Images) == 0 {
+		writeError(w, http.StatusBadRequest, errors.New("content is required"))
+		return
+	}
+	session, ok := s.session(w, r)
+	if !ok {
+		return
+	}
+	parts := make([]models.ContentPart, len(req.Images))
+	for i, image := range req.Images {
+		parts[i] = image
+	}
+	if !s.startRun(session.ID) {
+		if !req.Stream && s.agent.Enqueue(session.ID, req.Content, parts...) {
+			writeJSON(w, http.StatusAccepted, sendMessageResponse{Queued: true})
+			return
+		}
+		writeError(w, http.StatusConflict, fmt.Errorf("session %s is already running", session.ID))
+		return
+	}
+	defer s.endRun(session.ID)
+
+	var reply string
+	var err error
+	if req.Stream {
+		var chunks <-chan string
+		chunks, err = s.agent.Stream(r.Context(), session.ID, req.Content, parts...)
+		if err == nil {
+			var b strings.Builder
+			for chunk := range chunks {
+				b.WriteString(chunk)
+			}
+			reply = b.String()
+			err = r.Context().Err()
+		}
+	} else {
+		reply, err = s.agent.Chat(r.Context(), session.ID, req.Content, parts...)
+	}
+	if err != nil {
+		writeError(w, http.StatusBadGateway, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, sendMessageResponse{Content: reply})
+}
+
+type cancelResponse struct {
+	// Cancelled is false when the session had no run to cancel
+	Cancelled bool `json:"cancelled"`
+}
+
+// cancelRun stops the session's run, see agent.Cancel. The request that
+// started it fails once the session is cleaned up.
+func (s *Server) cancelRun(w http.ResponseWriter, r *http.Request) {
+	session, ok := s.session(w, r)
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, cancelResponse{Cancelled: s.agent.Cancel(session.ID)})
+}
+
+// startRun claims a session for a run, reporting false if one is running
+func (s *Server) startRun(sessionID string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.running[sessionID] {
+		return false
+	}
+	s.running[sessionID] = true
+	return true
+}
+
+func (s *Server) endRun(sessionID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.running, sessionID)
+}
+
+// session loads the session named in the path, answering 404 when it
+// doesn't exist
+func (s *Server) session(w http.ResponseWriter, r *http.Request) (*models.Session, bool) {
+	session, err := s.agent.Session(r.Context(), r.PathValue("id"))
+	if errors.Is(err, agent.ErrSessionNotFound) {
+		writeError(w, http.StatusNotFound, err)
+		return nil, false
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return nil, false
+	}
+	return session, true
+}
+
+// decode reads a JSON request body into v, answering 400 when it can't. An
+// empty body leaves v as it is.
+func decode(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodySize)).Decode(v)
+	if err != nil && !errors.Is(err, io.EOF) {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid request body: %w", err))
+		return false
+	}
+	return true
+}
+
+// intParam reads an integer query parameter, answering 400 when it isn't
+// one
+func intParam(w http.ResponseWriter, r *http.Request, name string, def int) (int, bool) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return def, true
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid %s: %q", name, value))
+		return 0, false
+	}
+	return n, true
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, errorResponse{Error: err.Error()})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
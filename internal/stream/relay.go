@@ -0,0 +1,212 @@
+package stream
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/omnitrix-sh/core.sh/pkg/models"
+)
+
+// Slow consumer policies
+const (
+	// PolicyBuffer keeps every delta until the consumer catches up
+	PolicyBuffer = "buffer"
+	// PolicyDrop discards the backlog once it passes MaxBacklog and tells
+	// the consumer how much was skipped
+	PolicyDrop = "drop"
+)
+
+const (
+	defaultBuffer     = 64
+	defaultMaxBacklog = 64 * 1024
+)
+
+// Options control how deltas are relayed to a consumer
+type Options struct {
+	// Buffer is the capacity of the output channel
+	Buffer int
+	// CoalesceBytes and CoalesceInterval merge small deltas: a delta
+	// shorter than CoalesceBytes waits up to CoalesceInterval for more
+	CoalesceBytes    int
+	CoalesceInterval time.Duration
+	// Policy is PolicyBuffer or PolicyDrop
+	Policy string
+	// MaxBacklog is the most text, in bytes, PolicyDrop holds back
+	MaxBacklog int
+}
+
+// OptionsFromConfig converts the stream settings, filling in defaults
+func OptionsFromConfig(cfg models.StreamConfig) (Options, error) {
+	opts := Options{
+		Buffer:           cfg.Buffer,
+		CoalesceBytes:    cfg.CoalesceBytes,
+		CoalesceInterval: time.Duration(cfg.CoalesceMS) * time.Millisecond,
+		Policy:           cfg.SlowConsumer,
+		MaxBacklog:       cfg.MaxBacklog,
+	}
+	if opts.Buffer <= 0 {
+		opts.Buffer = defaultBuffer
+	}
+	if opts.MaxBacklog <= 0 {
+		opts.MaxBacklog = defaultMaxBacklog
+	}
+	switch opts.Policy {
+	case "":
+		opts.Policy = PolicyBuffer
+	case PolicyBuffer, PolicyDrop:
+	default:
+		return opts, fmt.Errorf("invalid slow consumer policy: %s (use buffer or drop)", cfg.SlowConsumer)
+	}
+	return opts, nil
+}
+
+// Relay passes text deltas from a producer to a consumer without ever
+// blocking the producer, so a slow consumer cannot stall the read from the
+// provider until its connection times out. Deltas that pile up while the
+// consumer is busy are merged and sent as one.
+type Relay struct {
+	opts Options
+	out  chan string
+
+	mu      sync.Mutex
+	pending strings.Builder
+	since   time.Time // when the oldest pending delta arrived
+	skipped int       // characters dropped since the last delivery
+	closed  bool
+	wake    chan struct{}
+	done    chan struct{}
+}
+
+// NewRelay starts a relay. Its output closes after Close once the backlog
+// is delivered, or as soon as ctx is done.
+func NewRelay(ctx context.Context, opts Options) *Relay {
+	if opts.Buffer < 0 {
+		opts.Buffer = 0
+	}
+	r := &Relay{
+		opts: opts,
+		out:  make(chan string, opts.Buffer),
+		wake: make(chan struct{}, 1),
+		done: make(chan struct{}),
+	}
+	go r.run(ctx)
+	return r
+}
+
+// Out returns the channel deltas are delivered on
+func (r *Relay) Out() <-chan string {
+	return r.out
+}
+
+// Done is closed once the output is, after Close when the backlog is
+// delivered or when ctx is done
+func (r *Relay) Done() <-chan struct{} {
+	return r.done
+}
+
+// Send queues a delta. It never blocks.
+func (r *Relay) Send(delta string) {
+	if delta == "" {
+		return
+	}
+
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return
+	}
+	if r.pending.Len() == 0 {
+		r.since = time.Now()
+	}
+	r.pending.WriteString(delta)
+	if r.opts.Policy == PolicyDrop && r.pending.Len() > r.opts.MaxBacklog {
+		r.skipped += utf8.RuneCountInString(r.pending.String())
+		r.pending.Reset()
+	}
+	r.mu.Unlock()
+
+	r.notify()
+}
+
+// Close ends the stream once the queued deltas are delivered
+func (r *Relay) Close() {
+	r.mu.Lock()
+	r.closed = true
+	r.mu.Unlock()
+	r.notify()
+}
+
+func (r *Relay) notify() {
+	select {
+	case r.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (r *Relay) run(ctx context.Context) {
+	defer close(r.done)
+	defer close(r.out)
+
+	for {
+		select {
+		case <-r.wake:
+		case <-ctx.Done():
+			return
+		}
+
+		for {
+			delta, wait, done := r.take()
+			if wait > 0 {
+				// Give a short delta a moment to grow before sending it
+				select {
+				case <-time.After(wait):
+				case <-ctx.Done():
+					return
+				}
+				continue
+			}
+			if delta != "" {
+				select {
+				case r.out <- delta:
+				case <-ctx.Done():
+					return
+				}
+				continue
+			}
+			if done {
+				return
+			}
+			break
+		}
+	}
+}
+
+// take removes the pending text for delivery. It returns how long to wait
+// first instead if the text is short and fresh, and whether the relay is
+// finished.
+func (r *Relay) take() (string, time.Duration, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.pending.Len() == 0 && r.skipped == 0 {
+		return "", 0, r.closed
+	}
+
+	if !r.closed && r.skipped == 0 && r.pending.Len() < r.opts.CoalesceBytes {
+		if wait := r.opts.CoalesceInterval - time.Since(r.since); wait > 0 {
+			return "", wait, false
+		}
+	}
+
+	delta := r.pending.String()
+	if r.skipped > 0 {
+		delta = fmt.Sprintf("\n[%d characters skipped, the full response is saved in the session]\n", r.skipped) + delta
+		r.skipped = 0
+	}
+	r.pending.Reset()
+	return delta, 0, false
+}
@@ -0,0 +1,248 @@
+package symbols
+
+import (
+	"bufio"
+	"bytes"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+type parseFunc func(path string, content []byte) []Symbol
+
+// parserFor returns the symbol extractor for a file, or nil if the file's
+// language is not indexed
+func parserFor(path string) parseFunc {
+	ext := strings.ToLower(filepath.Ext(path))
+	if ext == ".go" {
+		return parseGo
+	}
+	if rules, ok := languageRules[ext]; ok {
+		return func(p string, content []byte) []Symbol {
+			return parseWithRules(p, content, rules)
+		}
+	}
+	return nil
+}
+
+// parseGo extracts declarations using the Go parser
+func parseGo(path string, content []byte) []Symbol {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, path, content, parser.SkipObjectResolution)
+	if err != nil && file == nil {
+		return nil
+	}
+
+	source := func(from, to token.Pos) string {
+		start, end := fset.Position(from).Offset, fset.Position(to).Offset
+		if start < 0 || end > len(content) || start >= end {
+			return ""
+		}
+		return strings.Join(strings.Fields(string(content[start:end])), " ")
+	}
+
+	var syms []Symbol
+	for _, decl := range file.Decls {
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			sym := Symbol{
+				Name:      d.Name.Name,
+				Kind:      KindFunc,
+				Path:      path,
+				Line:      fset.Position(d.Pos()).Line,
+				Signature: source(d.Pos(), d.Type.End()),
+				Exported:  d.Name.IsExported(),
+			}
+			if d.Recv != nil && len(d.Recv.List) > 0 {
+				sym.Kind = KindMethod
+				sym.Container = receiverName(d.Recv.List[0].Type)
+			}
+			syms = append(syms, sym)
+
+		case *ast.GenDecl:
+			for _, spec := range d.Specs {
+				switch s := spec.(type) {
+				case *ast.TypeSpec:
+					sym := Symbol{
+						Name:     s.Name.Name,
+						Kind:     KindType,
+						Path:     path,
+						Line:     fset.Position(s.Pos()).Line,
+						Exported: s.Name.IsExported(),
+					}
+					switch t := s.Type.(type) {
+					case *ast.StructType:
+						sym.Kind = KindStruct
+						sym.Signature = "type " + s.Name.Name + " struct"
+					case *ast.InterfaceType:
+						sym.Kind = KindInterface
+						sym.Signature = "type " + s.Name.Name + " interface"
+						for _, m := range t.Methods.List {
+							for _, n := range m.Names {
+								sym.Methods = append(sym.Methods, n.Name)
+							}
+						}
+					default:
+						sym.Signature = source(s.Pos(), s.End())
+					}
+					syms = append(syms, sym)
+
+				case *ast.ValueSpec:
+					kind := KindVar
+					if d.Tok == token.CONST {
+						kind = KindConst
+					}
+					for _, n := range s.Names {
+						if n.Name == "_" {
+							continue
+						}
+						syms = append(syms, Symbol{
+							Name:     n.Name,
+							Kind:     kind,
+							Path:     path,
+							Line:     fset.Position(n.Pos()).Line,
+							Exported: n.IsExported(),
+						})
+					}
+				}
+			}
+		}
+	}
+	return syms
+}
+
+func receiverName(expr ast.Expr) string {
+	switch t := expr.(type) {
+	case *ast.StarExpr:
+		return receiverName(t.X)
+	case *ast.IndexExpr:
+		return receiverName(t.X)
+	case *ast.IndexListExpr:
+		return receiverName(t.X)
+	case *ast.Ident:
+		return t.Name
+	}
+	return ""
+}
+
+// rule matches a single-line definition; the first capture group is the name
+type rule struct {
+	kind    Kind
+	pattern *regexp.Regexp
+}
+
+var (
+	pythonRules = []rule{
+		{KindClass, regexp.MustCompile(`^\s*class\s+(\w+)`)},
+		{KindFunc, regexp.MustCompile(`^\s*(?:async\s+)?def\s+(\w+)`)},
+	}
+	jsRules = []rule{
+		{KindClass, regexp.MustCompile(`^\s*(?:export\s+)?(?:default\s+)?(?:abstract\s+)?class\s+(\w+)`)},
+		{KindInterface, regexp.MustCompile(`^\s*(?:export\s+)?interface\s+(\w+)`)},
+		{KindType, regexp.MustCompile(`^\s*(?:export\s+)?type\s+(\w+)\s*(?:<[^=]*>)?\s*=`)},
+		{KindFunc, regexp.MustCompile(`^\s*(?:export\s+)?(?:default\s+)?(?:async\s+)?function\*?\s+(\w+)`)},
+		{KindFunc, regexp.MustCompile(`^\s*(?:export\s+)?(?:const|let|var)\s+(\w+)\s*(?::[^=]+)?=\s*(?:async\s+)?(?:\([^)]*\)|\w+)\s*(?::[^=]+)?=>`)},
+	}
+	rustRules = []rule{
+		{KindStruct, regexp.MustCompile(`^\s*(?:pub(?:\([^)]*\))?\s+)?struct\s+(\w+)`)},
+		{KindType, regexp.MustCompile(`^\s*(?:pub(?:\([^)]*\))?\s+)?enum\s+(\w+)`)},
+		{KindInterface, regexp.MustCompile(`^\s*(?:pub(?:\([^)]*\))?\s+)?trait\s+(\w+)`)},
+		{KindFunc, regexp.MustCompile(`^\s*(?:pub(?:\([^)]*\))?\s+)?(?:const\s+)?(?:async\s+)?(?:unsafe\s+)?fn\s+(\w+)`)},
+	}
+	javaRules = []rule{
+		{KindInterface, regexp.MustCompile(`^\s*(?:(?:public|private|protected|internal|static|abstract|sealed|partial)\s+)*interface\s+(\w+)`)},
+		{KindClass, regexp.MustCompile(`^\s*(?:(?:public|private|protected|internal|static|abstract|final|sealed|partial|data|open)\s+)*(?:class|record|enum|object)\s+(\w+)`)},
+	}
+	rubyRules = []rule{
+		{KindClass, regexp.MustCompile(`^\s*(?:class|module)\s+([A-Z]\w*)`)},
+		{KindFunc, regexp.MustCompile(`^\s*def\s+(?:self\.)?(\w+[?!]?)`)},
+	}
+)
+
+// languageRules are the patterns for the languages other than Go. There is
+// no real parser for them, tree-sitter or otherwise, so declarations split
+// over several lines are missed, and matches in comments or strings and
+// classes attributed by indentation alone can be wrong.
+var languageRules = map[string][]rule{
+	".py":   pythonRules,
+	".js":   jsRules,
+	".jsx":  jsRules,
+	".mjs":  jsRules,
+	".ts":   jsRules,
+	".tsx":  jsRules,
+	".rs":   rustRules,
+	".java": javaRules,
+	".kt":   javaRules,
+	".cs":   javaRules,
+	".rb":   rubyRules,
+}
+
+// parseWithRules is a ctags-style extractor: it matches definitions line by
+// line and uses indentation to attribute functions to enclosing classes
+func parseWithRules(path string, content []byte, rules []rule) []Symbol {
+	type scope struct {
+		name   string
+		indent int
+	}
+	var classes []scope
+	var syms []Symbol
+
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	scanner.Buffer(make([]byte, 0, 64*1024), maxIndexedFileSize)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := scanner.Text()
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "//") || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+
+		indent := len(line) - len(strings.TrimLeftFunc(line, unicode.IsSpace))
+		for len(classes) > 0 && indent <= classes[len(classes)-1].indent {
+			classes = classes[:len(classes)-1]
+		}
+
+		for _, r := range rules {
+			m := r.pattern.FindStringSubmatch(line)
+			if m == nil {
+				continue
+			}
+
+			sym := Symbol{
+				Name:      m[1],
+				Kind:      r.kind,
+				Path:      path,
+				Line:      lineNum,
+				Signature: strings.TrimRight(trimmed, " {:"),
+				Exported:  isExported(path, m[1], trimmed),
+			}
+			if r.kind == KindFunc && len(classes) > 0 {
+				sym.Kind = KindMethod
+				sym.Container = classes[len(classes)-1].name
+			}
+			if r.kind == KindClass || r.kind == KindInterface || r.kind == KindStruct {
+				classes = append(classes, scope{name: m[1], indent: indent})
+			}
+			syms = append(syms, sym)
+			break
+		}
+	}
+	return syms
+}
+
+func isExported(path, name, line string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".py", ".rb":
+		return !strings.HasPrefix(name, "_")
+	case ".js", ".jsx", ".mjs", ".ts", ".tsx":
+		return strings.HasPrefix(line, "export")
+	case ".rs":
+		return strings.HasPrefix(line, "pub")
+	}
+	return !strings.Contains(line, "private ")
+}
@@ -0,0 +1,211 @@
+package symbols
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+)
+
+// mapDir is a directory in the repo map
+type mapDir struct {
+	name     string
+	files    []*mapFile
+	exported int
+	expanded bool // files are listed
+}
+
+// mapFile is a file in the repo map
+type mapFile struct {
+	name, symbols string
+	exported      int
+	shown         bool // symbols are listed
+}
+
+// Map returns an outline of the indexed files: each directory with its
+// source files and their exported symbols, methods listed with their type.
+// The outline is kept within maxBytes. Directories are listed with their
+// number of files first, then with the names of their files, those with
+// the most exported symbols first; what room is left goes to the symbols
+// of the files with the most of them. It returns "" for an empty index.
+func (ix *Index) Map(maxBytes int) string {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+
+	if len(ix.files) == 0 {
+		return ""
+	}
+
+	byName := make(map[string]*mapDir)
+	var files []*mapFile
+	for rel, entry := range ix.files {
+		dirName, name := path.Split(rel)
+		dir, ok := byName[dirName]
+		if !ok {
+			dir = &mapDir{name: dirName}
+			byName[dirName] = dir
+		}
+		summary, exported := outline(entry.Symbols)
+		f := &mapFile{name: name, symbols: summary, exported: exported}
+		dir.files = append(dir.files, f)
+		dir.exported += exported
+		files = append(files, f)
+	}
+	dirs := make([]*mapDir, 0, len(byName))
+	for _, dir := range byName {
+		sort.Slice(dir.files, func(i, j int) bool {
+			return dir.files[i].name < dir.files[j].name
+		})
+		dirs = append(dirs, dir)
+	}
+	sort.Slice(dirs, func(i, j int) bool {
+		return dirs[i].name < dirs[j].name
+	})
+
+	size := 0
+	for _, dir := range dirs {
+		size += len(dirCount(dir.name, len(dir.files))) + 1
+	}
+	if size > maxBytes {
+		return dirSummary(dirs, maxBytes)
+	}
+
+	ranked := make([]*mapDir, len(dirs))
+	copy(ranked, dirs)
+	sort.SliceStable(ranked, func(i, j int) bool {
+		return ranked[i].exported > ranked[j].exported
+	})
+	for _, dir := range ranked {
+		extra := len(dirHeader(dir.name)) - len(dirCount(dir.name, len(dir.files)))
+		for _, f := range dir.files {
+			extra += len("\n  ") + len(f.name)
+		}
+		if size+extra <= maxBytes {
+			size += extra
+			dir.expanded = true
+		}
+	}
+
+	sort.SliceStable(files, func(i, j int) bool {
+		return files[i].exported > files[j].exported
+	})
+	for _, dir := range dirs {
+		if !dir.expanded {
+			for _, f := range dir.files {
+				f.symbols = ""
+			}
+		}
+	}
+	for _, f := range files {
+		if f.symbols == "" {
+			continue
+		}
+		if extra := len(": ") + len(f.symbols); size+extra <= maxBytes {
+			size += extra
+			f.shown = true
+		}
+	}
+
+	var sb strings.Builder
+	for _, dir := range dirs {
+		if !dir.expanded {
+			sb.WriteString(dirCount(dir.name, len(dir.files)))
+			sb.WriteString("\n")
+			continue
+		}
+		sb.WriteString(dirHeader(dir.name))
+		sb.WriteString("\n")
+		for _, f := range dir.files {
+			sb.WriteString("  ")
+			sb.WriteString(f.name)
+			if f.shown {
+				sb.WriteString(": ")
+				sb.WriteString(f.symbols)
+			}
+			sb.WriteString("\n")
+		}
+	}
+	return strings.TrimSuffix(sb.String(), "\n")
+}
+
+// outline lists a file's exported symbols in the order they are defined,
+// with the methods of a type in parentheses after it, and returns how
+// many there are
+func outline(syms []Symbol) (string, int) {
+	methods := make(map[string][]string)
+	defined := make(map[string]bool)
+	for _, sym := range syms {
+		switch {
+		case sym.Kind == KindMethod && sym.Container != "":
+			if sym.Exported {
+				methods[sym.Container] = append(methods[sym.Container], sym.Name)
+			}
+		case sym.Container == "":
+			defined[sym.Name] = true
+		}
+	}
+
+	var names []string
+	exported := 0
+	for _, sym := range syms {
+		if !sym.Exported {
+			continue
+		}
+		exported++
+		switch {
+		case sym.Kind == KindMethod && sym.Container != "":
+			// Methods of types defined in other files are listed on their
+			// own; those of unexported types here are left out
+			if !defined[sym.Container] {
+				names = append(names, sym.Container+"."+sym.Name)
+			}
+		case sym.Container != "":
+			// Members of classes are covered by the class
+		case len(methods[sym.Name]) > 0:
+			names = append(names, fmt.Sprintf("%s(%s)", sym.Name, strings.Join(methods[sym.Name], ", ")))
+		default:
+			names = append(names, sym.Name)
+		}
+	}
+	return strings.Join(names, ", "), exported
+}
+
+// dirHeader names a directory in the map
+func dirHeader(dir string) string {
+	if dir == "" {
+		return "./"
+	}
+	return dir
+}
+
+// dirCount names a directory that is not expanded, with its number of files
+func dirCount(dir string, files int) string {
+	if files == 1 {
+		return dirHeader(dir) + " (1 file)"
+	}
+	return fmt.Sprintf("%s (%d files)", dirHeader(dir), files)
+}
+
+// dirSummary lists as many directories as fit in maxBytes, with their
+// number of files, for workspaces too large to list them all
+func dirSummary(dirs []*mapDir, maxBytes int) string {
+	var sb strings.Builder
+	for i, dir := range dirs {
+		line := dirCount(dir.name, len(dir.files)) + "\n"
+		// Leave room to say how many directories are left out
+		reserve := 0
+		if i < len(dirs)-1 {
+			reserve = len(moreDirs(len(dirs) - i - 1))
+		}
+		if sb.Len()+len(line)+reserve > maxBytes {
+			sb.WriteString(moreDirs(len(dirs) - i))
+			return sb.String()
+		}
+		sb.WriteString(line)
+	}
+	return strings.TrimSuffix(sb.String(), "\n")
+}
+
+func moreDirs(n int) string {
+	return fmt.Sprintf("[%d more directories]", n)
+}
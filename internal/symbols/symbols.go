@@ -0,0 +1,376 @@
+package symbols
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const maxIndexedFileSize = 1024 * 1024 // 1MB
+
+// Kind of symbol
+type Kind string
+
+const (
+	KindFunc      Kind = "func"
+	KindMethod    Kind = "method"
+	KindType      Kind = "type"
+	KindStruct    Kind = "struct"
+	KindInterface Kind = "interface"
+	KindClass     Kind = "class"
+	KindConst     Kind = "const"
+	KindVar       Kind = "var"
+)
+
+// Symbol is a named definition in the workspace
+type Symbol struct {
+	Name      string `json:"name"`
+	Kind      Kind   `json:"kind"`
+	Path      string `json:"path"` // relative to the index root, slash separated
+	Line      int    `json:"line"`
+	Container string `json:"container,omitempty"` // receiver type or enclosing class
+	Signature string `json:"signature,omitempty"`
+	Exported  bool   `json:"exported"`
+
+	// Methods lists the method names of an interface, used to find
+	// implementations
+	Methods []string `json:"methods,omitempty"`
+}
+
+type fileEntry struct {
+	ModTime int64    `json:"mod_time"`
+	Size    int64    `json:"size"`
+	Symbols []Symbol `json:"symbols"`
+}
+
+// Index is a persistent symbol index of a directory tree. It is updated
+// incrementally: only files whose size or modification time changed are
+// re-parsed.
+type Index struct {
+	mu    sync.Mutex
+	root  string
+	path  string // persistence file, empty for in-memory indexes
+	files map[string]*fileEntry
+	dirty bool
+}
+
+type indexFile struct {
+	Root  string                `json:"root"`
+	Files map[string]*fileEntry `json:"files"`
+}
+
+// Open loads the index for root from dataDir, or starts an empty one. An
+// empty dataDir keeps the index in memory only.
+func Open(dataDir, root string) (*Index, error) {
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve root: %w", err)
+	}
+
+	ix := &Index{
+		root:  absRoot,
+		files: make(map[string]*fileEntry),
+	}
+
+	if dataDir == "" {
+		return ix, nil
+	}
+
+	sum := sha1.Sum([]byte(absRoot))
+	ix.path = filepath.Join(dataDir, "index", "symbols-"+hex.EncodeToString(sum[:])[:16]+".json")
+
+	data, err := os.ReadFile(ix.path)
+	if os.IsNotExist(err) {
+		return ix, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read symbol index: %w", err)
+	}
+
+	var stored indexFile
+	if err := json.Unmarshal(data, &stored); err != nil || stored.Root != absRoot {
+		// A corrupt or foreign index is simply rebuilt
+		return ix, nil
+	}
+	if stored.Files != nil {
+		ix.files = stored.Files
+	}
+	return ix, nil
+}
+
+// Root returns the indexed directory
+func (ix *Index) Root() string {
+	return ix.root
+}
+
+// Update re-parses changed files and drops deleted ones, returning how many
+// files were (re)indexed
+func (ix *Index) Update(ctx context.Context) (int, error) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+
+	seen := make(map[string]bool)
+	updated := 0
+
+	err := filepath.WalkDir(ix.root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		if d.IsDir() {
+			if path != ix.root && skipDir(d.Name()) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		parse := parserFor(path)
+		if parse == nil || !d.Type().IsRegular() {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil || info.Size() > maxIndexedFileSize {
+			return nil
+		}
+
+		rel, err := filepath.Rel(ix.root, path)
+		if err != nil {
+			return nil
+		}
+		rel = filepath.ToSlash(rel)
+		seen[rel] = true
+
+		if entry, ok := ix.files[rel]; ok && entry.ModTime == info.ModTime().UnixNano() && entry.Size == info.Size() {
+			return nil
+		}
+
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return nil
+		}
+
+		syms := parse(rel, content)
+		ix.files[rel] = &fileEntry{
+			ModTime: info.ModTime().UnixNano(),
+			Size:    info.Size(),
+			Symbols: syms,
+		}
+		ix.dirty = true
+		updated++
+		return nil
+	})
+	if err != nil {
+		return updated, err
+	}
+
+	for rel := range ix.files {
+		if !seen[rel] {
+			delete(ix.files, rel)
+			ix.dirty = true
+		}
+	}
+
+	return updated, nil
+}
+
+// Save persists the index if it changed since it was loaded
+func (ix *Index) Save() error {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+
+	if ix.path == "" || !ix.dirty {
+		return nil
+	}
+
+	data, err := json.Marshal(indexFile{Root: ix.root, Files: ix.files})
+	if err != nil {
+		return fmt.Errorf("failed to encode symbol index: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(ix.path), 0755); err != nil {
+		return fmt.Errorf("failed to create index directory: %w", err)
+	}
+
+	// Write to a temp file first so a crash never leaves a truncated index
+	tmp := ix.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write symbol index: %w", err)
+	}
+	if err := os.Rename(tmp, ix.path); err != nil {
+		return fmt.Errorf("failed to write symbol index: %w", err)
+	}
+
+	ix.dirty = false
+	return nil
+}
+
+// MatchMode controls how Query.Name is compared to symbol names
+type MatchMode string
+
+const (
+	MatchExact    MatchMode = "exact"
+	MatchPrefix   MatchMode = "prefix"
+	MatchContains MatchMode = "contains"
+)
+
+// Query selects symbols from the index
+type Query struct {
+	Name      string
+	Match     MatchMode
+	Kind      Kind
+	Container string
+	Limit     int
+}
+
+// Find returns symbols matching the query, exact name matches first
+func (ix *Index) Find(q Query) []Symbol {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+
+	name := strings.ToLower(q.Name)
+	var results []Symbol
+	for _, entry := range ix.files {
+		for _, sym := range entry.Symbols {
+			if q.Kind != "" && sym.Kind != q.Kind {
+				continue
+			}
+			if q.Container != "" && !strings.EqualFold(sym.Container, q.Container) {
+				continue
+			}
+			if !matchName(strings.ToLower(sym.Name), name, q.Match) {
+				continue
+			}
+			results = append(results, sym)
+		}
+	}
+
+	sortSymbols(results, q.Name)
+	if q.Limit > 0 && len(results) > q.Limit {
+		results = results[:q.Limit]
+	}
+	return results
+}
+
+// Implementations returns the types whose method sets include every method
+// of the named interface. Matching is by method name only.
+func (ix *Index) Implementations(iface string) ([]Symbol, error) {
+	interfaces := ix.Find(Query{Name: iface, Match: MatchExact, Kind: KindInterface})
+	if len(interfaces) == 0 {
+		return nil, fmt.Errorf("interface not found: %s", iface)
+	}
+
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+
+	// Collect method names per receiver type, keyed by directory so types in
+	// different packages don't merge
+	type typeKey struct{ dir, name string }
+	methods := make(map[typeKey]map[string]bool)
+	types := make(map[typeKey]Symbol)
+	for _, entry := range ix.files {
+		for _, sym := range entry.Symbols {
+			key := typeKey{filepath.Dir(sym.Path), sym.Container}
+			switch {
+			case sym.Kind == KindMethod && sym.Container != "":
+				if methods[key] == nil {
+					methods[key] = make(map[string]bool)
+				}
+				methods[key][sym.Name] = true
+			case sym.Kind == KindStruct || sym.Kind == KindType || sym.Kind == KindClass:
+				types[typeKey{filepath.Dir(sym.Path), sym.Name}] = sym
+			}
+		}
+	}
+
+	var results []Symbol
+	seen := make(map[typeKey]bool)
+	for _, in := range interfaces {
+		if len(in.Methods) == 0 {
+			continue
+		}
+		for key, set := range methods {
+			if seen[key] {
+				continue
+			}
+			implements := true
+			for _, m := range in.Methods {
+				if !set[m] {
+					implements = false
+					break
+				}
+			}
+			if !implements {
+				continue
+			}
+			seen[key] = true
+			if sym, ok := types[key]; ok {
+				results = append(results, sym)
+			} else {
+				results = append(results, Symbol{Name: key.name, Kind: KindType, Path: key.dir})
+			}
+		}
+	}
+
+	sortSymbols(results, "")
+	return results, nil
+}
+
+// Stats returns the number of indexed files and symbols
+func (ix *Index) Stats() (files, symbols int) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+
+	for _, entry := range ix.files {
+		symbols += len(entry.Symbols)
+	}
+	return len(ix.files), symbols
+}
+
+func matchName(symName, query string, mode MatchMode) bool {
+	switch mode {
+	case MatchPrefix:
+		return strings.HasPrefix(symName, query)
+	case MatchContains:
+		return strings.Contains(symName, query)
+	default:
+		return symName == query
+	}
+}
+
+func sortSymbols(syms []Symbol, query string) {
+	sort.Slice(syms, func(i, j int) bool {
+		a, b := syms[i], syms[j]
+		if query != "" && (a.Name == query) != (b.Name == query) {
+			return a.Name == query
+		}
+		if a.Exported != b.Exported {
+			return a.Exported
+		}
+		if a.Path != b.Path {
+			return a.Path < b.Path
+		}
+		return a.Line < b.Line
+	})
+}
+
+func skipDir(name string) bool {
+	if strings.HasPrefix(name, ".") {
+		return true
+	}
+	switch name {
+	case "node_modules", "vendor", "__pycache__", "target", "dist", "build":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,234 @@
+// Package tlsutil sets up TLS for server mode, since agent traffic carries
+// source code and credentials: provided certificates, self-signed ones that
+// clients pin, and client certificates for mutual TLS
+package tlsutil
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/omnitrix-sh/core.sh/pkg/models"
+)
+
+const (
+	// selfSignedValidity is how long generated certificates last. Clients
+	// pin the fingerprint, so a new one means pinning again.
+	selfSignedValidity = 2 * 365 * 24 * time.Hour
+	// renewBefore replaces generated certificates this close to expiring
+	renewBefore = 30 * 24 * time.Hour
+)
+
+var defaultHosts = []string{"localhost", "127.0.0.1", "::1"}
+
+// Enabled reports whether cfg asks for TLS
+func Enabled(cfg models.TLSConfig) bool {
+	return cfg.CertFile != "" || cfg.SelfSigned
+}
+
+// ServerConfig builds the server's TLS config and returns the fingerprint of
+// its certificate for clients to pin. It returns nil when TLS is not
+// configured. Self-signed certificates are kept in dataDir and reused
+// until they near expiry.
+func ServerConfig(cfg models.TLSConfig, dataDir string) (*tls.Config, string, error) {
+	if !Enabled(cfg) {
+		return nil, "", nil
+	}
+
+	var cert tls.Certificate
+	var err error
+	switch {
+	case cfg.CertFile != "":
+		if cfg.KeyFile == "" {
+			return nil, "", fmt.Errorf("tls: key_file is required with cert_file")
+		}
+		cert, err = tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to load TLS certificate: %w", err)
+		}
+	default:
+		hosts := cfg.Hosts
+		if len(hosts) == 0 {
+			hosts = defaultHosts
+		}
+		cert, err = selfSigned(filepath.Join(dataDir, "tls"), hosts)
+		if err != nil {
+			return nil, "", err
+		}
+	}
+
+	config := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+	if cfg.ClientCAFile != "" {
+		pool, err := loadPool(cfg.ClientCAFile)
+		if err != nil {
+			return nil, "", err
+		}
+		config.ClientCAs = pool
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return config, Fingerprint(cert.Certificate[0]), nil
+}
+
+// ClientConfig builds the TLS config for connecting to a server. With a
+// fingerprint the server's certificate must match it exactly instead of
+// being verified against the system roots, which is how self-signed
+// certificates are trusted. certFile and keyFile, if set, are presented
+// for mutual TLS.
+func ClientConfig(fingerprint, certFile, keyFile string) (*tls.Config, error) {
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+	if certFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	if fingerprint != "" {
+		want := normalizeFingerprint(fingerprint)
+		// The chain is checked by fingerprint below instead
+		config.InsecureSkipVerify = true
+		config.VerifyPeerCertificate = func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			if len(rawCerts) == 0 {
+				return errors.New("server presented no certificate")
+			}
+			if got := Fingerprint(rawCerts[0]); normalizeFingerprint(got) != want {
+				return fmt.Errorf("server certificate fingerprint %s does not match the pinned %s", got, fingerprint)
+			}
+			return nil
+		}
+	}
+	return config, nil
+}
+
+// Fingerprint returns the SHA-256 fingerprint of a DER certificate as
+// colon-separated hex, the form browsers and openssl show
+func Fingerprint(der []byte) string {
+	sum := sha256.Sum256(der)
+	parts := make([]string, len(sum))
+	for i, b := range sum {
+		parts[i] = fmt.Sprintf("%02X", b)
+	}
+	return strings.Join(parts, ":")
+}
+
+func normalizeFingerprint(fingerprint string) string {
+	fingerprint = strings.TrimPrefix(strings.ToLower(fingerprint), "sha256:")
+	return strings.NewReplacer(":", "", " ", "").Replace(fingerprint)
+}
+
+// CheckPlainAddr refuses to serve without TLS on anything but loopback
+func CheckPlainAddr(addr string) error {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return fmt.Errorf("invalid address %q: %w", addr, err)
+	}
+	if host == "localhost" {
+		return nil
+	}
+	if ip := net.ParseIP(host); ip != nil && ip.IsLoopback() {
+		return nil
+	}
+	return fmt.Errorf("refusing to serve %s without TLS: configure server.tls or listen on a loopback address", addr)
+}
+
+// selfSigned loads the generated certificate in dir, creating a new one
+// when there is none, it nears expiry or it doesn't cover hosts
+func selfSigned(dir string, hosts []string) (tls.Certificate, error) {
+	certPath := filepath.Join(dir, "server.crt")
+	keyPath := filepath.Join(dir, "server.key")
+
+	if cert, err := tls.LoadX509KeyPair(certPath, keyPath); err == nil {
+		if leaf, err := x509.ParseCertificate(cert.Certificate[0]); err == nil &&
+			time.Until(leaf.NotAfter) > renewBefore && covers(leaf, hosts) {
+			return cert, nil
+		}
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("failed to generate TLS key: %w", err)
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("failed to generate certificate serial: %w", err)
+	}
+
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: "omnitrix " + hosts[0]},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(selfSignedValidity),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+	}
+	for _, host := range hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("failed to create TLS certificate: %w", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("failed to encode TLS key: %w", err)
+	}
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return tls.Certificate{}, fmt.Errorf("failed to create TLS directory: %w", err)
+	}
+	if err := os.WriteFile(keyPath, keyPEM, 0o600); err != nil {
+		return tls.Certificate{}, fmt.Errorf("failed to save TLS key: %w", err)
+	}
+	if err := os.WriteFile(certPath, certPEM, 0o644); err != nil {
+		return tls.Certificate{}, fmt.Errorf("failed to save TLS certificate: %w", err)
+	}
+	return tls.X509KeyPair(certPEM, keyPEM)
+}
+
+// covers reports whether a certificate is valid for every host
+func covers(cert *x509.Certificate, hosts []string) bool {
+	for _, host := range hosts {
+		if cert.VerifyHostname(host) != nil {
+			return false
+		}
+	}
+	return true
+}
+
+func loadPool(path string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read client CA: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no certificates found in client CA %s", path)
+	}
+	return pool, nil
+}
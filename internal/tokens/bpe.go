@@ -0,0 +1,135 @@
+package tokens
+
+import (
+	"math"
+	"regexp"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+
+	tiktoken_loader "github.com/pkoukk/tiktoken-go-loader"
+)
+
+// Pre-tokenization patterns of the tiktoken encodings. RE2 has no lookahead,
+// so the "\s+(?!\S)" alternative is dropped here and emulated in split.
+const (
+	cl100kPattern = `(?i:'s|'t|'re|'ve|'m|'ll|'d)|[^\r\n\p{L}\p{N}]?\p{L}+|\p{N}{1,3}| ?[^\s\p{L}\p{N}]+[\r\n]*|\s*[\r\n]+|\s+`
+	o200kPattern  = `[^\r\n\p{L}\p{N}]?[\p{Lu}\p{Lt}\p{Lm}\p{Lo}\p{M}]*[\p{Ll}\p{Lm}\p{Lo}\p{M}]+(?i:'s|'t|'re|'ve|'m|'ll|'d)?|[^\r\n\p{L}\p{N}]?[\p{Lu}\p{Lt}\p{Lm}\p{Lo}\p{M}]+[\p{Ll}\p{Lm}\p{Lo}\p{M}]*(?i:'s|'t|'re|'ve|'m|'ll|'d)?|\p{N}{1,3}| ?[^\s\p{L}\p{N}]+[\r\n/]*|\s*[\r\n]+|\s+`
+)
+
+// encoding is a byte pair encoding compatible with OpenAI's tiktoken. Merge
+// ranks are loaded on first use.
+type encoding struct {
+	name    string
+	pattern *regexp.Regexp
+
+	once  sync.Once
+	ranks map[string]int
+	err   error
+}
+
+var (
+	cl100k = &encoding{name: "cl100k_base", pattern: regexp.MustCompile(`^(?:` + cl100kPattern + `)`)}
+	o200k  = &encoding{name: "o200k_base", pattern: regexp.MustCompile(`^(?:` + o200kPattern + `)`)}
+)
+
+func (e *encoding) load() error {
+	e.once.Do(func() {
+		e.ranks, e.err = tiktoken_loader.NewOfflineLoader().LoadTiktokenBpe(e.name + ".tiktoken")
+	})
+	return e.err
+}
+
+// Name returns the encoding name
+func (e *encoding) Name() string {
+	return e.name
+}
+
+// Exact reports that counts match the provider's own tokenizer
+func (e *encoding) Exact() bool {
+	return e.load() == nil
+}
+
+// Count returns the number of tokens in text, falling back to the heuristic
+// if the merge ranks cannot be loaded
+func (e *encoding) Count(text string) int {
+	if text == "" {
+		return 0
+	}
+	if e.load() != nil {
+		return Estimate(text)
+	}
+
+	n := 0
+	for _, piece := range e.split(text) {
+		if _, ok := e.ranks[piece]; ok {
+			n++
+			continue
+		}
+		n += len(e.merge(piece))
+	}
+	return n
+}
+
+// split breaks text into the pieces BPE is applied to
+func (e *encoding) split(text string) []string {
+	var pieces []string
+	for len(text) > 0 {
+		loc := e.pattern.FindStringIndex(text)
+		if loc == nil || loc[1] == 0 {
+			// Cannot happen with these patterns, but never loop forever
+			_, size := utf8.DecodeRuneInString(text)
+			loc = []int{0, size}
+		}
+
+		end := loc[1]
+		piece := text[:end]
+
+		// Emulate "\s+(?!\S)": a whitespace run followed by a non-space
+		// character leaves its last character to prefix the next piece
+		if end < len(text) && isSpaceRun(piece) && utf8.RuneCountInString(piece) > 1 {
+			if next, _ := utf8.DecodeRuneInString(text[end:]); !unicode.IsSpace(next) {
+				_, size := utf8.DecodeLastRuneInString(piece)
+				end -= size
+				piece = text[:end]
+			}
+		}
+
+		pieces = append(pieces, piece)
+		text = text[end:]
+	}
+	return pieces
+}
+
+// merge applies byte pair merges to a piece, lowest rank first, and returns
+// the resulting token boundaries
+func (e *encoding) merge(piece string) []string {
+	parts := make([]string, len(piece))
+	for i := range piece {
+		parts[i] = piece[i : i+1]
+	}
+
+	for len(parts) > 1 {
+		best, bestRank := -1, math.MaxInt
+		for i := 0; i < len(parts)-1; i++ {
+			if rank, ok := e.ranks[parts[i]+parts[i+1]]; ok && rank < bestRank {
+				best, bestRank = i, rank
+			}
+		}
+		if best < 0 {
+			break
+		}
+		parts[best] += parts[best+1]
+		parts = append(parts[:best+1], parts[best+2:]...)
+	}
+	return parts
+}
+
+func isSpaceRun(s string) bool {
+	for _, r := range s {
+		if !unicode.IsSpace(r) || r == '\r' || r == '\n' {
+			return false
+		}
+	}
+	return s != ""
+}
@@ -0,0 +1,123 @@
+package tokens
+
+import (
+	"encoding/json"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/omnitrix-sh/core.sh/pkg/models"
+)
+
+// messageOverhead is the per-message cost of role markers and separators in
+// chat templates
+const messageOverhead = 4
+
+// imageTokens is a rough cost for an attached image
+const imageTokens = 765
+
+// Counter counts tokens the way a model's tokenizer would
+type Counter interface {
+	Name() string
+	Count(text string) int
+	// Exact reports whether counts match the model's own tokenizer rather
+	// than approximating it
+	Exact() bool
+}
+
+// o200kModels use the o200k_base encoding, other OpenAI models cl100k_base
+var o200kModels = []string{"gpt-4o", "gpt-4.1", "gpt-4.5", "gpt-5", "o1", "o3", "o4", "chatgpt-4o"}
+
+// ForModel returns the counter for a model. OpenAI models are counted
+// exactly. Other models are approximated with cl100k_base, whose vocabulary
+// most current open models' BPE tokenizers are derived from or close to.
+func ForModel(model string) Counter {
+	name := strings.ToLower(model)
+	if i := strings.LastIndex(name, "/"); i >= 0 {
+		name = name[i+1:]
+	}
+
+	for _, prefix := range o200kModels {
+		if strings.HasPrefix(name, prefix) {
+			return o200k
+		}
+	}
+	if strings.HasPrefix(name, "gpt-") || strings.HasPrefix(name, "text-embedding-") {
+		return cl100k
+	}
+	return approximate{cl100k}
+}
+
+// approximate marks an encoding as a stand-in for a model's real tokenizer
+type approximate struct {
+	*encoding
+}
+
+func (approximate) Exact() bool { return false }
+
+// Heuristic is a Counter that needs no vocabulary, see Estimate
+var Heuristic Counter = heuristic{}
+
+type heuristic struct{}
+
+func (heuristic) Name() string          { return "heuristic" }
+func (heuristic) Count(text string) int { return Estimate(text) }
+func (heuristic) Exact() bool           { return false }
+
+// Estimate approximates the number of tokens in text. BPE tokenizers average
+// about four characters per token for English and code, but emit roughly one
+// token per character for CJK text, so those are counted separately.
+func Estimate(text string) int {
+	if text == "" {
+		return 0
+	}
+
+	wide, other := 0, 0
+	for _, r := range text {
+		if r >= 0x2E80 && (unicode.Is(unicode.Han, r) || unicode.Is(unicode.Hiragana, r) ||
+			unicode.Is(unicode.Katakana, r) || unicode.Is(unicode.Hangul, r)) {
+			wide++
+		} else {
+			other += utf8.RuneLen(r)
+		}
+	}
+	return wide + (other+3)/4
+}
+
+// Message counts the tokens a message takes up in a prompt
+func Message(c Counter, msg models.Message) int {
+	n := messageOverhead + c.Count(msg.Content)
+	for _, tc := range msg.ToolCalls {
+		args, _ := json.Marshal(tc.Function.Arguments)
+		n += c.Count(tc.Function.Name) + c.Count(string(args))
+	}
+	for _, part := range msg.Parts {
+		if part.Type() == "image" {
+			n += imageTokens
+		} else {
+			n += c.Count(part.String())
+		}
+	}
+	return n
+}
+
+// Tool counts the tokens a tool schema adds to every request
+func Tool(c Counter, tool models.Tool) int {
+	data, err := json.Marshal(tool)
+	if err != nil {
+		return 0
+	}
+	return c.Count(string(data))
+}
+
+// Request counts the prompt tokens of a whole request
+func Request(c Counter, req models.ChatRequest) int {
+	n := 0
+	for _, msg := range req.Messages {
+		n += Message(c, msg)
+	}
+	for _, tool := range req.Tools {
+		n += Tool(c, tool)
+	}
+	return n
+}
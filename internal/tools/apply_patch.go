@@ -0,0 +1,593 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// maxPatchFuzz is how many leading and trailing context lines a hunk may
+// drop when its full context no longer matches
+const maxPatchFuzz = 2
+
+type ApplyPatchTool struct {
+	workDir string
+	roots   []string // other directories it may use, see resolvePath
+}
+
+func NewApplyPatchTool(workDir string, roots ...string) *ApplyPatchTool {
+	return &ApplyPatchTool{
+		workDir: workDir,
+		roots:   roots,
+	}
+}
+
+func (t *ApplyPatchTool) Name() string {
+	return "apply_patch"
+}
+
+func (t *ApplyPatchTool) Description() string {
+	return `Apply a unified diff to files in the working directory and report the result of every hunk.
+
+Usage:
+- patch is a unified diff as produced by diff -u or git diff, covering one or more files
+- Use /dev/null as the old path to create a file, or as the new path to delete one
+- Hunks are located by their context, so line numbers may be approximate; whitespace differences and a few stale context lines are tolerated
+- dry_run validates the patch without writing anything
+
+The patch is applied only if every hunk succeeds; otherwise no file is changed and the failing hunks are reported.`
+}
+
+func (t *ApplyPatchTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"patch": map[string]interface{}{
+				"type":        "string",
+				"description": "Unified diff to apply",
+			},
+			"dry_run": map[string]interface{}{
+				"type":        "boolean",
+				"description": "Validate the patch without writing files (default: false)",
+			},
+		},
+		"required": []string{"patch"},
+	}
+}
+
+func (t *ApplyPatchTool) Risk() Risk {
+	return RiskWrite
+}
+
+// Paths returns the files the patch names in its headers, so permission
+// rules on paths cover them
+func (t *ApplyPatchTool) Paths(ctx context.Context, args map[string]interface{}) ([]string, error) {
+	patches, err := parsePatch(GetStringArg(args, "patch", ""))
+	if err != nil {
+		return nil, err
+	}
+	var paths []string
+	for _, p := range patches {
+		for i, path := range []string{p.oldPath, p.newPath} {
+			if path == "" || (i == 1 && path == p.oldPath) {
+				continue
+			}
+			absPath, err := resolvePath(t.workDir, path, t.roots...)
+			if err != nil {
+				return nil, err
+			}
+			paths = append(paths, absPath)
+		}
+	}
+	return paths, nil
+}
+
+// filePatch is the part of a patch that applies to one file
+type filePatch struct {
+	oldPath string
+	newPath string
+	hunks   []hunk
+}
+
+type hunk struct {
+	header   string
+	oldStart int
+	lines    []diffOp
+}
+
+// patchedFile is the pending state of a file while a patch is applied
+type patchedFile struct {
+	path    string
+	lines   []string
+	exists  bool
+	crlf    bool
+	eol     bool // ends with a newline
+	mode    os.FileMode
+	changed bool
+}
+
+func (t *ApplyPatchTool) Execute(ctx context.Context, args map[string]interface{}) (string, error) {
+	patch := GetStringArg(args, "patch", "")
+	if strings.TrimSpace(patch) == "" {
+		return "", fmt.Errorf("patch is required")
+	}
+	dryRun := GetBoolArg(args, "dry_run", false)
+
+	patches, err := parsePatch(patch)
+	if err != nil {
+		return "", err
+	}
+
+	// Files are patched in memory first; later file patches see the result
+	// of earlier ones touching the same path
+	files := make(map[string]*patchedFile)
+	var order []string
+	load := func(path string) (*patchedFile, error) {
+		absPath, err := resolvePath(t.workDir, path, t.roots...)
+		if err != nil {
+			return nil, err
+		}
+		if f, ok := files[absPath]; ok {
+			return f, nil
+		}
+		f, err := loadPatchedFile(absPath)
+		if err != nil {
+			return nil, err
+		}
+		files[absPath] = f
+		order = append(order, absPath)
+		return f, nil
+	}
+
+	var report strings.Builder
+	total, failed := 0, 0
+
+	for _, p := range patches {
+		total += len(p.hunks)
+
+		var status, target string
+		switch {
+		case p.oldPath == "":
+			status, target = "created", p.newPath
+		case p.newPath == "":
+			status, target = "deleted", p.oldPath
+		case p.oldPath != p.newPath:
+			status, target = "renamed from "+p.oldPath, p.newPath
+		default:
+			status, target = "modified", p.newPath
+		}
+		report.WriteString(fmt.Sprintf("%s (%s)\n", target, status))
+
+		src, err := load(target)
+		if err == nil && p.oldPath != "" {
+			src, err = load(p.oldPath)
+		}
+		if err != nil {
+			return "", err
+		}
+
+		switch {
+		case p.oldPath == "" && src.exists:
+			report.WriteString("  FAILED: file already exists\n")
+			failed += len(p.hunks)
+			continue
+		case p.oldPath != "" && !src.exists:
+			report.WriteString("  FAILED: file does not exist\n")
+			failed += len(p.hunks)
+			continue
+		}
+
+		lines := src.lines
+		grown, drift, floor := 0, 0, 0
+		for i, h := range p.hunks {
+			r, ok := applyHunk(lines, h, grown+drift, floor)
+			if !ok {
+				failed++
+				report.WriteString(fmt.Sprintf("  hunk %d %s: FAILED, context not found\n", i+1, h.header))
+				continue
+			}
+
+			if h.oldStart > 0 {
+				drift = r.start - (h.oldStart - 1) - grown
+			}
+			var notes []string
+			if drift != 0 {
+				notes = append(notes, fmt.Sprintf("offset %+d", drift))
+			}
+			if r.fuzz > 0 {
+				notes = append(notes, fmt.Sprintf("fuzz %d", r.fuzz))
+			}
+			detail := ""
+			if len(notes) > 0 {
+				detail = " (" + strings.Join(notes, ", ") + ")"
+			}
+			report.WriteString(fmt.Sprintf("  hunk %d %s: applied at line %d%s\n", i+1, h.header, r.start+1, detail))
+
+			grown += len(r.lines) - len(lines)
+			floor = r.end
+			lines = r.lines
+		}
+
+		switch {
+		case p.newPath == "":
+			if len(lines) > 0 {
+				failed++
+				report.WriteString("  FAILED: file is not empty after removing the patched lines\n")
+				continue
+			}
+			src.lines, src.exists, src.changed = nil, false, true
+		case p.oldPath == "":
+			*src = patchedFile{path: src.path, lines: lines, exists: true, eol: true, mode: 0644, changed: true}
+		case p.oldPath != p.newPath:
+			dest, err := load(p.newPath)
+			if err != nil {
+				return "", err
+			}
+			if dest.exists {
+				failed++
+				report.WriteString(fmt.Sprintf("  FAILED: %s already exists\n", p.newPath))
+				continue
+			}
+			*dest = patchedFile{path: dest.path, lines: lines, exists: true, crlf: src.crlf, eol: src.eol, mode: src.mode, changed: true}
+			src.lines, src.exists, src.changed = nil, false, true
+		default:
+			src.lines, src.changed = lines, true
+		}
+	}
+
+	var output strings.Builder
+	switch {
+	case failed > 0:
+		output.WriteString(fmt.Sprintf("Patch not applied: %d of %d hunks failed, no files were changed.\n\n", failed, total))
+	case dryRun:
+		output.WriteString(fmt.Sprintf("Dry run: all %d hunks apply, no files were changed.\n\n", total))
+	default:
+		output.WriteString(fmt.Sprintf("Applied patch: %d hunks in %d files.\n\n", total, len(patches)))
+	}
+	output.WriteString(report.String())
+
+	if failed > 0 {
+		output.WriteString("\nRead the affected files and regenerate the failing hunks against their current content.\n")
+		return output.String(), nil
+	}
+	if dryRun {
+		return output.String(), nil
+	}
+
+	// Write only once every hunk has been validated, so a bad hunk never
+	// leaves a half-applied patch behind
+	for _, absPath := range order {
+		f := files[absPath]
+		if !f.changed {
+			continue
+		}
+		if !f.exists {
+			if err := os.Remove(absPath); err != nil && !os.IsNotExist(err) {
+				return "", fmt.Errorf("failed to remove %s: %w", absPath, err)
+			}
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(absPath), 0755); err != nil {
+			return "", fmt.Errorf("failed to create directory for %s: %w", absPath, err)
+		}
+		if err := os.WriteFile(absPath, []byte(f.content()), f.mode); err != nil {
+			return "", fmt.Errorf("failed to write %s: %w", absPath, err)
+		}
+		recordChange(ctx, absPath)
+	}
+
+	return output.String(), nil
+}
+
+func loadPatchedFile(absPath string) (*patchedFile, error) {
+	f := &patchedFile{path: absPath, mode: 0644}
+
+	info, err := os.Stat(absPath)
+	if os.IsNotExist(err) {
+		return f, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat file: %w", err)
+	}
+	if info.IsDir() {
+		return nil, fmt.Errorf("path is a directory, not a file: %s", absPath)
+	}
+	if info.Size() > maxFileSize {
+		return nil, fmt.Errorf("file too large (%d bytes, max %d bytes)", info.Size(), maxFileSize)
+	}
+
+	data, err := os.ReadFile(absPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+
+	content := string(data)
+	f.exists = true
+	f.mode = info.Mode().Perm()
+	f.crlf = strings.Contains(content, "\r\n")
+	f.eol = strings.HasSuffix(content, "\n")
+	if f.crlf {
+		content = strings.ReplaceAll(content, "\r\n", "\n")
+	}
+	f.lines = splitLines(content)
+	return f, nil
+}
+
+func (f *patchedFile) content() string {
+	if len(f.lines) == 0 {
+		return ""
+	}
+	newline := "\n"
+	if f.crlf {
+		newline = "\r\n"
+	}
+	content := strings.Join(f.lines, newline)
+	if f.eol {
+		content += newline
+	}
+	return content
+}
+
+// parsePatch splits a unified diff into per-file patches. Hunk line counts
+// are ignored because models rarely get them right; a hunk ends at the
+// next hunk or file header instead.
+func parsePatch(patch string) ([]filePatch, error) {
+	lines := strings.Split(strings.ReplaceAll(patch, "\r\n", "\n"), "\n")
+
+	var patches []filePatch
+	var current *filePatch
+	var h *hunk
+
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+
+		if strings.HasPrefix(line, "--- ") && i+1 < len(lines) && strings.HasPrefix(lines[i+1], "+++ ") {
+			patches = append(patches, filePatch{
+				oldPath: patchPath(line[4:]),
+				newPath: patchPath(lines[i+1][4:]),
+			})
+			current = &patches[len(patches)-1]
+			h = nil
+			i++
+			continue
+		}
+
+		if strings.HasPrefix(line, "@@") {
+			if current == nil {
+				return nil, fmt.Errorf("line %d: hunk before any file header (--- and +++ lines)", i+1)
+			}
+			oldStart, err := parseHunkHeader(line)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", i+1, err)
+			}
+			current.hunks = append(current.hunks, hunk{header: hunkHeaderText(line), oldStart: oldStart})
+			h = &current.hunks[len(current.hunks)-1]
+			continue
+		}
+
+		if h == nil {
+			// diff --git, index and other extended headers
+			continue
+		}
+
+		switch {
+		case strings.HasPrefix(line, `\`):
+			// "\ No newline at end of file"
+		case line == "":
+			// Blank context lines often lose their leading space
+			if i < len(lines)-1 {
+				h.lines = append(h.lines, diffOp{' ', ""})
+			}
+		case line[0] == ' ' || line[0] == '-' || line[0] == '+':
+			h.lines = append(h.lines, diffOp{line[0], line[1:]})
+		default:
+			h = nil
+		}
+	}
+
+	if len(patches) == 0 {
+		return nil, fmt.Errorf("no file headers found; the patch must be a unified diff with --- and +++ lines")
+	}
+	for _, p := range patches {
+		if p.oldPath == "" && p.newPath == "" {
+			return nil, fmt.Errorf("patch has a file with neither an old nor a new path")
+		}
+		if len(p.hunks) == 0 {
+			return nil, fmt.Errorf("patch for %s has no hunks", p.newPath)
+		}
+	}
+	return patches, nil
+}
+
+// patchPath extracts the path from a --- or +++ header, returning "" for
+// /dev/null
+func patchPath(header string) string {
+	path := header
+	if tab := strings.IndexByte(path, '\t'); tab >= 0 {
+		path = path[:tab]
+	}
+	path = strings.TrimSpace(path)
+	if path == "/dev/null" {
+		return ""
+	}
+	if strings.HasPrefix(path, "a/") || strings.HasPrefix(path, "b/") {
+		path = path[2:]
+	}
+	return path
+}
+
+// parseHunkHeader returns the old start line of "@@ -l,s +l,s @@". A
+// header without line numbers yields 0, which searches the whole file.
+func parseHunkHeader(line string) (int, error) {
+	fields := strings.Fields(line)
+	if len(fields) < 2 || !strings.HasPrefix(fields[1], "-") {
+		return 0, nil
+	}
+	start := strings.SplitN(fields[1][1:], ",", 2)[0]
+	n, err := strconv.Atoi(start)
+	if err != nil {
+		return 0, fmt.Errorf("invalid hunk header: %s", line)
+	}
+	return n, nil
+}
+
+func hunkHeaderText(line string) string {
+	if end := strings.Index(line[2:], "@@"); end >= 0 {
+		return line[:end+4]
+	}
+	return line
+}
+
+// hunkResult is a hunk applied to a file's lines
+type hunkResult struct {
+	lines []string
+	start int // index of the hunk's first line, including context
+	end   int // index just past the replacement
+	fuzz  int
+}
+
+// applyHunk finds where the hunk applies in lines and applies it. The
+// search starts at the hunk's stated position shifted by offset and never
+// goes before floor, so hunks apply in order.
+func applyHunk(lines []string, h hunk, offset, floor int) (hunkResult, bool) {
+	for fuzz := 0; fuzz <= maxPatchFuzz; fuzz++ {
+		ops, ok := trimContext(h, fuzz)
+		if !ok {
+			break
+		}
+		var old []string
+		for _, op := range ops {
+			if op.kind != '+' {
+				old = append(old, op.text)
+			}
+		}
+
+		if len(old) == 0 {
+			// Only a pure insertion may have no context; one whose context
+			// was all dropped by fuzz could go anywhere
+			if fuzz > 0 {
+				break
+			}
+			// The header names the line to insert after
+			at := h.oldStart + offset
+			if h.oldStart == 0 || at > len(lines) {
+				at = len(lines)
+			}
+			if at < floor {
+				at = floor
+			}
+			repl := replacement(ops, nil)
+			return hunkResult{lines: splice(lines, at, 0, repl), start: at, end: at + len(repl)}, true
+		}
+
+		leading := leadingContext(h, fuzz)
+		expected := h.oldStart - 1 + offset + leading
+		for _, match := range []func(a, b string) bool{
+			func(a, b string) bool { return a == b },
+			func(a, b string) bool { return strings.TrimRight(a, " \t") == strings.TrimRight(b, " \t") },
+			func(a, b string) bool {
+				return strings.Join(strings.Fields(a), " ") == strings.Join(strings.Fields(b), " ")
+			},
+		} {
+			if at, ok := findLines(lines, old, expected, floor, match); ok {
+				repl := replacement(ops, lines[at:at+len(old)])
+				return hunkResult{
+					lines: splice(lines, at, len(old), repl),
+					start: at - leading,
+					end:   at + len(repl),
+					fuzz:  fuzz,
+				}, true
+			}
+		}
+	}
+	return hunkResult{}, false
+}
+
+// trimContext returns the hunk's lines with up to fuzz context lines
+// dropped from each end
+func trimContext(h hunk, fuzz int) ([]diffOp, bool) {
+	ops := h.lines
+	for i := 0; i < fuzz; i++ {
+		trimmed := false
+		if len(ops) > 0 && ops[0].kind == ' ' {
+			ops = ops[1:]
+			trimmed = true
+		}
+		if len(ops) > 0 && ops[len(ops)-1].kind == ' ' {
+			ops = ops[:len(ops)-1]
+			trimmed = true
+		}
+		if !trimmed {
+			return nil, false
+		}
+	}
+	return ops, true
+}
+
+// replacement returns the new side of ops. Context lines are taken from
+// matched, the file lines the old side matched, so whitespace the match
+// tolerated is kept as it is in the file.
+func replacement(ops []diffOp, matched []string) []string {
+	var repl []string
+	i := 0
+	for _, op := range ops {
+		switch op.kind {
+		case ' ':
+			repl = append(repl, matched[i])
+			i++
+		case '-':
+			i++
+		case '+':
+			repl = append(repl, op.text)
+		}
+	}
+	return repl
+}
+
+// leadingContext is how many context lines fuzz drops from the start
+func leadingContext(h hunk, fuzz int) int {
+	n := 0
+	for n < fuzz && n < len(h.lines) && h.lines[n].kind == ' ' {
+		n++
+	}
+	return n
+}
+
+// findLines finds old in lines, trying positions nearest expected first
+func findLines(lines, old []string, expected, floor int, match func(a, b string) bool) (int, bool) {
+	matchesAt := func(at int) bool {
+		if at < floor || at+len(old) > len(lines) {
+			return false
+		}
+		for i, line := range old {
+			if !match(lines[at+i], line) {
+				return false
+			}
+		}
+		return true
+	}
+
+	if expected < floor {
+		expected = floor
+	}
+	for d := 0; expected-d >= floor || expected+d <= len(lines); d++ {
+		if matchesAt(expected + d) {
+			return expected + d, true
+		}
+		if d > 0 && matchesAt(expected-d) {
+			return expected - d, true
+		}
+	}
+	return 0, false
+}
+
+func splice(lines []string, at, remove int, insert []string) []string {
+	result := make([]string, 0, len(lines)-remove+len(insert))
+	result = append(result, lines[:at]...)
+	result = append(result, insert...)
+	result = append(result, lines[at+remove:]...)
+	return result
+}
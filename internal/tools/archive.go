@@ -0,0 +1,576 @@
+package tools
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"cmp"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/omnitrix-sh/core.sh/internal/display"
+)
+
+const (
+	maxArchiveEntries   = 10000
+	maxArchiveTotalSize = 500 * 1024 * 1024 // 500MB
+)
+
+type archiveArgs struct {
+	Action      string   `json:"action" enum:"create,extract" description:"Whether to create or extract an archive"`
+	ArchivePath string   `json:"archive_path" description:"Path of the archive (.zip, .tar.gz or .tgz)"`
+	Paths       []string `json:"paths,omitempty" description:"Files or directories to include (required for create)"`
+	DestDir     string   `json:"dest_dir,omitempty" description:"Directory to extract into (extract only)"`
+	Overwrite   bool     `json:"overwrite,omitempty" description:"Overwrite existing files (default: false)"`
+}
+
+type ArchiveTool struct {
+	workDir string
+	roots   []string // other directories it may use, see resolvePath
+}
+
+func NewArchiveTool(workDir string, roots ...string) *ArchiveTool {
+	return &ArchiveTool{
+		workDir: workDir,
+		roots:   roots,
+	}
+}
+
+func (t *ArchiveTool) Name() string {
+	return "archive"
+}
+
+func (t *ArchiveTool) Description() string {
+	return `Create or extract zip and tar.gz archives inside the working directory.
+
+Usage:
+- action "create": pack the given files/directories into archive_path
+- action "extract": unpack archive_path into dest_dir (defaults to the archive's directory)
+- The format is chosen from the extension: .zip, .tar.gz or .tgz
+
+Entries that would escape the destination directory are rejected.`
+}
+
+func (t *ArchiveTool) Risk() Risk {
+	return RiskWrite
+}
+
+// Paths returns the archive a create call writes, or the files an extract
+// call would write, so permission rules on paths cover every entry
+func (t *ArchiveTool) Paths(ctx context.Context, args archiveArgs) ([]string, error) {
+	absArchive, err := resolvePath(t.workDir, args.ArchivePath, t.roots...)
+	if err != nil {
+		return nil, err
+	}
+	if args.Action != "extract" {
+		return []string{absArchive}, nil
+	}
+	format, err := archiveFormat(absArchive)
+	if err != nil {
+		return nil, err
+	}
+	absDest, err := resolvePath(t.workDir, cmp.Or(args.DestDir, filepath.Dir(absArchive)), t.roots...)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	if format == "zip" {
+		names, err = zipEntryNames(absArchive)
+	} else {
+		names, err = tarGzEntryNames(absArchive)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read archive: %w", err)
+	}
+	x := &extractor{destDir: absDest}
+	paths := []string{absDest}
+	for _, name := range names {
+		target, err := x.target(name)
+		if err != nil {
+			return nil, err
+		}
+		paths = append(paths, target)
+	}
+	return paths, nil
+}
+
+func (t *ArchiveTool) Run(ctx context.Context, args archiveArgs) (string, error) {
+	archivePath := args.ArchivePath
+	if archivePath == "" {
+		return "", fmt.Errorf("archive_path is required")
+	}
+
+	absArchive, err := resolvePath(t.workDir, archivePath, t.roots...)
+	if err != nil {
+		return "", err
+	}
+
+	format, err := archiveFormat(absArchive)
+	if err != nil {
+		return "", err
+	}
+
+	overwrite := args.Overwrite
+
+	switch action := args.Action; action {
+	case "create":
+		paths := args.Paths
+		if len(paths) == 0 {
+			return "", fmt.Errorf("paths is required for create")
+		}
+		return t.create(ctx, absArchive, format, paths, overwrite)
+
+	case "extract":
+		destDir := cmp.Or(args.DestDir, filepath.Dir(absArchive))
+		absDest, err := resolvePath(t.workDir, destDir, t.roots...)
+		if err != nil {
+			return "", err
+		}
+		return t.extract(ctx, absArchive, format, absDest, overwrite)
+
+	default:
+		return "", fmt.Errorf("action must be \"create\" or \"extract\", got %q", action)
+	}
+}
+
+func archiveFormat(path string) (string, error) {
+	lower := strings.ToLower(path)
+	switch {
+	case strings.HasSuffix(lower, ".zip"):
+		return "zip", nil
+	case strings.HasSuffix(lower, ".tar.gz"), strings.HasSuffix(lower, ".tgz"):
+		return "tar.gz", nil
+	}
+	return "", fmt.Errorf("unsupported archive format: %s (use .zip, .tar.gz or .tgz)", filepath.Base(path))
+}
+
+// archiveEntry is a file to be packed, with its name inside the archive
+type archiveEntry struct {
+	path string
+	name string
+	info fs.FileInfo
+}
+
+func (t *ArchiveTool) create(ctx context.Context, absArchive, format string, paths []string, overwrite bool) (string, error) {
+	if _, err := os.Stat(absArchive); err == nil && !overwrite {
+		return "", fmt.Errorf("archive already exists: %s (set overwrite to replace it)", t.relPath(absArchive))
+	}
+
+	var entries []archiveEntry
+	var totalSize int64
+	for _, p := range paths {
+		absPath, err := resolvePath(t.workDir, p, t.roots...)
+		if err != nil {
+			return "", err
+		}
+
+		// Entries are named relative to the parent of each given path, so
+		// packing "src" yields "src/main.go"
+		base := filepath.Dir(absPath)
+		err = filepath.WalkDir(absPath, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if path == absArchive {
+				return nil
+			}
+			if d.Type()&fs.ModeSymlink != 0 {
+				return nil
+			}
+
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+
+			name, err := filepath.Rel(base, path)
+			if err != nil {
+				return err
+			}
+
+			entries = append(entries, archiveEntry{path: path, name: filepath.ToSlash(name), info: info})
+			if !d.IsDir() {
+				totalSize += info.Size()
+			}
+			if len(entries) > maxArchiveEntries {
+				return fmt.Errorf("too many entries (max %d)", maxArchiveEntries)
+			}
+			if totalSize > maxArchiveTotalSize {
+				return fmt.Errorf("archive contents too large (max %d bytes)", maxArchiveTotalSize)
+			}
+			return ctx.Err()
+		})
+		if err != nil {
+			return "", fmt.Errorf("failed to collect %s: %w", p, err)
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(absArchive), 0755); err != nil {
+		return "", fmt.Errorf("failed to create parent directories: %w", err)
+	}
+
+	file, err := os.Create(absArchive)
+	if err != nil {
+		return "", fmt.Errorf("failed to create archive: %w", err)
+	}
+
+	if format == "zip" {
+		err = writeZip(file, entries)
+	} else {
+		err = writeTarGz(file, entries)
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(absArchive)
+		return "", fmt.Errorf("failed to write archive: %w", err)
+	}
+
+	files := 0
+	for _, e := range entries {
+		if !e.info.IsDir() {
+			files++
+		}
+	}
+
+	return fmt.Sprintf("Created %s archive: %s\nFiles: %d\nUncompressed size: %s\n",
+		format, t.relPath(absArchive), files, display.Size(totalSize)), nil
+}
+
+func writeZip(w io.Writer, entries []archiveEntry) error {
+	zw := zip.NewWriter(w)
+	for _, e := range entries {
+		header, err := zip.FileInfoHeader(e.info)
+		if err != nil {
+			return err
+		}
+		header.Name = e.name
+		if e.info.IsDir() {
+			header.Name += "/"
+		} else {
+			header.Method = zip.Deflate
+		}
+
+		writer, err := zw.CreateHeader(header)
+		if err != nil {
+			return err
+		}
+		if e.info.IsDir() {
+			continue
+		}
+		if err := copyFileTo(writer, e.path); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+func writeTarGz(w io.Writer, entries []archiveEntry) error {
+	gw := gzip.NewWriter(w)
+	tw := tar.NewWriter(gw)
+	for _, e := range entries {
+		header, err := tar.FileInfoHeader(e.info, "")
+		if err != nil {
+			return err
+		}
+		header.Name = e.name
+		if e.info.IsDir() {
+			header.Name += "/"
+		}
+
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		if e.info.IsDir() {
+			continue
+		}
+		if err := copyFileTo(tw, e.path); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gw.Close()
+}
+
+func copyFileTo(w io.Writer, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(w, f)
+	return err
+}
+
+// extractor writes archive entries into destDir, enforcing traversal and
+// size limits
+type extractor struct {
+	destDir   string
+	overwrite bool
+	files     int
+	total     int64
+	skipped   []string
+}
+
+func (t *ArchiveTool) extract(ctx context.Context, absArchive, format, absDest string, overwrite bool) (string, error) {
+	if _, err := os.Stat(absArchive); err != nil {
+		if os.IsNotExist(err) {
+			return "", fmt.Errorf("archive not found: %s", t.relPath(absArchive))
+		}
+		return "", fmt.Errorf("failed to stat archive: %w", err)
+	}
+
+	if err := os.MkdirAll(absDest, 0755); err != nil {
+		return "", fmt.Errorf("failed to create destination: %w", err)
+	}
+
+	x := &extractor{destDir: absDest, overwrite: overwrite}
+	var err error
+	if format == "zip" {
+		err = x.extractZip(ctx, absArchive)
+	} else {
+		err = x.extractTarGz(ctx, absArchive)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to extract archive: %w", err)
+	}
+
+	var output strings.Builder
+	output.WriteString(fmt.Sprintf("Extracted %s into %s\n", t.relPath(absArchive), t.relPath(absDest)))
+	output.WriteString(fmt.Sprintf("Files: %d\n", x.files))
+	output.WriteString(fmt.Sprintf("Size: %s\n", display.Size(x.total)))
+	if len(x.skipped) > 0 {
+		output.WriteString(fmt.Sprintf("\nSkipped %d entries:\n", len(x.skipped)))
+		for _, s := range x.skipped {
+			output.WriteString(fmt.Sprintf("  %s\n", s))
+		}
+	}
+	return output.String(), nil
+}
+
+// target returns the destination path for an entry name, rejecting names
+// that are absolute or climb out of the destination directory
+func (x *extractor) target(name string) (string, error) {
+	cleaned := filepath.Clean(filepath.FromSlash(name))
+	if filepath.IsAbs(cleaned) || filepath.VolumeName(cleaned) != "" {
+		return "", fmt.Errorf("illegal absolute path in archive: %s", name)
+	}
+
+	target := filepath.Join(x.destDir, cleaned)
+	rel, err := filepath.Rel(x.destDir, target)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("illegal path traversal in archive: %s", name)
+	}
+	// A symlink already in the destination must not lead the file out of it
+	if _, err := resolvePath(x.destDir, cleaned); err != nil {
+		return "", fmt.Errorf("illegal path in archive: %s leads outside the destination", name)
+	}
+	return target, nil
+}
+
+// writeFile writes an entry to target. What is already there is removed
+// rather than written through, and the file is created exclusively, so
+// neither a symlink nor a hard link there can lead the write elsewhere.
+func (x *extractor) writeFile(target string, r io.Reader, mode fs.FileMode) error {
+	if info, err := os.Lstat(target); err == nil {
+		if !x.overwrite {
+			return fmt.Errorf("file already exists: %s (set overwrite to replace it)", target)
+		}
+		if info.IsDir() {
+			return fmt.Errorf("cannot replace directory %s with a file", target)
+		}
+		if err := os.Remove(target); err != nil {
+			return err
+		}
+	}
+	dir := filepath.Dir(target)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	// The directories may have changed since target checked them
+	realDest, err := filepath.EvalSymlinks(x.destDir)
+	if err != nil {
+		return err
+	}
+	realDir, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return err
+	}
+	if !within(realDest, realDir) {
+		return fmt.Errorf("illegal path in archive: %s leads outside the destination", target)
+	}
+
+	f, err := os.OpenFile(target, os.O_CREATE|os.O_EXCL|os.O_WRONLY, mode.Perm()|0600)
+	if err != nil {
+		return err
+	}
+
+	remaining := maxArchiveTotalSize - x.total
+	n, err := io.Copy(f, io.LimitReader(r, remaining+1))
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	x.total += n
+	if x.total > maxArchiveTotalSize {
+		return fmt.Errorf("extracted contents exceed %d bytes", maxArchiveTotalSize)
+	}
+	x.files++
+	if x.files > maxArchiveEntries {
+		return fmt.Errorf("too many entries (max %d)", maxArchiveEntries)
+	}
+	return nil
+}
+
+func (x *extractor) extractZip(ctx context.Context, path string) error {
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+
+	for _, f := range zr.File {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		target, err := x.target(f.Name)
+		if err != nil {
+			return err
+		}
+
+		mode := f.Mode()
+		switch {
+		case mode.IsDir():
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return err
+			}
+		case mode.IsRegular():
+			rc, err := f.Open()
+			if err != nil {
+				return err
+			}
+			err = x.writeFile(target, rc, mode)
+			rc.Close()
+			if err != nil {
+				return err
+			}
+		default:
+			x.skipped = append(x.skipped, f.Name+" (not a regular file)")
+		}
+	}
+	return nil
+}
+
+func (x *extractor) extractTarGz(ctx context.Context, path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	gr, err := gzip.NewReader(file)
+	if err != nil {
+		return err
+	}
+	defer gr.Close()
+
+	tr := tar.NewReader(gr)
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		target, err := x.target(header.Name)
+		if err != nil {
+			return err
+		}
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := x.writeFile(target, tr, header.FileInfo().Mode()); err != nil {
+				return err
+			}
+		default:
+			// Links and devices could point outside the destination
+			x.skipped = append(x.skipped, header.Name+" (not a regular file)")
+		}
+	}
+}
+
+// zipEntryNames lists the names of the entries in a zip archive
+func zipEntryNames(path string) ([]string, error) {
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+
+	names := make([]string, 0, len(zr.File))
+	for _, f := range zr.File {
+		names = append(names, f.Name)
+	}
+	return names, nil
+}
+
+// tarGzEntryNames lists the names of the entries in a tar.gz archive
+func tarGzEntryNames(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	gr, err := gzip.NewReader(file)
+	if err != nil {
+		return nil, err
+	}
+	defer gr.Close()
+
+	var names []string
+	tr := tar.NewReader(gr)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return names, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, header.Name)
+		if len(names) > maxArchiveEntries {
+			return nil, fmt.Errorf("too many entries (max %d)", maxArchiveEntries)
+		}
+	}
+}
+
+func (t *ArchiveTool) relPath(path string) string {
+	if rel, err := filepath.Rel(t.workDir, path); err == nil {
+		return rel
+	}
+	return path
+}
@@ -0,0 +1,170 @@
+package tools
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestExtractorTarget(t *testing.T) {
+	base := t.TempDir()
+	dest := filepath.Join(base, "dest")
+	outside := filepath.Join(base, "outside")
+	for _, dir := range []string{dest, outside} {
+		if err := os.Mkdir(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink(outside, filepath.Join(dest, "escape")); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		entry string
+		want  string // empty when the entry must be rejected
+	}{
+		{"plain", "a/b.txt", filepath.Join(dest, "a/b.txt")},
+		{"dot segments inside", "a/../b.txt", filepath.Join(dest, "b.txt")},
+		{"parent", "../x", ""},
+		{"nested climb", "a/../../x", ""},
+		{"prefix sibling", "../dest2/x", ""},
+		{"absolute", "/etc/passwd", ""},
+		{"through symlink", "escape/x", ""},
+	}
+	x := &extractor{destDir: dest}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := x.target(tt.entry)
+			if tt.want == "" {
+				if err == nil {
+					t.Fatalf("target(%q) = %q, want an error", tt.entry, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("target(%q): %v", tt.entry, err)
+			}
+			if got != tt.want {
+				t.Errorf("target(%q) = %q, want %q", tt.entry, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExtractTraversal(t *testing.T) {
+	tests := []struct {
+		name  string
+		entry string
+		ok    bool
+	}{
+		{"plain", "a/b.txt", true},
+		{"parent", "../evil.txt", false},
+		{"nested climb", "a/../../evil.txt", false},
+		{"absolute", "/tmp/evil.txt", false},
+	}
+	formats := map[string]func(t *testing.T, path, entry string){
+		"zip":    writeTestZip,
+		"tar.gz": writeTestTarGz,
+	}
+	for format, write := range formats {
+		for _, tt := range tests {
+			t.Run(format+"/"+tt.name, func(t *testing.T) {
+				base := t.TempDir()
+				dest := filepath.Join(base, "dest")
+				archive := filepath.Join(base, "test."+format)
+				write(t, archive, tt.entry)
+
+				x := &extractor{destDir: dest}
+				if err := os.Mkdir(dest, 0755); err != nil {
+					t.Fatal(err)
+				}
+				var err error
+				if format == "zip" {
+					err = x.extractZip(context.Background(), archive)
+				} else {
+					err = x.extractTarGz(context.Background(), archive)
+				}
+				if tt.ok != (err == nil) {
+					t.Fatalf("extracting %q: got error %v, want ok=%v", tt.entry, err, tt.ok)
+				}
+				if _, err := os.Stat(filepath.Join(base, "evil.txt")); err == nil {
+					t.Errorf("extracting %q wrote outside the destination", tt.entry)
+				}
+			})
+		}
+	}
+}
+
+// TestExtractSymlinkedDir checks that a file can't be written through a
+// directory that was replaced by a symlink after the archive was listed
+func TestExtractSymlinkedDir(t *testing.T) {
+	base := t.TempDir()
+	dest := filepath.Join(base, "dest")
+	outside := filepath.Join(base, "outside")
+	for _, dir := range []string{dest, outside} {
+		if err := os.Mkdir(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink(outside, filepath.Join(dest, "a")); err != nil {
+		t.Fatal(err)
+	}
+
+	x := &extractor{destDir: dest}
+	if err := x.writeFile(filepath.Join(dest, "a", "b.txt"), nil, 0644); err == nil {
+		t.Fatal("writeFile through a symlinked directory succeeded")
+	}
+	if _, err := os.Stat(filepath.Join(outside, "b.txt")); err == nil {
+		t.Error("writeFile wrote outside the destination")
+	}
+}
+
+func writeTestZip(t *testing.T, path, entry string) {
+	t.Helper()
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	zw := zip.NewWriter(f)
+	w, err := zw.Create(entry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write([]byte("data")); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func writeTestTarGz(t *testing.T, path, entry string) {
+	t.Helper()
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	gw := gzip.NewWriter(f)
+	tw := tar.NewWriter(gw)
+	data := []byte("data")
+	header := &tar.Header{Name: entry, Mode: 0644, Size: int64(len(data)), Typeflag: tar.TypeReg}
+	if err := tw.WriteHeader(header); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tw.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gw.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
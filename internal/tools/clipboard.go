@@ -0,0 +1,107 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/omnitrix-sh/core.sh/internal/clipboard"
+)
+
+const maxClipboardSize = 1024 * 1024 // 1MB
+
+// ClipboardTool reads from and writes to the system clipboard. Reading and
+// writing are separately permitted since either can leak data.
+type ClipboardTool struct {
+	allowRead  bool
+	allowWrite bool
+}
+
+func NewClipboardTool(allowRead, allowWrite bool) *ClipboardTool {
+	return &ClipboardTool{
+		allowRead:  allowRead,
+		allowWrite: allowWrite,
+	}
+}
+
+func (t *ClipboardTool) Name() string {
+	return "clipboard"
+}
+
+func (t *ClipboardTool) Description() string {
+	return `Read from or write to the user's system clipboard.
+
+Usage:
+- action "read" returns the current clipboard text
+- action "write" replaces the clipboard with the given content
+
+Use this when the user refers to code "on my clipboard" or asks you to copy a result for them.`
+}
+
+func (t *ClipboardTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"action": map[string]interface{}{
+				"type":        "string",
+				"enum":        []string{"read", "write"},
+				"description": "Whether to read from or write to the clipboard",
+			},
+			"content": map[string]interface{}{
+				"type":        "string",
+				"description": "Text to copy to the clipboard (required for write)",
+			},
+		},
+		"required": []string{"action"},
+	}
+}
+
+func (t *ClipboardTool) Risk() Risk {
+	return RiskWrite
+}
+
+func (t *ClipboardTool) Execute(ctx context.Context, args map[string]interface{}) (string, error) {
+	switch action := GetStringArg(args, "action", ""); action {
+	case "read":
+		if !t.allowRead {
+			return "", fmt.Errorf("access denied: reading the clipboard is not permitted")
+		}
+
+		text, err := clipboard.Read(ctx)
+		if err != nil {
+			return "", fmt.Errorf("failed to read clipboard: %w", err)
+		}
+		if text == "" {
+			return "Clipboard is empty.", nil
+		}
+		if len(text) > maxClipboardSize {
+			return "", fmt.Errorf("clipboard contents too large (%d bytes, max %d bytes)", len(text), maxClipboardSize)
+		}
+
+		var output strings.Builder
+		output.WriteString(fmt.Sprintf("Clipboard (%d lines):\n\n", strings.Count(text, "\n")+1))
+		output.WriteString(text)
+		return output.String(), nil
+
+	case "write":
+		if !t.allowWrite {
+			return "", fmt.Errorf("access denied: writing the clipboard is not permitted")
+		}
+
+		content, ok := args["content"].(string)
+		if !ok {
+			return "", fmt.Errorf("content is required for write")
+		}
+		if len(content) > maxClipboardSize {
+			return "", fmt.Errorf("content too large (%d bytes, max %d bytes)", len(content), maxClipboardSize)
+		}
+
+		if err := clipboard.Write(ctx, content); err != nil {
+			return "", fmt.Errorf("failed to write clipboard: %w", err)
+		}
+		return fmt.Sprintf("Copied %d bytes to the clipboard.", len(content)), nil
+
+	default:
+		return "", fmt.Errorf("action must be \"read\" or \"write\", got %q", action)
+	}
+}
@@ -0,0 +1,184 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/omnitrix-sh/core.sh/pkg/models"
+)
+
+// commandPlaceholder matches {{name}} in a command tool's command
+var commandPlaceholder = regexp.MustCompile(`\{\{\s*([A-Za-z_][A-Za-z0-9_]*)\s*\}\}`)
+
+// toolName is what a tool may be called, as providers accept it
+var toolName = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// CommandTool runs a command defined in the config, like "run the
+// integration tests", through the exec tool so it gets the same shell,
+// sandbox and limits. Its arguments are put into the command, or passed
+// as JSON on standard input.
+type CommandTool struct {
+	name string
+	cfg  models.CommandToolConfig
+	risk Risk
+	exec *ExecTool
+}
+
+// NewCommandTool creates the tool named name from its config
+func NewCommandTool(name string, cfg models.CommandToolConfig, exec *ExecTool) (*CommandTool, error) {
+	if err := ValidateCommandTool(name, cfg); err != nil {
+		return nil, err
+	}
+	risk := Risk(cfg.Risk)
+	// A project's command is a shell command like any other, and must not
+	// run unasked for claiming to only read
+	if risk == "" || cfg.Project && (risk == RiskRead || risk == RiskWrite) {
+		risk = RiskExecute
+	}
+	return &CommandTool{name: name, cfg: cfg, risk: risk, exec: exec}, nil
+}
+
+// ValidateCommandTool checks a command tool's config: its name must not
+// clash with a built-in tool, its parameters must be an object schema and
+// its command may only use the arguments it declares
+func ValidateCommandTool(name string, cfg models.CommandToolConfig) error {
+	if !toolName.MatchString(name) {
+		return fmt.Errorf("command tool %q: names may only contain letters, digits, _ and -", name)
+	}
+	if _, ok := builtins[name]; ok {
+		return fmt.Errorf("command tool %q: there is a built-in tool of that name", name)
+	}
+	if strings.TrimSpace(cfg.Command) == "" {
+		return fmt.Errorf("command tool %q: command is required", name)
+	}
+	switch Risk(cfg.Risk) {
+	case "", RiskRead, RiskWrite, RiskExecute, RiskNetwork:
+	default:
+		return fmt.Errorf("command tool %q: invalid risk %q", name, cfg.Risk)
+	}
+	declared := make(map[string]bool, len(cfg.Args))
+	for arg := range cfg.Args {
+		declared[arg] = true
+	}
+	if cfg.Parameters != nil {
+		if len(cfg.Args) > 0 {
+			return fmt.Errorf("command tool %q: set either args or parameters, not both", name)
+		}
+		if typ, _ := cfg.Parameters["type"].(string); typ != "object" {
+			return fmt.Errorf("command tool %q: parameters must be a schema of type object", name)
+		}
+		properties, ok := cfg.Parameters["properties"].(map[string]interface{})
+		if _, set := cfg.Parameters["properties"]; set && !ok {
+			return fmt.Errorf("command tool %q: parameters.properties must be an object", name)
+		}
+		for arg := range properties {
+			declared[arg] = true
+		}
+		for _, arg := range stringList(cfg.Parameters["required"]) {
+			if !declared[arg] {
+				return fmt.Errorf("command tool %q: parameter %q is required but not among the properties", name, arg)
+			}
+		}
+	}
+	for _, match := range commandPlaceholder.FindAllStringSubmatch(cfg.Command, -1) {
+		if !declared[match[1]] {
+			return fmt.Errorf("command tool %q: command uses undeclared argument %q", name, match[1])
+		}
+	}
+	return nil
+}
+
+func (t *CommandTool) Name() string {
+	return t.name
+}
+
+func (t *CommandTool) Description() string {
+	if t.cfg.Description != "" {
+		return t.cfg.Description
+	}
+	return "Run: " + t.cfg.Command
+}
+
+func (t *CommandTool) Parameters() map[string]interface{} {
+	if t.cfg.Parameters != nil {
+		return t.cfg.Parameters
+	}
+	properties := make(map[string]interface{}, len(t.cfg.Args))
+	required := make([]string, 0, len(t.cfg.Args))
+	for name, description := range t.cfg.Args {
+		properties[name] = map[string]interface{}{
+			"type":        "string",
+			"description": description,
+		}
+		required = append(required, name)
+	}
+	sort.Strings(required)
+	return map[string]interface{}{
+		"type":       "object",
+		"properties": properties,
+		"required":   required,
+	}
+}
+
+func (t *CommandTool) Risk() Risk {
+	return t.risk
+}
+
+func (t *CommandTool) Execute(ctx context.Context, args map[string]interface{}) (string, error) {
+	required := stringList(t.Parameters()["required"])
+	var missing []string
+	command := commandPlaceholder.ReplaceAllStringFunc(t.cfg.Command, func(placeholder string) string {
+		name := commandPlaceholder.FindStringSubmatch(placeholder)[1]
+		value := args[name]
+		if value == nil {
+			if contains(required, name) {
+				missing = append(missing, name)
+			}
+			return ""
+		}
+		return shellQuote(commandArg(value))
+	})
+	if len(missing) > 0 {
+		return "", fmt.Errorf("missing arguments: %s", strings.Join(missing, ", "))
+	}
+
+	if t.cfg.Stdin {
+		if args == nil {
+			args = map[string]interface{}{}
+		}
+		input, err := json.Marshal(args)
+		if err != nil {
+			return "", fmt.Errorf("failed to encode arguments: %w", err)
+		}
+		// Piped in by the shell, so it reaches sandboxed commands too
+		command = fmt.Sprintf("printf '%%s\\n' %s | {\n%s\n}", shellQuote(string(input)), command)
+	}
+	return t.exec.Run(ctx, execArgs{Command: command})
+}
+
+// commandArg renders an argument for the command line: strings, numbers
+// and booleans as they are, lists and objects as JSON
+func commandArg(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case map[string]interface{}, []interface{}:
+		data, err := json.Marshal(v)
+		if err == nil {
+			return string(data)
+		}
+	}
+	return fmt.Sprint(value)
+}
+
+// shellQuote quotes s as a single word for POSIX shells
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
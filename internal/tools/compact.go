@@ -0,0 +1,70 @@
+package tools
+
+import (
+	"strings"
+
+	"github.com/omnitrix-sh/core.sh/pkg/models"
+)
+
+// maxCompactDescription caps the one-line description of a compact schema
+const maxCompactDescription = 120
+
+// ToCompactModelTool converts a Tool to a models.Tool with a one-line
+// description and no parameter docs. Types, enums and required fields are
+// kept, which is enough for capable models to call the tool correctly.
+func ToCompactModelTool(t Tool) models.Tool {
+	return models.Tool{
+		Type: "function",
+		Function: models.ToolFunction{
+			Name:        t.Name(),
+			Description: compactDescription(t.Description()),
+			Parameters:  compactSchema(t.Parameters()),
+		},
+	}
+}
+
+// compactDescription returns the first sentence of a description
+func compactDescription(desc string) string {
+	desc = strings.TrimSpace(desc)
+	if i := strings.Index(desc, "\n"); i >= 0 {
+		desc = desc[:i]
+	}
+	if i := strings.Index(desc, ". "); i >= 0 {
+		desc = desc[:i+1]
+	}
+	if runes := []rune(desc); len(runes) > maxCompactDescription {
+		desc = string(runes[:maxCompactDescription-3]) + "..."
+	}
+	return desc
+}
+
+// compactSchema returns a copy of a JSON schema without descriptions
+func compactSchema(schema map[string]interface{}) map[string]interface{} {
+	compact := make(map[string]interface{}, len(schema))
+	for key, val := range schema {
+		switch key {
+		case "description", "examples":
+			continue
+		case "properties":
+			if props, ok := val.(map[string]interface{}); ok {
+				compactProps := make(map[string]interface{}, len(props))
+				for name, prop := range props {
+					if p, ok := prop.(map[string]interface{}); ok {
+						compactProps[name] = compactSchema(p)
+					} else {
+						compactProps[name] = prop
+					}
+				}
+				compact[key] = compactProps
+				continue
+			}
+		case "items":
+			if items, ok := val.(map[string]interface{}); ok {
+				compact[key] = compactSchema(items)
+				continue
+			}
+		}
+		compact[key] = val
+	}
+	return compact
+}
@@ -0,0 +1,90 @@
+package tools
+
+import (
+	"context"
+	"io"
+	"sync"
+
+	"github.com/omnitrix-sh/core.sh/pkg/models"
+)
+
+type sessionKey struct{}
+
+// WithSessionID returns a context identifying the session tools run for, so
+// tools that keep state, like the exec tool's shell, keep it per session
+func WithSessionID(ctx context.Context, sessionID string) context.Context {
+	return context.WithValue(ctx, sessionKey{}, sessionID)
+}
+
+// SessionIDFromContext returns the session ID set with WithSessionID
+func SessionIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(sessionKey{}).(string)
+	return id
+}
+
+type changesKey struct{}
+
+// WithChangeRecorder returns a context that has tools executed with it call
+// record with the absolute path of every file they write
+func WithChangeRecorder(ctx context.Context, record func(path string)) context.Context {
+	return context.WithValue(ctx, changesKey{}, record)
+}
+
+// recordChange reports a written file to the context's recorder, if any
+func recordChange(ctx context.Context, path string) {
+	if record, ok := ctx.Value(changesKey{}).(func(string)); ok {
+		record(path)
+	}
+}
+
+type imagesKey struct{}
+
+// WithImageAttacher returns a context that has tools executed with it hand
+// images they read to attach, to be shown to the model along with their
+// result. Without one, as for a model that can't see images, tools say
+// what the image is instead.
+func WithImageAttacher(ctx context.Context, attach func(models.ImagePart)) context.Context {
+	return context.WithValue(ctx, imagesKey{}, attach)
+}
+
+// attachImage hands an image to the context's attacher and reports whether
+// there was one
+func attachImage(ctx context.Context, image models.ImagePart) bool {
+	attach, ok := ctx.Value(imagesKey{}).(func(models.ImagePart))
+	if ok {
+		attach(image)
+	}
+	return ok
+}
+
+type outputKey struct{}
+
+// WithOutputStream returns a context that has long-running tools executed
+// with it, such as exec, pass their output to stream as it is produced, so
+// frontends can show progress. Their result still holds all of it.
+func WithOutputStream(ctx context.Context, stream func(chunk string)) context.Context {
+	return context.WithValue(ctx, outputKey{}, stream)
+}
+
+// outputStream returns a writer passing what is written to the context's
+// output stream, or nil if it has none. It can be written to concurrently,
+// as a command's stdout and stderr are.
+func outputStream(ctx context.Context) io.Writer {
+	stream, ok := ctx.Value(outputKey{}).(func(string))
+	if !ok {
+		return nil
+	}
+	return &streamWriter{stream: stream}
+}
+
+type streamWriter struct {
+	mu     sync.Mutex
+	stream func(string)
+}
+
+func (w *streamWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.stream(string(p))
+	return len(p), nil
+}
@@ -0,0 +1,144 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/omnitrix-sh/core.sh/internal/depgraph"
+	"github.com/omnitrix-sh/core.sh/internal/display"
+)
+
+type DepGraphTool struct {
+	workDir string
+}
+
+func NewDepGraphTool(workDir string) *DepGraphTool {
+	return &DepGraphTool{
+		workDir: workDir,
+	}
+}
+
+func (t *DepGraphTool) Name() string {
+	return "dep_graph"
+}
+
+func (t *DepGraphTool) Description() string {
+	return `Analyze the import graph between packages in the workspace to assess the blast radius of a change.
+
+Usage:
+- action "dependents": what imports the given package (e.g. "what depends on internal/db")
+- action "dependencies": what the given package imports
+- action "overview": every package with its import and dependent counts
+- Set transitive to follow the graph all the way instead of one level
+
+Go packages are identified by directory (or full import path); JavaScript/TypeScript modules by file path.`
+}
+
+func (t *DepGraphTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"action": map[string]interface{}{
+				"type":        "string",
+				"enum":        []string{"dependents", "dependencies", "overview"},
+				"description": "Query to run",
+			},
+			"package": map[string]interface{}{
+				"type":        "string",
+				"description": "Package directory, import path or module file (required except for overview)",
+			},
+			"transitive": map[string]interface{}{
+				"type":        "boolean",
+				"description": "Follow dependencies transitively (default: false)",
+			},
+			"include_tests": map[string]interface{}{
+				"type":        "boolean",
+				"description": "Include imports from test files (default: false)",
+			},
+		},
+		"required": []string{"action"},
+	}
+}
+
+func (t *DepGraphTool) Risk() Risk {
+	return RiskRead
+}
+
+func (t *DepGraphTool) Execute(ctx context.Context, args map[string]interface{}) (string, error) {
+	action := GetStringArg(args, "action", "")
+	transitive := GetBoolArg(args, "transitive", false)
+
+	graph, err := depgraph.Build(ctx, t.workDir, depgraph.Options{
+		IncludeTests: GetBoolArg(args, "include_tests", false),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to build dependency graph: %w", err)
+	}
+	if len(graph.Packages) == 0 {
+		return "No Go or JavaScript/TypeScript packages found in the workspace.", nil
+	}
+
+	var output strings.Builder
+
+	if action == "overview" {
+		if graph.Module != "" {
+			output.WriteString(fmt.Sprintf("Module: %s\n", graph.Module))
+		}
+		output.WriteString(fmt.Sprintf("Packages: %d\n\n", len(graph.Packages)))
+		var rows [][]string
+		for _, id := range graph.IDs() {
+			pkg := graph.Packages[id]
+			rows = append(rows, []string{
+				id,
+				strconv.Itoa(len(pkg.Imports)),
+				strconv.Itoa(graph.DependentCount(id)),
+				strconv.Itoa(len(pkg.External)),
+			})
+		}
+		output.WriteString(display.Table([]string{"PACKAGE", "IMPORTS", "DEPENDENTS", "EXTERNAL"}, rows))
+		return output.String(), nil
+	}
+
+	name := GetStringArg(args, "package", "")
+	if name == "" {
+		return "", fmt.Errorf("package is required for %s", action)
+	}
+	id, err := graph.Resolve(name)
+	if err != nil {
+		return "", err
+	}
+
+	scope := "Direct"
+	if transitive {
+		scope = "Transitive"
+	}
+
+	switch action {
+	case "dependents":
+		deps := graph.Dependents(id, transitive)
+		output.WriteString(fmt.Sprintf("%s dependents of %s: %d\n", scope, id, len(deps)))
+		for _, d := range deps {
+			output.WriteString(fmt.Sprintf("  %s\n", d))
+		}
+
+	case "dependencies":
+		deps := graph.Dependencies(id, transitive)
+		output.WriteString(fmt.Sprintf("%s workspace dependencies of %s: %d\n", scope, id, len(deps)))
+		for _, d := range deps {
+			output.WriteString(fmt.Sprintf("  %s\n", d))
+		}
+		if external := graph.Packages[id].External; len(external) > 0 {
+			output.WriteString(fmt.Sprintf("\nExternal imports of %s: %d\n", id, len(external)))
+			for _, e := range external {
+				output.WriteString(fmt.Sprintf("  %s\n", e))
+			}
+		}
+
+	default:
+		return "", fmt.Errorf("action must be dependents, dependencies or overview, got %q", action)
+	}
+
+	return output.String(), nil
+}
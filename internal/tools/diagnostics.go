@@ -0,0 +1,116 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/omnitrix-sh/core.sh/internal/lsp"
+)
+
+const maxDiagnostics = 100
+
+type diagnosticsArgs struct {
+	FilePaths       []string `json:"file_paths,omitempty" description:"Files to check"`
+	IncludeWarnings bool     `json:"include_warnings,omitempty" description:"Include warnings, infos and hints (default: false)"`
+}
+
+type DiagnosticsTool struct {
+	workDir string
+	roots   []string // other directories it may use, see resolvePath
+	lsp     *lsp.Manager
+}
+
+// NewDiagnosticsTool creates the tool on top of the configured language
+// servers
+func NewDiagnosticsTool(workDir string, manager *lsp.Manager, roots ...string) *DiagnosticsTool {
+	return &DiagnosticsTool{
+		workDir: workDir,
+		roots:   roots,
+		lsp:     manager,
+	}
+}
+
+// diagnosticsFromOptions leaves the tool out when no language servers are
+// configured
+func diagnosticsFromOptions(o Options) Tool {
+	if o.LSP == nil {
+		return nil
+	}
+	return Typed[diagnosticsArgs](NewDiagnosticsTool(o.WorkDir, o.LSP, o.Roots...))
+}
+
+func (t *DiagnosticsTool) Name() string {
+	return "diagnostics"
+}
+
+func (t *DiagnosticsTool) Description() string {
+	return `Report compile errors, type errors and warnings from the project's language servers.
+
+Usage:
+- Provide file paths to check them as they are on disk now
+- Without paths, lists what the servers last reported for files checked so far
+- Optionally include warnings and hints, which are left out by default
+
+Errors in files you edit are reported automatically; use this to check other files or see warnings.`
+}
+
+func (t *DiagnosticsTool) Risk() Risk {
+	return RiskRead
+}
+
+func (t *DiagnosticsTool) Run(ctx context.Context, args diagnosticsArgs) (string, error) {
+	paths := args.FilePaths
+	includeWarnings := args.IncludeWarnings
+
+	var diagnostics []lsp.Diagnostic
+	var checkErr error
+	if len(paths) == 0 {
+		diagnostics = t.lsp.Diagnostics()
+	} else {
+		var absPaths []string
+		for _, path := range paths {
+			absPath, err := resolvePath(t.workDir, path, t.roots...)
+			if err != nil {
+				return "", err
+			}
+			if !t.lsp.Handles(absPath) {
+				return "", fmt.Errorf("no language server is configured for %s", path)
+			}
+			absPaths = append(absPaths, absPath)
+		}
+		diagnostics, checkErr = t.lsp.Check(ctx, absPaths...)
+		if checkErr != nil && len(diagnostics) == 0 {
+			return "", checkErr
+		}
+	}
+
+	total := len(diagnostics)
+	if !includeWarnings {
+		diagnostics = lsp.Errors(diagnostics)
+	}
+
+	var output strings.Builder
+	switch {
+	case len(diagnostics) == 0 && total > len(diagnostics):
+		output.WriteString(fmt.Sprintf("No errors (%d warnings and hints left out).\n", total))
+	case len(diagnostics) == 0:
+		output.WriteString("No problems found.\n")
+	default:
+		shown := diagnostics
+		if len(shown) > maxDiagnostics {
+			shown = shown[:maxDiagnostics]
+		}
+		output.WriteString(lsp.Format(shown, t.workDir))
+		if len(diagnostics) > len(shown) {
+			output.WriteString(fmt.Sprintf("... and %d more\n", len(diagnostics)-len(shown)))
+		}
+		if hidden := total - len(diagnostics); hidden > 0 {
+			output.WriteString(fmt.Sprintf("(%d warnings and hints left out)\n", hidden))
+		}
+	}
+	if checkErr != nil {
+		output.WriteString(fmt.Sprintf("\nSome files could not be checked: %v\n", checkErr))
+	}
+	return output.String(), nil
+}
@@ -0,0 +1,203 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+type editFileArgs struct {
+	FilePath             string `json:"file_path" description:"Path to the file to edit (relative or absolute)"`
+	OldString            string `json:"old_string,omitempty" description:"Exact text to replace"`
+	NewString            string `json:"new_string" description:"Replacement text"`
+	ExpectedReplacements int    `json:"expected_replacements,omitempty" default:"1" description:"Number of occurrences of old_string to replace (default: 1)"`
+	StartLine            int    `json:"start_line,omitempty" description:"First line to replace, instead of old_string (1-based)"`
+	EndLine              int    `json:"end_line,omitempty" description:"Last line to replace, inclusive (default: start_line)"`
+}
+
+type EditFileTool struct {
+	workDir string
+	roots   []string // other directories it may use, see resolvePath
+}
+
+func NewEditFileTool(workDir string, roots ...string) *EditFileTool {
+	return &EditFileTool{
+		workDir: workDir,
+		roots:   roots,
+	}
+}
+
+func (t *EditFileTool) Name() string {
+	return "edit_file"
+}
+
+func (t *EditFileTool) Description() string {
+	return `Make a precise edit to an existing file and return a diff of the change.
+
+Usage:
+- Replace text: provide old_string exactly as it appears in the file, including indentation, and new_string to put in its place
+- old_string must match exactly once unless expected_replacements says how many occurrences to replace
+- Replace lines: provide start_line and end_line (1-based, inclusive) and new_string instead of old_string
+- An empty new_string deletes the matched text or lines
+
+Prefer this over write_file for changes to existing files. Read the file first so old_string matches it.`
+}
+
+func (t *EditFileTool) Risk() Risk {
+	return RiskWrite
+}
+
+// fileEdit is an edit worked out but not yet written
+type fileEdit struct {
+	absPath     string
+	displayPath string
+	perm        os.FileMode
+	content     string
+	updated     string
+	replaced    int
+}
+
+// edit works out the edit args describe
+func (t *EditFileTool) edit(args editFileArgs) (*fileEdit, error) {
+	filePath := args.FilePath
+	if filePath == "" {
+		return nil, fmt.Errorf("file_path is required")
+	}
+
+	absPath, err := resolvePath(t.workDir, filePath, t.roots...)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := os.Stat(absPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat file: %w", err)
+	}
+	if info.IsDir() {
+		return nil, fmt.Errorf("path is a directory, not a file: %s", filePath)
+	}
+	if info.Size() > maxFileSize {
+		return nil, fmt.Errorf("file too large (%d bytes, max %d bytes)", info.Size(), maxFileSize)
+	}
+
+	data, err := os.ReadFile(absPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+	e := &fileEdit{absPath: absPath, displayPath: filePath, perm: info.Mode().Perm(), content: string(data)}
+	if rel, err := filepath.Rel(t.workDir, absPath); err == nil {
+		e.displayPath = filepath.ToSlash(rel)
+	}
+
+	if args.StartLine > 0 {
+		endLine := args.EndLine
+		if endLine == 0 {
+			endLine = args.StartLine
+		}
+		e.updated, e.replaced, err = replaceLines(e.content, args.StartLine, endLine, args.NewString)
+	} else {
+		e.updated, e.replaced, err = replaceString(e.content, args.OldString, args.NewString, args.ExpectedReplacements)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// Preview returns the diff the edit would make
+func (t *EditFileTool) Preview(ctx context.Context, args editFileArgs) (string, error) {
+	e, err := t.edit(args)
+	if err != nil {
+		return "", err
+	}
+	return unifiedDiff(e.displayPath, e.content, e.updated, 3), nil
+}
+
+func (t *EditFileTool) Run(ctx context.Context, args editFileArgs) (string, error) {
+	e, err := t.edit(args)
+	if err != nil {
+		return "", err
+	}
+	if e.updated == e.content {
+		return fmt.Sprintf("No changes: the edit leaves %s unchanged.", args.FilePath), nil
+	}
+
+	if err := os.WriteFile(e.absPath, []byte(e.updated), e.perm); err != nil {
+		return "", fmt.Errorf("failed to write file: %w", err)
+	}
+	recordChange(ctx, e.absPath)
+
+	var output strings.Builder
+	output.WriteString(fmt.Sprintf("Edited file: %s\n", e.displayPath))
+	if args.StartLine > 0 {
+		output.WriteString(fmt.Sprintf("Replaced %d line(s)\n\n", e.replaced))
+	} else {
+		output.WriteString(fmt.Sprintf("Replaced %d occurrence(s)\n\n", e.replaced))
+	}
+	output.WriteString(unifiedDiff(e.displayPath, e.content, e.updated, 3))
+	return output.String(), nil
+}
+
+// replaceString replaces old with new, requiring exactly expected matches.
+// Files with CRLF line endings are matched with the strings converted to
+// them, since models almost always write plain newlines.
+func replaceString(content, old, new string, expected int) (string, int, error) {
+	if old == "" {
+		return "", 0, fmt.Errorf("old_string is required unless start_line is given")
+	}
+	if expected < 1 {
+		expected = 1
+	}
+
+	count := strings.Count(content, old)
+	if count == 0 && strings.Contains(content, "\r\n") && !strings.Contains(old, "\r\n") {
+		old = strings.ReplaceAll(old, "\n", "\r\n")
+		new = strings.ReplaceAll(new, "\n", "\r\n")
+		count = strings.Count(content, old)
+	}
+
+	switch {
+	case count == 0:
+		return "", 0, fmt.Errorf("old_string not found in file; read the file and copy the text exactly, including whitespace")
+	case count != expected:
+		return "", 0, fmt.Errorf("old_string matches %d times but %d replacement(s) were expected; add surrounding lines to make it unique or set expected_replacements", count, expected)
+	}
+
+	return strings.ReplaceAll(content, old, new), count, nil
+}
+
+// replaceLines replaces lines start through end, 1-based and inclusive
+func replaceLines(content string, start, end int, replacement string) (string, int, error) {
+	lines := strings.SplitAfter(content, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	if end < start {
+		return "", 0, fmt.Errorf("end_line %d is before start_line %d", end, start)
+	}
+	if start > len(lines) || end > len(lines) {
+		return "", 0, fmt.Errorf("line range %d-%d is outside the file, which has %d lines", start, end, len(lines))
+	}
+
+	// Keep the replaced block's line ending so the file stays consistent
+	newline := "\n"
+	if strings.HasSuffix(lines[end-1], "\r\n") {
+		newline = "\r\n"
+	}
+	if replacement != "" && !strings.HasSuffix(replacement, "\n") && strings.HasSuffix(lines[end-1], "\n") {
+		replacement += newline
+	}
+
+	var out strings.Builder
+	for _, line := range lines[:start-1] {
+		out.WriteString(line)
+	}
+	out.WriteString(replacement)
+	for _, line := range lines[end:] {
+		out.WriteString(line)
+	}
+	return out.String(), end - start + 1, nil
+}
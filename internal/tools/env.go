@@ -0,0 +1,48 @@
+package tools
+
+import (
+	"context"
+	"os"
+	"sort"
+)
+
+type envKey struct{}
+
+// WithEnv returns a context carrying environment variables for the tools
+// executed with it, such as a session's DATABASE_URL pointing at a test
+// database
+func WithEnv(ctx context.Context, env map[string]string) context.Context {
+	if len(env) == 0 {
+		return ctx
+	}
+	return context.WithValue(ctx, envKey{}, env)
+}
+
+// EnvFromContext returns the environment variables set with WithEnv
+func EnvFromContext(ctx context.Context) map[string]string {
+	env, _ := ctx.Value(envKey{}).(map[string]string)
+	return env
+}
+
+// CommandEnv returns the environment for a command run by a tool: the
+// process environment with the context's variables added or overriding it.
+// Tools that run commands should set it as exec.Cmd.Env.
+func CommandEnv(ctx context.Context) []string {
+	env := EnvFromContext(ctx)
+	if len(env) == 0 {
+		return os.Environ()
+	}
+
+	names := make([]string, 0, len(env))
+	for name := range env {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	// Later entries win in exec, so overrides are appended
+	result := os.Environ()
+	for _, name := range names {
+		result = append(result, name+"="+env[name])
+	}
+	return result
+}
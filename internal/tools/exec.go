@@ -0,0 +1,432 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/omnitrix-sh/core.sh/internal/display"
+	"github.com/omnitrix-sh/core.sh/pkg/models"
+)
+
+const (
+	defaultExecTimeout   = 2 * time.Minute
+	maxExecTimeout       = 10 * time.Minute
+	defaultExecMaxOutput = 30000
+)
+
+// shellStateVars are maintained by the shell itself and never carried over
+var shellStateVars = map[string]bool{"PWD": true, "OLDPWD": true, "SHLVL": true, "_": true}
+
+type execArgs struct {
+	Command        string `json:"command" description:"The shell command to run"`
+	TimeoutSeconds int    `json:"timeout_seconds,omitempty" description:"Optional: seconds before the command is killed, see the default and maximum above"`
+}
+
+type ExecTool struct {
+	workDir    string
+	shell      string
+	timeout    time.Duration
+	maxOutput  int
+	persistent bool
+	sandbox    *sandbox // nil runs commands on the host
+
+	mu     sync.Mutex
+	shells map[string]*shellState // session ID -> state
+}
+
+// shellState is what a persistent shell carries between commands
+type shellState struct {
+	dir   string
+	env   map[string]string // variables changed by earlier commands
+	unset map[string]bool   // variables of the environment they unset
+}
+
+// NewExecTool creates the tool from the exec config. With Persistent set the
+// working directory and exported variables of a command carry over to the
+// next one in the same session, as in an interactive shell.
+func NewExecTool(workDir string, cfg models.ExecConfig) *ExecTool {
+	t := &ExecTool{
+		workDir:    workDir,
+		shell:      cfg.Shell,
+		timeout:    time.Duration(cfg.Timeout) * time.Second,
+		maxOutput:  cfg.MaxOutput,
+		persistent: cfg.Persistent,
+		sandbox:    newSandbox(workDir, cfg.Sandbox),
+		shells:     make(map[string]*shellState),
+	}
+	if t.shell == "" {
+		t.shell = "sh"
+		// Images may not have bash even when the host does
+		if _, err := exec.LookPath("bash"); err == nil && (t.sandbox == nil || !t.sandbox.isContainer()) {
+			t.shell = "bash"
+		}
+	}
+	if t.timeout <= 0 {
+		t.timeout = defaultExecTimeout
+	}
+	if t.maxOutput <= 0 {
+		t.maxOutput = defaultExecMaxOutput
+	}
+	return t
+}
+
+func (t *ExecTool) Name() string {
+	return "exec"
+}
+
+func (t *ExecTool) Description() string {
+	description := `Run a shell command in the working directory and return its exit code, stdout and stderr.
+
+Usage:
+- Provide the command to run, e.g. "go test ./..." or "ls -la src"
+- Commands run non-interactively; do not start editors or pagers
+- Long output is truncated in the middle, so filter it (e.g. with grep or tail) when you only need part of it
+- Optionally raise the timeout for slow commands such as full builds (default: %d seconds, max: %d)
+
+Prefer the dedicated file tools for reading and editing files.`
+	description = fmt.Sprintf(description, int(t.timeout.Seconds()), int(maxExecTimeout.Seconds()))
+	if t.sandbox != nil {
+		description += "\n\n" + t.sandbox.describe()
+	}
+	return description
+}
+
+// check returns what keeps the tool from running commands, and how to fix
+// it, or "" when it works
+func (t *ExecTool) check(ctx context.Context) (missing, fix string) {
+	if t.sandbox != nil {
+		if missing, fix := t.sandbox.check(ctx); missing != "" {
+			return missing, fix
+		}
+		// Containers run the image's shell
+		if t.sandbox.isContainer() {
+			return "", ""
+		}
+	}
+	if _, err := exec.LookPath(t.shell); err != nil {
+		return fmt.Sprintf("shell %s is not installed", t.shell), "install it or set exec.shell"
+	}
+	return "", ""
+}
+
+func (t *ExecTool) Risk() Risk {
+	return RiskExecute
+}
+
+func (t *ExecTool) Run(ctx context.Context, args execArgs) (string, error) {
+	command := args.Command
+	if strings.TrimSpace(command) == "" {
+		return "", fmt.Errorf("command is required")
+	}
+
+	timeout := t.timeout
+	if args.TimeoutSeconds > 0 {
+		timeout = time.Duration(args.TimeoutSeconds) * time.Second
+	}
+	if timeout > maxExecTimeout {
+		timeout = maxExecTimeout
+	}
+
+	sessionID := SessionIDFromContext(ctx)
+	state := t.state(sessionID)
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	script := command
+	var stateDir string
+	if t.persistent {
+		dir, err := os.MkdirTemp("", "omnitrix-exec-")
+		if err != nil {
+			return "", fmt.Errorf("failed to create shell state directory: %w", err)
+		}
+		defer os.RemoveAll(dir)
+		stateDir = dir
+
+		// Record the directory and environment however the command exits
+		script = fmt.Sprintf("trap 'pwd > %q; env -0 > %q' EXIT\n%s",
+			filepath.Join(dir, "pwd"), filepath.Join(dir, "env"), command)
+	}
+
+	base := CommandEnv(ctx)
+	var cmd *exec.Cmd
+	if t.sandbox != nil {
+		// The sandbox has its own environment; only the session's variables
+		// are passed in
+		vars := make(map[string]string)
+		for name, value := range EnvFromContext(ctx) {
+			if !state.unset[name] {
+				vars[name] = value
+			}
+		}
+		for name, value := range state.env {
+			vars[name] = value
+		}
+		var mounts []string
+		if stateDir != "" {
+			mounts = append(mounts, stateDir)
+		}
+		sandboxed, cleanup, err := t.sandbox.command(ctx, t.shell, script, state.dir, vars, mounts...)
+		if err != nil {
+			return "", err
+		}
+		defer cleanup()
+		cmd = sandboxed
+	} else {
+		cmd = exec.CommandContext(ctx, t.shell, "-c", script)
+		cmd.Dir = state.dir
+		for _, kv := range base {
+			if name, _, _ := strings.Cut(kv, "="); !state.unset[name] {
+				cmd.Env = append(cmd.Env, kv)
+			}
+		}
+		for name, value := range state.env {
+			cmd.Env = append(cmd.Env, name+"="+value)
+		}
+	}
+	// Don't hang on pipes held open by background processes after a kill
+	cmd.WaitDelay = 2 * time.Second
+	configureCommand(cmd)
+
+	stdout, stderr := newCapture(t.maxOutput), newCapture(t.maxOutput)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	if stream := outputStream(ctx); stream != nil {
+		cmd.Stdout = io.MultiWriter(stdout, stream)
+		cmd.Stderr = io.MultiWriter(stderr, stream)
+	}
+
+	start := time.Now()
+	err := cmd.Run()
+	elapsed := time.Since(start).Round(time.Millisecond)
+
+	exitCode := 0
+	var exitErr *exec.ExitError
+	switch {
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		exitCode = -1
+	case errors.As(err, &exitErr):
+		exitCode = exitErr.ExitCode()
+	case err != nil:
+		return "", fmt.Errorf("failed to run command: %w", err)
+	}
+
+	if t.persistent {
+		t.saveState(sessionID, stateDir, base)
+	}
+
+	var output strings.Builder
+	if exitCode == -1 {
+		output.WriteString(fmt.Sprintf("Command timed out after %s and was killed\n", timeout))
+	} else {
+		output.WriteString(fmt.Sprintf("Exit code: %d\n", exitCode))
+	}
+	output.WriteString(fmt.Sprintf("Duration: %s\n", display.Duration(elapsed)))
+	if t.persistent {
+		output.WriteString(fmt.Sprintf("Directory: %s\n", t.state(sessionID).dir))
+	}
+	if stdout.written > 0 {
+		output.WriteString("\nStdout:\n")
+		output.WriteString(t.captured(stdout))
+	}
+	if stderr.written > 0 {
+		output.WriteString("\nStderr:\n")
+		output.WriteString(t.captured(stderr))
+	}
+	if stdout.written == 0 && stderr.written == 0 {
+		output.WriteString("\n(no output)")
+	}
+
+	return output.String(), nil
+}
+
+// Command returns a command running script the way the tool runs the
+// model's commands: with its shell, in its sandbox if there is one, in the
+// working directory and with the environment of ctx. Call cleanup once it
+// ran.
+func (t *ExecTool) Command(ctx context.Context, script string) (cmd *exec.Cmd, cleanup func(), err error) {
+	if t.sandbox != nil {
+		cmd, cleanup, err = t.sandbox.command(ctx, t.shell, script, t.workDir, EnvFromContext(ctx))
+		if err != nil {
+			return nil, nil, err
+		}
+	} else {
+		cmd = exec.CommandContext(ctx, t.shell, "-c", script)
+		cmd.Dir = t.workDir
+		cmd.Env = CommandEnv(ctx)
+		cleanup = func() {}
+	}
+	cmd.WaitDelay = 2 * time.Second
+	configureCommand(cmd)
+	return cmd, cleanup, nil
+}
+
+// state returns a copy of the session's shell state
+func (t *ExecTool) state(sessionID string) shellState {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if s, ok := t.shells[sessionID]; ok && t.persistent {
+		return *s
+	}
+	return shellState{dir: t.workDir}
+}
+
+// saveState reads back what the command's shell recorded on exit. Only
+// variables that differ from the environment the command started with are
+// kept, so later changes to the session's environment still apply, along
+// with the ones missing from it, which were unset.
+func (t *ExecTool) saveState(sessionID, stateDir string, base []string) {
+	state := t.state(sessionID)
+
+	if data, err := os.ReadFile(filepath.Join(stateDir, "pwd")); err == nil {
+		if dir := strings.TrimSpace(string(data)); dir != "" {
+			state.dir = dir
+		}
+	}
+
+	if data, err := os.ReadFile(filepath.Join(stateDir, "env")); err == nil && len(data) > 0 {
+		initial := make(map[string]string)
+		for _, kv := range base {
+			if name, value, ok := strings.Cut(kv, "="); ok {
+				initial[name] = value
+			}
+		}
+
+		env := make(map[string]string)
+		seen := make(map[string]bool)
+		for _, kv := range strings.Split(strings.TrimSuffix(string(data), "\x00"), "\x00") {
+			name, value, ok := strings.Cut(kv, "=")
+			if !ok || shellStateVars[name] {
+				continue
+			}
+			seen[name] = true
+			if old, ok := initial[name]; !ok || old != value {
+				env[name] = value
+			}
+		}
+		unset := make(map[string]bool)
+		for name := range initial {
+			if !seen[name] && !shellStateVars[name] {
+				unset[name] = true
+			}
+		}
+		state.env, state.unset = env, unset
+	}
+
+	t.mu.Lock()
+	t.shells[sessionID] = &state
+	t.mu.Unlock()
+}
+
+// truncate shortens output beyond the limit, keeping its start and end where
+// commands usually print what matters
+func (t *ExecTool) truncate(output string) string {
+	if len(output) <= t.maxOutput {
+		return output
+	}
+	// Both cuts back up to a rune boundary so no character is split
+	half := t.maxOutput / 2
+	head := half
+	for head > 0 && !utf8.RuneStart(output[head]) {
+		head--
+	}
+	tail := len(output) - half
+	for tail < len(output) && !utf8.RuneStart(output[tail]) {
+		tail++
+	}
+	omitted := tail - head
+	return fmt.Sprintf("%s\n\n[... %d bytes truncated ...]\n\n%s", output[:head], omitted, output[tail:])
+}
+
+// captured returns what c kept of a command's output, cut in the middle
+// like truncate when the command wrote more than fits
+func (t *ExecTool) captured(c *capture) string {
+	head, tail := c.parts()
+	if c.skipped == 0 {
+		return t.truncate(display.Text(string(head) + string(tail)))
+	}
+	// Both cuts move to a rune boundary so no character is split
+	omitted := c.skipped
+	last := len(head) - 1
+	for last > 0 && len(head)-last < utf8.UTFMax && !utf8.RuneStart(head[last]) {
+		last--
+	}
+	if last >= 0 && !utf8.FullRune(head[last:]) {
+		omitted += int64(len(head) - last)
+		head = head[:last]
+	}
+	for len(tail) > 0 && !utf8.RuneStart(tail[0]) {
+		tail = tail[1:]
+		omitted++
+	}
+	return fmt.Sprintf("%s\n\n[... %d bytes truncated ...]\n\n%s", display.Text(string(head)), omitted, display.Text(string(tail)))
+}
+
+// capture keeps the start and the end of a command's output, limit bytes
+// at most, and counts the bytes in between it let go, so a command
+// printing without end can't use up memory
+type capture struct {
+	head    []byte
+	tail    []byte // a ring once full, oldest byte at start
+	start   int
+	headMax int
+	tailMax int
+	written int64
+	skipped int64
+}
+
+func newCapture(limit int) *capture {
+	return &capture{headMax: limit / 2, tailMax: limit - limit/2}
+}
+
+func (c *capture) Write(p []byte) (int, error) {
+	n := len(p)
+	c.written += int64(n)
+
+	if room := c.headMax - len(c.head); room > 0 {
+		k := min(room, len(p))
+		c.head = append(c.head, p[:k]...)
+		p = p[k:]
+	}
+	if room := c.tailMax - len(c.tail); room > 0 {
+		k := min(room, len(p))
+		c.tail = append(c.tail, p[:k]...)
+		p = p[k:]
+	}
+	if len(p) == 0 {
+		return n, nil
+	}
+
+	// The ring is full, so every byte written pushes the oldest one out
+	if len(p) >= c.tailMax {
+		c.skipped += int64(len(p))
+		copy(c.tail, p[len(p)-c.tailMax:])
+		c.start = 0
+		return n, nil
+	}
+	c.skipped += int64(len(p))
+	for len(p) > 0 {
+		k := copy(c.tail[c.start:], p)
+		c.start = (c.start + k) % c.tailMax
+		p = p[k:]
+	}
+	return n, nil
+}
+
+// parts returns the start of the output and its end, in order
+func (c *capture) parts() (head, tail []byte) {
+	tail = make([]byte, 0, len(c.tail))
+	tail = append(tail, c.tail[c.start:]...)
+	tail = append(tail, c.tail[:c.start]...)
+	return c.head, tail
+}
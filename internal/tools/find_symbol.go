@@ -0,0 +1,163 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/omnitrix-sh/core.sh/internal/symbols"
+)
+
+const defaultSymbolLimit = 50
+
+type FindSymbolTool struct {
+	workDir string
+	dataDir string
+
+	mu    sync.Mutex
+	index *symbols.Index
+}
+
+// NewFindSymbolTool creates the tool. The index is persisted under dataDir
+// so later sessions only re-parse files that changed; pass "" to keep it in
+// memory.
+func NewFindSymbolTool(workDir, dataDir string) *FindSymbolTool {
+	return &FindSymbolTool{
+		workDir: workDir,
+		dataDir: dataDir,
+	}
+}
+
+func (t *FindSymbolTool) Name() string {
+	return "find_symbol"
+}
+
+func (t *FindSymbolTool) Description() string {
+	return `Find where functions, methods, types, classes and constants are defined, using a symbol index of the workspace.
+
+Usage:
+- Provide a symbol name; use match "prefix" or "contains" for partial names
+- Optionally filter by kind (func, method, type, struct, interface, class, const, var)
+- Set implementations to true with an interface name to find types implementing it
+
+Go is parsed exactly. Python, JavaScript/TypeScript, Rust, Java, Kotlin, C# and Ruby are matched line by line with patterns, not parsed: declarations spread over several lines can be missed and text in comments or strings mistaken for one, so fall back to grep when a symbol isn't found. Faster than grep for locating definitions.`
+}
+
+func (t *FindSymbolTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"name": map[string]interface{}{
+				"type":        "string",
+				"description": "Symbol name to look up",
+			},
+			"match": map[string]interface{}{
+				"type":        "string",
+				"enum":        []string{"exact", "prefix", "contains"},
+				"description": "How to match the name (default: exact, case-insensitive)",
+			},
+			"kind": map[string]interface{}{
+				"type":        "string",
+				"description": "Optional: only return symbols of this kind",
+			},
+			"container": map[string]interface{}{
+				"type":        "string",
+				"description": "Optional: only return methods of this type or class",
+			},
+			"implementations": map[string]interface{}{
+				"type":        "boolean",
+				"description": "Find types implementing the named interface instead",
+			},
+			"limit": map[string]interface{}{
+				"type":        "integer",
+				"minimum":     1,
+				"description": "Maximum results to return (default: 50)",
+			},
+		},
+		"required": []string{"name"},
+	}
+}
+
+func (t *FindSymbolTool) Risk() Risk {
+	return RiskRead
+}
+
+func (t *FindSymbolTool) Execute(ctx context.Context, args map[string]interface{}) (string, error) {
+	name := GetStringArg(args, "name", "")
+	if name == "" {
+		return "", fmt.Errorf("name is required")
+	}
+
+	t.mu.Lock()
+	if t.index == nil {
+		index, err := symbols.Open(t.dataDir, t.workDir)
+		if err != nil {
+			t.mu.Unlock()
+			return "", err
+		}
+		t.index = index
+	}
+	t.mu.Unlock()
+
+	if _, err := t.index.Update(ctx); err != nil {
+		return "", fmt.Errorf("failed to update symbol index: %w", err)
+	}
+	// The index is a cache, failing to persist it only costs a rebuild
+	t.index.Save()
+
+	// Limit 0 means no limit to the index, which a model never means
+	limit := GetIntArg(args, "limit", defaultSymbolLimit)
+	if limit < 1 {
+		limit = defaultSymbolLimit
+	}
+
+	var results []symbols.Symbol
+	if GetBoolArg(args, "implementations", false) {
+		impls, err := t.index.Implementations(name)
+		if err != nil {
+			return "", err
+		}
+		results = impls
+	} else {
+		results = t.index.Find(symbols.Query{
+			Name:      name,
+			Match:     symbols.MatchMode(GetStringArg(args, "match", "exact")),
+			Kind:      symbols.Kind(GetStringArg(args, "kind", "")),
+			Container: GetStringArg(args, "container", ""),
+			Limit:     limit + 1,
+		})
+	}
+
+	if len(results) == 0 {
+		files, syms := t.index.Stats()
+		return fmt.Sprintf("No symbols found for %q (%d symbols indexed in %d files).", name, syms, files), nil
+	}
+
+	truncated := len(results) > limit
+	if truncated {
+		results = results[:limit]
+	}
+
+	var output strings.Builder
+	output.WriteString(fmt.Sprintf("Found %d symbols:\n\n", len(results)))
+	for _, sym := range results {
+		name := sym.Name
+		if sym.Container != "" {
+			name = sym.Container + "." + sym.Name
+		}
+		location := sym.Path
+		if sym.Line > 0 {
+			location = fmt.Sprintf("%s:%d", sym.Path, sym.Line)
+		}
+		output.WriteString(fmt.Sprintf("%-10s %-40s %s\n", sym.Kind, name, location))
+		if sym.Signature != "" {
+			output.WriteString(fmt.Sprintf("           %s\n", sym.Signature))
+		}
+	}
+	if truncated {
+		output.WriteString("\n[more results not shown, raise limit or narrow the query]\n")
+	}
+
+	return output.String(), nil
+}
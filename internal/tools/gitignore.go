@@ -0,0 +1,166 @@
+package tools
+
+import (
+	"bufio"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// ignoreRule is one pattern from a .gitignore file
+type ignoreRule struct {
+	base     string // directory of the .gitignore, relative to the root
+	pattern  string
+	negate   bool
+	dirOnly  bool
+	anchored bool
+}
+
+// gitignore matches paths against the .gitignore files of a tree. Nested
+// files are added as the walk reaches their directory.
+type gitignore struct {
+	root   string
+	rules  []ignoreRule
+	loaded map[string]bool // directories whose .gitignore was read
+}
+
+// defaultIgnore is what the file tools leave out besides the .gitignore
+// files: version control data, dependencies and build output
+var defaultIgnore = []string{
+	".git/", ".hg/", ".svn/",
+	"node_modules/", "vendor/", "__pycache__/", ".venv/",
+	"build/", "dist/", "target/",
+}
+
+// loadIgnore reads the root .gitignore and .git/info/exclude, with the
+// default ignore list before them and extra, in .gitignore syntax, after,
+// so either can take back what came before with a "!" pattern
+func loadIgnore(root string, extra []string) *gitignore {
+	g := &gitignore{root: root, loaded: make(map[string]bool)}
+	g.addLines(defaultIgnore, "")
+	g.addFile(filepath.Join(root, ".git", "info", "exclude"), "")
+	g.addFile(filepath.Join(root, ".gitignore"), "")
+	g.addLines(extra, "")
+	return g
+}
+
+// addDir loads the .gitignore of a directory relative to the root
+func (g *gitignore) addDir(rel string) {
+	if rel == "." || rel == "" || g.loaded[rel] {
+		return
+	}
+	g.loaded[rel] = true
+	g.addFile(filepath.Join(g.root, filepath.FromSlash(rel), ".gitignore"), rel)
+}
+
+// addDirs loads the .gitignore files of a directory relative to the root
+// and of those above it
+func (g *gitignore) addDirs(rel string) {
+	if outside(rel) {
+		return
+	}
+	parts := strings.Split(rel, "/")
+	for i := 1; i <= len(parts); i++ {
+		g.addDir(strings.Join(parts[:i], "/"))
+	}
+}
+
+func (g *gitignore) addFile(file, base string) {
+	f, err := os.Open(file)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	var lines []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	g.addLines(lines, base)
+}
+
+func (g *gitignore) addLines(lines []string, base string) {
+	for _, line := range lines {
+		line = strings.TrimRight(line, " \t\r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		rule := ignoreRule{base: base}
+		if strings.HasPrefix(line, "!") {
+			rule.negate = true
+			line = line[1:]
+		}
+		line = strings.TrimPrefix(line, "\\")
+		if strings.HasSuffix(line, "/") {
+			rule.dirOnly = true
+			line = strings.TrimSuffix(line, "/")
+		}
+		// A slash anywhere but the end anchors the pattern to its directory
+		if strings.Contains(line, "/") {
+			rule.anchored = true
+			line = strings.TrimPrefix(line, "/")
+		}
+		if line == "" {
+			continue
+		}
+
+		rule.pattern = line
+		g.rules = append(g.rules, rule)
+	}
+}
+
+// ignored reports whether a slash-separated path relative to the root is
+// ignored. The last matching rule wins, as in git.
+func (g *gitignore) ignored(rel string, isDir bool) bool {
+	ignored := false
+	for _, rule := range g.rules {
+		if rule.dirOnly && !isDir {
+			continue
+		}
+
+		name := rel
+		if rule.base != "" {
+			if !strings.HasPrefix(rel, rule.base+"/") {
+				continue
+			}
+			name = strings.TrimPrefix(rel, rule.base+"/")
+		}
+
+		var match bool
+		if rule.anchored {
+			match = matchSegments(strings.Split(rule.pattern, "/"), strings.Split(name, "/"))
+		} else {
+			match, _ = path.Match(rule.pattern, path.Base(name))
+		}
+		if match {
+			ignored = !rule.negate
+		}
+	}
+	return ignored
+}
+
+// excludes reports whether a slash-separated path relative to the root is
+// ignored, itself or through a directory above it. Paths outside the root
+// never are.
+func (g *gitignore) excludes(rel string, isDir bool) bool {
+	if rel == "." || outside(rel) {
+		return false
+	}
+	parts := strings.Split(rel, "/")
+	for i := 1; i < len(parts); i++ {
+		dir := strings.Join(parts[:i], "/")
+		if g.ignored(dir, true) {
+			return true
+		}
+		g.addDir(dir)
+	}
+	return g.ignored(rel, isDir)
+}
+
+// outside reports whether a slash-separated relative path leaves its root
+func outside(rel string) bool {
+	return rel == ".." || strings.HasPrefix(rel, "../")
+}
@@ -0,0 +1,167 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	defaultGlobLimit = 100
+	maxGlobLimit     = 1000
+)
+
+type globArgs struct {
+	Pattern        string `json:"pattern" description:"Glob pattern to match, relative to dir_path (supports **)"`
+	DirPath        string `json:"dir_path,omitempty" default:"." description:"Directory to search in (defaults to current directory)"`
+	IncludeIgnored bool   `json:"include_ignored,omitempty" description:"Include files ignored by .gitignore, dependencies and build output (default: false)"`
+	Limit          int    `json:"limit,omitempty" description:"Maximum number of files to return (default: 100, max: 1000)"`
+}
+
+type GlobTool struct {
+	workDir string
+	ignore  []string // patterns left out besides .gitignore, see loadIgnore
+	roots   []string // other directories it may use, see resolvePath
+}
+
+func NewGlobTool(workDir string, ignore []string, roots ...string) *GlobTool {
+	return &GlobTool{
+		workDir: workDir,
+		ignore:  ignore,
+		roots:   roots,
+	}
+}
+
+func (t *GlobTool) Name() string {
+	return "glob"
+}
+
+func (t *GlobTool) Description() string {
+	return `Find files by name pattern, most recently modified first.
+
+Usage:
+- Provide a glob pattern such as "**/*.go", "cmd/*/main.go" or "*_test.go"
+- Patterns without a slash match file names at any depth
+- Files ignored by .gitignore, dependencies and build output are skipped unless include_ignored is set
+- Optionally search below a subdirectory
+
+Use this to locate files instead of walking directories with list_dir.`
+}
+
+func (t *GlobTool) Risk() Risk {
+	return RiskRead
+}
+
+type globMatch struct {
+	path    string
+	modTime time.Time
+}
+
+func (t *GlobTool) Run(ctx context.Context, args globArgs) (string, error) {
+	pattern := args.Pattern
+	if pattern == "" {
+		return "", fmt.Errorf("pattern is required")
+	}
+
+	absDir, err := resolvePath(t.workDir, args.DirPath, t.roots...)
+	if err != nil {
+		return "", err
+	}
+
+	limit := args.Limit
+	if limit <= 0 {
+		limit = defaultGlobLimit
+	}
+	if limit > maxGlobLimit {
+		limit = maxGlobLimit
+	}
+
+	// Ignore rules are relative to the workspace, where .gitignore lives
+	var ignore *gitignore
+	if !args.IncludeIgnored {
+		ignore = loadIgnore(t.workDir, t.ignore)
+	}
+
+	var matches []globMatch
+	err = filepath.WalkDir(absDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+
+		relWork, err := filepath.Rel(t.workDir, path)
+		if err != nil {
+			return nil
+		}
+		relWork = filepath.ToSlash(relWork)
+
+		if d.IsDir() {
+			// A directory asked for by name is searched even if ignored
+			if path == absDir {
+				if ignore != nil {
+					ignore.addDirs(relWork)
+				}
+				// The rules are the working directory's, other roots have none
+				if outside(relWork) {
+					ignore = nil
+				}
+				return nil
+			}
+			if ignore != nil && ignore.ignored(relWork, true) {
+				return filepath.SkipDir
+			}
+			if ignore != nil {
+				ignore.addDir(relWork)
+			}
+			return nil
+		}
+
+		if ignore != nil && ignore.ignored(relWork, false) {
+			return nil
+		}
+
+		rel, err := filepath.Rel(absDir, path)
+		if err != nil || !MatchGlob(pattern, filepath.ToSlash(rel)) {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		matches = append(matches, globMatch{path: relWork, modTime: info.ModTime()})
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if len(matches) == 0 {
+		return fmt.Sprintf("No files match %s", pattern), nil
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		if !matches[i].modTime.Equal(matches[j].modTime) {
+			return matches[i].modTime.After(matches[j].modTime)
+		}
+		return matches[i].path < matches[j].path
+	})
+
+	var output strings.Builder
+	output.WriteString(fmt.Sprintf("Found %d file(s) matching %s\n\n", len(matches), pattern))
+	for i, m := range matches {
+		if i == limit {
+			output.WriteString(fmt.Sprintf("\n... %d more, narrow the pattern or raise the limit\n", len(matches)-limit))
+			break
+		}
+		output.WriteString(m.path)
+		output.WriteString("\n")
+	}
+	return output.String(), nil
+}
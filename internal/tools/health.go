@@ -0,0 +1,87 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"sort"
+	"strings"
+
+	"github.com/omnitrix-sh/core.sh/internal/clipboard"
+)
+
+// Degraded is a tool left out because something it needs is missing
+type Degraded struct {
+	Tool    string `json:"tool"`
+	Missing string `json:"missing"`
+	Fix     string `json:"fix"`
+}
+
+// Report is what building the tools found: the tools the model is offered
+// and those left out
+type Report struct {
+	Available []string   `json:"available"`
+	Degraded  []Degraded `json:"degraded,omitempty"`
+	// Unconfigured tools need settings to be of use, such as language
+	// servers for navigate
+	Unconfigured []string `json:"unconfigured,omitempty"`
+}
+
+// OK reports whether every tool asked for can be used
+func (r *Report) OK() bool {
+	return len(r.Degraded) == 0
+}
+
+func (r *Report) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Available: %s\n", listOrNone(r.Available))
+	if len(r.Unconfigured) > 0 {
+		fmt.Fprintf(&b, "Not configured: %s\n", strings.Join(r.Unconfigured, ", "))
+	}
+	for _, d := range r.Degraded {
+		fmt.Fprintf(&b, "Unavailable: %s: %s\n  fix: %s\n", d.Tool, d.Missing, d.Fix)
+	}
+	return b.String()
+}
+
+func listOrNone(names []string) string {
+	if len(names) == 0 {
+		return "none"
+	}
+	return strings.Join(names, ", ")
+}
+
+// checkExec finds out whether the configured shell and sandbox work
+func checkExec(ctx context.Context, o Options) (missing, fix string) {
+	return NewExecTool(o.WorkDir, o.Exec).check(ctx)
+}
+
+// checkLSP degrades the tools built on language servers when none of the
+// configured servers is installed. Those that are keep them working.
+func checkLSP(ctx context.Context, o Options) (missing, fix string) {
+	servers := o.LSP.Servers()
+	notInstalled := o.LSP.Missing()
+	if len(servers) == 0 || len(notInstalled) < len(servers) {
+		return "", ""
+	}
+	var commands []string
+	for _, name := range servers {
+		commands = append(commands, fmt.Sprintf("%s (%s)", notInstalled[name], name))
+	}
+	sort.Strings(commands)
+	return "language servers not installed: " + strings.Join(commands, ", "),
+		"install them or fix their command in the lsp settings"
+}
+
+func checkClipboard(ctx context.Context, o Options) (missing, fix string) {
+	if clipboard.Available() {
+		return "", ""
+	}
+	switch runtime.GOOS {
+	case "darwin":
+		return "pbcopy and pbpaste were not found", "make sure /usr/bin is on PATH"
+	case "windows":
+		return "powershell was not found", "make sure powershell is on PATH"
+	}
+	return "no clipboard utility is installed", "install wl-clipboard (Wayland), xclip or xsel"
+}
@@ -4,17 +4,38 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"path"
 	"path/filepath"
 	"strings"
+
+	"github.com/omnitrix-sh/core.sh/internal/display"
+)
+
+const (
+	defaultTreeDepth = 3
+	maxTreeDepth     = 10
+	maxTreeEntries   = 500 // entries shown by a recursive listing
 )
 
+type listDirArgs struct {
+	DirPath        string `json:"dir_path,omitempty" default:"." description:"Directory path to list (defaults to current directory)"`
+	ShowHidden     bool   `json:"show_hidden,omitempty" description:"Include hidden files (starting with .)"`
+	IncludeIgnored bool   `json:"include_ignored,omitempty" description:"Include entries ignored by .gitignore, dependencies and build output"`
+	Recursive      bool   `json:"recursive,omitempty" description:"List subdirectories too, as an indented tree"`
+	MaxDepth       int    `json:"max_depth,omitempty" default:"3" description:"Levels of the tree a recursive listing shows (max 10)"`
+}
+
 type ListDirTool struct {
 	workDir string
+	ignore  []string // patterns left out besides .gitignore, see loadIgnore
+	roots   []string // other directories it may use, see resolvePath
 }
 
-func NewListDirTool(workDir string) *ListDirTool {
+func NewListDirTool(workDir string, ignore []string, roots ...string) *ListDirTool {
 	return &ListDirTool{
 		workDir: workDir,
+		ignore:  ignore,
+		roots:   roots,
 	}
 }
 
@@ -28,49 +49,24 @@ func (t *ListDirTool) Description() string {
 Usage:
 - Provide directory path (defaults to current directory)
 - Optionally show hidden files
+- Entries ignored by .gitignore, dependencies and build output are left out unless include_ignored is set
+- Set recursive for an indented tree of the subdirectories too, down to max_depth levels
 - Optionally show full details
 
 Use this to understand project organization before reading or modifying files.`
 }
 
-func (t *ListDirTool) Parameters() map[string]interface{} {
-	return map[string]interface{}{
-		"type": "object",
-		"properties": map[string]interface{}{
-			"dir_path": map[string]interface{}{
-				"type":        "string",
-				"description": "Directory path to list (defaults to current directory)",
-			},
-			"show_hidden": map[string]interface{}{
-				"type":        "boolean",
-				"description": "Include hidden files (starting with .)",
-			},
-		},
-	}
+func (t *ListDirTool) Risk() Risk {
+	return RiskRead
 }
 
-func (t *ListDirTool) Execute(ctx context.Context, args map[string]interface{}) (string, error) {
-	dirPath := GetStringArg(args, "dir_path", ".")
-	showHidden := GetBoolArg(args, "show_hidden", false)
-
-	// Resolve path
-	if !filepath.IsAbs(dirPath) {
-		dirPath = filepath.Join(t.workDir, dirPath)
-	}
-
-	// Security check
-	absPath, err := filepath.Abs(dirPath)
-	if err != nil {
-		return "", fmt.Errorf("failed to resolve path: %w", err)
-	}
+func (t *ListDirTool) Run(ctx context.Context, args listDirArgs) (string, error) {
+	dirPath := args.DirPath
+	showHidden := args.ShowHidden
 
-	absWorkDir, err := filepath.Abs(t.workDir)
+	absPath, err := resolvePath(t.workDir, dirPath, t.roots...)
 	if err != nil {
-		return "", fmt.Errorf("failed to resolve work directory: %w", err)
-	}
-
-	if !strings.HasPrefix(absPath, absWorkDir) {
-		return "", fmt.Errorf("access denied: path is outside working directory")
+		return "", err
 	}
 
 	// Check if directory exists
@@ -92,12 +88,34 @@ func (t *ListDirTool) Execute(ctx context.Context, args map[string]interface{})
 		return "", fmt.Errorf("failed to read directory: %w", err)
 	}
 
+	// A directory listed by name is shown even if ignored, its entries
+	// are not
+	var ignore *gitignore
+	relDir := "."
+	if !args.IncludeIgnored {
+		ignore = loadIgnore(t.workDir, t.ignore)
+		if rel, err := filepath.Rel(t.workDir, absPath); err == nil {
+			relDir = filepath.ToSlash(rel)
+		}
+		ignore.addDirs(relDir)
+	}
+	// The rules are the working directory's, other roots have none
+	if outside(relDir) {
+		ignore = nil
+	}
+
+	if args.Recursive {
+		return t.tree(absPath, dirPath, relDir, ignore, args), nil
+	}
+
 	// Format output
 	var output strings.Builder
 	output.WriteString(fmt.Sprintf("Directory: %s\n", dirPath))
 	output.WriteString(fmt.Sprintf("Entries: %d\n\n", len(entries)))
 
-	var dirs, files []string
+	var dirs []string
+	var files [][]string
+	ignored := 0
 
 	for _, entry := range entries {
 		name := entry.Name()
@@ -106,6 +124,10 @@ func (t *ListDirTool) Execute(ctx context.Context, args map[string]interface{})
 		if !showHidden && strings.HasPrefix(name, ".") {
 			continue
 		}
+		if ignore != nil && ignore.ignored(path.Join(relDir, name), entry.IsDir()) {
+			ignored++
+			continue
+		}
 
 		if entry.IsDir() {
 			dirs = append(dirs, name+"/")
@@ -114,9 +136,9 @@ func (t *ListDirTool) Execute(ctx context.Context, args map[string]interface{})
 			info, err := entry.Info()
 			size := ""
 			if err == nil {
-				size = formatSize(info.Size())
+				size = display.Size(info.Size())
 			}
-			files = append(files, fmt.Sprintf("%-40s %s", name, size))
+			files = append(files, []string{name, size})
 		}
 	}
 
@@ -132,29 +154,102 @@ func (t *ListDirTool) Execute(ctx context.Context, args map[string]interface{})
 	// Then files
 	if len(files) > 0 {
 		output.WriteString("Files:\n")
-		for _, file := range files {
-			output.WriteString(fmt.Sprintf("  %s\n", file))
+		for _, line := range splitLines(display.Table(nil, files)) {
+			output.WriteString(fmt.Sprintf("  %s\n", line))
 		}
 	}
 
+	if ignored > 0 {
+		output.WriteString(fmt.Sprintf("\n%d ignored entries left out, set include_ignored to list them\n", ignored))
+	}
+
 	return output.String(), nil
 }
 
-func formatSize(size int64) string {
-	const (
-		KB = 1024
-		MB = 1024 * KB
-		GB = 1024 * MB
-	)
-
-	switch {
-	case size >= GB:
-		return fmt.Sprintf("%.1f GB", float64(size)/GB)
-	case size >= MB:
-		return fmt.Sprintf("%.1f MB", float64(size)/MB)
-	case size >= KB:
-		return fmt.Sprintf("%.1f KB", float64(size)/KB)
-	default:
-		return fmt.Sprintf("%d B", size)
+// treeWalk is the state of a recursive listing
+type treeWalk struct {
+	ignore     *gitignore // nil to include ignored entries
+	showHidden bool
+	maxDepth   int
+	output     strings.Builder
+	shown      int
+	ignored    int
+	truncated  bool
+}
+
+// tree lists a directory and its subdirectories as an indented tree,
+// directories first, stopping after maxTreeEntries entries
+func (t *ListDirTool) tree(absPath, dirPath, relDir string, ignore *gitignore, args listDirArgs) string {
+	w := &treeWalk{ignore: ignore, showHidden: args.ShowHidden, maxDepth: args.MaxDepth}
+	if w.maxDepth <= 0 {
+		w.maxDepth = defaultTreeDepth
+	}
+	if w.maxDepth > maxTreeDepth {
+		w.maxDepth = maxTreeDepth
+	}
+
+	w.output.WriteString(fmt.Sprintf("Directory: %s (tree, %d levels)\n\n", dirPath, w.maxDepth))
+	w.walk(absPath, relDir, 0)
+	if w.truncated {
+		w.output.WriteString(fmt.Sprintf("\n... stopped after %d entries, list a subdirectory or lower max_depth\n", maxTreeEntries))
+	}
+	if w.ignored > 0 {
+		w.output.WriteString(fmt.Sprintf("\n%d ignored entries left out, set include_ignored to list them\n", w.ignored))
+	}
+	return w.output.String()
+}
+
+func (w *treeWalk) walk(dir, rel string, depth int) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		w.output.WriteString(fmt.Sprintf("%s(unreadable: %v)\n", strings.Repeat("  ", depth), err))
+		return
+	}
+
+	var dirs, files []os.DirEntry
+	for _, entry := range entries {
+		name := entry.Name()
+		if !w.showHidden && strings.HasPrefix(name, ".") {
+			continue
+		}
+		if w.ignore != nil && w.ignore.ignored(path.Join(rel, name), entry.IsDir()) {
+			w.ignored++
+			continue
+		}
+		if entry.IsDir() {
+			dirs = append(dirs, entry)
+		} else {
+			files = append(files, entry)
+		}
+	}
+
+	indent := strings.Repeat("  ", depth)
+	for _, entry := range append(dirs, files...) {
+		if w.shown == maxTreeEntries {
+			w.truncated = true
+			return
+		}
+		w.shown++
+
+		if !entry.IsDir() {
+			size := ""
+			if info, err := entry.Info(); err == nil {
+				size = "  " + display.Size(info.Size())
+			}
+			w.output.WriteString(fmt.Sprintf("%s%s%s\n", indent, entry.Name(), size))
+			continue
+		}
+
+		w.output.WriteString(fmt.Sprintf("%s%s/\n", indent, entry.Name()))
+		if depth+1 < w.maxDepth {
+			childRel := path.Join(rel, entry.Name())
+			if w.ignore != nil {
+				w.ignore.addDir(childRel)
+			}
+			w.walk(filepath.Join(dir, entry.Name()), childRel, depth+1)
+			if w.truncated {
+				return
+			}
+		}
 	}
 }
@@ -0,0 +1,209 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/omnitrix-sh/core.sh/internal/lsp"
+)
+
+const defaultNavigateLimit = 50
+
+type navigateArgs struct {
+	Action   string `json:"action" enum:"definition,references,symbols" description:"What to look up"`
+	FilePath string `json:"file_path,omitempty" description:"File containing the symbol, or whose symbols to list"`
+	Line     int    `json:"line,omitempty" description:"Line of the symbol (1-based)"`
+	Symbol   string `json:"symbol,omitempty" description:"Name of the symbol on that line"`
+	Column   int    `json:"column,omitempty" description:"Optional: column of the symbol (1-based), instead of symbol"`
+	Query    string `json:"query,omitempty" description:"Symbol name to search the workspace for (symbols action without file_path)"`
+	Limit    int    `json:"limit,omitempty" default:"50" description:"Maximum results to return"`
+}
+
+type NavigateTool struct {
+	workDir string
+	roots   []string // other directories it may use, see resolvePath
+	lsp     *lsp.Manager
+}
+
+// NewNavigateTool creates the tool on top of the configured language
+// servers
+func NewNavigateTool(workDir string, manager *lsp.Manager, roots ...string) *NavigateTool {
+	return &NavigateTool{
+		workDir: workDir,
+		roots:   roots,
+		lsp:     manager,
+	}
+}
+
+// navigateFromOptions leaves the tool out when no language servers are
+// configured
+func navigateFromOptions(o Options) Tool {
+	if o.LSP == nil {
+		return nil
+	}
+	return Typed[navigateArgs](NewNavigateTool(o.WorkDir, o.LSP, o.Roots...))
+}
+
+func (t *NavigateTool) Name() string {
+	return "navigate"
+}
+
+func (t *NavigateTool) Description() string {
+	return `Navigate code semantically using the project's language servers.
+
+Usage:
+- action "definition": where the symbol at file_path, line is defined
+- action "references": every place the symbol at file_path, line is used
+- action "symbols": the symbols declared in file_path, or with query instead, symbols across the workspace matching it
+- For definition and references, give the symbol's name as it appears on the line; column is only needed when it appears more than once
+
+Unlike text search this follows imports, methods and shadowed names exactly.`
+}
+
+func (t *NavigateTool) Risk() Risk {
+	return RiskRead
+}
+
+func (t *NavigateTool) Run(ctx context.Context, args navigateArgs) (string, error) {
+	limit := args.Limit
+	if limit <= 0 {
+		limit = defaultNavigateLimit
+	}
+
+	switch args.Action {
+	case "definition", "references":
+		path, line, column, err := t.position(args)
+		if err != nil {
+			return "", err
+		}
+		var locations []lsp.Location
+		if args.Action == "definition" {
+			locations, err = t.lsp.Definition(ctx, path, line, column)
+		} else {
+			locations, err = t.lsp.References(ctx, path, line, column)
+		}
+		if err != nil {
+			return "", err
+		}
+		if len(locations) == 0 {
+			return fmt.Sprintf("No %s found at %s:%d:%d.", args.Action, t.lsp.RelPath(path), line, column), nil
+		}
+		return t.formatLocations(locations, limit), nil
+
+	case "symbols":
+		var symbols []lsp.Symbol
+		var searchErr error
+		switch {
+		case args.FilePath != "":
+			path, err := resolvePath(t.workDir, args.FilePath, t.roots...)
+			if err != nil {
+				return "", err
+			}
+			symbols, err = t.lsp.DocumentSymbols(ctx, path)
+			if err != nil {
+				return "", err
+			}
+		case args.Query != "":
+			symbols, searchErr = t.lsp.WorkspaceSymbols(ctx, args.Query)
+			if searchErr != nil && len(symbols) == 0 {
+				return "", searchErr
+			}
+		default:
+			return "", fmt.Errorf("file_path or query is required for symbols")
+		}
+		if len(symbols) == 0 {
+			return "No symbols found.", nil
+		}
+		output := t.formatSymbols(symbols, limit)
+		if searchErr != nil {
+			output += fmt.Sprintf("\nSome servers could not be searched: %v\n", searchErr)
+		}
+		return output, nil
+	}
+
+	return "", fmt.Errorf("action must be definition, references or symbols")
+}
+
+// position resolves the file, line and column of the symbol in args
+func (t *NavigateTool) position(args navigateArgs) (string, int, int, error) {
+	filePath, line := args.FilePath, args.Line
+	if filePath == "" || line <= 0 {
+		return "", 0, 0, fmt.Errorf("file_path and line are required")
+	}
+	path, err := resolvePath(t.workDir, filePath, t.roots...)
+	if err != nil {
+		return "", 0, 0, err
+	}
+
+	if args.Column > 0 {
+		return path, line, args.Column, nil
+	}
+	symbol := args.Symbol
+	if symbol == "" {
+		return "", 0, 0, fmt.Errorf("symbol or column is required")
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", 0, 0, fmt.Errorf("failed to read file: %w", err)
+	}
+	lines := splitLines(string(content))
+	if line > len(lines) {
+		return "", 0, 0, fmt.Errorf("line %d is past the end of %s (%d lines)", line, filePath, len(lines))
+	}
+	text := lines[line-1]
+	offset := strings.Index(text, symbol)
+	if offset < 0 {
+		return "", 0, 0, fmt.Errorf("%s does not appear on line %d of %s: %s", symbol, line, filePath, strings.TrimSpace(text))
+	}
+	return path, line, lsp.Column(text, offset), nil
+}
+
+// formatLocations lists locations with the line of code at each
+func (t *NavigateTool) formatLocations(locations []lsp.Location, limit int) string {
+	files := make(map[string][]string)
+	var output strings.Builder
+	output.WriteString(fmt.Sprintf("%d results:\n", len(locations)))
+	for i, loc := range locations {
+		if i == limit {
+			output.WriteString(fmt.Sprintf("... and %d more\n", len(locations)-limit))
+			break
+		}
+		lines, ok := files[loc.Path]
+		if !ok {
+			if content, err := os.ReadFile(loc.Path); err == nil {
+				lines = splitLines(string(content))
+			}
+			files[loc.Path] = lines
+		}
+		output.WriteString(fmt.Sprintf("%s:%d:%d", t.lsp.RelPath(loc.Path), loc.Line, loc.Column))
+		if loc.Line >= 1 && loc.Line <= len(lines) {
+			output.WriteString(": " + strings.TrimSpace(lines[loc.Line-1]))
+		}
+		output.WriteString("\n")
+	}
+	return output.String()
+}
+
+func (t *NavigateTool) formatSymbols(symbols []lsp.Symbol, limit int) string {
+	var output strings.Builder
+	output.WriteString(fmt.Sprintf("%d symbols:\n", len(symbols)))
+	for i, s := range symbols {
+		if i == limit {
+			output.WriteString(fmt.Sprintf("... and %d more\n", len(symbols)-limit))
+			break
+		}
+		name := s.Name
+		if s.Container != "" {
+			name = s.Container + "." + s.Name
+		}
+		output.WriteString(fmt.Sprintf("%s %s  %s:%d", s.Kind, name, t.lsp.RelPath(s.Path), s.Line))
+		if s.Detail != "" {
+			output.WriteString("  " + s.Detail)
+		}
+		output.WriteString("\n")
+	}
+	return output.String()
+}
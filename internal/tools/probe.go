@@ -0,0 +1,206 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const maxProbeBody = 2048
+
+type ProbeTool struct {
+	client *http.Client
+}
+
+func NewProbeTool() *ProbeTool {
+	return &ProbeTool{
+		client: &http.Client{
+			// Report redirects instead of following them off localhost
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+	}
+}
+
+func (t *ProbeTool) Name() string {
+	return "probe"
+}
+
+func (t *ProbeTool) Description() string {
+	return `Check whether a local port is listening and optionally perform an HTTP health check against it.
+
+Usage:
+- Provide the port to check
+- Optionally provide an HTTP path (e.g. "/health") to send a GET request
+- Optionally wait for the port to come up, useful right after starting a server
+
+Only localhost addresses can be probed. Use this to verify that a server you started is actually running and responding.`
+}
+
+func (t *ProbeTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"port": map[string]interface{}{
+				"type":        "integer",
+				"description": "Port number to check",
+			},
+			"host": map[string]interface{}{
+				"type":        "string",
+				"description": "Loopback host to probe (default: localhost)",
+			},
+			"path": map[string]interface{}{
+				"type":        "string",
+				"description": "Optional: HTTP path to GET once the port is listening (e.g. /health)",
+			},
+			"https": map[string]interface{}{
+				"type":        "boolean",
+				"description": "Use https for the HTTP check (default: false)",
+			},
+			"expect_status": map[string]interface{}{
+				"type":        "integer",
+				"description": "Optional: HTTP status code the check must return (default: any 2xx)",
+			},
+			"wait_seconds": map[string]interface{}{
+				"type":        "integer",
+				"description": "Optional: keep retrying for up to this many seconds until the check passes (max 60)",
+			},
+		},
+		"required": []string{"port"},
+	}
+}
+
+func (t *ProbeTool) Risk() Risk {
+	return RiskNetwork
+}
+
+func (t *ProbeTool) Execute(ctx context.Context, args map[string]interface{}) (string, error) {
+	port := GetIntArg(args, "port", 0)
+	if port < 1 || port > 65535 {
+		return "", fmt.Errorf("port must be between 1 and 65535")
+	}
+
+	host := GetStringArg(args, "host", "localhost")
+	if !isLoopbackHost(host) {
+		return "", fmt.Errorf("access denied: only localhost can be probed")
+	}
+
+	path := GetStringArg(args, "path", "")
+	if path != "" && !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	scheme := "http"
+	if GetBoolArg(args, "https", false) {
+		scheme = "https"
+	}
+	expectStatus := GetIntArg(args, "expect_status", 0)
+
+	wait := GetIntArg(args, "wait_seconds", 0)
+	if wait < 0 {
+		wait = 0
+	}
+	if wait > 60 {
+		wait = 60
+	}
+
+	address := net.JoinHostPort(host, strconv.Itoa(port))
+	deadline := time.Now().Add(time.Duration(wait) * time.Second)
+	start := time.Now()
+
+	for {
+		result, ok := t.probe(ctx, address, scheme, path, expectStatus)
+		if ok || time.Now().After(deadline) {
+			if wait > 0 {
+				result = fmt.Sprintf("%sElapsed: %s\n", result, time.Since(start).Round(time.Millisecond))
+			}
+			return result, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-time.After(500 * time.Millisecond):
+		}
+	}
+}
+
+// probe runs a single check and reports whether it passed
+func (t *ProbeTool) probe(ctx context.Context, address, scheme, path string, expectStatus int) (string, bool) {
+	var output strings.Builder
+	output.WriteString(fmt.Sprintf("Address: %s\n", address))
+
+	dialer := net.Dialer{Timeout: 2 * time.Second}
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		output.WriteString("Port: not listening\n")
+		output.WriteString(fmt.Sprintf("Error: %v\n", err))
+		return output.String(), false
+	}
+	conn.Close()
+	output.WriteString("Port: listening\n")
+
+	if path == "" {
+		return output.String(), true
+	}
+
+	url := fmt.Sprintf("%s://%s%s", scheme, address, path)
+	reqCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(reqCtx, "GET", url, nil)
+	if err != nil {
+		output.WriteString(fmt.Sprintf("HTTP: failed to create request: %v\n", err))
+		return output.String(), false
+	}
+
+	reqStart := time.Now()
+	resp, err := t.client.Do(req)
+	if err != nil {
+		output.WriteString(fmt.Sprintf("HTTP GET %s: %v\n", url, err))
+		return output.String(), false
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxProbeBody+1))
+	truncated := len(body) > maxProbeBody
+	if truncated {
+		body = body[:maxProbeBody]
+	}
+
+	output.WriteString(fmt.Sprintf("HTTP GET %s: %s (%s)\n", url, resp.Status, time.Since(reqStart).Round(time.Millisecond)))
+	if contentType := resp.Header.Get("Content-Type"); contentType != "" {
+		output.WriteString(fmt.Sprintf("Content-Type: %s\n", contentType))
+	}
+	if len(body) > 0 {
+		output.WriteString("\nBody:\n")
+		output.Write(body)
+		if truncated {
+			output.WriteString("\n[truncated]")
+		}
+		output.WriteString("\n")
+	}
+
+	passed := resp.StatusCode >= 200 && resp.StatusCode < 300
+	if expectStatus != 0 {
+		passed = resp.StatusCode == expectStatus
+	}
+	if !passed {
+		output.WriteString("\nCheck: failed\n")
+	}
+
+	return output.String(), passed
+}
+
+func isLoopbackHost(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(strings.Trim(host, "[]"))
+	return ip != nil && ip.IsLoopback()
+}
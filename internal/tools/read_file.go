@@ -1,22 +1,44 @@
 package tools
 
 import (
+	"bufio"
 	"context"
+	"encoding/base64"
 	"fmt"
+	"io"
+	"net/http"
 	"os"
 	"path/filepath"
 	"strings"
+
+	"github.com/omnitrix-sh/core.sh/internal/display"
+	"github.com/omnitrix-sh/core.sh/pkg/models"
+)
+
+const (
+	maxFileSize   = 10 * 1024 * 1024 // 10MB, for tools reading whole files
+	maxReadLines  = 2000             // lines read_file shows at once
+	maxLineLength = 2000             // bytes of a line read_file shows
 )
 
-const maxFileSize = 10 * 1024 * 1024 // 10MB
+type readFileArgs struct {
+	FilePath       string `json:"file_path" description:"Path to the file to read (relative or absolute)"`
+	StartLine      int    `json:"start_line,omitempty" default:"1" description:"Optional: Line number to start reading from (1-indexed)"`
+	EndLine        *int   `json:"end_line,omitempty" description:"Optional: Line number to stop reading at (inclusive), at most 2000 lines after start_line"`
+	IncludeIgnored bool   `json:"include_ignored,omitempty" description:"Optional: Read the file even if it is ignored (default: false)"`
+}
 
 type ReadFileTool struct {
 	workDir string
+	ignore  []string // patterns left out besides .gitignore, see loadIgnore
+	roots   []string // other directories it may use, see resolvePath
 }
 
-func NewReadFileTool(workDir string) *ReadFileTool {
+func NewReadFileTool(workDir string, ignore []string, roots ...string) *ReadFileTool {
 	return &ReadFileTool{
 		workDir: workDir,
+		ignore:  ignore,
+		roots:   roots,
 	}
 }
 
@@ -30,55 +52,26 @@ func (t *ReadFileTool) Description() string {
 Usage:
 - Provide the file path (relative to working directory or absolute)
 - Optionally specify line range to read partial content
+- At most 2000 lines are shown at once, and long lines are cut; the output says where it stopped so you can continue with start_line
+- Files ignored by .gitignore, dependencies and build output are refused unless include_ignored is set
+- Images are attached for you to view if the model supports images; other binary files are refused
 
 The tool will return the file contents with line numbers for easy reference.`
 }
 
-func (t *ReadFileTool) Parameters() map[string]interface{} {
-	return map[string]interface{}{
-		"type": "object",
-		"properties": map[string]interface{}{
-			"file_path": map[string]interface{}{
-				"type":        "string",
-				"description": "Path to the file to read (relative or absolute)",
-			},
-			"start_line": map[string]interface{}{
-				"type":        "integer",
-				"description": "Optional: Line number to start reading from (1-indexed)",
-			},
-			"end_line": map[string]interface{}{
-				"type":        "integer",
-				"description": "Optional: Line number to stop reading at (inclusive)",
-			},
-		},
-		"required": []string{"file_path"},
-	}
+func (t *ReadFileTool) Risk() Risk {
+	return RiskRead
 }
 
-func (t *ReadFileTool) Execute(ctx context.Context, args map[string]interface{}) (string, error) {
-	filePath := GetStringArg(args, "file_path", "")
+func (t *ReadFileTool) Run(ctx context.Context, args readFileArgs) (string, error) {
+	filePath := args.FilePath
 	if filePath == "" {
 		return "", fmt.Errorf("file_path is required")
 	}
 
-	// Resolve path
-	if !filepath.IsAbs(filePath) {
-		filePath = filepath.Join(t.workDir, filePath)
-	}
-
-	// Security check: ensure path is within work directory
-	absPath, err := filepath.Abs(filePath)
-	if err != nil {
-		return "", fmt.Errorf("failed to resolve path: %w", err)
-	}
-
-	absWorkDir, err := filepath.Abs(t.workDir)
+	absPath, err := resolvePath(t.workDir, filePath, t.roots...)
 	if err != nil {
-		return "", fmt.Errorf("failed to resolve work directory: %w", err)
-	}
-
-	if !strings.HasPrefix(absPath, absWorkDir) {
-		return "", fmt.Errorf("access denied: path is outside working directory")
+		return "", err
 	}
 
 	// Check if file exists
@@ -94,41 +87,125 @@ func (t *ReadFileTool) Execute(ctx context.Context, args map[string]interface{})
 		return "", fmt.Errorf("path is a directory, not a file: %s", filePath)
 	}
 
-	// Check file size
-	if info.Size() > maxFileSize {
-		return "", fmt.Errorf("file too large (%d bytes, max %d bytes)", info.Size(), maxFileSize)
+	if !args.IncludeIgnored {
+		rel, err := filepath.Rel(t.workDir, absPath)
+		if err == nil && loadIgnore(t.workDir, t.ignore).excludes(filepath.ToSlash(rel), false) {
+			return "", fmt.Errorf("file is ignored by .gitignore or tools.ignore: %s (set include_ignored to read it anyway)", filePath)
+		}
 	}
 
-	// Read file
-	content, err := os.ReadFile(absPath)
+	f, err := os.Open(absPath)
 	if err != nil {
 		return "", fmt.Errorf("failed to read file: %w", err)
 	}
-
-	lines := strings.Split(string(content), "\n")
-	
-	// Handle line range
-	startLine := GetIntArg(args, "start_line", 1)
-	endLine := GetIntArg(args, "end_line", len(lines))
-
-	if startLine < 1 {
-		startLine = 1
+	defer f.Close()
+	reader := bufio.NewReaderSize(f, 64*1024)
+
+	// What the file is shows in its first bytes
+	head, _ := reader.Peek(8000)
+	mimeType := http.DetectContentType(head)
+	if strings.HasPrefix(mimeType, "image/") {
+		return t.readImage(ctx, filePath, absPath, mimeType, info.Size())
+	}
+	if isBinary(head) {
+		return "", fmt.Errorf("%s is a binary file (%s, %s) and is not shown; inspect it with a command that understands the format", filePath, mimeType, display.Size(info.Size()))
 	}
-	if endLine > len(lines) {
-		endLine = len(lines)
+
+	// Handle line range: at most maxReadLines from startLine
+	startLine := max(args.StartLine, 1)
+	endLine := startLine + maxReadLines - 1
+	if args.EndLine != nil {
+		endLine = *args.EndLine
 	}
 	if startLine > endLine {
 		return "", fmt.Errorf("start_line (%d) must be <= end_line (%d)", startLine, endLine)
 	}
+	windowed := false
+	if args.EndLine == nil || endLine-startLine >= maxReadLines {
+		endLine = startLine + maxReadLines - 1
+		windowed = true
+	}
+
+	var body strings.Builder
+	total, cut := 0, 0
+	for {
+		line, length, err := readLine(reader, maxLineLength)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", fmt.Errorf("failed to read file: %w", err)
+		}
+		total++
+		if total < startLine || total > endLine {
+			continue
+		}
+		if length > len(line) {
+			line += fmt.Sprintf(" [... %d more bytes]", length-len(line))
+			cut++
+		}
+		body.WriteString(fmt.Sprintf("%4d | %s\n", total, line))
+	}
+
+	if total == 0 {
+		return fmt.Sprintf("File: %s\nThe file is empty.\n", filePath), nil
+	}
+	if startLine > total {
+		return "", fmt.Errorf("start_line (%d) is past the end of the file (%d lines)", startLine, total)
+	}
+	if endLine > total {
+		endLine = total
+	}
 
 	// Format output with line numbers
 	var output strings.Builder
 	output.WriteString(fmt.Sprintf("File: %s\n", filePath))
-	output.WriteString(fmt.Sprintf("Lines: %d-%d of %d\n\n", startLine, endLine, len(lines)))
-
-	for i := startLine - 1; i < endLine; i++ {
-		output.WriteString(fmt.Sprintf("%4d | %s\n", i+1, lines[i]))
+	output.WriteString(fmt.Sprintf("Lines: %d-%d of %d\n\n", startLine, endLine, total))
+	output.WriteString(body.String())
+	if windowed && endLine < total {
+		output.WriteString(fmt.Sprintf("\n[truncated after line %d of %d, use start_line/end_line to continue]\n", endLine, total))
+	}
+	if cut > 0 {
+		output.WriteString(fmt.Sprintf("\n[%d line(s) cut at %d bytes]\n", cut, maxLineLength))
 	}
 
 	return output.String(), nil
 }
+
+// readImage attaches an image file for the model to view
+func (t *ReadFileTool) readImage(ctx context.Context, filePath, absPath, mimeType string, size int64) (string, error) {
+	if size > models.MaxImageSize {
+		return "", fmt.Errorf("image too large (%s, max %s)", display.Size(size), display.Size(models.MaxImageSize))
+	}
+	content, err := os.ReadFile(absPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to read file: %w", err)
+	}
+	image := models.ImagePart{Base64: base64.StdEncoding.EncodeToString(content), MimeType: mimeType}
+	if !attachImage(ctx, image) {
+		return "", fmt.Errorf("%s is an image (%s, %s) and the current model can't view images", filePath, mimeType, display.Size(size))
+	}
+	return fmt.Sprintf("Image: %s (%s, %s), attached below\n", filePath, mimeType, display.Size(size)), nil
+}
+
+// readLine reads the next line without its line ending, keeping the first
+// limit bytes of it, and returns the line's full length. It returns io.EOF
+// only when no line is left.
+func readLine(r *bufio.Reader, limit int) (string, int, error) {
+	var line []byte
+	length := 0
+	for {
+		chunk, more, err := r.ReadLine()
+		if err != nil {
+			return "", 0, err
+		}
+		length += len(chunk)
+		if room := limit - len(line); room > 0 {
+			line = append(line, chunk[:min(room, len(chunk))]...)
+		}
+		if !more {
+			// A cut may have split a character
+			return strings.ToValidUTF8(string(line), ""), length, nil
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sort"
+
+	"github.com/omnitrix-sh/core.sh/internal/lsp"
+	"github.com/omnitrix-sh/core.sh/pkg/models"
+)
+
+// Options are what the built-in tools are constructed with
+type Options struct {
+	WorkDir string
+	DataDir string
+	Exec    models.ExecConfig
+	LSP     *lsp.Manager // nil without language servers
+	// Commands are tools running configured shell commands, keyed by name
+	Commands map[string]models.CommandToolConfig
+	// Roots are directories besides WorkDir the file tools may use.
+	// Relative ones are taken from WorkDir.
+	Roots []string
+	// Ignore are patterns in .gitignore syntax the file tools leave out
+	// besides .gitignore and the default list of dependency and build
+	// directories
+	Ignore []string
+	// Databases are what sql_query may query and sql_execute may change,
+	// keyed by name
+	Databases map[string]models.DatabaseConfig
+	// External are the names of tools offered besides these, such as by
+	// plugins, which disabled may name as well
+	External []string
+}
+
+type builtin struct {
+	// create returns nil when the tool can't work with the options
+	create func(opts Options) Tool
+	// optional tools are only available when enabled explicitly
+	optional bool
+	// check returns what keeps the tool from working and how to fix it, or
+	// "" when nothing does
+	check func(ctx context.Context, opts Options) (missing, fix string)
+}
+
+var builtins = map[string]builtin{
+	"read_file":     {create: func(o Options) Tool { return Typed[readFileArgs](NewReadFileTool(o.WorkDir, o.Ignore, o.Roots...)) }},
+	"write_file":    {create: func(o Options) Tool { return Typed[writeFileArgs](NewWriteFileTool(o.WorkDir, o.Roots...)) }},
+	"edit_file":     {create: func(o Options) Tool { return Typed[editFileArgs](NewEditFileTool(o.WorkDir, o.Roots...)) }},
+	"apply_patch":   {create: func(o Options) Tool { return NewApplyPatchTool(o.WorkDir, o.Roots...) }},
+	"list_dir":      {create: func(o Options) Tool { return Typed[listDirArgs](NewListDirTool(o.WorkDir, o.Ignore, o.Roots...)) }},
+	"glob":          {create: func(o Options) Tool { return Typed[globArgs](NewGlobTool(o.WorkDir, o.Ignore, o.Roots...)) }},
+	"regex_replace": {create: regexReplaceFromOptions},
+	"find_symbol":   {create: func(o Options) Tool { return NewFindSymbolTool(o.WorkDir, o.DataDir) }},
+	"dep_graph":     {create: func(o Options) Tool { return NewDepGraphTool(o.WorkDir) }},
+	"archive":       {create: func(o Options) Tool { return Typed[archiveArgs](NewArchiveTool(o.WorkDir, o.Roots...)) }},
+	"scaffold":      {create: func(o Options) Tool { return Typed[scaffoldArgs](NewScaffoldTool(o.WorkDir, o.Roots...)) }},
+	"sql_query":     {create: sqlQueryFromOptions},
+	"sql_execute":   {create: sqlExecuteFromOptions},
+	"exec":          {create: func(o Options) Tool { return Typed[execArgs](NewExecTool(o.WorkDir, o.Exec)) }, check: checkExec},
+	"diagnostics":   {create: diagnosticsFromOptions, check: checkLSP},
+	"navigate":      {create: navigateFromOptions, check: checkLSP},
+	"clipboard":     {create: func(o Options) Tool { return NewClipboardTool(true, true) }, optional: true, check: checkClipboard},
+	"probe":         {create: func(o Options) Tool { return NewProbeTool() }, optional: true},
+}
+
+// Builtins returns the names of all built-in tools, sorted
+func Builtins() []string {
+	names := make([]string, 0, len(builtins))
+	for name := range builtins {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Build creates the default tools plus the optional ones in enabled and the
+// command tools, minus those in disabled. Disabling wins when a tool is in both. Tools missing
+// something they need, like an installed command, are left out rather than
+// failing when the model calls them; BuildReport tells which and why.
+func Build(opts Options, enabled, disabled []string) ([]Tool, error) {
+	tools, _, err := BuildReport(context.Background(), opts, enabled, disabled)
+	return tools, err
+}
+
+// BuildReport is Build that also reports which tools are available and
+// which were left out
+func BuildReport(ctx context.Context, opts Options, enabled, disabled []string) ([]Tool, *Report, error) {
+	roots := make([]string, len(opts.Roots))
+	for i, root := range opts.Roots {
+		if !filepath.IsAbs(root) {
+			root = filepath.Join(opts.WorkDir, root)
+		}
+		roots[i] = root
+	}
+	opts.Roots = roots
+
+	selected := make(map[string]bool)
+	for name, b := range builtins {
+		selected[name] = !b.optional
+	}
+	for _, name := range enabled {
+		if _, ok := builtins[name]; !ok {
+			return nil, nil, fmt.Errorf("unknown tool: %s", name)
+		}
+		selected[name] = true
+	}
+	external := make(map[string]bool, len(opts.External))
+	for _, name := range opts.External {
+		external[name] = true
+	}
+	for _, name := range disabled {
+		if external[name] {
+			continue
+		}
+		if _, ok := opts.Commands[name]; ok {
+			selected[name] = false
+			continue
+		}
+		if _, ok := builtins[name]; !ok {
+			return nil, nil, fmt.Errorf("unknown tool: %s", name)
+		}
+		selected[name] = false
+	}
+
+	var result []Tool
+	report := &Report{}
+	for _, name := range Builtins() {
+		if !selected[name] {
+			continue
+		}
+		b := builtins[name]
+		tool := b.create(opts)
+		if tool == nil {
+			report.Unconfigured = append(report.Unconfigured, name)
+			continue
+		}
+		if b.check != nil {
+			if missing, fix := b.check(ctx, opts); missing != "" {
+				report.Degraded = append(report.Degraded, Degraded{Tool: name, Missing: missing, Fix: fix})
+				continue
+			}
+		}
+		result = append(result, tool)
+		report.Available = append(report.Available, name)
+	}
+
+	var commands []string
+	for name := range opts.Commands {
+		if selected, ok := selected[name]; !ok || selected {
+			commands = append(commands, name)
+		}
+	}
+	if len(commands) == 0 {
+		return result, report, nil
+	}
+	sort.Strings(commands)
+	exec := NewExecTool(opts.WorkDir, opts.Exec)
+	if missing, fix := exec.check(ctx); missing != "" {
+		for _, name := range commands {
+			report.Degraded = append(report.Degraded, Degraded{Tool: name, Missing: missing, Fix: fix})
+		}
+		return result, report, nil
+	}
+	for _, name := range commands {
+		tool, err := NewCommandTool(name, opts.Commands[name], exec)
+		if err != nil {
+			return nil, nil, err
+		}
+		result = append(result, tool)
+		report.Available = append(report.Available, name)
+	}
+	return result, report, nil
+}
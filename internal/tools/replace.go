@@ -0,0 +1,269 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/omnitrix-sh/core.sh/internal/display"
+)
+
+const (
+	maxReplaceFiles   = 500
+	maxReplacePreview = 400 // diff lines shown in the report
+)
+
+type regexReplaceArgs struct {
+	Pattern        string `json:"pattern" description:"Regular expression to search for (RE2 syntax, (?m) for multiline anchors)"`
+	Replacement    string `json:"replacement" description:"Replacement text, may reference capture groups as $1 or ${name}"`
+	Glob           string `json:"glob" description:"Glob selecting files to process, relative to dir_path (e.g. **/*.go)"`
+	DirPath        string `json:"dir_path,omitempty" default:"." description:"Directory to search from (defaults to current directory)"`
+	DryRun         bool   `json:"dry_run,omitempty" default:"true" description:"Preview changes without writing them (default: true)"`
+	IncludeIgnored bool   `json:"include_ignored,omitempty" description:"Include files ignored by .gitignore, dependencies and build output (default: false)"`
+}
+
+type RegexReplaceTool struct {
+	workDir string
+	ignore  []string // patterns left out besides .gitignore, see loadIgnore
+	roots   []string // other directories it may use, see resolvePath
+}
+
+func NewRegexReplaceTool(workDir string, ignore []string, roots ...string) *RegexReplaceTool {
+	return &RegexReplaceTool{
+		workDir: workDir,
+		ignore:  ignore,
+		roots:   roots,
+	}
+}
+
+func regexReplaceFromOptions(o Options) Tool {
+	return Typed[regexReplaceArgs](NewRegexReplaceTool(o.WorkDir, o.Ignore, o.Roots...))
+}
+
+func (t *RegexReplaceTool) Name() string {
+	return "regex_replace"
+}
+
+func (t *RegexReplaceTool) Description() string {
+	return `Replace a regular expression across every file matching a glob, for mechanical refactors too large to edit file by file.
+
+Usage:
+- pattern uses Go RE2 syntax; replacement may reference groups as $1 or ${name}
+- glob selects files, e.g. "**/*.go" or "internal/**/*_test.go"
+- dry_run defaults to true and returns a diff preview with match counts; run again with dry_run false to apply
+
+Binary files are skipped, and so are files ignored by .gitignore, dependencies and build output unless include_ignored is set.`
+}
+
+// replaceResult is the outcome of the replacement in one file
+type replaceResult struct {
+	path    string
+	absPath string
+	mode    fs.FileMode
+	updated []byte
+	matches int
+	diff    string
+}
+
+func (t *RegexReplaceTool) Risk() Risk {
+	return RiskWrite
+}
+
+func (t *RegexReplaceTool) Run(ctx context.Context, args regexReplaceArgs) (string, error) {
+	results, scanned, err := t.replace(ctx, args)
+	if err != nil {
+		return "", err
+	}
+	pattern := args.Pattern
+	glob := args.Glob
+	dryRun := args.DryRun
+
+	// Only write once every file has been processed, so an error part way
+	// through the walk never leaves a half-applied refactor
+	if !dryRun {
+		for _, r := range results {
+			if err := os.WriteFile(r.absPath, r.updated, r.mode); err != nil {
+				return "", fmt.Errorf("failed to write %s: %w", r.path, err)
+			}
+			recordChange(ctx, r.absPath)
+		}
+	}
+
+	if len(results) == 0 {
+		return fmt.Sprintf("No matches for %s in %d files matching %s.", pattern, scanned, glob), nil
+	}
+
+	total, totalDiffLines := 0, 0
+	for _, r := range results {
+		total += r.matches
+		totalDiffLines += strings.Count(r.diff, "\n")
+	}
+
+	var output strings.Builder
+	if dryRun {
+		output.WriteString("Dry run, no files were changed.\n")
+	} else {
+		output.WriteString("Applied changes.\n")
+	}
+	output.WriteString(fmt.Sprintf("Matches: %d in %d files (%d files scanned)\n\n", total, len(results), scanned))
+
+	var rows [][]string
+	for _, r := range results {
+		rows = append(rows, []string{r.path, strconv.Itoa(r.matches)})
+	}
+	for _, line := range splitLines(display.Table(nil, rows)) {
+		output.WriteString(fmt.Sprintf("  %s\n", line))
+	}
+
+	output.WriteString("\n")
+	shown := 0
+	for _, r := range results {
+		lines := strings.Count(r.diff, "\n")
+		if shown+lines > maxReplacePreview {
+			output.WriteString(fmt.Sprintf("[diff truncated, %d more lines not shown]\n", totalDiffLines-shown))
+			break
+		}
+		output.WriteString(r.diff)
+		shown += lines
+	}
+
+	if dryRun {
+		output.WriteString("\nRun again with dry_run false to apply.\n")
+	}
+	return output.String(), nil
+}
+
+// Paths returns the files a call would write, none for a dry run, so
+// permission rules on paths cover every file the glob selects
+func (t *RegexReplaceTool) Paths(ctx context.Context, args regexReplaceArgs) ([]string, error) {
+	if args.DryRun {
+		return nil, nil
+	}
+	results, _, err := t.replace(ctx, args)
+	if err != nil {
+		return nil, err
+	}
+	paths := make([]string, len(results))
+	for i, r := range results {
+		paths[i] = r.absPath
+	}
+	return paths, nil
+}
+
+// replace computes the replacement in every file the glob selects without
+// writing anything, returning the files that change and how many were
+// scanned
+func (t *RegexReplaceTool) replace(ctx context.Context, args regexReplaceArgs) ([]replaceResult, int, error) {
+	pattern := args.Pattern
+	if pattern == "" {
+		return nil, 0, fmt.Errorf("pattern is required")
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, 0, fmt.Errorf("invalid pattern: %w", err)
+	}
+
+	replacement := args.Replacement
+
+	glob := args.Glob
+	if glob == "" {
+		return nil, 0, fmt.Errorf("glob is required")
+	}
+
+	absDir, err := resolvePath(t.workDir, args.DirPath, t.roots...)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var ignore *gitignore
+	if !args.IncludeIgnored {
+		ignore = loadIgnore(t.workDir, t.ignore)
+	}
+
+	var results []replaceResult
+	scanned := 0
+	err = filepath.WalkDir(absDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		relWork, err := filepath.Rel(t.workDir, path)
+		if err != nil {
+			return nil
+		}
+		relWork = filepath.ToSlash(relWork)
+
+		if d.IsDir() {
+			if ignore == nil {
+				return nil
+			}
+			if path == absDir {
+				ignore.addDirs(relWork)
+				// The rules are the working directory's, other roots have none
+				if outside(relWork) {
+					ignore = nil
+				}
+				return nil
+			}
+			if ignore.ignored(relWork, true) {
+				return filepath.SkipDir
+			}
+			ignore.addDir(relWork)
+			return nil
+		}
+		if !d.Type().IsRegular() || (ignore != nil && ignore.ignored(relWork, false)) {
+			return nil
+		}
+
+		rel, err := filepath.Rel(absDir, path)
+		if err != nil || !MatchGlob(glob, filepath.ToSlash(rel)) {
+			return nil
+		}
+
+		scanned++
+		if scanned > maxReplaceFiles {
+			return fmt.Errorf("glob matches more than %d files, narrow it down", maxReplaceFiles)
+		}
+
+		info, err := d.Info()
+		if err != nil || info.Size() > maxFileSize {
+			return nil
+		}
+
+		content, err := os.ReadFile(path)
+		if err != nil || isBinary(content) {
+			return nil
+		}
+
+		matches := re.FindAllIndex(content, -1)
+		if len(matches) == 0 {
+			return nil
+		}
+
+		updated := re.ReplaceAll(content, []byte(replacement))
+		if string(updated) == string(content) {
+			return nil
+		}
+
+		results = append(results, replaceResult{
+			path:    relWork,
+			absPath: path,
+			mode:    info.Mode().Perm(),
+			updated: updated,
+			matches: len(matches),
+			diff:    unifiedDiff(relWork, string(content), string(updated), 2),
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	return results, scanned, nil
+}
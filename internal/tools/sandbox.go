@@ -0,0 +1,242 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/omnitrix-sh/core.sh/pkg/models"
+)
+
+// Sandbox backends
+const (
+	SandboxDocker    = "docker"
+	SandboxPodman    = "podman"
+	SandboxNamespace = "namespace"
+)
+
+const defaultSandboxImage = "debian:stable-slim"
+
+// sandboxCheckTimeout bounds asking a container engine whether it runs
+const sandboxCheckTimeout = 5 * time.Second
+
+// sandbox wraps commands so they run isolated from the host, with only the
+// working directory writable
+type sandbox struct {
+	workDir string
+	cfg     models.SandboxConfig
+}
+
+// newSandbox returns the configured sandbox, or nil when commands run
+// directly on the host
+func newSandbox(workDir string, cfg models.SandboxConfig) *sandbox {
+	if cfg.Backend == "" {
+		return nil
+	}
+	if cfg.Image == "" {
+		cfg.Image = defaultSandboxImage
+	}
+	return &sandbox{workDir: workDir, cfg: cfg}
+}
+
+// describe tells the model what the sandbox allows
+func (s *sandbox) describe() string {
+	network := "there is no network access"
+	if s.cfg.Network {
+		network = "network access is allowed"
+	}
+	if s.isContainer() {
+		return fmt.Sprintf("Commands run in a %s container: only the working directory is shared with the host and %s.", s.cfg.Image, network)
+	}
+	return fmt.Sprintf("Commands run in a sandbox: only the working directory is writable, the home directory is empty and %s.", network)
+}
+
+func (s *sandbox) isContainer() bool {
+	return s.cfg.Backend == SandboxDocker || s.cfg.Backend == SandboxPodman
+}
+
+// check returns what keeps the sandbox from running commands, and how to
+// fix it, or "" when it works
+func (s *sandbox) check(ctx context.Context) (missing, fix string) {
+	switch s.cfg.Backend {
+	case SandboxDocker, SandboxPodman:
+		binary, err := exec.LookPath(s.cfg.Backend)
+		if err != nil {
+			return s.cfg.Backend + " is not installed", fmt.Sprintf("install %s or change exec.sandbox.backend", s.cfg.Backend)
+		}
+		ctx, cancel := context.WithTimeout(ctx, sandboxCheckTimeout)
+		defer cancel()
+		if err := exec.CommandContext(ctx, binary, "info").Run(); err != nil {
+			return s.cfg.Backend + " is not running", fmt.Sprintf("start the %s daemon or change exec.sandbox.backend", s.cfg.Backend)
+		}
+	case SandboxNamespace:
+		if runtime.GOOS != "linux" {
+			return "the namespace sandbox only works on Linux", "use the docker or podman backend"
+		}
+		if _, err := exec.LookPath("bwrap"); err != nil {
+			return "bubblewrap (bwrap) is not installed", "install bubblewrap or change exec.sandbox.backend"
+		}
+		if len(s.limits()) > 0 {
+			if _, err := exec.LookPath("prlimit"); err != nil {
+				return "prlimit is not installed, so memory_mb and pids can't be applied", "install util-linux or unset exec.sandbox.memory_mb and pids"
+			}
+		}
+	default:
+		return fmt.Sprintf("unknown sandbox backend %q", s.cfg.Backend), "set exec.sandbox.backend to docker, podman or namespace"
+	}
+	return "", ""
+}
+
+// command builds the command running script with shell in dir inside the
+// sandbox. vars are set on top of the sandbox's own environment and mounts
+// are extra host directories made writable, such as the persistent shell's
+// state directory. The returned cleanup must be called once the command
+// has finished.
+func (s *sandbox) command(ctx context.Context, shell, script, dir string, vars map[string]string, mounts ...string) (*exec.Cmd, func(), error) {
+	switch s.cfg.Backend {
+	case SandboxDocker, SandboxPodman:
+		return s.containerCommand(ctx, shell, script, dir, vars, mounts)
+	case SandboxNamespace:
+		cmd, err := s.namespaceCommand(ctx, shell, script, dir, vars, mounts)
+		return cmd, func() {}, err
+	}
+	return nil, nil, fmt.Errorf("unknown sandbox backend %q: use docker, podman or namespace", s.cfg.Backend)
+}
+
+func (s *sandbox) containerCommand(ctx context.Context, shell, script, dir string, vars map[string]string, mounts []string) (*exec.Cmd, func(), error) {
+	binary, err := exec.LookPath(s.cfg.Backend)
+	if err != nil {
+		return nil, nil, fmt.Errorf("sandbox backend %s is not available: %w", s.cfg.Backend, err)
+	}
+
+	name := "omnitrix-exec-" + uuid.New().String()[:8]
+	args := []string{"run", "--rm", "--init", "--name", name, "-w", dir}
+	if !s.cfg.Network {
+		args = append(args, "--network", "none")
+	}
+	// Mount at the same paths so paths in output match the host's
+	for _, path := range append([]string{s.workDir}, mounts...) {
+		args = append(args, "-v", path+":"+path)
+	}
+	// Files created in the working directory belong to the user, not root
+	if uid := os.Getuid(); uid >= 0 {
+		if s.cfg.Backend == SandboxPodman {
+			args = append(args, "--userns", "keep-id")
+		} else {
+			args = append(args, "--user", fmt.Sprintf("%d:%d", uid, os.Getgid()))
+		}
+	}
+	if s.cfg.CPUs > 0 {
+		args = append(args, "--cpus", strconv.FormatFloat(s.cfg.CPUs, 'f', -1, 64))
+	}
+	if s.cfg.MemoryMB > 0 {
+		args = append(args, "--memory", fmt.Sprintf("%dm", s.cfg.MemoryMB))
+	}
+	if s.cfg.Pids > 0 {
+		args = append(args, "--pids-limit", strconv.Itoa(s.cfg.Pids))
+	}
+	for _, kv := range sortedVars(vars) {
+		args = append(args, "-e", kv)
+	}
+	args = append(args, s.cfg.Image, shell, "-c", script)
+
+	cmd := exec.CommandContext(ctx, binary, args...)
+	// Killing the client on a timeout leaves the container running
+	cleanup := func() {
+		if ctx.Err() == nil {
+			return
+		}
+		removeCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		exec.CommandContext(removeCtx, binary, "rm", "-f", name).Run()
+	}
+	return cmd, cleanup, nil
+}
+
+func (s *sandbox) namespaceCommand(ctx context.Context, shell, script, dir string, vars map[string]string, mounts []string) (*exec.Cmd, error) {
+	binary, err := exec.LookPath("bwrap")
+	if err != nil {
+		return nil, fmt.Errorf("sandbox backend namespace needs bubblewrap (bwrap): %w", err)
+	}
+
+	// Later mounts are laid over earlier ones, so the writable directories
+	// come after the read-only root, the private /tmp and the empty home
+	// directory that hides keys and credentials such as ~/.ssh and
+	// ~/.config
+	args := []string{
+		"--ro-bind", "/", "/",
+		"--dev", "/dev",
+		"--proc", "/proc",
+		"--tmpfs", "/tmp",
+	}
+	home, err := os.UserHomeDir()
+	if err == nil && home != "/" {
+		args = append(args, "--tmpfs", home)
+	}
+	for _, path := range append([]string{s.workDir}, mounts...) {
+		args = append(args, "--bind", path, path)
+	}
+	args = append(args, "--unshare-all", "--die-with-parent", "--new-session")
+	if s.cfg.Network {
+		args = append(args, "--share-net")
+	}
+
+	// Like in a container, the command sees only a basic environment and
+	// the session's variables, not the host's tokens and keys
+	args = append(args, "--clearenv")
+	for _, name := range sandboxEnv {
+		if value, ok := os.LookupEnv(name); ok {
+			args = append(args, "--setenv", name, value)
+		}
+	}
+	for _, kv := range sortedVars(vars) {
+		name, value, _ := strings.Cut(kv, "=")
+		args = append(args, "--setenv", name, value)
+	}
+
+	args = append(args, "--chdir", dir, "--")
+	// The limits are set inside the namespace, so they count only the
+	// sandbox's processes
+	if limits := s.limits(); len(limits) > 0 {
+		args = append(args, "prlimit")
+		args = append(args, limits...)
+		args = append(args, "--")
+	}
+	args = append(args, shell, "-c", script)
+
+	return exec.CommandContext(ctx, binary, args...), nil
+}
+
+// sandboxEnv are the host variables the namespace sandbox passes on
+var sandboxEnv = []string{"PATH", "HOME", "USER", "LANG", "LC_ALL", "TERM", "TZ"}
+
+// limits returns the prlimit options applying the memory and process
+// limits in the namespace sandbox. Memory is capped per process, as the
+// size of its data; CPUs can only be capped by the container backends.
+func (s *sandbox) limits() []string {
+	var limits []string
+	if s.cfg.MemoryMB > 0 {
+		limits = append(limits, fmt.Sprintf("--data=%d", s.cfg.MemoryMB<<20))
+	}
+	if s.cfg.Pids > 0 {
+		limits = append(limits, fmt.Sprintf("--nproc=%d", s.cfg.Pids))
+	}
+	return limits
+}
+
+// sortedVars returns vars as NAME=value pairs in a stable order
+func sortedVars(vars map[string]string) []string {
+	result := make([]string, 0, len(vars))
+	for name, value := range vars {
+		result = append(result, name+"="+value)
+	}
+	sort.Strings(result)
+	return result
+}
@@ -0,0 +1,337 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"embed"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+	"unicode"
+
+	"github.com/omnitrix-sh/core.sh/internal/depgraph"
+)
+
+//go:embed templates
+var builtinTemplates embed.FS
+
+// ScaffoldTool instantiates project templates. Template files ending in
+// .tmpl are rendered with text/template and lose the suffix, everything
+// else is copied verbatim. Path segments may also contain template actions.
+type scaffoldArgs struct {
+	Template  string                 `json:"template" description:"Template name or path to a template directory"`
+	Vars      map[string]interface{} `json:"vars,omitempty" description:"Template variables, e.g. {\"Name\": \"billing\"}"`
+	DestDir   string                 `json:"dest_dir,omitempty" default:"." description:"Directory to generate into (defaults to current directory)"`
+	DryRun    bool                   `json:"dry_run,omitempty" description:"List the files that would be generated without writing them"`
+	Overwrite bool                   `json:"overwrite,omitempty" description:"Overwrite files that already exist (default: false)"`
+}
+
+type ScaffoldTool struct {
+	workDir string
+	roots   []string // other directories it may use, see resolvePath
+}
+
+func NewScaffoldTool(workDir string, roots ...string) *ScaffoldTool {
+	return &ScaffoldTool{
+		workDir: workDir,
+		roots:   roots,
+	}
+}
+
+func (t *ScaffoldTool) Name() string {
+	return "scaffold"
+}
+
+func (t *ScaffoldTool) Description() string {
+	return fmt.Sprintf(`Generate files from a project template instead of writing boilerplate by hand.
+
+Usage:
+- Provide a template name and the variables it needs (most templates need "Name")
+- Built-in templates: %s
+- Project templates are read from .omnitrix/templates/<name>, or pass a directory path
+- Use dry_run to preview the files that would be created
+
+Existing files are never overwritten unless overwrite is set.`, strings.Join(builtinTemplateNames(), ", "))
+}
+
+// scaffoldFile is a rendered file ready to be written
+type scaffoldFile struct {
+	path    string
+	content []byte
+	mode    fs.FileMode
+}
+
+func (t *ScaffoldTool) Risk() Risk {
+	return RiskWrite
+}
+
+func (t *ScaffoldTool) Run(ctx context.Context, args scaffoldArgs) (string, error) {
+	name := args.Template
+	files, err := t.render(args)
+	if err != nil {
+		return "", err
+	}
+
+	overwrite := args.Overwrite
+	var conflicts []string
+	for _, f := range files {
+		if _, err := os.Stat(f.path); err == nil && !overwrite {
+			conflicts = append(conflicts, t.relPath(f.path))
+		}
+	}
+	if len(conflicts) > 0 {
+		return "", fmt.Errorf("files already exist (set overwrite to replace them): %s", strings.Join(conflicts, ", "))
+	}
+
+	var output strings.Builder
+	if args.DryRun {
+		output.WriteString(fmt.Sprintf("Dry run: template %s would generate %d files:\n", name, len(files)))
+		for _, f := range files {
+			output.WriteString(fmt.Sprintf("  %s (%d lines)\n", t.relPath(f.path), bytes.Count(f.content, []byte("\n"))))
+		}
+		return output.String(), nil
+	}
+
+	for _, f := range files {
+		if err := ctx.Err(); err != nil {
+			return "", err
+		}
+		if err := os.MkdirAll(filepath.Dir(f.path), 0755); err != nil {
+			return "", fmt.Errorf("failed to create parent directories: %w", err)
+		}
+		if err := os.WriteFile(f.path, f.content, f.mode); err != nil {
+			return "", fmt.Errorf("failed to write %s: %w", t.relPath(f.path), err)
+		}
+		recordChange(ctx, f.path)
+	}
+
+	output.WriteString(fmt.Sprintf("Generated %d files from template %s:\n", len(files), name))
+	for _, f := range files {
+		output.WriteString(fmt.Sprintf("  %s\n", t.relPath(f.path)))
+	}
+	return output.String(), nil
+}
+
+// Paths returns the files a call would write, none for a dry run, so
+// permission rules on paths cover every file the template generates
+func (t *ScaffoldTool) Paths(ctx context.Context, args scaffoldArgs) ([]string, error) {
+	if args.DryRun {
+		return nil, nil
+	}
+	files, err := t.render(args)
+	if err != nil {
+		return nil, err
+	}
+	paths := make([]string, len(files))
+	for i, f := range files {
+		paths[i] = f.path
+	}
+	return paths, nil
+}
+
+// render renders the template a call names, with each file's path
+// resolved in the destination directory, without writing anything
+func (t *ScaffoldTool) render(args scaffoldArgs) ([]scaffoldFile, error) {
+	name := args.Template
+	if name == "" {
+		return nil, fmt.Errorf("template is required (built-in: %s)", strings.Join(builtinTemplateNames(), ", "))
+	}
+
+	templateFS, err := t.findTemplate(name)
+	if err != nil {
+		return nil, err
+	}
+
+	destDir, err := resolvePath(t.workDir, args.DestDir, t.roots...)
+	if err != nil {
+		return nil, err
+	}
+
+	vars := t.defaultVars()
+	for key, val := range args.Vars {
+		vars[key] = val
+	}
+
+	files, err := renderTemplate(templateFS, vars)
+	if err != nil {
+		return nil, fmt.Errorf("failed to render template %s: %w", name, err)
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("template %s contains no files", name)
+	}
+	for i := range files {
+		target, err := resolvePath(destDir, files[i].path)
+		if err != nil {
+			return nil, fmt.Errorf("template path %s: %w", files[i].path, err)
+		}
+		files[i].path = target
+	}
+	return files, nil
+}
+
+// findTemplate looks up a template by name in the project's template
+// directory, then the built-in templates, then as a workspace path
+func (t *ScaffoldTool) findTemplate(name string) (fs.FS, error) {
+	if !strings.ContainsAny(name, `/\`) {
+		projectDir := filepath.Join(t.workDir, ".omnitrix", "templates", name)
+		if info, err := os.Stat(projectDir); err == nil && info.IsDir() {
+			return os.DirFS(projectDir), nil
+		}
+
+		if sub, err := fs.Sub(builtinTemplates, path.Join("templates", name)); err == nil {
+			if _, err := fs.Stat(sub, "."); err == nil {
+				if entries, err := fs.ReadDir(sub, "."); err == nil && len(entries) > 0 {
+					return sub, nil
+				}
+			}
+		}
+	}
+
+	dir, err := resolvePath(t.workDir, name, t.roots...)
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(dir)
+	if err != nil || !info.IsDir() {
+		return nil, fmt.Errorf("template not found: %s (built-in: %s)", name, strings.Join(builtinTemplateNames(), ", "))
+	}
+	return os.DirFS(dir), nil
+}
+
+// defaultVars returns variables every template can use without the model
+// having to supply them
+func (t *ScaffoldTool) defaultVars() map[string]interface{} {
+	vars := make(map[string]interface{})
+	if module := depgraph.ModulePath(filepath.Join(t.workDir, "go.mod")); module != "" {
+		vars["Module"] = module
+	}
+	return vars
+}
+
+func renderTemplate(templateFS fs.FS, vars map[string]interface{}) ([]scaffoldFile, error) {
+	var files []scaffoldFile
+
+	err := fs.WalkDir(templateFS, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+
+		outPath, err := renderString(p, p, vars)
+		if err != nil {
+			return err
+		}
+
+		content, err := fs.ReadFile(templateFS, p)
+		if err != nil {
+			return err
+		}
+
+		if strings.HasSuffix(outPath, ".tmpl") {
+			outPath = strings.TrimSuffix(outPath, ".tmpl")
+			rendered, err := renderString(p, string(content), vars)
+			if err != nil {
+				return err
+			}
+			content = []byte(rendered)
+		}
+
+		mode := fs.FileMode(0644)
+		if info, err := d.Info(); err == nil && info.Mode().Perm()&0111 != 0 {
+			mode = 0755
+		}
+
+		files = append(files, scaffoldFile{path: filepath.FromSlash(outPath), content: content, mode: mode})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(files, func(i, j int) bool { return files[i].path < files[j].path })
+	return files, nil
+}
+
+func renderString(name, text string, vars map[string]interface{}) (string, error) {
+	tmpl, err := template.New(name).Funcs(scaffoldFuncs).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, vars); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+var scaffoldFuncs = template.FuncMap{
+	"lower": strings.ToLower,
+	"upper": strings.ToUpper,
+	"title": func(s string) string {
+		if s == "" {
+			return s
+		}
+		runes := []rune(s)
+		runes[0] = unicode.ToUpper(runes[0])
+		return string(runes)
+	},
+	"snake": func(s string) string { return joinWords(s, "_") },
+	"kebab": func(s string) string { return joinWords(s, "-") },
+}
+
+// joinWords splits camelCase, kebab-case and snake_case identifiers into
+// lowercase words joined by sep
+func joinWords(s, sep string) string {
+	var words []string
+	var current []rune
+	runes := []rune(s)
+	for i, r := range runes {
+		switch {
+		case r == '_' || r == '-' || unicode.IsSpace(r):
+			if len(current) > 0 {
+				words = append(words, string(current))
+				current = nil
+			}
+			continue
+		case unicode.IsUpper(r) && i > 0 && len(current) > 0 &&
+			(unicode.IsLower(runes[i-1]) || (i+1 < len(runes) && unicode.IsLower(runes[i+1]))):
+			words = append(words, string(current))
+			current = nil
+		}
+		current = append(current, unicode.ToLower(r))
+	}
+	if len(current) > 0 {
+		words = append(words, string(current))
+	}
+	return strings.Join(words, sep)
+}
+
+func builtinTemplateNames() []string {
+	entries, err := builtinTemplates.ReadDir("templates")
+	if err != nil {
+		return nil
+	}
+
+	var names []string
+	for _, e := range entries {
+		if e.IsDir() {
+			names = append(names, e.Name())
+		}
+	}
+	return names
+}
+
+func (t *ScaffoldTool) relPath(p string) string {
+	if rel, err := filepath.Rel(t.workDir, p); err == nil {
+		return rel
+	}
+	return p
+}
@@ -0,0 +1,387 @@
+package tools
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/go-sql-driver/mysql"
+	_ "github.com/jackc/pgx/v5/stdlib"
+	"github.com/omnitrix-sh/core.sh/pkg/models"
+)
+
+const (
+	defaultSQLRows = 100
+	maxSQLRows     = 1000
+	maxSQLCell     = 200 // bytes of a value shown in the table
+)
+
+// sqlDrivers are the database/sql drivers of the config's driver names
+var sqlDrivers = map[string]string{
+	"sqlite":   sqliteConfined,
+	"postgres": "pgx",
+	"mysql":    "mysql",
+}
+
+// sqliteConfined is SQLite with ATTACH, and so VACUUM INTO, disabled, which
+// would otherwise create or open files anywhere, even on a read-only
+// connection
+const sqliteConfined = "sqlite3_confined"
+
+type sqlQueryArgs struct {
+	Database string `json:"database" description:"Name of a configured database, or the path of a SQLite file in the workspace"`
+	Query    string `json:"query" description:"The SQL statement to run"`
+	MaxRows  int    `json:"max_rows,omitempty" default:"100" description:"Rows shown at most (max 1000)"`
+}
+
+type sqlExecuteArgs struct {
+	Database string `json:"database" description:"Name of a writable configured database"`
+	Query    string `json:"query" description:"The SQL statement to run"`
+	MaxRows  int    `json:"max_rows,omitempty" default:"100" description:"Rows shown at most (max 1000)"`
+}
+
+// SQLQueryTool runs queries on databases read-only, even those that are
+// writable; SQLExecuteTool changes them
+type SQLQueryTool struct {
+	workDir   string
+	databases map[string]models.DatabaseConfig
+	roots     []string // other directories SQLite files may be in, see resolvePath
+	write     bool     // statements may change writable databases
+}
+
+func NewSQLQueryTool(workDir string, databases map[string]models.DatabaseConfig, roots ...string) *SQLQueryTool {
+	return &SQLQueryTool{
+		workDir:   workDir,
+		databases: databases,
+		roots:     roots,
+	}
+}
+
+// sqlQueryFromOptions offers sql_query only for projects with databases
+func sqlQueryFromOptions(o Options) Tool {
+	if len(o.Databases) == 0 {
+		return nil
+	}
+	return Typed[sqlQueryArgs](NewSQLQueryTool(o.WorkDir, o.Databases, o.Roots...))
+}
+
+func (t *SQLQueryTool) Name() string {
+	return "sql_query"
+}
+
+func (t *SQLQueryTool) Description() string {
+	names := make([]string, 0, len(t.databases))
+	for name := range t.databases {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	databases := make([]string, len(names))
+	for i, name := range names {
+		databases[i] = fmt.Sprintf("- %s (%s)", name, sqlDriver(t.databases[name]))
+	}
+
+	return `Run a read-only SQL query against a project database and return the rows as a table.
+
+Usage:
+- Name a configured database, or give the path of a SQLite file in the workspace
+- Statements that change the database fail; use sql_execute, where offered, for those
+- At most max_rows rows are shown; add LIMIT, WHERE or aggregates to the query rather than paging through large tables
+- Look up the schema first, e.g. sqlite_master for SQLite or information_schema for Postgres and MySQL
+
+Configured databases:
+` + strings.Join(databases, "\n")
+}
+
+func (t *SQLQueryTool) Risk() Risk {
+	return RiskRead
+}
+
+func (t *SQLQueryTool) Run(ctx context.Context, args sqlQueryArgs) (string, error) {
+	query := strings.TrimSpace(args.Query)
+	if query == "" {
+		return "", fmt.Errorf("query is empty")
+	}
+	maxRows := args.MaxRows
+	if maxRows <= 0 {
+		maxRows = defaultSQLRows
+	}
+	if maxRows > maxSQLRows {
+		maxRows = maxSQLRows
+	}
+
+	db, writable, err := t.open(args.Database)
+	if err != nil {
+		return "", err
+	}
+	defer db.Close()
+
+	// Read-only connections still get a read-only transaction, so drivers
+	// that can't open read-only are covered; it is rolled back either way
+	tx, err := db.BeginTx(ctx, &sql.TxOptions{ReadOnly: !writable})
+	if err != nil {
+		return "", fmt.Errorf("failed to connect to %s: %w", args.Database, err)
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, query)
+	if err != nil {
+		return "", fmt.Errorf("query failed: %w", err)
+	}
+	table, err := formatRows(rows, maxRows)
+	if err != nil {
+		return "", fmt.Errorf("query failed: %w", err)
+	}
+	if writable {
+		if err := tx.Commit(); err != nil {
+			return "", fmt.Errorf("failed to commit: %w", err)
+		}
+	}
+	return table, nil
+}
+
+// SQLExecuteTool runs statements that change the writable databases
+type SQLExecuteTool struct {
+	query *SQLQueryTool
+}
+
+// NewSQLExecuteTool creates the tool for the writable databases among
+// databases
+func NewSQLExecuteTool(workDir string, databases map[string]models.DatabaseConfig, roots ...string) *SQLExecuteTool {
+	writable := make(map[string]models.DatabaseConfig)
+	for name, db := range databases {
+		if db.Writable {
+			writable[name] = db
+		}
+	}
+	return &SQLExecuteTool{query: &SQLQueryTool{workDir: workDir, databases: writable, roots: roots, write: true}}
+}
+
+// sqlExecuteFromOptions offers sql_execute only for projects with writable
+// databases
+func sqlExecuteFromOptions(o Options) Tool {
+	tool := NewSQLExecuteTool(o.WorkDir, o.Databases, o.Roots...)
+	if len(tool.query.databases) == 0 {
+		return nil
+	}
+	return Typed[sqlExecuteArgs](tool)
+}
+
+func (t *SQLExecuteTool) Name() string {
+	return "sql_execute"
+}
+
+func (t *SQLExecuteTool) Description() string {
+	names := make([]string, 0, len(t.query.databases))
+	for name := range t.query.databases {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	databases := make([]string, len(names))
+	for i, name := range names {
+		databases[i] = fmt.Sprintf("- %s (%s)", name, sqlDriver(t.query.databases[name]))
+	}
+
+	return `Run a SQL statement that changes a writable project database, such as INSERT, UPDATE or a migration, and return any rows as a table.
+
+Usage:
+- Only the databases below can be changed; use sql_query to read
+- The statement runs in a transaction that is committed when it succeeds
+
+Writable databases:
+` + strings.Join(databases, "\n")
+}
+
+func (t *SQLExecuteTool) Risk() Risk {
+	return RiskWrite
+}
+
+func (t *SQLExecuteTool) Run(ctx context.Context, args sqlExecuteArgs) (string, error) {
+	return t.query.Run(ctx, sqlQueryArgs(args))
+}
+
+// open connects to the database named, or the SQLite file at the path
+// given, reporting whether it may be changed: only writable databases,
+// and only by sql_execute
+func (t *SQLQueryTool) open(database string) (*sql.DB, bool, error) {
+	cfg, configured := t.databases[database]
+	switch {
+	case t.write && !configured:
+		return nil, false, fmt.Errorf("unknown database %q: sql_execute only runs on writable configured databases", database)
+	case !configured:
+		cfg = models.DatabaseConfig{Driver: "sqlite", DSN: database}
+	case !t.write:
+		cfg.Writable = false
+	}
+	driver := sqlDriver(cfg)
+	name, ok := sqlDrivers[driver]
+	if !ok {
+		return nil, false, fmt.Errorf("database %s: unknown driver %q, use sqlite, postgres or mysql", database, driver)
+	}
+
+	dsn := cfg.DSN
+	switch driver {
+	case "sqlite":
+		absPath, err := resolvePath(t.workDir, cfg.DSN, t.roots...)
+		if err != nil {
+			return nil, false, err
+		}
+		if _, err := os.Stat(absPath); err != nil {
+			if configured {
+				return nil, false, fmt.Errorf("database %s: %w", database, err)
+			}
+			return nil, false, fmt.Errorf("unknown database %q: it is neither configured nor a SQLite file in the workspace", database)
+		}
+		mode := "ro"
+		if cfg.Writable {
+			mode = "rw"
+		}
+		dsn = "file:" + (&url.URL{Path: absPath}).EscapedPath() + "?mode=" + mode
+	case "mysql":
+		var err error
+		if dsn, err = mysqlDSN(cfg.DSN); err != nil {
+			return nil, false, fmt.Errorf("database %s: %w", database, err)
+		}
+	}
+
+	db, err := sql.Open(name, dsn)
+	if err != nil {
+		return nil, false, fmt.Errorf("database %s: %w", database, err)
+	}
+	db.SetMaxOpenConns(1)
+	return db, cfg.Writable, nil
+}
+
+// sqlDriver returns the driver of a database, following from its DSN when
+// not configured
+func sqlDriver(cfg models.DatabaseConfig) string {
+	switch {
+	case cfg.Driver != "":
+		return strings.ToLower(cfg.Driver)
+	case strings.HasPrefix(cfg.DSN, "postgres://"), strings.HasPrefix(cfg.DSN, "postgresql://"):
+		return "postgres"
+	case strings.HasPrefix(cfg.DSN, "mysql://"):
+		return "mysql"
+	}
+	return "sqlite"
+}
+
+// mysqlDSN turns a mysql:// URL into the MySQL driver's DSN format. Other
+// DSNs are taken to be in that format already.
+func mysqlDSN(dsn string) (string, error) {
+	if !strings.HasPrefix(dsn, "mysql://") {
+		return dsn, nil
+	}
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return "", fmt.Errorf("invalid URL: %w", err)
+	}
+	cfg := mysql.NewConfig()
+	cfg.Net = "tcp"
+	cfg.Addr = u.Host
+	if u.Port() == "" {
+		cfg.Addr += ":3306"
+	}
+	cfg.DBName = strings.TrimPrefix(u.Path, "/")
+	if u.User != nil {
+		cfg.User = u.User.Username()
+		cfg.Passwd, _ = u.User.Password()
+	}
+	for key, values := range u.Query() {
+		if cfg.Params == nil {
+			cfg.Params = make(map[string]string)
+		}
+		cfg.Params[key] = values[len(values)-1]
+	}
+	return cfg.FormatDSN(), nil
+}
+
+// formatRows renders up to maxRows rows as a table with a line on how
+// many there were
+func formatRows(rows *sql.Rows, maxRows int) (string, error) {
+	defer rows.Close()
+	columns, err := rows.Columns()
+	if err != nil {
+		return "", err
+	}
+	if len(columns) == 0 {
+		// Some drivers, like SQLite's, only run a statement as its rows are
+		// read
+		for rows.Next() {
+		}
+		if err := rows.Err(); err != nil {
+			return "", err
+		}
+		return "The statement ran and returned no rows.", nil
+	}
+
+	var b strings.Builder
+	b.WriteString("| " + strings.Join(columns, " | ") + " |\n")
+	b.WriteString("|" + strings.Repeat(" --- |", len(columns)) + "\n")
+
+	values := make([]interface{}, len(columns))
+	pointers := make([]interface{}, len(columns))
+	for i := range values {
+		pointers[i] = &values[i]
+	}
+	cells := make([]string, len(columns))
+	count, more := 0, false
+	for rows.Next() {
+		if count == maxRows {
+			more = true
+			break
+		}
+		if err := rows.Scan(pointers...); err != nil {
+			return "", err
+		}
+		for i, value := range values {
+			cells[i] = sqlCell(value)
+		}
+		b.WriteString("| " + strings.Join(cells, " | ") + " |\n")
+		count++
+	}
+	if err := rows.Err(); err != nil {
+		return "", err
+	}
+
+	switch {
+	case more:
+		fmt.Fprintf(&b, "\n[first %d rows shown, the query returned more]", count)
+	case count == 1:
+		b.WriteString("\n(1 row)")
+	default:
+		fmt.Fprintf(&b, "\n(%d rows)", count)
+	}
+	return b.String(), nil
+}
+
+// sqlCell renders a value for a table cell on one line
+func sqlCell(value interface{}) string {
+	var s string
+	switch v := value.(type) {
+	case nil:
+		return "NULL"
+	case []byte:
+		if !utf8.Valid(v) {
+			return fmt.Sprintf("<%d bytes>", len(v))
+		}
+		s = string(v)
+	case time.Time:
+		s = v.Format(time.RFC3339Nano)
+	default:
+		s = fmt.Sprint(v)
+	}
+	if len(s) > maxSQLCell {
+		cut := maxSQLCell
+		for cut > 0 && !utf8.RuneStart(s[cut]) {
+			cut--
+		}
+		s = s[:cut] + "..."
+	}
+	return strings.NewReplacer("\r", `\r`, "\n", `\n`, "|", `\|`).Replace(s)
+}
@@ -0,0 +1,14 @@
+//go:build !cgo
+
+package tools
+
+import (
+	"database/sql"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// Without cgo the driver only fails to open, saying it needs cgo
+func init() {
+	sql.Register(sqliteConfined, &sqlite3.SQLiteDriver{})
+}
@@ -3,18 +3,48 @@ package tools
 import (
 	"context"
 	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
 
 	"github.com/omnitrix-sh/core.sh/pkg/models"
 )
 
+// Risk is how much harm a tool can do, used to decide whether running it
+// needs the user's approval
+type Risk string
+
+const (
+	RiskRead    Risk = "read"    // only reads the workspace
+	RiskWrite   Risk = "write"   // changes files or other local state
+	RiskExecute Risk = "execute" // runs commands
+	RiskNetwork Risk = "network" // makes network requests
+)
+
 // Tool is the interface that all tools must implement
 type Tool interface {
 	Name() string
 	Description() string
 	Parameters() map[string]interface{}
+	Risk() Risk
 	Execute(ctx context.Context, args map[string]interface{}) (string, error)
 }
 
+// Previewer is implemented by tools that can show what they would change
+// before they run, such as a diff of the file they edit, so the user can
+// judge the change when asked to approve it
+type Previewer interface {
+	Preview(ctx context.Context, args map[string]interface{}) (string, error)
+}
+
+// PathLister is implemented by tools that change files their path
+// arguments don't name, such as those in a patch's headers, so permission
+// rules on paths cover every file they touch
+type PathLister interface {
+	Paths(ctx context.Context, args map[string]interface{}) ([]string, error)
+}
+
 // ToModelTool converts a Tool to the models.Tool format
 func ToModelTool(t Tool) models.Tool {
 	return models.Tool{
@@ -68,3 +98,99 @@ func GetBoolArg(args map[string]interface{}, key string, defaultVal bool) bool {
 	}
 	return defaultVal
 }
+
+// GetStringSliceArg safely gets a string array argument
+func GetStringSliceArg(args map[string]interface{}, key string) []string {
+	val, ok := args[key]
+	if !ok {
+		return nil
+	}
+
+	switch v := val.(type) {
+	case []string:
+		return v
+	case []interface{}:
+		result := make([]string, 0, len(v))
+		for _, item := range v {
+			if str, ok := item.(string); ok {
+				result = append(result, str)
+			}
+		}
+		return result
+	case string:
+		if v != "" {
+			return []string{v}
+		}
+	}
+	return nil
+}
+
+// resolvePath resolves a path relative to workDir and ensures it stays
+// inside the working directory or one of roots, the extra directories file
+// tools may use. Symlinks are followed, so a link can't lead out of them;
+// paths that don't exist yet are checked through their nearest existing
+// parent, so files can still be created. The path is returned as given,
+// made absolute, not with its symlinks resolved.
+func resolvePath(workDir, path string, roots ...string) (string, error) {
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(workDir, path)
+	}
+
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve path: %w", err)
+	}
+	realPath, err := EvalExisting(absPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve path: %w", err)
+	}
+
+	for _, root := range append([]string{workDir}, roots...) {
+		absRoot, err := filepath.Abs(root)
+		if err != nil {
+			return "", fmt.Errorf("failed to resolve work directory: %w", err)
+		}
+		realRoot, err := filepath.EvalSymlinks(absRoot)
+		if err != nil {
+			realRoot = absRoot
+		}
+		if within(realRoot, realPath) {
+			return absPath, nil
+		}
+	}
+	return "", fmt.Errorf("access denied: path is outside working directory")
+}
+
+// EvalExisting is filepath.EvalSymlinks for paths whose last elements may
+// not exist yet: the longest existing prefix is resolved and the rest
+// appended. An existing link that can't be followed, such as one whose
+// target is missing, is an error, since writing to it would create the
+// target wherever it points.
+func EvalExisting(path string) (string, error) {
+	var missing []string
+	for {
+		resolved, err := filepath.EvalSymlinks(path)
+		if err == nil {
+			return filepath.Join(append([]string{resolved}, missing...)...), nil
+		}
+		if _, lstatErr := os.Lstat(path); lstatErr == nil {
+			return "", err
+		}
+		parent := filepath.Dir(path)
+		if parent == path {
+			return filepath.Join(append([]string{path}, missing...)...), nil
+		}
+		missing = append([]string{filepath.Base(path)}, missing...)
+		path = parent
+	}
+}
+
+// within reports whether path is root or inside it. Both must be absolute
+// and clean.
+func within(root, path string) bool {
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return false
+	}
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
@@ -0,0 +1,71 @@
+package tools
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestResolvePath(t *testing.T) {
+	base := t.TempDir()
+	workDir := filepath.Join(base, "work")
+	sibling := filepath.Join(base, "work2")
+	extra := filepath.Join(base, "extra")
+	outside := filepath.Join(base, "outside")
+	for _, dir := range []string{workDir, filepath.Join(workDir, "sub"), sibling, extra, outside} {
+		if err := os.Mkdir(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	links := map[string]string{
+		filepath.Join(workDir, "escape"):   outside,
+		filepath.Join(workDir, "inside"):   filepath.Join(workDir, "sub"),
+		filepath.Join(workDir, "to-extra"): extra,
+		filepath.Join(workDir, "dangling"): filepath.Join(outside, "missing"),
+	}
+	for link, target := range links {
+		if err := os.Symlink(target, link); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name  string
+		path  string
+		roots []string
+		want  string // empty when the path must be rejected
+	}{
+		{"relative", "a/b.txt", nil, filepath.Join(workDir, "a/b.txt")},
+		{"work dir itself", ".", nil, workDir},
+		{"absolute inside", filepath.Join(workDir, "x"), nil, filepath.Join(workDir, "x")},
+		{"parent", "..", nil, ""},
+		{"climbing out", "../outside/x", nil, ""},
+		{"prefix sibling", sibling, nil, ""},
+		{"prefix sibling relative", "../work2/x", nil, ""},
+		{"symlink escape", "escape/x", nil, ""},
+		{"symlink escape itself", "escape", nil, ""},
+		{"symlink inside", "inside/x", nil, filepath.Join(workDir, "inside/x")},
+		{"dangling symlink", "dangling", nil, ""},
+		{"extra root", filepath.Join(extra, "x"), []string{extra}, filepath.Join(extra, "x")},
+		{"extra root through symlink", "to-extra/x", []string{extra}, filepath.Join(workDir, "to-extra/x")},
+		{"symlink to unlisted root", "to-extra/x", nil, ""},
+		{"outside every root", filepath.Join(outside, "x"), []string{extra}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := resolvePath(workDir, tt.path, tt.roots...)
+			if tt.want == "" {
+				if err == nil {
+					t.Fatalf("resolvePath(%q) = %q, want an error", tt.path, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("resolvePath(%q): %v", tt.path, err)
+			}
+			if got != tt.want {
+				t.Errorf("resolvePath(%q) = %q, want %q", tt.path, got, tt.want)
+			}
+		})
+	}
+}
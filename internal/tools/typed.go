@@ -0,0 +1,376 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+)
+
+// TypedTool is a tool that takes its arguments as a struct instead of a
+// map. Wrapped with Typed, its parameter schema is derived from the struct
+// and arguments are checked against it before Run is called.
+//
+// Fields are described with tags:
+//
+//	json:"name"               the argument's name
+//	json:"name,omitempty"     makes it optional, as does a pointer type
+//	description:"..."         what the model is told about it
+//	enum:"a,b,c"              the values it may take
+//	default:"10"              its value when left out, as JSON unless it is a string
+//
+// Fields without omitempty, a pointer type or a default are required.
+//
+// A TypedTool can also list the paths it changes and preview its changes
+// by implementing Paths and Preview with Args in place of the map, see
+// PathLister and Previewer.
+type TypedTool[Args any] interface {
+	Name() string
+	Description() string
+	Risk() Risk
+	Run(ctx context.Context, args Args) (string, error)
+}
+
+// Typed adapts a TypedTool to the Tool interface. It panics if Args is not
+// a struct or its tags are invalid, which is a programming error.
+func Typed[Args any](tool TypedTool[Args]) Tool {
+	argsType := reflect.TypeOf((*Args)(nil)).Elem()
+	if argsType.Kind() != reflect.Struct {
+		panic(fmt.Sprintf("tool %s: arguments must be a struct, not %s", tool.Name(), argsType))
+	}
+	schema, err := schemaOf(argsType)
+	if err != nil {
+		panic(fmt.Sprintf("tool %s: %v", tool.Name(), err))
+	}
+	return &typed[Args]{TypedTool: tool, argsType: argsType, schema: schema}
+}
+
+type typed[Args any] struct {
+	TypedTool[Args]
+	argsType reflect.Type
+	schema   map[string]interface{}
+}
+
+func (t *typed[Args]) Parameters() map[string]interface{} {
+	return t.schema
+}
+
+func (t *typed[Args]) Execute(ctx context.Context, args map[string]interface{}) (string, error) {
+	var decoded Args
+	if err := decodeArgs(t.argsType, args, &decoded); err != nil {
+		return "", err
+	}
+	return t.Run(ctx, decoded)
+}
+
+// Paths makes every typed tool a PathLister; tools without a Paths of
+// their own list no paths
+func (t *typed[Args]) Paths(ctx context.Context, args map[string]interface{}) ([]string, error) {
+	lister, ok := t.TypedTool.(interface {
+		Paths(ctx context.Context, args Args) ([]string, error)
+	})
+	if !ok {
+		return nil, nil
+	}
+	var decoded Args
+	if err := decodeArgs(t.argsType, args, &decoded); err != nil {
+		return nil, err
+	}
+	return lister.Paths(ctx, decoded)
+}
+
+// Preview makes every typed tool a Previewer; tools without a Preview of
+// their own show nothing
+func (t *typed[Args]) Preview(ctx context.Context, args map[string]interface{}) (string, error) {
+	previewer, ok := t.TypedTool.(interface {
+		Preview(ctx context.Context, args Args) (string, error)
+	})
+	if !ok {
+		return "", nil
+	}
+	var decoded Args
+	if err := decodeArgs(t.argsType, args, &decoded); err != nil {
+		return "", err
+	}
+	return previewer.Preview(ctx, decoded)
+}
+
+// decodeArgs checks args against the struct type and stores them in out
+func decodeArgs(argsType reflect.Type, args map[string]interface{}, out interface{}) error {
+	if args == nil {
+		args = map[string]interface{}{}
+	}
+	normalized, err := normalize(argsType, args, "")
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(normalized)
+	if err != nil {
+		return fmt.Errorf("invalid arguments: %w", err)
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("invalid arguments: %w", err)
+	}
+	return nil
+}
+
+// field is a struct field taking part in the schema
+type field struct {
+	index       int
+	name        string
+	required    bool
+	description string
+	enum        []string
+	def         interface{} // nil without a default
+}
+
+// fieldsOf returns the argument fields of a struct type
+func fieldsOf(t reflect.Type) ([]field, error) {
+	var fields []field
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if !sf.IsExported() {
+			continue
+		}
+		tag := sf.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, options, _ := strings.Cut(tag, ",")
+		if name == "" {
+			name = sf.Name
+		}
+
+		f := field{
+			index:       i,
+			name:        name,
+			description: sf.Tag.Get("description"),
+			required:    sf.Type.Kind() != reflect.Pointer && !strings.Contains(options, "omitempty"),
+		}
+		if enum := sf.Tag.Get("enum"); enum != "" {
+			f.enum = strings.Split(enum, ",")
+		}
+		if def, ok := sf.Tag.Lookup("default"); ok {
+			var value interface{} = def
+			if elem(sf.Type).Kind() != reflect.String {
+				if err := json.Unmarshal([]byte(def), &value); err != nil {
+					return nil, fmt.Errorf("field %s: invalid default %q: %w", sf.Name, def, err)
+				}
+			}
+			normalized, err := normalize(sf.Type, value, name)
+			if err != nil {
+				return nil, fmt.Errorf("field %s: invalid default: %w", sf.Name, err)
+			}
+			f.def = normalized
+			f.required = false
+		}
+		fields = append(fields, f)
+	}
+	return fields, nil
+}
+
+// schemaOf derives the JSON schema of a type
+func schemaOf(t reflect.Type) (map[string]interface{}, error) {
+	t = elem(t)
+	switch t.Kind() {
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}, nil
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}, nil
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}, nil
+	case reflect.Interface:
+		return map[string]interface{}{}, nil
+	case reflect.Slice, reflect.Array:
+		items, err := schemaOf(t.Elem())
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"type": "array", "items": items}, nil
+	case reflect.Map:
+		if t.Key().Kind() != reflect.String {
+			return nil, fmt.Errorf("map keys must be strings, not %s", t.Key())
+		}
+		values, err := schemaOf(t.Elem())
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"type": "object", "additionalProperties": values}, nil
+	case reflect.Struct:
+		fields, err := fieldsOf(t)
+		if err != nil {
+			return nil, err
+		}
+		properties := make(map[string]interface{}, len(fields))
+		var required []string
+		for _, f := range fields {
+			property, err := schemaOf(t.Field(f.index).Type)
+			if err != nil {
+				return nil, fmt.Errorf("field %s: %w", t.Field(f.index).Name, err)
+			}
+			if f.description != "" {
+				property["description"] = f.description
+			}
+			if f.enum != nil {
+				property["enum"] = f.enum
+			}
+			if f.def != nil {
+				property["default"] = f.def
+			}
+			properties[f.name] = property
+			if f.required {
+				required = append(required, f.name)
+			}
+		}
+		schema := map[string]interface{}{"type": "object", "properties": properties}
+		if len(required) > 0 {
+			schema["required"] = required
+		}
+		return schema, nil
+	}
+	return nil, fmt.Errorf("unsupported argument type %s", t)
+}
+
+// normalize checks a decoded JSON value against a type, filling in
+// defaults. Models often send a single value where a list is expected, so
+// that is accepted as a list of one.
+func normalize(t reflect.Type, value interface{}, path string) (interface{}, error) {
+	t = elem(t)
+	switch t.Kind() {
+	case reflect.String:
+		if _, ok := value.(string); !ok {
+			return nil, argError(path, "must be a string")
+		}
+	case reflect.Bool:
+		if _, ok := value.(bool); !ok {
+			return nil, argError(path, "must be true or false")
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, ok := number(value)
+		if !ok || n != math.Trunc(n) {
+			return nil, argError(path, "must be an integer")
+		}
+		if n < 0 && t.Kind() >= reflect.Uint && t.Kind() <= reflect.Uint64 {
+			return nil, argError(path, "must not be negative")
+		}
+		return int64(n), nil
+	case reflect.Float32, reflect.Float64:
+		n, ok := number(value)
+		if !ok {
+			return nil, argError(path, "must be a number")
+		}
+		return n, nil
+	case reflect.Slice, reflect.Array:
+		items, ok := value.([]interface{})
+		if !ok {
+			items = []interface{}{value}
+		}
+		result := make([]interface{}, len(items))
+		for i, item := range items {
+			normalized, err := normalize(t.Elem(), item, fmt.Sprintf("%s[%d]", path, i))
+			if err != nil {
+				return nil, err
+			}
+			result[i] = normalized
+		}
+		return result, nil
+	case reflect.Map:
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, argError(path, "must be an object")
+		}
+		result := make(map[string]interface{}, len(object))
+		for key, item := range object {
+			normalized, err := normalize(t.Elem(), item, join(path, key))
+			if err != nil {
+				return nil, err
+			}
+			result[key] = normalized
+		}
+		return result, nil
+	case reflect.Struct:
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, argError(path, "must be an object")
+		}
+		fields, err := fieldsOf(t)
+		if err != nil {
+			return nil, err
+		}
+		result := make(map[string]interface{}, len(fields))
+		for _, f := range fields {
+			name := join(path, f.name)
+			item, ok := object[f.name]
+			if !ok || item == nil {
+				switch {
+				case f.def != nil:
+					result[f.name] = f.def
+				case f.required:
+					return nil, fmt.Errorf("%s is required", name)
+				}
+				continue
+			}
+			normalized, err := normalize(t.Field(f.index).Type, item, name)
+			if err != nil {
+				return nil, err
+			}
+			if f.enum != nil {
+				if s, _ := normalized.(string); !contains(f.enum, s) {
+					return nil, fmt.Errorf("%s must be one of %s", name, strings.Join(f.enum, ", "))
+				}
+			}
+			result[f.name] = normalized
+		}
+		return result, nil
+	}
+	return value, nil
+}
+
+// elem returns the type pointers point to
+func elem(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	return t
+}
+
+func number(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	}
+	return 0, false
+}
+
+func argError(path, problem string) error {
+	if path == "" {
+		return fmt.Errorf("arguments %s", problem)
+	}
+	return fmt.Errorf("%s %s", path, problem)
+}
+
+func join(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
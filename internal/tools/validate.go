@@ -0,0 +1,184 @@
+package tools
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// ValidationError is a tool call whose arguments don't fit the tool's
+// parameter schema. It lists every problem along with the parameters the
+// tool takes, so the model can correct the call in one go.
+type ValidationError struct {
+	Tool     string
+	Problems []string
+	Usage    string // the tool's parameters, see usage
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("invalid arguments for %s: %s\nParameters: %s", e.Tool, strings.Join(e.Problems, "; "), e.Usage)
+}
+
+// ValidateArgs checks a call's arguments against the tool's parameter
+// schema before it runs: their types, required parameters and enums. As
+// with typed tools, a null counts as left out and a single value is
+// accepted where a list is expected. It returns a *ValidationError.
+func ValidateArgs(tool Tool, args map[string]interface{}) error {
+	schema := tool.Parameters()
+	if args == nil {
+		args = map[string]interface{}{}
+	}
+	var problems []string
+	checkValue(schema, args, "", &problems)
+	if len(problems) == 0 {
+		return nil
+	}
+	return &ValidationError{Tool: tool.Name(), Problems: problems, Usage: usage(schema)}
+}
+
+// checkValue appends what is wrong with value under schema to problems
+func checkValue(schema map[string]interface{}, value interface{}, path string, problems *[]string) {
+	if len(schema) == 0 {
+		return
+	}
+	typ, _ := schema["type"].(string)
+	switch typ {
+	case "string":
+		if _, ok := value.(string); !ok {
+			*problems = append(*problems, argError(path, "must be a string").Error())
+			return
+		}
+	case "integer":
+		if n, ok := number(value); !ok || n != math.Trunc(n) {
+			*problems = append(*problems, argError(path, "must be an integer").Error())
+			return
+		}
+	case "number":
+		if _, ok := number(value); !ok {
+			*problems = append(*problems, argError(path, "must be a number").Error())
+			return
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			*problems = append(*problems, argError(path, "must be true or false").Error())
+			return
+		}
+	case "array":
+		items, _ := schema["items"].(map[string]interface{})
+		list, ok := value.([]interface{})
+		if !ok {
+			checkValue(items, value, path, problems)
+			return
+		}
+		for i, item := range list {
+			checkValue(items, item, fmt.Sprintf("%s[%d]", path, i), problems)
+		}
+		return
+	case "object":
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			*problems = append(*problems, argError(path, "must be an object").Error())
+			return
+		}
+		checkObject(schema, object, path, problems)
+		return
+	}
+
+	if enum := stringList(schema["enum"]); enum != nil {
+		if s, _ := value.(string); !contains(enum, s) {
+			*problems = append(*problems, argError(path, "must be one of "+strings.Join(enum, ", ")).Error())
+		}
+	}
+}
+
+// checkObject checks the properties of an object against schema
+func checkObject(schema, object map[string]interface{}, path string, problems *[]string) {
+	properties, _ := schema["properties"].(map[string]interface{})
+	for _, name := range stringList(schema["required"]) {
+		if object[name] == nil {
+			*problems = append(*problems, fmt.Sprintf("%s is required", join(path, name)))
+		}
+	}
+
+	names := make([]string, 0, len(object))
+	for name := range object {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		value := object[name]
+		if value == nil {
+			continue
+		}
+		if property, ok := properties[name].(map[string]interface{}); ok {
+			checkValue(property, value, join(path, name), problems)
+			continue
+		}
+		switch additional := schema["additionalProperties"].(type) {
+		case bool:
+			if !additional {
+				*problems = append(*problems, fmt.Sprintf("%s is not a parameter", join(path, name)))
+			}
+		case map[string]interface{}:
+			checkValue(additional, value, join(path, name), problems)
+		}
+	}
+}
+
+// usage summarizes the top-level parameters of a schema, such as
+// "file_path (string, required), start_line (integer)"
+func usage(schema map[string]interface{}) string {
+	properties, _ := schema["properties"].(map[string]interface{})
+	if len(properties) == 0 {
+		return "none"
+	}
+	required := stringList(schema["required"])
+	names := make([]string, 0, len(properties))
+	for name := range properties {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		// Required parameters first
+		ri, rj := contains(required, names[i]), contains(required, names[j])
+		if ri != rj {
+			return ri
+		}
+		return names[i] < names[j]
+	})
+
+	parts := make([]string, len(names))
+	for i, name := range names {
+		property, _ := properties[name].(map[string]interface{})
+		kind, _ := property["type"].(string)
+		if enum := stringList(property["enum"]); enum != nil {
+			kind = "one of " + strings.Join(enum, "|")
+		}
+		if kind == "" {
+			kind = "any"
+		}
+		if contains(required, name) {
+			kind += ", required"
+		}
+		parts[i] = fmt.Sprintf("%s (%s)", name, kind)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// stringList returns a schema list of strings, which tools build as either
+// []string or []interface{}
+func stringList(value interface{}) []string {
+	switch v := value.(type) {
+	case []string:
+		return v
+	case []interface{}:
+		result := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				result = append(result, s)
+			}
+		}
+		return result
+	}
+	return nil
+}
@@ -8,13 +8,21 @@ import (
 	"strings"
 )
 
+type writeFileArgs struct {
+	FilePath   string `json:"file_path" description:"Path to the file to write (relative or absolute)"`
+	Content    string `json:"content" description:"Content to write to the file"`
+	CreateDirs bool   `json:"create_dirs,omitempty" default:"true" description:"Create parent directories if they don't exist (default: true)"`
+}
+
 type WriteFileTool struct {
 	workDir string
+	roots   []string // other directories it may use, see resolvePath
 }
 
-func NewWriteFileTool(workDir string) *WriteFileTool {
+func NewWriteFileTool(workDir string, roots ...string) *WriteFileTool {
 	return &WriteFileTool{
 		workDir: workDir,
+		roots:   roots,
 	}
 }
 
@@ -33,54 +41,43 @@ Usage:
 Use this to create new files or modify existing ones. Always read the file first before modifying to avoid conflicts.`
 }
 
-func (t *WriteFileTool) Parameters() map[string]interface{} {
-	return map[string]interface{}{
-		"type": "object",
-		"properties": map[string]interface{}{
-			"file_path": map[string]interface{}{
-				"type":        "string",
-				"description": "Path to the file to write (relative or absolute)",
-			},
-			"content": map[string]interface{}{
-				"type":        "string",
-				"description": "Content to write to the file",
-			},
-			"create_dirs": map[string]interface{}{
-				"type":        "boolean",
-				"description": "Create parent directories if they don't exist (default: true)",
-			},
-		},
-		"required": []string{"file_path", "content"},
-	}
+func (t *WriteFileTool) Risk() Risk {
+	return RiskWrite
 }
 
-func (t *WriteFileTool) Execute(ctx context.Context, args map[string]interface{}) (string, error) {
-	filePath := GetStringArg(args, "file_path", "")
+// Preview returns the diff writing the file would make
+func (t *WriteFileTool) Preview(ctx context.Context, args writeFileArgs) (string, error) {
+	filePath := args.FilePath
 	if filePath == "" {
 		return "", fmt.Errorf("file_path is required")
 	}
-
-	content := GetStringArg(args, "content", "")
-	createDirs := GetBoolArg(args, "create_dirs", true)
-
-	// Resolve path
-	if !filepath.IsAbs(filePath) {
-		filePath = filepath.Join(t.workDir, filePath)
-	}
-
-	// Security check: ensure path is within work directory
-	absPath, err := filepath.Abs(filePath)
+	absPath, err := resolvePath(t.workDir, filePath, t.roots...)
 	if err != nil {
-		return "", fmt.Errorf("failed to resolve path: %w", err)
+		return "", err
+	}
+	displayPath := filePath
+	if rel, err := filepath.Rel(t.workDir, absPath); err == nil {
+		displayPath = filepath.ToSlash(rel)
 	}
+	var oldContent string
+	if data, err := os.ReadFile(absPath); err == nil {
+		oldContent = string(data)
+	}
+	return unifiedDiff(displayPath, oldContent, args.Content, 3), nil
+}
 
-	absWorkDir, err := filepath.Abs(t.workDir)
-	if err != nil {
-		return "", fmt.Errorf("failed to resolve work directory: %w", err)
+func (t *WriteFileTool) Run(ctx context.Context, args writeFileArgs) (string, error) {
+	filePath := args.FilePath
+	if filePath == "" {
+		return "", fmt.Errorf("file_path is required")
 	}
 
-	if !strings.HasPrefix(absPath, absWorkDir) {
-		return "", fmt.Errorf("access denied: path is outside working directory")
+	content := args.Content
+	createDirs := args.CreateDirs
+
+	absPath, err := resolvePath(t.workDir, filePath, t.roots...)
+	if err != nil {
+		return "", err
 	}
 
 	// Check if it's a directory
@@ -109,6 +106,7 @@ func (t *WriteFileTool) Execute(ctx context.Context, args map[string]interface{}
 	if err := os.WriteFile(absPath, []byte(content), 0644); err != nil {
 		return "", fmt.Errorf("failed to write file: %w", err)
 	}
+	recordChange(ctx, absPath)
 
 	// Generate response
 	var response strings.Builder
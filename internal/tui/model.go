@@ -0,0 +1,624 @@
+package tui
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/textarea"
+	"github.com/charmbracelet/bubbles/viewport"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/omnitrix-sh/core.sh/internal/agent"
+	"github.com/omnitrix-sh/core.sh/internal/events"
+	"github.com/omnitrix-sh/core.sh/internal/permissions"
+	"github.com/omnitrix-sh/core.sh/pkg/models"
+)
+
+const (
+	// historyLimit is how many earlier messages are shown when a session
+	// is opened
+	historyLimit = 200
+	// sessionLimit is how many sessions the switcher lists
+	sessionLimit = 100
+	// eventBuffer is how many events the TUI can fall behind before it
+	// misses some
+	eventBuffer = 1024
+	// inputHeight is the number of lines of the message input
+	inputHeight = 3
+)
+
+// mode is what the TUI is showing
+type mode int
+
+const (
+	modeChat mode = iota
+	modeSessions
+)
+
+// entryKind is what an entry of the transcript shows
+type entryKind int
+
+const (
+	entryUser entryKind = iota
+	entryAssistant
+	entryTool
+	entryNote
+	entryError
+)
+
+// entry is one block of the transcript
+type entry struct {
+	kind entryKind
+	text string
+}
+
+// Messages sent to the model
+type (
+	// eventMsg is an event of the session with subscription gen
+	eventMsg struct {
+		gen   int
+		event events.Event
+	}
+	// eventsClosedMsg means the subscription gen ended
+	eventsClosedMsg struct{ gen int }
+	// historyMsg carries the earlier messages of a session being opened
+	historyMsg struct {
+		session  *models.Session
+		mode     agent.Mode
+		messages []models.Message
+		err      error
+	}
+	// sessionsMsg carries the sessions for the switcher
+	sessionsMsg struct {
+		sessions []models.Session
+		err      error
+	}
+	// runDoneMsg means the run started by send ended
+	runDoneMsg struct{ err error }
+)
+
+type model struct {
+	ctx context.Context
+	app *App
+
+	width, height int
+	viewport      viewport.Model
+	input         textarea.Model
+	mode          mode
+	stream        bool
+
+	session     *models.Session
+	sessionMode agent.Mode // plan or build, see agent.Mode
+	transcript  []entry
+	partial     strings.Builder // the reply streaming in
+	status      string
+	err         string
+
+	loading bool // the history of the session is being loaded
+	running bool
+	cancel  context.CancelFunc // cancels the run
+
+	gen        int // counts subscriptions, so events of old ones are dropped
+	events     <-chan events.Event
+	stopEvents func()
+
+	// approvals are the permission requests waiting for an answer, oldest
+	// first; the first is shown
+	approvals []permissions.Request
+	// questions are the model's questions waiting for an answer, oldest
+	// first; the first is shown and answered from the input
+	questions []permissions.Question
+
+	sessions []models.Session
+	cursor   int
+}
+
+func newModel(ctx context.Context, app *App, session *models.Session) *model {
+	input := textarea.New()
+	input.Placeholder = "Ask anything (Enter to send, Alt+Enter for a new line)"
+	input.ShowLineNumbers = false
+	input.Prompt = "> "
+	input.SetHeight(inputHeight)
+	input.KeyMap.InsertNewline = key.NewBinding(key.WithKeys("alt+enter", "ctrl+j"))
+	input.Focus()
+
+	m := &model{
+		ctx:      ctx,
+		app:      app,
+		viewport: viewport.New(80, 20),
+		input:    input,
+		stream:   app.opts.Stream,
+		session:  session,
+		loading:  true,
+	}
+	m.subscribe()
+	return m
+}
+
+func (m *model) Init() tea.Cmd {
+	return tea.Batch(textarea.Blink, m.loadHistory(m.session), m.waitForEvent())
+}
+
+// close ends the run and the subscription
+func (m *model) close() {
+	if m.cancel != nil {
+		m.cancel()
+	}
+	if m.stopEvents != nil {
+		m.stopEvents()
+	}
+}
+
+func (m *model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.width, m.height = msg.Width, msg.Height
+		m.layout()
+		return m, nil
+
+	case tea.KeyMsg:
+		return m.handleKey(msg)
+
+	case eventMsg:
+		if msg.gen != m.gen {
+			return m, nil
+		}
+		m.handleEvent(msg.event)
+		m.refresh()
+		return m, m.waitForEvent()
+
+	case eventsClosedMsg:
+		return m, nil
+
+	case historyMsg:
+		if msg.err != nil {
+			m.loading = false
+			m.err = msg.err.Error()
+			return m, nil
+		}
+		if msg.session.ID != m.session.ID {
+			return m, nil // the user switched again meanwhile
+		}
+		m.loading = false
+		m.session = msg.session
+		m.sessionMode = msg.mode
+		m.transcript = transcriptOf(msg.messages)
+		m.refresh()
+		return m, nil
+
+	case sessionsMsg:
+		if msg.err != nil {
+			m.err = msg.err.Error()
+			m.mode = modeChat
+			return m, nil
+		}
+		m.sessions = msg.sessions
+		m.cursor = 0
+		for i, session := range m.sessions {
+			if session.ID == m.session.ID {
+				m.cursor = i
+			}
+		}
+		return m, nil
+
+	case runDoneMsg:
+		m.running = false
+		m.cancel = nil
+		m.approvals = nil
+		m.questions = nil
+		m.status = ""
+		m.flushPartial()
+		if msg.err != nil && !strings.Contains(msg.err.Error(), context.Canceled.Error()) {
+			m.transcript = append(m.transcript, entry{entryError, msg.err.Error()})
+		}
+		m.refresh()
+		return m, nil
+	}
+
+	var cmd tea.Cmd
+	m.input, cmd = m.input.Update(msg)
+	return m, cmd
+}
+
+func (m *model) handleKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	if msg.String() == "ctrl+c" {
+		if m.running {
+			m.cancel()
+			return m, nil
+		}
+		return m, tea.Quit
+	}
+
+	if m.mode == modeSessions {
+		return m.handleSessionKey(msg)
+	}
+
+	if len(m.approvals) > 0 {
+		switch msg.String() {
+		case "y", "Y":
+			m.answer(true)
+		case "n", "N", "esc":
+			m.answer(false)
+		case "pgup", "pgdown", "up", "down":
+			var cmd tea.Cmd
+			m.viewport, cmd = m.viewport.Update(msg)
+			return m, cmd
+		}
+		return m, nil
+	}
+
+	if len(m.questions) > 0 {
+		switch msg.String() {
+		case "enter":
+			if text := strings.TrimSpace(m.input.Value()); text != "" {
+				m.input.Reset()
+				m.reply(text)
+			}
+			return m, nil
+		case "esc":
+			m.reply("")
+			return m, nil
+		case "pgup", "pgdown":
+			var cmd tea.Cmd
+			m.viewport, cmd = m.viewport.Update(msg)
+			return m, cmd
+		}
+		var cmd tea.Cmd
+		m.input, cmd = m.input.Update(msg)
+		return m, cmd
+	}
+
+	switch msg.String() {
+	case "esc":
+		if m.running {
+			m.cancel()
+		}
+		return m, nil
+	case "ctrl+s":
+		if m.running {
+			return m, nil
+		}
+		m.mode = modeSessions
+		return m, m.loadSessions()
+	case "ctrl+n":
+		if m.running {
+			return m, nil
+		}
+		return m, m.newSession()
+	case "ctrl+t":
+		m.stream = !m.stream
+		return m, nil
+	case "ctrl+p":
+		if m.running || m.loading {
+			return m, nil
+		}
+		m.switchMode()
+		return m, nil
+	case "ctrl+r":
+		if m.running || m.loading {
+			return m, nil
+		}
+		return m, m.regenerate()
+	case "pgup", "pgdown":
+		var cmd tea.Cmd
+		m.viewport, cmd = m.viewport.Update(msg)
+		return m, cmd
+	case "enter":
+		text := strings.TrimSpace(m.input.Value())
+		if text == "" || m.loading {
+			return m, nil
+		}
+		if m.running {
+			m.enqueue(text)
+			return m, nil
+		}
+		m.input.Reset()
+		m.err = ""
+		return m, m.send(text)
+	}
+
+	var cmd tea.Cmd
+	m.input, cmd = m.input.Update(msg)
+	return m, cmd
+}
+
+func (m *model) handleSessionKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "esc", "ctrl+s":
+		m.mode = modeChat
+	case "up", "k":
+		if m.cursor > 0 {
+			m.cursor--
+		}
+	case "down", "j":
+		if m.cursor < len(m.sessions)-1 {
+			m.cursor++
+		}
+	case "n", "ctrl+n":
+		m.mode = modeChat
+		return m, m.newSession()
+	case "enter":
+		m.mode = modeChat
+		if m.cursor < len(m.sessions) {
+			return m, m.open(&m.sessions[m.cursor])
+		}
+	}
+	return m, nil
+}
+
+// handleEvent adds what an event reports to the transcript
+func (m *model) handleEvent(e events.Event) {
+	switch e.Type {
+	case events.TypeStatus:
+		if e.Status.State == events.StateDone {
+			m.status = ""
+		} else {
+			m.status = e.Status.Message
+		}
+
+	case events.TypeDelta:
+		if e.Delta.Kind == models.ChunkContent {
+			m.partial.WriteString(e.Delta.Text)
+		}
+
+	case events.TypeMessage:
+		switch e.Message.Role {
+		case models.RoleUser:
+			m.transcript = append(m.transcript, entry{entryUser, e.Message.Content})
+		case models.RoleAssistant:
+			m.partial.Reset()
+			if strings.TrimSpace(e.Message.Content) != "" {
+				m.transcript = append(m.transcript, entry{entryAssistant, e.Message.Content})
+			}
+		case models.RoleEvent:
+			m.transcript = append(m.transcript, entry{entryNote, e.Message.Content})
+		}
+
+	case events.TypeToolStarted:
+		m.flushPartial()
+		m.transcript = append(m.transcript, entry{entryTool, toolStarted(e.Tool)})
+
+	case events.TypeToolFinished:
+		m.transcript = append(m.transcript, entry{entryTool, toolFinished(e.Tool)})
+
+	case events.TypeToolOutput:
+		// The latest line shows the tool is getting somewhere; the whole
+		// output is in its result
+		if line := lastLine(e.Tool.Output); line != "" {
+			m.status = e.Tool.Name + ": " + line
+		}
+
+	case events.TypePermission:
+		m.approvals = append(m.approvals, *e.Permission)
+
+	case events.TypeQuestion:
+		m.questions = append(m.questions, *e.Question)
+
+	case events.TypeError:
+		m.err = e.Error.Message
+
+	case events.TypeConfigChanged:
+		m.transcript = append(m.transcript, entry{entryNote, configChanged(e.Config)})
+	}
+}
+
+// configChanged describes a reload of the config
+func configChanged(change *events.ConfigChange) string {
+	if change.Error != "" {
+		return "Config not reloaded: " + change.Error
+	}
+	note := "Config reloaded"
+	if len(change.Applied) > 0 {
+		note += ", applied " + strings.Join(change.Applied, ", ")
+	}
+	if len(change.Restart) > 0 {
+		note += "; restart to apply " + strings.Join(change.Restart, ", ")
+	}
+	return note
+}
+
+// flushPartial keeps a reply that stopped streaming before it was saved,
+// such as one cancelled halfway
+func (m *model) flushPartial() {
+	if text := strings.TrimSpace(m.partial.String()); text != "" {
+		m.transcript = append(m.transcript, entry{entryAssistant, text})
+	}
+	m.partial.Reset()
+}
+
+// answer decides the permission request shown
+func (m *model) answer(approved bool) {
+	req := m.approvals[0]
+	m.approvals = m.approvals[1:]
+	m.app.approvals.Answer(req.ID, approved)
+	verdict := "Declined"
+	if approved {
+		verdict = "Approved"
+	}
+	m.transcript = append(m.transcript, entry{entryNote, verdict + " " + req.Tool})
+	m.refresh()
+}
+
+// reply answers the question shown, where the number of an option stands
+// for the option; an empty answer skips it
+func (m *model) reply(text string) {
+	q := m.questions[0]
+	m.questions = m.questions[1:]
+	if n, err := strconv.Atoi(text); err == nil && n >= 1 && n <= len(q.Options) {
+		text = q.Options[n-1]
+	}
+	m.app.approvals.AnswerQuestion(q.ID, text)
+	if text == "" {
+		m.transcript = append(m.transcript, entry{entryNote, "Skipped the question: " + q.Question})
+	} else {
+		m.transcript = append(m.transcript, entry{entryNote, q.Question + "\n" + text})
+	}
+	m.refresh()
+}
+
+// switchMode toggles the session between plan and build mode
+func (m *model) switchMode() {
+	next, note := agent.ModePlan, "Plan mode: the model reads the project and proposes a plan; tools that change files or run commands are off."
+	if m.sessionMode == agent.ModePlan {
+		next, note = agent.ModeBuild, "Build mode: every tool is available."
+	}
+	if err := m.app.agent.SetSessionMode(m.ctx, m.session.ID, next); err != nil {
+		m.err = err.Error()
+		return
+	}
+	m.sessionMode = next
+	m.transcript = append(m.transcript, entry{entryNote, note})
+	m.refresh()
+}
+
+// enqueue adds text to the run in progress, which sends it once its
+// current tool calls are done
+func (m *model) enqueue(text string) {
+	if !m.app.agent.Enqueue(m.session.ID, text) {
+		m.err = "a streamed reply takes no queued messages; send it once the reply is done"
+		return
+	}
+	m.input.Reset()
+	m.err = ""
+	m.transcript = append(m.transcript, entry{entryNote, "Queued until the current tool calls are done"})
+	m.refresh()
+}
+
+// regenerate replaces the reply to the last message with a new one. The
+// message is shown again when the run saves it anew.
+func (m *model) regenerate() tea.Cmd {
+	last := -1
+	for i, e := range m.transcript {
+		if e.kind == entryUser {
+			last = i
+		}
+	}
+	if last < 0 {
+		return nil
+	}
+	m.transcript = m.transcript[:last]
+	m.err = ""
+	m.refresh()
+
+	ctx, cancel := context.WithCancel(m.ctx)
+	m.running = true
+	m.cancel = cancel
+	a, sessionID := m.app.agent, m.session.ID
+	return func() tea.Msg {
+		defer cancel()
+		_, err := a.Regenerate(ctx, sessionID, "")
+		return runDoneMsg{err: err}
+	}
+}
+
+// send runs a turn with text
+func (m *model) send(text string) tea.Cmd {
+	ctx, cancel := context.WithCancel(m.ctx)
+	m.running = true
+	m.cancel = cancel
+	a, sessionID, stream := m.app.agent, m.session.ID, m.stream
+	return func() tea.Msg {
+		defer cancel()
+		if !stream {
+			_, err := a.Chat(ctx, sessionID, text)
+			return runDoneMsg{err: err}
+		}
+		// The reply arrives as delta events; the channel only says when
+		// it is complete
+		chunks, err := a.Stream(ctx, sessionID, text)
+		if err != nil {
+			return runDoneMsg{err: err}
+		}
+		for range chunks {
+		}
+		return runDoneMsg{err: ctx.Err()}
+	}
+}
+
+// open switches to a session
+func (m *model) open(session *models.Session) tea.Cmd {
+	m.session = session
+	m.transcript = nil
+	m.partial.Reset()
+	m.approvals = nil
+	m.questions = nil
+	m.err = ""
+	m.loading = true
+	m.subscribe()
+	m.refresh()
+	return tea.Batch(m.loadHistory(session), m.waitForEvent())
+}
+
+func (m *model) newSession() tea.Cmd {
+	session, err := m.app.agent.CreateSession(m.ctx, "")
+	if err != nil {
+		m.err = err.Error()
+		return nil
+	}
+	return m.open(session)
+}
+
+// subscribe follows the events of the current session from now on
+func (m *model) subscribe() {
+	if m.stopEvents != nil {
+		m.stopEvents()
+	}
+	m.gen++
+	m.events, m.stopEvents = m.app.bus.Subscribe(m.session.ID, eventBuffer)
+}
+
+func (m *model) waitForEvent() tea.Cmd {
+	gen, ch := m.gen, m.events
+	return func() tea.Msg {
+		e, ok := <-ch
+		if !ok {
+			return eventsClosedMsg{gen}
+		}
+		return eventMsg{gen, e}
+	}
+}
+
+func (m *model) loadHistory(session *models.Session) tea.Cmd {
+	a, ctx := m.app.agent, m.ctx
+	return func() tea.Msg {
+		page, err := a.Messages(ctx, session.ID, "", historyLimit)
+		if err != nil {
+			return historyMsg{err: err}
+		}
+		mode, err := a.SessionMode(ctx, session.ID)
+		if err != nil {
+			return historyMsg{err: err}
+		}
+		return historyMsg{session: session, mode: mode, messages: page.Messages}
+	}
+}
+
+func (m *model) loadSessions() tea.Cmd {
+	a, ctx := m.app.agent, m.ctx
+	return func() tea.Msg {
+		sessions, err := a.ListSessions(ctx, sessionLimit, 0)
+		return sessionsMsg{sessions, err}
+	}
+}
+
+// transcriptOf shows stored messages the way their events are shown
+func transcriptOf(messages []models.Message) []entry {
+	var transcript []entry
+	for _, msg := range messages {
+		switch msg.Role {
+		case models.RoleUser:
+			transcript = append(transcript, entry{entryUser, msg.Content})
+		case models.RoleAssistant:
+			if strings.TrimSpace(msg.Content) != "" {
+				transcript = append(transcript, entry{entryAssistant, msg.Content})
+			}
+			for _, call := range msg.ToolCalls {
+				transcript = append(transcript, entry{entryTool, toolStarted(&events.Tool{Name: call.Function.Name, Arguments: call.Function.Arguments})})
+			}
+		case models.RoleEvent:
+			transcript = append(transcript, entry{entryNote, msg.Content})
+		}
+	}
+	return transcript
+}
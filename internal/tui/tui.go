@@ -0,0 +1,81 @@
+// Package tui is a terminal frontend for the agent, built with Bubble Tea
+// on the event bus: a chat view that follows runs as they happen, with
+// streamed replies, tool runs and approval prompts showing a diff of the
+// files a tool would change, and a switcher between sessions.
+package tui
+
+import (
+	"context"
+	"fmt"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/omnitrix-sh/core.sh/internal/agent"
+	"github.com/omnitrix-sh/core.sh/internal/events"
+	"github.com/omnitrix-sh/core.sh/internal/permissions"
+	"github.com/omnitrix-sh/core.sh/pkg/models"
+)
+
+// Options configure the TUI
+type Options struct {
+	// Stream shows replies as they arrive. Tools only run without it; it
+	// can be switched while the TUI runs.
+	Stream bool
+}
+
+// App runs the TUI for an agent. The agent must publish on the same bus,
+// and should ask Approver for approvals.
+type App struct {
+	agent     *agent.Agent
+	bus       *events.Bus
+	opts      Options
+	approvals *permissions.Pending
+}
+
+// New creates a TUI for the agent
+func New(a *agent.Agent, bus *events.Bus, opts Options) *App {
+	return &App{
+		agent:     a,
+		bus:       bus,
+		opts:      opts,
+		approvals: permissions.NewPending(0),
+	}
+}
+
+// Approver returns the approver to give the agent, see
+// agent.SetPermissions. Requests are answered in the TUI.
+func (app *App) Approver() permissions.Approver {
+	return app.approvals
+}
+
+// Run shows the TUI until the user quits or ctx is done. It opens the
+// session with ID sessionID, or the most recent session if sessionID is
+// "", or a new one if there are none.
+func (app *App) Run(ctx context.Context, sessionID string) error {
+	session, err := app.initialSession(ctx, sessionID)
+	if err != nil {
+		return err
+	}
+	style = newStyles()
+	m := newModel(ctx, app, session)
+	defer m.close()
+
+	p := tea.NewProgram(m, tea.WithAltScreen(), tea.WithContext(ctx))
+	if _, err := p.Run(); err != nil && ctx.Err() == nil {
+		return fmt.Errorf("failed to run the terminal UI: %w", err)
+	}
+	return nil
+}
+
+func (app *App) initialSession(ctx context.Context, sessionID string) (*models.Session, error) {
+	if sessionID != "" {
+		return app.agent.Session(ctx, sessionID)
+	}
+	sessions, err := app.agent.ListSessions(ctx, 1, 0)
+	if err != nil {
+		return nil, err
+	}
+	if len(sessions) > 0 {
+		return &sessions[0], nil
+	}
+	return app.agent.CreateSession(ctx, "")
+}
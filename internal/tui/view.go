@@ -0,0 +1,295 @@
+package tui
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/omnitrix-sh/core.sh/internal/display"
+	"github.com/omnitrix-sh/core.sh/internal/events"
+	"github.com/omnitrix-sh/core.sh/internal/permissions"
+)
+
+const (
+	// maxArgLength is how much of a tool argument is shown
+	maxArgLength = 60
+	// maxPreviewLines bounds the diff shown in an approval prompt
+	maxPreviewLines = 200
+)
+
+// styles are the looks of the TUI. In plain mode they are all empty, for
+// screen readers and terminals without colors.
+type styles struct {
+	header, user, assistant, tool, note, error, status, help lipgloss.Style
+	approval, added, removed, hunk, selected                 lipgloss.Style
+}
+
+func newStyles() styles {
+	if display.Plain() {
+		return styles{}
+	}
+	return styles{
+		header:    lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("12")),
+		user:      lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("14")),
+		assistant: lipgloss.NewStyle(),
+		tool:      lipgloss.NewStyle().Foreground(lipgloss.Color("8")),
+		note:      lipgloss.NewStyle().Italic(true).Foreground(lipgloss.Color("8")),
+		error:     lipgloss.NewStyle().Foreground(lipgloss.Color("9")),
+		status:    lipgloss.NewStyle().Foreground(lipgloss.Color("11")),
+		help:      lipgloss.NewStyle().Foreground(lipgloss.Color("8")),
+		approval:  lipgloss.NewStyle().Border(lipgloss.RoundedBorder()).BorderForeground(lipgloss.Color("11")).Padding(0, 1),
+		added:     lipgloss.NewStyle().Foreground(lipgloss.Color("10")),
+		removed:   lipgloss.NewStyle().Foreground(lipgloss.Color("9")),
+		hunk:      lipgloss.NewStyle().Foreground(lipgloss.Color("13")),
+		selected:  lipgloss.NewStyle().Reverse(true),
+	}
+}
+
+// style is set when the TUI starts, once the display settings are known
+var style styles
+
+// layout sizes the viewport and input to the window
+func (m *model) layout() {
+	m.input.SetWidth(m.width)
+	// header, status and help take a line each
+	m.viewport.Width = m.width
+	m.viewport.Height = max(m.height-inputHeight-3, 1)
+	m.refresh()
+}
+
+// refresh renders the transcript into the viewport, following the end
+func (m *model) refresh() {
+	m.viewport.SetContent(m.renderTranscript())
+	m.viewport.GotoBottom()
+}
+
+func (m *model) View() string {
+	if m.width == 0 {
+		return ""
+	}
+	if m.mode == modeSessions {
+		return m.renderSessions()
+	}
+
+	var b strings.Builder
+	b.WriteString(m.renderHeader())
+	b.WriteString("\n")
+	b.WriteString(m.viewport.View())
+	b.WriteString("\n")
+	b.WriteString(m.renderStatus())
+	b.WriteString("\n")
+	b.WriteString(m.input.View())
+	b.WriteString("\n")
+	b.WriteString(style.help.Render(m.help()))
+	return b.String()
+}
+
+func (m *model) renderHeader() string {
+	mode := "tools"
+	if m.stream {
+		mode = "streaming"
+	}
+	return style.header.Render(fmt.Sprintf("Omnitrix · %s · %s · %s · %s", m.session.Title, m.session.Model, m.sessionMode, mode))
+}
+
+func (m *model) renderStatus() string {
+	switch {
+	case m.err != "":
+		return style.error.Render(truncate("Error: "+m.err, m.width))
+	case m.status != "":
+		return style.status.Render(truncate(m.status, m.width))
+	case m.running:
+		return style.status.Render("Working...")
+	}
+	return ""
+}
+
+func (m *model) help() string {
+	switch {
+	case len(m.approvals) > 0:
+		return "y approve · n decline · PgUp/PgDn scroll"
+	case len(m.questions) > 0:
+		return "Enter answer · Esc skip · PgUp/PgDn scroll"
+	case m.running:
+		return "Enter queue · Esc cancel · PgUp/PgDn scroll"
+	}
+	return "Enter send · Ctrl+S sessions · Ctrl+N new session · Ctrl+P plan/build · Ctrl+R regenerate · Ctrl+T streaming/tools · Ctrl+C quit"
+}
+
+func (m *model) renderTranscript() string {
+	width := max(m.width, 20)
+	wrap := lipgloss.NewStyle().Width(width)
+
+	var blocks []string
+	for _, e := range m.transcript {
+		blocks = append(blocks, renderEntry(e, wrap))
+	}
+	if text := m.partial.String(); text != "" {
+		blocks = append(blocks, renderEntry(entry{entryAssistant, text}, wrap))
+	}
+	if len(m.approvals) > 0 {
+		blocks = append(blocks, renderApproval(m.approvals[0], width))
+	} else if len(m.questions) > 0 {
+		blocks = append(blocks, renderQuestion(m.questions[0], width))
+	}
+	return strings.Join(blocks, "\n\n")
+}
+
+func renderEntry(e entry, wrap lipgloss.Style) string {
+	switch e.kind {
+	case entryUser:
+		return style.user.Render("You") + "\n" + wrap.Render(e.text)
+	case entryAssistant:
+		return style.header.Render("Omnitrix") + "\n" + style.assistant.Render(wrap.Render(e.text))
+	case entryTool:
+		return style.tool.Render(wrap.Render(e.text))
+	case entryError:
+		return style.error.Render(wrap.Render("Error: " + e.text))
+	}
+	return style.note.Render(wrap.Render(e.text))
+}
+
+// renderApproval shows a permission request with what the tool would
+// change
+func renderApproval(req permissions.Request, width int) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Allow %s (%s)?", req.Tool, req.Risk)
+	for _, path := range req.Paths {
+		fmt.Fprintf(&b, "\n  %s", path)
+	}
+	if command, ok := req.Args["command"].(string); ok {
+		fmt.Fprintf(&b, "\n  $ %s", command)
+	}
+	if req.Preview != "" {
+		b.WriteString("\n\n")
+		b.WriteString(renderDiff(req.Preview))
+	}
+	b.WriteString("\n\n[y] approve   [n] decline")
+	return style.approval.Width(max(width-2, 10)).Render(b.String())
+}
+
+func renderQuestion(q permissions.Question, width int) string {
+	var b strings.Builder
+	b.WriteString(q.Question)
+	for i, option := range q.Options {
+		fmt.Fprintf(&b, "\n  %d. %s", i+1, option)
+	}
+	b.WriteString("\n\nType your answer and press Enter, or Esc to skip")
+	return style.approval.Width(max(width-2, 10)).Render(b.String())
+}
+
+// renderDiff colors a unified diff, cutting it short when it is long
+func renderDiff(diff string) string {
+	lines := strings.Split(strings.TrimRight(diff, "\n"), "\n")
+	var omitted int
+	if len(lines) > maxPreviewLines {
+		omitted = len(lines) - maxPreviewLines
+		lines = lines[:maxPreviewLines]
+	}
+	for i, line := range lines {
+		switch {
+		case strings.HasPrefix(line, "+++"), strings.HasPrefix(line, "---"):
+		case strings.HasPrefix(line, "+"):
+			lines[i] = style.added.Render(line)
+		case strings.HasPrefix(line, "-"):
+			lines[i] = style.removed.Render(line)
+		case strings.HasPrefix(line, "@@"):
+			lines[i] = style.hunk.Render(line)
+		}
+	}
+	if omitted > 0 {
+		lines = append(lines, fmt.Sprintf("... %d more lines", omitted))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (m *model) renderSessions() string {
+	var b strings.Builder
+	b.WriteString(style.header.Render("Sessions"))
+	b.WriteString("\n\n")
+	if len(m.sessions) == 0 {
+		b.WriteString("Loading...")
+	}
+	// Keep the cursor in view
+	visible := max(m.height-4, 1)
+	start := 0
+	if m.cursor >= visible {
+		start = m.cursor - visible + 1
+	}
+	for i := start; i < len(m.sessions) && i < start+visible; i++ {
+		session := m.sessions[i]
+		line := truncate(fmt.Sprintf("%-40s %4d messages  %s", truncate(session.Title, 40), session.MessageCount, display.Time(session.UpdatedAt)), m.width)
+		if i == m.cursor {
+			if display.Plain() {
+				line = "> " + line
+			} else {
+				line = style.selected.Render(line)
+			}
+		} else if display.Plain() {
+			line = "  " + line
+		}
+		b.WriteString(line)
+		b.WriteString("\n")
+	}
+	b.WriteString("\n")
+	b.WriteString(style.help.Render("↑/↓ choose · Enter open · n new session · Esc back"))
+	return b.String()
+}
+
+// toolStarted describes a tool run that started
+func toolStarted(tool *events.Tool) string {
+	return fmt.Sprintf("▸ %s %s", tool.Name, summarizeArgs(tool.Arguments))
+}
+
+// toolFinished describes a tool run that finished
+func toolFinished(tool *events.Tool) string {
+	duration := display.Duration(time.Duration(tool.DurationMS) * time.Millisecond)
+	if tool.Error != "" {
+		return fmt.Sprintf("✗ %s failed after %s: %s", tool.Name, duration, firstLine(tool.Error))
+	}
+	return fmt.Sprintf("✓ %s (%s)", tool.Name, duration)
+}
+
+// summarizeArgs shows a tool's arguments on one line
+func summarizeArgs(args map[string]interface{}) string {
+	names := make([]string, 0, len(args))
+	for name := range args {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	parts := make([]string, 0, len(names))
+	for _, name := range names {
+		value := firstLine(fmt.Sprint(args[name]))
+		parts = append(parts, fmt.Sprintf("%s=%s", name, truncate(value, maxArgLength)))
+	}
+	return strings.Join(parts, " ")
+}
+
+func firstLine(s string) string {
+	if i := strings.IndexByte(s, '\n'); i >= 0 {
+		return s[:i] + "..."
+	}
+	return s
+}
+
+// lastLine returns the last line of s that isn't blank
+func lastLine(s string) string {
+	lines := strings.Split(s, "\n")
+	for i := len(lines) - 1; i >= 0; i-- {
+		if line := strings.TrimSpace(lines[i]); line != "" {
+			return line
+		}
+	}
+	return ""
+}
+
+// truncate shortens s to width characters
+func truncate(s string, width int) string {
+	runes := []rune(s)
+	if width <= 3 || len(runes) <= width {
+		return s
+	}
+	return string(runes[:width-3]) + "..."
+}
@@ -0,0 +1,325 @@
+// Package update finds out whether a newer release is out and replaces the
+// running binary with it. Release binaries are signed, and one whose
+// signature doesn't verify is never installed.
+package update
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/omnitrix-sh/core.sh/internal/version"
+	"github.com/omnitrix-sh/core.sh/pkg/models"
+)
+
+const (
+	defaultRepository = "omnitrix-sh/core.sh"
+	defaultInterval   = 24 * time.Hour
+	apiBase           = "https://api.github.com"
+	// maxBinarySize bounds downloads, far above any real release
+	maxBinarySize = 200 << 20
+	// stateFile remembers when releases were last checked
+	stateFile = "update.json"
+)
+
+// PublicKey is the base64 ed25519 key release binaries are signed with,
+// over the release version, a newline and the binary. It is set by release
+// builds with
+//
+//	-ldflags "-X github.com/omnitrix-sh/core.sh/internal/update.PublicKey=..."
+//
+// and can be replaced with UpdateConfig.PublicKey, which only the user
+// config can set. Without a key nothing can be installed.
+var PublicKey = ""
+
+var (
+	// ErrNoAsset is returned for releases without a binary for this platform
+	ErrNoAsset = errors.New("release has no binary for this platform")
+	// ErrNotNewer is returned for releases not newer than the running
+	// build, so an old signed release can never replace a newer one
+	ErrNotNewer = errors.New("release is not newer than the running version")
+)
+
+// Release is a published version
+type Release struct {
+	Version     string    `json:"version"`
+	URL         string    `json:"url"` // the release page
+	Notes       string    `json:"notes,omitempty"`
+	PublishedAt time.Time `json:"published_at"`
+
+	assets map[string]string // file name -> download URL
+}
+
+// Status compares the running build with the latest release
+type Status struct {
+	Current   string    `json:"current"`
+	Latest    *Release  `json:"latest"`
+	Available bool      `json:"available"` // Latest is newer than Current
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+// Updater checks one repository's releases
+type Updater struct {
+	cfg     models.UpdateConfig
+	dataDir string
+	client  *http.Client
+	apiBase string
+}
+
+// New creates an updater. Checks only happen on request or, with
+// cfg.Check, through CheckIfDue.
+func New(cfg models.UpdateConfig, dataDir string) *Updater {
+	if cfg.Repository == "" {
+		cfg.Repository = defaultRepository
+	}
+	return &Updater{
+		cfg:     cfg,
+		dataDir: dataDir,
+		client:  &http.Client{Timeout: 5 * time.Minute},
+		apiBase: apiBase,
+	}
+}
+
+// Check fetches the latest release and compares it with the running build
+func (u *Updater) Check(ctx context.Context) (*Status, error) {
+	release, err := u.latest(ctx)
+	if err != nil {
+		return nil, err
+	}
+	status := &Status{
+		Current:   version.Get().Version,
+		Latest:    release,
+		CheckedAt: time.Now(),
+	}
+	status.Available = version.Compare(status.Current, release.Version) < 0
+	u.saveState(state{CheckedAt: status.CheckedAt, Latest: release.Version})
+	return status, nil
+}
+
+// CheckIfDue runs Check when checks are turned on and the last one is older
+// than the configured interval. Otherwise it returns nil, as it does for
+// builds that aren't releases and can't be compared.
+func (u *Updater) CheckIfDue(ctx context.Context) (*Status, error) {
+	if !u.cfg.Check || !version.Get().Release() {
+		return nil, nil
+	}
+	interval := time.Duration(u.cfg.IntervalHours) * time.Hour
+	if interval <= 0 {
+		interval = defaultInterval
+	}
+	if last := u.loadState(); time.Since(last.CheckedAt) < interval {
+		return nil, nil
+	}
+	return u.Check(ctx)
+}
+
+// Apply downloads the release's binary for this platform, verifies its
+// signature and replaces the running executable with it. The new version
+// runs from the next start. Releases not newer than the running build are
+// refused.
+func (u *Updater) Apply(ctx context.Context, release *Release) error {
+	current := version.Get().Version
+	if !version.Valid(release.Version) || version.Compare(current, release.Version) >= 0 {
+		return fmt.Errorf("%w: %s, running %s", ErrNotNewer, release.Version, current)
+	}
+	key, err := u.publicKey()
+	if err != nil {
+		return err
+	}
+	name := assetName()
+	binaryURL, ok := release.assets[name]
+	if !ok {
+		return fmt.Errorf("%w (%s)", ErrNoAsset, name)
+	}
+	signatureURL, ok := release.assets[name+".sig"]
+	if !ok {
+		return fmt.Errorf("release %s is not signed", release.Version)
+	}
+
+	binary, err := u.download(ctx, binaryURL, maxBinarySize)
+	if err != nil {
+		return err
+	}
+	encoded, err := u.download(ctx, signatureURL, 1024)
+	if err != nil {
+		return err
+	}
+	signature, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(encoded)))
+	if err != nil || !ed25519.Verify(key, signedMessage(release.Version, binary), signature) {
+		return fmt.Errorf("signature of %s %s does not verify; not installing it", name, release.Version)
+	}
+	return replaceExecutable(binary)
+}
+
+// signedMessage is what a release signature covers: the version, a newline
+// and the binary. Signing the version along with the binary keeps an old
+// signed binary from being served as a newer release.
+func signedMessage(version string, binary []byte) []byte {
+	message := make([]byte, 0, len(version)+1+len(binary))
+	message = append(message, version...)
+	message = append(message, '\n')
+	return append(message, binary...)
+}
+
+// publicKey returns the key release signatures are checked with
+func (u *Updater) publicKey() (ed25519.PublicKey, error) {
+	encoded := u.cfg.PublicKey
+	if encoded == "" {
+		encoded = PublicKey
+	}
+	if encoded == "" {
+		return nil, errors.New("no release signing key is configured, so updates can't be verified")
+	}
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return nil, errors.New("invalid release signing key: want a base64 ed25519 public key")
+	}
+	return ed25519.PublicKey(key), nil
+}
+
+// assetName is the file name of the release binary for this platform
+func assetName() string {
+	name := fmt.Sprintf("omnitrix_%s_%s", runtime.GOOS, runtime.GOARCH)
+	if runtime.GOOS == "windows" {
+		name += ".exe"
+	}
+	return name
+}
+
+type githubRelease struct {
+	TagName     string    `json:"tag_name"`
+	HTMLURL     string    `json:"html_url"`
+	Body        string    `json:"body"`
+	PublishedAt time.Time `json:"published_at"`
+	Assets      []struct {
+		Name string `json:"name"`
+		URL  string `json:"browser_download_url"`
+	} `json:"assets"`
+}
+
+// latest fetches the latest release, leaving out drafts and pre-releases
+func (u *Updater) latest(ctx context.Context) (*Release, error) {
+	url := fmt.Sprintf("%s/repos/%s/releases/latest", u.apiBase, u.cfg.Repository)
+	data, err := u.download(ctx, url, 1<<20)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check for updates: %w", err)
+	}
+	var gh githubRelease
+	if err := json.Unmarshal(data, &gh); err != nil {
+		return nil, fmt.Errorf("failed to read release: %w", err)
+	}
+	release := &Release{
+		Version:     gh.TagName,
+		URL:         gh.HTMLURL,
+		Notes:       gh.Body,
+		PublishedAt: gh.PublishedAt,
+		assets:      make(map[string]string, len(gh.Assets)),
+	}
+	for _, asset := range gh.Assets {
+		release.assets[asset.Name] = asset.URL
+	}
+	return release, nil
+}
+
+// download fetches url, failing for responses larger than limit
+func (u *Updater) download(ctx context.Context, url string, limit int64) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "omnitrix/"+version.Get().Version)
+	resp, err := u.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: %s", url, resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, limit+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to download %s: %w", url, err)
+	}
+	if int64(len(data)) > limit {
+		return nil, fmt.Errorf("%s is larger than %d bytes", url, limit)
+	}
+	return data, nil
+}
+
+// replaceExecutable swaps the running executable for binary. The new file
+// is written next to it first, so a failed write leaves the old one
+// intact.
+func replaceExecutable(binary []byte) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to find the running executable: %w", err)
+	}
+	if resolved, err := filepath.EvalSymlinks(exe); err == nil {
+		exe = resolved
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(exe), ".omnitrix-update-*")
+	if err != nil {
+		return fmt.Errorf("failed to write update: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := io.Copy(tmp, bytes.NewReader(binary)); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write update: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write update: %w", err)
+	}
+	if err := os.Chmod(tmp.Name(), 0o755); err != nil {
+		return fmt.Errorf("failed to write update: %w", err)
+	}
+
+	// Windows can't replace a running executable, only rename it
+	if runtime.GOOS == "windows" {
+		old := exe + ".old"
+		os.Remove(old)
+		if err := os.Rename(exe, old); err != nil {
+			return fmt.Errorf("failed to replace %s: %w", exe, err)
+		}
+	}
+	if err := os.Rename(tmp.Name(), exe); err != nil {
+		return fmt.Errorf("failed to replace %s: %w", exe, err)
+	}
+	return nil
+}
+
+// state is what is remembered between checks
+type state struct {
+	CheckedAt time.Time `json:"checked_at"`
+	Latest    string    `json:"latest"`
+}
+
+func (u *Updater) loadState() state {
+	var s state
+	if data, err := os.ReadFile(filepath.Join(u.dataDir, stateFile)); err == nil {
+		json.Unmarshal(data, &s)
+	}
+	return s
+}
+
+// saveState remembers the check. Failing to only means checking again
+// sooner, so errors are ignored.
+func (u *Updater) saveState(s state) {
+	if u.dataDir == "" {
+		return
+	}
+	if data, err := json.Marshal(s); err == nil {
+		os.WriteFile(filepath.Join(u.dataDir, stateFile), data, 0o644)
+	}
+}
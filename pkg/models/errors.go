@@ -0,0 +1,101 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Provider failure classes. Use errors.Is to branch on them.
+var (
+	ErrRateLimited           = errors.New("rate limited")
+	ErrAuth                  = errors.New("authentication failed")
+	ErrContextLengthExceeded = errors.New("context length exceeded")
+	ErrModelNotFound         = errors.New("model not found")
+	ErrOverloaded            = errors.New("provider overloaded")
+)
+
+// ProviderError is returned when a provider API rejects a request
+type ProviderError struct {
+	Provider   ProviderType
+	StatusCode int
+	Message    string
+	Code       string
+	Kind       error // one of the Err* classes above, nil if unclassified
+}
+
+func (e *ProviderError) Error() string {
+	return fmt.Sprintf("%s API error (status %d): %s", e.Provider, e.StatusCode, e.Message)
+}
+
+func (e *ProviderError) Unwrap() error {
+	return e.Kind
+}
+
+// NewProviderError builds a classified error from an HTTP error response
+func NewProviderError(provider ProviderType, statusCode int, body []byte) *ProviderError {
+	message, code := parseErrorBody(body)
+	return &ProviderError{
+		Provider:   provider,
+		StatusCode: statusCode,
+		Message:    message,
+		Code:       code,
+		Kind:       classifyError(statusCode, message, code),
+	}
+}
+
+// parseErrorBody extracts the message and code from the error formats used
+// by OpenAI-compatible APIs ({"error": {"message", "code"}}) and Ollama
+// ({"error": "..."}), falling back to the raw body.
+func parseErrorBody(body []byte) (string, string) {
+	var envelope struct {
+		Error json.RawMessage `json:"error"`
+	}
+	if err := json.Unmarshal(body, &envelope); err == nil && len(envelope.Error) > 0 {
+		var text string
+		if err := json.Unmarshal(envelope.Error, &text); err == nil {
+			return text, ""
+		}
+
+		var detail struct {
+			Message string      `json:"message"`
+			Type    string      `json:"type"`
+			Code    interface{} `json:"code"`
+		}
+		if err := json.Unmarshal(envelope.Error, &detail); err == nil && detail.Message != "" {
+			code := detail.Type
+			if s, ok := detail.Code.(string); ok && s != "" {
+				code = s
+			}
+			return detail.Message, code
+		}
+	}
+
+	return strings.TrimSpace(string(body)), ""
+}
+
+func classifyError(statusCode int, message, code string) error {
+	text := strings.ToLower(message + " " + code)
+
+	switch {
+	case strings.Contains(text, "context_length_exceeded"),
+		strings.Contains(text, "context length"),
+		strings.Contains(text, "context window"),
+		strings.Contains(text, "too many tokens"):
+		return ErrContextLengthExceeded
+	case statusCode == http.StatusTooManyRequests:
+		return ErrRateLimited
+	case statusCode == http.StatusUnauthorized, statusCode == http.StatusForbidden:
+		return ErrAuth
+	case statusCode == http.StatusNotFound && strings.Contains(text, "model"):
+		return ErrModelNotFound
+	case statusCode == http.StatusServiceUnavailable,
+		statusCode == 529,
+		strings.Contains(text, "overloaded"):
+		return ErrOverloaded
+	}
+
+	return nil
+}
@@ -0,0 +1,64 @@
+package models
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// MaxImageSize is the largest image file NewImagePartFromFile will load
+const MaxImageSize = 20 * 1024 * 1024 // 20MB
+
+// NewImagePartFromFile loads an image file as a base64 ImagePart
+func NewImagePartFromFile(path string) (ImagePart, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return ImagePart{}, err
+	}
+	if info.Size() > MaxImageSize {
+		return ImagePart{}, fmt.Errorf("image too large (%d bytes, max %d bytes)", info.Size(), MaxImageSize)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ImagePart{}, err
+	}
+
+	mimeType := http.DetectContentType(data)
+	if !strings.HasPrefix(mimeType, "image/") {
+		return ImagePart{}, fmt.Errorf("not an image: %s (%s)", path, mimeType)
+	}
+
+	return ImagePart{
+		Base64:   base64.StdEncoding.EncodeToString(data),
+		MimeType: mimeType,
+	}, nil
+}
+
+// DataURL returns the image as a URL, encoding inline data as a data: URL
+func (i ImagePart) DataURL() string {
+	if i.Base64 == "" {
+		return i.URL
+	}
+	mimeType := i.MimeType
+	if mimeType == "" {
+		mimeType = "image/png"
+	}
+	return "data:" + mimeType + ";base64," + i.Base64
+}
+
+// InlineData returns the base64 image data, extracting it from a data: URL
+// if needed. It returns "" for images only available at a remote URL.
+func (i ImagePart) InlineData() string {
+	if i.Base64 != "" {
+		return i.Base64
+	}
+	if strings.HasPrefix(i.URL, "data:") {
+		if idx := strings.Index(i.URL, ";base64,"); idx >= 0 {
+			return i.URL[idx+len(";base64,"):]
+		}
+	}
+	return ""
+}
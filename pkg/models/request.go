@@ -0,0 +1,59 @@
+package models
+
+// MapText returns a copy of the request with fn applied to every piece of
+// text sent to the provider: message content, text parts and string values
+// in tool call arguments. The request itself is left unchanged.
+func (r ChatRequest) MapText(fn func(string) string) ChatRequest {
+	messages := make([]Message, len(r.Messages))
+	for i, msg := range r.Messages {
+		msg.Content = fn(msg.Content)
+
+		if len(msg.Parts) > 0 {
+			parts := make([]ContentPart, len(msg.Parts))
+			for j, part := range msg.Parts {
+				if text, ok := part.(TextPart); ok {
+					part = TextPart{Text: fn(text.Text)}
+				}
+				parts[j] = part
+			}
+			msg.Parts = parts
+		}
+
+		if len(msg.ToolCalls) > 0 {
+			calls := make([]ToolCall, len(msg.ToolCalls))
+			for j, tc := range msg.ToolCalls {
+				args := make(map[string]interface{}, len(tc.Function.Arguments))
+				for k, v := range tc.Function.Arguments {
+					args[k] = mapValue(v, fn)
+				}
+				tc.Function.Arguments = args
+				calls[j] = tc
+			}
+			msg.ToolCalls = calls
+		}
+
+		messages[i] = msg
+	}
+	r.Messages = messages
+	return r
+}
+
+func mapValue(v interface{}, fn func(string) string) interface{} {
+	switch v := v.(type) {
+	case string:
+		return fn(v)
+	case []interface{}:
+		values := make([]interface{}, len(v))
+		for i, item := range v {
+			values[i] = mapValue(item, fn)
+		}
+		return values
+	case map[string]interface{}:
+		values := make(map[string]interface{}, len(v))
+		for k, item := range v {
+			values[k] = mapValue(item, fn)
+		}
+		return values
+	}
+	return v
+}
@@ -37,14 +37,82 @@ type Message struct {
 	SessionID  string       `json:"session_id"`
 	Role       Role         `json:"role"`
 	Content    string       `json:"content"`
+	Reasoning  string       `json:"reasoning,omitempty"` // thinking output, never sent back to providers
 	Parts      []ContentPart `json:"parts,omitempty"`
 	ToolCalls  []ToolCall   `json:"tool_calls,omitempty"`
 	ToolCallID string       `json:"tool_call_id,omitempty"`
 	Model      string       `json:"model,omitempty"`
+	Params     *RunParams   `json:"params,omitempty"` // how an assistant message was generated
+	Config     *SessionConfig `json:"config,omitempty"` // the new configuration, for event messages
+	Interrupted bool        `json:"interrupted,omitempty"` // the run was cancelled before this reply was complete
 	CreatedAt  time.Time    `json:"created_at"`
 	UpdatedAt  time.Time    `json:"updated_at"`
 }
 
+// SessionConfig is the configuration a session's prompts are built with
+type SessionConfig struct {
+	Provider     ProviderType `json:"provider"`
+	Model        string       `json:"model"`
+	SystemPrompt string       `json:"system_prompt,omitempty"`
+	Language     string       `json:"language,omitempty"`
+	Mode         string       `json:"mode,omitempty"` // see agent.Mode
+	Tools        []string     `json:"tools,omitempty"`
+	Permissions  string       `json:"permissions,omitempty"` // policy summary
+}
+
+// RunParams records the parameters a response was generated with, so a turn
+// can be investigated and replayed with identical settings
+type RunParams struct {
+	Provider          ProviderType           `json:"provider"`
+	Model             string                 `json:"model"`
+	ResponseModel     string                 `json:"response_model,omitempty"`
+	SystemFingerprint string                 `json:"system_fingerprint,omitempty"`
+	MaxTokens         int                    `json:"max_tokens,omitempty"`
+	Temperature       *float32               `json:"temperature,omitempty"`
+	TopP              *float32               `json:"top_p,omitempty"`
+	Stop              []string               `json:"stop,omitempty"`
+	Seed              *int                   `json:"seed,omitempty"`
+	FrequencyPenalty  *float32               `json:"frequency_penalty,omitempty"`
+	PresencePenalty   *float32               `json:"presence_penalty,omitempty"`
+	ReasoningEffort   string                 `json:"reasoning_effort,omitempty"`
+	ThinkingBudget    int                    `json:"thinking_budget,omitempty"`
+	Options           map[string]interface{} `json:"options,omitempty"`
+}
+
+// NewRunParams captures the generation parameters of a request
+func NewRunParams(provider ProviderType, req ChatRequest) *RunParams {
+	return &RunParams{
+		Provider:         provider,
+		Model:            req.Model,
+		MaxTokens:        req.MaxTokens,
+		Temperature:      req.Temperature,
+		TopP:             req.TopP,
+		Stop:             req.Stop,
+		Seed:             req.Seed,
+		FrequencyPenalty: req.FrequencyPenalty,
+		PresencePenalty:  req.PresencePenalty,
+		ReasoningEffort:  req.ReasoningEffort,
+		ThinkingBudget:   req.ThinkingBudget,
+		Options:          req.Options,
+	}
+}
+
+// ApplyTo sets a request's generation parameters to exactly the recorded
+// ones, replacing whatever the request had
+func (p RunParams) ApplyTo(req *ChatRequest) {
+	req.Model = p.Model
+	req.MaxTokens = p.MaxTokens
+	req.Temperature = p.Temperature
+	req.TopP = p.TopP
+	req.Stop = p.Stop
+	req.Seed = p.Seed
+	req.FrequencyPenalty = p.FrequencyPenalty
+	req.PresencePenalty = p.PresencePenalty
+	req.ReasoningEffort = p.ReasoningEffort
+	req.ThinkingBudget = p.ThinkingBudget
+	req.Options = p.Options
+}
+
 // Role in conversation
 type Role string
 
@@ -53,6 +121,9 @@ const (
 	RoleUser      Role = "user"
 	RoleAssistant Role = "assistant"
 	RoleTool      Role = "tool"
+	// RoleEvent messages record changes to a session's configuration in its
+	// history. They are never sent to providers.
+	RoleEvent Role = "event"
 )
 
 // ContentPart for multi-modal content
@@ -69,10 +140,11 @@ type TextPart struct {
 func (t TextPart) Type() string   { return "text" }
 func (t TextPart) String() string { return t.Text }
 
-// ImagePart is image content
+// ImagePart is image content, either a URL or base64 encoded data
 type ImagePart struct {
-	URL    string `json:"url,omitempty"`
-	Base64 string `json:"base64,omitempty"`
+	URL      string `json:"url,omitempty"`
+	Base64   string `json:"base64,omitempty"`
+	MimeType string `json:"mime_type,omitempty"`
 }
 
 func (i ImagePart) Type() string   { return "image" }
@@ -107,6 +179,7 @@ type Session struct {
 	MessageCount     int       `json:"message_count"`
 	PromptTokens     int64     `json:"prompt_tokens"`
 	CompletionTokens int64     `json:"completion_tokens"`
+	Cost             float64   `json:"cost"` // USD
 	CreatedAt        time.Time `json:"created_at"`
 	UpdatedAt        time.Time `json:"updated_at"`
 }
@@ -125,12 +198,149 @@ type FileChange struct {
 
 // ChatRequest for AI providers
 type ChatRequest struct {
-	Messages    []Message `json:"messages"`
-	Model       string    `json:"model"`
-	MaxTokens   int       `json:"max_tokens,omitempty"`
-	Temperature float32   `json:"temperature,omitempty"`
-	Stream      bool      `json:"stream"`
-	Tools       []Tool    `json:"tools,omitempty"`
+	Messages         []Message `json:"messages"`
+	Model            string    `json:"model"`
+	MaxTokens        int       `json:"max_tokens,omitempty"`
+	Temperature      *float32  `json:"temperature,omitempty"`
+	TopP             *float32  `json:"top_p,omitempty"`
+	Stop             []string  `json:"stop,omitempty"`
+	Seed             *int      `json:"seed,omitempty"`
+	FrequencyPenalty *float32  `json:"frequency_penalty,omitempty"`
+	PresencePenalty  *float32  `json:"presence_penalty,omitempty"`
+	Stream           bool      `json:"stream"`
+	Tools            []Tool    `json:"tools,omitempty"`
+
+	// Reasoning models: ReasoningEffort is "low", "medium", "high" or "none"
+	// to disable thinking, ThinkingBudget caps reasoning tokens
+	ReasoningEffort string `json:"reasoning_effort,omitempty"`
+	ThinkingBudget  int    `json:"thinking_budget,omitempty"`
+
+	// Provider specific overrides, currently used by Ollama
+	Options   map[string]interface{} `json:"options,omitempty"`
+	KeepAlive string                 `json:"keep_alive,omitempty"`
+}
+
+// SamplingParams are default generation settings for a model. Unset fields
+// leave the provider's own defaults in place.
+type SamplingParams struct {
+	MaxTokens        int      `json:"max_tokens,omitempty"`
+	Temperature      *float32 `json:"temperature,omitempty"`
+	TopP             *float32 `json:"top_p,omitempty"`
+	Stop             []string `json:"stop,omitempty"`
+	Seed             *int     `json:"seed,omitempty"`
+	FrequencyPenalty *float32 `json:"frequency_penalty,omitempty"`
+	PresencePenalty  *float32 `json:"presence_penalty,omitempty"`
+	ReasoningEffort  string   `json:"reasoning_effort,omitempty"`
+	ThinkingBudget   int      `json:"thinking_budget,omitempty"`
+}
+
+// ApplyTo fills in any sampling fields the request does not already set
+func (p SamplingParams) ApplyTo(req *ChatRequest) {
+	if req.MaxTokens == 0 {
+		req.MaxTokens = p.MaxTokens
+	}
+	if req.Temperature == nil {
+		req.Temperature = p.Temperature
+	}
+	if req.TopP == nil {
+		req.TopP = p.TopP
+	}
+	if len(req.Stop) == 0 {
+		req.Stop = p.Stop
+	}
+	if req.Seed == nil {
+		req.Seed = p.Seed
+	}
+	if req.FrequencyPenalty == nil {
+		req.FrequencyPenalty = p.FrequencyPenalty
+	}
+	if req.PresencePenalty == nil {
+		req.PresencePenalty = p.PresencePenalty
+	}
+	if req.ReasoningEffort == "" {
+		req.ReasoningEffort = p.ReasoningEffort
+	}
+	if req.ThinkingBudget == 0 {
+		req.ThinkingBudget = p.ThinkingBudget
+	}
+}
+
+// Override sets every sampling field p sets, replacing the request's
+func (p SamplingParams) Override(req *ChatRequest) {
+	if p.MaxTokens != 0 {
+		req.MaxTokens = p.MaxTokens
+	}
+	if p.Temperature != nil {
+		req.Temperature = p.Temperature
+	}
+	if p.TopP != nil {
+		req.TopP = p.TopP
+	}
+	if len(p.Stop) > 0 {
+		req.Stop = p.Stop
+	}
+	if p.Seed != nil {
+		req.Seed = p.Seed
+	}
+	if p.FrequencyPenalty != nil {
+		req.FrequencyPenalty = p.FrequencyPenalty
+	}
+	if p.PresencePenalty != nil {
+		req.PresencePenalty = p.PresencePenalty
+	}
+	if p.ReasoningEffort != "" {
+		req.ReasoningEffort = p.ReasoningEffort
+	}
+	if p.ThinkingBudget != 0 {
+		req.ThinkingBudget = p.ThinkingBudget
+	}
+}
+
+// PromptVariant changes how a recorded turn is sent again, for comparing
+// prompts and parameters. Empty fields keep what the turn was sent with.
+type PromptVariant struct {
+	Name string `json:"name,omitempty"`
+
+	// SystemPrompt replaces the configured system prompt, and
+	// PromptFragments the fragments appended to it. Environment details
+	// and context files are kept.
+	SystemPrompt    string   `json:"system_prompt,omitempty"`
+	PromptFragments []string `json:"prompt_fragments,omitempty"`
+
+	// Model of the same provider
+	Model  string         `json:"model,omitempty"`
+	Params SamplingParams `json:"params,omitempty"`
+}
+
+// ExperimentConfig compares two variants on the turns of real sessions,
+// replaying each turn under both without saving the results to the
+// session
+type ExperimentConfig struct {
+	// Name identifies the experiment's results
+	Name string `json:"name,omitempty"`
+
+	A PromptVariant `json:"a"`
+	B PromptVariant `json:"b"`
+
+	// SampleRate is the share of turns, from 0 to 1, replayed in the
+	// background as they happen. With 0 experiments only run on demand.
+	SampleRate float64 `json:"sample_rate,omitempty"`
+}
+
+// EffectiveReasoningEffort returns the requested reasoning effort, deriving
+// one from ThinkingBudget for providers that only accept effort levels
+func (r ChatRequest) EffectiveReasoningEffort() string {
+	if r.ReasoningEffort != "" || r.ThinkingBudget <= 0 {
+		return r.ReasoningEffort
+	}
+	switch {
+	case r.ThinkingBudget <= 2048:
+		return "low"
+	case r.ThinkingBudget <= 16384:
+		return "medium"
+	default:
+		return "high"
+	}
 }
 
 // ChatResponse from AI providers
@@ -138,18 +348,33 @@ type ChatResponse struct {
 	ID           string     `json:"id"`
 	Model        string     `json:"model"`
 	Content      string     `json:"content"`
+	Reasoning    string     `json:"reasoning,omitempty"`
+	Fingerprint  string     `json:"system_fingerprint,omitempty"` // backend configuration, when the provider reports it
 	ToolCalls    []ToolCall `json:"tool_calls,omitempty"`
 	FinishReason string     `json:"finish_reason"`
 	Usage        TokenUsage `json:"usage"`
+	Cost         float64    `json:"cost,omitempty"` // USD, filled in by the agent
 }
 
+// ChunkKind distinguishes what a stream chunk's Delta contains
+type ChunkKind string
+
+const (
+	ChunkContent   ChunkKind = ""          // answer text
+	ChunkReasoning ChunkKind = "reasoning" // thinking output of reasoning models
+)
+
 // StreamChunk for streaming responses
 type StreamChunk struct {
-	ID           string     `json:"id"`
-	Delta        string     `json:"delta"`
-	ToolCalls    []ToolCall `json:"tool_calls,omitempty"`
-	FinishReason string     `json:"finish_reason,omitempty"`
-	Done         bool       `json:"done"`
+	ID           string      `json:"id"`
+	Kind         ChunkKind   `json:"kind,omitempty"`
+	Delta        string      `json:"delta"`
+	ToolCalls    []ToolCall  `json:"tool_calls,omitempty"`
+	FinishReason string      `json:"finish_reason,omitempty"`
+	Usage        *TokenUsage `json:"usage,omitempty"` // set on the final chunk when the provider reports it
+	Model        string      `json:"model,omitempty"`
+	Fingerprint  string      `json:"system_fingerprint,omitempty"`
+	Done         bool        `json:"done"`
 }
 
 // TokenUsage tracking
@@ -159,6 +384,362 @@ type TokenUsage struct {
 	TotalTokens      int `json:"total_tokens"`
 }
 
+// PostProcessConfig selects the post-processors applied to final assistant
+// output. Inline <think> blocks are stripped unless KeepThinking is set.
+type PostProcessConfig struct {
+	KeepThinking    bool `json:"keep_thinking,omitempty"`
+	NormalizeFences bool `json:"normalize_fences,omitempty"`
+
+	// Language code such as "en" the response must be written in; the model
+	// is asked once to answer again otherwise
+	Language string `json:"language,omitempty"`
+
+	// Regex replacements applied in order
+	Rules []RewriteRule `json:"rules,omitempty"`
+}
+
+// RewriteRule replaces matches of Pattern with Replacement, which may refer
+// to submatches as $1
+type RewriteRule struct {
+	Pattern     string `json:"pattern"`
+	Replacement string `json:"replacement"`
+}
+
+// ToolsConfig selects built-in tools. Enabled adds optional tools such as
+// clipboard and probe to the defaults; Disabled removes tools.
+type ToolsConfig struct {
+	Enabled  []string `json:"enabled,omitempty"`
+	Disabled []string `json:"disabled,omitempty"`
+
+	// Directories outside the working directory the file tools may read
+	// and write, such as a sibling checkout. Relative ones are taken from
+	// the working directory.
+	Roots []string `json:"roots,omitempty"`
+
+	// Paths the file tools leave out, in .gitignore syntax, besides those
+	// in .gitignore and the dependency and build directories left out by
+	// default. A "!" pattern such as "!vendor/" takes one back.
+	Ignore []string `json:"ignore,omitempty"`
+}
+
+// DatabaseConfig is a database the sql_query tool may query
+type DatabaseConfig struct {
+	// "sqlite", "postgres" or "mysql". Unset, it follows from the DSN:
+	// postgres:// and mysql:// URLs, or else a SQLite file.
+	Driver string `json:"driver,omitempty"`
+
+	// Path of a SQLite file in the workspace, taken from the working
+	// directory when relative, or the URL of a Postgres or MySQL server
+	DSN string `json:"dsn"`
+
+	// Allow statements that change the database through the sql_execute
+	// tool. sql_query always runs in a read-only transaction, on a SQLite
+	// file opened read-only.
+	Writable bool `json:"writable,omitempty"`
+}
+
+// PluginsConfig is where tools and providers shipped as separate programs
+// are started from, see package plugin
+type PluginsConfig struct {
+	// Directory whose executables are started as plugins, by default
+	// ~/.config/omnitrix/plugins. Only the user's config may set it.
+	Dir string `json:"dir,omitempty"`
+
+	// File or manifest names of plugins not to start
+	Disabled []string `json:"disabled,omitempty"`
+}
+
+// FormatterConfig runs a formatter or linter, such as gofmt or eslint
+// --fix, on the files tools write
+type FormatterConfig struct {
+	// Shell command run in the working directory with the files appended,
+	// quoted for the shell, e.g. "gofmt -w"
+	Command string `json:"command"`
+
+	// Files it applies to as globs, e.g. ["*.go"]. Patterns with a slash
+	// match the path from the working directory, others the file name.
+	Files []string `json:"files"`
+
+	// Seconds it may take, 30 if unset
+	Timeout int `json:"timeout,omitempty"`
+}
+
+// CommandToolConfig defines a tool that runs a shell command, for project
+// tasks the model should run the same way every time
+type CommandToolConfig struct {
+	// What the model is told the tool does
+	Description string `json:"description"`
+
+	// Command run by the exec tool's shell. {{name}} is replaced by the
+	// argument of that name, quoted for the shell.
+	Command string `json:"command"`
+
+	// Arguments the model passes, with what it is told about them. Each is
+	// a required string.
+	Args map[string]string `json:"args,omitempty"`
+
+	// JSON schema of the arguments, an object, for tools needing more
+	// than Args: optional arguments, numbers, lists or enums. Placeholders
+	// of arguments left out are removed.
+	Parameters map[string]interface{} `json:"parameters,omitempty"`
+
+	// Pass the arguments to the command as a JSON object on its standard
+	// input, for scripts that would rather parse them than take them on
+	// the command line
+	Stdin bool `json:"stdin,omitempty"`
+
+	// Risk level deciding whether running it needs approval: "read",
+	// "write", "execute" (default) or "network". Tools the project's config
+	// defines or changes count as "execute" at least.
+	Risk string `json:"risk,omitempty"`
+
+	// Project is set by config.Load for tools of the project's config
+	Project bool `json:"-"`
+}
+
+// CheckpointConfig configures the snapshots of the working tree taken
+// before each agent turn, so changes the agent made can be rolled back.
+// Files ignored by .gitignore are not included.
+type CheckpointConfig struct {
+	// On by default; needs git installed
+	Enabled bool `json:"enabled"`
+
+	// Checkpoints kept per session, 50 if unset
+	Keep int `json:"keep,omitempty"`
+}
+
+// MessageLimitsConfig caps the size of single messages in bytes, so one
+// pasted log file can't fill the context of every later prompt. Content
+// over a limit is kept as an attachment the model can page through, and
+// the message keeps only its start and end.
+type MessageLimitsConfig struct {
+	// Limit for user messages, 100000 if unset; -1 for no limit
+	User int `json:"user,omitempty"`
+
+	// Limit for tool results, 50000 if unset; -1 for no limit
+	Tool int `json:"tool,omitempty"`
+
+	// Limits for the results of single tools, by tool name, replacing Tool
+	Tools map[string]int `json:"tools,omitempty"`
+
+	// Limit for all tool results of one response together; 0 for none.
+	// When they are larger the largest results are shortened until they
+	// fit.
+	ToolTotal int `json:"tool_total,omitempty"`
+
+	// How much of an oversized message is kept in it, 4000 if unset
+	Preview int `json:"preview,omitempty"`
+}
+
+// RunLimits caps what a single run, one user message and the tool calls it
+// leads to, may use
+type RunLimits struct {
+	// Provider calls per run, 10 if unset
+	MaxIterations int `json:"max_iterations,omitempty"`
+
+	// Cost in USD per run; 0 for no limit. Only models with known prices
+	// count towards it.
+	MaxCost float64 `json:"max_cost,omitempty"`
+}
+
+// CIConfig configures omnitrix ci, the non-interactive mode for CI jobs
+type CIConfig struct {
+	// Tools approved without asking, on top of what the permissions allow.
+	// Everything else that needs approval is declined.
+	Allow []string `json:"allow,omitempty"`
+
+	RunLimits
+
+	// Timeout of the whole run, such as "10m"; none if unset
+	Timeout string `json:"timeout,omitempty"`
+}
+
+// UpdateConfig controls checking for new releases. Nothing is checked
+// unless Check is set; updating is always up to the user. Only the user
+// config can set it, so a project can't point updates at another
+// repository or key.
+type UpdateConfig struct {
+	Check bool `json:"check,omitempty"`
+
+	// Hours between checks, 24 if unset
+	IntervalHours int `json:"interval_hours,omitempty"`
+
+	// GitHub repository releases come from, omnitrix-sh/core.sh if unset
+	Repository string `json:"repository,omitempty"`
+
+	// Base64 ed25519 key releases are signed with, replacing the one built
+	// in, e.g. for builds from a fork. Signatures cover the version, a
+	// newline and the binary.
+	PublicKey string `json:"public_key,omitempty"`
+}
+
+// ToolExecutionConfig controls how the tool calls of one response run
+type ToolExecutionConfig struct {
+	// Calls of read-only tools run concurrently on up to Workers at a
+	// time, 4 if unset; 1 runs every call in turn. Tools that change
+	// something always run alone, in the order the model called them.
+	Workers int `json:"workers,omitempty"`
+
+	// Timeout of a tool call in seconds, counted from its approval; none
+	// if unset. Tools with timeouts of their own, such as exec, keep them
+	// as well.
+	Timeout int `json:"timeout,omitempty"`
+
+	// Timeouts by tool name, in seconds, replacing Timeout for those tools
+	Timeouts map[string]int `json:"timeouts,omitempty"`
+}
+
+// TaskConfig configures the task tool, which hands work to a sub-agent
+// with its own context
+type TaskConfig struct {
+	// Disabled removes the task tool
+	Disabled bool `json:"disabled,omitempty"`
+
+	// Tools of sub-agents, by name; every tool that only reads if unset.
+	// Sub-agents never get the task tool itself.
+	Tools []string `json:"tools,omitempty"`
+
+	// Provider calls per task, 15 if unset
+	MaxIterations int `json:"max_iterations,omitempty"`
+}
+
+// MemoryConfig configures long-term memory: facts and preferences the
+// model saves with the remember tool and gets back in later sessions
+type MemoryConfig struct {
+	// Disabled removes the remember tool and stops recalling memories
+	Disabled bool `json:"disabled,omitempty"`
+
+	// EmbeddingModel picks the memories relevant to each message, served by
+	// the chat provider. retrieval.embedding_model is used if unset; with
+	// neither, the most recent memories are recalled.
+	EmbeddingModel string `json:"embedding_model,omitempty"`
+
+	// TopK is the most memories recalled per message (default 5)
+	TopK int `json:"top_k,omitempty"`
+
+	// MinScore is the cosine similarity a memory needs to the message to
+	// be recalled (default 0.3)
+	MinScore float64 `json:"min_score,omitempty"`
+}
+
+// CodeSearchConfig configures the semantic_search tool, which finds code
+// by meaning with embeddings of the workspace's files
+type CodeSearchConfig struct {
+	// Disabled removes the semantic_search tool
+	Disabled bool `json:"disabled,omitempty"`
+
+	// EmbeddingModel embeds the files and queries, served by the chat
+	// provider. retrieval.embedding_model is used if unset; with neither,
+	// the tool is not offered.
+	EmbeddingModel string `json:"embedding_model,omitempty"`
+}
+
+// RepoMapConfig configures the repo map: an outline of the workspace's
+// source files and their exported symbols, added to the system prompt so
+// the model knows its way around a project from the first message
+type RepoMapConfig struct {
+	// Enabled adds the repo map to the system prompt
+	Enabled bool `json:"enabled,omitempty"`
+
+	// MaxTokens the repo map takes up at most, 1024 if unset. Larger
+	// projects are outlined in less detail.
+	MaxTokens int `json:"max_tokens,omitempty"`
+}
+
+// ExecConfig configures the exec tool
+type ExecConfig struct {
+	// Shell used to run commands, default bash if installed or sh
+	Shell string `json:"shell,omitempty"`
+
+	// Default timeout in seconds, 120 if unset
+	Timeout int `json:"timeout,omitempty"`
+
+	// Output beyond this many bytes per stream is truncated in the middle,
+	// 30000 if unset. Only that much of it is ever held in memory.
+	MaxOutput int `json:"max_output,omitempty"`
+
+	// Keep the working directory and exported variables between commands
+	Persistent bool `json:"persistent,omitempty"`
+
+	// Run commands isolated from the host
+	Sandbox SandboxConfig `json:"sandbox,omitempty"`
+}
+
+// SandboxConfig isolates the commands the exec tool runs. The working
+// directory stays writable; the rest of the filesystem is the container
+// image's, or read-only with the namespace backend.
+type SandboxConfig struct {
+	// "docker", "podman" or "namespace" (a bubblewrap user namespace, Linux
+	// only). Empty runs commands directly on the host.
+	Backend string `json:"backend,omitempty"`
+
+	// Container image, debian:stable-slim if unset
+	Image string `json:"image,omitempty"`
+
+	// Allow network access, off by default
+	Network bool `json:"network,omitempty"`
+
+	// Limits per command. CPUs may be fractional, e.g. 1.5, and only the
+	// container backends apply them; the namespace backend caps the memory
+	// of each process and the number of processes with prlimit.
+	CPUs     float64 `json:"cpus,omitempty"`
+	MemoryMB int     `json:"memory_mb,omitempty"`
+	Pids     int     `json:"pids,omitempty"`
+}
+
+// PermissionsConfig sets the policy for running tools. Actions are "allow",
+// "deny" or "ask". When several rules apply the most restrictive wins.
+type PermissionsConfig struct {
+	// Action per risk level ("read", "write", "execute", "network"). By
+	// default reads are allowed and everything else asks.
+	Risks map[string]string `json:"risks,omitempty"`
+
+	// Action per tool name
+	Tools map[string]string `json:"tools,omitempty"`
+
+	// Actions for tools touching paths matching a glob, relative to the
+	// working directory, e.g. {"pattern": ".env*", "action": "deny"}
+	Paths []PathPermission `json:"paths,omitempty"`
+}
+
+// PathPermission applies an action to paths matching a glob pattern
+type PathPermission struct {
+	Pattern string `json:"pattern"`
+	Action  string `json:"action"`
+}
+
+// ModelPrice is the price of a model in USD per million tokens
+type ModelPrice struct {
+	Input  float64 `json:"input"`
+	Output float64 `json:"output"`
+}
+
+// ModelAlias is the model a short name stands for. Without a provider it
+// names the model of whichever provider is used.
+type ModelAlias struct {
+	Provider ProviderType `json:"provider,omitempty"`
+	Model    string       `json:"model"`
+}
+
+// ModelProfile is what is known about a model: its generation defaults,
+// context window, capabilities and price. Unset fields fall back to the
+// built-in catalog and then to the provider's own defaults.
+type ModelProfile struct {
+	SamplingParams
+
+	// Context window in tokens, see Config.ContextOverflow
+	ContextSize int `json:"context_size,omitempty"`
+
+	// Whether the model takes tools and images. Tools aren't offered to a
+	// model without tool calling, and images sent to one without vision
+	// are replaced by a note.
+	SupportsTools  *bool `json:"supports_tools,omitempty"`
+	SupportsVision *bool `json:"supports_vision,omitempty"`
+
+	// Price per million tokens, overriding the built-in one
+	Price *ModelPrice `json:"price,omitempty"`
+}
+
 // Tool definition for function calling
 type Tool struct {
 	Type     string       `json:"type"` // "function"
@@ -180,6 +761,11 @@ type Config struct {
 	// Working directory
 	WorkDir string `json:"work_dir"`
 
+	// Delay in milliseconds before a turn's messages are written to the
+	// database. 0 writes each step of a turn as it completes; a delay lets
+	// concurrent sessions share fewer, larger transactions.
+	WriteBehindMS int `json:"write_behind_ms,omitempty"`
+
 	// AI Providers
 	Providers map[ProviderType]ProviderConfig `json:"providers"`
 
@@ -189,22 +775,313 @@ type Config struct {
 	// Default provider
 	DefaultProvider string `json:"default_provider"`
 
+	// Short names for models, such as "fast" or "local", accepted wherever
+	// a model name is
+	Aliases map[string]ModelAlias `json:"aliases,omitempty"`
+
+	// Sampling defaults keyed by model name, "*" applies to every model
+	ModelParams map[string]SamplingParams `json:"model_params,omitempty"`
+
+	// Model profiles keyed by model name, layered over the built-in
+	// catalog and model_params; "*" applies to every model
+	Models map[string]ModelProfile `json:"models,omitempty"`
+
 	// LSP configurations
 	LSP map[string]LSPConfig `json:"lsp"`
 
+	// System prompt sent first in every request, before environment details
+	// and context files. Empty uses the built-in prompt.
+	SystemPrompt string `json:"system_prompt,omitempty"`
+
+	// Extra instructions appended to the system prompt, e.g. project
+	// conventions. Fragments from the user and project config both apply.
+	PromptFragments []string `json:"prompt_fragments,omitempty"`
+
 	// Context files to include
 	ContextPaths []string `json:"context_paths"`
 
+	// Outline of the workspace's files and symbols in the system prompt
+	RepoMap RepoMapConfig `json:"repo_map,omitempty"`
+
+	// What to do when a prompt exceeds the model's context window: "trim"
+	// (default) drops the oldest history, "compact" summarizes it first,
+	// "retrieve" drops it but brings back the earlier messages most relevant
+	// to the new one (see Retrieval) and "reject" fails the request
+	ContextOverflow string `json:"context_overflow,omitempty"`
+
+	// Embedding settings for the "retrieve" overflow policy
+	Retrieval RetrievalConfig `json:"retrieval,omitempty"`
+
+	// How tool schemas are sent: "full" (default), "compact" to send short
+	// schemas and expand a tool once the model uses it, or "auto" to compact
+	// only for models known to handle it
+	ToolSchemas string `json:"tool_schemas,omitempty"`
+
+	// Token prices keyed by model name, overriding the built-in catalog
+	Pricing map[string]ModelPrice `json:"pricing,omitempty"`
+
+	// Opt-in logging of the prompts sent to providers
+	PromptLog PromptLogConfig `json:"prompt_log,omitempty"`
+
+	// Language code such as "de" for the assistant's explanations; code is
+	// left unchanged. Sessions can choose their own.
+	Language string `json:"language,omitempty"`
+
+	// Agent mode of sessions that haven't chosen one: "build" (default),
+	// or "plan" for read-only tools and a plan as the answer
+	Mode string `json:"mode,omitempty"`
+
+	// Opt-in archive of provider requests and responses in the database
+	Archive ArchiveConfig `json:"archive,omitempty"`
+
+	// Scanning of requests to providers for credentials
+	Secrets SecretsConfig `json:"secrets,omitempty"`
+
+	// Replacing of identifying details in requests to cloud providers
+	Pseudonymize PseudonymizeConfig `json:"pseudonymize,omitempty"`
+
+	// Snapshots of the working tree taken before each agent turn
+	Checkpoints CheckpointConfig `json:"checkpoints,omitempty"`
+
+	// Rewriting of final assistant output before it is saved and returned
+	PostProcess PostProcessConfig `json:"post_process,omitempty"`
+
+	// Which built-in tools are available, usually adjusted per project
+	Tools ToolsConfig `json:"tools,omitempty"`
+
+	// Concurrency and timeouts of tool calls
+	ToolExecution ToolExecutionConfig `json:"tool_execution,omitempty"`
+
+	// Sub-agents started with the task tool
+	Tasks TaskConfig `json:"tasks,omitempty"`
+
+	// Facts and preferences remembered across sessions
+	Memory MemoryConfig `json:"memory,omitempty"`
+
+	// The semantic_search tool, finding code by meaning
+	CodeSearch CodeSearchConfig `json:"code_search,omitempty"`
+
+	// Settings for the exec tool
+	Exec ExecConfig `json:"exec,omitempty"`
+
+	// Tools running shell commands, keyed by tool name
+	Commands map[string]CommandToolConfig `json:"commands,omitempty"`
+
+	// Databases the sql_query tool may query, keyed by name
+	Databases map[string]DatabaseConfig `json:"databases,omitempty"`
+
+	// Formatters and linters run, in order, on the files tools write; what
+	// they can't fix is added to the tool's result
+	Formatters []FormatterConfig `json:"formatters,omitempty"`
+
+	// Programs offering more tools and providers
+	Plugins PluginsConfig `json:"plugins,omitempty"`
+
+	// Prompt library: reusable prompts keyed by name, which frontends offer
+	// as shortcuts
+	Prompts map[string]string `json:"prompts,omitempty"`
+
+	// Size limits of single messages
+	MessageLimits MessageLimitsConfig `json:"message_limits,omitempty"`
+
+	// A/B comparison of prompt or parameter variants
+	Experiment ExperimentConfig `json:"experiment,omitempty"`
+
+	// Non-interactive runs in CI
+	CI CIConfig `json:"ci,omitempty"`
+
+	// Which tool executions are allowed, denied or need the user's approval
+	Permissions PermissionsConfig `json:"permissions,omitempty"`
+
+	// How streamed responses are delivered to slow consumers
+	Stream StreamConfig `json:"stream,omitempty"`
+
+	// How times, sizes and durations are shown
+	Display DisplayConfig `json:"display,omitempty"`
+
+	// Settings for serving sessions to other frontends
+	Server ServerConfig `json:"server,omitempty"`
+
+	// Checking for new releases
+	Update UpdateConfig `json:"update,omitempty"`
+
+	// Environment variables for tool executions in every session. Sessions
+	// can add their own; values are scrubbed from requests to providers.
+	Env map[string]string `json:"env,omitempty"`
+
 	// Debug mode
 	Debug bool `json:"debug"`
 }
 
+// PromptLogConfig controls prompt logging for debugging context management.
+// Secrets are always redacted; Mode decides how much of the rest is kept.
+type PromptLogConfig struct {
+	Enabled bool `json:"enabled"`
+
+	// Mode is "redacted" (default) to strip file contents and code blocks,
+	// "paths_only" to keep only message sizes and referenced paths, or
+	// "full" to keep everything except secrets
+	Mode string `json:"mode,omitempty"`
+
+	// Dir defaults to <data_dir>/prompts
+	Dir string `json:"dir,omitempty"`
+
+	// RedactPatterns are extra regular expressions to mask, such as
+	// internal hostnames or customer names
+	RedactPatterns []string `json:"redact_patterns,omitempty"`
+}
+
+// RetrievalConfig controls how earlier messages are brought back into a
+// prompt that no longer fits the context window
+type RetrievalConfig struct {
+	// EmbeddingModel is served by the chat provider, e.g. "nomic-embed-text"
+	// for Ollama. Retrieval is off without one.
+	EmbeddingModel string `json:"embedding_model,omitempty"`
+
+	// TopK is the most earlier messages brought back (default 5)
+	TopK int `json:"top_k,omitempty"`
+
+	// MinScore is the cosine similarity a message needs to the new one to
+	// be brought back (default 0.3)
+	MinScore float64 `json:"min_score,omitempty"`
+}
+
+// StreamConfig controls delivery of streamed responses
+type StreamConfig struct {
+	// Buffer is the capacity of the channel deltas are delivered on
+	// (default 64)
+	Buffer int `json:"buffer,omitempty"`
+
+	// Deltas shorter than CoalesceBytes wait up to CoalesceMS milliseconds
+	// to be merged with the next ones
+	CoalesceBytes int `json:"coalesce_bytes,omitempty"`
+	CoalesceMS    int `json:"coalesce_ms,omitempty"`
+
+	// SlowConsumer is "buffer" (default) to hold every delta until the
+	// consumer catches up, or "drop" to skip text once MaxBacklog bytes
+	// are waiting. Skipped text is still saved with the response.
+	SlowConsumer string `json:"slow_consumer,omitempty"`
+	MaxBacklog   int    `json:"max_backlog,omitempty"`
+}
+
+// DisplayConfig controls how output is presented to the user
+type DisplayConfig struct {
+	// Locale such as "de_DE" or "en-US", defaults to LC_ALL, LC_TIME or LANG
+	Locale string `json:"locale,omitempty"`
+
+	// Timezone is an IANA name such as "Europe/Berlin", defaults to local
+	Timezone string `json:"timezone,omitempty"`
+
+	// Plain output for screen readers: no colors, box drawing or aligned
+	// tables
+	Plain bool `json:"plain,omitempty"`
+}
+
+// SecretsConfig controls the scan for credentials in everything sent to
+// providers
+type SecretsConfig struct {
+	// "redact" (default) masks secrets, "block" refuses to send the request
+	// and "off" sends it unchanged
+	Policy string `json:"policy,omitempty"`
+
+	// Policy per provider, overriding Policy. Ollama runs locally, so it
+	// defaults to "off".
+	Providers map[string]string `json:"providers,omitempty"`
+
+	// Extra regular expressions to treat as secrets
+	Patterns []string `json:"patterns,omitempty"`
+
+	// Findings to let through, usually set per project for fixtures and
+	// example keys: a rule name such as "jwt" lets through all it finds,
+	// anything else is a regular expression the whole secret must match
+	Allow []string `json:"allow,omitempty"`
+
+	// External scanner run with the text on stdin, e.g. ["gitleaks",
+	// "stdin", "--report-format", "json", "--report-path", "-"]. It prints
+	// gitleaks JSON findings or one secret per line. Only the user's config
+	// can set it.
+	Command []string `json:"command,omitempty"`
+}
+
+// PseudonymizeConfig replaces project names, host names, emails and
+// addresses in requests to cloud providers with stand-ins, and puts the
+// originals back in responses
+type PseudonymizeConfig struct {
+	Enabled bool `json:"enabled"`
+
+	// Names to hide wherever they appear, ignoring case, such as project,
+	// customer and product names
+	Terms []string `json:"terms,omitempty"`
+
+	// What is detected besides Terms: "emails", "hosts" and "ips", all of
+	// them if unset
+	Detect []string `json:"detect,omitempty"`
+
+	// Hosts and addresses to leave alone, with their subdomains, on top of
+	// well-known public ones such as github.com and pypi.org
+	Allow []string `json:"allow,omitempty"`
+
+	// Providers it applies to; every provider except ollama if unset
+	Providers []string `json:"providers,omitempty"`
+}
+
+// ServerConfig configures server mode
+type ServerConfig struct {
+	// Address to listen on, default 127.0.0.1:7433
+	Addr string `json:"addr,omitempty"`
+
+	TLS TLSConfig `json:"tls,omitempty"`
+}
+
+// TLSConfig secures connections to the server. With neither a certificate
+// nor SelfSigned the server only accepts plain connections on loopback.
+type TLSConfig struct {
+	// PEM certificate and key to serve
+	CertFile string `json:"cert_file,omitempty"`
+	KeyFile  string `json:"key_file,omitempty"`
+
+	// Generate a self-signed certificate, kept in the data directory, when
+	// no certificate is given. Clients pin its fingerprint.
+	SelfSigned bool `json:"self_signed,omitempty"`
+
+	// Names and addresses the self-signed certificate is valid for,
+	// localhost and the loopback addresses if unset
+	Hosts []string `json:"hosts,omitempty"`
+
+	// Require clients to present a certificate signed by this PEM CA (mTLS)
+	ClientCAFile string `json:"client_ca_file,omitempty"`
+}
+
+// ArchiveConfig controls archiving of provider exchanges. Entries are
+// compressed and secrets are always redacted.
+type ArchiveConfig struct {
+	Enabled bool `json:"enabled"`
+
+	// MaxEntries caps the number of archived exchanges, oldest dropped
+	// first (default 1000)
+	MaxEntries int `json:"max_entries,omitempty"`
+
+	// MaxAgeDays drops exchanges older than this (default 30)
+	MaxAgeDays int `json:"max_age_days,omitempty"`
+
+	// RedactPatterns are extra regular expressions to mask
+	RedactPatterns []string `json:"redact_patterns,omitempty"`
+}
+
 // ProviderConfig for each AI provider
 type ProviderConfig struct {
 	Enabled  bool   `json:"enabled"`
+	// The URL and key are only read from the user's config, where they
+	// may be env: or keyring: references
 	BaseURL  string `json:"base_url"`
 	APIKey   string `json:"api_key,omitempty"`
 	Models   []string `json:"models,omitempty"`
+
+	// Ollama model options (num_ctx, num_predict, num_gpu, temperature, ...)
+	Options map[string]interface{} `json:"options,omitempty"`
+
+	// How long Ollama keeps the model loaded, e.g. "10m", or "-1" for forever
+	KeepAlive string `json:"keep_alive,omitempty"`
 }
 
 // LSPConfig for language servers
@@ -212,4 +1089,9 @@ type LSPConfig struct {
 	Command string   `json:"command"`
 	Args    []string `json:"args"`
 	Enabled bool     `json:"enabled"`
+
+	// File extensions the server handles, e.g. [".ts", ".tsx"]. Defaults
+	// to the usual extensions when the entry is named after a language,
+	// like "go" or "python".
+	Extensions []string `json:"extensions,omitempty"`
 }